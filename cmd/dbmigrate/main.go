@@ -0,0 +1,98 @@
+// Command dbmigrate copies the legacy Python app's SQLite database (users, pages and cached
+// external results) into the PostgreSQL database of cmd/server.
+//
+//	go run ./cmd/dbmigrate -from src/database/whoknows.db -to "$DATABASE_URL" -dry-run
+//	go run ./cmd/dbmigrate -from src/database/whoknows.db -to "$DATABASE_URL"
+//
+// The target must already be migrated (start cmd/server against it once). Rows that already
+// exist there are skipped, so the import can be re-run. Legacy MD5 password hashes are
+// wrapped in bcrypt; with -passwords=reset every imported account must also choose a new
+// password. See internal/legacyimport for the mapping.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"devops-valgfag/internal/legacyimport"
+	"devops-valgfag/internal/logscrub"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	logscrub.Install() // skipped users and failed rows are logged with their values
+	from := flag.String("from", "src/database/whoknows.db", "legacy SQLite database file")
+	to := flag.String("to", os.Getenv("DATABASE_URL"), "target PostgreSQL DSN (default $DATABASE_URL; optional with -dry-run)")
+	passwords := flag.String("passwords", string(legacyimport.PasswordsRehash), "rehash: users keep their password; reset: users must choose a new one")
+	tenant := flag.Int("tenant", 1, "tenant ID for the imported pages and external results")
+	dryRun := flag.Bool("dry-run", false, "read and map everything, write nothing (inserts are rolled back)")
+	batch := flag.Int("batch", 500, "rows between progress reports")
+	flag.Parse()
+
+	mode, err := legacyimport.ParsePasswordMode(*passwords)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Stat(*from); err != nil {
+		log.Fatal(err)
+	}
+	src, err := sql.Open("sqlite", "file:"+*from+"?mode=ro")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = src.Close() }()
+
+	var dst *sql.DB
+	switch {
+	case *to != "":
+		if dst, err = sql.Open("pgx", *to); err != nil {
+			log.Fatal(err)
+		}
+		defer func() { _ = dst.Close() }()
+		if err := dst.Ping(); err != nil {
+			log.Fatal("Failed to connect to PostgreSQL: ", err)
+		}
+	case !*dryRun:
+		log.Fatal("-to (or DATABASE_URL) is required unless -dry-run is set")
+	default:
+		log.Println("No target database: the dry run only reads the legacy file.")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	reports, err := legacyimport.Run(ctx, src, dst, legacyimport.Options{
+		Tenant:    *tenant,
+		Passwords: mode,
+		DryRun:    *dryRun,
+		BatchSize: *batch,
+		Progress: func(table string, done, total int) {
+			log.Printf("%s: %d/%d rows", table, done, total)
+		},
+	})
+
+	verb := "inserted"
+	if *dryRun {
+		verb = "would insert"
+	}
+	for _, r := range reports {
+		if r.Missing {
+			fmt.Printf("%-17s not in the legacy database\n", r.Table)
+			continue
+		}
+		fmt.Printf("%-17s read %d, %s %d, skipped %d existing, %d invalid\n", r.Table, r.Read, verb, r.Inserted, r.Skipped, r.Invalid)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dryRun {
+		fmt.Println("Dry run: nothing was written.")
+	}
+}
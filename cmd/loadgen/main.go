@@ -0,0 +1,204 @@
+// Command loadgen replays a realistic search query distribution against a running
+// WhoKnows instance and reports throughput and latency percentiles.
+//
+//	go run ./cmd/loadgen -base http://localhost:8080 -c 20 -d 30s
+//
+// Queries come from internal/benchdata (Zipf-distributed, like the benchmark dataset),
+// so seeding the target with the same generator gives realistic hit rates. /api/search
+// needs a session: pass -user/-password to log in first.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/benchdata"
+)
+
+type result struct {
+	latency time.Duration
+	status  int // 0 = transport error
+}
+
+func main() {
+	base := flag.String("base", "http://localhost:8080", "base URL of the instance under test")
+	path := flag.String("path", "/search?format=json", "search endpoint; the query is appended as q=...")
+	lang := flag.String("lang", "en", "language parameter")
+	concurrency := flag.Int("c", 10, "concurrent workers")
+	duration := flag.Duration("d", 30*time.Second, "test duration")
+	rate := flag.Int("rps", 0, "max requests per second across all workers (0 = as fast as possible)")
+	distinct := flag.Int("queries", 2000, "length of the generated query stream (replayed in a loop)")
+	zipf := flag.Float64("zipf", 1.2, "Zipf skew of the query distribution (> 1; higher = more repeats)")
+	seed := flag.Int64("seed", 1, "random seed for the query stream")
+	user := flag.String("user", "", "username to log in with (needed for /api/search)")
+	password := flag.String("password", "", "password for -user")
+	timeout := flag.Duration("timeout", 10*time.Second, "per-request timeout")
+	flag.Parse()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Timeout: *timeout,
+		Jar:     jar,
+		Transport: &http.Transport{
+			MaxIdleConns:        *concurrency,
+			MaxIdleConnsPerHost: *concurrency,
+		},
+	}
+
+	if *user != "" {
+		if err := login(client, *base, *user, *password); err != nil {
+			log.Fatalf("login failed: %v", err)
+		}
+	}
+
+	queries := benchdata.Queries(*distinct, *seed, *zipf)
+	sep := "?"
+	if strings.Contains(*path, "?") {
+		sep = "&"
+	}
+	target := strings.TrimSuffix(*base, "/") + *path + sep + "language=" + url.QueryEscape(*lang) + "&q="
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+
+	var ticks <-chan time.Time
+	if *rate > 0 {
+		t := time.NewTicker(time.Second / time.Duration(*rate))
+		defer t.Stop()
+		ticks = t.C
+	}
+
+	var (
+		next    atomic.Int64
+		mu      sync.Mutex
+		results []result
+		wg      sync.WaitGroup
+	)
+	start := time.Now()
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := make([]result, 0, 1024)
+			defer func() {
+				mu.Lock()
+				results = append(results, local...)
+				mu.Unlock()
+			}()
+			for {
+				if ticks != nil {
+					select {
+					case <-ticks:
+					case <-ctx.Done():
+						return
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				q := queries[int(next.Add(1)-1)%len(queries)]
+				local = append(local, fire(ctx, client, target+url.QueryEscape(q)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	report(os.Stdout, results, time.Since(start))
+}
+
+// fire sends one request; requests cut off by the end of the run are not counted as errors.
+func fire(ctx context.Context, client *http.Client, u string) result {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return result{}
+	}
+	req.Header.Set("Accept", "application/json")
+
+	t := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return result{status: -1}
+		}
+		return result{latency: time.Since(t)}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return result{latency: time.Since(t), status: resp.StatusCode}
+}
+
+// login stores a session cookie in the client's jar. /api/login redirects on success and
+// re-renders the form (200) on failure, so only the redirect counts.
+func login(client *http.Client, base, user, password string) error {
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	form := url.Values{"username": {user}, "password": {password}}
+	resp, err := noRedirect.PostForm(strings.TrimSuffix(base, "/")+"/api/login", form)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusFound {
+		return fmt.Errorf("invalid credentials (status %d)", resp.StatusCode)
+	}
+	return nil
+}
+
+func report(w io.Writer, results []result, elapsed time.Duration) {
+	var (
+		latencies []time.Duration
+		errors    int
+		statuses  = map[int]int{}
+	)
+	for _, r := range results {
+		switch {
+		case r.status == -1:
+			continue // aborted at the end of the run
+		case r.status == 0:
+			errors++
+		default:
+			statuses[r.status]++
+			latencies = append(latencies, r.latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	total := len(latencies) + errors
+	_, _ = fmt.Fprintf(w, "requests:   %d in %s (%.1f req/s)\n", total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
+	_, _ = fmt.Fprintf(w, "errors:     %d\n", errors)
+
+	codes := make([]int, 0, len(statuses))
+	for c := range statuses {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	for _, c := range codes {
+		_, _ = fmt.Fprintf(w, "status %d: %d\n", c, statuses[c])
+	}
+
+	if len(latencies) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "latency:    p50=%s p95=%s p99=%s max=%s\n",
+		percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99), latencies[len(latencies)-1].Round(time.Microsecond))
+}
+
+// percentile returns the p-th percentile of sorted latencies (nearest rank).
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted))*p/100+0.5) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return sorted[idx].Round(time.Microsecond)
+}
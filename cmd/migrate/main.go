@@ -0,0 +1,129 @@
+// Command migrate applies the pending database migrations without starting the server, for
+// deploy pipelines that migrate before rolling out, and reports schema drift.
+//
+//	go run ./cmd/migrate -dsn "$DATABASE_URL"                      # apply migrations/
+//	go run ./cmd/migrate -driver sqlite -status                    # list pending, apply nothing
+//	go run ./cmd/migrate -status -metrics-file /var/lib/node_exporter/migrate.prom
+//
+// Run it from the repository root (or pass -dir). The run is exported like at server startup
+// (app_migration_duration_seconds, app_migrations_applied, app_migrations_pending,
+// app_migration_last_version, app_migration_failures_total); -metrics-file writes them in the
+// Prometheus text format for the node_exporter textfile collector, also when the run fails.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/migrate"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func main() {
+	driver := flag.String("driver", os.Getenv("DB_DRIVER"), "postgres or sqlite (default $DB_DRIVER, postgres if unset)")
+	dsn := flag.String("dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN (default $DATABASE_URL)")
+	path := flag.String("path", getenv("DATABASE_PATH", "data/whoknows.db"), "SQLite file (default $DATABASE_PATH)")
+	dir := flag.String("dir", "", "migrations directory (default migrations, or migrations/sqlite for SQLite)")
+	status := flag.Bool("status", false, "only report applied and pending migrations")
+	metricsFile := flag.String("metrics-file", "", "write the migration metrics to this file (Prometheus text format)")
+	flag.Parse()
+
+	d, err := dialect.Parse(*driver)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dir == "" {
+		*dir = "migrations"
+		if d == dialect.SQLite {
+			*dir = filepath.Join("migrations", "sqlite")
+		}
+	}
+	db, err := open(d, *dsn, *path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	err = run(db, d, *dir, *status)
+	if *metricsFile != "" {
+		if werr := prometheus.WriteToTextfile(*metricsFile, migrationMetrics{}); werr != nil {
+			log.Printf("write metrics: %v", werr)
+		}
+	}
+	if err != nil {
+		_ = db.Close()
+		log.Fatal(err)
+	}
+}
+
+// run applies the migrations in dir, or with status only reports them. A status with pending
+// migrations is not an error; the report and app_migrations_pending show them.
+func run(db *sql.DB, d dialect.Dialect, dir string, status bool) error {
+	if !status {
+		apply := migrate.RunMigrationsFrom
+		if d == dialect.SQLite {
+			apply = migrate.RunSQLiteMigrationsFrom
+		}
+		if err := apply(db, dir); err != nil {
+			return err
+		}
+	}
+	report, err := migrate.Status(db, dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("applied %d, pending %d, last version %q\n", report.Applied, report.Pending, report.LastVersion)
+	return nil
+}
+
+// migrationMetrics gathers only the app_migration* metrics from the default registry, without
+// the Go runtime and process metrics of this short-lived command.
+type migrationMetrics struct{}
+
+func (migrationMetrics) Gather() ([]*dto.MetricFamily, error) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	out := families[:0]
+	for _, f := range families {
+		if strings.HasPrefix(f.GetName(), "app_migration") {
+			out = append(out, f)
+		}
+	}
+	return out, err
+}
+
+func open(d dialect.Dialect, dsn, path string) (*sql.DB, error) {
+	if d == dialect.SQLite {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		return dialect.OpenSQLite(path)
+	}
+	if dsn == "" {
+		return nil, fmt.Errorf("-dsn (or DATABASE_URL) is required for PostgreSQL")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	return db, nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,118 @@
+// Command seed fills a database with generated pages (English and Danish), demo users and
+// cached external results, for local development, demos and benchmark datasets.
+//
+//	go run ./cmd/seed -driver sqlite -migrate                  # data/whoknows.db, like DB_DRIVER=sqlite
+//	go run ./cmd/seed -dsn "$DATABASE_URL" -pages 50000 -users 0 -external 0
+//
+// The database must be migrated (start cmd/server against it once, or pass -migrate from the
+// repository root). Existing rows are skipped, so seeding can be re-run. The demo users are
+// demo1..demoN (demo1 is an admin) with the password from -password. Seeding refuses to run
+// with APP_ENV=prod.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/migrate"
+	"devops-valgfag/internal/seed"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func main() {
+	driver := flag.String("driver", os.Getenv("DB_DRIVER"), "postgres or sqlite (default $DB_DRIVER, postgres if unset)")
+	dsn := flag.String("dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN (default $DATABASE_URL)")
+	path := flag.String("path", getenv("DATABASE_PATH", "data/whoknows.db"), "SQLite file (default $DATABASE_PATH)")
+	runMigrations := flag.Bool("migrate", false, "apply pending migrations first (run from the repository root)")
+	pages := flag.Int("pages", 200, "generated pages")
+	languages := flag.String("languages", "en,da", "page languages, comma-separated")
+	users := flag.Int("users", 3, "demo users demo1..demoN")
+	password := flag.String("password", seed.DefaultPassword, "password of the demo users")
+	external := flag.Int("external", 50, "cached external results")
+	tenant := flag.Int("tenant", 1, "tenant ID for the pages and external results")
+	randSeed := flag.Int64("seed", 1, "random seed; the same seed generates the same data")
+	flag.Parse()
+
+	if env := strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV"))); env == "prod" || env == "production" {
+		log.Fatal("Refusing to seed with APP_ENV=prod")
+	}
+
+	d, err := dialect.Parse(*driver)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := open(d, *dsn, *path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if *runMigrations {
+		migrateFn := migrate.RunMigrations
+		if d == dialect.SQLite {
+			migrateFn = migrate.RunSQLiteMigrations
+		}
+		if err := migrateFn(db); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	reports, err := seed.Run(ctx, db, seed.Options{
+		Pages:     *pages,
+		Languages: strings.Split(*languages, ","),
+		Users:     *users,
+		Password:  *password,
+		External:  *external,
+		Tenant:    *tenant,
+		Seed:      *randSeed,
+		Progress: func(table string, done, total int) {
+			log.Printf("%s: %d/%d rows", table, done, total)
+		},
+	})
+	for _, r := range reports {
+		fmt.Printf("%-17s inserted %d, skipped %d existing\n", r.Table, r.Inserted, r.Skipped)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func open(d dialect.Dialect, dsn, path string) (*sql.DB, error) {
+	if d == dialect.SQLite {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		return dialect.OpenSQLite(path)
+	}
+	if dsn == "" {
+		return nil, fmt.Errorf("-dsn (or DATABASE_URL) is required for PostgreSQL")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	return db, nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
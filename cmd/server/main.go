@@ -9,29 +9,23 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
-	"html/template"
+	"context"
+	"errors"
+	"io/fs"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	_ "devops-valgfag/docs"
 	h "devops-valgfag/handlers"
-	metrics "devops-valgfag/internal/metrics"
-	migrate "devops-valgfag/internal/migrate"
-
-	"github.com/gorilla/mux"
-	"github.com/gorilla/sessions"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	httpSwagger "github.com/swaggo/http-swagger"
-
-	// PostgreSQL driver
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"devops-valgfag/internal/app"
+	"devops-valgfag/internal/config"
+	"devops-valgfag/internal/errortrack"
+	"devops-valgfag/internal/logscrub"
+	"devops-valgfag/internal/secrets"
 )
 
 // User represents an application user with login credentials.
@@ -59,252 +53,121 @@ type AuthResponse struct {
 	Message    string `json:"message" example:"Login successful"`
 }
 
-// dsnMeta is safe-to-log info about the DB connection (no password).
-type dsnMeta struct {
-	Source string // DB_HOST / DATABASE_URL / default
-	Host   string
-	DB     string
-	User   string
-}
-
 func main() {
 
+	// Log output has e-mail addresses, passwords and tokens redacted, including the values
+	// that database errors echo (see internal/logscrub).
+	logscrub.Install()
+
 	// -------------------------
 	// Runtime config
 	// -------------------------
 
-	// PORT: which TCP port the HTTP server listens on (default 8080).
-	port := getenv("PORT", "8080")
+	// Secrets (SESSION_KEY, POSTGRES_PASSWORD, ...) may come from <KEY>_FILE (Docker/Kubernetes
+	// secrets) or Vault (VAULT_ADDR). They are resolved first, so they win over the config file.
+	loadSecrets()
 
-	// APP_ENV: used to toggle "prod" behavior (e.g. safer logging).
-	appEnv := getenv("APP_ENV", "dev")
+	// CONFIG_FILE: optional YAML settings (default config.yaml, used if present; see
+	// config.example.yaml). Its values fill in unset environment variables, so env overrides it.
+	// baseEnv keeps the environment without them, for re-reading the file on reload.
+	baseEnv := config.Environ()
+	loadConfigFile()
 
-	// DSN = "Data Source Name" = connection string used by sql.Open().
-	// meta = non-sensitive info we can safely log for debugging.
-	dsn, meta := resolvePostgresDSN()
-
-	// In prod we log LESS to avoid leaking details (even if it's "only" username).
-	if appEnv != "prod" {
-		log.Printf("Using PostgreSQL DSN (source=%s host=%s db=%s user=%s)", meta.Source, meta.Host, meta.DB, meta.User)
-	} else {
-		log.Printf("Using PostgreSQL DSN (source=%s host=%s db=%s)", meta.Source, meta.Host, meta.DB)
+	// Every setting is read from the environment in one place (see internal/app/config.go).
+	cfg, err := app.ConfigFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// SESSION_KEY is used by gorilla/sessions to sign (and possibly encrypt) cookies.
-	// If it is weak, sessions can be forged. That's why we enforce 32+ bytes in prod.
-	sessionKey := getenv("SESSION_KEY", "")
-	if sessionKey == "" {
-		log.Fatal("SESSION_KEY is required")
-	}
-	// Note: len(sessionKey) counts bytes, not characters.
-	if appEnv == "prod" && len(sessionKey) < 32 {
-		log.Fatal("SESSION_KEY must be at least 32 bytes (not characters) in prod")
+	// SIGHUP re-reads CONFIG_FILE (under the startup environment) and ADMIN_IP_ACL_FILE right away
+	// (the ACL file is also picked up within 10s of a change). Other settings need a restart.
+	cfg.ReloadRuntime = func() (h.RuntimeConfig, error) {
+		_, values, err := readConfigFile()
+		if err != nil {
+			return h.RuntimeConfig{}, err
+		}
+		return app.RuntimeConfigFromEnv(config.Lookup(baseEnv, values), cfg.AppEnv, cfg.Dialect)
 	}
 
-	// Feature toggles
-	useFTS := getenv("SEARCH_FTS", "0") == "1"
-	externalSearchEnabled := getenv("EXTERNAL_SEARCH", "1") == "1"
-
-	// -------------------------
-	// Database
-	// -------------------------
-
-	// Open PostgreSQL using the pgx driver
-	db, err := sql.Open("pgx", dsn)
+	a, err := app.New(cfg)
 	if err != nil {
+		errortrack.Flush(5 * time.Second)
 		log.Fatal(err)
 	}
-	// Ensure DB is closed on main() exit
-	defer func() {
-		if cerr := db.Close(); cerr != nil {
-			log.Printf("error closing DB: %v", cerr)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			_, _ = h.ReloadConfig() // logged and counted by ReloadConfig
 		}
 	}()
 
-	// Optional connection pool tuning (safe defaults)
-	db.SetConnMaxLifetime(parseDurationEnv("DB_CONN_MAX_LIFETIME", 30*time.Minute))
-	db.SetMaxOpenConns(parseIntEnv("DB_MAX_OPEN_CONNS", 10))
-	db.SetMaxIdleConns(parseIntEnv("DB_MAX_IDLE_CONNS", 10))
-
-	// Test DB connection
-	if err := db.Ping(); err != nil {
-		log.Fatal("Failed to connect to PostgreSQL:", err)
-	}
-
-	// Run database migrations
-	log.Println("Running database migrations...")
-	if err := migrate.RunMigrations(db); err != nil {
-		log.Fatalf("migration error: %v", err)
-	}
-	log.Println("Connected to PostgreSQL and migrations applied successfully!")
-
-	// -------------------------
-	// HTTP (templates, sessions, router)
-	// -------------------------
-
-	// Templates
-	funcs := template.FuncMap{
-		"now":  time.Now,
-		"year": func() int { return time.Now().Year() },
+	// SIGINT/SIGTERM (Ctrl+C, docker stop) finish the running requests before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := a.Run(ctx); err != nil {
+		log.Fatal(err)
 	}
-	tmpl := template.Must(template.New("").Funcs(funcs).ParseGlob("./templates/*.html"))
-
-	// Session store backed by secure cookies.
-	// The sessionKey is used to sign cookies so clients cannot tamper with them.
-	sessionStore := sessions.NewCookieStore([]byte(sessionKey))
-
-	// "Wire handlers" = give handlers access to shared dependencies:
-	// - db connection
-	// - parsed HTML templates
-	// - session store
-	h.Init(db, tmpl, sessionStore)
-	h.EnableFTSSearch(useFTS)
-	h.EnableExternalSearch(externalSearchEnabled)
-
-	// Router
-	r := mux.NewRouter()
-
-	// Metrics middleware
-	r.Use(metrics.RequestMetricsMiddleware())
-
-	// Routes
-	// - Static assets
-	// - Pages
-	// - API
-	// - Health/metrics
-	// - Swagger
-	fs := http.FileServer(http.Dir("static"))
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", fs))
-
-	r.HandleFunc("/", h.HomePageHandler).Methods(http.MethodGet, http.MethodHead)
-	r.HandleFunc("/about", h.AboutPageHandler).Methods(http.MethodGet, http.MethodHead)
-	r.HandleFunc("/login", h.LoginPageHandler).Methods(http.MethodGet, http.MethodHead)
-	r.HandleFunc("/register", h.RegisterPageHandler).Methods(http.MethodGet, http.MethodHead)
-	r.HandleFunc("/weather", h.WeatherPageHandler).Methods(http.MethodGet, http.MethodHead)
-	r.HandleFunc("/search", h.SearchPageHandler).Methods(http.MethodGet, http.MethodHead)
-
-	r.HandleFunc("/api/login", h.APILoginHandler).Methods(http.MethodPost)
-	r.HandleFunc("/api/register", h.APIRegisterHandler).Methods(http.MethodPost)
-	r.HandleFunc("/api/logout", h.APILogoutHandler).Methods(http.MethodPost)
-
-	r.HandleFunc("/api/search", h.APISearchHandler).Methods(http.MethodGet)
-
-	r.HandleFunc("/api/weather", h.APIWeatherHandler).Methods(http.MethodGet)
-
-	r.HandleFunc("/healthz", h.Healthz).Methods(http.MethodGet, http.MethodHead)
-	r.HandleFunc("/readyz", h.Readyz).Methods(http.MethodGet, http.MethodHead)
-
-	r.Handle("/metrics", promhttp.Handler())
+	log.Println("Server stopped")
+}
 
-	swaggerHandler := httpSwagger.WrapHandler
-	// Support both /swagger and /swagger/index.html (avoids 404 without trailing slash).
-	r.HandleFunc("/swagger", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/swagger/index.html", http.StatusFound)
-	}).Methods(http.MethodGet, http.MethodHead)
-	
-	r.PathPrefix("/swagger/").Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodHead {
-			r2 := r.Clone(r.Context())
-			r2.Method = http.MethodGet
-			swaggerHandler.ServeHTTP(w, r2)
-			return
+// loadSecrets fills unset secret settings from <KEY>_FILE and, when VAULT_ADDR is set, from
+// the Vault secret at VAULT_SECRET_PATH. A secret that is configured but unreadable stops startup.
+func loadSecrets() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	providers := []secrets.Provider{secrets.Files{}}
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		// VAULT_TOKEN may itself be a mounted file (VAULT_TOKEN_FILE).
+		if _, err := secrets.Apply(ctx, []string{"VAULT_TOKEN"}, secrets.Files{}); err != nil {
+			log.Fatal(err)
 		}
-		swaggerHandler.ServeHTTP(w, r)
-	})).Methods(http.MethodGet, http.MethodHead)
-
-	// -------------------------
-	// Server
-	// -------------------------
-
-	// http.Server lets us configure timeouts (recommended in production).
-	// Handler: r means "use the mux router to handle every incoming request".
-	srv := &http.Server{
-		Addr:              ":" + port,
-		Handler:           r,
-		ReadHeaderTimeout: 5 * time.Second,
-		ReadTimeout:       15 * time.Second,
-		WriteTimeout:      15 * time.Second,
-		IdleTimeout:       60 * time.Second,
+		path := getenv("VAULT_SECRET_PATH", "secret/data/whoknows")
+		client := &http.Client{Timeout: 5 * time.Second}
+		providers = append(providers, secrets.NewVault(addr, os.Getenv("VAULT_TOKEN"), path, client))
 	}
 
-	fmt.Printf("Server running on :%s\n", port)
-	log.Fatal(srv.ListenAndServe())
-}
-
-// resolvePostgresDSN determines how the application should connect to PostgreSQL.
-// Precedence:
-// 1) DB_HOST + POSTGRES_* env vars (Docker / VM / local compose)
-// 2) DATABASE_URL (CI / cloud / managed databases)
-// 3) Fallback to docker-compose default service name
-//
-// It returns:
-// - a full DSN string used to open the DB connection
-// - safe-to-log metadata describing the chosen configuration
-func resolvePostgresDSN() (string, dsnMeta) {
-
-	// Case 1: Running in Docker / VM where DB host is provided explicitly
-	if host := os.Getenv("DB_HOST"); host != "" {
-		return buildPostgresDSN(host, "DB_HOST")
+	applied, err := secrets.Apply(ctx, secrets.Keys, providers...)
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	// Case 2: Running in CI/cloud where a full DATABASE_URL is injected (e.g. GitHub Actions env).
-	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
-		meta, err := extractDSNMeta(dsn)
-		if err != nil {
-			log.Fatal("invalid DATABASE_URL:", err)
+	for _, key := range secrets.Keys {
+		if from, ok := applied[key]; ok {
+			log.Printf("secrets: %s from %s", key, from)
 		}
-		meta.Source = "DATABASE_URL"
-		return dsn, meta
 	}
-
-	// Case 3: Local docker-compose fallback (service name resolution)
-	return buildPostgresDSN("postgres_db", "default")
 }
 
-// buildPostgresDSN constructs a PostgreSQL connection string from individual environment variables.
-// This is used when the environment does NOT provide a full DATABASE_URL.
-func buildPostgresDSN(host, source string) (string, dsnMeta) {
-	port := getenv("POSTGRES_PORT", "5432")
-	user := getenv("POSTGRES_USER", "devops")
-	pass := getenv("POSTGRES_PASSWORD", "devops")
-	dbName := getenv("POSTGRES_DB", "whoknows")
-	sslmode := getenv("POSTGRES_SSLMODE", "disable") // keeps your current behavior by default
-
-	dsn := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		url.QueryEscape(user),
-		url.QueryEscape(pass),
-		host, // do NOT escape host
-		port,
-		url.QueryEscape(dbName),
-		url.QueryEscape(sslmode),
-	)
-
-	return dsn, dsnMeta{
-		Source: source,
-		Host:   host,
-		DB:     dbName,
-		User:   user,
+// loadConfigFile applies CONFIG_FILE (see internal/config). An invalid file, or a missing one
+// that CONFIG_FILE names explicitly, stops startup.
+func loadConfigFile() {
+	path, values, err := readConfigFile()
+	if err != nil {
+		log.Fatal(err)
 	}
-}
-
-func extractDSNMeta(raw string) (dsnMeta, error) {
-	parsed, err := url.Parse(raw)
+	if values == nil {
+		return
+	}
+	overridden, err := config.Apply(values)
 	if err != nil {
-		return dsnMeta{}, err
+		log.Fatal(err)
 	}
-
-	dbName := strings.TrimPrefix(parsed.Path, "/")
-	user := ""
-	if parsed.User != nil {
-		user = parsed.User.Username()
+	log.Printf("config: %d settings from %s", len(values), path)
+	if len(overridden) > 0 {
+		log.Printf("config: overridden by the environment: %s", strings.Join(overridden, ", "))
 	}
+}
 
-	return dsnMeta{
-		Host: parsed.Hostname(),
-		DB:   dbName,
-		User: user,
-	}, nil
+// readConfigFile reads CONFIG_FILE. Values are nil when the default file does not exist.
+func readConfigFile() (string, map[string]string, error) {
+	path := getenv("CONFIG_FILE", "config.yaml")
+	values, err := config.Load(path)
+	if errors.Is(err, fs.ErrNotExist) && os.Getenv("CONFIG_FILE") == "" {
+		return path, nil, nil
+	}
+	return path, values, err
 }
 
 func getenv(key, fallback string) string {
@@ -313,27 +176,3 @@ func getenv(key, fallback string) string {
 	}
 	return fallback
 }
-
-func parseIntEnv(key string, fallback int) int {
-	v := os.Getenv(key)
-	if v == "" {
-		return fallback
-	}
-	n, err := strconv.Atoi(v)
-	if err != nil || n < 0 {
-		return fallback
-	}
-	return n
-}
-
-func parseDurationEnv(key string, fallback time.Duration) time.Duration {
-	v := os.Getenv(key)
-	if v == "" {
-		return fallback
-	}
-	d, err := time.ParseDuration(v)
-	if err != nil || d <= 0 {
-		return fallback
-	}
-	return d
-}
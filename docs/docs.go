@@ -271,6 +271,11 @@ const docTemplate = `{
             "properties": {
                 "error": {
                     "type": "string"
+                },
+                "field": {
+                    "description": "the offending field of a rejected JSON body",
+                    "type": "string",
+                    "example": "limit"
                 }
             }
         },
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// AccountExport is the data kept about the current user, returned by GET /api/me/export.
+type AccountExport struct {
+	ExportedAt    time.Time     `json:"exported_at"`
+	Account       ExportAccount `json:"account"`
+	Preferences   Preferences   `json:"preferences"`
+	Bookmarks     []Bookmark    `json:"bookmarks"`
+	SavedSearches []SavedSearch `json:"saved_searches"`
+	Consents      []Consent     `json:"consents"` // terms of service / privacy policy acceptances
+}
+
+// ExportAccount is the account part of AccountExport.
+type ExportAccount struct {
+	ID           int        `json:"id" example:"1"`
+	Username     string     `json:"username" example:"alice"`
+	Email        string     `json:"email" example:"alice@example.com"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	TermsVersion string     `json:"terms_version,omitempty" example:"2026-10-01"`
+}
+
+// APIAccountExportHandler godoc
+// @Summary      Export your data
+// @Description  Returns the data kept about the logged-in user as a JSON download: account, preferences, bookmarks, saved searches and the history of accepted terms of service and privacy policy versions. Requires session auth.
+// @Tags         Auth
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  AccountExport
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/export [get]
+func APIAccountExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	fail := func(msg string, err error) {
+		reportError(r, msg, err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not export account"})
+	}
+
+	var (
+		out            = AccountExport{ExportedAt: time.Now().UTC()}
+		created, login sql.NullTime
+		termsVersion   sql.NullString
+	)
+	err := db.QueryRowContext(ctx, `
+SELECT id, username, email, created_at, last_login_at, terms_version
+FROM users WHERE id = $1 AND deleted_at IS NULL`, userID,
+	).Scan(&out.Account.ID, &out.Account.Username, &out.Account.Email, &created, &login, &termsVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusUnauthorized, APIErrorResponse{Error: "unauthorized"})
+		return
+	}
+	if err != nil {
+		fail("export account error", err)
+		return
+	}
+	if created.Valid {
+		out.Account.CreatedAt = &created.Time
+	}
+	if login.Valid {
+		out.Account.LastLoginAt = &login.Time
+	}
+	out.Account.TermsVersion = termsVersion.String
+
+	if out.Preferences, err = queryUserPreferences(ctx, userID); err != nil {
+		fail("export preferences error", err)
+		return
+	}
+	if out.Bookmarks, err = queryBookmarks(ctx, userID); err != nil {
+		fail("export bookmarks error", err)
+		return
+	}
+	if out.SavedSearches, err = querySavedSearches(ctx, `WHERE user_id = $1 ORDER BY name`, userID); err != nil {
+		fail("export saved searches error", err)
+		return
+	}
+	if out.Consents, err = queryConsents(ctx, userID); err != nil {
+		fail("export consents error", err)
+		return
+	}
+	if out.Bookmarks == nil {
+		out.Bookmarks = []Bookmark{}
+	}
+	if out.SavedSearches == nil {
+		out.SavedSearches = []SavedSearch{}
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="whoknows-account.json"`)
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/apperror"
+	"devops-valgfag/internal/metrics"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account settings: logged-in users change their password or email on /settings. Both need the
+// current password. A new password ends every other session (session_version) and remember-me
+// token and is confirmed by email; a new email only takes effect once the link sent to it is
+// opened, and the old address is told about the request.
+
+const (
+	settingsTitle   = "Settings"
+	emailChangeTTL  = 24 * time.Hour
+	accountBodySize = 4096
+)
+
+var (
+	errWrongPassword = apperror.New(apperror.Forbidden, "current password is incorrect")
+
+	errEmailLinkInvalid = apperror.New(apperror.Invalid, "This confirmation link is invalid or has expired")
+)
+
+// ChangePasswordRequest is the body of POST /api/me/password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	NewPassword2    string `json:"new_password2"`
+}
+
+// ChangeEmailRequest is the body of POST /api/me/email.
+type ChangeEmailRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Email           string `json:"email" example:"new@example.com"`
+}
+
+// AccountChangeResponse is returned by the account settings endpoints.
+type AccountChangeResponse struct {
+	Message     string `json:"message"`
+	EmailQueued bool   `json:"email_queued"` // confirmation/notification email queued
+}
+
+// settingsAccount is the account row the settings endpoints work on.
+type settingsAccount struct {
+	User
+	PendingEmail string
+}
+
+func loadSettingsAccount(ctx context.Context, userID int) (settingsAccount, error) {
+	var (
+		a       settingsAccount
+		pending sql.NullString
+	)
+	err := db.QueryRowContext(ctx, `
+SELECT id, username, email, password, session_version, pending_email
+FROM users WHERE id = $1 AND deleted_at IS NULL`, userID,
+	).Scan(&a.ID, &a.Username, &a.Email, &a.Password, &a.SessionVersion, &pending)
+	a.PendingEmail = pending.String
+	return a, err
+}
+
+// reauthenticate loads the logged-in account and checks its current password.
+func reauthenticate(ctx context.Context, userID int, password string) (settingsAccount, error) {
+	a, err := loadSettingsAccount(ctx, userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return a, apperror.New(apperror.Unauthorized, "unauthorized")
+	case err != nil:
+		return a, apperror.Wrap(apperror.Internal, "database error", fmt.Errorf("load account: %w", err))
+	}
+	if !authService.VerifyPassword(ctx, a.Password, password) {
+		metrics.AuthFailures.WithLabelValues("reauth", "403").Inc()
+		return a, errWrongPassword
+	}
+	return a, nil
+}
+
+// queueAccountEmail queues a mail about the account; it reports whether that worked.
+func queueAccountEmail(r *http.Request, to, subject, body string) bool {
+	if jobQueue == nil || to == "" {
+		return false
+	}
+	if _, err := jobQueue.Enqueue(r.Context(), JobSendEmail, SendEmailPayload{To: to, Subject: subject, Body: body}); err != nil {
+		reportError(r, "enqueue account email error", err)
+		return false
+	}
+	return true
+}
+
+// SettingsPageHandler renders /settings (the login page for anonymous users).
+func SettingsPageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok || db == nil {
+		redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	a, err := loadSettingsAccount(r.Context(), userID)
+	if err != nil {
+		reportError(r, "load account error", err)
+		redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	renderTemplate(w, r, "settings", map[string]any{
+		"Title":        settingsTitle,
+		"Username":     a.Username,
+		"Email":        a.Email,
+		"PendingEmail": a.PendingEmail,
+	})
+}
+
+// APIChangePasswordHandler godoc
+// @Summary      Change password
+// @Description  Changes the logged-in user's password after checking the current one. Every other session and remember-me token is signed out; this session stays logged in. A notification is emailed to the account.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  ChangePasswordRequest  true  "Current and new password"
+// @Success      200  {object}  AccountChangeResponse
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse  "Current password is incorrect"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/password [post]
+func APIChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	if !decodeJSONBody(w, r, accountBodySize, &req) {
+		return
+	}
+	switch {
+	case req.NewPassword == "":
+		writeAPIError(w, r, apperror.New(apperror.Invalid, "new_password is required"))
+		return
+	case req.NewPassword != req.NewPassword2:
+		writeAPIError(w, r, apperror.New(apperror.Invalid, "passwords do not match"))
+		return
+	}
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	a, err := reauthenticate(r.Context(), userID, req.CurrentPassword)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		writeAPIError(w, r, apperror.Wrap(apperror.Internal, "internal error", fmt.Errorf("bcrypt.GenerateFromPassword (change password): %w", err)))
+		return
+	}
+	ctx := r.Context()
+	var version int
+	err = db.QueryRowContext(ctx, `
+UPDATE users SET password = $1, session_version = session_version + 1
+WHERE id = $2 RETURNING session_version`, string(hash), a.ID,
+	).Scan(&version)
+	if err != nil {
+		writeAPIError(w, r, apperror.Wrap(apperror.Internal, "could not change password", fmt.Errorf("change password: %w", err)))
+		return
+	}
+	if err := revokeRememberTokens(ctx, a.ID); err != nil {
+		reportError(r, "revoke remember tokens error", err) // session_version already invalidates them
+	}
+	a.SessionVersion = version
+	if err := startSession(w, r, a.User); err != nil {
+		reportError(r, "startSession error (change password)", err)
+	}
+
+	resp := AccountChangeResponse{Message: "Password changed"}
+	resp.EmailQueued = queueAccountEmail(r, a.Email, "Your WhoKnows password was changed",
+		"Hi "+a.Username+",\n\nThe password of your WhoKnows account was just changed, and all other "+
+			"devices were signed out.\n\nIf you did not do this, contact an administrator right away.\n")
+	audit(r, "user.password_changed", "user", a.ID, map[string]any{"email_queued": resp.EmailQueued})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// APIChangeEmailHandler godoc
+// @Summary      Change email address
+// @Description  Starts an email change for the logged-in user after checking the current password. The new address gets a confirmation link (valid 24 hours) and only replaces the old one once it is opened; the old address is notified.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  ChangeEmailRequest  true  "Current password and new email"
+// @Success      202  {object}  AccountChangeResponse
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse  "Current password is incorrect"
+// @Failure      409  {object}  APIErrorResponse  "Email already in use"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/email [post]
+func APIChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req ChangeEmailRequest
+	if !decodeJSONBody(w, r, accountBodySize, &req) {
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		writeAPIError(w, r, apperror.New(apperror.Invalid, "email is not a valid address"))
+		return
+	}
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	a, err := reauthenticate(r.Context(), userID, req.CurrentPassword)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if strings.EqualFold(email, a.Email) {
+		writeAPIError(w, r, apperror.New(apperror.Invalid, "this is already your email"))
+		return
+	}
+
+	ctx := r.Context()
+	var taken int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE email = $1 AND id <> $2`, email, a.ID).Scan(&taken); err != nil {
+		writeAPIError(w, r, apperror.Wrap(apperror.Internal, "database error", fmt.Errorf("email taken query: %w", err)))
+		return
+	}
+	if taken > 0 {
+		writeAPIError(w, r, apperror.New(apperror.Conflict, "email already in use"))
+		return
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		writeAPIError(w, r, apperror.Wrap(apperror.Internal, "internal error", fmt.Errorf("email change token: %w", err)))
+		return
+	}
+	_, err = db.ExecContext(ctx, `
+UPDATE users SET pending_email = $1, email_change_hash = $2, email_change_expires = $3 WHERE id = $4`,
+		email, hashResetToken(token), time.Now().UTC().Add(emailChangeTTL), a.ID,
+	)
+	if err != nil {
+		writeAPIError(w, r, apperror.Wrap(apperror.Internal, "could not change email", fmt.Errorf("email change: %w", err)))
+		return
+	}
+
+	link := publicURL(r) + "/confirm-email?" + url.Values{"token": {token}}.Encode()
+	resp := AccountChangeResponse{Message: "Confirmation sent"}
+	resp.EmailQueued = queueAccountEmail(r, email, "Confirm your new WhoKnows email address",
+		"Hi "+a.Username+",\n\nConfirm that this is the new email address of your WhoKnows account:\n\n"+
+			link+"\n\nThe link expires in 24 hours. If you did not ask for this, ignore this email.\n")
+	queueAccountEmail(r, a.Email, "Your WhoKnows email address is being changed",
+		"Hi "+a.Username+",\n\nSomeone signed in to your WhoKnows account asked to change its email address "+
+			"to "+email+". It changes once the link sent there is opened.\n\n"+
+			"If you did not do this, change your password right away.\n")
+	audit(r, "user.email_change_requested", "user", a.ID, map[string]any{"email_queued": resp.EmailQueued})
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// ConfirmEmailHandler applies an email change from the link sent to the new address and
+// renders the settings page with the outcome.
+func ConfirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var err error = errEmailLinkInvalid
+	if token := r.URL.Query().Get("token"); token != "" && db != nil {
+		err = confirmEmailChange(r, token)
+	}
+
+	data := map[string]any{"Title": settingsTitle}
+	if id, ok := currentUserID(r); ok {
+		if a, loadErr := loadSettingsAccount(r.Context(), id); loadErr == nil {
+			data["Username"], data["Email"], data["PendingEmail"] = a.Username, a.Email, a.PendingEmail
+		}
+	}
+	if err != nil {
+		renderPageError(w, r, "settings", data, err)
+		return
+	}
+	data["Notice"] = "Your email address has been changed"
+	renderTemplate(w, r, "settings", data)
+}
+
+func confirmEmailChange(r *http.Request, token string) error {
+	var userID int
+	err := db.QueryRowContext(r.Context(), `
+UPDATE users
+SET email = pending_email, pending_email = NULL, email_change_hash = NULL, email_change_expires = NULL
+WHERE email_change_hash = $1 AND email_change_expires > $2 AND pending_email IS NOT NULL AND deleted_at IS NULL
+RETURNING id`, hashResetToken(token), time.Now().UTC(),
+	).Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return errEmailLinkInvalid
+	case err != nil:
+		// Most likely the address was taken by another account in the meantime (UNIQUE).
+		return apperror.Wrap(apperror.Internal, "Could not change the email address", fmt.Errorf("confirm email: %w", err))
+	}
+	audit(r, "user.email_changed", "user", userID, nil)
+	return nil
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/service"
+)
+
+// Every account has a status. Only active accounts can log in; SessionGuardMiddleware ends
+// the sessions of accounts that leave it. New sign-ups start as pending when registration
+// needs admin approval (REGISTRATION_APPROVAL), otherwise as active.
+const (
+	UserStatusPending  = service.UserStatusPending
+	UserStatusActive   = service.UserStatusActive
+	UserStatusDisabled = service.UserStatusDisabled // temporarily blocked, e.g. a compromised account
+	UserStatusBanned   = service.UserStatusBanned   // blocked for abuse
+)
+
+// statusTransitions lists the statuses an admin may move an account to from each status.
+var statusTransitions = map[string][]string{
+	UserStatusPending:  {UserStatusActive, UserStatusBanned},
+	UserStatusActive:   {UserStatusDisabled, UserStatusBanned},
+	UserStatusDisabled: {UserStatusActive, UserStatusBanned},
+	UserStatusBanned:   {UserStatusActive},
+}
+
+// statusNeedsReason is true for statuses that block an account; the reason goes to the audit log.
+func statusNeedsReason(status string) bool {
+	return status == UserStatusDisabled || status == UserStatusBanned
+}
+
+var registrationApproval atomic.Bool
+
+// SetRegistrationApproval makes new sign-ups pending until an admin activates them.
+func SetRegistrationApproval(enabled bool) {
+	registrationApproval.Store(enabled)
+}
+
+// registrationStatus is the status given to self-registered accounts.
+func registrationStatus() string {
+	if registrationApproval.Load() {
+		return UserStatusPending
+	}
+	return UserStatusActive
+}
+
+// AdminUserStatusChange is the body accepted by POST /admin/users/{id}/status.
+type AdminUserStatusChange struct {
+	Status string `json:"status" example:"banned"`
+	Reason string `json:"reason" example:"spam"` // required for disabled and banned
+}
+
+var errInvalidTransition = errors.New("invalid status transition")
+
+// AdminSetUserStatusHandler godoc
+// @Summary      Change a user's account status
+// @Description  Moves an account between pending, active, disabled and banned. Allowed: pending→active/banned, active→disabled/banned, disabled→active/banned, banned→active. Disabling or banning needs a reason; the change and its reason are audit-logged and the user's sessions end on their next request. Setting the current status again is a no-op. Admins cannot change their own status. Admin only.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id    path  int                    true  "User ID"
+// @Param        body  body  AdminUserStatusChange  true  "New status"
+// @Success      200  {object}  AdminUser
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse  "Transition not allowed"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/users/{id}/status [post]
+func AdminSetUserStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var in AdminUserStatusChange
+	if !decodeJSONBody(w, r, adminUserBodyLimit, &in) {
+		return
+	}
+	changeUserStatus(w, r, in)
+}
+
+// AdminDisableUserHandler godoc
+// @Summary      Disable a user
+// @Description  Shortcut for setting the status to disabled; takes an optional {"reason": "..."} body (required unless the account is already disabled). Admin only.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id    path  int                    true   "User ID"
+// @Param        body  body  AdminUserStatusChange  false  "Reason (status is ignored)"
+// @Success      200  {object}  AdminUser
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/users/{id}/disable [post]
+func AdminDisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeOptionalStatusChange(w, r)
+	if !ok {
+		return
+	}
+	in.Status = UserStatusDisabled
+	changeUserStatus(w, r, in)
+}
+
+// AdminEnableUserHandler godoc
+// @Summary      Enable a user
+// @Description  Shortcut for setting the status to active: approves a pending sign-up, re-enables a disabled account or lifts a ban. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id  path  int  true  "User ID"
+// @Success      200  {object}  AdminUser
+// @Failure      400  {object}  APIErrorResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/users/{id}/enable [post]
+func AdminEnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeOptionalStatusChange(w, r)
+	if !ok {
+		return
+	}
+	in.Status = UserStatusActive
+	changeUserStatus(w, r, in)
+}
+
+func decodeOptionalStatusChange(w http.ResponseWriter, r *http.Request) (AdminUserStatusChange, bool) {
+	var in AdminUserStatusChange
+	ok := decodeOptionalJSONBody(w, r, adminUserBodyLimit, &in)
+	return in, ok
+}
+
+// changeUserStatus validates and applies a status change for the user in the {id} route variable.
+func changeUserStatus(w http.ResponseWriter, r *http.Request, in AdminUserStatusChange) {
+	in.Reason = strings.TrimSpace(in.Reason)
+	if _, known := statusTransitions[in.Status]; !known {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "status must be pending, active, disabled or banned"})
+		return
+	}
+	u, ok := userFromRoute(w, r, false)
+	if !ok {
+		return
+	}
+	if self, _ := currentUserID(r); self == u.ID {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "cannot change the status of your own account"})
+		return
+	}
+	if u.Status == in.Status {
+		writeJSON(w, http.StatusOK, u)
+		return
+	}
+	if statusNeedsReason(in.Status) && in.Reason == "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "a reason is required to set status " + in.Status})
+		return
+	}
+
+	err := setUserStatus(r, u, in.Status, in.Reason)
+	switch {
+	case errors.Is(err, errInvalidTransition):
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: "cannot change status from " + u.Status + " to " + in.Status})
+		return
+	case err != nil:
+		reportError(r, "set user status error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not change status"})
+		return
+	}
+
+	u, err = loadAdminUser(r.Context(), u.ID)
+	if err != nil {
+		reportError(r, "reload user error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// setUserStatus moves u to status if the transition is allowed and records it in the audit log.
+// The update is conditional on the current status, so concurrent changes cannot skip a check.
+func setUserStatus(r *http.Request, u AdminUser, status, reason string) error {
+	allowed := false
+	for _, s := range statusTransitions[u.Status] {
+		allowed = allowed || s == status
+	}
+	if !allowed {
+		return errInvalidTransition
+	}
+
+	res, err := db.ExecContext(r.Context(), `
+UPDATE users SET status = $1, status_reason = $2, status_changed_at = $3
+WHERE id = $4 AND status = $5`,
+		status, reason, time.Now().UTC(), u.ID, u.Status,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errInvalidTransition
+	}
+	audit(r, "user.status", "user", u.ID, map[string]any{"from": u.Status, "to": status, "reason": reason})
+	return nil
+}
+
+// writeAccountBlocked answers 403 for a request whose account is not active: JSON for API
+// clients, otherwise the login page with the reason.
+func writeAccountBlocked(w http.ResponseWriter, r *http.Request, status string) {
+	respondError(w, r, "login", map[string]any{"Title": loginTitle}, service.AccountStatusError(status))
+}
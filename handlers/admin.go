@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+)
+
+// isAdmin reports whether the current session belongs to a user with users.is_admin set.
+// Any lookup error is treated as "not admin" (fail closed).
+func isAdmin(r *http.Request) bool {
+	if db == nil {
+		return false
+	}
+	userID, ok := currentUserID(r)
+	if !ok {
+		return false
+	}
+
+	var admin bool
+	err := db.QueryRowContext(r.Context(), `SELECT is_admin FROM users WHERE id = $1 AND deleted_at IS NULL`, userID).Scan(&admin)
+	if err != nil {
+		log.Printf("isAdmin lookup error: %v", err)
+		return false
+	}
+	return admin
+}
+
+// RequireAdmin wraps a handler so only logged-in admins can reach it.
+// Anonymous users get 401, logged-in non-admins get 403 (both as JSON).
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAuthenticated(r) {
+			writeJSON(w, http.StatusUnauthorized, APIErrorResponse{Error: "unauthorized"})
+			return
+		}
+		if !isAdmin(r) {
+			writeJSON(w, http.StatusForbidden, APIErrorResponse{Error: "forbidden"})
+			return
+		}
+		next(w, r)
+	}
+}
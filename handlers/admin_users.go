@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// Admin user management. Account status changes live in account_status.go. Forcing a
+// password reset bumps the user's session_version, which SessionGuardMiddleware compares
+// against the version stored in the session cookie, so existing sessions end on their next
+// request. Every change is audit-logged.
+
+const (
+	adminUsersDefaultLimit = 50
+	adminUsersMaxLimit     = 200
+	adminUserBodyLimit     = 64 << 10
+
+	// passwordResetTTL is how long an emailed password reset link stays valid.
+	passwordResetTTL = 24 * time.Hour
+)
+
+// AdminUser is a user account as seen by admins.
+type AdminUser struct {
+	ID                int        `json:"id" example:"7"`
+	Username          string     `json:"username" example:"alice"`
+	Email             string     `json:"email" example:"alice@example.com"`
+	IsAdmin           bool       `json:"is_admin"`
+	Status            string     `json:"status" example:"active"` // pending, active, disabled or banned
+	StatusReason      string     `json:"status_reason,omitempty" example:"spam"`
+	StatusChangedAt   *time.Time `json:"status_changed_at,omitempty"`
+	MustResetPassword bool       `json:"must_reset_password"`
+	CreatedAt         *time.Time `json:"created_at,omitempty"`
+	LastLoginAt       *time.Time `json:"last_login_at,omitempty"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"` // set for soft-deleted users
+}
+
+// AdminUserListResponse is a page of users returned by GET /admin/users.
+type AdminUserListResponse struct {
+	Total  int         `json:"total" example:"123"` // users matching the filters
+	Limit  int         `json:"limit" example:"50"`
+	Offset int         `json:"offset" example:"0"`
+	Users  []AdminUser `json:"users"`
+}
+
+// UserActivity summarises what a user has done on the site.
+type UserActivity struct {
+	Bookmarks     int        `json:"bookmarks" example:"4"`
+	SavedSearches int        `json:"saved_searches" example:"2"`
+	Votes         int        `json:"votes" example:"9"`
+	Clicks        int        `json:"clicks" example:"31"`
+	LastClickAt   *time.Time `json:"last_click_at,omitempty"`
+}
+
+// AdminUserDetail is returned by GET /admin/users/{id}.
+type AdminUserDetail struct {
+	AdminUser
+	Activity UserActivity `json:"activity"`
+}
+
+// AdminUserCreate is the body accepted by POST /admin/users.
+type AdminUserCreate struct {
+	Username string `json:"username" example:"alice"`
+	Email    string `json:"email" example:"alice@example.com"`
+	Password string `json:"password"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// AdminUserUpdate is the body accepted by PATCH /admin/users/{id}; omitted fields are unchanged.
+type AdminUserUpdate struct {
+	Email   *string `json:"email,omitempty" example:"alice@example.com"`
+	IsAdmin *bool   `json:"is_admin,omitempty"`
+}
+
+// AdminPasswordResetResponse is returned by POST /admin/users/{id}/reset-password.
+type AdminPasswordResetResponse struct {
+	ExpiresAt   time.Time `json:"expires_at"`
+	EmailQueued bool      `json:"email_queued"` // false when no job queue is configured
+}
+
+var errUserNotFound = errors.New("user not found")
+
+const adminUserColumns = `id, username, email, is_admin, status, status_reason, status_changed_at, must_reset_password, created_at, last_login_at, deleted_at`
+
+func scanAdminUser(scan func(...any) error) (AdminUser, error) {
+	var (
+		u                                          AdminUser
+		statusChanged, created, lastLogin, deleted sql.NullTime
+	)
+	err := scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.Status, &u.StatusReason, &statusChanged,
+		&u.MustResetPassword, &created, &lastLogin, &deleted)
+	if err != nil {
+		return AdminUser{}, err
+	}
+	u.StatusChangedAt = nullTimePtr(statusChanged)
+	u.CreatedAt = nullTimePtr(created)
+	u.LastLoginAt = nullTimePtr(lastLogin)
+	u.DeletedAt = nullTimePtr(deleted)
+	return u, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// loadAdminUser returns the user with the given ID, including disabled and deleted accounts.
+func loadAdminUser(ctx context.Context, id int) (AdminUser, error) {
+	u, err := scanAdminUser(db.QueryRowContext(ctx, `SELECT `+adminUserColumns+` FROM users WHERE id = $1`, id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AdminUser{}, errUserNotFound
+	}
+	return u, err
+}
+
+// userFromRoute loads the user named by the {id} route variable and writes 404/500 itself.
+// Soft-deleted users only count as found when allowDeleted is set.
+func userFromRoute(w http.ResponseWriter, r *http.Request, allowDeleted bool) (AdminUser, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "user not found"})
+		return AdminUser{}, false
+	}
+	u, err := loadAdminUser(r.Context(), id)
+	switch {
+	case errors.Is(err, errUserNotFound), err == nil && u.DeletedAt != nil && !allowDeleted:
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "user not found"})
+		return AdminUser{}, false
+	case err != nil:
+		reportError(r, "load user error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return AdminUser{}, false
+	}
+	return u, true
+}
+
+// AdminListUsersHandler godoc
+// @Summary      List users
+// @Description  Returns users ordered by ID, filtered by a username/email substring, account status and admin flag. Soft-deleted users are only included with status=deleted or status=all. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        q       query  string  false  "Username or email contains (case-insensitive)"
+// @Param        status  query  string  false  "pending, active, disabled, banned, deleted or all (default: all but deleted)"
+// @Param        admin   query  bool    false  "Only admins (true) or non-admins (false)"
+// @Param        limit   query  int     false  "Page size (default 50, max 200)"
+// @Param        offset  query  int     false  "Users to skip"
+// @Success      200  {object}  AdminUserListResponse
+// @Failure      400  {object}  APIErrorResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/users [get]
+func AdminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	resp := AdminUserListResponse{Limit: adminUsersDefaultLimit, Users: []AdminUser{}}
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 {
+		resp.Limit = min(n, adminUsersMaxLimit)
+	}
+	if n, err := strconv.Atoi(q.Get("offset")); err == nil && n > 0 {
+		resp.Offset = n
+	}
+
+	var (
+		conds []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	switch status := q.Get("status"); status {
+	case "":
+		conds = append(conds, "deleted_at IS NULL")
+	case UserStatusPending, UserStatusActive, UserStatusDisabled, UserStatusBanned:
+		conds = append(conds, "deleted_at IS NULL AND status = "+arg(status))
+	case "deleted":
+		conds = append(conds, "deleted_at IS NOT NULL")
+	case "all":
+	default:
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "status must be pending, active, disabled, banned, deleted or all"})
+		return
+	}
+	if raw := q.Get("admin"); raw != "" {
+		admin, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "admin must be true or false"})
+			return
+		}
+		conds = append(conds, "is_admin = "+arg(admin))
+	}
+	if text := strings.TrimSpace(q.Get("q")); text != "" {
+		// LOWER ... LIKE instead of ILIKE keeps the query portable to the SQLite test schema.
+		p := arg("%" + escapeLike(strings.ToLower(text)) + "%")
+		conds = append(conds, "(LOWER(username) LIKE "+p+" ESCAPE '\\' OR LOWER(email) LIKE "+p+" ESCAPE '\\')")
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	ctx := r.Context()
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&resp.Total); err != nil {
+		reportError(r, "count users error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	page := ` ORDER BY id LIMIT ` + arg(resp.Limit) + ` OFFSET ` + arg(resp.Offset)
+	rows, err := db.QueryContext(ctx, `SELECT `+adminUserColumns+` FROM users`+where+page, args...)
+	if err != nil {
+		reportError(r, "list users error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	for rows.Next() {
+		u, err := scanAdminUser(rows.Scan)
+		if err != nil {
+			reportError(r, "list users scan error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+			return
+		}
+		resp.Users = append(resp.Users, u)
+	}
+	if err := rows.Err(); err != nil {
+		reportError(r, "list users error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// AdminGetUserHandler godoc
+// @Summary      Get a user
+// @Description  Returns one user (including blocked and soft-deleted accounts) with a summary of their activity. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id  path  int  true  "User ID"
+// @Success      200  {object}  AdminUserDetail
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/users/{id} [get]
+func AdminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromRoute(w, r, true)
+	if !ok {
+		return
+	}
+	activity, err := loadUserActivity(r.Context(), u.ID)
+	if err != nil {
+		reportError(r, "user activity error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, AdminUserDetail{AdminUser: u, Activity: activity})
+}
+
+func loadUserActivity(ctx context.Context, userID int) (UserActivity, error) {
+	var a UserActivity
+	counts := []struct {
+		table string
+		dst   *int
+	}{
+		{"bookmarks", &a.Bookmarks},
+		{"saved_searches", &a.SavedSearches},
+		{"result_votes", &a.Votes},
+		{"search_clicks", &a.Clicks},
+	}
+	for _, c := range counts {
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+c.table+` WHERE user_id = $1`, userID).Scan(c.dst); err != nil {
+			return UserActivity{}, err
+		}
+	}
+
+	var last sql.NullTime
+	err := db.QueryRowContext(ctx,
+		`SELECT clicked_at FROM search_clicks WHERE user_id = $1 ORDER BY clicked_at DESC LIMIT 1`, userID,
+	).Scan(&last)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return UserActivity{}, err
+	}
+	a.LastClickAt = nullTimePtr(last)
+	return a, nil
+}
+
+// AdminCreateUserHandler godoc
+// @Summary      Create a user
+// @Description  Creates an account with the given password, optionally as admin. Admin only.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  AdminUserCreate  true  "New user"
+// @Success      201  {object}  AdminUser
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse  "Username already in use"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/users [post]
+func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var in AdminUserCreate
+	if !decodeJSONBody(w, r, adminUserBodyLimit, &in) {
+		return
+	}
+	in.Username = strings.TrimSpace(in.Username)
+	in.Email = strings.TrimSpace(in.Email)
+
+	ctx := r.Context()
+	err := authService.Register(ctx, service.Registration{
+		Username: in.Username, Email: in.Email, Password: in.Password, Password2: in.Password, Status: UserStatusActive,
+	})
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	var id int
+	err = db.QueryRowContext(ctx, `SELECT id FROM users WHERE username = $1`, in.Username).Scan(&id)
+	if err == nil && in.IsAdmin {
+		_, err = db.ExecContext(ctx, `UPDATE users SET is_admin = TRUE WHERE id = $1`, id)
+	}
+	var u AdminUser
+	if err == nil {
+		u, err = loadAdminUser(ctx, id)
+	}
+	if err != nil {
+		reportError(r, "create user error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	audit(r, "user.create", "user", u.ID, map[string]any{"username": u.Username, "is_admin": u.IsAdmin})
+	writeJSON(w, http.StatusCreated, u)
+}
+
+// AdminUpdateUserHandler godoc
+// @Summary      Update a user
+// @Description  Changes a user's email and/or admin flag. Admins cannot change their own admin flag. Admin only.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id    path  int              true  "User ID"
+// @Param        body  body  AdminUserUpdate  true  "Fields to change"
+// @Success      200  {object}  AdminUser
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/users/{id} [patch]
+func AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromRoute(w, r, false)
+	if !ok {
+		return
+	}
+	var upd AdminUserUpdate
+	if !decodeJSONBody(w, r, adminUserBodyLimit, &upd) {
+		return
+	}
+
+	ctx := r.Context()
+	changes := map[string]any{}
+	if upd.Email != nil && strings.TrimSpace(*upd.Email) != u.Email {
+		email := strings.TrimSpace(*upd.Email)
+		if email == "" {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "email cannot be empty"})
+			return
+		}
+		var taken int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE email = $1 AND id <> $2`, email, u.ID).Scan(&taken); err != nil {
+			reportError(r, "email check error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+			return
+		}
+		if taken > 0 {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "email already in use"})
+			return
+		}
+		changes["email"] = email
+	}
+	if upd.IsAdmin != nil && *upd.IsAdmin != u.IsAdmin {
+		if self, _ := currentUserID(r); self == u.ID {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "cannot change your own admin flag"})
+			return
+		}
+		changes["is_admin"] = *upd.IsAdmin
+	}
+
+	if len(changes) > 0 {
+		email, admin := u.Email, u.IsAdmin
+		if v, ok := changes["email"].(string); ok {
+			email = v
+		}
+		if v, ok := changes["is_admin"].(bool); ok {
+			admin = v
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE users SET email = $1, is_admin = $2 WHERE id = $3`, email, admin, u.ID); err != nil {
+			reportError(r, "update user error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not update user"})
+			return
+		}
+		audit(r, "user.update", "user", u.ID, changes)
+	}
+
+	u, err := loadAdminUser(ctx, u.ID)
+	if err != nil {
+		reportError(r, "reload user error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// AdminResetPasswordHandler godoc
+// @Summary      Force a password reset
+// @Description  Ends the user's sessions, blocks password login and emails a single-use reset link (valid 24h) via the job queue. The user can log in again after choosing a new password. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id  path  int  true  "User ID"
+// @Success      202  {object}  AdminPasswordResetResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/users/{id}/reset-password [post]
+func AdminResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromRoute(w, r, false)
+	if !ok {
+		return
+	}
+	token, err := newResetToken()
+	if err != nil {
+		reportError(r, "reset token error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "internal error"})
+		return
+	}
+
+	ctx := r.Context()
+	resp := AdminPasswordResetResponse{ExpiresAt: time.Now().UTC().Add(passwordResetTTL)}
+	_, err = db.ExecContext(ctx, `
+UPDATE users
+SET must_reset_password = TRUE, password_reset_hash = $1, password_reset_expires = $2,
+    session_version = session_version + 1
+WHERE id = $3`, hashResetToken(token), resp.ExpiresAt, u.ID)
+	if err != nil {
+		reportError(r, "reset password error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not reset password"})
+		return
+	}
+
+	if jobQueue != nil {
+		link := publicURL(r) + "/reset-password?" + url.Values{"token": {token}}.Encode()
+		_, err := jobQueue.Enqueue(ctx, JobSendEmail, SendEmailPayload{
+			To:      u.Email,
+			Subject: "Reset your WhoKnows password",
+			Body: "Hi " + u.Username + ",\n\nAn administrator has reset your password. Choose a new one here:\n\n" +
+				link + "\n\nThe link expires in 24 hours.\n",
+		})
+		if err != nil {
+			reportError(r, "enqueue reset email error", err)
+		}
+		resp.EmailQueued = err == nil
+	}
+	audit(r, "user.reset_password", "user", u.ID, map[string]any{"email_queued": resp.EmailQueued})
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// newResetToken returns an unguessable password reset token; only its hash is stored.
+func newResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
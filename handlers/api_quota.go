@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// Daily API quotas. Besides the per-minute rate limits by client address, every logged-in user
+// may make API_DAILY_QUOTA calls to the API routes (/api/... and /graphql) per UTC day, counted
+// in api_usage so the quota holds across replicas. Responses carry X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset (seconds until the quota resets); over the quota
+// the call gets 429 until midnight UTC. Anonymous calls are only rate limited. GET /api/me shows
+// the day's usage.
+
+// apiUsageRetention is how long api_usage rows are kept (purge_deleted deletes older days).
+const apiUsageRetention = 30 * 24 * time.Hour
+
+// apiDailyQuota is the calls per user and day; 0 means unlimited.
+var apiDailyQuota atomic.Int64
+
+// SetAPIDailyQuota sets the calls each user may make per UTC day (0 = unlimited).
+func SetAPIDailyQuota(calls int) {
+	apiDailyQuota.Store(int64(calls))
+}
+
+// APIUsage is a user's API usage for the current UTC day.
+type APIUsage struct {
+	Day   string `json:"day" example:"2026-10-18"` // UTC
+	Calls int    `json:"calls" example:"42"`
+	// Limit is the daily quota; 0 means unlimited, and remaining is left out.
+	Limit     int       `json:"limit" example:"5000"`
+	Remaining *int      `json:"remaining,omitempty" example:"4958"`
+	ResetsAt  time.Time `json:"resets_at" example:"2026-10-19T00:00:00Z"`
+}
+
+// MeResponse is returned by GET /api/me.
+type MeResponse struct {
+	ID       int      `json:"id" example:"1"`
+	Username string   `json:"username" example:"alice"`
+	Email    string   `json:"email" example:"alice@example.com"`
+	APIUsage APIUsage `json:"api_usage"`
+}
+
+// apiQuotaExempt are the API routes the quota does not count, on purpose:
+//   - /api/me shows the usage, so checking it must not use it up;
+//   - /api/login, /api/register, /api/logout and /api/password-reset are the account flows,
+//     which have their own "auth" rate limit, and a user over the quota must still log out;
+//   - /api/search/click is the beacon the search page sends for every result click;
+//   - /api/metrics/summary is an ops endpoint for dashboards (METRICS_SUMMARY_TOKEN or admins).
+var apiQuotaExempt = []string{
+	"/api/me",
+	"/api/login",
+	"/api/register",
+	"/api/logout",
+	"/api/password-reset",
+	"/api/search/click",
+	"/api/metrics/summary",
+}
+
+// APIQuotaMiddleware applies APIQuota to every API route except apiQuotaExempt.
+func APIQuotaMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		counted := APIQuota(next.ServeHTTP)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !apiQuotaPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			counted(w, r)
+		})
+	}
+}
+
+func apiQuotaPath(path string) bool {
+	if path != "/graphql" && !strings.HasPrefix(path, "/api/") {
+		return false
+	}
+	for _, p := range apiQuotaExempt {
+		if path == p {
+			return false
+		}
+	}
+	return true
+}
+
+// APIQuota counts a call of a logged-in user against their daily quota and answers 429 once
+// it is used up. Database errors fail open, like the rate limiters.
+func APIQuota(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quota := int(apiDailyQuota.Load())
+		userID, ok := currentUserID(r)
+		if quota <= 0 || !ok || db == nil || databaseDown() {
+			next(w, r)
+			return
+		}
+
+		now := time.Now().UTC()
+		calls, allowed, err := countAPICall(r.Context(), userID, now, quota)
+		if err != nil {
+			log.Printf("api quota error: %v", err)
+			next(w, r)
+			return
+		}
+
+		reset := int(apiQuotaReset(now).Sub(now).Seconds()) + 1
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(quota))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(quota-calls, 0)))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(reset))
+		if !allowed {
+			metrics.RateLimited.WithLabelValues("api_quota").Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(reset))
+			writeJSON(w, http.StatusTooManyRequests, APIErrorResponse{Error: "daily API quota exceeded"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// countAPICall adds a call to the user's count for now's day unless the quota is used up.
+// It returns the calls made so far today (including this one when allowed).
+func countAPICall(ctx context.Context, userID int, now time.Time, quota int) (int, bool, error) {
+	day := now.Format(time.DateOnly)
+	var calls int
+	err := db.QueryRowContext(ctx, `
+INSERT INTO api_usage (user_id, day, calls) VALUES ($1, $2, 1)
+ON CONFLICT (user_id, day) DO UPDATE SET calls = api_usage.calls + 1
+WHERE api_usage.calls < $3
+RETURNING calls`, userID, day, quota,
+	).Scan(&calls)
+	if errors.Is(err, sql.ErrNoRows) { // the update was skipped: quota used up
+		return quota, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return calls, true, nil
+}
+
+// loadAPIUsage returns the user's usage for now's day.
+func loadAPIUsage(ctx context.Context, userID int, now time.Time) (APIUsage, error) {
+	u := APIUsage{
+		Day:      now.Format(time.DateOnly),
+		Limit:    int(apiDailyQuota.Load()),
+		ResetsAt: apiQuotaReset(now),
+	}
+	err := db.QueryRowContext(ctx,
+		`SELECT calls FROM api_usage WHERE user_id = $1 AND day = $2`, userID, u.Day,
+	).Scan(&u.Calls)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return u, err
+	}
+	if u.Limit > 0 {
+		remaining := max(u.Limit-u.Calls, 0)
+		u.Remaining = &remaining
+	}
+	return u, nil
+}
+
+// apiQuotaReset is the next midnight UTC after now.
+func apiQuotaReset(now time.Time) time.Time {
+	return now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+}
+
+// pruneAPIUsage deletes the usage of days older than apiUsageRetention.
+func pruneAPIUsage(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	res, err := db.ExecContext(ctx, `DELETE FROM api_usage WHERE day < $1`,
+		time.Now().UTC().Add(-apiUsageRetention).Format(time.DateOnly))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("pruned %d API usage row(s)", n)
+	}
+	return nil
+}
+
+// APIMeHandler godoc
+// @Summary      Current user
+// @Description  Returns the logged-in user and their API usage today (calls, the daily quota API_DAILY_QUOTA, remaining calls and when the count resets at midnight UTC). Requires session auth; not counted against the quota.
+// @Tags         Auth
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  MeResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me [get]
+func APIMeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	account, err := loadSettingsAccount(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusUnauthorized, APIErrorResponse{Error: "unauthorized"})
+		return
+	}
+	if err != nil {
+		reportError(r, "load account error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	usage, err := loadAPIUsage(r.Context(), userID, time.Now().UTC())
+	if err != nil {
+		reportError(r, "load api usage error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, MeResponse{
+		ID:       account.ID,
+		Username: account.Username,
+		Email:    account.Email,
+		APIUsage: usage,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"devops-valgfag/internal/sanitize"
+
+	"github.com/gorilla/mux"
+)
+
+// Article view: the full stored content of a local page at /page/{id} (HTML) and
+// /api/pages/{id} (JSON), with related pages and prev/next links within its language.
+
+// PageLink is a reference to another page.
+type PageLink struct {
+	ID    int    `json:"id" example:"43"`
+	Title string `json:"title" example:"Gopher"`
+	URL   string `json:"url" example:"/gopher"`
+}
+
+// PageView is a page with its rendered content and navigation, returned by GET /api/pages/{id}.
+type PageView struct {
+	Page
+	ContentHTML string     `json:"content_html"` // sanitized HTML of content
+	Related     []PageLink `json:"related"`
+	Prev        *PageLink  `json:"prev,omitempty"`
+	Next        *PageLink  `json:"next,omitempty"`
+}
+
+// loadPageView loads a page with everything the article view shows. Related pages and
+// prev/next are best effort: failures are logged and leave them empty.
+func loadPageView(ctx context.Context, id int) (PageView, error) {
+	p, err := loadPage(ctx, id)
+	if err != nil {
+		return PageView{}, err
+	}
+	v := PageView{Page: p, ContentHTML: sanitize.Content(p.Content), Related: []PageLink{}}
+
+	if v.Related, err = relatedPages(ctx, p, relatedDefaultLimit); err != nil {
+		log.Println("related pages error:", err)
+		v.Related = []PageLink{}
+	}
+	if v.Prev, err = adjacentPage(ctx, p, false); err != nil {
+		log.Println("previous page error:", err)
+	}
+	if v.Next, err = adjacentPage(ctx, p, true); err != nil {
+		log.Println("next page error:", err)
+	}
+	return v, nil
+}
+
+// adjacentPage returns the page before (or after) p by id in the same language and tenant.
+func adjacentPage(ctx context.Context, p Page, next bool) (*PageLink, error) {
+	q := `SELECT id, title, url FROM pages WHERE language = $1 AND tenant_id = $3 AND deleted_at IS NULL AND id < $2 ORDER BY id DESC LIMIT 1`
+	if next {
+		q = `SELECT id, title, url FROM pages WHERE language = $1 AND tenant_id = $3 AND deleted_at IS NULL AND id > $2 ORDER BY id LIMIT 1`
+	}
+	var l PageLink
+	err := db.QueryRowContext(ctx, q, p.Language, p.ID, tenantID(ctx)).Scan(&l.ID, &l.Title, &l.URL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func queryPageLinks(ctx context.Context, query string, args ...any) ([]PageLink, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	out := []PageLink{}
+	for rows.Next() {
+		var l PageLink
+		if err := rows.Scan(&l.ID, &l.Title, &l.URL); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// ArticlePageHandler renders the full content of a local page.
+func ArticlePageHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil || databaseDown() {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	v, err := loadPageView(r.Context(), id)
+	switch {
+	case errors.Is(err, errPageNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		reportError(r, "load page error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, r, "article", map[string]any{
+		"Title": v.Title,
+		"Page":  v,
+		// Safe: ContentHTML went through sanitize.Content.
+		"Content": template.HTML(v.ContentHTML),
+	})
+}
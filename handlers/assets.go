@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-valgfag/static"
+)
+
+// Static assets are embedded in the binary (package static) and served under /static/ with a
+// hash of their content in the name (style.3f2a9c1b7e.css). Templates link them with
+// {{asset "style.css"}}, so a deploy changes the URL of every file that changed and browsers
+// may cache the files for a year. A file with a .br or .gz sibling is served precompressed to
+// clients accepting it. The plain name still works, with a short cache lifetime, for links from
+// outside the templates.
+
+const (
+	assetHashLen        = 10
+	assetCacheImmutable = "public, max-age=31536000, immutable"
+	assetCacheShort     = "public, max-age=300"
+)
+
+// assetEncodings are the precompressed variants, in order of preference.
+var assetEncodings = []struct{ name, ext string }{{"br", ".br"}, {"gzip", ".gz"}}
+
+// assetFile is one static file and its precompressed variants.
+type assetFile struct {
+	name        string // "css/site.css"
+	hashed      string // "css/site.3f2a9c1b7e.css"
+	hash        string
+	contentType string
+	data        []byte
+	encoded     map[string][]byte // Content-Encoding -> body
+}
+
+// assetSet maps both the plain and the hashed name of every file to it.
+type assetSet map[string]*assetFile
+
+var assets = struct {
+	sync.Mutex
+	set assetSet
+	dir string // TEMPLATE_RELOAD: re-read from this directory on every use
+}{set: mustLoadAssets(static.FS)}
+
+func mustLoadAssets(fsys fs.FS) assetSet {
+	set, err := loadAssets(fsys)
+	if err != nil {
+		panic("static assets: " + err.Error())
+	}
+	return set
+}
+
+// loadAssets reads and fingerprints the files of fsys.
+func loadAssets(fsys fs.FS) (assetSet, error) {
+	set := assetSet{}
+	var variants []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch path.Ext(name) {
+		case ".go":
+			return nil
+		case ".br", ".gz":
+			variants = append(variants, name)
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])[:assetHashLen]
+		ext := path.Ext(name)
+		f := &assetFile{
+			name:        name,
+			hashed:      strings.TrimSuffix(name, ext) + "." + hash + ext,
+			hash:        hash,
+			contentType: mime.TypeByExtension(ext),
+			data:        data,
+			encoded:     map[string][]byte{},
+		}
+		if f.contentType == "" {
+			f.contentType = http.DetectContentType(data)
+		}
+		set[f.name] = f
+		set[f.hashed] = f
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range variants {
+		f := set[strings.TrimSuffix(name, path.Ext(name))]
+		if f == nil {
+			continue // a compressed file without its original is not served
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, enc := range assetEncodings {
+			if path.Ext(name) == enc.ext {
+				f.encoded[enc.name] = data
+			}
+		}
+	}
+	return set, nil
+}
+
+// EnableAssetReload serves static files from dir instead of the embedded copy, re-reading them
+// on every use so CSS edits show up without a rebuild (TEMPLATE_RELOAD=1, dev only). An empty
+// dir goes back to the embedded files.
+func EnableAssetReload(dir string) {
+	assets.Lock()
+	defer assets.Unlock()
+	assets.dir = dir
+	if dir == "" {
+		assets.set = mustLoadAssets(static.FS)
+	}
+}
+
+// currentAssets returns the asset set to serve and link.
+func currentAssets() assetSet {
+	assets.Lock()
+	defer assets.Unlock()
+	if assets.dir == "" {
+		return assets.set
+	}
+	set, err := loadAssets(os.DirFS(assets.dir))
+	if err != nil {
+		log.Println("asset reload error (keeping previous assets):", err)
+		return assets.set
+	}
+	assets.set = set
+	return set
+}
+
+// Asset returns the URL of a static file by its plain name ("style.css"), fingerprinted when
+// the file exists. Templates call it as {{asset "style.css"}}.
+func Asset(name string) string {
+	if f, ok := currentAssets()[name]; ok {
+		return URL("/static/" + f.hashed)
+	}
+	return URL("/static/" + name)
+}
+
+// StaticHandler serves the static files; it expects the /static/ prefix to be stripped.
+// Fingerprinted names are cached for a year, plain names for five minutes.
+func StaticHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		f, ok := currentAssets()[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		cacheControl := assetCacheShort
+		if name == f.hashed {
+			cacheControl = assetCacheImmutable
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("Content-Type", f.contentType)
+
+		body, etag := f.data, f.hash
+		if len(f.encoded) > 0 {
+			w.Header().Add("Vary", "Accept-Encoding")
+			for _, enc := range assetEncodings {
+				if data, ok := f.encoded[enc.name]; ok && acceptsEncoding(r, enc.name) {
+					w.Header().Set("Content-Encoding", enc.name)
+					body, etag = data, f.hash+"-"+enc.name
+					break
+				}
+			}
+		}
+		w.Header().Set("ETag", strconv.Quote(etag))
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(body))
+	})
+}
+
+// acceptsEncoding reports whether r's Accept-Encoding allows enc: listed (or matched by "*")
+// without q=0. An explicit entry wins over "*".
+func acceptsEncoding(r *http.Request, enc string) bool {
+	star := false
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		allowed := true
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				allowed = false
+			}
+		}
+		if strings.EqualFold(coding, enc) {
+			return allowed
+		}
+		if coding == "*" {
+			star = allowed
+		}
+	}
+	return star
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Admin actions that change accounts or content are recorded in audit_log: who did what to
+// which target, plus action-specific details. Writing the entry is best effort; a failure is
+// reported but never undoes or fails the action itself.
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 500
+)
+
+// AuditEntry is one recorded admin action.
+type AuditEntry struct {
+	ID         int64          `json:"id" example:"12"`
+	ActorID    *int           `json:"actor_id,omitempty" example:"1"` // null once the actor is purged
+	Action     string         `json:"action" example:"user.disable"`
+	TargetType string         `json:"target_type" example:"user"`
+	TargetID   *int           `json:"target_id,omitempty" example:"7"`
+	Details    map[string]any `json:"details"`
+	ClientIP   string         `json:"client_ip,omitempty" example:"203.0.113.7"` // empty for entries recorded before it was kept
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// AdminAuditLogResponse is returned by GET /admin/audit.
+type AdminAuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// audit records an admin action by the current user and the client address it came from.
+// details may be nil.
+func audit(r *http.Request, action, targetType string, targetID int, details map[string]any) {
+	if db == nil {
+		return
+	}
+	if details == nil {
+		details = map[string]any{}
+	}
+	raw, err := json.Marshal(details)
+	if err != nil {
+		reportError(r, "audit details error", err)
+		return
+	}
+	var actor any
+	if id, ok := currentUserID(r); ok {
+		actor = id
+	}
+	ip := clientIP(r)
+	_, err = db.ExecContext(r.Context(), `
+INSERT INTO audit_log (actor_id, action, target_type, target_id, details, client_ip, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		actor, action, targetType, targetID, string(raw), ip, time.Now().UTC(),
+	)
+	if err != nil {
+		reportError(r, "audit log insert error", err)
+		return
+	}
+	log.Printf("audit: actor=%v client_ip=%s action=%s target=%s/%d details=%s", actor, ip, action, targetType, targetID, raw)
+}
+
+// AdminAuditLogHandler godoc
+// @Summary      Audit log
+// @Description  Returns recorded admin actions, newest first, optionally for one target (e.g. target_type=user&target_id=7). Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        target_type  query  string  false  "Target type (user, page)"
+// @Param        target_id    query  int     false  "Target ID (requires target_type)"
+// @Param        limit        query  int     false  "Max entries returned (default 100, max 500)"
+// @Success      200  {object}  AdminAuditLogResponse
+// @Failure      400  {object}  APIErrorResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/audit [get]
+func AdminAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := auditDefaultLimit
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 {
+		limit = min(n, auditMaxLimit)
+	}
+
+	where, args := "", []any{}
+	if tt := q.Get("target_type"); tt != "" {
+		args = append(args, tt)
+		where = ` WHERE target_type = $1`
+		if raw := q.Get("target_id"); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "invalid target_id"})
+				return
+			}
+			args = append(args, id)
+			where += ` AND target_id = $2`
+		}
+	} else if q.Get("target_id") != "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "target_id requires target_type"})
+		return
+	}
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(r.Context(), `
+SELECT id, actor_id, action, target_type, target_id, details, COALESCE(client_ip, ''), created_at
+FROM audit_log`+where+`
+ORDER BY created_at DESC, id DESC
+LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		reportError(r, "audit log query error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	resp := AdminAuditLogResponse{Entries: []AuditEntry{}}
+	for rows.Next() {
+		var (
+			e       AuditEntry
+			details []byte
+		)
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID, &details, &e.ClientIP, &e.CreatedAt); err != nil {
+			reportError(r, "audit log scan error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+			return
+		}
+		if err := json.Unmarshal(details, &e.Details); err != nil || e.Details == nil {
+			e.Details = map[string]any{}
+		}
+		resp.Entries = append(resp.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		reportError(r, "audit log query error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
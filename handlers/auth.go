@@ -1,99 +1,101 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"devops-valgfag/internal/apperror"
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/service"
 )
 
 const (
 	loginTitle    = "Sign In"
 	registerTitle = "Sign Up"
+
+	// authFormLimit caps the login and sign-up form bodies (a CAPTCHA token is the largest field).
+	authFormLimit = 16 << 10
 )
 
 // User represents the user object returned from the database.
 // The Password field contains a bcrypt hash (never a plaintext password).
 type User struct {
-	ID       int
-	Username string
-	Email    string
-	Password string
+	ID             int
+	Username       string
+	Email          string
+	Password       string
+	SessionVersion int // stored in the session; see SessionGuardMiddleware
 }
 
 // APILoginHandler authenticates a user and starts a cookie-based session.
 //
 // Behavior:
-// - Expects form fields: username, password (application/x-www-form-urlencoded).
+// - Expects form fields: username, password (application/x-www-form-urlencoded), optionally
+//   remember to also get a long-lived remember-me cookie (see remember_me.go).
 // - On success: stores the authenticated user_id in the "session" cookie and redirects to "/" (302).
-// - On failure (bad form / bad credentials): renders the login page with an error and returns 200.
-// - Avoids username enumeration by not distinguishing between "unknown user" and "wrong password".
+//   A login from a device the user has not used before is emailed to them (see login_devices.go).
+// - On failure: renders the login page with an error and the matching status code
+//   (400 bad form, 401 bad credentials, 500 session error).
+// - Correct credentials for a pending, disabled or banned account (or one that must reset its
+//   password) render the login page with 403.
+// - Avoids username enumeration by not distinguishing between "unknown user" and "wrong password",
+//   also not in response time: unknown users are checked against a dummy bcrypt hash and failures
+//   are delayed by a jittered LOGIN_FAILURE_DELAY (see service.AuthService).
 //
 // APILoginHandler godoc
 // @Summary      User login
-// @Description  Authenticate a user and start a session. On failure, renders the login page (HTTP 200) with an error message.
+// @Description  Authenticate a user and start a session. On failure, renders the login page with an error message and an error status.
 // @Tags         Auth
 // @Accept       application/x-www-form-urlencoded
 // @Produce      html
 // @Param        username  formData  string  true   "Username"
 // @Param        password  formData  string  true   "Password"
+// @Param        remember  formData  string  false  "Non-empty to stay logged in (REMEMBER_ME_TTL)"
 // @Success      302  {string}  string  "Redirect to home page"
-// @Success      200  {string}  string  "Rendered login form with errors"
+// @Failure      400  {string}  string  "Rendered login form: bad request"
+// @Failure      401  {string}  string  "Rendered login form: invalid username or password"
+// @Failure      403  {string}  string  "Account pending, disabled or banned, or password reset required"
+// @Failure      500  {string}  string  "Rendered login form: internal error"
 // @Router       /api/login [post]
 func APILoginHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, authFormLimit)
 	if err := r.ParseForm(); err != nil {
-		renderTemplate(w, r, "login", map[string]any{
-			"Title": loginTitle,
-			"Error": "Bad request",
-		})
+		renderAuthFailure(w, r, "login", map[string]any{"Title": loginTitle}, errBadForm)
 		return
 	}
 
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
-	u := User{}
-
-	// Query PostgreSQL using parameter placeholder $1
-	err := db.QueryRow(
-		`SELECT id, username, email, password FROM users WHERE username = $1`,
-		username,
-	).Scan(&u.ID, &u.Username, &u.Email, &u.Password)
-
-	// Avoid username enumeration by not distinguishing between "bad user" and "bad password"
-	if err != nil || bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) != nil {
-		renderTemplate(w, r, "login", map[string]any{
+	u, err := authenticateUser(r.Context(), username, password)
+	if err != nil {
+		renderAuthFailure(w, r, "login", map[string]any{
 			"Title":    loginTitle,
-			"Error":    "Invalid username or password",
 			"Username": username,
-		})
+		}, err)
 		return
 	}
 
 	// Create a session for the authenticated user
-	sess, err := sessionStore.Get(r, "session")
-	if err != nil {
-		log.Printf("sessionStore.Get error (login): %v", err)
-		renderTemplate(w, r, "login", map[string]any{
+	if err := startSession(w, r, u); err != nil {
+		renderAuthFailure(w, r, "login", map[string]any{
 			"Title":    loginTitle,
-			"Error":    "Internal server error",
 			"Username": username,
-		})
+		}, apperror.Wrap(apperror.Internal, apperror.InternalMessage, fmt.Errorf("startSession (login): %w", err)))
 		return
 	}
-
-	sess.Values["user_id"] = u.ID
-	if err := sess.Save(r, w); err != nil {
-		log.Printf("sess.Save error (login): %v", err)
-		renderTemplate(w, r, "login", map[string]any{
-			"Title":    loginTitle,
-			"Error":    "Internal server error",
-			"Username": username,
-		})
-		return
+	if r.FormValue("remember") != "" {
+		if err := issueRememberToken(w, r, u); err != nil {
+			reportError(r, "remember token error", err) // the session works without it
+		}
 	}
+	noteLoginDevice(r, u)
 
-	http.Redirect(w, r, "/", http.StatusFound)
+	redirect(w, r, "/", http.StatusFound)
 }
 
 // APIRegisterHandler creates a new user account.
@@ -101,11 +103,17 @@ func APILoginHandler(w http.ResponseWriter, r *http.Request) {
 // Behavior:
 // - Expects form fields: username, email, password, password2 (application/x-www-form-urlencoded).
 // - On success: inserts the user (bcrypt password hash) and redirects to "/login" (302).
-// - On validation / DB errors: renders the register page with an error and returns 200.
+// - On failure: renders the register page with an error and the matching status code
+//   (400 bad form or invalid input, 409 username taken, 500 DB errors).
+// - Bot checks (see register_guard.go): a filled-in honeypot field is answered like a success
+//   without creating the user; a form submitted too fast, an expired form or a failed CAPTCHA
+//   re-renders the form with 400 (503 when the CAPTCHA service cannot be reached).
+// - With TERMS_VERSION set, accept_terms must be ticked (400 otherwise); the accepted version
+//   is recorded with the account (see consent.go).
 //
 // APIRegisterHandler godoc
 // @Summary      Register user
-// @Description  Create a new user account. On validation errors, renders the register page (HTTP 200) with an error message.
+// @Description  Create a new user account. On failure, renders the register page with an error message and an error status.
 // @Tags         Auth
 // @Accept       application/x-www-form-urlencoded
 // @Produce      html
@@ -113,15 +121,18 @@ func APILoginHandler(w http.ResponseWriter, r *http.Request) {
 // @Param        email      formData  string  true   "Email address"
 // @Param        password   formData  string  true   "Password"
 // @Param        password2  formData  string  true   "Password confirmation"
+// @Param        form_token formData  string  false  "Signed render time of the form (required with REGISTER_MIN_SUBMIT_TIME)"
+// @Param        accept_terms formData  string  false  "Non-empty to accept the terms of service and privacy policy (required with TERMS_VERSION)"
 // @Success      302  {string}  string  "Redirect to login page"
-// @Success      200  {string}  string  "Rendered register form with errors"
+// @Failure      400  {string}  string  "Rendered register form: missing fields, passwords do not match, terms not accepted, form submitted too fast or CAPTCHA failed"
+// @Failure      409  {string}  string  "Rendered register form: username already in use"
+// @Failure      500  {string}  string  "Rendered register form: internal error"
+// @Failure      503  {string}  string  "Rendered register form: CAPTCHA service unavailable"
 // @Router       /api/register [post]
 func APIRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, authFormLimit)
 	if err := r.ParseForm(); err != nil {
-		renderTemplate(w, r, "register", map[string]any{
-			"Title": registerTitle,
-			"Error": "Bad request",
-		})
+		renderAuthFailure(w, r, "register", registerPageData(map[string]any{"Title": registerTitle}), errBadForm)
 		return
 	}
 
@@ -130,74 +141,39 @@ func APIRegisterHandler(w http.ResponseWriter, r *http.Request) {
 	pw1 := r.FormValue("password")
 	pw2 := r.FormValue("password2")
 
-	// Basic validation for required fields
-	if username == "" || email == "" || pw1 == "" {
-		renderTemplate(w, r, "register", map[string]any{
-			"Title": registerTitle,
-			"Error": "All fields required",
-		})
-		return
-	}
-
-	// Password confirmation check
-	if pw1 != pw2 {
-		renderTemplate(w, r, "register", map[string]any{
-			"Title": registerTitle,
-			"Error": "Passwords do not match",
-		})
-		return
-	}
-
-	// Check if username already exists
-	var exists int
-	err := db.QueryRow(
-		`SELECT COUNT(*) FROM users WHERE username = $1`,
-		username,
-	).Scan(&exists)
-	if err != nil {
-		log.Printf("register exists query error: %v", err)
-		renderTemplate(w, r, "register", map[string]any{
-			"Title": registerTitle,
-			"Error": "Database error",
-		})
-		return
-	}
-
-	if exists > 0 {
-		renderTemplate(w, r, "register", map[string]any{
-			"Title": registerTitle,
-			"Error": "Username already in use",
-		})
+	if block := checkRegistration(r); block != nil {
+		metrics.RegistrationBlocked.WithLabelValues(block.reason).Inc()
+		if block.reason == "honeypot" {
+			// Answer like a successful signup so the bot has no reason to retry.
+			redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		renderAuthFailure(w, r, "register", registerPageData(map[string]any{
+			"Title":    registerTitle,
+			"Username": username,
+			"Email":    email,
+		}), block.err)
 		return
 	}
 
-	// Hash the password using bcrypt
-	hash, err := bcrypt.GenerateFromPassword([]byte(pw1), bcrypt.DefaultCost)
-	if err != nil {
-		log.Printf("bcrypt.GenerateFromPassword error: %v", err)
-		renderTemplate(w, r, "register", map[string]any{
-			"Title": registerTitle,
-			"Error": "Internal error, please try again",
+	termsVersion, err := registrationTerms(r)
+	if err == nil {
+		err = authService.Register(r.Context(), service.Registration{
+			Username: username, Email: email, Password: pw1, Password2: pw2, Status: registrationStatus(),
+			TermsVersion: termsVersion,
 		})
-		return
 	}
-
-	// Insert new user into PostgreSQL
-	_, err = db.Exec(
-		`INSERT INTO users (username, email, password) VALUES ($1, $2, $3)`,
-		username, email, string(hash),
-	)
 	if err != nil {
-		log.Printf("register insert error: %v", err)
-		renderTemplate(w, r, "register", map[string]any{
-			"Title": registerTitle,
-			"Error": "Registration failed",
-		})
+		renderAuthFailure(w, r, "register", registerPageData(map[string]any{
+			"Title":    registerTitle,
+			"Username": username,
+			"Email":    email,
+		}), err)
 		return
 	}
 
 	// Redirect to login page after successful registration
-	http.Redirect(w, r, "/login", http.StatusFound)
+	redirect(w, r, "/login", http.StatusFound)
 }
 
 // APILogoutHandler clears the current user's session and redirects home.
@@ -219,17 +195,77 @@ func APIRegisterHandler(w http.ResponseWriter, r *http.Request) {
 func APILogoutHandler(w http.ResponseWriter, r *http.Request) {
 	sess, err := sessionStore.Get(r, "session")
 	if err != nil {
-		log.Printf("sessionStore.Get error (logout): %v", err)
+		reportError(r, "sessionStore.Get error (logout)", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	delete(sess.Values, "user_id")
+	forgetSession(r.Context(), sess)
+	forgetRememberToken(w, r)
 	if err := sess.Save(r, w); err != nil {
-		log.Printf("sess.Save error (logout): %v", err)
+		reportError(r, "sess.Save error (logout)", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	http.Redirect(w, r, "/", http.StatusFound)
+	redirect(w, r, "/", http.StatusFound)
+}
+
+// renderAuthFailure re-renders the login or register form (page) with err and counts the
+// failure in app_auth_failures_total.
+func renderAuthFailure(w http.ResponseWriter, r *http.Request, page string, data map[string]any, err error) {
+	metrics.AuthFailures.WithLabelValues(page, strconv.Itoa(apperror.KindOf(err).HTTPStatus())).Inc()
+	renderPageError(w, r, page, data, err)
+}
+
+// -----------------------------------------------------------------------------
+// Shared auth logic (used by the REST/form handlers and the GraphQL API)
+// -----------------------------------------------------------------------------
+
+// errBadForm is returned for a form body that cannot be parsed.
+var errBadForm = apperror.New(apperror.Invalid, "Bad request")
+
+// authService holds the login and sign-up rules (internal/service); accounts live in the users
+// table (see user_store.go).
+var authService = &service.AuthService{Users: sqlUserStore{}, FailureDelay: 250 * time.Millisecond}
+
+// SetLoginFailureDelay sets the minimum delay of a failed login (LOGIN_FAILURE_DELAY); failures
+// wait between d and 2*d. 0 turns the delay off.
+func SetLoginFailureDelay(d time.Duration) {
+	if d >= 0 {
+		authService.FailureDelay = d
+	}
+}
+
+// authenticateUser logs a user in with authService and returns the account for the session.
+// Unknown users and wrong passwords get the same error and take the same time.
+func authenticateUser(ctx context.Context, username, password string) (User, error) {
+	u, err := authService.Login(ctx, username, password)
+	if err != nil {
+		return User{}, err
+	}
+	return User{ID: u.ID, Username: u.Username, Email: u.Email, Password: u.PasswordHash, SessionVersion: u.SessionVersion}, nil
+}
+
+// startSession stores the authenticated user_id (and the account's session_version,
+// checked by SessionGuardMiddleware) in the "session" cookie, and records the session in
+// user_sessions.
+func startSession(w http.ResponseWriter, r *http.Request, u User) error {
+	sess, err := sessionStore.Get(r, "session")
+	if err != nil {
+		return err
+	}
+	forgetSession(r.Context(), sess) // a previous login in this browser
+	sess.Values["user_id"] = u.ID
+	sess.Values["session_version"] = u.SessionVersion
+	if db != nil {
+		// Untracked sessions work and get a row from SessionGuardMiddleware later.
+		if key, err := recordSession(r, u.ID, u.SessionVersion); err != nil {
+			log.Printf("record session error: %v", err)
+		} else {
+			sess.Values["session_key"] = key
+		}
+	}
+	return sess.Save(r, w)
 }
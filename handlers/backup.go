@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/lock"
+	"devops-valgfag/internal/storage"
+)
+
+// Backups are whole-database dumps kept in object storage under storage.BackupPrefix:
+// pg_dump custom-format archives on PostgreSQL (restore with pg_restore) and VACUUM INTO
+// copies on SQLite. They are named by creation time, so keys sort oldest first.
+
+const (
+	// backupNamePrefix starts every backup key; retention only ever deletes keys with it.
+	backupNamePrefix = storage.BackupPrefix + "whoknows-"
+	// backupTimeLayout names backups to the millisecond, so back-to-back backups never collide.
+	backupTimeLayout = "20060102T150405.000Z"
+	// backupURLTTL bounds the download links returned by GET /admin/backups.
+	backupURLTTL = 15 * time.Minute
+)
+
+// BackupConfig configures backup_database (see SetBackupConfig).
+type BackupConfig struct {
+	DSN    string // PostgreSQL connection URL handed to pg_dump (unused on SQLite)
+	PGDump string // pg_dump binary (default "pg_dump")
+	Keep   int    // newest backups kept; older ones are deleted after each backup (0 keeps all)
+}
+
+// backupConfig is set by SetBackupConfig.
+var backupConfig = BackupConfig{PGDump: "pg_dump"}
+
+// backupLockKey keeps replicas from dumping the database at the same time.
+var backupLockKey = lock.Key("db_backup")
+
+// backupMu stands in for the advisory lock on SQLite, which only runs as one process.
+var backupMu sync.Mutex
+
+// errBackupStorage is returned when no object storage is configured to keep backups in.
+var errBackupStorage = errors.New("backups need object storage (STORAGE_BACKEND)")
+
+// BackupInfo describes one stored backup.
+type BackupInfo struct {
+	Key         string    `json:"key" example:"backups/whoknows-20261017T020000.000Z.dump"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	DownloadURL string    `json:"download_url"` // signed, valid for 15 minutes
+}
+
+// BackupsResponse is returned by GET /admin/backups.
+type BackupsResponse struct {
+	Backups []BackupInfo `json:"backups"`
+}
+
+// BackupQueuedResponse is returned by POST /admin/backups.
+type BackupQueuedResponse struct {
+	JobID int64 `json:"job_id"`
+}
+
+// SetBackupConfig configures how backups are taken and how many are kept.
+func SetBackupConfig(cfg BackupConfig) {
+	if cfg.PGDump == "" {
+		cfg.PGDump = "pg_dump"
+	}
+	backupConfig = cfg
+}
+
+// backupDatabase dumps the database into storage and applies the retention policy. It
+// returns the new backup's key, or "" when another replica is already taking a backup.
+func backupDatabase(ctx context.Context) (string, error) {
+	if db == nil {
+		return "", errors.New("database not configured")
+	}
+	if objectStore == nil {
+		return "", errBackupStorage
+	}
+
+	var key string
+	err := withBackupLock(ctx, func(ctx context.Context) error {
+		ext, dump := ".dump", dumpPostgres
+		if sqlDialect == dialect.SQLite {
+			ext, dump = ".db", dumpSQLite
+		}
+
+		tmp, err := os.CreateTemp("", "whoknows-backup-*"+ext)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(tmp.Name()) }()
+		defer func() { _ = tmp.Close() }()
+
+		start := time.Now()
+		if err := dump(ctx, tmp); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, 0); err != nil {
+			return err
+		}
+		key = backupNamePrefix + start.UTC().Format(backupTimeLayout) + ext
+		if err := objectStore.Put(ctx, key, tmp, "application/octet-stream"); err != nil {
+			return fmt.Errorf("store backup: %w", err)
+		}
+		log.Printf("backup_database: stored %s in %s", key, time.Since(start).Round(time.Millisecond))
+
+		return pruneBackups(ctx, backupConfig.Keep)
+	})
+	if errors.Is(err, lock.ErrNotAcquired) {
+		log.Println("backup_database: another backup is running, skipping")
+		return "", nil
+	}
+	return key, err
+}
+
+// withBackupLock runs fn unless another backup holds the lock (lock.ErrNotAcquired).
+func withBackupLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	if sqlDialect == dialect.SQLite {
+		if !backupMu.TryLock() {
+			return lock.ErrNotAcquired
+		}
+		defer backupMu.Unlock()
+		return fn(ctx)
+	}
+	return lock.TryWithLock(ctx, db, backupLockKey, fn)
+}
+
+// dumpPostgres runs pg_dump into out. The password is passed in PGPASSWORD rather than on
+// the command line, where other processes could read it.
+func dumpPostgres(ctx context.Context, out *os.File) error {
+	if backupConfig.DSN == "" {
+		return errors.New("no PostgreSQL connection URL for pg_dump")
+	}
+	u, err := url.Parse(backupConfig.DSN)
+	if err != nil {
+		return fmt.Errorf("parse DSN: %w", err)
+	}
+	env := os.Environ()
+	if u.User != nil {
+		if pw, ok := u.User.Password(); ok {
+			env = append(env, "PGPASSWORD="+pw)
+			u.User = url.User(u.User.Username())
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, backupConfig.PGDump,
+		"--format=custom", "--no-owner", "--no-privileges", "--dbname="+u.String())
+	cmd.Env = env
+	cmd.Stdout = out
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 500 {
+			msg = msg[:500]
+		}
+		return fmt.Errorf("pg_dump: %w: %s", err, msg)
+	}
+	return nil
+}
+
+// dumpSQLite writes a consistent copy of the database into out with VACUUM INTO, which
+// needs an empty target file.
+func dumpSQLite(ctx context.Context, out *os.File) error {
+	if _, err := db.ExecContext(ctx, `VACUUM INTO $1`, out.Name()); err != nil {
+		return fmt.Errorf("vacuum into: %w", err)
+	}
+	return nil
+}
+
+// listBackups returns the stored backups, newest first.
+func listBackups(ctx context.Context) ([]storage.ObjectInfo, error) {
+	objects, err := objectStore.List(ctx, backupNamePrefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key > objects[j].Key })
+	return objects, nil
+}
+
+// pruneBackups deletes all but the keep newest backups (keep <= 0 keeps everything).
+func pruneBackups(ctx context.Context, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	backups, err := listBackups(ctx)
+	if err != nil {
+		return fmt.Errorf("list backups: %w", err)
+	}
+	for _, b := range backups[min(keep, len(backups)):] {
+		if err := objectStore.Delete(ctx, b.Key); err != nil {
+			return fmt.Errorf("delete backup %s: %w", b.Key, err)
+		}
+		log.Printf("backup_database: deleted %s (BACKUP_KEEP=%d)", b.Key, keep)
+	}
+	return nil
+}
+
+// backupCreatedAt reads the creation time from the backup's name; the object's modification
+// time is only a fallback, since copying backups between buckets changes it.
+func backupCreatedAt(o storage.ObjectInfo) time.Time {
+	name := strings.TrimPrefix(o.Key, backupNamePrefix)
+	if t, err := time.Parse(backupTimeLayout, strings.TrimSuffix(name, path.Ext(name))); err == nil {
+		return t
+	}
+	return o.ModTime
+}
+
+// backupDatabaseTask is the backup_database task: it queues a backup job so a failed dump is
+// retried like other jobs.
+func backupDatabaseTask(ctx context.Context) error {
+	if objectStore == nil || jobQueue == nil {
+		return nil
+	}
+	_, err := jobQueue.Enqueue(ctx, JobBackupDatabase, struct{}{})
+	return err
+}
+
+func runBackupJob(ctx context.Context, _ json.RawMessage) error {
+	_, err := backupDatabase(ctx)
+	return err
+}
+
+// AdminBackupsHandler godoc
+// @Summary      List database backups
+// @Description  Returns the stored backups, newest first, with download links valid for 15 minutes. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  BackupsResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /admin/backups [get]
+func AdminBackupsHandler(w http.ResponseWriter, r *http.Request) {
+	if objectStore == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "storage not configured"})
+		return
+	}
+	ctx := r.Context()
+	objects, err := listBackups(ctx)
+	if err != nil {
+		reportError(r, "list backups error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not list backups"})
+		return
+	}
+
+	backups := make([]BackupInfo, 0, len(objects))
+	for _, o := range objects {
+		link, err := objectStore.SignedURL(ctx, o.Key, backupURLTTL)
+		if err != nil {
+			reportError(r, "sign backup url error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not list backups"})
+			return
+		}
+		backups = append(backups, BackupInfo{Key: o.Key, Size: o.Size, CreatedAt: backupCreatedAt(o), DownloadURL: link})
+	}
+	writeJSON(w, http.StatusOK, BackupsResponse{Backups: backups})
+}
+
+// AdminCreateBackupHandler godoc
+// @Summary      Back up the database now
+// @Description  Queues a backup_database job that dumps the database into storage under backups/ and then deletes backups beyond BACKUP_KEEP. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Success      202  {object}  BackupQueuedResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /admin/backups [post]
+func AdminCreateBackupHandler(w http.ResponseWriter, r *http.Request) {
+	if jobQueue == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "job queue not configured"})
+		return
+	}
+	if objectStore == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "storage not configured"})
+		return
+	}
+	id, err := jobQueue.Enqueue(r.Context(), JobBackupDatabase, struct{}{})
+	if err != nil {
+		reportError(r, "enqueue backup error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not queue backup"})
+		return
+	}
+	audit(r, "backup.create", "job", int(id), map[string]any{})
+	writeJSON(w, http.StatusAccepted, BackupQueuedResponse{JobID: id})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// BASE_PATH mounts the app under a path prefix (/whoknows) behind a reverse proxy. Routes,
+// handlers and templates keep working with unprefixed paths: BasePathMiddleware strips the
+// prefix from requests, and URL puts it back in front of links and redirects.
+
+// basePath is the configured prefix ("/whoknows"), or "" when the app is mounted at the root.
+var basePath string
+
+// SetBasePath configures the path prefix the app is served under. p is "" or a path with a
+// leading and without a trailing slash (the config validates it).
+func SetBasePath(p string) {
+	basePath = p
+}
+
+// URL returns a site-relative path ("/search?q=go") with the base path in front, for links,
+// redirects and asset URLs. Absolute URLs and anything else not starting with a single "/"
+// are returned as they are. Templates call it as {{url "/path"}}.
+func URL(path string) string {
+	if basePath == "" || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return path
+	}
+	return basePath + path
+}
+
+// redirect is http.Redirect to URL(target).
+func redirect(w http.ResponseWriter, r *http.Request, target string, code int) {
+	http.Redirect(w, r, URL(target), code)
+}
+
+// stripBasePath returns path without the base path, for paths seen by the client (a Referer).
+func stripBasePath(path string) string {
+	if basePath == "" {
+		return path
+	}
+	if path == basePath {
+		return "/"
+	}
+	if rest, ok := strings.CutPrefix(path, basePath+"/"); ok {
+		return "/" + rest
+	}
+	return path
+}
+
+// BasePathMiddleware strips the base path from request paths; the bare prefix is redirected to
+// the prefix with a trailing slash. Requests without the prefix are served as they are, so
+// health probes hitting the container and proxies that strip the prefix themselves keep
+// working. Like TenantMiddleware, it wraps the router instead of being added with Use.
+func BasePathMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if basePath == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.URL.Path == basePath {
+				target := basePath + "/"
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			}
+			if rest, ok := strings.CutPrefix(r.URL.Path, basePath+"/"); ok {
+				r.URL.Path = "/" + rest
+				r.URL.RawPath = ""
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Per-user cap keeps the bookmarks page and list endpoint bounded.
+const maxBookmarksPerUser = 500
+
+// Bookmark is a search result saved by a logged-in user.
+type Bookmark struct {
+	ID        int64     `json:"id" example:"1"`
+	Title     string    `json:"title" example:"Golang"`
+	URL       string    `json:"url" example:"https://go.dev"`
+	Public    bool      `json:"public"` // shown on the owner's profile page
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BookmarkRequest is the body accepted by POST /api/me/bookmarks.
+type BookmarkRequest struct {
+	Title  string `json:"title" example:"Golang"`
+	URL    string `json:"url" example:"https://go.dev"`
+	Public bool   `json:"public"`
+}
+
+// BookmarkUpdate is the body accepted by PATCH /api/me/bookmarks/{id}.
+type BookmarkUpdate struct {
+	Public bool `json:"public"`
+}
+
+// APIBookmarksResponse is returned by GET /api/me/bookmarks.
+type APIBookmarksResponse struct {
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// APICreateBookmarkHandler godoc
+// @Summary      Save a result
+// @Description  Bookmarks a result (title + URL) for the current user. Saving the same URL again returns the existing bookmark. Requires session auth.
+// @Tags         Bookmarks
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  BookmarkRequest  true  "Result to save"
+// @Success      200  {object}  Bookmark  "Already bookmarked"
+// @Success      201  {object}  Bookmark
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/bookmarks [post]
+func APICreateBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req BookmarkRequest
+	if !decodeJSONBody(w, r, 4096, &req) {
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	target := strings.TrimSpace(req.URL)
+	if title == "" || target == "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "title and url are required"})
+		return
+	}
+
+	ctx := r.Context()
+	if existing, found, err := findBookmark(ctx, userID, target); err != nil {
+		reportError(r, "bookmark lookup error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	} else if found {
+		writeJSON(w, http.StatusOK, existing)
+		return
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM bookmarks WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		reportError(r, "bookmark count error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	if count >= maxBookmarksPerUser {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "bookmark limit reached (max 500)"})
+		return
+	}
+
+	// ON CONFLICT DO NOTHING covers a concurrent save of the same URL; the re-read returns the winner.
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO bookmarks (user_id, title, url, is_public) VALUES ($1, $2, $3, $4) ON CONFLICT (user_id, url) DO NOTHING`,
+		userID, title, target, req.Public,
+	)
+	if err != nil {
+		reportError(r, "create bookmark error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save bookmark"})
+		return
+	}
+
+	b, _, err := findBookmark(ctx, userID, target)
+	if err != nil {
+		reportError(r, "bookmark reload error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, b)
+}
+
+// APIListBookmarksHandler godoc
+// @Summary      List bookmarks
+// @Description  Returns the current user's bookmarks, newest first. Requires session auth.
+// @Tags         Bookmarks
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  APIBookmarksResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/bookmarks [get]
+func APIListBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := queryBookmarks(r.Context(), userID)
+	if err != nil {
+		reportError(r, "list bookmarks error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIBookmarksResponse{Bookmarks: list})
+}
+
+// APIDeleteBookmarkHandler godoc
+// @Summary      Delete bookmark
+// @Description  Removes one of the current user's bookmarks. Requires session auth.
+// @Tags         Bookmarks
+// @Security     sessionAuth
+// @Param        id  path  int  true  "Bookmark ID"
+// @Success      204
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/bookmarks/{id} [delete]
+func APIDeleteBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "bookmark not found"})
+		return
+	}
+
+	// Scoped by user_id: other users' bookmarks look like missing ones.
+	res, err := db.ExecContext(r.Context(), `DELETE FROM bookmarks WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		reportError(r, "delete bookmark error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete bookmark"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "bookmark not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIUpdateBookmarkHandler godoc
+// @Summary      Update bookmark
+// @Description  Shows or hides one of the current user's bookmarks on their public profile page (/u/{username}). Requires session auth.
+// @Tags         Bookmarks
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id    path  int             true  "Bookmark ID"
+// @Param        body  body  BookmarkUpdate  true  "Visibility"
+// @Success      200  {object}  Bookmark
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/bookmarks/{id} [patch]
+func APIUpdateBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "bookmark not found"})
+		return
+	}
+	var upd BookmarkUpdate
+	if !decodeJSONBody(w, r, 4096, &upd) {
+		return
+	}
+
+	list, err := scanBookmarks(db.QueryContext(r.Context(),
+		`UPDATE bookmarks SET is_public = $1 WHERE id = $2 AND user_id = $3 RETURNING id, title, url, is_public, created_at`,
+		upd.Public, id, userID,
+	))
+	if err != nil {
+		reportError(r, "update bookmark error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not update bookmark"})
+		return
+	}
+	if len(list) == 0 {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "bookmark not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, list[0])
+}
+
+// BookmarksPageHandler renders the logged-in user's saved results.
+func BookmarksPageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok || db == nil {
+		redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	list, err := queryBookmarks(r.Context(), userID)
+	if err != nil {
+		log.Printf("bookmarks page error: %v", err)
+		list = []Bookmark{}
+	}
+	renderTemplate(w, r, "bookmarks", map[string]any{
+		"Title":     "Bookmarks",
+		"Bookmarks": list,
+	})
+}
+
+// sessionUser resolves the session user for the /api/me/* endpoints, writing the error response itself.
+func sessionUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if db == nil {
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database not configured"})
+		return 0, false
+	}
+	userID, ok := currentUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, APIErrorResponse{Error: "unauthorized"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func findBookmark(ctx context.Context, userID int, target string) (Bookmark, bool, error) {
+	list, err := scanBookmarks(db.QueryContext(ctx,
+		`SELECT id, title, url, is_public, created_at FROM bookmarks WHERE user_id = $1 AND url = $2`,
+		userID, target,
+	))
+	if err != nil || len(list) == 0 {
+		return Bookmark{}, false, err
+	}
+	return list[0], true, nil
+}
+
+func queryBookmarks(ctx context.Context, userID int) ([]Bookmark, error) {
+	return scanBookmarks(db.QueryContext(ctx,
+		`SELECT id, title, url, is_public, created_at FROM bookmarks WHERE user_id = $1 ORDER BY created_at DESC, id DESC`,
+		userID,
+	))
+}
+
+func queryPublicBookmarks(ctx context.Context, userID int) ([]Bookmark, error) {
+	return scanBookmarks(db.QueryContext(ctx,
+		`SELECT id, title, url, is_public, created_at FROM bookmarks WHERE user_id = $1 AND is_public ORDER BY created_at DESC, id DESC`,
+		userID,
+	))
+}
+
+// bookmarkedURLs maps URL -> bookmark ID for the user (drives the star toggle on search results).
+func bookmarkedURLs(ctx context.Context, userID int) map[string]int64 {
+	out := map[string]int64{}
+	list, err := queryBookmarks(ctx, userID)
+	if err != nil {
+		log.Printf("bookmarked urls error: %v", err)
+		return out
+	}
+	for _, b := range list {
+		out[b.URL] = b.ID
+	}
+	return out
+}
+
+func scanBookmarks(rows *sql.Rows, err error) ([]Bookmark, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	out := []Bookmark{}
+	for rows.Next() {
+		var b Bookmark
+		if err := rows.Scan(&b.ID, &b.Title, &b.URL, &b.Public, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+)
+
+const (
+	// Clicks deeper than this are not real result positions (UI max is 100 per page).
+	maxClickRank = 1000
+
+	clickReportDefaultDays = 7
+	clickReportMaxDays     = 90
+	clickReportTopQueries  = 50
+)
+
+// SearchClickRequest is the body accepted by POST /api/search/click.
+type SearchClickRequest struct {
+	Query    string `json:"query" example:"golang"`
+	Language string `json:"language,omitempty" example:"en"`
+	URL      string `json:"url" example:"/golang"`
+	Rank     int    `json:"rank" example:"1"` // 1-based position in the result list
+	// PageID is the clicked page; ids that are not pages of the tenant are stored as null.
+	PageID int `json:"page_id,omitempty" example:"42"`
+}
+
+// APISearchClickHandler godoc
+// @Summary      Record result click
+// @Description  Records which search result (rank, URL, query) was clicked. Works for anonymous users; the user is stored when logged in.
+// @Tags         Search
+// @Accept       json
+// @Param        body  body  SearchClickRequest  true  "Clicked result"
+// @Success      204
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/search/click [post]
+func APISearchClickHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database not configured"})
+		return
+	}
+
+	var req SearchClickRequest
+	if !decodeJSONBody(w, r, 4096, &req) {
+		return
+	}
+
+	// Normalize the query so the report aggregates "Go" and " go " together.
+	query := strings.ToLower(strings.TrimSpace(req.Query))
+	target := strings.TrimSpace(req.URL)
+	lang := req.Language
+	if lang == "" {
+		lang = "en"
+	}
+	switch {
+	case query == "" || target == "":
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "query and url are required"})
+		return
+	case req.Rank < 1 || req.Rank > maxClickRank:
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "rank must be between 1 and 1000"})
+		return
+	case lang != "en" && lang != "da":
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "language must be one of: en, da"})
+		return
+	}
+
+	var userID, pageID sql.NullInt64
+	if id, ok := currentUserID(r); ok {
+		userID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	// Tag the click with the visitor's experiment variants (see experiments.go).
+	variants := clickAssignment(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	// page_id comes from the client: an id that is not a page of this tenant is dropped.
+	if req.PageID > 0 {
+		err := db.QueryRowContext(ctx,
+			`SELECT id FROM pages WHERE id = $1 AND tenant_id = $2`, req.PageID, tenantID(ctx),
+		).Scan(&pageID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			reportError(r, "click page lookup error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not record click"})
+			return
+		}
+	}
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO search_clicks (query, language, url, rank, page_id, user_id, variants) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		query, lang, target, req.Rank, pageID, userID, variants.String(),
+	)
+	if err != nil {
+		reportError(r, "record click error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not record click"})
+		return
+	}
+
+	metrics.SearchClicks.Inc()
+	metrics.SearchClickRank.Observe(float64(req.Rank))
+	countExperiments(metrics.ExperimentClicks, variants)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ClickReportQuery is one row of the admin click report.
+type ClickReportQuery struct {
+	Query       string  `json:"query" example:"golang"`
+	Language    string  `json:"language" example:"en"`
+	Clicks      int     `json:"clicks" example:"12"`
+	AvgRank     float64 `json:"avg_rank" example:"1.5"`
+	TopRankRate float64 `json:"top_rank_rate" example:"0.75"` // share of clicks on the first result
+}
+
+// ClickReport is returned by GET /admin/reports/clicks.
+type ClickReport struct {
+	Since       time.Time          `json:"since"`
+	TotalClicks int                `json:"total_clicks" example:"120"`
+	AvgRank     float64            `json:"avg_rank" example:"2.1"`
+	Queries     []ClickReportQuery `json:"queries"`
+}
+
+// AdminClickReportHandler godoc
+// @Summary      Click-through report
+// @Description  Aggregated result clicks per query for the last N days (default 7, max 90), most clicked first. Queries with a high average rank are candidates for relevance tuning. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        days  query  int  false  "Report window in days"
+// @Success      200  {object}  ClickReport
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/reports/clicks [get]
+func AdminClickReportHandler(w http.ResponseWriter, r *http.Request) {
+	days := clickReportDefaultDays
+	if n, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && n > 0 {
+		days = min(n, clickReportMaxDays)
+	}
+	since := time.Now().UTC().AddDate(0, 0, -days)
+
+	report, err := queryClickReport(r.Context(), since)
+	if err != nil {
+		reportError(r, "click report error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not build report"})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// queryClickReport aggregates search_clicks newer than since.
+func queryClickReport(ctx context.Context, since time.Time) (ClickReport, error) {
+	report := ClickReport{Since: since, Queries: []ClickReportQuery{}}
+
+	// Reporting is read-only, so it can run on the replica.
+	pool, _ := readDB()
+	err := pool.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(AVG(rank), 0) FROM search_clicks WHERE clicked_at >= $1`,
+		since,
+	).Scan(&report.TotalClicks, &report.AvgRank)
+	if err != nil {
+		return report, err
+	}
+
+	rows, err := queryRead(ctx, `
+SELECT query, language, COUNT(*) AS clicks, AVG(rank),
+       SUM(CASE WHEN rank = 1 THEN 1 ELSE 0 END) * 1.0 / COUNT(*)
+FROM search_clicks
+WHERE clicked_at >= $1
+GROUP BY query, language
+ORDER BY clicks DESC, query
+LIMIT $2`, since, clickReportTopQueries)
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	for rows.Next() {
+		var q ClickReportQuery
+		if err := rows.Scan(&q.Query, &q.Language, &q.Clicks, &q.AvgRank, &q.TopRankRate); err != nil {
+			return report, err
+		}
+		report.Queries = append(report.Queries, q)
+	}
+	return report, rows.Err()
+}
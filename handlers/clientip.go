@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+
+	"devops-valgfag/internal/clientip"
+
+	"github.com/gorilla/mux"
+)
+
+// trustedProxies are the peers whose forwarding headers are believed (TRUSTED_PROXIES, see
+// SetTrustedProxies). Replaced on config reload.
+var trustedProxies atomic.Pointer[[]netip.Prefix]
+
+type clientIPKey struct{}
+
+// SetTrustedProxies configures the reverse proxies (CIDRs) allowed to report the client
+// address in X-Forwarded-For / X-Real-IP. Nil trusts none: the peer address is the client.
+func SetTrustedProxies(prefixes []netip.Prefix) {
+	trustedProxies.Store(&prefixes)
+}
+
+func currentTrustedProxies() []netip.Prefix {
+	if p := trustedProxies.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// ClientIPMiddleware resolves the client address once per request (see clientip.Resolve)
+// for the rate limiter, audit log and logs; read it with ClientIP.
+func ClientIPMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientip.Resolve(r.RemoteAddr, r.Header, currentTrustedProxies())
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+		})
+	}
+}
+
+// ClientIP returns the client address resolved by ClientIPMiddleware ("" outside one).
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// clientIP is ClientIP for r, resolving it directly for handlers served without the middleware.
+func clientIP(r *http.Request) string {
+	if ip := ClientIP(r.Context()); ip != "" {
+		return ip
+	}
+	return clientip.Resolve(r.RemoteAddr, r.Header, currentTrustedProxies())
+}
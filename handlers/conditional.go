@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+)
+
+// Conditional GETs: resources with validators send ETag and Last-Modified, and a client that
+// already has the current copy (If-None-Match, or If-Modified-Since without it, as RFC 9110
+// says) gets 304 Not Modified without the body. Results are counted in
+// app_http_conditional_requests_total{route,result}.
+
+// Results of a conditional GET.
+const (
+	conditionalNotModified   = "not_modified"
+	conditionalModified      = "modified"
+	conditionalUnconditional = "unconditional"
+)
+
+// checkNotModified sets etag and modified (if not zero) on w and answers 304 when r shows the
+// client's copy is current. It reports whether it did; the caller then writes nothing else.
+func checkNotModified(w http.ResponseWriter, r *http.Request, route, etag string, modified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	result := conditionalUnconditional
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		result = conditionalModified
+		if etagListMatches(inm, etag) {
+			result = conditionalNotModified
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		// Last-Modified has whole seconds, so the comparison does too.
+		if t, err := http.ParseTime(ims); err == nil {
+			result = conditionalModified
+			if !modified.Truncate(time.Second).After(t) {
+				result = conditionalNotModified
+			}
+		}
+	}
+	metrics.ConditionalRequests.WithLabelValues(route, result).Inc()
+	if result != conditionalNotModified {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagListMatches reports whether an If-None-Match value ("*" or a list of entity tags)
+// matches etag. The comparison is weak: W/"3" matches "3".
+func etagListMatches(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/apperror"
+
+	"github.com/gorilla/mux"
+)
+
+// Terms of service and privacy policy consent: with TERMS_VERSION set, signing up requires
+// accepting them (the accept_terms checkbox), which records the version in users.terms_version
+// and in the user_consents history (part of the account export). When the version changes,
+// ConsentMiddleware sends logged-in users' page views to the /consent interstitial until they
+// accept the new one. The APIs keep working, so clients are not locked out mid-session.
+
+// Where an acceptance was given (user_consents.source).
+const (
+	consentSourceRegistration = "registration"
+	consentSourceInterstitial = "consent"
+)
+
+// TermsConfig is the consent configuration (TERMS_VERSION, TERMS_URL, PRIVACY_URL).
+type TermsConfig struct {
+	// Version of the terms and privacy policy users must have accepted; "" turns consent off.
+	Version string
+	// TermsURL and PrivacyURL are linked from the sign-up form and the interstitial.
+	TermsURL   string
+	PrivacyURL string
+}
+
+var terms TermsConfig
+
+// SetTerms sets the terms users must accept.
+func SetTerms(c TermsConfig) {
+	terms = c
+}
+
+// errTermsNotAccepted is returned for a sign-up without the accept_terms checkbox.
+var errTermsNotAccepted = apperror.New(apperror.Invalid, "You must accept the terms of service and privacy policy")
+
+// Consent is one acceptance of the terms, as listed in the account export.
+type Consent struct {
+	Version    string    `json:"version" example:"2026-10-01"`
+	Source     string    `json:"source" example:"registration"` // registration | consent
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+// ConsentRequest is the body of POST /api/me/consent (a form post works too).
+type ConsentRequest struct {
+	Version string `json:"version" example:"2026-10-01"` // the version shown to the user
+}
+
+// termsPageData adds the consent links of the sign-up form and interstitial.
+func termsPageData(data map[string]any) map[string]any {
+	data["TermsVersion"] = terms.Version
+	data["TermsURL"] = terms.TermsURL
+	data["PrivacyURL"] = terms.PrivacyURL
+	return data
+}
+
+// registrationTerms is the version a sign-up form accepted: "" when consent is off, an
+// error when it is on and the box was not ticked.
+func registrationTerms(r *http.Request) (string, error) {
+	return acceptTerms(r.FormValue("accept_terms") != "")
+}
+
+// acceptTerms is registrationTerms for an explicit acceptance (the GraphQL register mutation).
+func acceptTerms(accepted bool) (string, error) {
+	if terms.Version == "" {
+		return "", nil
+	}
+	if !accepted {
+		return "", errTermsNotAccepted
+	}
+	return terms.Version, nil
+}
+
+// acceptedTerms is the version the user accepted last ("" for none).
+func acceptedTerms(ctx context.Context, userID int) (string, error) {
+	var v sql.NullString
+	err := db.QueryRowContext(ctx, `SELECT terms_version FROM users WHERE id = $1`, userID).Scan(&v)
+	return v.String, err
+}
+
+// recordConsent stores an acceptance of version by the user.
+func recordConsent(ctx context.Context, userID int, version, source string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET terms_version = $1 WHERE id = $2`, version, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO user_consents (user_id, version, source, accepted_at) VALUES ($1, $2, $3, $4)`,
+		userID, version, source, time.Now().UTC(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryConsents returns the user's acceptances, oldest first.
+func queryConsents(ctx context.Context, userID int) ([]Consent, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT version, source, accepted_at FROM user_consents WHERE user_id = $1 ORDER BY accepted_at, id`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+	list := []Consent{}
+	for rows.Next() {
+		var c Consent
+		if err := rows.Scan(&c.Version, &c.Source, &c.AcceptedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// consentExempt are the paths that stay reachable before the current terms are accepted.
+var consentExempt = []string{"/consent", "/static/", "/files/", "/language/", "/metrics", "/debug/", "/events", "/healthz", "/readyz"}
+
+// ConsentMiddleware redirects logged-in users who have not accepted the current TERMS_VERSION
+// to the /consent interstitial when they open a page (GET, not an API request). Lookup errors
+// fail open. It must run after SessionGuardMiddleware.
+func ConsentMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if terms.Version == "" || db == nil || r.Method != http.MethodGet || apiRequest(r) || consentExemptPath(r.URL.Path) || databaseDown() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			userID, ok := currentUserID(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			accepted, err := acceptedTerms(r.Context(), userID)
+			if err != nil {
+				log.Printf("consent lookup error: %v", err)
+			}
+			if err != nil || accepted == terms.Version {
+				next.ServeHTTP(w, r)
+				return
+			}
+			redirect(w, r, "/consent?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		})
+	}
+}
+
+func consentExemptPath(path string) bool {
+	for _, p := range consentExempt {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// localRedirect is next if it is a path on this site, otherwise "/".
+func localRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// ConsentPageHandler renders the interstitial asking to accept the current terms. Users who
+// already did (or when consent is off) continue to next.
+func ConsentPageHandler(w http.ResponseWriter, r *http.Request) {
+	next := localRedirect(r.URL.Query().Get("next"))
+	userID, ok := currentUserID(r)
+	if !ok || db == nil {
+		redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	if terms.Version == "" {
+		redirect(w, r, next, http.StatusFound)
+		return
+	}
+	accepted, err := acceptedTerms(r.Context(), userID)
+	if err != nil {
+		reportError(r, "consent lookup error", err)
+	}
+	if accepted == terms.Version {
+		redirect(w, r, next, http.StatusFound)
+		return
+	}
+	renderTemplate(w, r, "consent", termsPageData(map[string]any{
+		"Title":    "Terms of service",
+		"Next":     next,
+		"Accepted": accepted,
+	}))
+}
+
+// APIAcceptTermsHandler godoc
+// @Summary      Accept the terms of service
+// @Description  Records that the logged-in user accepts the current terms of service and privacy policy (TERMS_VERSION). The version shown to the user must be sent back; a form post (version, next) redirects to next, as the /consent page does. Requires session auth.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  ConsentRequest  true  "Accepted version"
+// @Success      200  {object}  Consent
+// @Success      303  {string}  string  "Form post: redirect to next"
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse  "No terms configured"
+// @Failure      409  {object}  APIErrorResponse  "The terms changed since they were shown"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/consent [post]
+func APIAcceptTermsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	form := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	var req ConsentRequest
+	if form {
+		req.Version = r.FormValue("version")
+	} else if !decodeJSONBody(w, r, 4096, &req) {
+		return
+	}
+	switch {
+	case terms.Version == "":
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "no terms to accept"})
+		return
+	case req.Version == "":
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "version is required"})
+		return
+	case req.Version != terms.Version:
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: "the terms have changed; review the current version"})
+		return
+	}
+
+	if err := recordConsent(r.Context(), userID, req.Version, consentSourceInterstitial); err != nil {
+		reportError(r, "record consent error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not record consent"})
+		return
+	}
+	audit(r, "user.terms_accepted", "user", userID, map[string]any{"version": req.Version})
+	if form {
+		redirect(w, r, localRedirect(r.FormValue("next")), http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusOK, Consent{Version: req.Version, Source: consentSourceInterstitial, AcceptedAt: time.Now().UTC()})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+)
+
+// Degraded mode: while the primary database is unreachable the site keeps serving what it can
+// without it (static pages, weather, cached search results) instead of failing every request.
+// dbDown is set by CheckDatabase (check_database task, /readyz) and after failed search queries.
+var dbDown atomic.Bool
+
+// dbCheckTimeout bounds a single database health probe.
+const dbCheckTimeout = 2 * time.Second
+
+// searchStaleTTL is how long cached search results are kept past their TTL to be served
+// while the database is down.
+const searchStaleTTL = time.Hour
+
+// errSearchUnavailableMsg is returned by the search APIs in degraded mode when nothing is cached.
+const errSearchUnavailableMsg = "search temporarily unavailable"
+
+var errDatabaseNotConfigured = errors.New("database not configured")
+
+// CheckDatabase pings the primary database and enters or leaves degraded mode accordingly.
+func CheckDatabase(ctx context.Context) error {
+	if db == nil {
+		return errDatabaseNotConfigured
+	}
+	ctx, cancel := context.WithTimeout(ctx, dbCheckTimeout)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	setDatabaseDown(err != nil, err)
+	return err
+}
+
+// databaseDown reports whether the handlers are in degraded mode.
+func databaseDown() bool {
+	return dbDown.Load()
+}
+
+// searchUnavailable reports whether an empty search result means "could not search"
+// rather than "nothing found", so handlers can say so instead of showing no results.
+func searchUnavailable(results []SearchResult) bool {
+	return len(results) == 0 && databaseDown()
+}
+
+// noteQueryError probes the database after a failed query, so degraded mode starts with the
+// first failing request instead of the next scheduled check. Canceled queries say nothing
+// about the database and are ignored.
+func noteQueryError(ctx context.Context, err error) {
+	if err == nil || isQueryCanceled(ctx, err) || databaseDown() {
+		return
+	}
+	_ = CheckDatabase(context.WithoutCancel(ctx))
+}
+
+// writeSearchUnavailableHeaders tells clients when to retry a search refused in degraded mode.
+func writeSearchUnavailableHeaders(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "30")
+}
+
+func setDatabaseDown(down bool, err error) {
+	if dbDown.Swap(down) != down {
+		if down {
+			log.Printf("database unreachable, entering degraded mode: %v", err)
+		} else {
+			log.Println("database reachable again, leaving degraded mode")
+		}
+	}
+	v := 0.0
+	if down {
+		v = 1
+	}
+	metrics.DegradedMode.Set(v)
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import "devops-valgfag/internal/dialect"
+
+// sqlDialect is the database passed to Init. Queries that cannot be written portably
+// (full-text search, statement timeouts) branch on it.
+var sqlDialect = dialect.Postgres
+
+// SetDialect sets the SQL dialect of the database (DB_DRIVER, default PostgreSQL).
+func SetDialect(d dialect.Dialect) {
+	sqlDialect = d
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"devops-valgfag/internal/apperror"
+)
+
+// Handlers answer failures through the functions below instead of picking a status and message
+// themselves: the apperror.Kind decides the status, the Message is what the user sees (JSON
+// "error" or the page's Error, translated by the template), and the cause of an internal or
+// unavailable error goes to the log and the error tracker.
+
+// writeAPIError answers err as an APIErrorResponse.
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	e := apperror.From(err)
+	logAppError(r, e)
+	writeJSON(w, e.Kind.HTTPStatus(), APIErrorResponse{Error: e.Message})
+}
+
+// renderPageError re-renders page with data and err's message as Error.
+func renderPageError(w http.ResponseWriter, r *http.Request, page string, data map[string]any, err error) {
+	e := apperror.From(err)
+	logAppError(r, e)
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["Error"] = e.Message
+	renderTemplateStatus(w, r, e.Kind.HTTPStatus(), page, data)
+}
+
+// respondError is writeAPIError for API clients and renderPageError otherwise.
+func respondError(w http.ResponseWriter, r *http.Request, page string, data map[string]any, err error) {
+	if apiRequest(r) {
+		writeAPIError(w, r, err)
+		return
+	}
+	renderPageError(w, r, page, data, err)
+}
+
+func logAppError(r *http.Request, e *apperror.Error) {
+	if e.Cause == nil {
+		return
+	}
+	switch e.Kind {
+	case apperror.Internal:
+		reportError(r, e.Message, e.Cause)
+	case apperror.Unavailable:
+		log.Printf("%s: %v", e.Message, e.Cause)
+	}
+}
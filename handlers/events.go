@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/events"
+)
+
+// SSE event types sent on /events.
+const (
+	EventAnnouncement   = "announcement"    // deployment notices / admin messages
+	EventExternalSearch = "external_search" // Wikipedia enrichment degraded / recovered
+	EventWeather        = "weather"         // DMI weather provider outage / recovered
+)
+
+const (
+	// How many past events reconnecting clients can replay via Last-Event-ID.
+	eventHistorySize = 50
+
+	// Comment lines keep idle connections alive through proxies.
+	sseHeartbeat = 25 * time.Second
+
+	// Reconnect delay suggested to EventSource clients.
+	sseRetry = 5 * time.Second
+)
+
+// eventHub is the process-wide broadcast hub behind /events.
+var eventHub = events.NewHub(eventHistorySize)
+
+// Announce pushes an event to every connected /events client.
+func Announce(eventType, message string) {
+	eventHub.Publish(eventType, message)
+}
+
+// serviceHealth tracks degraded dependencies so status events are only sent on transitions
+// (not once per failing request).
+var serviceHealth = struct {
+	mu       sync.Mutex
+	degraded map[string]bool
+}{degraded: map[string]bool{}}
+
+// reportServiceStatus records the outcome of a dependency call and announces
+// "degraded" / "recovered" when the state changes.
+func reportServiceStatus(eventType, service string, ok bool) {
+	serviceHealth.mu.Lock()
+	wasDegraded := serviceHealth.degraded[eventType]
+	serviceHealth.degraded[eventType] = !ok
+	serviceHealth.mu.Unlock()
+
+	switch {
+	case !ok && !wasDegraded:
+		Announce(eventType, service+" is currently unavailable")
+	case ok && wasDegraded:
+		Announce(eventType, service+" has recovered")
+	}
+}
+
+// EventsHandler streams system status and announcements as Server-Sent Events.
+//
+// Reconnection: every event carries an id; browsers resend it as Last-Event-ID
+// and any buffered events newer than that are replayed first.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	// SSE streams outlive the server-wide WriteTimeout, so lift it for this response.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Println("events: cannot clear write deadline:", err)
+	}
+
+	lastID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	ch, missed := eventHub.Subscribe(lastID)
+	defer eventHub.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds()); err != nil {
+		return
+	}
+	for _, ev := range missed {
+		if writeSSE(w, ev) != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Println("events: flush not supported:", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-ch:
+			if writeSSE(w, ev) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// writeSSE writes one event in text/event-stream framing (data is JSON-encoded).
+func writeSSE(w http.ResponseWriter, ev events.Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, payload)
+	return err
+}
+
+// AnnouncementRequest is the body accepted by POST /admin/announcements.
+type AnnouncementRequest struct {
+	Message string `json:"message" example:"Scheduled maintenance at 22:00"`
+}
+
+// AdminAnnouncementHandler godoc
+// @Summary      Broadcast announcement
+// @Description  Pushes an announcement to every client connected to /events. Admin only.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  AnnouncementRequest  true  "Announcement"
+// @Success      202  {object}  events.Event
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Router       /admin/announcements [post]
+func AdminAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	var req AnnouncementRequest
+	if !decodeJSONBody(w, r, 4096, &req) {
+		return
+	}
+	msg := strings.TrimSpace(req.Message)
+	if msg == "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "message is required"})
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, eventHub.Publish(EventAnnouncement, msg))
+}
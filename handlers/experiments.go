@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/experiments"
+	"devops-valgfag/internal/searchmerge"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Search A/B experiments. Visitors are bucketed by a random ID in the exp_id cookie, so the
+// same browser stays in its variants across requests and replicas. Experiments are configured
+// at startup (EXPERIMENTS, see main.go); only the search page, /api/search and result clicks
+// take part. Other entry points (GraphQL, gRPC, batch) always get the default behaviour.
+
+const (
+	// ExperimentSearchMerge overrides the merge strategy (variants: append, interleave, score).
+	ExperimentSearchMerge = "search_merge"
+	// ExperimentSearchRanking picks the FTS ranking (variants: v1 = ts_rank, v2 = ts_rank_cd).
+	ExperimentSearchRanking = "search_ranking"
+
+	rankingV1 = "v1"
+	rankingV2 = "v2"
+
+	experimentCookieName   = "exp_id"
+	experimentCookieMaxAge = 365 * 24 * time.Hour
+
+	experimentReportDefaultDays = 7
+	experimentReportMaxDays     = 90
+)
+
+// knownExperiments lists the experiments the search code branches on, with their variants.
+var knownExperiments = map[string][]string{
+	ExperimentSearchMerge:   {string(searchmerge.Append), string(searchmerge.Interleave), string(searchmerge.Score)},
+	ExperimentSearchRanking: {rankingV1, rankingV2},
+}
+
+// activeExperiments is set by SetExperiments, at startup and on config reload.
+var activeExperiments atomic.Pointer[[]experiments.Experiment]
+
+func currentExperiments() []experiments.Experiment {
+	if p := activeExperiments.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// SetExperiments enables the given experiments. Only experiments and variants the search
+// code implements are accepted.
+func SetExperiments(exps []experiments.Experiment) error {
+	if err := checkExperiments(exps); err != nil {
+		return err
+	}
+	activeExperiments.Store(&exps)
+	return nil
+}
+
+func checkExperiments(exps []experiments.Experiment) error {
+	for _, e := range exps {
+		variants, ok := knownExperiments[e.Name]
+		if !ok {
+			return fmt.Errorf("experiments: unknown experiment %q", e.Name)
+		}
+		if err := experiments.CheckVariants(e, variants...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExperimentVariantReport is one variant with its clicks in the report window.
+type ExperimentVariantReport struct {
+	Name    string  `json:"name" example:"interleave"`
+	Weight  int     `json:"weight" example:"50"`
+	Clicks  int     `json:"clicks" example:"120"`
+	AvgRank float64 `json:"avg_rank" example:"2.3"`
+}
+
+// ExperimentReport is an active experiment with per-variant click statistics.
+type ExperimentReport struct {
+	Name     string                    `json:"name" example:"search_merge"`
+	Variants []ExperimentVariantReport `json:"variants"`
+}
+
+// AdminExperimentsResponse is returned by GET /admin/experiments.
+type AdminExperimentsResponse struct {
+	Since       time.Time          `json:"since"`
+	Experiments []ExperimentReport `json:"experiments"`
+	// Available lists every experiment the code supports with its variants.
+	Available map[string][]string `json:"available"`
+}
+
+// experimentUnit returns the visitor ID from the exp_id cookie.
+func experimentUnit(r *http.Request) (string, bool) {
+	c, err := r.Cookie(experimentCookieName)
+	if err != nil || len(c.Value) != 32 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(c.Value); err != nil {
+		return "", false
+	}
+	return c.Value, true
+}
+
+// withExperiments assigns the visitor to the active experiments, issuing an exp_id cookie
+// on the first visit, and returns the request with the assignment in its context.
+func withExperiments(w http.ResponseWriter, r *http.Request) *http.Request {
+	active := currentExperiments()
+	if len(active) == 0 {
+		return r
+	}
+	unit, ok := experimentUnit(r)
+	if !ok {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			log.Println("experiment id error:", err)
+			return r
+		}
+		unit = hex.EncodeToString(b)
+		http.SetCookie(w, &http.Cookie{
+			Name:     experimentCookieName,
+			Value:    unit,
+			Path:     "/",
+			MaxAge:   int(experimentCookieMaxAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return r.WithContext(experiments.WithAssignment(r.Context(), experiments.AssignAll(active, unit)))
+}
+
+// clickAssignment returns the variants of the visitor reporting a click. Unlike
+// withExperiments it never issues a cookie: a click without one had no variants.
+func clickAssignment(r *http.Request) experiments.Assignment {
+	unit, ok := experimentUnit(r)
+	active := currentExperiments()
+	if !ok || len(active) == 0 {
+		return nil
+	}
+	return experiments.AssignAll(active, unit)
+}
+
+// countExperiments increments counter once per experiment the request is in.
+func countExperiments(counter *prometheus.CounterVec, a experiments.Assignment) {
+	for name, variant := range a {
+		counter.WithLabelValues(name, variant).Inc()
+	}
+}
+
+// experimentMergePolicy returns mergePolicy with the strategy of the search_merge variant.
+func experimentMergePolicy(ctx context.Context) searchmerge.Policy {
+	var p searchmerge.Policy
+	if cur := mergePolicy.Load(); cur != nil {
+		p = *cur
+	}
+	if v := experiments.VariantOf(ctx, ExperimentSearchMerge); v != "" {
+		p.Strategy = searchmerge.Strategy(v)
+	}
+	return p
+}
+
+// AdminExperimentsHandler godoc
+// @Summary      A/B experiments
+// @Description  Returns the active search experiments with their variant weights and, per variant, the result clicks and average clicked rank of the last N days (default 7, max 90). Searches per variant are in the app_experiment_searches_total metric. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        days  query  int  false  "Report window in days"
+// @Success      200  {object}  AdminExperimentsResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/experiments [get]
+func AdminExperimentsHandler(w http.ResponseWriter, r *http.Request) {
+	days := experimentReportDefaultDays
+	if n, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && n > 0 {
+		days = min(n, experimentReportMaxDays)
+	}
+	since := time.Now().UTC().AddDate(0, 0, -days)
+
+	stats, err := queryVariantClicks(r.Context(), since)
+	if err != nil {
+		reportError(r, "experiment report error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not build report"})
+		return
+	}
+
+	resp := AdminExperimentsResponse{Since: since, Experiments: []ExperimentReport{}, Available: knownExperiments}
+	for _, e := range currentExperiments() {
+		rep := ExperimentReport{Name: e.Name}
+		for _, v := range e.Variants {
+			st := stats[e.Name+"="+v.Name]
+			vr := ExperimentVariantReport{Name: v.Name, Weight: v.Weight, Clicks: st.clicks}
+			if st.clicks > 0 {
+				vr.AvgRank = float64(st.rankSum) / float64(st.clicks)
+			}
+			rep.Variants = append(rep.Variants, vr)
+		}
+		resp.Experiments = append(resp.Experiments, rep)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type variantClicks struct {
+	clicks  int
+	rankSum int
+}
+
+// queryVariantClicks sums clicks and ranks per "experiment=variant" since the given time.
+func queryVariantClicks(ctx context.Context, since time.Time) (map[string]variantClicks, error) {
+	rows, err := queryRead(ctx, `
+SELECT variants, COUNT(*), SUM(rank)
+FROM search_clicks
+WHERE clicked_at >= $1 AND variants <> ''
+GROUP BY variants`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	out := map[string]variantClicks{}
+	for rows.Next() {
+		var (
+			variants       string
+			clicks, ranked int
+		)
+		if err := rows.Scan(&variants, &clicks, &ranked); err != nil {
+			return nil, err
+		}
+		for _, pair := range strings.Split(variants, ",") {
+			st := out[pair]
+			st.clicks += clicks
+			st.rankSum += ranked
+			out[pair] = st
+		}
+	}
+	return out, rows.Err()
+}
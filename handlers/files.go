@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"devops-valgfag/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// signedURLVerifier is implemented by storage backends whose signed URLs point back at this
+// application (the filesystem backend); S3 serves its presigned URLs itself.
+type signedURLVerifier interface {
+	VerifySignedURL(key string, query url.Values) error
+}
+
+// SignedFileHandler serves /files/{key} for signed URLs issued by the filesystem backend.
+// The link itself is the credential, so no session is needed.
+func SignedFileHandler(w http.ResponseWriter, r *http.Request) {
+	verifier, ok := objectStore.(signedURLVerifier)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	key := mux.Vars(r)["key"]
+	if err := verifier.VerifySignedURL(key, r.URL.Query()); err != nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	obj, err := objectStore.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		reportError(r, "stored file read error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = obj.Body.Close() }()
+
+	// Cache no longer than the link is valid.
+	maxAge := int64(0)
+	if exp, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64); err == nil {
+		maxAge = max(0, exp-time.Now().Unix())
+	}
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(maxAge, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.Copy(w, obj.Body)
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"devops-valgfag/internal/apperror"
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/service"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// gqlSchemaSDL is the public GraphQL contract served on /graphql.
+// It exposes the same operations as the REST API and follows the same auth rules:
+// search requires a session, weather is public, me is null when logged out. Every login and
+// register mutation is charged to the auth rate limit like /api/login and /api/register, and
+// register runs the same bot checks and terms acceptance as the register form.
+const gqlSchemaSDL = `
+schema {
+  query: Query
+  mutation: Mutation
+}
+
+type Query {
+  search(q: String!, language: String! = "en", limit: Int! = 10): [SearchResult!]!
+  me: User
+  weather(lat: Float! = 55.715, lon: Float! = 12.561): Weather!
+}
+
+type Mutation {
+  login(username: String!, password: String!): AuthPayload!
+  register(username: String!, email: String!, password: String!, password2: String!, acceptTerms: Boolean! = false, formToken: String, captcha: String): AuthPayload!
+}
+
+type SearchResult {
+  id: Int!
+  title: String!
+  url: String!
+  language: String!
+  description: String!
+}
+
+type User {
+  id: Int!
+  username: String!
+  email: String!
+}
+
+type Weather {
+  latitude: Float!
+  longitude: Float!
+  temperature: Float!
+  windSpeed: Float!
+  windDirection: Float!
+  step: String!
+}
+
+type AuthPayload {
+  ok: Boolean!
+  message: String!
+  user: User
+}
+`
+
+const (
+	// Bounds for incoming GraphQL requests (cheap protection against abusive queries).
+	gqlMaxBodyBytes = 64 << 10
+	gqlMaxDepth     = 8
+)
+
+var (
+	errGQLUnauthorized = errors.New("unauthorized")
+	errGQLNoHTTP       = errors.New("internal error")
+
+	errGQLSearchUnavailable = errors.New(errSearchUnavailableMsg)
+)
+
+// gqlTooManyRequests is the auth payload message of a mutation over the auth rate limit.
+const gqlTooManyRequests = "Too many requests, please try again later"
+
+var gqlSchema = graphql.MustParseSchema(
+	gqlSchemaSDL,
+	&gqlResolver{},
+	graphql.UseFieldResolvers(),
+	graphql.MaxDepth(gqlMaxDepth),
+)
+
+// gqlHTTPKey carries the request/response into resolvers, so they can read
+// and write the session cookie exactly like the REST handlers do.
+type gqlHTTPKey struct{}
+
+type gqlHTTP struct {
+	w http.ResponseWriter
+	r *http.Request
+}
+
+func gqlHTTPFrom(ctx context.Context) (gqlHTTP, bool) {
+	v, ok := ctx.Value(gqlHTTPKey{}).(gqlHTTP)
+	return v, ok
+}
+
+// GraphQL result types (graphql-go maps Int to int32).
+
+type gqlSearchResult struct {
+	ID          int32
+	Title       string
+	URL         string
+	Language    string
+	Description string
+}
+
+type gqlUser struct {
+	ID       int32
+	Username string
+	Email    string
+}
+
+type gqlWeather struct {
+	Latitude      float64
+	Longitude     float64
+	Temperature   float64
+	WindSpeed     float64
+	WindDirection float64
+	Step          string
+}
+
+type gqlAuthPayload struct {
+	OK      bool
+	Message string
+	User    *gqlUser
+}
+
+// gqlResolver is the root resolver for Query and Mutation.
+type gqlResolver struct{}
+
+// Search mirrors /api/search: session required, local results only, capped limit.
+func (gqlResolver) Search(ctx context.Context, args struct {
+	Q        string
+	Language string
+	Limit    int32
+}) ([]gqlSearchResult, error) {
+	hc, ok := gqlHTTPFrom(ctx)
+	if !ok {
+		return nil, errGQLNoHTTP
+	}
+	if !isAuthenticated(hc.r) {
+		return nil, errGQLUnauthorized
+	}
+
+	limit := int(args.Limit)
+	if limit <= 0 || limit > pageLimit {
+		limit = apiLimit
+	}
+
+	results := runSearch(ctx, args.Q, args.Language, limit, false)
+	if strings.TrimSpace(args.Q) != "" && searchUnavailable(results) {
+		return nil, errGQLSearchUnavailable
+	}
+	if len(results) > 0 {
+		metrics.SearchWithResult.Inc()
+	}
+
+	out := make([]gqlSearchResult, 0, len(results))
+	for _, res := range results {
+		out = append(out, gqlSearchResult{
+			ID:          int32(res.ID),
+			Title:       res.Title,
+			URL:         res.URL,
+			Language:    res.Language,
+			Description: res.Description,
+		})
+	}
+	return out, nil
+}
+
+// Me returns the logged-in user, or null when there is no session.
+func (gqlResolver) Me(ctx context.Context) (*gqlUser, error) {
+	hc, ok := gqlHTTPFrom(ctx)
+	if !ok {
+		return nil, errGQLNoHTTP
+	}
+	userID, ok := currentUserID(hc.r)
+	if !ok {
+		return nil, nil
+	}
+
+	var u gqlUser
+	err := db.QueryRowContext(ctx,
+		`SELECT id, username, email FROM users WHERE id = $1 AND deleted_at IS NULL`,
+		userID,
+	).Scan(&u.ID, &u.Username, &u.Email)
+	if err != nil {
+		log.Printf("graphql me lookup error: %v", err)
+		return nil, nil
+	}
+	return &u, nil
+}
+
+// Weather mirrors /api/weather for an arbitrary position.
+func (gqlResolver) Weather(ctx context.Context, args struct {
+	Lat float64
+	Lon float64
+}) (*gqlWeather, error) {
+	data, err := weatherService.At(ctx, args.Lat, args.Lon)
+	if err != nil {
+		log.Println("graphql weather fetch error:", err)
+		return nil, service.ErrWeatherUnavailable
+	}
+	first, err := service.Current(data)
+	if err != nil {
+		return nil, err
+	}
+	return &gqlWeather{
+		Latitude:      first.Geometry.Coordinates[1],
+		Longitude:     first.Geometry.Coordinates[0],
+		Temperature:   first.Properties.Temperature,
+		WindSpeed:     first.Properties.WindSpeed,
+		WindDirection: first.Properties.WindDir,
+		Step:          first.Properties.Step,
+	}, nil
+}
+
+// Login mirrors POST /api/login and sets the same session cookie. Each login in a document
+// counts against the auth rate limit, so aliased logins cannot try several passwords at once.
+func (gqlResolver) Login(ctx context.Context, args struct {
+	Username string
+	Password string
+}) (gqlAuthPayload, error) {
+	hc, ok := gqlHTTPFrom(ctx)
+	if !ok {
+		return gqlAuthPayload{}, errGQLNoHTTP
+	}
+	if !allowRequest(hc.r, "auth") {
+		return gqlAuthPayload{OK: false, Message: gqlTooManyRequests}, nil
+	}
+
+	u, err := authenticateUser(ctx, args.Username, args.Password)
+	if err != nil {
+		return gqlAuthPayload{OK: false, Message: gqlErrorMessage(ctx, err)}, nil
+	}
+	if err := startSession(hc.w, hc.r, u); err != nil {
+		log.Printf("startSession error (graphql login): %v", err)
+		return gqlAuthPayload{OK: false, Message: "Internal server error"}, nil
+	}
+	noteLoginDevice(hc.r, u)
+
+	return gqlAuthPayload{
+		OK:      true,
+		Message: "Login successful",
+		User:    &gqlUser{ID: int32(u.ID), Username: u.Username, Email: u.Email},
+	}, nil
+}
+
+// Register mirrors POST /api/register (same validation, bot checks and messages). formToken is
+// the form_token of a rendered register form (required with REGISTER_MIN_SUBMIT_TIME), captcha
+// the CAPTCHA widget response, and acceptTerms must be true with TERMS_VERSION set.
+func (gqlResolver) Register(ctx context.Context, args struct {
+	Username    string
+	Email       string
+	Password    string
+	Password2   string
+	AcceptTerms bool
+	FormToken   *string
+	Captcha     *string
+}) (gqlAuthPayload, error) {
+	hc, ok := gqlHTTPFrom(ctx)
+	if !ok {
+		return gqlAuthPayload{}, errGQLNoHTTP
+	}
+	if !allowRequest(hc.r, "auth") {
+		return gqlAuthPayload{OK: false, Message: gqlTooManyRequests}, nil
+	}
+
+	proof := registrationProof{}
+	if args.FormToken != nil {
+		proof.formToken = *args.FormToken
+	}
+	if args.Captcha != nil {
+		proof.captcha = *args.Captcha
+	}
+	if block := checkRegistrationProof(hc.r, proof); block != nil {
+		metrics.RegistrationBlocked.WithLabelValues(block.reason).Inc()
+		return gqlAuthPayload{OK: false, Message: gqlErrorMessage(ctx, block.err)}, nil
+	}
+
+	termsVersion, err := acceptTerms(args.AcceptTerms)
+	if err == nil {
+		err = authService.Register(ctx, service.Registration{
+			Username: args.Username, Email: args.Email, Password: args.Password, Password2: args.Password2, Status: registrationStatus(),
+			TermsVersion: termsVersion,
+		})
+	}
+	if err != nil {
+		return gqlAuthPayload{OK: false, Message: gqlErrorMessage(ctx, err)}, nil
+	}
+	return gqlAuthPayload{OK: true, Message: "Registration successful"}, nil
+}
+
+// gqlErrorMessage is the user message of err for an auth payload; like writeAPIError it logs
+// the cause of internal errors instead of returning it.
+func gqlErrorMessage(ctx context.Context, err error) string {
+	e := apperror.From(err)
+	if hc, ok := gqlHTTPFrom(ctx); ok {
+		logAppError(hc.r, e)
+	} else if e.Cause != nil {
+		log.Printf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+// graphQLRequest is the standard GraphQL-over-HTTP request body.
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	Extensions    map[string]any `json:"extensions"` // sent by some clients (persisted queries); ignored
+}
+
+// GraphQLHandler godoc
+// @Summary      GraphQL API
+// @Description  GraphQL endpoint exposing search, me and weather queries plus login/register mutations. Uses the same session cookie and auth rules as the REST API.
+// @Tags         GraphQL
+// @Accept       json
+// @Produce      json
+// @Param        body  body  graphQLRequest  true  "GraphQL request"
+// @Success      200  {object}  map[string]any  "GraphQL response (data / errors)"
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Router       /graphql [post]
+func GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	if !decodeJSONBody(w, r, gqlMaxBodyBytes, &req) {
+		return
+	}
+	if req.Query == "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "query is required"})
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), gqlHTTPKey{}, gqlHTTP{w: w, r: r})
+	resp := gqlSchema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/searchpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// How often the standard gRPC health service re-checks the database.
+const grpcHealthInterval = 10 * time.Second
+
+// NewGRPCServer builds the internal gRPC server: SearchService plus the standard
+// grpc.health.v1.Health service, so grpc-health-probe works against the same port.
+// The health status follows the database (like /readyz) and is refreshed in the background.
+func NewGRPCServer() *grpc.Server {
+	srv := grpc.NewServer()
+	searchpb.RegisterSearchServiceServer(srv, &searchService{})
+
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go watchGRPCHealth(hs)
+
+	return srv
+}
+
+// watchGRPCHealth keeps the overall ("") and SearchService health status in sync with the DB.
+func watchGRPCHealth(hs *health.Server) {
+	ticker := time.NewTicker(grpcHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		st := healthpb.HealthCheckResponse_SERVING
+		if checkDatabase(context.Background()) != nil {
+			st = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		hs.SetServingStatus("", st)
+		hs.SetServingStatus(searchpb.SearchService_ServiceDesc.ServiceName, st)
+		<-ticker.C
+	}
+}
+
+// checkDatabase pings the DB with the same timeout as /readyz.
+func checkDatabase(ctx context.Context) error {
+	if db == nil {
+		return status.Error(codes.Unavailable, "database not configured")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// searchService implements searchpb.SearchServiceServer on top of the shared search pipeline.
+type searchService struct {
+	searchpb.UnimplementedSearchServiceServer
+}
+
+// Search mirrors /api/search (local results only, capped limit).
+// No session is required: the gRPC port is meant for internal services only.
+func (searchService) Search(ctx context.Context, req *searchpb.SearchRequest) (*searchpb.SearchResponse, error) {
+	if db == nil {
+		return nil, status.Error(codes.Unavailable, "database not configured")
+	}
+
+	limit := int(req.GetLimit())
+	if limit <= 0 || limit > pageLimit {
+		limit = apiLimit
+	}
+
+	results := runSearch(ctx, req.GetQuery(), grpcLanguage(req.GetLanguage()), limit, false)
+	if strings.TrimSpace(req.GetQuery()) != "" && searchUnavailable(results) {
+		return nil, status.Error(codes.Unavailable, errSearchUnavailableMsg)
+	}
+	if len(results) > 0 {
+		metrics.SearchWithResult.Inc()
+	}
+
+	resp := &searchpb.SearchResponse{Results: make([]*searchpb.SearchResult, 0, len(results))}
+	for _, res := range results {
+		resp.Results = append(resp.Results, &searchpb.SearchResult{
+			Id:          int64(res.ID),
+			Title:       res.Title,
+			Url:         res.URL,
+			Language:    res.Language,
+			Description: res.Description,
+		})
+	}
+	return resp, nil
+}
+
+// Suggest mirrors /api/suggest.
+func (searchService) Suggest(ctx context.Context, req *searchpb.SuggestRequest) (*searchpb.SuggestResponse, error) {
+	prefix := strings.TrimSpace(req.GetPrefix())
+	if prefix == "" || db == nil {
+		return &searchpb.SuggestResponse{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	titles, err := querySuggestions(ctx, prefix, grpcLanguage(req.GetLanguage()), suggestLimit)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "suggest query failed")
+	}
+	return &searchpb.SuggestResponse{Suggestions: titles}, nil
+}
+
+// Health reports service + database status (for callers that do not speak grpc.health.v1).
+func (searchService) Health(ctx context.Context, _ *searchpb.HealthRequest) (*searchpb.HealthResponse, error) {
+	if err := checkDatabase(ctx); err != nil {
+		return &searchpb.HealthResponse{
+			Status:   searchpb.HealthResponse_STATUS_NOT_SERVING,
+			Database: "unavailable",
+		}, nil
+	}
+	return &searchpb.HealthResponse{
+		Status:   searchpb.HealthResponse_STATUS_SERVING,
+		Database: "ok",
+	}, nil
+}
+
+// grpcLanguage defaults an empty language to en; gRPC calls carry no cookies or
+// Accept-Language to negotiate from.
+func grpcLanguage(lang string) string {
+	if lang == "" {
+		return "en"
+	}
+	return lang
+}
@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+
+	"devops-valgfag/internal/clientip"
+	"devops-valgfag/internal/errortrack"
+	"devops-valgfag/internal/metrics"
 
 	"github.com/gorilla/sessions"
 )
@@ -17,30 +24,72 @@ import (
 var (
 	db           *sql.DB
 	tmpl         *template.Template
-	sessionStore *sessions.CookieStore
+	sessionStore sessions.Store
+
+	// publicBaseURL is the externally visible scheme://host (PUBLIC_BASE_URL).
+	// Empty means "derive from the incoming request".
+	publicBaseURL string
 )
 
 // Init injects shared dependencies into the handlers package.
 //
 // It must be called once from main.go during application startup.
 // This avoids global initialization logic and keeps handlers testable.
-func Init(database *sql.DB, templates *template.Template, store *sessions.CookieStore) {
+func Init(database *sql.DB, templates *template.Template, store sessions.Store) {
 	db = database
 	tmpl = templates
 	sessionStore = store
+	// Tenants are cached from the previous database, if any.
+	invalidateTenants()
+}
+
+// SetPublicBaseURL configures the absolute base URL used in generated links
+// (OpenSearch descriptor, sitemap). A trailing slash is ignored.
+func SetPublicBaseURL(u string) {
+	publicBaseURL = strings.TrimSuffix(strings.TrimSpace(u), "/")
+}
+
+// publicURL returns the configured public base URL, or reconstructs scheme://host
+// from the request. X-Forwarded-Proto is honored so links stay https behind a TLS-terminating proxy,
+// but only from a trusted proxy (TRUSTED_PROXIES, see SetTrustedProxies).
+// The base path (BASE_PATH) is appended, so callers add unprefixed paths.
+func publicURL(r *http.Request) string {
+	if publicBaseURL != "" {
+		return publicBaseURL + basePath
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); (proto == "https" || proto == "http") && clientip.Trusted(r.RemoteAddr, currentTrustedProxies()) {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + basePath
 }
 
-// renderTemplate executes an HTML template with common default data.
+// renderTemplate executes an HTML template with common default data and status 200.
 //
 // It ensures that:
 // - Content-Type is set correctly
 // - Title always exists
 // - Authentication state is available to templates
+// - The negotiated language (see getLanguage) is available as .Lang for the `t` func
+// - Display preferences (theme, page size) are available as .Prefs
+// - The OpenSearch descriptor URL is available for the <link rel="search"> tag
 //
 // This function is internal to the handlers package.
 func renderTemplate(w http.ResponseWriter, r *http.Request, name string, data map[string]any) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderTemplateStatus(w, r, http.StatusOK, name, data)
+}
 
+// renderTemplateStatus is renderTemplate with an explicit status code.
+//
+// The page is rendered into a buffer before anything is written, so headers (including
+// cookies set while loading template data) go out before the status line. A template error
+// is counted in app_template_errors_total and answered with the 500 error page instead of a
+// half-written page.
+func renderTemplateStatus(w http.ResponseWriter, r *http.Request, status int, name string, data map[string]any) {
 	if data == nil {
 		data = map[string]any{}
 	}
@@ -48,10 +97,49 @@ func renderTemplate(w http.ResponseWriter, r *http.Request, name string, data ma
 		data["Title"] = ""
 	}
 	data["LoggedIn"] = isAuthenticated(r)
+	data["Lang"] = getLanguage(r)
+	if _, ok := data["Prefs"]; !ok {
+		data["Prefs"] = loadPreferences(r)
+	}
+	data["OpenSearchURL"] = openSearchPath
+
+	var buf bytes.Buffer
+	if err := templates().ExecuteTemplate(&buf, name, data); err != nil {
+		metrics.TemplateErrors.WithLabelValues(name).Inc()
+		reportError(r, "template exec error ("+name+")", err)
+		renderErrorPage(w, r, data)
+		return
+	}
+	writeHTML(w, status, &buf)
+}
+
+// renderErrorPage answers 500 with the "error" template, reusing the common data already
+// loaded for the failed page. If even that fails, it falls back to a plain-text 500.
+func renderErrorPage(w http.ResponseWriter, r *http.Request, common map[string]any) {
+	data := map[string]any{
+		"Title":     "Something went wrong",
+		"RequestID": RequestID(r.Context()),
+	}
+	for _, k := range []string{"LoggedIn", "Lang", "Prefs", "OpenSearchURL"} {
+		data[k] = common[k]
+	}
 
-	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
-		// Cannot safely call http.Error if template wrote some content
-		log.Println("template exec error:", err)
+	var buf bytes.Buffer
+	if err := templates().ExecuteTemplate(&buf, "error", data); err != nil {
+		metrics.TemplateErrors.WithLabelValues("error").Inc()
+		log.Println("template exec error (error page):", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	writeHTML(w, http.StatusInternalServerError, &buf)
+}
+
+// writeHTML writes a rendered page with status.
+func writeHTML(w http.ResponseWriter, status int, buf *bytes.Buffer) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Println("template write error:", err)
 	}
 }
 
@@ -69,6 +157,19 @@ func isAuthenticated(r *http.Request) bool {
 	return ok
 }
 
+// currentUserID returns the logged-in user's ID from the session, if any.
+func currentUserID(r *http.Request) (int, bool) {
+	if sessionStore == nil {
+		return 0, false
+	}
+	sess, err := sessionStore.Get(r, "session")
+	if err != nil {
+		return 0, false
+	}
+	id, ok := sess.Values["user_id"].(int)
+	return id, ok
+}
+
 // writeJSON writes a JSON response with the given HTTP status code.
 //
 // It is used by API handlers to return structured JSON responses.
@@ -78,6 +179,25 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
+// reportError logs a failed request's underlying error and reports it to the error tracker
+// (SENTRY_DSN) together with the request and its ID. msg says what failed.
+func reportError(r *http.Request, msg string, err error) {
+	log.Printf("%s: %v", msg, err)
+	errortrack.Capture(errortrack.Event{
+		Err:       err,
+		Message:   msg,
+		Request:   r,
+		RequestID: RequestID(r.Context()),
+	})
+}
+
+// reportExternalError logs and reports a failed call to an external API (DMI, Wikipedia),
+// tagged with the service so outages are grouped per provider.
+func reportExternalError(service, msg string, err error) {
+	log.Printf("%s: %v", msg, err)
+	errortrack.CaptureError(fmt.Errorf("%s: %w", msg, err), map[string]string{"kind": "external_api", "service": service})
+}
+
 // InitSchema initializes the database schema for tests/CI by executing schema.sql.
 // It creates tables/indexes but does not insert demo data.
 //
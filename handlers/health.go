@@ -4,7 +4,6 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"time"
 )
 
 // Healthz godoc
@@ -48,10 +47,7 @@ func Readyz(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-
-		if err := db.PingContext(ctx); err != nil {
+		if err := CheckDatabase(context.Background()); err != nil {
 			log.Printf("readyz: db ping failed: %v", err)
 			w.WriteHeader(http.StatusServiceUnavailable)
 			return
@@ -66,14 +62,11 @@ func Readyz(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Independent short timeout context so readiness isn't tied to client context,
-	// and so it won't hang indefinitely if DB stalls.
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	if err := db.PingContext(ctx); err != nil {
+	// Independent short timeout context (inside CheckDatabase) so readiness isn't tied to the
+	// client context and won't hang if the DB stalls. A failed ping also enters degraded mode.
+	if err := CheckDatabase(context.Background()); err != nil {
 		log.Printf("readyz: db ping failed: %v", err)
-		http.Error(w, "database not ready", http.StatusServiceUnavailable)
+		http.Error(w, "degraded: database unavailable", http.StatusServiceUnavailable)
 		return
 	}
 
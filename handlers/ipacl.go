@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/clientip"
+
+	"github.com/gorilla/mux"
+)
+
+// opsPathPrefixes are guarded by the ops ACL: the admin API and UI, Prometheus metrics and
+// debug endpoints.
+var opsPathPrefixes = []string{"/admin", "/api/admin", "/metrics", "/debug"}
+
+// opsACLCheckInterval is how often the ACL file is checked for changes.
+const opsACLCheckInterval = 10 * time.Second
+
+// opsACL is the allow/deny list for opsPathPrefixes: the static entries from the environment
+// (ADMIN_IP_ALLOW / ADMIN_IP_DENY) merged with the ACL file (ADMIN_IP_ACL_FILE), which is
+// re-read when it changes or on ReloadOpsACL. A broken file is logged and the previous rules
+// keep applying.
+var opsACL struct {
+	sync.RWMutex
+	base      clientip.ACL
+	file      string
+	fileACL   clientip.ACL
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// SetOpsACL configures the ops route ACL from static rules and an optional rule file
+// (see clientip.ParseACL; "" for none). The file must be readable at startup.
+func SetOpsACL(base clientip.ACL, file string) error {
+	opsACL.Lock()
+	defer opsACL.Unlock()
+
+	opsACL.base = base
+	opsACL.file = file
+	opsACL.fileACL = clientip.ACL{}
+	opsACL.modTime = time.Time{}
+	opsACL.checkedAt = time.Time{}
+	if file == "" {
+		return nil
+	}
+	return reloadOpsACLLocked(true)
+}
+
+// ReloadOpsACL re-reads the ACL file now (main calls it on SIGHUP). On error the previous
+// rules stay in effect.
+func ReloadOpsACL() error {
+	opsACL.Lock()
+	defer opsACL.Unlock()
+	if opsACL.file == "" {
+		return nil
+	}
+	return reloadOpsACLLocked(true)
+}
+
+// currentOpsACL returns the rules in effect, re-reading the file if it changed.
+func currentOpsACL() clientip.ACL {
+	opsACL.RLock()
+	stale := opsACL.file != "" && time.Since(opsACL.checkedAt) > opsACLCheckInterval
+	acl := opsACL.base.Merge(opsACL.fileACL)
+	opsACL.RUnlock()
+	if !stale {
+		return acl
+	}
+
+	opsACL.Lock()
+	defer opsACL.Unlock()
+	if time.Since(opsACL.checkedAt) > opsACLCheckInterval {
+		if err := reloadOpsACLLocked(false); err != nil {
+			log.Println("ops ACL reload error (keeping previous rules):", err)
+		}
+	}
+	return opsACL.base.Merge(opsACL.fileACL)
+}
+
+// reloadOpsACLLocked re-reads the ACL file if it is newer than the loaded rules (or always,
+// with force). The caller holds opsACL's write lock.
+func reloadOpsACLLocked(force bool) error {
+	opsACL.checkedAt = time.Now()
+	info, err := os.Stat(opsACL.file)
+	if err != nil {
+		return err
+	}
+	if !force && !info.ModTime().After(opsACL.modTime) {
+		return nil
+	}
+	f, err := os.Open(opsACL.file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil {
+			log.Println("ops ACL close error:", cerr)
+		}
+	}()
+	acl, err := clientip.ParseACL(f)
+	if err != nil {
+		return err
+	}
+	log.Printf("ops ACL loaded from %s (%d allow, %d deny)", opsACL.file, len(acl.Allow), len(acl.Deny))
+	opsACL.fileACL = acl
+	opsACL.modTime = info.ModTime()
+	return nil
+}
+
+// OpsACLMiddleware answers 403 for requests to ops routes (opsPathPrefixes) from a client
+// address the ops ACL does not permit. Rejections are recorded in the audit log. It needs
+// ClientIPMiddleware to run first, so addresses behind trusted proxies are checked.
+func OpsACLMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !opsPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if ip := clientIP(r); !currentOpsACL().Permits(ip) {
+				audit(r, "access.denied", "route", 0, map[string]any{"method": r.Method, "path": r.URL.Path})
+				writeHTTPError(w, r, http.StatusForbidden, "Forbidden",
+					"Access to this page is not allowed from your network.")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func opsPath(path string) bool {
+	for _, p := range opsPathPrefixes {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
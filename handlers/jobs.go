@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+
+	"devops-valgfag/internal/jobs"
+
+	"github.com/gorilla/mux"
+)
+
+// Job types registered by RegisterJobs.
+const (
+	JobScrapeExternal   = "scrape_external"
+	JobSendEmail        = "send_email"
+	JobRefreshWeather   = "refresh_weather"
+	JobCleanupSessions  = "cleanup_sessions"
+	JobPromoteExternal  = "promote_external"
+	JobDBMaintenance    = "db_maintenance"
+	JobBackupDatabase   = "backup_database"
+	JobEnforceRetention = "enforce_retention"
+)
+
+const (
+	adminJobsDefaultLimit = 50
+	adminJobsMaxLimit     = 500
+)
+
+// jobQueue is set by SetJobQueue; admin job endpoints return 503 without it.
+var jobQueue *jobs.Queue
+
+// ScrapeExternalPayload is the payload of a scrape_external job.
+type ScrapeExternalPayload struct {
+	Query    string `json:"query"`
+	Language string `json:"language"`
+	TenantID int    `json:"tenant_id,omitempty"` // default tenant when 0 (jobs queued before tenants)
+}
+
+// SendEmailPayload is the payload of a send_email job.
+type SendEmailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// AdminJobsResponse is returned by GET /admin/jobs.
+type AdminJobsResponse struct {
+	Depth map[string]int `json:"depth"`
+	Jobs  []jobs.Job     `json:"jobs"`
+}
+
+// SetJobQueue makes the queue available to the admin endpoints.
+func SetJobQueue(q *jobs.Queue) {
+	jobQueue = q
+}
+
+// RegisterJobs registers the handlers for all job types on q.
+func RegisterJobs(q *jobs.Queue) {
+	q.Register(JobScrapeExternal, runScrapeExternalJob)
+	q.Register(JobSendEmail, runSendEmailJob)
+	q.Register(JobRefreshWeather, func(ctx context.Context, _ json.RawMessage) error {
+		_, err := weatherService.Refresh(ctx)
+		return err
+	})
+	q.Register(JobCleanupSessions, runCleanupSessionsJob)
+	q.Register(JobPromoteExternal, runPromoteExternalJob)
+	q.Register(JobDBMaintenance, runMaintenanceJob)
+	q.Register(JobBackupDatabase, runBackupJob)
+	q.Register(JobEnforceRetention, runRetentionJob)
+}
+
+func runScrapeExternalJob(ctx context.Context, raw json.RawMessage) error {
+	var p ScrapeExternalPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	q := strings.TrimSpace(p.Query)
+	if q == "" {
+		return errors.New("query is required")
+	}
+	lang := p.Language
+	if lang == "" {
+		lang = "en"
+	}
+	tenant := p.TenantID
+	if tenant == 0 {
+		tenant = defaultTenantID
+	}
+	return scrapeExternal(ctx, tenant, q, lang)
+}
+
+// runSendEmailJob delivers mail via SMTP_ADDR (host:port) as SMTP_FROM.
+// SMTP_USERNAME/SMTP_PASSWORD enable PLAIN auth. Without SMTP_ADDR the mail is logged and dropped.
+func runSendEmailJob(_ context.Context, raw json.RawMessage) error {
+	var p SendEmailPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	if p.To == "" || strings.ContainsAny(p.To+p.Subject, "\r\n") {
+		return errors.New("invalid recipient or subject")
+	}
+
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		log.Printf("send_email: SMTP_ADDR not set, dropping mail to %s (%q)", p.To, p.Subject)
+		return nil
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "noreply@localhost"
+	}
+
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	msg := "From: " + from + "\r\n" +
+		"To: " + p.To + "\r\n" +
+		"Subject: " + p.Subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + p.Body
+	return smtp.SendMail(addr, auth, from, []string{p.To}, []byte(msg))
+}
+
+// runCleanupSessionsJob deletes expired remember-me tokens and the user_sessions rows of
+// ended sessions. Sessions themselves live in signed cookies or Redis and expire on their own.
+func runCleanupSessionsJob(ctx context.Context, _ json.RawMessage) error {
+	if err := pruneRememberTokens(ctx); err != nil {
+		return err
+	}
+	return pruneSessions(ctx)
+}
+
+// AdminJobsHandler godoc
+// @Summary      Inspect background jobs
+// @Description  Returns queue depth per status and the newest jobs, optionally filtered by status (queued, running, done, failed). Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        status  query  string  false  "Job status filter"
+// @Param        limit   query  int     false  "Max jobs returned (default 50, max 500)"
+// @Success      200  {object}  AdminJobsResponse
+// @Failure      400  {object}  APIErrorResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /admin/jobs [get]
+func AdminJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if jobQueue == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "job queue not configured"})
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", jobs.StatusQueued, jobs.StatusRunning, jobs.StatusDone, jobs.StatusFailed:
+	default:
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "invalid status"})
+		return
+	}
+	limit := adminJobsDefaultLimit
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = min(n, adminJobsMaxLimit)
+	}
+
+	ctx := r.Context()
+	depth, err := jobQueue.Depth(ctx)
+	if err != nil {
+		reportError(r, "job depth error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	list, err := jobQueue.List(ctx, status, limit)
+	if err != nil {
+		reportError(r, "list jobs error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, AdminJobsResponse{Depth: depth, Jobs: list})
+}
+
+// AdminRequeueJobHandler godoc
+// @Summary      Requeue failed job
+// @Description  Puts a failed job back in the queue with a fresh attempt budget. Admin only.
+// @Tags         Admin
+// @Security     sessionAuth
+// @Param        id  path  int  true  "Job ID"
+// @Success      204
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /admin/jobs/{id}/requeue [post]
+func AdminRequeueJobHandler(w http.ResponseWriter, r *http.Request) {
+	if jobQueue == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "job queue not configured"})
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "failed job not found"})
+		return
+	}
+
+	err = jobQueue.Requeue(r.Context(), id)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "failed job not found"})
+		return
+	case err != nil:
+		reportError(r, "requeue job error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not requeue job"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// JSON request bodies are decoded strictly: one JSON value of at most the handler's limit, and
+// only the fields the request type declares. A typo ("lmit") or a field from another endpoint
+// is answered 400 naming it instead of being silently ignored.
+
+// errEmptyBody is the decode error for a request without a body.
+var errEmptyBody = &bodyError{status: http.StatusBadRequest, message: "request body is empty"}
+
+// bodyError is a rejected request body.
+type bodyError struct {
+	status  int
+	message string
+	field   string // offending field, "" when the body as a whole is wrong
+}
+
+func (e *bodyError) Error() string { return e.message }
+
+// decodeJSONBody decodes r's body into dst. On failure it answers 400 (413 when the body is
+// larger than limit) with an APIErrorResponse naming the problem and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, limit int64, dst any) bool {
+	return writeBodyError(w, readJSONBody(w, r, limit, dst))
+}
+
+// decodeOptionalJSONBody is decodeJSONBody for endpoints whose body may be left out: an empty
+// body leaves dst as it is.
+func decodeOptionalJSONBody(w http.ResponseWriter, r *http.Request, limit int64, dst any) bool {
+	err := readJSONBody(w, r, limit, dst)
+	if errors.Is(err, errEmptyBody) {
+		err = nil
+	}
+	return writeBodyError(w, err)
+}
+
+func writeBodyError(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return true
+	}
+	var be *bodyError
+	if !errors.As(err, &be) {
+		be = &bodyError{status: http.StatusBadRequest, message: "invalid JSON body"}
+	}
+	writeJSON(w, be.status, APIErrorResponse{Error: be.message, Field: be.field})
+	return false
+}
+
+// readJSONBody decodes r's body into dst, returning a *bodyError on failure.
+func readJSONBody(w http.ResponseWriter, r *http.Request, limit int64, dst any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return jsonBodyError(err, limit)
+	}
+	// A second value ({"a":1}{"b":2}) is as wrong as a syntax error.
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			return jsonBodyError(err, limit)
+		}
+		return &bodyError{status: http.StatusBadRequest, message: "invalid JSON body: unexpected data after the JSON value"}
+	}
+	return nil
+}
+
+// jsonBodyError turns an encoding/json error into a message a client can act on.
+func jsonBodyError(err error, limit int64) *bodyError {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		tooBig    *http.MaxBytesError
+	)
+	switch {
+	case errors.Is(err, io.EOF):
+		return errEmptyBody
+	case errors.As(err, &tooBig):
+		return &bodyError{status: http.StatusRequestEntityTooLarge, message: fmt.Sprintf("request body too large (max %d bytes)", limit)}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &bodyError{status: http.StatusBadRequest, message: "invalid JSON body: unexpected end of input"}
+	case errors.As(err, &syntaxErr):
+		return &bodyError{status: http.StatusBadRequest, message: fmt.Sprintf("invalid JSON body: syntax error at byte %d", syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return &bodyError{status: http.StatusBadRequest, message: fmt.Sprintf("invalid JSON body: want %s, got %s", jsonTypeName(typeErr.Type), typeErr.Value)}
+		}
+		return &bodyError{
+			status:  http.StatusBadRequest,
+			message: fmt.Sprintf("field %q: want %s, got %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value),
+			field:   typeErr.Field,
+		}
+	}
+	// encoding/json has no error type for an unknown field.
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		name = strings.Trim(name, `"`)
+		return &bodyError{status: http.StatusBadRequest, message: fmt.Sprintf("unknown field %q", name), field: name}
+	}
+	return &bodyError{status: http.StatusBadRequest, message: "invalid JSON body"}
+}
+
+// jsonTypeName is the JSON name of the type a Go value decodes from.
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"devops-valgfag/internal/i18n"
+
+	"github.com/gorilla/mux"
+)
+
+// languageCookieMaxAge keeps the explicit UI language choice for a year.
+const languageCookieMaxAge = 365 * 24 * time.Hour
+
+// SetLanguageHandler stores the chosen UI language in the "lang" cookie
+// and sends the user back to the page they came from.
+func SetLanguageHandler(w http.ResponseWriter, r *http.Request) {
+	lang, ok := i18n.Normalize(mux.Vars(r)["lang"])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     i18n.CookieName,
+		Value:    lang,
+		Path:     "/",
+		MaxAge:   int(languageCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	redirect(w, r, sameSiteReferer(r), http.StatusFound)
+}
+
+// sameSiteReferer returns the Referer path (+query, without the base path) when it points at
+// this host, so the redirect cannot be abused as an open redirect. Falls back to "/".
+func sameSiteReferer(r *http.Request) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host != r.Host || ref.Path == "" {
+		return "/"
+	}
+	path := stripBasePath(ref.Path)
+	if ref.RawQuery != "" {
+		return path + "?" + ref.RawQuery
+	}
+	return path
+}
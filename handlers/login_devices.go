@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"devops-valgfag/internal/clientip"
+)
+
+// New device login alerts: each login records a fingerprint of the device (a hash of the
+// User-Agent and the client's /24 or /48 network, so a changing address on the same network
+// is the same device). A login from a fingerprint the user has not used before is audit-logged
+// and, unless the user turned login_alerts off in their preferences, emailed to them. The very
+// first device of an account is recorded silently.
+
+// loginDeviceUAMax bounds the User-Agent kept for the email.
+const loginDeviceUAMax = 200
+
+// deviceFingerprint identifies the device of a request.
+func deviceFingerprint(userAgent, ip string) string {
+	sum := sha256.Sum256([]byte(userAgent + "\n" + clientip.Network(ip)))
+	return hex.EncodeToString(sum[:])
+}
+
+// noteLoginDevice records the device of a successful login by u and alerts the user when it
+// is new. Failures are logged and never fail the login.
+func noteLoginDevice(r *http.Request, u User) {
+	if db == nil {
+		return
+	}
+	ctx := r.Context()
+	ip := clientIP(r)
+	ua := r.UserAgent()
+	if len(ua) > loginDeviceUAMax {
+		ua = ua[:loginDeviceUAMax]
+	}
+	isNew, first, err := recordLoginDevice(ctx, u.ID, deviceFingerprint(r.UserAgent(), ip), ua)
+	if err != nil {
+		log.Printf("login device error: %v", err)
+		return
+	}
+	if !isNew || first {
+		return
+	}
+
+	emailQueued := false
+	prefs, err := queryUserPreferences(ctx, u.ID)
+	if err != nil {
+		log.Printf("login device preferences error: %v", err)
+	}
+	if err == nil && prefs.LoginAlerts && jobQueue != nil && u.Email != "" {
+		_, err := jobQueue.Enqueue(ctx, JobSendEmail, SendEmailPayload{
+			To:      u.Email,
+			Subject: "New sign-in to your WhoKnows account",
+			Body:    newDeviceEmail(u.Username, ua, clientip.Network(ip), time.Now().UTC()),
+		})
+		if err != nil {
+			reportError(r, "enqueue login alert error", err)
+		}
+		emailQueued = err == nil
+	}
+	audit(r, "user.login_new_device", "user", u.ID, map[string]any{
+		"user_agent":   ua,
+		"network":      clientip.Network(ip),
+		"email_queued": emailQueued,
+	})
+}
+
+// recordLoginDevice stores the device or bumps its last_seen_at. isNew is true when the user
+// had not used it before, first when it is the user's first device at all.
+func recordLoginDevice(ctx context.Context, userID int, fingerprint, userAgent string) (isNew, first bool, err error) {
+	now := time.Now().UTC()
+	res, err := db.ExecContext(ctx,
+		`UPDATE user_devices SET last_seen_at = $1 WHERE user_id = $2 AND fingerprint = $3`,
+		now, userID, fingerprint,
+	)
+	if err != nil {
+		return false, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return false, false, err
+	}
+
+	var known int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_devices WHERE user_id = $1`, userID).Scan(&known); err != nil {
+		return false, false, err
+	}
+	// ON CONFLICT: a concurrent login from the same device already inserted it.
+	res, err = db.ExecContext(ctx, `
+INSERT INTO user_devices (user_id, fingerprint, user_agent, first_seen_at, last_seen_at)
+VALUES ($1, $2, $3, $4, $4)
+ON CONFLICT (user_id, fingerprint) DO NOTHING`,
+		userID, fingerprint, userAgent, now,
+	)
+	if err != nil {
+		return false, false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, known == 0, err
+}
+
+func newDeviceEmail(username, userAgent, network string, at time.Time) string {
+	if userAgent == "" {
+		userAgent = "unknown"
+	}
+	return "Hi " + username + ",\n\n" +
+		"Your WhoKnows account was just signed in to from a device we have not seen before:\n\n" +
+		"  Time:    " + at.Format("2006-01-02 15:04 MST") + "\n" +
+		"  Browser: " + userAgent + "\n" +
+		"  Network: " + network + "\n\n" +
+		"If this was you, there is nothing to do. If not, change your password right away.\n\n" +
+		"You can turn these emails off with the login_alerts setting in your preferences.\n"
+}
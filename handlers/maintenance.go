@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/lock"
+
+	"github.com/gorilla/mux"
+)
+
+// Database maintenance operations, run as db_maintenance jobs (progress in maintenance_runs).
+const (
+	// MaintenanceRebuildFTS recomputes pages.content_tsv for every page, e.g. after the text
+	// search configuration or the unaccent dictionary changed (SQLite: rebuilds pages_fts).
+	MaintenanceRebuildFTS = "rebuild_fts"
+	// MaintenanceReindexFTS rebuilds the full-text indexes without blocking writes
+	// (REINDEX CONCURRENTLY; SQLite: optimizes pages_fts).
+	MaintenanceReindexFTS = "reindex_fts"
+	// MaintenanceAnalyze refreshes the planner statistics of the pages table.
+	MaintenanceAnalyze = "analyze"
+)
+
+const (
+	// Pages whose content_tsv is recomputed per statement (and progress update) by rebuild_fts.
+	maintenanceBatch = 500
+	// Runs listed by GET /admin/maintenance.
+	maintenanceListLimit = 20
+)
+
+// ftsIndexes are the full-text indexes rebuilt by reindex_fts (see migrations 0003 and 0023).
+var ftsIndexes = []string{"idx_pages_content_tsv", "idx_external_results_tsv"}
+
+// maintenanceLockKey keeps maintenance runs from overlapping across replicas.
+var maintenanceLockKey = lock.Key("db_maintenance")
+
+// maintenanceMu stands in for the advisory lock on SQLite, which only runs as one process.
+var maintenanceMu sync.Mutex
+
+// MaintenanceRun is one row of maintenance_runs.
+type MaintenanceRun struct {
+	ID         int64      `json:"id"`
+	Operation  string     `json:"operation"`
+	Status     string     `json:"status"` // queued, running, done or failed
+	Done       int64      `json:"done"`   // rows for rebuild_fts, indexes or tables otherwise
+	Total      int64      `json:"total"`
+	LastError  string     `json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// MaintenancePayload is the payload of a db_maintenance job.
+type MaintenancePayload struct {
+	RunID int64 `json:"run_id"`
+}
+
+// MaintenanceRunsResponse is returned by GET /admin/maintenance.
+type MaintenanceRunsResponse struct {
+	Runs []MaintenanceRun `json:"runs"`
+}
+
+// maintenanceProgress records how far a run got; total may grow as the work is discovered.
+type maintenanceProgress func(done, total int64)
+
+// maintenanceOps maps operation names to their implementation.
+var maintenanceOps = map[string]func(ctx context.Context, progress maintenanceProgress) error{
+	MaintenanceRebuildFTS: rebuildFTS,
+	MaintenanceReindexFTS: reindexFTS,
+	MaintenanceAnalyze:    analyzePages,
+}
+
+// rebuildFTS recomputes content_tsv in id order, maintenanceBatch pages per statement, so a
+// large table is never locked as a whole. SQLite rebuilds the external-content FTS5 index in
+// one statement.
+func rebuildFTS(ctx context.Context, progress maintenanceProgress) error {
+	var total int64
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pages`).Scan(&total); err != nil {
+		return err
+	}
+	progress(0, total)
+
+	if sqlDialect == dialect.SQLite {
+		if _, err := db.ExecContext(ctx, `INSERT INTO pages_fts (pages_fts) VALUES ('rebuild')`); err != nil {
+			return err
+		}
+		progress(total, total)
+		return nil
+	}
+
+	var done, lastID int64
+	for {
+		var n, maxID int64
+		err := db.QueryRowContext(ctx, `
+WITH batch AS (
+  UPDATE pages
+  SET content_tsv = to_tsvector('simple', f_unaccent(coalesce(title, '') || ' ' || coalesce(content, '')))
+  WHERE id IN (SELECT id FROM pages WHERE id > $1 ORDER BY id LIMIT $2)
+  RETURNING id
+)
+SELECT COUNT(*), COALESCE(MAX(id), 0) FROM batch`, lastID, maintenanceBatch).Scan(&n, &maxID)
+		if err != nil {
+			return fmt.Errorf("rebuild content_tsv after page %d: %w", lastID, err)
+		}
+		if n == 0 {
+			return nil
+		}
+		done += n
+		lastID = maxID
+		progress(done, max(total, done))
+	}
+}
+
+// reindexFTS rebuilds the full-text indexes one by one. REINDEX CONCURRENTLY cannot run in a
+// transaction, so each index is its own statement.
+func reindexFTS(ctx context.Context, progress maintenanceProgress) error {
+	if sqlDialect == dialect.SQLite {
+		progress(0, 1)
+		if _, err := db.ExecContext(ctx, `INSERT INTO pages_fts (pages_fts) VALUES ('optimize')`); err != nil {
+			return err
+		}
+		progress(1, 1)
+		return nil
+	}
+
+	total := int64(len(ftsIndexes))
+	progress(0, total)
+	for i, name := range ftsIndexes {
+		// Index names are constants; identifiers cannot be bound as parameters.
+		if _, err := db.ExecContext(ctx, `REINDEX INDEX CONCURRENTLY `+name); err != nil {
+			return fmt.Errorf("reindex %s: %w", name, err)
+		}
+		progress(int64(i+1), total)
+	}
+	return nil
+}
+
+// analyzePages refreshes the planner statistics of pages (same statement on both dialects).
+func analyzePages(ctx context.Context, progress maintenanceProgress) error {
+	progress(0, 1)
+	if _, err := db.ExecContext(ctx, `ANALYZE pages`); err != nil {
+		return err
+	}
+	progress(1, 1)
+	return nil
+}
+
+// withMaintenanceLock runs fn unless another maintenance run holds the lock (lock.ErrNotAcquired).
+func withMaintenanceLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	if sqlDialect == dialect.SQLite {
+		if !maintenanceMu.TryLock() {
+			return lock.ErrNotAcquired
+		}
+		defer maintenanceMu.Unlock()
+		return fn(ctx)
+	}
+	return lock.TryWithLock(ctx, db, maintenanceLockKey, fn)
+}
+
+// runMaintenanceJob performs a queued maintenance run and records its progress and outcome.
+// Failures are retried like other jobs. A run that finds another one holding the lock (two
+// requests raced past the endpoint's check) fails without retrying; a job whose lease expired
+// while its run is still going simply leaves that run alone.
+func runMaintenanceJob(ctx context.Context, raw json.RawMessage) error {
+	var p MaintenancePayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	var operation string
+	err := db.QueryRowContext(ctx, `SELECT operation FROM maintenance_runs WHERE id = $1`, p.RunID).Scan(&operation)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("db_maintenance: run %d no longer exists", p.RunID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	op, ok := maintenanceOps[operation]
+	if !ok {
+		return fmt.Errorf("unknown maintenance operation %q", operation)
+	}
+
+	err = withMaintenanceLock(ctx, func(ctx context.Context) error {
+		if _, err := db.ExecContext(ctx, `
+UPDATE maintenance_runs
+SET status = 'running', done = 0, total = 0, last_error = NULL, started_at = $2, finished_at = NULL
+WHERE id = $1`, p.RunID, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		runErr := op(ctx, func(done, total int64) {
+			if _, err := db.ExecContext(ctx,
+				`UPDATE maintenance_runs SET done = $2, total = $3 WHERE id = $1`, p.RunID, done, total,
+			); err != nil {
+				log.Printf("db_maintenance: run %d progress: %v", p.RunID, err)
+			}
+		})
+
+		status, lastErr := "done", sql.NullString{}
+		if runErr != nil {
+			status, lastErr = "failed", sql.NullString{String: runErr.Error(), Valid: true}
+		}
+		// Background: record the outcome even when the job's ctx was cancelled mid-run.
+		if _, err := db.ExecContext(context.Background(),
+			`UPDATE maintenance_runs SET status = $2, last_error = $3, finished_at = $4 WHERE id = $1`,
+			p.RunID, status, lastErr, time.Now().UTC(),
+		); err != nil && runErr == nil {
+			runErr = err
+		}
+		log.Printf("db_maintenance: %s run %d %s in %s", operation, p.RunID, status, time.Since(start).Round(time.Millisecond))
+		return runErr
+	})
+	if errors.Is(err, lock.ErrNotAcquired) {
+		_, err = db.ExecContext(ctx, `
+UPDATE maintenance_runs SET status = 'failed', last_error = $2, finished_at = $3
+WHERE id = $1 AND status = 'queued'`, p.RunID, "another maintenance operation is running", time.Now().UTC())
+	}
+	return err
+}
+
+// listMaintenanceRuns returns the newest runs first.
+func listMaintenanceRuns(ctx context.Context, limit int) ([]MaintenanceRun, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT id, operation, status, done, total, last_error, created_at, started_at, finished_at
+FROM maintenance_runs
+ORDER BY id DESC
+LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	runs := []MaintenanceRun{}
+	for rows.Next() {
+		var (
+			run               MaintenanceRun
+			lastErr           sql.NullString
+			started, finished sql.NullTime
+		)
+		if err := rows.Scan(&run.ID, &run.Operation, &run.Status, &run.Done, &run.Total, &lastErr, &run.CreatedAt, &started, &finished); err != nil {
+			return nil, err
+		}
+		run.LastError = lastErr.String
+		if started.Valid {
+			run.StartedAt = &started.Time
+		}
+		if finished.Valid {
+			run.FinishedAt = &finished.Time
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// AdminMaintenanceHandler godoc
+// @Summary      List database maintenance runs
+// @Description  Returns the newest maintenance runs (rebuild_fts, reindex_fts, analyze) with their progress. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  MaintenanceRunsResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/maintenance [get]
+func AdminMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	runs, err := listMaintenanceRuns(r.Context(), maintenanceListLimit)
+	if err != nil {
+		reportError(r, "list maintenance runs error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, MaintenanceRunsResponse{Runs: runs})
+}
+
+// AdminStartMaintenanceHandler godoc
+// @Summary      Start database maintenance
+// @Description  Queues a maintenance operation as a db_maintenance job: rebuild_fts (recompute pages.content_tsv), reindex_fts (REINDEX CONCURRENTLY the full-text indexes) or analyze (ANALYZE pages). Only one operation runs at a time. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        operation  path  string  true  "rebuild_fts, reindex_fts or analyze"
+// @Success      202  {object}  MaintenanceRun
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /admin/maintenance/{operation} [post]
+func AdminStartMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if jobQueue == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "job queue not configured"})
+		return
+	}
+	operation := mux.Vars(r)["operation"]
+	if _, ok := maintenanceOps[operation]; !ok {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "unknown maintenance operation"})
+		return
+	}
+	ctx := r.Context()
+
+	var pending int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM maintenance_runs WHERE status IN ('queued', 'running')`,
+	).Scan(&pending); err != nil {
+		reportError(r, "maintenance runs lookup error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not start maintenance"})
+		return
+	}
+	if pending > 0 {
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: "another maintenance operation is queued or running"})
+		return
+	}
+
+	run := MaintenanceRun{Operation: operation, Status: "queued", CreatedAt: time.Now().UTC()}
+	if err := db.QueryRowContext(ctx,
+		`INSERT INTO maintenance_runs (operation, created_at) VALUES ($1, $2) RETURNING id`,
+		operation, run.CreatedAt,
+	).Scan(&run.ID); err != nil {
+		reportError(r, "create maintenance run error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not start maintenance"})
+		return
+	}
+	if _, err := jobQueue.Enqueue(ctx, JobDBMaintenance, MaintenancePayload{RunID: run.ID}); err != nil {
+		reportError(r, "enqueue maintenance error", err)
+		if _, derr := db.ExecContext(ctx, `DELETE FROM maintenance_runs WHERE id = $1`, run.ID); derr != nil {
+			log.Println("delete maintenance run error:", derr)
+		}
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not start maintenance"})
+		return
+	}
+
+	audit(r, "maintenance.start", "maintenance_run", int(run.ID), map[string]any{"operation": operation})
+	writeJSON(w, http.StatusAccepted, run)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterMethodHandlers completes the method set of every path route of r: a path with a GET
+// route also answers HEAD (the same handler; net/http drops the body), and OPTIONS answers 204
+// with an Allow header listing what the path accepts. It must be called after all routes are
+// registered and before RegisterErrorHandlers, so the Allow header of a 405 includes them.
+//
+// Prefix routes (/static/, /swagger/) and routes without a method matcher (/metrics) are left
+// alone; they already accept every method.
+func RegisterMethodHandlers(r *mux.Router) {
+	type pathRoutes struct {
+		methods []string
+		get     http.Handler
+	}
+	var order []string
+	paths := map[string]*pathRoutes{}
+	_ = r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		if re, err := route.GetPathRegexp(); err != nil || !strings.HasSuffix(re, "$") {
+			return nil // PathPrefix
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		p := paths[tmpl]
+		if p == nil {
+			p = &pathRoutes{}
+			paths[tmpl] = p
+			order = append(order, tmpl)
+		}
+		p.methods = append(p.methods, methods...)
+		if p.get == nil && slices.Contains(methods, http.MethodGet) {
+			p.get = route.GetHandler()
+		}
+		return nil
+	})
+
+	for _, tmpl := range order {
+		p := paths[tmpl]
+		if p.get != nil && !slices.Contains(p.methods, http.MethodHead) {
+			r.Handle(tmpl, p.get).Methods(http.MethodHead)
+			p.methods = append(p.methods, http.MethodHead)
+		}
+		if !slices.Contains(p.methods, http.MethodOptions) {
+			p.methods = append(p.methods, http.MethodOptions)
+			r.Handle(tmpl, optionsHandler(allowHeader(p.methods))).Methods(http.MethodOptions)
+		}
+	}
+}
+
+// optionsHandler answers OPTIONS with 204 and allow as the Allow header.
+func optionsHandler(allow string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowHeader joins methods in the order of allowedMethodCandidates, without duplicates.
+func allowHeader(methods []string) string {
+	var allow []string
+	for _, m := range allowedMethodCandidates {
+		if slices.Contains(methods, m) {
+			allow = append(allow, m)
+		}
+	}
+	return strings.Join(allow, ", ")
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+)
+
+// GET /api/metrics/summary condenses this instance's Prometheus metrics into one JSON
+// document for dashboard widgets and uptime pages that cannot query Prometheus. Counters are
+// totals since the process started (per replica); percentiles come from the histograms'
+// buckets, so they are estimates over the same period.
+
+// metricsSummaryToken is set by SetMetricsSummaryToken.
+var metricsSummaryToken string
+
+// SetMetricsSummaryToken sets the bearer token accepted by GET /api/metrics/summary
+// (METRICS_SUMMARY_TOKEN). Empty leaves the endpoint to admins.
+func SetMetricsSummaryToken(token string) {
+	metricsSummaryToken = strings.TrimSpace(token)
+}
+
+// RequireMetricsToken wraps a handler so it accepts "Authorization: Bearer <METRICS_SUMMARY_TOKEN>"
+// and otherwise behaves like RequireAdmin, for dashboards that cannot hold a session.
+func RequireMetricsToken(next http.HandlerFunc) http.HandlerFunc {
+	admin := RequireAdmin(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			admin(w, r)
+			return
+		}
+		if metricsSummaryToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(metricsSummaryToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			writeJSON(w, http.StatusUnauthorized, APIErrorResponse{Error: "unauthorized"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// LatencyPercentiles are latency percentiles in milliseconds.
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+// RequestsSummary counts HTTP responses (app_http_requests_total).
+type RequestsSummary struct {
+	Total     int64            `json:"total"`
+	ByClass   map[string]int64 `json:"by_class"`   // "2xx", "3xx", "4xx", "5xx"
+	ErrorRate float64          `json:"error_rate"` // share of 5xx responses (0-1)
+}
+
+// SearchSummary covers searches (app_search_total, app_search_duration_seconds).
+type SearchSummary struct {
+	Total       int64              `json:"total"`
+	WithResults int64              `json:"with_results"`
+	HitRate     float64            `json:"hit_rate"` // share of searches with at least one result (0-1)
+	LatencyMS   LatencyPercentiles `json:"latency_ms"`
+}
+
+// DBSummary covers read-only queries (app_db_queries_total, app_db_query_duration_seconds)
+// and the database state flags.
+type DBSummary struct {
+	Queries         int64              `json:"queries"`
+	Errors          int64              `json:"errors"`
+	LatencyMS       LatencyPercentiles `json:"latency_ms"`
+	OpenConnections int64              `json:"open_connections"` // primary pool
+	Degraded        bool               `json:"degraded"`         // primary unreachable (app_degraded_mode)
+	ReplicaUp       bool               `json:"replica_up"`
+}
+
+// MetricsSummaryResponse is returned by GET /api/metrics/summary.
+type MetricsSummaryResponse struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Requests    RequestsSummary `json:"requests"`
+	Search      SearchSummary   `json:"search"`
+	DB          DBSummary       `json:"db"`
+}
+
+// summarizeMetrics builds the summary from a metrics snapshot.
+func summarizeMetrics(s metrics.Snapshot) MetricsSummaryResponse {
+	resp := MetricsSummaryResponse{GeneratedAt: time.Now().UTC()}
+
+	resp.Requests.ByClass = map[string]int64{}
+	for _, class := range []string{"2xx", "3xx", "4xx", "5xx"} {
+		n := int64(s.Sum("app_http_requests_total", func(l metrics.Labels) bool {
+			return strings.HasPrefix(l["code"], class[:1])
+		}))
+		resp.Requests.ByClass[class] = n
+		resp.Requests.Total += n
+	}
+	resp.Requests.ErrorRate = ratio(int(resp.Requests.ByClass["5xx"]), int(resp.Requests.Total))
+
+	resp.Search.Total = int64(s.Sum("app_search_total", nil))
+	resp.Search.WithResults = int64(s.Sum("app_search_with_result_total", nil))
+	resp.Search.HitRate = ratio(int(resp.Search.WithResults), int(resp.Search.Total))
+	resp.Search.LatencyMS = latencyPercentiles(s, "app_search_duration_seconds")
+
+	resp.DB.Queries = int64(s.Sum("app_db_queries_total", nil))
+	resp.DB.Errors = int64(s.Sum("app_db_queries_total", func(l metrics.Labels) bool { return l["result"] == "error" }))
+	resp.DB.LatencyMS = latencyPercentiles(s, "app_db_query_duration_seconds")
+	resp.DB.OpenConnections = int64(s.Sum("go_sql_open_connections", func(l metrics.Labels) bool { return l["db_name"] == poolPrimary }))
+	resp.DB.Degraded = s.Sum("app_degraded_mode", nil) > 0
+	resp.DB.ReplicaUp = s.Sum("app_db_replica_up", nil) > 0
+	return resp
+}
+
+// latencyPercentiles reads the percentiles of a seconds histogram, in milliseconds.
+func latencyPercentiles(s metrics.Snapshot, name string) LatencyPercentiles {
+	h := s.Histogram(name, nil)
+	// Rounded to 0.1ms: bucket interpolation is not more precise than that.
+	ms := func(q float64) float64 { return math.Round(metrics.Quantile(q, h)*10000) / 10 }
+	return LatencyPercentiles{P50: ms(0.5), P90: ms(0.9), P95: ms(0.95), P99: ms(0.99)}
+}
+
+// APIMetricsSummaryHandler godoc
+// @Summary      Metrics summary
+// @Description  Key counters and gauges of this instance as JSON for dashboard widgets that cannot query Prometheus: HTTP responses by status class, search hit rate, and search and DB latency percentiles estimated from the histograms. Counters are totals since the process started. Requires an admin session or "Authorization: Bearer <METRICS_SUMMARY_TOKEN>".
+// @Tags         Observability
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  MetricsSummaryResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/metrics/summary [get]
+func APIMetricsSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := metrics.Gather(nil)
+	if err != nil {
+		reportError(r, "gather metrics error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not read metrics"})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, summarizeMetrics(snapshot))
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"devops-valgfag/internal/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// notFoundOther is the app_http_not_found_total prefix for paths outside every route prefix,
+// so random paths from scanners cannot grow the label set.
+const notFoundOther = "other"
+
+// allowedMethodCandidates are tried against the routes to build the Allow header of a 405.
+var allowedMethodCandidates = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// RegisterErrorHandlers installs the 404 and 405 handlers on r: branded HTML pages, or JSON
+// for API clients, carrying the request ID. It must be called after all routes are
+// registered, since the routes' top-level path segments become the prefixes of
+// app_http_not_found_total.
+//
+// mux runs neither handler through r.Use middleware, so both get a request ID of their own.
+func RegisterErrorHandlers(r *mux.Router) {
+	prefixes := routePrefixes(r)
+	r.NotFoundHandler = RequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		metrics.NotFound.WithLabelValues(notFoundPrefix(prefixes, req.URL.Path)).Inc()
+		writeHTTPError(w, req, http.StatusNotFound, "Page not found",
+			"The page you are looking for does not exist or has been moved.")
+	}))
+	r.MethodNotAllowedHandler = RequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if allow := allowedMethods(r, req); len(allow) > 0 {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+		}
+		writeHTTPError(w, req, http.StatusMethodNotAllowed, "Method not allowed",
+			"This page cannot be requested this way.")
+	}))
+}
+
+// writeHTTPError answers status with the error page, or with JSON ({"error": "..."} in
+// lowercase, like the other API errors) for API paths and clients asking for JSON.
+func writeHTTPError(w http.ResponseWriter, r *http.Request, status int, title, message string) {
+	if apiRequest(r) {
+		writeJSON(w, status, APIErrorResponse{Error: strings.ToLower(title)})
+		return
+	}
+	renderTemplateStatus(w, r, status, "error", map[string]any{
+		"Title":     title,
+		"Message":   message,
+		"RequestID": RequestID(r.Context()),
+	})
+}
+
+// apiRequest reports whether r expects a JSON error rather than an HTML page.
+func apiRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/admin/") ||
+		r.URL.Path == "/graphql" || wantsJSON(r)
+}
+
+// routePrefixes returns the first path segment ("/api") of every route template.
+func routePrefixes(r *mux.Router) map[string]bool {
+	prefixes := map[string]bool{}
+	_ = r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			if p := firstSegment(tmpl); p != "/" && !strings.Contains(p, "{") {
+				prefixes[p] = true
+			}
+		}
+		return nil
+	})
+	return prefixes
+}
+
+// notFoundPrefix is the metric label for path: its first segment if that is a route prefix.
+func notFoundPrefix(prefixes map[string]bool, path string) string {
+	if p := firstSegment(path); prefixes[p] {
+		return p
+	}
+	return notFoundOther
+}
+
+func firstSegment(path string) string {
+	seg, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return "/" + seg
+}
+
+// allowedMethods lists the methods some route of r accepts for req's path.
+func allowedMethods(r *mux.Router, req *http.Request) []string {
+	var allow []string
+	for _, method := range allowedMethodCandidates {
+		probe := req.Clone(req.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if r.Match(probe, &match) && match.MatchErr == nil {
+			allow = append(allow, method)
+		}
+	}
+	return allow
+}
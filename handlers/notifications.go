@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Notifications older than the newest N are not returned by the API.
+const notificationsListLimit = 50
+
+// Notification is an in-app message for one user (e.g. new saved search matches).
+type Notification struct {
+	ID        int64      `json:"id" example:"1"`
+	Message   string     `json:"message" example:"2 new result(s) for your saved search \"Go news\""`
+	URL       string     `json:"url,omitempty" example:"/search?language=en&q=golang"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+// APINotificationsResponse is returned by GET /api/me/notifications.
+type APINotificationsResponse struct {
+	Unread        int            `json:"unread" example:"2"`
+	Notifications []Notification `json:"notifications"`
+}
+
+// createNotification stores an in-app notification for a user.
+func createNotification(ctx context.Context, userID int64, message, link string) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO notifications (user_id, message, url) VALUES ($1, $2, $3)`,
+		userID, message, link,
+	)
+	return err
+}
+
+// APIListNotificationsHandler godoc
+// @Summary      List notifications
+// @Description  Returns the current user's newest in-app notifications and the unread count. Requires session auth.
+// @Tags         Saved searches
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  APINotificationsResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/notifications [get]
+func APIListNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	resp, err := queryNotifications(r.Context(), userID)
+	if err != nil {
+		reportError(r, "list notifications error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// APIMarkNotificationsReadHandler godoc
+// @Summary      Mark notifications read
+// @Description  Marks all of the current user's notifications as read. Requires session auth.
+// @Tags         Saved searches
+// @Security     sessionAuth
+// @Success      204
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/notifications/read [post]
+func APIMarkNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := db.ExecContext(r.Context(),
+		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		reportError(r, "mark notifications read error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func queryNotifications(ctx context.Context, userID int) (APINotificationsResponse, error) {
+	resp := APINotificationsResponse{Notifications: []Notification{}}
+
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`,
+		userID,
+	).Scan(&resp.Unread)
+	if err != nil {
+		return resp, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+SELECT id, message, url, created_at, read_at
+FROM notifications
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2`, userID, notificationsListLimit)
+	if err != nil {
+		return resp, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	for rows.Next() {
+		var n Notification
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.Message, &n.URL, &n.CreatedAt, &readAt); err != nil {
+			return resp, err
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		n.URL = URL(n.URL) // stored without the base path
+		resp.Notifications = append(resp.Notifications, n)
+	}
+	return resp, rows.Err()
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Path of the OpenSearch description document (linked from every HTML page).
+	openSearchPath = "/opensearch.xml"
+
+	// Max number of suggestions returned to the browser search box.
+	suggestLimit = 8
+)
+
+// openSearchDescription is the XML document browsers read to register WhoKnows
+// as a search engine (https://github.com/dewitt/opensearch).
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"OpenSearchDescription"`
+	XMLNS         string          `xml:"xmlns,attr"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	Image         openSearchImage `xml:"Image"`
+	URLs          []openSearchURL `xml:"Url"`
+}
+
+type openSearchImage struct {
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+	Type   string `xml:"type,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Method   string `xml:"method,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// OpenSearchHandler serves the OpenSearch description document.
+// Absolute URLs are required by browsers, so they use PUBLIC_BASE_URL or the incoming request.
+func OpenSearchHandler(w http.ResponseWriter, r *http.Request) {
+	base := publicURL(r)
+
+	doc := openSearchDescription{
+		XMLNS:         "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:     "WhoKnows",
+		Description:   "Search WhoKnows",
+		InputEncoding: "UTF-8",
+		Image: openSearchImage{
+			Width:  16,
+			Height: 16,
+			Type:   "image/png",
+			Value:  base + "/static/monkgroup.png",
+		},
+		URLs: []openSearchURL{
+			{Type: "text/html", Method: "get", Template: base + "/search?q={searchTerms}"},
+			{Type: "application/x-suggestions+json", Method: "get", Template: base + "/api/suggest?q={searchTerms}"},
+		},
+	}
+
+	writeXML(w, r, "application/opensearchdescription+xml", doc)
+}
+
+// APISuggestHandler godoc
+// @Summary      Search suggestions
+// @Description  Returns page titles matching the query prefix in the OpenSearch suggestions format: [query, [titles...]].
+// @Tags         Search
+// @Produce      json
+// @Param        q          query  string  false  "Search query prefix"
+// @Param        language   query  string  false  "Language code, en or da (default: lang cookie, saved preference, Accept-Language, then en)"
+// @Success      200  {array}  any  "OpenSearch suggestions"
+// @Router       /api/suggest [get]
+func APISuggestHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	lang := getLanguage(r)
+
+	suggestions := []string{}
+	if q != "" && db != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		titles, err := querySuggestions(ctx, q, lang, suggestLimit)
+		if err != nil {
+			log.Println("suggest query error:", err)
+		} else {
+			suggestions = titles
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-suggestions+json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode([]any{q, suggestions})
+}
+
+// querySuggestions returns titles of the context tenant's pages that start with the given
+// prefix (case-insensitive). Wildcards in the prefix match literally.
+// LOWER(...) LIKE is used instead of ILIKE so the query also runs on SQLite in tests.
+func querySuggestions(ctx context.Context, prefix, lang string, limit int) ([]string, error) {
+	const sqlSuggest = `
+SELECT title
+FROM pages
+WHERE language = $1
+  AND tenant_id = $4
+  AND deleted_at IS NULL
+  AND LOWER(title) LIKE $2 ESCAPE '\'
+ORDER BY title
+LIMIT $3;`
+
+	out := make([]string, 0, limit)
+	err := querySearch(ctx, func(rows *sql.Rows) error {
+		out = out[:0] // may run again on the primary after a replica failure
+		defer func() {
+			if err := rows.Close(); err != nil {
+				log.Println(rowsCloseErrMsg, err)
+			}
+		}()
+
+		for rows.Next() {
+			var title string
+			if err := rows.Scan(&title); err != nil {
+				log.Println("rows.Scan error:", err)
+				continue
+			}
+			out = append(out, title)
+		}
+		return rows.Err()
+	}, sqlSuggest, lang, escapeLike(strings.ToLower(prefix))+"%", limit, tenantID(ctx))
+	return out, err
+}
+
+// likeEscaper escapes the LIKE wildcards (and the escape character) for ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes s match itself literally in a LIKE pattern with ESCAPE '\'.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Page edits use optimistic concurrency: every page has a version, GET returns it as the ETag,
+// and PUT must say which version it edits (If-Match, or "version" in the body). The update
+// only applies to that version and bumps it, so of two editors working from the same version
+// the second gets 409 with the current version instead of silently overwriting the first.
+
+const pageBodyLimit = 1 << 20
+
+// Page is an editable content page.
+type Page struct {
+	ID          int        `json:"id" example:"42"`
+	Title       string     `json:"title" example:"Go (programming language)"`
+	URL         string     `json:"url" example:"/go"`
+	Language    string     `json:"language" example:"en"`
+	Content     string     `json:"content"`
+	LastUpdated *time.Time `json:"last_updated,omitempty"`
+	Version     int        `json:"version" example:"3"`
+	Tags        []Tag      `json:"tags"`
+}
+
+// PageUpdate is the body accepted by PUT /api/pages/{id}. The URL is the page's identity
+// (bookmarks, clicks, sitemap) and cannot be changed.
+type PageUpdate struct {
+	Title    string `json:"title" example:"Go (programming language)"`
+	Language string `json:"language" example:"en"`
+	Content  string `json:"content"`
+	Version  *int   `json:"version,omitempty" example:"3"` // alternative to If-Match
+}
+
+// APIVersionConflictResponse is returned with 409 when a page was changed by someone else.
+type APIVersionConflictResponse struct {
+	Error          string `json:"error" example:"page was modified by someone else"`
+	CurrentVersion int    `json:"current_version" example:"4"`
+}
+
+var errPageNotFound = errors.New("page not found")
+
+// pageETag formats a page version as a strong ETag.
+func pageETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch reads the version from an If-Match header ("3", "\"3\"" or W/"3").
+// ok is false when the header is absent.
+func parseIfMatch(h string) (version int, ok bool, err error) {
+	h = strings.TrimSpace(h)
+	if h == "" {
+		return 0, false, nil
+	}
+	h = strings.Trim(strings.TrimPrefix(h, "W/"), `"`)
+	version, err = strconv.Atoi(h)
+	if err != nil || version < 1 {
+		return 0, true, errors.New("If-Match must be a page version")
+	}
+	return version, true, nil
+}
+
+// loadPage loads a page of the context's tenant; pages of other tenants are not found.
+func loadPage(ctx context.Context, id int) (Page, error) {
+	var (
+		p       Page
+		updated sql.NullTime
+	)
+	err := db.QueryRowContext(ctx, `
+SELECT id, title, url, language, content, last_updated, version
+FROM pages
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL`, id, tenantID(ctx)).Scan(&p.ID, &p.Title, &p.URL, &p.Language, &p.Content, &updated, &p.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Page{}, errPageNotFound
+	}
+	if err != nil {
+		return Page{}, err
+	}
+	if updated.Valid {
+		p.LastUpdated = &updated.Time
+	}
+	p.Tags, err = pageTags(ctx, p.ID)
+	return p, err
+}
+
+// pageValidators loads what a conditional GET of a page compares: its version (the ETag)
+// and last_updated (Last-Modified, zero when unknown).
+func pageValidators(ctx context.Context, id int) (version int, modified time.Time, err error) {
+	var updated sql.NullTime
+	err = db.QueryRowContext(ctx, `
+SELECT version, last_updated FROM pages
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL`, id, tenantID(ctx)).Scan(&version, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, time.Time{}, errPageNotFound
+	}
+	return version, updated.Time, err
+}
+
+// APIGetPageHandler godoc
+// @Summary      Get a page
+// @Description  Returns a content page with its full content (raw and as sanitized HTML), related pages and the previous/next page in its language. The version is also sent as the ETag for a later PUT, and last_updated as Last-Modified. With If-None-Match (or If-Modified-Since) matching the current page, the answer is 304 without a body. The validators follow edits of the page itself; related pages, prev/next links and tags may change without them.
+// @Tags         Pages
+// @Produce      json
+// @Param        id  path  int  true  "Page ID"
+// @Param        If-None-Match      header  string  false  "ETag of the copy the client has"
+// @Param        If-Modified-Since  header  string  false  "Last-Modified of the copy the client has"
+// @Success      200  {object}  PageView
+// @Success      304
+// @Header       200,304  {string}  ETag  "Page version"
+// @Header       200,304  {string}  Last-Modified  "Time of the last edit"
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/pages/{id} [get]
+func APIGetPageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return
+	}
+	// The validators come from a cheap lookup, so a 304 skips loading content, related pages
+	// and links.
+	version, modified, err := pageValidators(r.Context(), id)
+	switch {
+	case errors.Is(err, errPageNotFound):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return
+	case err != nil:
+		reportError(r, "load page error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	if checkNotModified(w, r, "pages", pageETag(version), modified) {
+		return
+	}
+
+	p, err := loadPageView(r.Context(), id)
+	switch {
+	case errors.Is(err, errPageNotFound):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return
+	case err != nil:
+		reportError(r, "load page error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	// An edit between the two lookups: describe the page that is sent.
+	w.Header().Set("ETag", pageETag(p.Version))
+	if p.LastUpdated != nil {
+		w.Header().Set("Last-Modified", p.LastUpdated.UTC().Format(http.TimeFormat))
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// APIUpdatePageHandler godoc
+// @Summary      Update a page
+// @Description  Replaces title, language and content of a page. The edited version must be given via If-Match (the ETag from GET) or "version" in the body; if the page has changed since, nothing is written and 409 returns the current version. Admin only.
+// @Tags         Pages
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id        path    int         true   "Page ID"
+// @Param        If-Match  header  string      false  "Version being edited (ETag from GET)"
+// @Param        body      body    PageUpdate  true   "New page contents"
+// @Success      200  {object}  Page
+// @Header       200  {string}  ETag  "New page version"
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      409  {object}  APIVersionConflictResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      428  {object}  APIErrorResponse  "No version given"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/pages/{id} [put]
+func APIUpdatePageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return
+	}
+
+	var upd PageUpdate
+	if !decodeJSONBody(w, r, pageBodyLimit, &upd) {
+		return
+	}
+	upd.Title = strings.TrimSpace(upd.Title)
+	if upd.Language == "" {
+		upd.Language = "en"
+	}
+	switch {
+	case upd.Title == "" || strings.TrimSpace(upd.Content) == "":
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "title and content are required"})
+		return
+	case upd.Language != "en" && upd.Language != "da":
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "language must be en or da"})
+		return
+	}
+
+	version, ok, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: err.Error()})
+		return
+	}
+	switch {
+	case ok && upd.Version != nil && *upd.Version != version:
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "If-Match and version disagree"})
+		return
+	case !ok && upd.Version == nil:
+		writeJSON(w, http.StatusPreconditionRequired, APIErrorResponse{Error: "If-Match header or version required"})
+		return
+	case !ok:
+		version = *upd.Version
+	}
+
+	ctx := r.Context()
+	var taken int
+	tenant := tenantID(ctx)
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pages WHERE title = $1 AND id <> $2 AND tenant_id = $3`, upd.Title, id, tenant).Scan(&taken); err != nil {
+		reportError(r, "page title check error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	if taken > 0 {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "title already in use"})
+		return
+	}
+
+	res, err := db.ExecContext(ctx, `
+UPDATE pages
+SET title = $1, language = $2, content = $3, last_updated = $4, version = version + 1
+WHERE id = $5 AND version = $6 AND tenant_id = $7 AND deleted_at IS NULL`,
+		upd.Title, upd.Language, upd.Content, time.Now().UTC(), id, version, tenant,
+	)
+	if err != nil {
+		reportError(r, "update page error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save page"})
+		return
+	}
+
+	// Whether or not the update applied, answer with the page as it is now.
+	p, err := loadPage(ctx, id)
+	switch {
+	case errors.Is(err, errPageNotFound):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return
+	case err != nil:
+		reportError(r, "reload page error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	w.Header().Set("ETag", pageETag(p.Version))
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeJSON(w, http.StatusConflict, APIVersionConflictResponse{
+			Error:          "page was modified by someone else",
+			CurrentVersion: p.Version,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
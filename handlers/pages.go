@@ -12,5 +12,5 @@ func LoginPageHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func RegisterPageHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, r, "register", map[string]any{"Title": "Sign Up"})
+	renderTemplate(w, r, "register", registerPageData(map[string]any{"Title": "Sign Up"}))
 }
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"devops-valgfag/internal/apperror"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const resetPasswordTitle = "Reset password"
+
+var errResetLinkInvalid = apperror.New(apperror.Invalid, "This reset link is invalid or has expired")
+
+// ResetPasswordPageHandler renders the form for choosing a new password from an emailed reset link.
+func ResetPasswordPageHandler(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, r, "reset_password", map[string]any{
+		"Title": resetPasswordTitle,
+		"Token": r.URL.Query().Get("token"),
+	})
+}
+
+// APIPasswordResetHandler godoc
+// @Summary      Complete a password reset
+// @Description  Sets a new password using the token from a reset email sent after an admin forced a reset. The token is single-use and expires after 24 hours. On failure, renders the reset page with an error message.
+// @Tags         Auth
+// @Accept       application/x-www-form-urlencoded
+// @Produce      html
+// @Param        token      formData  string  true  "Reset token from the email"
+// @Param        password   formData  string  true  "New password"
+// @Param        password2  formData  string  true  "New password confirmation"
+// @Success      302  {string}  string  "Redirect to login page"
+// @Failure      400  {string}  string  "Rendered reset form: missing fields, passwords do not match or invalid link"
+// @Failure      500  {string}  string  "Rendered reset form: internal error"
+// @Router       /api/password-reset [post]
+func APIPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	fail := func(token string, err error) {
+		renderPageError(w, r, "reset_password", map[string]any{
+			"Title": resetPasswordTitle,
+			"Token": token,
+		}, err)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, authFormLimit)
+	if err := r.ParseForm(); err != nil {
+		fail("", errBadForm)
+		return
+	}
+	token := r.FormValue("token")
+	pw1 := r.FormValue("password")
+	pw2 := r.FormValue("password2")
+	switch {
+	case token == "" || pw1 == "":
+		fail(token, apperror.New(apperror.Invalid, "All fields required"))
+		return
+	case pw1 != pw2:
+		fail(token, apperror.New(apperror.Invalid, "Passwords do not match"))
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw1), bcrypt.DefaultCost)
+	if err != nil {
+		fail(token, apperror.Wrap(apperror.Internal, "Internal error, please try again", fmt.Errorf("bcrypt.GenerateFromPassword (password reset): %w", err)))
+		return
+	}
+
+	ctx := r.Context()
+	var userID int
+	err = db.QueryRowContext(ctx, `
+UPDATE users
+SET password = $1, must_reset_password = FALSE, password_reset_hash = NULL, password_reset_expires = NULL,
+    session_version = session_version + 1
+WHERE password_reset_hash = $2 AND password_reset_expires > $3 AND deleted_at IS NULL
+RETURNING id`, string(hash), hashResetToken(token), time.Now().UTC()).Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows): // unknown, already used or expired
+		fail("", errResetLinkInvalid)
+		return
+	case err != nil:
+		fail(token, apperror.Wrap(apperror.Internal, "Database error", fmt.Errorf("password reset update: %w", err)))
+		return
+	}
+	if err := revokeRememberTokens(ctx, userID); err != nil {
+		reportError(r, "revoke remember tokens error", err) // session_version already invalidates them
+	}
+	audit(r, "user.password_reset_completed", "user", userID, nil)
+
+	redirect(w, r, "/login", http.StatusFound)
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// Anonymous users keep their preferences in this cookie (url-encoded key/value pairs).
+	prefsCookieName   = "prefs"
+	prefsCookieMaxAge = 365 * 24 * time.Hour
+
+	minResultsPerPage = 5
+	maxResultsPerPage = 100
+)
+
+// Preferences are the user-controlled display settings.
+// Logged-in users' preferences live in user_preferences; anonymous users' in the "prefs" cookie.
+type Preferences struct {
+	Theme          string `json:"theme" example:"dark"`          // system | light | dark
+	Language       string `json:"language" example:"da"`         // default search language
+	ResultsPerPage int    `json:"results_per_page" example:"20"` // UI search page size
+	LoginAlerts    bool   `json:"login_alerts" example:"true"`   // email on logins from a new device (logged-in users)
+
+	// languageSet is true once the user chose Language; until then the request language is
+	// negotiated (see getLanguage).
+	languageSet bool
+}
+
+// PreferencesUpdate is the partial update accepted by PUT /api/me/preferences.
+// Omitted fields keep their current value.
+type PreferencesUpdate struct {
+	Theme          *string `json:"theme,omitempty"`
+	Language       *string `json:"language,omitempty"`
+	ResultsPerPage *int    `json:"results_per_page,omitempty"`
+	LoginAlerts    *bool   `json:"login_alerts,omitempty"`
+}
+
+func defaultPreferences() Preferences {
+	return Preferences{Theme: "system", Language: "en", ResultsPerPage: pageLimit, LoginAlerts: true}
+}
+
+// validate checks the values against the same constraints as the user_preferences table.
+func (p Preferences) validate() error {
+	switch p.Theme {
+	case "system", "light", "dark":
+	default:
+		return errors.New("theme must be one of: system, light, dark")
+	}
+	switch p.Language {
+	case "en", "da":
+	default:
+		return errors.New("language must be one of: en, da")
+	}
+	if p.ResultsPerPage < minResultsPerPage || p.ResultsPerPage > maxResultsPerPage {
+		return errors.New("results_per_page must be between 5 and 100")
+	}
+	return nil
+}
+
+// apply merges a partial update into p.
+func (p Preferences) apply(u PreferencesUpdate) Preferences {
+	if u.Theme != nil {
+		p.Theme = *u.Theme
+	}
+	if u.Language != nil {
+		p.Language = *u.Language
+		p.languageSet = true
+	}
+	if u.ResultsPerPage != nil {
+		p.ResultsPerPage = *u.ResultsPerPage
+	}
+	if u.LoginAlerts != nil {
+		p.LoginAlerts = *u.LoginAlerts
+	}
+	return p
+}
+
+// loadPreferences returns the preferences for the current request.
+// Failures fall back to defaults: preferences must never break page rendering.
+func loadPreferences(r *http.Request) Preferences {
+	// In degraded mode the cookie (or default) preferences are used instead of waiting on the database.
+	if userID, ok := currentUserID(r); ok && db != nil && !databaseDown() {
+		p, err := queryUserPreferences(r.Context(), userID)
+		if err != nil {
+			log.Printf("load preferences error: %v", err)
+			return defaultPreferences()
+		}
+		return p
+	}
+	return cookiePreferences(r)
+}
+
+// queryUserPreferences loads a user's row, returning defaults when none exists yet.
+func queryUserPreferences(ctx context.Context, userID int) (Preferences, error) {
+	var p Preferences
+	err := db.QueryRowContext(ctx,
+		`SELECT theme, language, results_per_page, login_alerts, language_set FROM user_preferences WHERE user_id = $1`,
+		userID,
+	).Scan(&p.Theme, &p.Language, &p.ResultsPerPage, &p.LoginAlerts, &p.languageSet)
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultPreferences(), nil
+	}
+	return p, err
+}
+
+// storedLanguage returns the language the user chose in their preferences, or "" when they
+// never chose one.
+func storedLanguage(r *http.Request) string {
+	if p := loadPreferences(r); p.languageSet {
+		return p.Language
+	}
+	return ""
+}
+
+// saveUserPreferences upserts a user's row.
+func saveUserPreferences(ctx context.Context, userID int, p Preferences) error {
+	_, err := db.ExecContext(ctx, `
+INSERT INTO user_preferences (user_id, theme, language, results_per_page, login_alerts, language_set, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+ON CONFLICT (user_id) DO UPDATE SET
+  theme = excluded.theme,
+  language = excluded.language,
+  results_per_page = excluded.results_per_page,
+  login_alerts = excluded.login_alerts,
+  language_set = excluded.language_set,
+  updated_at = excluded.updated_at`,
+		userID, p.Theme, p.Language, p.ResultsPerPage, p.LoginAlerts, p.languageSet,
+	)
+	return err
+}
+
+// cookiePreferences decodes the anonymous "prefs" cookie; invalid values are ignored.
+func cookiePreferences(r *http.Request) Preferences {
+	p := defaultPreferences()
+	c, err := r.Cookie(prefsCookieName)
+	if err != nil {
+		return p
+	}
+	vals, err := url.ParseQuery(c.Value)
+	if err != nil {
+		return p
+	}
+
+	candidate := p
+	if v := vals.Get("theme"); v != "" {
+		candidate.Theme = v
+	}
+	if v := vals.Get("language"); v != "" {
+		candidate.Language = v
+		candidate.languageSet = true
+	}
+	if n, err := strconv.Atoi(vals.Get("results_per_page")); err == nil {
+		candidate.ResultsPerPage = n
+	}
+	if candidate.validate() != nil {
+		return p
+	}
+	return candidate
+}
+
+func setPreferencesCookie(w http.ResponseWriter, p Preferences) {
+	vals := url.Values{}
+	vals.Set("theme", p.Theme)
+	if p.languageSet {
+		vals.Set("language", p.Language)
+	}
+	vals.Set("results_per_page", strconv.Itoa(p.ResultsPerPage))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     prefsCookieName,
+		Value:    vals.Encode(),
+		Path:     "/",
+		MaxAge:   int(prefsCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// APIGetPreferencesHandler godoc
+// @Summary      Get display preferences
+// @Description  Returns the current display preferences (from the DB when logged in, otherwise from the prefs cookie).
+// @Tags         Preferences
+// @Produce      json
+// @Success      200  {object}  Preferences
+// @Router       /api/me/preferences [get]
+func APIGetPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, loadPreferences(r))
+}
+
+// APIUpdatePreferencesHandler godoc
+// @Summary      Update display preferences
+// @Description  Partially updates display preferences. Logged-in users are persisted in user_preferences; anonymous users get a prefs cookie.
+// @Tags         Preferences
+// @Accept       json
+// @Produce      json
+// @Param        body  body  PreferencesUpdate  true  "Fields to change"
+// @Success      200  {object}  Preferences
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/preferences [put]
+func APIUpdatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var upd PreferencesUpdate
+	if !decodeJSONBody(w, r, 4096, &upd) {
+		return
+	}
+
+	p := loadPreferences(r).apply(upd)
+	if err := p.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if userID, ok := currentUserID(r); ok && db != nil {
+		if err := saveUserPreferences(r.Context(), userID, p); err != nil {
+			reportError(r, "save preferences error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save preferences"})
+			return
+		}
+	} else {
+		setPreferencesCookie(w, p)
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif" // registers decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// Public profiles live at /u/{username}: avatar, join date and the bookmarks the user marked
+// public. Uploaded avatars are kept in object storage; users without one get their Gravatar.
+
+const (
+	avatarMaxBytes     = 1 << 20
+	avatarMaxDimension = 2048
+	avatarCacheControl = "public, max-age=300"
+	avatarURLTTL       = time.Hour // must outlive the cached redirect
+	gravatarBaseURL    = "https://www.gravatar.com/avatar/"
+	gravatarDefault    = "identicon"
+)
+
+// avatarTypes maps the accepted (sniffed) content types to the stored file extension.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+// objectStore is set by SetStorage; avatar uploads return 503 without it.
+var objectStore storage.Storage
+
+// SetStorage configures where uploaded files are stored.
+func SetStorage(s storage.Storage) {
+	objectStore = s
+}
+
+// AvatarResponse is returned by POST /api/me/avatar.
+type AvatarResponse struct {
+	AvatarURL string `json:"avatar_url" example:"/u/alice/avatar"`
+}
+
+// profileUser is the public part of an account.
+type profileUser struct {
+	ID        int
+	Username  string
+	Email     string
+	AvatarKey string
+	CreatedAt *time.Time
+}
+
+// loadProfileUser finds an active, not deleted user by username.
+func loadProfileUser(ctx context.Context, username string) (profileUser, bool, error) {
+	var (
+		u       profileUser
+		key     sql.NullString
+		created sql.NullTime
+	)
+	err := db.QueryRowContext(ctx, `
+SELECT id, username, email, avatar_key, created_at
+FROM users
+WHERE username = $1 AND deleted_at IS NULL AND status = $2`, username, UserStatusActive,
+	).Scan(&u.ID, &u.Username, &u.Email, &key, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return profileUser{}, false, nil
+	}
+	if err != nil {
+		return profileUser{}, false, err
+	}
+	u.AvatarKey = key.String
+	u.CreatedAt = nullTimePtr(created)
+	return u, true, nil
+}
+
+func avatarPath(username string) string {
+	return "/u/" + url.PathEscape(username) + "/avatar"
+}
+
+// gravatarURL returns the Gravatar image for an email address (identicon when none is registered).
+func gravatarURL(email string, size int) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return gravatarBaseURL + hex.EncodeToString(sum[:]) + "?" + url.Values{
+		"d": {gravatarDefault},
+		"s": {strconv.Itoa(size)},
+	}.Encode()
+}
+
+// ProfilePageHandler renders the public profile of an active user.
+func ProfilePageHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil || databaseDown() {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	u, found, err := loadProfileUser(r.Context(), mux.Vars(r)["username"])
+	if err != nil {
+		reportError(r, "profile lookup error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	bookmarks, err := queryPublicBookmarks(r.Context(), u.ID)
+	if err != nil {
+		reportError(r, "public bookmarks error", err)
+		bookmarks = []Bookmark{}
+	}
+	joined := ""
+	if u.CreatedAt != nil {
+		joined = u.CreatedAt.Format("2 January 2006")
+	}
+	self, _ := currentUserID(r)
+	renderTemplate(w, r, "profile", map[string]any{
+		"Title":     u.Username,
+		"Username":  u.Username,
+		"JoinedAt":  joined,
+		"AvatarURL": avatarPath(u.Username),
+		"Bookmarks": bookmarks,
+		"CanUpload": self == u.ID && objectStore != nil,
+	})
+}
+
+// AvatarHandler godoc
+// @Summary      User avatar
+// @Description  Redirects to a short-lived signed URL for the user's uploaded avatar, or to their Gravatar (identicon fallback) when they have none.
+// @Tags         Profile
+// @Param        username  path   string  true   "Username"
+// @Param        s         query  int     false  "Gravatar size in pixels (default 128, 16-512)"
+// @Success      302  {string}  string  "Redirect to the avatar or to Gravatar"
+// @Failure      404  {string}  string  "Unknown user"
+// @Router       /u/{username}/avatar [get]
+func AvatarHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil || databaseDown() {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	u, found, err := loadProfileUser(r.Context(), mux.Vars(r)["username"])
+	if err != nil {
+		reportError(r, "avatar lookup error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	if u.AvatarKey != "" && objectStore != nil {
+		// Let the backend serve the bytes (S3 directly, the filesystem via /files/).
+		signed, err := objectStore.SignedURL(r.Context(), u.AvatarKey, avatarURLTTL)
+		if err == nil {
+			w.Header().Set("Cache-Control", avatarCacheControl)
+			redirect(w, r, signed, http.StatusFound)
+			return
+		}
+		reportError(r, "avatar url error", err)
+		// Fall back to Gravatar rather than a broken image.
+	}
+
+	size := 128
+	if n, err := strconv.Atoi(r.URL.Query().Get("s")); err == nil {
+		size = max(16, min(n, 512))
+	}
+	w.Header().Set("Cache-Control", avatarCacheControl)
+	redirect(w, r, gravatarURL(u.Email, size), http.StatusFound)
+}
+
+// APIUploadAvatarHandler godoc
+// @Summary      Upload avatar
+// @Description  Replaces the current user's avatar. Accepts a PNG, JPEG or GIF of at most 1 MiB and 2048x2048 pixels as multipart field "avatar". Requires session auth.
+// @Tags         Profile
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     sessionAuth
+// @Param        avatar  formData  file  true  "Image (PNG, JPEG or GIF)"
+// @Success      200  {object}  AvatarResponse
+// @Failure      400  {object}  APIErrorResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse
+// @Failure      415  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /api/me/avatar [post]
+func APIUploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	if objectStore == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "avatar storage not configured"})
+		return
+	}
+
+	// Room for the multipart envelope around the image.
+	r.Body = http.MaxBytesReader(w, r.Body, avatarMaxBytes+64<<10)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, APIErrorResponse{Error: "avatar too large (max 1 MiB)"})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: `multipart field "avatar" required`})
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(file, avatarMaxBytes+1))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "could not read upload"})
+		return
+	}
+	if len(data) > avatarMaxBytes {
+		writeJSON(w, http.StatusRequestEntityTooLarge, APIErrorResponse{Error: "avatar too large (max 1 MiB)"})
+		return
+	}
+	// The declared Content-Type is ignored; only what the bytes look like counts.
+	contentType := http.DetectContentType(data)
+	ext, allowed := avatarTypes[contentType]
+	if !allowed {
+		writeJSON(w, http.StatusUnsupportedMediaType, APIErrorResponse{Error: "avatar must be PNG, JPEG or GIF"})
+		return
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "not a valid image"})
+		return
+	}
+	if cfg.Width > avatarMaxDimension || cfg.Height > avatarMaxDimension {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "avatar too large (max 2048x2048 pixels)"})
+		return
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		reportError(r, "avatar key error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "internal error"})
+		return
+	}
+	// A new key per upload, so caches never serve the previous image under the new one.
+	key := storage.AvatarPrefix + strconv.Itoa(userID) + "-" + hex.EncodeToString(suffix) + ext
+
+	ctx := r.Context()
+	if err := objectStore.Put(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		reportError(r, "avatar store error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not store avatar"})
+		return
+	}
+	old, username, err := swapAvatarKey(ctx, userID, sql.NullString{String: key, Valid: true})
+	if err != nil {
+		reportError(r, "avatar update error", err)
+		_ = objectStore.Delete(ctx, key)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save avatar"})
+		return
+	}
+	deleteAvatarObject(r, old)
+	writeJSON(w, http.StatusOK, AvatarResponse{AvatarURL: URL(avatarPath(username))})
+}
+
+// APIDeleteAvatarHandler godoc
+// @Summary      Remove avatar
+// @Description  Deletes the current user's uploaded avatar; their Gravatar is shown again. Requires session auth.
+// @Tags         Profile
+// @Security     sessionAuth
+// @Success      204
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/avatar [delete]
+func APIDeleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	old, _, err := swapAvatarKey(r.Context(), userID, sql.NullString{})
+	if err != nil {
+		reportError(r, "avatar delete error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not remove avatar"})
+		return
+	}
+	deleteAvatarObject(r, old)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swapAvatarKey stores key as the user's avatar and returns the previous key and the username.
+func swapAvatarKey(ctx context.Context, userID int, key sql.NullString) (old, username string, err error) {
+	var prev sql.NullString
+	err = db.QueryRowContext(ctx, `SELECT avatar_key, username FROM users WHERE id = $1`, userID).Scan(&prev, &username)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE users SET avatar_key = $1 WHERE id = $2`, key, userID); err != nil {
+		return "", "", err
+	}
+	return prev.String, username, nil
+}
+
+// deleteAvatarObject removes a replaced avatar; a failure only leaves an orphaned object behind.
+func deleteAvatarObject(r *http.Request, key string) {
+	if key == "" || objectStore == nil {
+		return
+	}
+	if err := objectStore.Delete(r.Context(), key); err != nil {
+		reportError(r, "avatar cleanup error", err)
+	}
+}
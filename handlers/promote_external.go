@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/scraper"
+	"devops-valgfag/internal/urlcheck"
+)
+
+const (
+	// External results cached for at least this many queries are promoted to pages ...
+	promoteMinQueries = 3
+	// ... at most this many per promote_external_results run, to stay polite to Wikipedia.
+	promoteBatch = 10
+)
+
+// PromoteExternalPayload is the payload of a promote_external job.
+type PromoteExternalPayload struct {
+	URL      string `json:"url"`
+	TenantID int    `json:"tenant_id,omitempty"` // default tenant when 0
+}
+
+// PromoteExternalRequest is the optional body of POST /admin/external-results/promote.
+type PromoteExternalRequest struct {
+	// URL of one cached external result to promote now; empty promotes the most frequent ones.
+	URL string `json:"url" example:"https://en.wikipedia.org/?curid=25039021"`
+}
+
+// PromoteExternalResponse is returned by POST /admin/external-results/promote.
+type PromoteExternalResponse struct {
+	Queued []PromoteExternalPayload `json:"queued"`
+}
+
+// promoteCandidates returns the cached external results returned for at least
+// promoteMinQueries queries that have no page with their URL yet (deleted pages count, so
+// promotion never brings them back), most frequent first.
+func promoteCandidates(ctx context.Context, limit int) ([]PromoteExternalPayload, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT e.tenant_id, e.url
+FROM external_results e
+WHERE NOT EXISTS (SELECT 1 FROM pages p WHERE p.tenant_id = e.tenant_id AND p.url = e.url)
+GROUP BY e.tenant_id, e.url
+HAVING COUNT(*) >= $1
+ORDER BY COUNT(*) DESC, MAX(e.created_at) DESC, e.url
+LIMIT $2`, promoteMinQueries, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	var out []PromoteExternalPayload
+	for rows.Next() {
+		var p PromoteExternalPayload
+		if err := rows.Scan(&p.TenantID, &p.URL); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// enqueuePromotions queues a promote_external job per payload and returns the queued ones.
+func enqueuePromotions(ctx context.Context, payloads []PromoteExternalPayload) ([]PromoteExternalPayload, error) {
+	queued := make([]PromoteExternalPayload, 0, len(payloads))
+	for _, p := range payloads {
+		if _, err := jobQueue.Enqueue(ctx, JobPromoteExternal, p); err != nil {
+			return queued, err
+		}
+		queued = append(queued, p)
+	}
+	return queued, nil
+}
+
+// promoteExternalResults is the promote_external_results task: it queues the most frequent
+// cached external results for promotion into pages.
+func promoteExternalResults(ctx context.Context) error {
+	if db == nil || jobQueue == nil || !externalEnabled.Load() {
+		return nil
+	}
+	candidates, err := promoteCandidates(ctx, promoteBatch)
+	if err != nil {
+		return err
+	}
+	queued, err := enqueuePromotions(ctx, candidates)
+	if len(queued) > 0 {
+		log.Printf("queued %d external result(s) for promotion to pages", len(queued))
+	}
+	return err
+}
+
+// runPromoteExternalJob fetches the full article behind a cached external result and upserts
+// it into pages, in the wiki's language. Articles that cannot become pages (not Wikipedia,
+// unsupported language, title taken by another page) are skipped rather than retried.
+func runPromoteExternalJob(ctx context.Context, raw json.RawMessage) error {
+	var p PromoteExternalPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	if p.URL == "" {
+		return errors.New("url is required")
+	}
+	tenant := p.TenantID
+	if tenant == 0 {
+		tenant = defaultTenantID
+	}
+
+	article, err := scraper.WikipediaArticle(ctx, p.URL)
+	reportServiceStatus(EventExternalSearch, "External search (Wikipedia)", err == nil || errors.Is(err, scraper.ErrNotWikipedia))
+	if errors.Is(err, scraper.ErrNotWikipedia) {
+		log.Printf("promote_external: skipping %s: %v", p.URL, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if article.Language != "en" && article.Language != "da" {
+		log.Printf("promote_external: skipping %s: unsupported language %q", p.URL, article.Language)
+		return nil
+	}
+
+	var taken int
+	err = db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM pages WHERE tenant_id = $1 AND title = $2 AND url <> $3`,
+		tenant, article.Title, p.URL,
+	).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		log.Printf("promote_external: skipping %s: a page titled %q already exists", p.URL, article.Title)
+		return nil
+	}
+
+	_, err = db.ExecContext(ctx, `
+INSERT INTO pages (tenant_id, title, url, language, content, last_updated)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (tenant_id, url) DO UPDATE SET
+  title = excluded.title,
+  language = excluded.language,
+  content = excluded.content,
+  last_updated = excluded.last_updated,
+  version = pages.version + 1`,
+		tenant, article.Title, p.URL, article.Language, article.Text, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("upsert page: %w", err)
+	}
+	log.Printf("promote_external: promoted %s (%s, %d bytes)", p.URL, article.Language, len(article.Text))
+	return nil
+}
+
+// AdminPromoteExternalHandler godoc
+// @Summary      Promote cached external results to pages
+// @Description  Queues promote_external jobs that fetch the full Wikipedia article behind cached external results and add it to the searchable pages. With a url, promotes that cached result (in the request's tenant); without, the most frequently returned ones, like the promote_external_results task. Admin only.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  PromoteExternalRequest  false  "Optional URL to promote"
+// @Success      202  {object}  PromoteExternalResponse
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /admin/external-results/promote [post]
+func AdminPromoteExternalHandler(w http.ResponseWriter, r *http.Request) {
+	if jobQueue == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "job queue not configured"})
+		return
+	}
+	var in PromoteExternalRequest
+	if !decodeOptionalJSONBody(w, r, 4096, &in) {
+		return
+	}
+	ctx := r.Context()
+
+	var candidates []PromoteExternalPayload
+	if u := strings.TrimSpace(in.URL); u != "" {
+		if _, err := urlcheck.Parse(u); err != nil {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "invalid url: " + strings.TrimPrefix(err.Error(), "urlcheck: ")})
+			return
+		}
+		tenant := tenantID(ctx)
+		var cached int
+		if err := db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM external_results WHERE tenant_id = $1 AND url = $2`, tenant, u,
+		).Scan(&cached); err != nil {
+			reportError(r, "promote external lookup error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not queue promotion"})
+			return
+		}
+		if cached == 0 {
+			writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "no cached external result with this url"})
+			return
+		}
+		candidates = []PromoteExternalPayload{{URL: u, TenantID: tenant}}
+	} else {
+		var err error
+		if candidates, err = promoteCandidates(ctx, promoteBatch); err != nil {
+			reportError(r, "promote external candidates error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not queue promotion"})
+			return
+		}
+	}
+
+	queued, err := enqueuePromotions(ctx, candidates)
+	if err != nil {
+		reportError(r, "enqueue promote external error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not queue promotion"})
+		return
+	}
+	urls := make([]string, 0, len(queued))
+	for _, p := range queued {
+		urls = append(urls, p.URL)
+	}
+	audit(r, "external.promote", "external_result", 0, map[string]any{"urls": urls})
+	writeJSON(w, http.StatusAccepted, PromoteExternalResponse{Queued: queued})
+}
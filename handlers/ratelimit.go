@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/ratelimit"
+)
+
+// rateLimiters maps a scope to its limiter (see SetRateLimiter); scopes without one are unlimited.
+// Replaced on config reload, so access goes through rateLimitersMu.
+var (
+	rateLimitersMu sync.RWMutex
+	rateLimiters   = map[string]ratelimit.Limiter{}
+)
+
+// SetRateLimiter configures the limiter for a scope (in-memory or Redis, see main.go). Nil removes it.
+func SetRateLimiter(scope string, l ratelimit.Limiter) {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	if l == nil {
+		delete(rateLimiters, scope)
+		return
+	}
+	rateLimiters[scope] = l
+}
+
+func rateLimiter(scope string) ratelimit.Limiter {
+	rateLimitersMu.RLock()
+	defer rateLimitersMu.RUnlock()
+	return rateLimiters[scope]
+}
+
+// RateLimit wraps a handler with a per-client limit shared by all routes using the same scope.
+// Clients are told apart by address (see ClientIPMiddleware).
+// Over the limit the client gets 429. Limiter errors (e.g. Redis down) fail open.
+func RateLimit(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowRequest(r, scope) {
+			w.Header().Set("Retry-After", "60")
+			writeJSON(w, http.StatusTooManyRequests, APIErrorResponse{Error: "too many requests"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// allowRequest charges one call of r's client to the scope's limiter and reports whether it is
+// within the limit; rejections are counted. Handlers that run several limited operations per
+// request (GraphQL mutations) call it for each one.
+func allowRequest(r *http.Request, scope string) bool {
+	limiter := rateLimiter(scope)
+	if limiter == nil {
+		return true
+	}
+	allowed, err := limiter.Allow(r.Context(), scope+":"+clientIP(r))
+	if err != nil {
+		log.Printf("rate limiter error: %v", err)
+		return true
+	}
+	if !allowed {
+		metrics.RateLimited.WithLabelValues(scope).Inc()
+	}
+	return allowed
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
+
+	"devops-valgfag/internal/errortrack"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// requestIDHeader carries the request ID in both directions: a sane ID set by the proxy is
+// reused, otherwise one is generated. It is echoed on every response, so a user reporting an
+// error page can quote it and it can be found in the logs.
+const requestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{8,64}$`)
+
+type requestIDKey struct{}
+
+// RequestID returns the ID assigned to the request by RequestIDMiddleware ("" outside one).
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware assigns each request an ID (see requestIDHeader).
+func RequestIDMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(requestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RecoverMiddleware turns a panicking handler into a 500 response carrying the request ID
+// instead of a dropped connection. The panic and its stack are logged, counted
+// (app_panics_total) and reported to the error tracker (SENTRY_DSN), if configured.
+func RecoverMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pw := &panicWriter{ResponseWriter: w}
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// net/http uses ErrAbortHandler to abort a response on purpose; keep that behavior.
+				if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(rec)
+				}
+
+				stack := debug.Stack()
+				id := RequestID(r.Context())
+				metrics.PanicsTotal.Inc()
+				log.Printf("panic: %v [request_id=%s client_ip=%s method=%s path=%s]\n%s", rec, id, clientIP(r), r.Method, r.URL.Path, stack)
+				errortrack.Capture(errortrack.Event{
+					Message:   fmt.Sprintf("panic: %v", rec),
+					Level:     errortrack.LevelFatal,
+					Stack:     stack,
+					Request:   r,
+					RequestID: id,
+					Tags:      map[string]string{"kind": "panic"},
+				})
+
+				if pw.wroteHeader {
+					// Part of the response is already out; the client sees it cut short.
+					return
+				}
+				writeInternalError(pw, r, id)
+			}()
+			next.ServeHTTP(pw, r)
+		})
+	}
+}
+
+// writeInternalError answers a request whose handler failed unexpectedly.
+func writeInternalError(w http.ResponseWriter, r *http.Request, requestID string) {
+	w.Header().Del("Content-Length")
+	if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/graphql" || wantsJSON(r) {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "internal server error", "request_id": requestID})
+		return
+	}
+	http.Error(w, "internal server error (request ID: "+requestID+")", http.StatusInternalServerError)
+}
+
+// panicWriter records whether the response has started, so a recovered panic knows
+// whether it can still send an error response.
+type panicWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *panicWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *panicWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController (SSE flushing).
+func (w *panicWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/apperror"
+	"devops-valgfag/internal/httpclient"
+)
+
+// Registration bot mitigation. The register form carries a honeypot field that is hidden from
+// people (bots that fill in every input give themselves away), a signed timestamp so forms
+// submitted faster than a person can type are rejected, and optionally an hCaptcha or
+// Cloudflare Turnstile widget. Blocked attempts are counted in app_registration_blocked_total.
+
+const (
+	// registerHoneypotField is hidden with CSS; people leave it empty.
+	registerHoneypotField = "website"
+	registerTokenField    = "form_token"
+	// registerTokenMaxAge is how long a rendered register form can be submitted.
+	registerTokenMaxAge = 24 * time.Hour
+
+	captchaHCaptcha  = "hcaptcha"
+	captchaTurnstile = "turnstile"
+)
+
+// captchaProviders describes the supported CAPTCHA services: the widget script, the CSS class
+// of the widget element, the form field the widget fills in and the verification endpoint.
+var captchaProviders = map[string]struct {
+	script, class, field, verifyURL string
+}{
+	captchaHCaptcha: {
+		"https://js.hcaptcha.com/1/api.js", "h-captcha", "h-captcha-response",
+		"https://api.hcaptcha.com/siteverify",
+	},
+	captchaTurnstile: {
+		"https://challenges.cloudflare.com/turnstile/v0/api.js", "cf-turnstile", "cf-turnstile-response",
+		"https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	},
+}
+
+// RegistrationGuardConfig configures the register form checks.
+type RegistrationGuardConfig struct {
+	MinSubmitTime    time.Duration // REGISTER_MIN_SUBMIT_TIME; 0 disables the timing check
+	SigningKey       []byte        // signs the form timestamp (derived from SESSION_KEY)
+	CaptchaProvider  string        // CAPTCHA_PROVIDER: "" (off), "hcaptcha" or "turnstile"
+	CaptchaSiteKey   string
+	CaptchaSecret    string
+	CaptchaVerifyURL string // overrides the provider's verification endpoint (tests)
+}
+
+// registrationGuard is set by SetRegistrationGuard; the zero value only checks the honeypot.
+var registrationGuard RegistrationGuardConfig
+
+var captchaClient = httpclient.New("captcha", 10*time.Second)
+
+// SetRegistrationGuard configures the register form checks.
+func SetRegistrationGuard(cfg RegistrationGuardConfig) error {
+	cfg.CaptchaProvider = strings.ToLower(strings.TrimSpace(cfg.CaptchaProvider))
+	if cfg.CaptchaProvider != "" {
+		provider, ok := captchaProviders[cfg.CaptchaProvider]
+		if !ok {
+			return fmt.Errorf("unknown CAPTCHA provider %q (want hcaptcha or turnstile)", cfg.CaptchaProvider)
+		}
+		if cfg.CaptchaSiteKey == "" || cfg.CaptchaSecret == "" {
+			return fmt.Errorf("CAPTCHA provider %s needs a site key and a secret", cfg.CaptchaProvider)
+		}
+		if cfg.CaptchaVerifyURL == "" {
+			cfg.CaptchaVerifyURL = provider.verifyURL
+		}
+	}
+	if cfg.MinSubmitTime > 0 {
+		if len(cfg.SigningKey) == 0 {
+			return fmt.Errorf("the register form timing check needs a signing key")
+		}
+		// Derive a key of our own instead of reusing the caller's secret directly.
+		mac := hmac.New(sha256.New, cfg.SigningKey)
+		mac.Write([]byte("register form token"))
+		cfg.SigningKey = mac.Sum(nil)
+	}
+	registrationGuard = cfg
+	return nil
+}
+
+// registerPageData adds the bot mitigation fields and the terms to accept to the register
+// template data.
+func registerPageData(data map[string]any) map[string]any {
+	data["HoneypotField"] = registerHoneypotField
+	termsPageData(data)
+	if registrationGuard.MinSubmitTime > 0 {
+		data["FormToken"] = registerFormToken(time.Now())
+	}
+	if provider, ok := captchaProviders[registrationGuard.CaptchaProvider]; ok {
+		data["CaptchaScript"] = provider.script
+		data["CaptchaClass"] = provider.class
+		data["CaptchaSiteKey"] = registrationGuard.CaptchaSiteKey
+	}
+	return data
+}
+
+// registerFormToken is "<unix time in ms>.<signature>" for a form rendered at t.
+func registerFormToken(t time.Time) string {
+	ts := strconv.FormatInt(t.UnixMilli(), 10)
+	return ts + "." + signRegisterToken(ts)
+}
+
+func signRegisterToken(ts string) string {
+	mac := hmac.New(sha256.New, registrationGuard.SigningKey)
+	mac.Write([]byte(ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// registrationBlock is why a registration was rejected as automated.
+type registrationBlock struct {
+	reason string // app_registration_blocked_total label
+	err    *apperror.Error
+}
+
+var (
+	errFormExpired        = apperror.New(apperror.Invalid, "The form has expired, please try again")
+	errSubmittedTooFast   = apperror.New(apperror.Invalid, "Please take a moment and submit the form again")
+	errCaptchaFailed      = apperror.New(apperror.Invalid, "Please confirm that you are not a robot")
+	errCaptchaUnavailable = apperror.New(apperror.Unavailable, "Internal error, please try again")
+)
+
+// registrationProof is what a sign-up submits for the bot checks: the honeypot field, the
+// signed form token and the CAPTCHA widget response.
+type registrationProof struct {
+	honeypot  string
+	formToken string
+	captcha   string
+}
+
+// checkRegistration runs the bot checks on a parsed register form. The honeypot is checked
+// first and answered like a success (see APIRegisterHandler), so bots learn nothing from it.
+func checkRegistration(r *http.Request) *registrationBlock {
+	proof := registrationProof{
+		honeypot:  r.PostFormValue(registerHoneypotField),
+		formToken: r.PostFormValue(registerTokenField),
+	}
+	if provider, ok := captchaProviders[registrationGuard.CaptchaProvider]; ok {
+		proof.captcha = r.PostFormValue(provider.field)
+	}
+	return checkRegistrationProof(r, proof)
+}
+
+// checkRegistrationProof runs the bot checks on the proof of a sign-up that did not come from
+// the register form (the GraphQL register mutation).
+func checkRegistrationProof(r *http.Request, proof registrationProof) *registrationBlock {
+	if proof.honeypot != "" {
+		return &registrationBlock{reason: "honeypot"}
+	}
+	if minAge := registrationGuard.MinSubmitTime; minAge > 0 {
+		ts, sig, _ := strings.Cut(proof.formToken, ".")
+		ms, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || !hmac.Equal([]byte(sig), []byte(signRegisterToken(ts))) {
+			return &registrationBlock{"form_token", errFormExpired}
+		}
+		age := time.Since(time.UnixMilli(ms))
+		if age > registerTokenMaxAge {
+			return &registrationBlock{"form_token", errFormExpired}
+		}
+		if age < minAge {
+			return &registrationBlock{"too_fast", errSubmittedTooFast}
+		}
+	}
+	if _, ok := captchaProviders[registrationGuard.CaptchaProvider]; ok {
+		response := proof.captcha
+		if response == "" {
+			return &registrationBlock{"captcha", errCaptchaFailed}
+		}
+		passed, err := verifyCaptcha(r.Context(), response, clientIP(r))
+		if err != nil {
+			reportError(r, "captcha verify error", err)
+			return &registrationBlock{"captcha_unavailable", errCaptchaUnavailable}
+		}
+		if !passed {
+			return &registrationBlock{"captcha", errCaptchaFailed}
+		}
+	}
+	return nil
+}
+
+// verifyCaptcha checks a widget response with the provider (hCaptcha and Turnstile share
+// the siteverify protocol).
+func verifyCaptcha(ctx context.Context, response, remoteIP string) (bool, error) {
+	form := url.Values{
+		"secret":   {registrationGuard.CaptchaSecret},
+		"response": {response},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, registrationGuard.CaptchaVerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := captchaClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("siteverify: status %d", resp.StatusCode)
+	}
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("siteverify: %w", err)
+	}
+	return result.Success, nil
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"devops-valgfag/internal/cache"
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// "More like this": pages related to a page, shown on the article view and served by
+// GET /api/pages/{id}/related. With FTS the page's most frequent lexemes (from its own
+// content_tsv) are OR-ed into a tsquery and other pages are ranked against it; without FTS,
+// pages mentioning one of the longer title words are returned. Results are cached per page.
+
+const (
+	relatedDefaultLimit = 5
+	relatedMaxLimit     = 10 // also the number of results computed and cached
+	// relatedLexemes caps the lexemes taken from the page's tsvector for the FTS query.
+	relatedLexemes = 20
+	// relatedTerms caps the title words used without FTS.
+	relatedTerms = 5
+)
+
+var (
+	relatedCache    cache.Cache
+	relatedCacheTTL time.Duration
+)
+
+// SetRelatedCache enables caching of related pages for ttl. A nil cache or ttl <= 0 disables it.
+func SetRelatedCache(c cache.Cache, ttl time.Duration) {
+	if ttl <= 0 {
+		c = nil
+	}
+	relatedCache, relatedCacheTTL = c, ttl
+}
+
+// APIRelatedPagesResponse is returned by GET /api/pages/{id}/related.
+type APIRelatedPagesResponse struct {
+	Related []PageLink `json:"related"`
+}
+
+// APIRelatedPagesHandler godoc
+// @Summary      Related pages
+// @Description  Pages similar to the given page in the same language ("more like this"), best first. Based on the page's full-text vector when FTS is enabled, otherwise on its title words. Cached per page.
+// @Tags         Pages
+// @Produce      json
+// @Param        id     path   int  true   "Page ID"
+// @Param        limit  query  int  false  "Max results (default 5, max 10)"
+// @Success      200  {object}  APIRelatedPagesResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/pages/{id}/related [get]
+func APIRelatedPagesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return
+	}
+	limit := relatedDefaultLimit
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = min(n, relatedMaxLimit)
+	}
+
+	p, err := loadPage(r.Context(), id)
+	switch {
+	case errors.Is(err, errPageNotFound):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return
+	case err != nil:
+		reportError(r, "load page error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	related, err := relatedPages(r.Context(), p, limit)
+	if err != nil {
+		reportError(r, "related pages error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIRelatedPagesResponse{Related: related})
+}
+
+// relatedPages returns up to limit pages related to p, from the cache when possible.
+func relatedPages(ctx context.Context, p Page, limit int) ([]PageLink, error) {
+	key := "related:" + strconv.Itoa(p.ID)
+	links, ok := cachedRelated(ctx, key)
+	if !ok {
+		var err error
+		if links, err = queryRelated(ctx, p); err != nil {
+			return nil, err
+		}
+		storeRelated(ctx, key, links)
+	}
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+func cachedRelated(ctx context.Context, key string) ([]PageLink, bool) {
+	if relatedCache == nil {
+		return nil, false
+	}
+	data, ok, err := relatedCache.Get(ctx, key)
+	if err != nil {
+		log.Println("related cache get error:", err)
+		metrics.CacheRequests.WithLabelValues("related", "error").Inc()
+		return nil, false
+	}
+	var links []PageLink
+	if !ok || json.Unmarshal(data, &links) != nil {
+		metrics.CacheRequests.WithLabelValues("related", "miss").Inc()
+		return nil, false
+	}
+	metrics.CacheRequests.WithLabelValues("related", "hit").Inc()
+	return links, true
+}
+
+func storeRelated(ctx context.Context, key string, links []PageLink) {
+	if relatedCache == nil {
+		return
+	}
+	data, err := json.Marshal(links)
+	if err != nil {
+		return
+	}
+	if err := relatedCache.Set(ctx, key, data, relatedCacheTTL); err != nil {
+		log.Println("related cache set error:", err)
+	}
+}
+
+// queryRelated computes the related pages of p (up to relatedMaxLimit). The FTS variant
+// needs PostgreSQL's tsvector; SQLite always matches title words.
+func queryRelated(ctx context.Context, p Page) ([]PageLink, error) {
+	if useFTSSearch.Load() && sqlDialect == dialect.Postgres {
+		links, err := queryRelatedFTS(ctx, p)
+		if err == nil || isQueryCanceled(ctx, err) {
+			return links, err
+		}
+		log.Println("FTS related pages error, falling back to LIKE:", err)
+	}
+	return queryRelatedLike(ctx, p)
+}
+
+// queryRelatedFTS builds the query from the page's most frequent plain-word lexemes of at
+// least four characters (short words in the 'simple' config are mostly stop words).
+func queryRelatedFTS(ctx context.Context, p Page) ([]PageLink, error) {
+	const sqlRelated = `
+WITH src AS (
+  SELECT content_tsv FROM pages WHERE id = $2
+),
+mlt AS (
+  SELECT to_tsquery('simple', string_agg(t.lexeme, ' | ')) AS query
+  FROM (
+    SELECT u.lexeme
+    FROM src, unnest(src.content_tsv) AS u
+    WHERE length(u.lexeme) >= 4 AND u.lexeme ~ '^[[:alnum:]]+$'
+    ORDER BY cardinality(u.positions) DESC, u.lexeme
+    LIMIT $3
+  ) t
+)
+SELECT p.id, p.title, p.url
+FROM pages p
+CROSS JOIN mlt
+WHERE p.language = $1
+  AND p.id <> $2
+  AND p.tenant_id = $5
+  AND p.deleted_at IS NULL
+  AND p.content_tsv @@ mlt.query
+ORDER BY ts_rank(p.content_tsv, mlt.query) DESC, p.id DESC
+LIMIT $4;`
+	return queryPageLinks(ctx, sqlRelated, p.Language, p.ID, relatedLexemes, relatedMaxLimit, tenantID(ctx))
+}
+
+// queryRelatedLike matches the longer title words against other pages' titles and content.
+func queryRelatedLike(ctx context.Context, p Page) ([]PageLink, error) {
+	terms := titleTerms(p.Title)
+	if len(terms) == 0 {
+		return []PageLink{}, nil
+	}
+	args := []any{p.Language, p.ID, tenantID(ctx)}
+	conds := make([]string, 0, len(terms))
+	for _, term := range terms {
+		args = append(args, "%"+term+"%")
+		n := "$" + strconv.Itoa(len(args))
+		conds = append(conds, "LOWER(title) LIKE "+n+" OR LOWER(content) LIKE "+n)
+	}
+	args = append(args, relatedMaxLimit)
+	q := `
+SELECT id, title, url
+FROM pages
+WHERE language = $1
+  AND id <> $2
+  AND tenant_id = $3
+  AND deleted_at IS NULL
+  AND (` + strings.Join(conds, " OR ") + `)
+ORDER BY last_updated DESC NULLS LAST, id DESC
+LIMIT $` + strconv.Itoa(len(args))
+	return queryPageLinks(ctx, q, args...)
+}
+
+// titleTerms returns the distinct lower-cased title words of at least four letters.
+func titleTerms(title string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(w)) < 4 || seen[w] {
+			continue
+		}
+		seen[w] = true
+		out = append(out, w)
+		if len(out) == relatedTerms {
+			break
+		}
+	}
+	return out
+}
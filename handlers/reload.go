@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/experiments"
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/ratelimit"
+	"devops-valgfag/internal/searchmerge"
+	"devops-valgfag/internal/slowquery"
+)
+
+// RuntimeConfig is the configuration that can change without a restart: main builds it from
+// the environment at startup and again on SIGHUP or POST /admin/config/reload (ReloadConfig).
+type RuntimeConfig struct {
+	SearchFTS            bool                     // SEARCH_FTS
+	ExternalSearch       bool                     // EXTERNAL_SEARCH
+	SearchMerge          searchmerge.Policy       // SEARCH_MERGE_STRATEGY, SEARCH_EXTERNAL_QUOTA
+	SearchShadow         ShadowMode               // SEARCH_SHADOW
+	SearchShadowSample   int                      // SEARCH_SHADOW_SAMPLE, percent of searches
+	Experiments          []experiments.Experiment // EXPERIMENTS
+	RegistrationApproval bool                     // REGISTRATION_APPROVAL
+	RateLimitAuth        int                      // RATE_LIMIT_AUTH, requests per minute; 0 disables
+	RateLimitAPI         int                      // RATE_LIMIT_API
+	APIDailyQuota        int                      // API_DAILY_QUOTA, calls per user and UTC day; 0 disables
+	TrustedProxies       []netip.Prefix           // TRUSTED_PROXIES
+	SlowQueryThreshold   time.Duration            // SLOW_QUERY_THRESHOLD; 0 disables slow query logs
+	SlowQueryExplain     bool                     // SLOW_QUERY_EXPLAIN
+}
+
+// runtimeConfig is the RuntimeConfig in effect and what is needed to apply and reload it.
+// The lock serializes reloads.
+var runtimeConfig struct {
+	sync.Mutex
+	current    RuntimeConfig
+	applied    bool
+	source     func() (RuntimeConfig, error)
+	newLimiter func(perMinute int) ratelimit.Limiter
+	tracers    []*slowquery.Tracer
+}
+
+// SetRateLimitBackend sets how ApplyRuntimeConfig creates rate limiters (in-memory or Redis,
+// see main.go). The default is in-memory.
+func SetRateLimitBackend(newLimiter func(perMinute int) ratelimit.Limiter) {
+	runtimeConfig.Lock()
+	defer runtimeConfig.Unlock()
+	runtimeConfig.newLimiter = newLimiter
+}
+
+// SetSlowQueryTracers registers the database tracers that get the slow query settings.
+func SetSlowQueryTracers(tracers ...*slowquery.Tracer) {
+	runtimeConfig.Lock()
+	defer runtimeConfig.Unlock()
+	runtimeConfig.tracers = tracers
+}
+
+// SetConfigSource sets how ReloadConfig reads the configuration (main re-reads CONFIG_FILE
+// layered under the environment).
+func SetConfigSource(load func() (RuntimeConfig, error)) {
+	runtimeConfig.Lock()
+	defer runtimeConfig.Unlock()
+	runtimeConfig.source = load
+}
+
+// ApplyRuntimeConfig validates c and puts it in effect, returning the settings that changed.
+// An invalid config is rejected as a whole and the current one stays in effect.
+func ApplyRuntimeConfig(c RuntimeConfig) ([]string, error) {
+	runtimeConfig.Lock()
+	defer runtimeConfig.Unlock()
+	if err := checkRuntimeConfig(c); err != nil {
+		return nil, err
+	}
+	return applyRuntimeConfigLocked(c), nil
+}
+
+// ReloadConfig reads the configuration from the config source and the ops ACL file and
+// applies both, or neither if either is invalid. Reloads are counted in
+// app_config_reloads_total.
+func ReloadConfig() ([]string, error) {
+	changed, err := reloadConfig()
+	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("failure").Inc()
+		log.Println("config reload error (keeping previous config):", err)
+		return nil, err
+	}
+	metrics.ConfigReloads.WithLabelValues("success").Inc()
+	if len(changed) > 0 {
+		log.Printf("config reloaded, changed: %s", strings.Join(changed, ", "))
+	} else {
+		log.Println("config reloaded, no changes")
+	}
+	return changed, nil
+}
+
+func reloadConfig() ([]string, error) {
+	runtimeConfig.Lock()
+	defer runtimeConfig.Unlock()
+	if runtimeConfig.source == nil {
+		return nil, errors.New("config reload is not configured")
+	}
+	next, err := runtimeConfig.source()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRuntimeConfig(next); err != nil {
+		return nil, err
+	}
+	if err := ReloadOpsACL(); err != nil {
+		return nil, fmt.Errorf("ADMIN_IP_ACL_FILE: %w", err)
+	}
+	return applyRuntimeConfigLocked(next), nil
+}
+
+// checkRuntimeConfig reports settings that the setters would reject.
+func checkRuntimeConfig(c RuntimeConfig) error {
+	if s := c.SearchMerge.Strategy; s != "" { // the zero Policy appends
+		if _, err := searchmerge.ParseStrategy(string(s)); err != nil {
+			return err
+		}
+	}
+	if c.SearchMerge.ExternalQuota < 0 || c.RateLimitAuth < 0 || c.RateLimitAPI < 0 || c.APIDailyQuota < 0 {
+		return errors.New("limits and quotas must not be negative")
+	}
+	if _, err := ParseShadowMode(string(c.SearchShadow)); err != nil {
+		return err
+	}
+	if c.SearchShadowSample < 0 || c.SearchShadowSample > 100 {
+		return errors.New("SEARCH_SHADOW_SAMPLE: want a percentage from 0 to 100")
+	}
+	return checkExperiments(c.Experiments)
+}
+
+// applyRuntimeConfigLocked puts a checked config in effect. Rate limiters are only replaced
+// when their limit changed, so clients keep their counts across reloads.
+func applyRuntimeConfigLocked(c RuntimeConfig) []string {
+	prev, first := runtimeConfig.current, !runtimeConfig.applied
+
+	EnableFTSSearch(c.SearchFTS)
+	EnableExternalSearch(c.ExternalSearch)
+	SetSearchMerge(c.SearchMerge)
+	SetSearchShadow(c.SearchShadow, c.SearchShadowSample)
+	_ = SetExperiments(c.Experiments) // checked by checkRuntimeConfig
+	SetRegistrationApproval(c.RegistrationApproval)
+	SetTrustedProxies(c.TrustedProxies)
+	if first || c.RateLimitAuth != prev.RateLimitAuth {
+		SetRateLimiter("auth", newRateLimiter(c.RateLimitAuth))
+	}
+	if first || c.RateLimitAPI != prev.RateLimitAPI {
+		SetRateLimiter("api", newRateLimiter(c.RateLimitAPI))
+	}
+	SetAPIDailyQuota(c.APIDailyQuota)
+	for _, t := range runtimeConfig.tracers {
+		t.Configure(c.SlowQueryThreshold, c.SlowQueryExplain)
+	}
+
+	runtimeConfig.current, runtimeConfig.applied = c, true
+	if first {
+		return nil
+	}
+	return changedSettings(prev, c)
+}
+
+// newRateLimiter returns a limiter for perMinute requests, or nil (unlimited) for 0.
+func newRateLimiter(perMinute int) ratelimit.Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if runtimeConfig.newLimiter != nil {
+		return runtimeConfig.newLimiter(perMinute)
+	}
+	return ratelimit.NewMemory(perMinute, time.Minute)
+}
+
+// changedSettings names the environment variables whose values differ between a and b.
+func changedSettings(a, b RuntimeConfig) []string {
+	var changed []string
+	add := func(differ bool, names ...string) {
+		if differ {
+			changed = append(changed, names...)
+		}
+	}
+	add(a.SearchFTS != b.SearchFTS, "SEARCH_FTS")
+	add(a.ExternalSearch != b.ExternalSearch, "EXTERNAL_SEARCH")
+	add(a.SearchMerge.Strategy != b.SearchMerge.Strategy, "SEARCH_MERGE_STRATEGY")
+	add(a.SearchMerge.ExternalQuota != b.SearchMerge.ExternalQuota, "SEARCH_EXTERNAL_QUOTA")
+	add(a.SearchShadow != b.SearchShadow, "SEARCH_SHADOW")
+	add(a.SearchShadowSample != b.SearchShadowSample, "SEARCH_SHADOW_SAMPLE")
+	add(!reflect.DeepEqual(a.Experiments, b.Experiments), "EXPERIMENTS")
+	add(a.RegistrationApproval != b.RegistrationApproval, "REGISTRATION_APPROVAL")
+	add(a.RateLimitAuth != b.RateLimitAuth, "RATE_LIMIT_AUTH")
+	add(a.RateLimitAPI != b.RateLimitAPI, "RATE_LIMIT_API")
+	add(a.APIDailyQuota != b.APIDailyQuota, "API_DAILY_QUOTA")
+	add(!slices.Equal(a.TrustedProxies, b.TrustedProxies), "TRUSTED_PROXIES")
+	add(a.SlowQueryThreshold != b.SlowQueryThreshold, "SLOW_QUERY_THRESHOLD")
+	add(a.SlowQueryExplain != b.SlowQueryExplain, "SLOW_QUERY_EXPLAIN")
+	return changed
+}
+
+// ConfigReloadResponse lists the settings a reload changed.
+type ConfigReloadResponse struct {
+	Changed []string `json:"changed" example:"RATE_LIMIT_API,SEARCH_FTS"`
+}
+
+// AdminReloadConfigHandler godoc
+// @Summary      Reload runtime config
+// @Description  Re-reads CONFIG_FILE (under the environment) and ADMIN_IP_ACL_FILE and applies the settings that can change without a restart: search feature flags, experiments, registration approval, rate limits, the daily API quota, trusted proxies and slow query logging. Same as sending SIGHUP to this replica. An invalid config is rejected and the previous one stays in effect. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  ConfigReloadResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      422  {object}  APIErrorResponse
+// @Router       /admin/config/reload [post]
+func AdminReloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	changed, err := ReloadConfig()
+	if err != nil {
+		audit(r, "config.reload_failed", "config", 0, map[string]any{"error": err.Error()})
+		writeJSON(w, http.StatusUnprocessableEntity, APIErrorResponse{Error: "config reload failed: " + err.Error()})
+		return
+	}
+	if changed == nil {
+		changed = []string{}
+	}
+	audit(r, "config.reload", "config", 0, map[string]any{"changed": changed})
+	writeJSON(w, http.StatusOK, ConfigReloadResponse{Changed: changed})
+}
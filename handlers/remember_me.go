@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// "Remember me" logins: next to the session, a login with the remember box ticked gets a
+// persistent-login cookie "<selector>:<validator>". The selector finds the remember_tokens row,
+// which only stores a hash of the validator. When a request arrives without a session,
+// RememberMeMiddleware starts a new session from the cookie and rotates the validator, so a
+// stolen cookie stops working once the owner comes back. Tokens are revoked on logout, when
+// the password changes and whenever the account's session_version moves on (admin password
+// reset, status change).
+
+const rememberCookieName = "remember"
+
+// rememberTTL is set by SetRememberMeTTL.
+var rememberTTL = 30 * 24 * time.Hour
+
+// SetRememberMeTTL sets how long a remember-me cookie keeps a user logged in (REMEMBER_ME_TTL).
+func SetRememberMeTTL(d time.Duration) {
+	if d > 0 {
+		rememberTTL = d
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashValidator(validator string) string {
+	sum := sha256.Sum256([]byte(validator))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueRememberToken stores a new token for u and sets the remember cookie.
+func issueRememberToken(w http.ResponseWriter, r *http.Request, u User) error {
+	selector, err := randomHex(12)
+	if err != nil {
+		return err
+	}
+	validator, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	_, err = db.ExecContext(r.Context(), `
+INSERT INTO remember_tokens (user_id, selector, validator_hash, session_version, expires_at, created_at, last_used_at)
+VALUES ($1, $2, $3, $4, $5, $6, $6)`,
+		u.ID, selector, hashValidator(validator), u.SessionVersion, now.Add(rememberTTL), now,
+	)
+	if err != nil {
+		return err
+	}
+	setRememberCookie(w, r, selector+":"+validator, rememberTTL)
+	linkRememberToken(r, selector)
+	return nil
+}
+
+func setRememberCookie(w http.ResponseWriter, r *http.Request, value string, maxAge time.Duration) {
+	c := &http.Cookie{
+		Name:     rememberCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(publicURL(r), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge <= 0 {
+		c.MaxAge = -1
+	}
+	http.SetCookie(w, c)
+}
+
+// forgetRememberToken deletes the token of the request's remember cookie and clears the cookie.
+func forgetRememberToken(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(rememberCookieName)
+	if err != nil {
+		return
+	}
+	if selector, _, ok := strings.Cut(c.Value, ":"); ok && db != nil {
+		if _, err := db.ExecContext(r.Context(), `DELETE FROM remember_tokens WHERE selector = $1`, selector); err != nil {
+			log.Printf("remember token delete error: %v", err)
+		}
+	}
+	setRememberCookie(w, r, "", 0)
+}
+
+// revokeRememberTokens deletes all remember tokens of a user (password changed).
+func revokeRememberTokens(ctx context.Context, userID int) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM remember_tokens WHERE user_id = $1`, userID)
+	return err
+}
+
+// pruneRememberTokens deletes expired remember tokens.
+func pruneRememberTokens(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `DELETE FROM remember_tokens WHERE expires_at < $1`, time.Now().UTC())
+	return err
+}
+
+// RememberMeMiddleware logs in requests that carry a valid remember cookie but no session.
+// It must run before SessionGuardMiddleware.
+func RememberMeMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if db != nil && sessionStore != nil && !databaseDown() {
+				if c, err := r.Cookie(rememberCookieName); err == nil {
+					if _, loggedIn := currentUserID(r); !loggedIn {
+						restoreRememberedSession(w, r, c.Value)
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// restoreRememberedSession starts a session from a remember cookie value and rotates it.
+func restoreRememberedSession(w http.ResponseWriter, r *http.Request, value string) {
+	ctx := r.Context()
+	selector, validator, ok := strings.Cut(value, ":")
+	if !ok {
+		setRememberCookie(w, r, "", 0)
+		return
+	}
+
+	var (
+		tokenID      int64
+		storedHash   string
+		tokenVersion int
+		expiresAt    time.Time
+		status       string
+		mustReset    bool
+		u            User
+	)
+	err := db.QueryRowContext(ctx, `
+SELECT t.id, t.validator_hash, t.session_version, t.expires_at,
+       u.id, u.username, u.email, u.session_version, u.status, u.must_reset_password
+FROM remember_tokens t JOIN users u ON u.id = t.user_id
+WHERE t.selector = $1 AND u.deleted_at IS NULL`, selector,
+	).Scan(&tokenID, &storedHash, &tokenVersion, &expiresAt,
+		&u.ID, &u.Username, &u.Email, &u.SessionVersion, &status, &mustReset)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		setRememberCookie(w, r, "", 0)
+		return
+	case err != nil:
+		log.Printf("remember token lookup error: %v", err)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(hashValidator(validator)), []byte(storedHash)) != 1 {
+		// Most likely a parallel request that lost the rotation race; its browser already has
+		// the new cookie, so neither the token nor the cookie is touched.
+		return
+	}
+	if time.Now().After(expiresAt) || tokenVersion != u.SessionVersion || status != UserStatusActive || mustReset {
+		if _, err := db.ExecContext(ctx, `DELETE FROM remember_tokens WHERE id = $1`, tokenID); err != nil {
+			log.Printf("remember token delete error: %v", err)
+		}
+		setRememberCookie(w, r, "", 0)
+		return
+	}
+
+	next, err := randomHex(32)
+	if err != nil {
+		log.Printf("remember token rotate error: %v", err)
+		return
+	}
+	res, err := db.ExecContext(ctx, `
+UPDATE remember_tokens SET validator_hash = $1, last_used_at = $2 WHERE id = $3 AND validator_hash = $4`,
+		hashValidator(next), time.Now().UTC(), tokenID, storedHash,
+	)
+	if err != nil {
+		log.Printf("remember token rotate error: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return // rotated by a parallel request
+	}
+	if err := startSession(w, r, u); err != nil {
+		log.Printf("startSession error (remember me): %v", err)
+		return
+	}
+	linkRememberToken(r, selector)
+	setRememberCookie(w, r, selector+":"+next, time.Until(expiresAt))
+}
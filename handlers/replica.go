@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+)
+
+// Read-only queries (search, suggestions, click report) may go to a read replica (DATABASE_URL_RO).
+// Writes (auth, bookmarks, ingestion of external results, ...) always use the primary `db`.
+var (
+	replicaDB      *sql.DB
+	replicaHealthy atomic.Bool
+)
+
+// Pool labels used in the per-pool metrics.
+const (
+	poolPrimary = "primary"
+	poolReplica = "replica"
+)
+
+// replicaPingTimeout bounds the health probe run after a failed replica query.
+const replicaPingTimeout = 2 * time.Second
+
+// SetReadReplica routes read-only queries to ro (nil routes everything to the primary).
+// The replica starts out healthy; CheckReadReplica and failed queries update that.
+func SetReadReplica(ro *sql.DB) {
+	replicaDB = ro
+	replicaHealthy.Store(ro != nil)
+	setReplicaUp(ro != nil)
+}
+
+// CheckReadReplica pings the replica and marks it healthy or down.
+// While it is down, reads fall back to the primary. Run periodically by the check_read_replica task.
+func CheckReadReplica(ctx context.Context) error {
+	if replicaDB == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+	defer cancel()
+
+	err := replicaDB.PingContext(ctx)
+	markReplica(err == nil)
+	return err
+}
+
+// readDB returns the pool read-only queries should use: the replica while it is healthy, else the primary.
+func readDB() (*sql.DB, string) {
+	if replicaDB != nil && replicaHealthy.Load() {
+		return replicaDB, poolReplica
+	}
+	return db, poolPrimary
+}
+
+// queryRead runs a read-only query on the replica, falling back to the primary when the
+// replica turns out to be unreachable. Query errors on a reachable replica are returned as-is.
+func queryRead(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := withReadPool(ctx, func(pool *sql.DB) error {
+		var err error
+		rows, err = pool.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// withReadPool runs fn against the read pool and repeats it on the primary if the replica failed
+// because it is down. fn may run twice, so it must not have side effects beyond reading.
+func withReadPool(ctx context.Context, fn func(pool *sql.DB) error) error {
+	pool, name := readDB()
+	start := time.Now()
+	err := fn(pool)
+	metrics.DBQueryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	metrics.DBQueries.WithLabelValues(name, queryResult(err)).Inc()
+	if err == nil || name != poolReplica || ctx.Err() != nil {
+		return err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+	pingErr := replicaDB.PingContext(pingCtx)
+	cancel()
+	if pingErr == nil {
+		return err
+	}
+
+	log.Printf("read replica unavailable, falling back to primary: %v", pingErr)
+	markReplica(false)
+	metrics.DBReplicaFallbacks.Inc()
+
+	start = time.Now()
+	err = fn(db)
+	metrics.DBQueryDuration.WithLabelValues(poolPrimary).Observe(time.Since(start).Seconds())
+	metrics.DBQueries.WithLabelValues(poolPrimary, queryResult(err)).Inc()
+	return err
+}
+
+// markReplica records a health transition (logged once per change).
+func markReplica(healthy bool) {
+	if replicaHealthy.Swap(healthy) != healthy && healthy {
+		log.Println("read replica is back, routing reads to it again")
+	}
+	setReplicaUp(healthy)
+}
+
+func setReplicaUp(up bool) {
+	v := 0.0
+	if up {
+		v = 1
+	}
+	metrics.DBReplicaUp.Set(v)
+}
+
+func queryResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/lock"
+	"devops-valgfag/internal/metrics"
+)
+
+// Data retention. The anonymous search log (search_log) and the cached external results
+// (external_results) are kept for SEARCH_LOG_RETENTION and EXTERNAL_CACHE_RETENTION. The hourly
+// enforce_retention task deletes older rows in batches of retentionBatch, each its own
+// statement, so a large backlog never locks a table for long. Runs are recorded in
+// retention_runs, which is pruned the same way after retentionRunRetention; admins can list
+// them and start one with the admin endpoints. A run still queued or running after
+// retentionRunTimeout (its job lost, or the process killed mid-run) is marked failed, so it
+// does not block new runs.
+
+const (
+	defaultSearchLogRetention     = 7 * 24 * time.Hour
+	defaultExternalCacheRetention = 30 * 24 * time.Hour
+	// stats_rollup recomputes yesterday from the search log, so it is kept at least this long.
+	minSearchLogRetention = 2 * 24 * time.Hour
+
+	// Rows deleted per statement.
+	retentionBatch = 1000
+	// Runs listed by GET /admin/retention.
+	retentionListLimit = 20
+	// Finished runs are kept this long.
+	retentionRunRetention = 30 * 24 * time.Hour
+	// Queued or running runs older than this are considered abandoned.
+	retentionRunTimeout = time.Hour
+
+	retentionTriggerScheduled = "scheduled"
+	retentionTriggerAdmin     = "admin"
+)
+
+// RetentionConfig is how long each kind of data is kept (<= 0 = default).
+type RetentionConfig struct {
+	SearchLog     time.Duration // SEARCH_LOG_RETENTION
+	ExternalCache time.Duration // EXTERNAL_CACHE_RETENTION
+}
+
+// retention is set by SetRetention.
+var retention = RetentionConfig{
+	SearchLog:     defaultSearchLogRetention,
+	ExternalCache: defaultExternalCacheRetention,
+}
+
+// SetRetention sets how long the search log (at least two days) and the external result cache
+// are kept.
+func SetRetention(cfg RetentionConfig) {
+	if cfg.SearchLog <= 0 {
+		cfg.SearchLog = defaultSearchLogRetention
+	}
+	cfg.SearchLog = max(cfg.SearchLog, minSearchLogRetention)
+	if cfg.ExternalCache <= 0 {
+		cfg.ExternalCache = defaultExternalCacheRetention
+	}
+	retention = cfg
+}
+
+// retentionLockKey keeps retention runs from overlapping across replicas.
+var retentionLockKey = lock.Key("retention")
+
+// retentionMu stands in for the advisory lock on SQLite, which only runs as one process.
+var retentionMu sync.Mutex
+
+// RetentionRun is one row of retention_runs.
+type RetentionRun struct {
+	ID                     int64      `json:"id"`
+	Trigger                string     `json:"trigger" example:"scheduled"` // scheduled or admin
+	Status                 string     `json:"status" example:"done"`       // queued, running, done or failed
+	SearchLogDeleted       int64      `json:"search_log_deleted" example:"1200"`
+	ExternalResultsDeleted int64      `json:"external_results_deleted" example:"35"`
+	LastError              string     `json:"last_error,omitempty"`
+	CreatedAt              time.Time  `json:"created_at"`
+	StartedAt              *time.Time `json:"started_at,omitempty"`
+	FinishedAt             *time.Time `json:"finished_at,omitempty"`
+}
+
+// RetentionPayload is the payload of an enforce_retention job.
+type RetentionPayload struct {
+	RunID int64 `json:"run_id"`
+}
+
+// RetentionResponse is returned by GET /admin/retention.
+type RetentionResponse struct {
+	SearchLogRetention     string         `json:"search_log_retention" example:"168h0m0s"`
+	ExternalCacheRetention string         `json:"external_cache_retention" example:"720h0m0s"`
+	Runs                   []RetentionRun `json:"runs"`
+}
+
+// retentionPolicies are the tables enforce_retention prunes: the metric label and the statement
+// deleting one batch of rows older than $1 ($2 = batch size).
+var retentionPolicies = []struct {
+	table  string
+	maxAge func() time.Duration
+	delete string
+	cutoff func(t time.Time) any
+}{
+	{
+		table:  "search_log",
+		maxAge: func() time.Duration { return retention.SearchLog },
+		delete: `DELETE FROM search_log WHERE id IN (SELECT id FROM search_log WHERE day < $1 ORDER BY id LIMIT $2)`,
+		cutoff: func(t time.Time) any { return t.Format(time.DateOnly) },
+	},
+	{
+		table:  "external_results",
+		maxAge: func() time.Duration { return retention.ExternalCache },
+		delete: `DELETE FROM external_results WHERE id IN (SELECT id FROM external_results WHERE created_at < $1 ORDER BY id LIMIT $2)`,
+		cutoff: func(t time.Time) any { return t },
+	},
+	{
+		table:  "retention_runs",
+		maxAge: func() time.Duration { return retentionRunRetention },
+		delete: `DELETE FROM retention_runs WHERE id IN (SELECT id FROM retention_runs WHERE created_at < $1 AND status IN ('done', 'failed') ORDER BY id LIMIT $2)`,
+		cutoff: func(t time.Time) any { return t },
+	},
+}
+
+// purgeBatched runs a batched delete until a batch comes back short, returning the rows deleted.
+func purgeBatched(ctx context.Context, table, stmt string, cutoff any) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		res, err := db.ExecContext(ctx, stmt, cutoff, retentionBatch)
+		if err != nil {
+			return total, fmt.Errorf("purge %s: %w", table, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		metrics.RetentionPurged.WithLabelValues(table).Add(float64(n))
+		if n < retentionBatch {
+			return total, nil
+		}
+	}
+}
+
+// withRetentionLock runs fn unless another retention run holds the lock (lock.ErrNotAcquired).
+func withRetentionLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	if sqlDialect == dialect.SQLite {
+		if !retentionMu.TryLock() {
+			return lock.ErrNotAcquired
+		}
+		defer retentionMu.Unlock()
+		return fn(ctx)
+	}
+	return lock.TryWithLock(ctx, db, retentionLockKey, fn)
+}
+
+// expireRetentionRuns marks runs queued or running for longer than retentionRunTimeout failed.
+func expireRetentionRuns(ctx context.Context) error {
+	now := time.Now().UTC()
+	res, err := db.ExecContext(ctx, `
+UPDATE retention_runs SET status = 'failed', last_error = $2, finished_at = $3
+WHERE status IN ('queued', 'running') AND created_at < $1`,
+		now.Add(-retentionRunTimeout), "abandoned: not finished within "+retentionRunTimeout.String(), now)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		log.Printf("retention: marked %d abandoned run(s) failed", n)
+	}
+	return nil
+}
+
+// createRetentionRun records a queued run.
+func createRetentionRun(ctx context.Context, trigger string) (RetentionRun, error) {
+	run := RetentionRun{Trigger: trigger, Status: "queued", CreatedAt: time.Now().UTC()}
+	err := db.QueryRowContext(ctx,
+		`INSERT INTO retention_runs (trigger_source, created_at) VALUES ($1, $2) RETURNING id`,
+		trigger, run.CreatedAt,
+	).Scan(&run.ID)
+	return run, err
+}
+
+// executeRetentionRun prunes every table of retentionPolicies and records the outcome in the
+// run. A run that finds another one holding the lock fails without doing anything.
+func executeRetentionRun(ctx context.Context, runID int64) error {
+	err := withRetentionLock(ctx, func(ctx context.Context) error {
+		if _, err := db.ExecContext(ctx,
+			`UPDATE retention_runs SET status = 'running', started_at = $2 WHERE id = $1`,
+			runID, time.Now().UTC(),
+		); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		now := start.UTC()
+		deleted := map[string]int64{}
+		var runErr error
+		for _, p := range retentionPolicies {
+			n, err := purgeBatched(ctx, p.table, p.delete, p.cutoff(now.Add(-p.maxAge())))
+			deleted[p.table] = n
+			if err != nil {
+				runErr = err
+				break
+			}
+		}
+
+		status, lastErr := "done", sql.NullString{}
+		if runErr != nil {
+			status, lastErr = "failed", sql.NullString{String: runErr.Error(), Valid: true}
+		}
+		// Background: record the outcome even when ctx was cancelled mid-run.
+		if _, err := db.ExecContext(context.Background(), `
+UPDATE retention_runs
+SET status = $2, search_log_deleted = $3, external_results_deleted = $4, last_error = $5, finished_at = $6
+WHERE id = $1`,
+			runID, status, deleted["search_log"], deleted["external_results"], lastErr, time.Now().UTC(),
+		); err != nil && runErr == nil {
+			runErr = err
+		}
+		log.Printf("retention: run %d %s in %s (search_log=%d external_results=%d)",
+			runID, status, time.Since(start).Round(time.Millisecond), deleted["search_log"], deleted["external_results"])
+		return runErr
+	})
+	if errors.Is(err, lock.ErrNotAcquired) {
+		_, err = db.ExecContext(ctx, `
+UPDATE retention_runs SET status = 'failed', last_error = $2, finished_at = $3
+WHERE id = $1 AND status = 'queued'`, runID, "another retention run is in progress", time.Now().UTC())
+	}
+	return err
+}
+
+// enforceRetention is the enforce_retention task.
+func enforceRetention(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	if err := expireRetentionRuns(ctx); err != nil {
+		return err
+	}
+	run, err := createRetentionRun(ctx, retentionTriggerScheduled)
+	if err != nil {
+		return err
+	}
+	return executeRetentionRun(ctx, run.ID)
+}
+
+// runRetentionJob performs a retention run queued from the admin endpoint.
+func runRetentionJob(ctx context.Context, raw json.RawMessage) error {
+	var p RetentionPayload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	return executeRetentionRun(ctx, p.RunID)
+}
+
+// listRetentionRuns returns the newest runs first.
+func listRetentionRuns(ctx context.Context, limit int) ([]RetentionRun, error) {
+	runs := []RetentionRun{}
+	err := queryRows(ctx, `
+SELECT id, trigger_source, status, search_log_deleted, external_results_deleted, last_error, created_at, started_at, finished_at
+FROM retention_runs
+ORDER BY id DESC
+LIMIT $1`, []any{limit}, func(scan func(...any) error) error {
+		var (
+			run               RetentionRun
+			lastErr           sql.NullString
+			started, finished sql.NullTime
+		)
+		if err := scan(&run.ID, &run.Trigger, &run.Status, &run.SearchLogDeleted, &run.ExternalResultsDeleted,
+			&lastErr, &run.CreatedAt, &started, &finished); err != nil {
+			return err
+		}
+		run.LastError = lastErr.String
+		if started.Valid {
+			run.StartedAt = &started.Time
+		}
+		if finished.Valid {
+			run.FinishedAt = &finished.Time
+		}
+		runs = append(runs, run)
+		return nil
+	})
+	return runs, err
+}
+
+// AdminRetentionHandler godoc
+// @Summary      Data retention status
+// @Description  Returns the retention periods of the search log (SEARCH_LOG_RETENTION) and the external result cache (EXTERNAL_CACHE_RETENTION) and the newest retention runs with the rows they deleted. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  RetentionResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/retention [get]
+func AdminRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	runs, err := listRetentionRuns(r.Context(), retentionListLimit)
+	if err != nil {
+		reportError(r, "list retention runs error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, RetentionResponse{
+		SearchLogRetention:     retention.SearchLog.String(),
+		ExternalCacheRetention: retention.ExternalCache.String(),
+		Runs:                   runs,
+	})
+}
+
+// AdminRunRetentionHandler godoc
+// @Summary      Run data retention now
+// @Description  Queues a retention run (an enforce_retention job) that deletes search log rows and cached external results past their retention period in batches. Only one run is queued or running at a time; runs not finished within an hour are marked failed. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Success      202  {object}  RetentionRun
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /admin/retention/run [post]
+func AdminRunRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	if jobQueue == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "job queue not configured"})
+		return
+	}
+	ctx := r.Context()
+
+	if err := expireRetentionRuns(ctx); err != nil {
+		reportError(r, "expire retention runs error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not start retention run"})
+		return
+	}
+	var pending int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM retention_runs WHERE status IN ('queued', 'running')`,
+	).Scan(&pending); err != nil {
+		reportError(r, "retention runs lookup error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not start retention run"})
+		return
+	}
+	if pending > 0 {
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: "a retention run is already queued or running"})
+		return
+	}
+
+	run, err := createRetentionRun(ctx, retentionTriggerAdmin)
+	if err != nil {
+		reportError(r, "create retention run error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not start retention run"})
+		return
+	}
+	if _, err := jobQueue.Enqueue(ctx, JobEnforceRetention, RetentionPayload{RunID: run.ID}); err != nil {
+		reportError(r, "enqueue retention error", err)
+		if _, derr := db.ExecContext(ctx, `DELETE FROM retention_runs WHERE id = $1`, run.ID); derr != nil {
+			log.Println("delete retention run error:", derr)
+		}
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not start retention run"})
+		return
+	}
+
+	audit(r, "retention.start", "retention_run", int(run.ID), nil)
+	writeJSON(w, http.StatusAccepted, run)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// defaultRobotsDisallow keeps crawlers out of machine/ops endpoints.
+var defaultRobotsDisallow = []string{"/api/", "/admin/", "/swagger/"}
+
+// robotsPolicy is configured once at startup (see ConfigureRobots).
+var robotsPolicy = struct {
+	disallowAll bool
+	disallow    []string
+}{disallow: defaultRobotsDisallow}
+
+// ConfigureRobots sets the crawler policy served on /robots.txt.
+//
+// - disallowAll blocks every path (used for staging / non-prod environments).
+// - disallow overrides the default list; nil/empty keeps the defaults.
+func ConfigureRobots(disallowAll bool, disallow []string) {
+	robotsPolicy.disallowAll = disallowAll
+	robotsPolicy.disallow = defaultRobotsDisallow
+	if len(disallow) > 0 {
+		robotsPolicy.disallow = disallow
+	}
+}
+
+// RobotsHandler serves /robots.txt from the configured policy.
+// The sitemap location is advertised unless the whole site is disallowed.
+func RobotsHandler(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+
+	if robotsPolicy.disallowAll {
+		b.WriteString("Disallow: " + URL("/") + "\n")
+	} else {
+		for _, p := range robotsPolicy.disallow {
+			b.WriteString("Disallow: " + URL(p) + "\n")
+		}
+		b.WriteString("\nSitemap: " + publicURL(r) + "/sitemap.xml\n")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	// Avoid writing a body for HEAD requests.
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxSavedSearchesPerUser = 50
+	maxSavedSearchNameLen   = 100
+)
+
+// SavedSearch is a named query+language a user wants to follow, in the tenant it was saved in.
+// ShareURL opens the same search for anyone (no login needed).
+type SavedSearch struct {
+	ID        int64      `json:"id" example:"1"`
+	Name      string     `json:"name" example:"Go news"`
+	Query     string     `json:"query" example:"golang"`
+	Language  string     `json:"language" example:"en"`
+	ShareURL  string     `json:"share_url" example:"/s/3f2a9c0d1e4b5a6f"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// SavedSearchRequest is the body accepted by POST /api/me/saved-searches.
+type SavedSearchRequest struct {
+	Name     string `json:"name" example:"Go news"`
+	Query    string `json:"query" example:"golang"`
+	Language string `json:"language,omitempty" example:"en"`
+}
+
+// APISavedSearchesResponse is returned by GET /api/me/saved-searches.
+type APISavedSearchesResponse struct {
+	SavedSearches []SavedSearch `json:"saved_searches"`
+}
+
+// APICreateSavedSearchHandler godoc
+// @Summary      Save a search
+// @Description  Saves a query+language under a name in the request's tenant. The search is re-run periodically and the user is notified (in-app) when new pages of that tenant match. Requires session auth.
+// @Tags         Saved searches
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  SavedSearchRequest  true  "Search to save"
+// @Success      201  {object}  SavedSearch
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/saved-searches [post]
+func APICreateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req SavedSearchRequest
+	if !decodeJSONBody(w, r, 4096, &req) {
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	query := strings.TrimSpace(req.Query)
+	lang := req.Language
+	if lang == "" {
+		lang = "en"
+	}
+	switch {
+	case name == "" || query == "":
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "name and query are required"})
+		return
+	case len(name) > maxSavedSearchNameLen:
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "name is too long (max 100)"})
+		return
+	case lang != "en" && lang != "da":
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "language must be one of: en, da"})
+		return
+	}
+
+	ctx := r.Context()
+	var count, dup int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(CASE WHEN name = $2 THEN 1 ELSE 0 END), 0) FROM saved_searches WHERE user_id = $1`,
+		userID, name,
+	).Scan(&count, &dup)
+	if err != nil {
+		reportError(r, "saved search count error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	if dup > 0 {
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: "a saved search with this name already exists"})
+		return
+	}
+	if count >= maxSavedSearchesPerUser {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "saved search limit reached (max 50)"})
+		return
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		reportError(r, "share token error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "internal error"})
+		return
+	}
+
+	// Only pages added after saving count as "new", so start from the tenant's current max page id.
+	_, err = db.ExecContext(ctx, `
+INSERT INTO saved_searches (user_id, name, query, language, share_token, tenant_id, last_seen_page_id)
+VALUES ($1, $2, $3, $4, $5, $6, (SELECT COALESCE(MAX(id), 0) FROM pages WHERE tenant_id = $6))`,
+		userID, name, query, lang, token, tenantID(ctx),
+	)
+	if err != nil {
+		reportError(r, "create saved search error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save search"})
+		return
+	}
+
+	list, err := querySavedSearches(ctx, `WHERE share_token = $1`, token)
+	if err != nil || len(list) == 0 {
+		reportError(r, "saved search reload error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, list[0])
+}
+
+// APIListSavedSearchesHandler godoc
+// @Summary      List saved searches
+// @Description  Returns the current user's saved searches. Requires session auth.
+// @Tags         Saved searches
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  APISavedSearchesResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/saved-searches [get]
+func APIListSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := querySavedSearches(r.Context(), `WHERE user_id = $1 ORDER BY name`, userID)
+	if err != nil {
+		reportError(r, "list saved searches error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APISavedSearchesResponse{SavedSearches: list})
+}
+
+// APIDeleteSavedSearchHandler godoc
+// @Summary      Delete saved search
+// @Description  Removes one of the current user's saved searches (its share link stops working). Requires session auth.
+// @Tags         Saved searches
+// @Security     sessionAuth
+// @Param        id  path  int  true  "Saved search ID"
+// @Success      204
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/saved-searches/{id} [delete]
+func APIDeleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "saved search not found"})
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), `DELETE FROM saved_searches WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		reportError(r, "delete saved search error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete saved search"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "saved search not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SharedSearchHandler resolves a share link (/s/{token}) to the search page.
+func SharedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		http.Error(w, "database not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var query, lang string
+	var tenant int
+	err := db.QueryRowContext(r.Context(),
+		`SELECT query, language, tenant_id FROM saved_searches WHERE share_token = $1`,
+		mux.Vars(r)["token"],
+	).Scan(&query, &lang, &tenant)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		reportError(r, "shared search lookup error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	path, err := tenantSearchPath(r.Context(), tenant, query, lang)
+	if err != nil {
+		reportError(r, "shared search tenant error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	redirect(w, r, path, http.StatusFound)
+}
+
+// RunSavedSearches checks every saved search for pages added to its tenant since its last
+// run and creates one in-app notification per search with new matches.
+// It returns the number of notifications created.
+func RunSavedSearches(ctx context.Context) (int, error) {
+	// Load everything first: no open cursor while writing below.
+	type pending struct {
+		id, userID, lastSeen, maxPageID int64
+		tenant                          int
+		name, query, lang               string
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT s.id, s.user_id, s.tenant_id, s.last_seen_page_id, m.max_id, s.name, s.query, s.language
+FROM saved_searches s
+JOIN (SELECT tenant_id, MAX(id) AS max_id FROM pages GROUP BY tenant_id) m ON m.tenant_id = s.tenant_id
+WHERE s.last_seen_page_id < m.max_id`)
+	if err != nil {
+		return 0, err
+	}
+	var due []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.userID, &p.tenant, &p.lastSeen, &p.maxPageID, &p.name, &p.query, &p.lang); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		due = append(due, p)
+	}
+	if err := rows.Close(); err != nil {
+		log.Println(rowsCloseErrMsg, err)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, p := range due {
+		// LOWER(...) LIKE keeps this portable (SQLite in tests) and matches like the ILIKE fallback.
+		var matches int
+		err := db.QueryRowContext(ctx, `
+SELECT COUNT(*) FROM pages
+WHERE tenant_id = $1
+  AND language = $2
+  AND id > $3
+  AND id <= $4
+  AND deleted_at IS NULL
+  AND (LOWER(title) LIKE $5 ESCAPE '\' OR LOWER(content) LIKE $5 ESCAPE '\')`,
+			p.tenant, p.lang, p.lastSeen, p.maxPageID, "%"+escapeLike(strings.ToLower(p.query))+"%",
+		).Scan(&matches)
+		if err != nil {
+			return created, err
+		}
+
+		if matches > 0 {
+			msg := fmt.Sprintf("%d new result(s) for your saved search %q", matches, p.name)
+			link, err := tenantSearchPath(ctx, p.tenant, p.query, p.lang)
+			if err != nil {
+				return created, err
+			}
+			if err := createNotification(ctx, p.userID, msg, link); err != nil {
+				return created, err
+			}
+			created++
+		}
+
+		_, err = db.ExecContext(ctx,
+			`UPDATE saved_searches SET last_seen_page_id = $1, last_run_at = CURRENT_TIMESTAMP WHERE id = $2`,
+			p.maxPageID, p.id,
+		)
+		if err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+func querySavedSearches(ctx context.Context, where string, args ...any) ([]SavedSearch, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, name, query, language, share_token, last_run_at, created_at FROM saved_searches `+where,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	out := []SavedSearch{}
+	for rows.Next() {
+		var s SavedSearch
+		var token string
+		var lastRun sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Name, &s.Query, &s.Language, &token, &lastRun, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		s.ShareURL = "/s/" + token
+		if lastRun.Valid {
+			s.LastRunAt = &lastRun.Time
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func searchPath(query, lang string) string {
+	return "/search?" + url.Values{"q": {query}, "language": {lang}}.Encode()
+}
+
+// tenantSearchPath is searchPath in a tenant: other tenants than the default get their
+// /t/<slug> prefix, so the link opens the corpus the search was saved in.
+func tenantSearchPath(ctx context.Context, tenant int, query, lang string) (string, error) {
+	if tenant == defaultTenantID {
+		return searchPath(query, lang), nil
+	}
+	t, err := loadTenant(ctx, tenant)
+	if err != nil {
+		return "", err
+	}
+	return tenantPathPrefix + t.Slug + searchPath(query, lang), nil
+}
+
+// newShareToken returns an unguessable token for share links.
+func newShareToken() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
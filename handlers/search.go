@@ -3,17 +3,29 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
+	"unicode"
 
+	"devops-valgfag/internal/cache"
 	dbx "devops-valgfag/internal/db"
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/experiments"
+	"devops-valgfag/internal/i18n"
+	"devops-valgfag/internal/lock"
 	"devops-valgfag/internal/metrics"
 	"devops-valgfag/internal/scraper"
-
-	"github.com/prometheus/client_golang/prometheus"
+	"devops-valgfag/internal/searchmerge"
+	"devops-valgfag/internal/service"
+	"devops-valgfag/internal/snippet"
 )
 
 // Feature flags toggled at startup (typically from env vars in main).
@@ -21,6 +33,15 @@ import (
 var useFTSSearch atomic.Bool    // Prefer PostgreSQL FTS over ILIKE when enabled.
 var externalEnabled atomic.Bool // Allow optional Wikipedia enrichment (disabled in tests/CI for determinism).
 
+// mergePolicy decides where external results go among local ones (see SetSearchMerge).
+var mergePolicy atomic.Pointer[searchmerge.Policy]
+
+// searchCache holds recent results keyed by language/limit/query (see SetSearchCache); nil disables it.
+var (
+	searchCache    cache.Cache
+	searchCacheTTL time.Duration
+)
+
 func init() {
 	// Default behavior: allow external enrichment.
 	// Tests/CI can disable this with EnableExternalSearch(false).
@@ -29,20 +50,29 @@ func init() {
 
 const (
 	// UI vs API limits: UI is for humans (more results), API is for machines (smaller payload).
+	// pageLimit is the UI default; users can change it via their display preferences.
 	pageLimit = 50
 	apiLimit  = 10
 
 	// Upper bound on search execution time (primarily DB calls via QueryContext).
 	requestTimeout = 2 * time.Second
 
-	// Max length of snippet text returned per result.
-	snippetLen = 200
+	// Length of the snippet text returned per result, in runes; clients can pick another
+	// length within the bounds with ?snippet_length=.
+	snippetLen    = service.DefaultSnippetLength
+	snippetMinLen = 50
+	snippetMaxLen = 500
 
 	rowsCloseErrMsg = "rows.Close error:"
+
+	// Relevance feedback term in the FTS ranking (see queryFTS).
+	// ts_rank values are typically 0-0.1, so the vote term is capped at +/-0.05.
+	feedbackWeight  = 0.05
+	feedbackDamping = 10.0
 )
 
 // EnableFTSSearch toggles PostgreSQL full-text search (FTS) usage.
-// When enabled, queryLocal() tries FTS first and falls back to ILIKE if needed.
+// When enabled, queryLocal() tries FTS first (queryPages) and falls back to ILIKE if needed.
 func EnableFTSSearch(on bool) {
 	useFTSSearch.Store(on)
 }
@@ -54,14 +84,7 @@ func EnableExternalSearch(on bool) {
 }
 
 // SearchResult is the normalized result shape used by both UI and API.
-// Local DB results use a real ID; external cached results set ID=0.
-type SearchResult struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	URL         string `json:"url"`
-	Language    string `json:"language"`
-	Description string `json:"description"` // Snippet (local content or external snippet)
-}
+type SearchResult = service.SearchResult
 
 // APISearchResponse is the stable JSON contract returned by /api/search.
 type APISearchResponse struct {
@@ -76,7 +99,7 @@ func HomePageHandler(w http.ResponseWriter, r *http.Request) {
 		if raw := r.URL.RawQuery; raw != "" {
 			target += "?" + raw
 		}
-		http.Redirect(w, r, target, http.StatusFound)
+		redirect(w, r, target, http.StatusFound)
 		return
 	}
 
@@ -85,6 +108,7 @@ func HomePageHandler(w http.ResponseWriter, r *http.Request) {
 		"Title":   "Home",
 		"Query":   "",
 		"Results": []SearchResult{},
+		"Tags":    loadTagCloud(r, getLanguage(r)),
 	})
 }
 
@@ -92,31 +116,102 @@ func HomePageHandler(w http.ResponseWriter, r *http.Request) {
 // WEB PAGE SEARCH HANDLER
 // -----------------------------------------------------------------------------
 
-// SearchPageHandler serves HTML search results for the web UI.
+// SearchPageHandler serves search results for the web UI.
 // It allows optional external enrichment to improve user experience.
+//
+// Representations:
+//   - full HTML page (default)
+//   - results fragment only for HX-Request / ?partial=1 (no full page reload)
+//   - JSON (same shape as /api/search) for ?format=json or Accept: application/json
 func SearchPageHandler(w http.ResponseWriter, r *http.Request) {
 	// Defensive check: avoid nil pointer panics if DB wiring/configuration fails.
 	if db == nil {
 		http.Error(w, "database not configured", http.StatusInternalServerError)
 		return
 	}
+	r = withExperiments(w, r)
 
 	q := r.URL.Query().Get("q")
+	tag := tagSlug(r.URL.Query().Get("tag"))
+	snippetLength := parseSnippetLength(r)
+
+	// Display preferences decide the default language and how many results to show.
+	prefs := loadPreferences(r)
 	lang := getLanguage(r)
 
-	// Shared search pipeline (UI settings: pageLimit + includeExternal).
-	results := runSearch(r, q, lang, pageLimit, true)
+	// Shared search pipeline (UI settings: preferred page size + includeExternal).
+	results := runTaggedSearch(r.Context(), q, lang, tag, prefs.ResultsPerPage, snippetLength, true)
+	unavailable := (strings.TrimSpace(q) != "" || tag != "") && searchUnavailable(results)
 
 	// Used for calculating "hit rate" (searches that return at least one result).
 	if len(results) > 0 {
 		metrics.SearchWithResult.Inc()
 	}
 
-	renderTemplate(w, r, "search", map[string]any{
-		"Title":   "Search",
-		"Query":   q,
-		"Results": results,
-	})
+	// Star toggle state for logged-in users (URL -> bookmark ID).
+	bookmarked := map[string]int64{}
+	if userID, ok := currentUserID(r); ok && len(results) > 0 && !databaseDown() {
+		bookmarked = bookmarkedURLs(r.Context(), userID)
+	}
+
+	// The same URL serves three representations, so caches must key on the selectors.
+	w.Header().Add("Vary", "HX-Request, Accept")
+
+	if unavailable {
+		writeSearchUnavailableHeaders(w)
+		if wantsJSON(r) {
+			writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: errSearchUnavailableMsg})
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	switch {
+	case wantsJSON(r):
+		writeJSON(w, http.StatusOK, APISearchResponse{SearchResults: results})
+	case wantsPartial(r):
+		// Results fragment only (htmx-style incremental update).
+		renderTemplate(w, r, "search-results", map[string]any{
+			"Query":       q,
+			"Language":    lang,
+			"Tag":         tag,
+			"Results":     results,
+			"Bookmarked":  bookmarked,
+			"Prefs":       prefs,
+			"Unavailable": unavailable,
+			"Degraded":    databaseDown(),
+		})
+	default:
+		renderTemplate(w, r, "search", map[string]any{
+			"Title":       "Search",
+			"Query":       q,
+			"Language":    lang,
+			"Tag":         tag,
+			"Tags":        loadTagCloud(r, lang),
+			"Results":     results,
+			"Bookmarked":  bookmarked,
+			"Prefs":       prefs,
+			"Unavailable": unavailable,
+			"Degraded":    databaseDown(),
+		})
+	}
+}
+
+// wantsPartial reports whether the client asked for just the results fragment:
+// htmx sends "HX-Request: true"; plain links can use ?partial=1.
+func wantsPartial(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" || r.URL.Query().Get("partial") == "1"
+}
+
+// wantsJSON reports whether the client asked for JSON (?format=json, or an Accept
+// header that prefers application/json over HTML).
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
 }
 
 // -----------------------------------------------------------------------------
@@ -129,8 +224,11 @@ func SearchPageHandler(w http.ResponseWriter, r *http.Request) {
 // @Tags         Search
 // @Produce      json
 // @Param        q          query  string  false  "Search query"
-// @Param        language   query  string  false  "Language code (default en)"
+// @Param        language   query  string  false  "Language code, en or da (default: lang cookie, saved preference, Accept-Language, then en)"
+// @Param        tag        query  string  false  "Only pages with this tag (slug); without q, lists the tagged pages"
+// @Param        snippet_length  query  int   false  "Snippet length in characters (50-500, default 200)"
 // @Success      200  {object}  APISearchResponse  "Search results"
+// @Failure      503  {object}  APIErrorResponse   "Search temporarily unavailable (database down, nothing cached)"
 // @Router       /api/search [get]
 func APISearchHandler(w http.ResponseWriter, r *http.Request) {
 	if db == nil {
@@ -143,12 +241,19 @@ func APISearchHandler(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
 		return
 	}
+	r = withExperiments(w, r)
 
 	q := r.URL.Query().Get("q")
+	tag := tagSlug(r.URL.Query().Get("tag"))
 	lang := getLanguage(r)
 
 	// API settings: smaller limit + no external enrichment for predictability and stability.
-	results := runSearch(r, q, lang, apiLimit, false)
+	results := runTaggedSearch(r.Context(), q, lang, tag, apiLimit, parseSnippetLength(r), false)
+	if (strings.TrimSpace(q) != "" || tag != "") && searchUnavailable(results) {
+		writeSearchUnavailableHeaders(w)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": errSearchUnavailableMsg})
+		return
+	}
 
 	if len(results) > 0 {
 		metrics.SearchWithResult.Inc()
@@ -161,7 +266,7 @@ func APISearchHandler(w http.ResponseWriter, r *http.Request) {
 // Shared search runner (metrics + timeout + best-effort behavior)
 // -----------------------------------------------------------------------------
 
-// runSearch is the shared search pipeline used by both UI and API.
+// runSearch is the shared search pipeline used by the UI, REST API and GraphQL API.
 // It handles:
 //   - input sanitization
 //   - metrics (count + latency)
@@ -169,109 +274,450 @@ func APISearchHandler(w http.ResponseWriter, r *http.Request) {
 //   - local DB search (FTS preferred, ILIKE fallback)
 //   - optional external enrichment
 //   - final result capping for predictable response sizes
-func runSearch(r *http.Request, q, lang string, limit int, includeExternal bool) []SearchResult {
-	q = strings.TrimSpace(q)
-	if q == "" {
-		return []SearchResult{}
-	}
+func runSearch(ctx context.Context, q, lang string, limit int, includeExternal bool) []SearchResult {
+	return runTaggedSearch(ctx, q, lang, "", limit, snippetLen, includeExternal)
+}
 
-	metrics.SearchTotal.Inc()
-	timer := prometheus.NewTimer(metrics.SearchLatency)
-	defer timer.ObserveDuration()
+// runTaggedSearch is runSearch restricted to pages carrying tag (a slug; "" for no filter),
+// with snippets of snippetLength runes (see service.SearchService.Search).
+// Every search with a query is recorded for the anonymous usage statistics (logSearch).
+func runTaggedSearch(ctx context.Context, q, lang, tag string, limit, snippetLength int, includeExternal bool) []SearchResult {
+	return searcher.Search(ctx, service.SearchQuery{
+		Query:           q,
+		Language:        lang,
+		Tag:             tag,
+		Limit:           limit,
+		SnippetLength:   snippetLength,
+		IncludeExternal: includeExternal,
+	})
+}
 
-	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
-	defer cancel()
+// searcher runs every search; searchBackend and searchCacheStore connect it to the database,
+// Wikipedia and the search cache.
+var searcher service.Searcher = &service.SearchService{
+	Backend: searchBackend{},
+	Cache:   searchCacheStore{},
+	Timeout: requestTimeout,
+}
 
-	local, err := queryLocal(ctx, q, lang, limit)
-	if err != nil {
-		log.Println("search local error:", err)
-		local = []SearchResult{}
+type searchBackend struct{}
+
+func (searchBackend) Local(ctx context.Context, q service.SearchQuery) ([]SearchResult, error) {
+	return queryLocal(ctx, q.Query, q.Language, q.Tag, q.Limit, q.SnippetLength)
+}
+
+func (searchBackend) External(ctx context.Context, q service.SearchQuery) []SearchResult {
+	return loadExternalBestEffort(ctx, tenantID(ctx), q.Query, q.Language)
+}
+
+func (searchBackend) ExternalEnabled() bool { return externalEnabled.Load() }
+
+func (searchBackend) MergePolicy(ctx context.Context) searchmerge.Policy {
+	return experimentMergePolicy(ctx)
+}
+
+func (searchBackend) CacheScope(ctx context.Context) string {
+	var scope string
+	if assignment := experiments.FromContext(ctx); len(assignment) > 0 {
+		// Variants rank and merge differently, so they must not share cached results.
+		scope = "exp[" + assignment.String() + "]:"
+	}
+	if tid := tenantID(ctx); tid != defaultTenantID {
+		scope += fmt.Sprintf("tenant[%d]:", tid)
 	}
+	return scope
+}
+
+func (searchBackend) Degraded() bool { return databaseDown() }
+
+func (searchBackend) QueryFailed(ctx context.Context, err error) {
+	log.Println("search local error:", err)
+	noteQueryError(ctx, err)
+}
+
+func (searchBackend) LogSearch(ctx context.Context, q, lang string, results int) {
+	logSearch(ctx, q, lang, results)
+}
+
+// searchCacheStore is the service.SearchCache over searchCache (see SetSearchCache).
+type searchCacheStore struct{}
+
+func (searchCacheStore) Get(ctx context.Context, key string) ([]SearchResult, bool, bool) {
+	return cachedSearch(ctx, key)
+}
+
+func (searchCacheStore) Set(ctx context.Context, key string, results []SearchResult) {
+	storeSearch(ctx, key, results)
+}
+
+// SetSearchMerge configures how external results are merged with local ones. The zero
+// Policy only lets them fill the slots local results leave free.
+func SetSearchMerge(p searchmerge.Policy) {
+	mergePolicy.Store(&p)
+}
 
-	// Optional enrichment: only for UI and only if enabled.
-	if includeExternal && externalEnabled.Load() {
-		ext := loadExternalBestEffort(q, lang)
-		local = append(local, ext...)
+// SetSearchCache enables caching of search results for ttl (in-memory or Redis, see main.go).
+// A nil cache or ttl <= 0 disables it.
+func SetSearchCache(c cache.Cache, ttl time.Duration) {
+	if ttl <= 0 {
+		c = nil
 	}
+	searchCache, searchCacheTTL = c, ttl
+}
+
+// cachedSearchEntry is the cached form of a search. Entries are fresh until FreshUntil and
+// kept for searchStaleTTL longer, to be served while the database is down.
+type cachedSearchEntry struct {
+	FreshUntil time.Time      `json:"fresh_until"`
+	Results    []cachedResult `json:"results"`
+}
+
+// cachedResult also keeps the highlighted snippet, which SearchResult leaves out of its JSON.
+type cachedResult struct {
+	SearchResult
+	DescriptionHTML string `json:"description_html,omitempty"`
+}
 
-	// Enforce final cap (external results should not expand response beyond the configured limit).
-	if len(local) > limit {
-		local = local[:limit]
+// cachedSearch returns the cached results for key and whether they are still fresh.
+// Only fresh entries count as cache hits.
+func cachedSearch(ctx context.Context, key string) (results []SearchResult, fresh, ok bool) {
+	if searchCache == nil {
+		return nil, false, false
+	}
+	data, ok, err := searchCache.Get(ctx, key)
+	if err != nil {
+		log.Println("search cache get error:", err)
+		metrics.CacheRequests.WithLabelValues("search", "error").Inc()
+		return nil, false, false
+	}
+	var entry cachedSearchEntry
+	if !ok || json.Unmarshal(data, &entry) != nil {
+		metrics.CacheRequests.WithLabelValues("search", "miss").Inc()
+		return nil, false, false
+	}
+	results = make([]SearchResult, len(entry.Results))
+	for i, c := range entry.Results {
+		results[i] = c.SearchResult
+		if c.DescriptionHTML != "" {
+			// Sanitized again: the cache (Redis) is outside the process.
+			results[i].DescriptionHTML = template.HTML(scraper.SanitizeSnippet(c.DescriptionHTML))
+		}
+	}
+	if time.Now().After(entry.FreshUntil) {
+		metrics.CacheRequests.WithLabelValues("search", "miss").Inc()
+		return results, false, true
 	}
+	metrics.CacheRequests.WithLabelValues("search", "hit").Inc()
+	return results, true, true
+}
 
-	return local
+func storeSearch(ctx context.Context, key string, results []SearchResult) {
+	if searchCache == nil {
+		return
+	}
+	entry := cachedSearchEntry{FreshUntil: time.Now().Add(searchCacheTTL), Results: make([]cachedResult, len(results))}
+	for i, r := range results {
+		entry.Results[i] = cachedResult{SearchResult: r, DescriptionHTML: string(r.DescriptionHTML)}
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := searchCache.Set(ctx, key, data, searchCacheTTL+searchStaleTTL); err != nil {
+		log.Println("search cache set error:", err)
+	}
 }
 
 // -----------------------------------------------------------------------------
 // Local DB search (FTS preferred + fallback)
 // -----------------------------------------------------------------------------
 
-// queryLocal performs the local DB search.
+// queryLocal performs the local DB search in the context's tenant, restricted to pages tagged
+// tag unless it is "".
 // If FTS is enabled, it tries FTS first and falls back to ILIKE if we get a FTS error.
-func queryLocal(ctx context.Context, q, lang string, limit int) ([]SearchResult, error) {
+// A canceled or timed-out FTS query is not retried: the (slower) ILIKE scan would not do better.
+// Without a query it lists the pages carrying tag.
+// Snippets are at most snippetLength runes and show the text around the match.
+// Slots the pages leave free go to matching cached external results (queryExternalCache),
+// unless results are restricted to a tag.
+func queryLocal(ctx context.Context, q, lang, tag string, limit, snippetLength int) ([]SearchResult, error) {
+	if q == "" {
+		return queryTagged(ctx, lang, tag, limit, snippetLength)
+	}
+	res, err := queryPages(ctx, q, lang, tag, limit, snippetLength)
+	if err != nil || tag != "" || len(res) >= limit {
+		return res, err
+	}
+	cached, err := queryExternalCache(ctx, q, lang, limit-len(res), res)
+	if err != nil {
+		if isQueryCanceled(ctx, err) {
+			return res, err
+		}
+		log.Println("external cache search error:", err)
+	}
+	return append(res, cached...), nil
+}
+
+// queryPages searches the pages: FTS first if enabled, falling back to ILIKE if we get a FTS error.
+// With shadow traffic on (SetSearchShadow), the path that answered is compared with the
+// alternate one in the background.
+func queryPages(ctx context.Context, q, lang, tag string, limit, snippetLength int) ([]SearchResult, error) {
+	sq := service.SearchQuery{Query: q, Language: lang, Tag: tag, Limit: limit, SnippetLength: snippetLength}
 	if useFTSSearch.Load() {
-		res, err := queryFTS(ctx, q, lang, limit)
-		if err == nil {
-			return res, nil
+		path, start := pageSearch{fts: true, ranking: ftsRanking(ctx)}, time.Now()
+		res, err := path.run(ctx, sq)
+		if err == nil || isQueryCanceled(ctx, err) {
+			shadowSearch(ctx, sq, path, res, err, time.Since(start))
+			return res, err
 		}
 		log.Println("FTS search error, falling back to ILIKE:", err)
 	}
-	return queryILIKE(ctx, q, lang, limit)
+	path, start := pageSearch{}, time.Now()
+	res, err := path.run(ctx, sq)
+	shadowSearch(ctx, sq, path, res, err, time.Since(start))
+	return res, err
+}
+
+// ftsRanking is the visitor's variant of the search_ranking experiment (rankingV1 outside it).
+func ftsRanking(ctx context.Context) string {
+	if experiments.VariantOf(ctx, ExperimentSearchRanking) == rankingV2 {
+		return rankingV2
+	}
+	return rankingV1
+}
+
+// parseSnippetLength reads ?snippet_length=, clamped to the allowed range (default snippetLen).
+func parseSnippetLength(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("snippet_length"))
+	if err != nil {
+		return snippetLen
+	}
+	return min(max(n, snippetMinLen), snippetMaxLen)
+}
+
+// headlineOptions are the ts_headline options for snippets of about n runes: a single
+// fragment, without highlight markers (snippets are plain text).
+func headlineOptions(n int) string {
+	words := max(n/6, 4)
+	return fmt.Sprintf(`MaxWords=%d, MinWords=%d, StartSel="", StopSel=""`, words, words/2)
+}
+
+// trimSnippets cuts the fetched snippets down to n runes, around the first match of q.
+func trimSnippets(results []SearchResult, q string, n int) {
+	for i := range results {
+		results[i].Description = snippet.Around(results[i].Description, q, n)
+	}
 }
 
 // queryFTS performs ranked PostgreSQL full-text search against pages.content_tsv.
 // NOTE: 'simple' config matches the migration that builds content_tsv using to_tsvector('simple', ...).
-func queryFTS(ctx context.Context, q, lang string, limit int) ([]SearchResult, error) {
-	const sqlFTS = `
-WITH qq AS (SELECT plainto_tsquery('simple', $2) AS query)
-SELECT id, title, url, language, LEFT(content, $3) AS snippet
-FROM pages, qq
-WHERE language = $1
-  AND content_tsv @@ qq.query
-ORDER BY ts_rank(content_tsv, qq.query) DESC, id DESC
-LIMIT $4;`
+//
+// Relevance feedback: the net vote score from result_votes adds a bounded term,
+// feedbackWeight * score / (|score| + feedbackDamping), so votes can reorder close
+// matches but never outweigh a much better text match.
+//
+// The text match is ranked with ts_rank (rankingV1), or with ts_rank_cd (rankingV2: cover
+// density, which rewards query words close together); see ftsRanking.
+//
+// Snippets come from ts_headline, which picks the passage that best covers the query. It
+// parses the whole document, so it only runs on the LIMITed hits.
+//
+// On SQLite the FTS5 index is used instead (see sqlFTSSQLite); it has a single ranking.
+func queryFTS(ctx context.Context, ranking, q, lang, tag string, limit, snippetLength int) ([]SearchResult, error) {
+	query, args := ftsStatement(ctx, ranking, q, lang, tag, limit, snippetLength)
+	if query == "" {
+		return []SearchResult{}, nil
+	}
 
-	rows, err := db.QueryContext(ctx, sqlFTS, lang, q, snippetLen, limit)
-	if err != nil {
-		return nil, err
+	var out []SearchResult
+	err := querySearch(ctx, func(rows *sql.Rows) (err error) {
+		out, err = scanRows(rows, lang, limit)
+		return err
+	}, query, args...)
+	trimSnippets(out, q, snippetLength)
+	return out, err
+}
+
+// ftsStatement is the SQL statement and arguments queryFTS runs. The statement is "" when q
+// has no words to match (SQLite, where an empty FTS5 query is an error).
+func ftsStatement(ctx context.Context, ranking, q, lang, tag string, limit, snippetLength int) (string, []any) {
+	sqlFTS := sqlFTSRank
+	if ranking == rankingV2 {
+		sqlFTS = sqlFTSRankCD
+	}
+	args := []any{lang, q, headlineOptions(snippetLength), limit, feedbackWeight, feedbackDamping, tag, tenantID(ctx)}
+	if sqlDialect == dialect.SQLite {
+		match := ftsMatch(q)
+		if match == "" {
+			return "", nil
+		}
+		sqlFTS = sqlFTSSQLite
+		args[1], args[2] = match, min(max(snippetLength/6, 4), 64)
 	}
-	return scanRows(rows)
+	return sqlFTS, args
 }
 
+// ftsMatch turns q into an FTS5 query matching all of its words, like plainto_tsquery:
+// each word is quoted, so FTS5 operators and punctuation in q are taken literally.
+func ftsMatch(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// sqlFTSTemplate is the FTS query with its ranking function left as %[1]s.
+const sqlFTSTemplate = `
+WITH qq AS (SELECT plainto_tsquery('simple', f_unaccent($2)) AS query),
+     fb AS (SELECT page_id, SUM(vote) AS score FROM result_votes GROUP BY page_id),
+     hits AS (
+       SELECT p.id, p.title, p.url, p.content,
+              %[1]s(p.content_tsv, qq.query)
+              + $5::float8 * COALESCE(fb.score, 0) / (ABS(COALESCE(fb.score, 0)) + $6::float8) AS score
+       FROM pages p
+       CROSS JOIN qq
+       LEFT JOIN fb ON fb.page_id = p.id
+       WHERE p.language = $1
+         AND p.tenant_id = $8
+         AND p.deleted_at IS NULL
+         AND p.content_tsv @@ qq.query
+         AND ($7::text = '' OR EXISTS (
+               SELECT 1 FROM page_tags pt JOIN tags t ON t.id = pt.tag_id
+               WHERE pt.page_id = p.id AND t.slug = $7))
+       ORDER BY score DESC, p.id DESC
+       LIMIT $4
+     )
+SELECT h.id, h.title, h.url, ts_headline('simple', h.content, qq.query, $3) AS snippet
+FROM hits h
+CROSS JOIN qq
+ORDER BY h.score DESC, h.id DESC;`
+
+var (
+	sqlFTSRank   = fmt.Sprintf(sqlFTSTemplate, "ts_rank")
+	sqlFTSRankCD = fmt.Sprintf(sqlFTSTemplate, "ts_rank_cd")
+)
+
+// sqlFTSSQLite is the FTS query on SQLite, against the FTS5 index of
+// migrations/sqlite/0002_pages_fts.sql: bm25 (lower is better, hence negated) plus the same
+// feedback term, with snippets of $3 tokens from FTS5's snippet().
+const sqlFTSSQLite = `
+WITH fb AS (SELECT page_id, SUM(vote) AS score FROM result_votes GROUP BY page_id)
+SELECT p.id, p.title, p.url, snippet(pages_fts, 1, '', '', '', $3) AS snippet
+FROM pages_fts
+JOIN pages p ON p.id = pages_fts.rowid
+LEFT JOIN fb ON fb.page_id = p.id
+WHERE pages_fts MATCH $2
+  AND p.language = $1
+  AND p.tenant_id = $8
+  AND p.deleted_at IS NULL
+  AND ($7 = '' OR EXISTS (
+        SELECT 1 FROM page_tags pt JOIN tags t ON t.id = pt.tag_id
+        WHERE pt.page_id = p.id AND t.slug = $7))
+ORDER BY -bm25(pages_fts) + $5 * COALESCE(fb.score, 0) / (ABS(COALESCE(fb.score, 0)) + $6) DESC, p.id DESC
+LIMIT $4;`
+
 // queryILIKE is a simple substring search fallback.
 // It is used when FTS is disabled or unavailable (e.g., missing migration/index).
-func queryILIKE(ctx context.Context, q, lang string, limit int) ([]SearchResult, error) {
+//
+// The database returns a window of twice the snippet length, starting one snippet length
+// before the query's first occurrence in the content (or at the start, when the query only
+// matches the title); trimSnippets centres the snippet on the match within it. Both sides
+// are compared lowercased and unaccented, so "blabaer" finds "Blåbær" and vice versa.
+// SQLite has no GREATEST or STRPOS, so it gets the same query with MAX and INSTR.
+func queryILIKE(ctx context.Context, q, lang, tag string, limit, snippetLength int) ([]SearchResult, error) {
+	query, args := ilikeStatement(ctx, q, lang, tag, limit, snippetLength)
+
+	var out []SearchResult
+	err := querySearch(ctx, func(rows *sql.Rows) (err error) {
+		out, err = scanRows(rows, lang, limit)
+		return err
+	}, query, args...)
+	trimSnippets(out, q, snippetLength)
+	return out, err
+}
+
+// ilikeStatement is the SQL statement and arguments queryILIKE runs.
+func ilikeStatement(ctx context.Context, q, lang, tag string, limit, snippetLength int) (string, []any) {
 	const sqlILIKE = `
-SELECT id, title, url, language, LEFT(content, $3) AS snippet
+SELECT id, title, url,
+       SUBSTR(content, GREATEST(STRPOS(f_unaccent(LOWER(content)), f_unaccent($7)) - $3, 1), 2 * $3) AS snippet
 FROM pages
 WHERE language = $1
-  AND (title ILIKE $2 OR content ILIKE $2)
+  AND tenant_id = $6
+  AND deleted_at IS NULL
+  AND (f_unaccent(LOWER(title)) LIKE f_unaccent($2) OR f_unaccent(LOWER(content)) LIKE f_unaccent($2))
+  AND ($5::text = '' OR EXISTS (
+        SELECT 1 FROM page_tags pt JOIN tags t ON t.id = pt.tag_id
+        WHERE pt.page_id = pages.id AND t.slug = $5))
 ORDER BY last_updated DESC NULLS LAST, id DESC
 LIMIT $4;`
-
-	rows, err := db.QueryContext(ctx, sqlILIKE, lang, "%"+q+"%", snippetLen, limit)
-	if err != nil {
-		return nil, err
+	const sqlLikeSQLite = `
+SELECT id, title, url,
+       SUBSTR(content, MAX(INSTR(f_unaccent(LOWER(content)), f_unaccent($7)) - $3, 1), 2 * $3) AS snippet
+FROM pages
+WHERE language = $1
+  AND tenant_id = $6
+  AND deleted_at IS NULL
+  AND (f_unaccent(LOWER(title)) LIKE f_unaccent($2) OR f_unaccent(LOWER(content)) LIKE f_unaccent($2))
+  AND ($5 = '' OR EXISTS (
+        SELECT 1 FROM page_tags pt JOIN tags t ON t.id = pt.tag_id
+        WHERE pt.page_id = pages.id AND t.slug = $5))
+ORDER BY last_updated DESC NULLS LAST, id DESC
+LIMIT $4;`
+	query := sqlILIKE
+	if sqlDialect == dialect.SQLite {
+		query = sqlLikeSQLite
 	}
-	return scanRows(rows)
+	return query, []any{lang, "%" + q + "%", snippetLength, limit, tag, tenantID(ctx), q}
+}
+
+// queryTagged lists the pages carrying tag, by title. It sticks to portable SQL (SUBSTR
+// rather than LEFT) so tag browsing also works on SQLite.
+func queryTagged(ctx context.Context, lang, tag string, limit, snippetLength int) ([]SearchResult, error) {
+	const sqlTagged = `
+SELECT p.id, p.title, p.url, SUBSTR(p.content, 1, 2 * $3) AS snippet
+FROM pages p
+JOIN page_tags pt ON pt.page_id = p.id
+JOIN tags t ON t.id = pt.tag_id
+WHERE p.language = $1
+  AND p.tenant_id = $5
+  AND p.deleted_at IS NULL
+  AND t.slug = $2
+ORDER BY p.title, p.id
+LIMIT $4;`
+
+	var out []SearchResult
+	err := querySearch(ctx, func(rows *sql.Rows) (err error) {
+		out, err = scanRows(rows, lang, limit)
+		return err
+	}, sqlTagged, lang, tag, snippetLength, limit, tenantID(ctx))
+	trimSnippets(out, "", snippetLength)
+	return out, err
 }
 
 // scanRows converts SQL rows to []SearchResult and guarantees rows.Close() is called.
-func scanRows(rows *sql.Rows) ([]SearchResult, error) {
+// Rows are scanned in place into a slice presized for limit results: a per-row temporary
+// would escape to the heap (its fields are passed to Scan), costing one allocation per row.
+// The queries filter on language, so it is not selected (the driver would allocate the same
+// string for every row) but filled in from lang.
+func scanRows(rows *sql.Rows, lang string, limit int) ([]SearchResult, error) {
 	defer func() {
 		if err := rows.Close(); err != nil {
 			log.Println(rowsCloseErrMsg, err)
 		}
 	}()
 
-	out := make([]SearchResult, 0, 16)
+	out := make([]SearchResult, 0, limit)
 	for rows.Next() {
-		var it SearchResult
-		if err := rows.Scan(&it.ID, &it.Title, &it.URL, &it.Language, &it.Description); err != nil {
+		n := len(out)
+		out = append(out, SearchResult{Language: lang})
+		it := &out[n]
+		if err := rows.Scan(&it.ID, &it.Title, &it.URL, &it.Description); err != nil {
 			log.Println("rows.Scan error:", err)
+			out = out[:n]
 			continue
 		}
-		out = append(out, it)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -286,53 +732,75 @@ func scanRows(rows *sql.Rows) ([]SearchResult, error) {
 // loadExternalBestEffort returns cached Wikipedia results for (query, lang).
 // If no cache exists, it performs a scrape and stores results in the DB.
 // Failures are logged but do not fail the request (best-effort enrichment).
-func loadExternalBestEffort(q, lang string) []SearchResult {
+// scrapeExternal fetches Wikipedia results for q and stores them in the external cache.
+// Also run by the scrape_external background job. A per-query advisory lock keeps replicas
+// from scraping the same query at the same time; the one that loses simply skips.
+// Results are cached per tenant, like the pages they enrich. SQLite has no advisory locks,
+// but it only runs as a single process.
+func scrapeExternal(ctx context.Context, tenant int, q, lang string) error {
+	if sqlDialect == dialect.SQLite {
+		return scrapeExternalLocked(ctx, tenant, q, lang)
+	}
+	key := lock.Key(fmt.Sprintf("scrape:%d:%s:%s", tenant, lang, q))
+	err := lock.TryWithLock(ctx, db, key, func(ctx context.Context) error {
+		return scrapeExternalLocked(ctx, tenant, q, lang)
+	})
+	if errors.Is(err, lock.ErrNotAcquired) {
+		return nil
+	}
+	return err
+}
+
+func scrapeExternalLocked(ctx context.Context, tenant int, q, lang string) error {
+	scraped, err := scraper.WikipediaSearch(q, 10)
+	reportServiceStatus(EventExternalSearch, "External search (Wikipedia)", err == nil)
+	if err != nil {
+		return err
+	}
+	if len(scraped) == 0 {
+		return nil
+	}
+
+	store := make([]dbx.ExternalResult, 0, len(scraped))
+	for _, s := range scraped {
+		store = append(store, dbx.ExternalResult{
+			Title:   s.Title,
+			URL:     s.URL,
+			Snippet: s.Snippet,
+		})
+	}
+	if err := dbx.InsertExternal(ctx, db, tenant, q, lang, store); err != nil {
+		log.Println("InsertExternal error:", err)
+	}
+	return nil
+}
+
+func loadExternalBestEffort(ctx context.Context, tenant int, q, lang string) []SearchResult {
 	// Ensure cache exists (best effort).
-	if !dbx.ExternalExists(db, q, lang) {
-		scraped, err := scraper.WikipediaSearch(q, 10)
-		if err != nil {
-			log.Println("WikipediaSearch error:", err)
-		} else if len(scraped) > 0 {
-			store := make([]dbx.ExternalResult, 0, len(scraped))
-			for _, s := range scraped {
-				store = append(store, dbx.ExternalResult{
-					Title:   s.Title,
-					URL:     s.URL,
-					Snippet: s.Snippet,
-				})
-			}
-			if err := dbx.InsertExternal(db, q, lang, store); err != nil {
-				log.Println("InsertExternal error:", err)
-			}
+	cached, err := dbx.ExternalExists(ctx, db, tenant, q, lang)
+	if err != nil {
+		log.Println("ExternalExists error:", err)
+		return nil
+	}
+	if !cached {
+		if err := scrapeExternal(ctx, tenant, q, lang); err != nil {
+			reportExternalError("wikipedia", "WikipediaSearch error", err)
 		}
 	}
 
-	ext, err := dbx.GetExternal(db, q, lang)
+	ext, err := dbx.GetExternal(ctx, db, tenant, q, lang)
 	if err != nil {
 		log.Println("GetExternal error:", err)
 		return nil
 	}
 
-	out := make([]SearchResult, 0, len(ext))
-	for _, e := range ext {
-		out = append(out, SearchResult{
-			ID:          0,
-			Title:       e.Title,
-			URL:         e.URL,
-			Language:    lang,
-			Description: e.Snippet,
-		})
-	}
-	return out
+	return externalSearchResults(ext, lang)
 }
 
-// getLanguage reads the requested language code.
-// Default is "en" for predictable behavior.
+// getLanguage negotiates the language of a request: the language= parameter, the lang
+// cookie, the user's saved preference, then Accept-Language (see i18n.Negotiate). Search,
+// the UI and external enrichment all use it, so a page never mixes languages.
 func getLanguage(r *http.Request) string {
-	lang := r.URL.Query().Get("language")
-	if lang == "" {
-		return "en"
-	}
-	return lang
+	return i18n.Negotiate(r, func() string { return storedLanguage(r) })
 }
 
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/i18n"
+	"devops-valgfag/internal/metrics"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// Max queries accepted in one POST /api/search/batch body.
+	batchMaxQueries = 20
+
+	// How many queries of a batch run against the DB at the same time.
+	batchConcurrency = 4
+
+	// Combined deadline for the whole batch (each query still has its own requestTimeout).
+	batchTimeout = 5 * time.Second
+)
+
+// APIBatchSearchRequest is the body accepted by POST /api/search/batch.
+type APIBatchSearchRequest struct {
+	Queries  []string `json:"queries" example:"golang,docker"`
+	Language string   `json:"language,omitempty" example:"en"` // default: the negotiated request language
+	Limit    int      `json:"limit,omitempty" example:"5"`     // per query, default 10
+}
+
+// APIBatchSearchResult holds the results for one query of a batch.
+type APIBatchSearchResult struct {
+	Query         string         `json:"query"`
+	SearchResults []SearchResult `json:"search_results"`
+}
+
+// APIBatchSearchResponse is returned by POST /api/search/batch (same order as the request).
+type APIBatchSearchResponse struct {
+	Results []APIBatchSearchResult `json:"results"`
+}
+
+// APIBatchSearchHandler godoc
+// @Summary      Batch search
+// @Description  Runs up to 20 queries concurrently (local database only) and returns results per query, in request order. Requires session auth.
+// @Tags         Search
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  APIBatchSearchRequest  true  "Queries"
+// @Success      200  {object}  APIBatchSearchResponse
+// @Failure      400  {object}  APIErrorResponse  "Invalid input (e.g. an unsupported language); an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      504  {object}  APIErrorResponse
+// @Router       /api/search/batch [post]
+func APIBatchSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database not configured"})
+		return
+	}
+	if !isAuthenticated(r) {
+		writeJSON(w, http.StatusUnauthorized, APIErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req APIBatchSearchRequest
+	if !decodeJSONBody(w, r, 16<<10, &req) {
+		return
+	}
+	if len(req.Queries) == 0 {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "queries is required"})
+		return
+	}
+	if len(req.Queries) > batchMaxQueries {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "too many queries (max 20)"})
+		return
+	}
+
+	lang := getLanguage(r)
+	if code := strings.TrimSpace(req.Language); code != "" {
+		var ok bool
+		if lang, ok = i18n.Normalize(code); !ok {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{
+				Error: "unsupported language (supported: " + strings.Join(i18n.Supported, ", ") + ")",
+				Field: "language",
+			})
+			return
+		}
+	}
+	limit := req.Limit
+	if limit <= 0 || limit > apiLimit {
+		limit = apiLimit
+	}
+
+	results, err := runBatchSearch(r.Context(), req.Queries, lang, limit)
+	if err != nil {
+		writeJSON(w, http.StatusGatewayTimeout, APIErrorResponse{Error: "batch search timed out"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIBatchSearchResponse{Results: results})
+}
+
+// runBatchSearch runs each query through runSearch with bounded concurrency.
+// Results keep the request order; the whole batch fails if the combined deadline passes.
+func runBatchSearch(ctx context.Context, queries []string, lang string, limit int) ([]APIBatchSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, batchTimeout)
+	defer cancel()
+
+	out := make([]APIBatchSearchResult, len(queries))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(batchConcurrency)
+
+	for i, q := range queries {
+		g.Go(func() error {
+			// Skip queued queries once the batch deadline has passed.
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			res := runSearch(gctx, q, lang, limit, false)
+			if len(res) > 0 {
+				metrics.SearchWithResult.Inc()
+			}
+			out[i] = APIBatchSearchResult{Query: q, SearchResults: res}
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	// runSearch swallows DB errors, so check the deadline explicitly.
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, ctx.Err()
+	}
+	return out, nil
+}
@@ -0,0 +1,159 @@
+package handlers
+
+// Benchmarks for the search hot path. They live in the package (unlike the tests in tests/)
+// because they measure unexported functions directly.
+//
+//	go test ./handlers -run '^$' -bench . -benchmem
+//
+// BenchmarkScanRows runs on in-memory SQLite. The query benchmarks need PostgreSQL (FTS, ILIKE):
+// point BENCH_DATABASE_URL at a throwaway database; it is migrated and its /bench/ pages are
+// replaced when BENCH_ROWS (default 10000) changes.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/benchdata"
+	"devops-valgfag/internal/cache"
+	"devops-valgfag/internal/migrate"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+func benchRows(fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv("BENCH_ROWS")); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// usePostgresBenchDB points the package db at BENCH_DATABASE_URL, seeded with BENCH_ROWS pages.
+func usePostgresBenchDB(b *testing.B) {
+	b.Helper()
+	dsn := os.Getenv("BENCH_DATABASE_URL")
+	if dsn == "" {
+		b.Skip("BENCH_DATABASE_URL not set")
+	}
+	pg, err := sql.Open("pgx", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = pg.Close() })
+	if err := migrate.RunMigrations(pg); err != nil {
+		b.Fatal(err)
+	}
+
+	ctx := context.Background()
+	rows := benchRows(10000)
+	var have int
+	if err := pg.QueryRowContext(ctx, `SELECT COUNT(*) FROM pages WHERE url LIKE '/bench/%'`).Scan(&have); err != nil {
+		b.Fatal(err)
+	}
+	if have != rows {
+		if _, err := pg.ExecContext(ctx, `DELETE FROM pages WHERE url LIKE '/bench/%'`); err != nil {
+			b.Fatal(err)
+		}
+		if err := benchdata.Seed(ctx, pg, benchdata.Options{Rows: rows}); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := pg.ExecContext(ctx, `ANALYZE pages`); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	prev := db
+	db = pg
+	b.Cleanup(func() { db = prev })
+}
+
+func BenchmarkScanRows(b *testing.B) {
+	sqlite, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = sqlite.Close() }()
+	sqlite.SetMaxOpenConns(1) // one connection = one in-memory database
+	if err := InitSchema(sqlite); err != nil {
+		b.Fatal(err)
+	}
+	if err := benchdata.Seed(context.Background(), sqlite, benchdata.Options{Rows: benchRows(1000)}); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, limit := range []int{apiLimit, pageLimit} {
+		b.Run(fmt.Sprintf("limit=%d", limit), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rows, err := sqlite.Query(`SELECT id, title, url, substr(content, 1, $1) FROM pages LIMIT $2`, snippetLen, limit)
+				if err != nil {
+					b.Fatal(err)
+				}
+				res, err := scanRows(rows, "en", limit)
+				if err != nil || len(res) != limit {
+					b.Fatalf("scanRows: %d results, err=%v", len(res), err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkQueryFTS(b *testing.B) {
+	usePostgresBenchDB(b)
+	benchQueries(b, func(ctx context.Context, q, lang, tag string, limit, snippetLength int) ([]SearchResult, error) {
+		return queryFTS(ctx, rankingV1, q, lang, tag, limit, snippetLength)
+	})
+}
+
+func BenchmarkQueryILIKE(b *testing.B) {
+	usePostgresBenchDB(b)
+	benchQueries(b, queryILIKE)
+}
+
+func benchQueries(b *testing.B, query func(ctx context.Context, q, lang, tag string, limit, snippetLength int) ([]SearchResult, error)) {
+	queries := benchdata.Queries(1000, 1, 0)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := query(ctx, queries[i%len(queries)], "en", "", apiLimit, snippetLen); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRunSearch measures the full pipeline with and without the result cache.
+func BenchmarkRunSearch(b *testing.B) {
+	usePostgresBenchDB(b)
+	EnableFTSSearch(true)
+	EnableExternalSearch(false)
+	b.Cleanup(func() {
+		EnableFTSSearch(false)
+		EnableExternalSearch(true)
+		SetSearchCache(nil, 0)
+	})
+	queries := benchdata.Queries(1000, 1, 0)
+
+	for _, tc := range []struct {
+		name  string
+		cache cache.Cache
+	}{
+		{"nocache", nil},
+		{"memcache", cache.NewMemory(1000)},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			SetSearchCache(tc.cache, time.Minute)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runSearch(context.Background(), queries[i%len(queries)], "en", apiLimit, false)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/service"
+	"devops-valgfag/internal/textnorm"
+)
+
+// explainTimeout bounds an EXPLAIN ANALYZE, which runs the query to completion.
+const explainTimeout = 30 * time.Second
+
+// SearchExplainResponse is the query plan of a search.
+type SearchExplainResponse struct {
+	Path    string   `json:"path" example:"fts_v1"`  // ilike, fts_v1 or fts_v2 (fts on SQLite), as in the shadow metrics
+	Pool    string   `json:"pool" example:"replica"` // the connection pool searches currently use
+	Analyze bool     `json:"analyze"`                // whether the query was executed (EXPLAIN ANALYZE)
+	Query   string   `json:"query"`
+	Args    []any    `json:"args"`
+	Plan    []string `json:"plan"`
+}
+
+// AdminSearchExplainHandler godoc
+// @Summary      Explain a search query
+// @Description  Returns the plan of the exact SQL statement the search would run for q, with its arguments, on the pool searches use. On PostgreSQL it is EXPLAIN (ANALYZE, BUFFERS), which executes the query (read-only, rolled back); analyze=0 only plans it. On SQLite it is EXPLAIN QUERY PLAN. The path follows SEARCH_FTS and the admin's search_ranking variant unless path / ranking are given. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        q          query  string  true   "Search query"
+// @Param        language   query  string  false  "Language code, en or da (default: lang cookie, saved preference, Accept-Language, then en)"
+// @Param        tag        query  string  false  "Tag filter (slug)"
+// @Param        limit      query  int     false  "Result limit (default 50, the search page's)"
+// @Param        snippet_length  query  int  false  "Snippet length in characters (50-500, default 200)"
+// @Param        path       query  string  false  "fts or ilike (default: what SEARCH_FTS selects)"
+// @Param        ranking    query  string  false  "FTS ranking, v1 (ts_rank) or v2 (ts_rank_cd)"
+// @Param        analyze    query  bool    false  "Execute the query (default true)"
+// @Success      200  {object}  SearchExplainResponse
+// @Failure      400  {object}  APIErrorResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/admin/search/explain [get]
+func AdminSearchExplainHandler(w http.ResponseWriter, r *http.Request) {
+	r = withExperiments(w, r)
+	params := r.URL.Query()
+
+	q := service.SearchQuery{
+		Query:         textnorm.Query(params.Get("q")),
+		Language:      getLanguage(r),
+		Tag:           tagSlug(params.Get("tag")),
+		Limit:         pageLimit,
+		SnippetLength: parseSnippetLength(r),
+	}
+	if q.Query == "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "q is required"})
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > pageLimit {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: fmt.Sprintf("limit must be 1-%d", pageLimit)})
+			return
+		}
+		q.Limit = n
+	}
+
+	path := pageSearch{fts: useFTSSearch.Load(), ranking: ftsRanking(r.Context())}
+	switch params.Get("path") {
+	case "":
+	case "fts":
+		path.fts = true
+	case "ilike":
+		path.fts = false
+	default:
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "path must be fts or ilike"})
+		return
+	}
+	switch ranking := params.Get("ranking"); ranking {
+	case "":
+	case rankingV1, rankingV2:
+		path.ranking = ranking
+	default:
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "ranking must be v1 or v2"})
+		return
+	}
+	analyze := params.Get("analyze") != "0" && params.Get("analyze") != "false" && sqlDialect == dialect.Postgres
+
+	query, args := path.statement(r.Context(), q)
+	if query == "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "q has no words to search for"})
+		return
+	}
+
+	pool, poolName := readDB()
+	plan, err := explainQuery(r.Context(), pool, query, args, analyze)
+	if err != nil {
+		reportError(r, "search explain error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "explain failed: " + err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, SearchExplainResponse{
+		Path:    path.String(),
+		Pool:    poolName,
+		Analyze: analyze,
+		Query:   strings.TrimSpace(query),
+		Args:    args,
+		Plan:    plan,
+	})
+}
+
+// explainQuery returns the plan of query, one line per element. It runs in a read-only
+// transaction that is rolled back, so ANALYZE cannot change anything.
+func explainQuery(ctx context.Context, pool *sql.DB, query string, args []any, analyze bool) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, explainTimeout)
+	defer cancel()
+
+	tx, err := pool.BeginTx(ctx, &sql.TxOptions{ReadOnly: sqlDialect == dialect.Postgres})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if sqlDialect == dialect.SQLite {
+		return explainSQLite(ctx, tx, query, args)
+	}
+	explain := "EXPLAIN "
+	if analyze {
+		explain = "EXPLAIN (ANALYZE, BUFFERS) "
+	}
+	rows, err := tx.QueryContext(ctx, explain+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var plan []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		plan = append(plan, line)
+	}
+	return plan, rows.Err()
+}
+
+// explainSQLite returns SQLite's EXPLAIN QUERY PLAN as an indented tree.
+func explainSQLite(ctx context.Context, tx *sql.Tx, query string, args []any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var plan []string
+	depth := map[int]int{}
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			return nil, err
+		}
+		depth[id] = depth[parent] + 1
+		plan = append(plan, strings.Repeat("  ", depth[id]-1)+detail)
+	}
+	return plan, rows.Err()
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"html/template"
+
+	dbx "devops-valgfag/internal/db"
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/scraper"
+)
+
+// Cached external results (external_results) are stored per query, but what Wikipedia
+// returned for one query is often the answer to a related one. queryLocal therefore also
+// searches the cache by title and snippet and fills the slots pages leave free with its
+// matches, so previously fetched knowledge is reused without a new scrape.
+
+// sqlExternalCacheFTS searches the cache with the full-text index of
+// migrations/0023_external_results_search.sql (PostgreSQL with SEARCH_FTS). A URL cached
+// for several queries is returned once, with its most recent title and snippet.
+const sqlExternalCacheFTS = `
+WITH qq AS (SELECT plainto_tsquery('simple', f_unaccent($3)) AS query),
+     hits AS (
+       SELECT MAX(e.id) AS id,
+              MAX(ts_rank(to_tsvector('simple', f_unaccent(e.title || ' ' || f_strip_tags(e.snippet))), qq.query)) AS score
+       FROM external_results e
+       CROSS JOIN qq
+       WHERE e.tenant_id = $1
+         AND e.language = $2
+         AND to_tsvector('simple', f_unaccent(e.title || ' ' || f_strip_tags(e.snippet))) @@ qq.query
+       GROUP BY e.url
+       ORDER BY score DESC, id DESC
+       LIMIT $4
+     )
+SELECT e.title, e.url, e.snippet
+FROM hits h
+JOIN external_results e ON e.id = h.id
+ORDER BY h.score DESC, h.id DESC;`
+
+// sqlExternalCacheLike is the substring search over the cache (trigram index on PostgreSQL),
+// lowercased and unaccented like queryILIKE, newest entries first; $3 is escaped with
+// escapeLike. It is portable SQL, so SQLite runs it too.
+const sqlExternalCacheLike = `
+SELECT e.title, e.url, e.snippet
+FROM external_results e
+WHERE e.id IN (
+  SELECT MAX(id)
+  FROM external_results
+  WHERE tenant_id = $1
+    AND language = $2
+    AND f_unaccent(LOWER(title || ' ' || f_strip_tags(snippet))) LIKE f_unaccent($3) ESCAPE '\'
+  GROUP BY url
+)
+ORDER BY e.created_at DESC, e.id DESC
+LIMIT $4;`
+
+// queryExternalCache returns up to limit cached external results matching q in the
+// context's tenant, skipping the URLs in exclude.
+func queryExternalCache(ctx context.Context, q, lang string, limit int, exclude []SearchResult) ([]SearchResult, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	query, pattern := sqlExternalCacheLike, "%"+escapeLike(q)+"%"
+	if useFTSSearch.Load() && sqlDialect == dialect.Postgres {
+		query, pattern = sqlExternalCacheFTS, q
+	}
+
+	seen := make(map[string]bool, len(exclude))
+	for _, r := range exclude {
+		seen[r.URL] = true
+	}
+	var cached []dbx.ExternalResult
+	err := querySearch(ctx, func(rows *sql.Rows) error {
+		defer func() { _ = rows.Close() }()
+		for rows.Next() {
+			var e dbx.ExternalResult
+			if err := rows.Scan(&e.Title, &e.URL, &e.Snippet); err != nil {
+				return err
+			}
+			if !seen[e.URL] {
+				seen[e.URL] = true
+				cached = append(cached, e)
+			}
+		}
+		return rows.Err()
+	}, query, tenantID(ctx), lang, pattern, limit+len(exclude))
+	if err != nil {
+		return nil, err
+	}
+	return externalSearchResults(cached[:min(len(cached), limit)], lang), nil
+}
+
+// externalSearchResults converts cached external results for display. Rows cached before
+// snippets were sanitized on scrape may still hold raw HTML, so the snippet is cleaned again
+// here: highlights for the page, plain text for JSON.
+func externalSearchResults(ext []dbx.ExternalResult, lang string) []SearchResult {
+	out := make([]SearchResult, 0, len(ext))
+	for _, e := range ext {
+		out = append(out, SearchResult{
+			ID:              0,
+			Title:           e.Title,
+			URL:             e.URL,
+			Language:        lang,
+			Description:     scraper.SnippetText(e.Snippet),
+			DescriptionHTML: template.HTML(scraper.SanitizeSnippet(e.Snippet)),
+		})
+	}
+	return out
+}
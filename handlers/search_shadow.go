@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/service"
+)
+
+// Shadow traffic (SEARCH_SHADOW) runs every sampled page search a second time on an
+// alternate path in the background and compares the two: which pages both found, in which
+// order, and how long each took. Users always get the results of the configured path; the
+// comparison only ends up in metrics (app_search_shadow_*) and, for diverging results, the
+// log. It de-risks switching SEARCH_FTS on or moving the search_ranking experiment to v2.
+
+// ShadowMode picks what shadow traffic compares.
+type ShadowMode string
+
+const (
+	ShadowOff ShadowMode = ""
+	// ShadowPath runs the path SEARCH_FTS does not use: ILIKE behind FTS, or FTS behind ILIKE.
+	ShadowPath ShadowMode = "path"
+	// ShadowRanking runs the other FTS ranking (ts_rank vs ts_rank_cd). PostgreSQL only, as
+	// SQLite has a single ranking; searches served by ILIKE are not compared.
+	ShadowRanking ShadowMode = "ranking"
+)
+
+// ParseShadowMode parses SEARCH_SHADOW: "" or "off", "path" or "ranking".
+func ParseShadowMode(s string) (ShadowMode, error) {
+	switch m := ShadowMode(s); m {
+	case "", "off":
+		return ShadowOff, nil
+	case ShadowPath, ShadowRanking:
+		return m, nil
+	}
+	return ShadowOff, fmt.Errorf("SEARCH_SHADOW: unknown mode %q (want off, path or ranking)", s)
+}
+
+// shadowConcurrency bounds the shadow searches running at once; a search finding all slots
+// taken is not shadowed (counted as skipped), so shadow traffic cannot pile up under load.
+const shadowConcurrency = 4
+
+var (
+	shadowConfig atomic.Pointer[shadowSettings]
+	shadowSlots  = make(chan struct{}, shadowConcurrency)
+	shadowRuns   sync.WaitGroup
+)
+
+type shadowSettings struct {
+	mode   ShadowMode
+	sample int // percent of searches shadowed
+}
+
+// SetSearchShadow turns shadow traffic on for samplePercent (0-100) of the page searches,
+// or off with ShadowOff.
+func SetSearchShadow(mode ShadowMode, samplePercent int) {
+	shadowConfig.Store(&shadowSettings{mode: mode, sample: min(max(samplePercent, 0), 100)})
+}
+
+// WaitSearchShadow waits for the shadow searches started so far (tests).
+func WaitSearchShadow() {
+	shadowRuns.Wait()
+}
+
+// pageSearch is one path to search the pages: ILIKE, or FTS with a ranking.
+type pageSearch struct {
+	fts     bool
+	ranking string // rankingV1 or rankingV2; FTS only
+}
+
+// String is the path's metric label: ilike, fts_v1 or fts_v2 (fts on SQLite).
+func (p pageSearch) String() string {
+	switch {
+	case !p.fts:
+		return "ilike"
+	case sqlDialect == dialect.SQLite:
+		return "fts"
+	}
+	return "fts_" + p.ranking
+}
+
+func (p pageSearch) run(ctx context.Context, q service.SearchQuery) ([]SearchResult, error) {
+	if p.fts {
+		return queryFTS(ctx, p.ranking, q.Query, q.Language, q.Tag, q.Limit, q.SnippetLength)
+	}
+	return queryILIKE(ctx, q.Query, q.Language, q.Tag, q.Limit, q.SnippetLength)
+}
+
+// statement is the SQL statement and arguments run would execute ("" if it would not query).
+func (p pageSearch) statement(ctx context.Context, q service.SearchQuery) (string, []any) {
+	if p.fts {
+		return ftsStatement(ctx, p.ranking, q.Query, q.Language, q.Tag, q.Limit, q.SnippetLength)
+	}
+	return ilikeStatement(ctx, q.Query, q.Language, q.Tag, q.Limit, q.SnippetLength)
+}
+
+// alternate is the path mode compares p with; ok is false if there is none.
+func (p pageSearch) alternate(mode ShadowMode) (pageSearch, bool) {
+	switch mode {
+	case ShadowPath:
+		if p.fts {
+			return pageSearch{}, true
+		}
+		return pageSearch{fts: true, ranking: rankingV1}, true
+	case ShadowRanking:
+		if !p.fts || sqlDialect != dialect.Postgres {
+			return pageSearch{}, false
+		}
+		if p.ranking == rankingV2 {
+			return pageSearch{fts: true, ranking: rankingV1}, true
+		}
+		return pageSearch{fts: true, ranking: rankingV2}, true
+	}
+	return pageSearch{}, false
+}
+
+// shadowSearch starts the shadow comparison of a page search that served results in took,
+// if shadow traffic is on, the search succeeded and it is sampled. It does not wait for it.
+func shadowSearch(ctx context.Context, q service.SearchQuery, served pageSearch, results []SearchResult, err error, took time.Duration) {
+	cfg := shadowConfig.Load()
+	if cfg == nil || cfg.mode == ShadowOff || err != nil || rand.IntN(100) >= cfg.sample {
+		return
+	}
+	shadow, ok := served.alternate(cfg.mode)
+	if !ok {
+		return
+	}
+	select {
+	case shadowSlots <- struct{}{}:
+	default:
+		metrics.SearchShadow.WithLabelValues(string(cfg.mode), "skipped").Inc()
+		return
+	}
+
+	// The shadow keeps the request's values (tenant, experiments) but not its cancellation:
+	// it runs after the response has been written.
+	shadowCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), requestTimeout)
+	shadowRuns.Add(1)
+	go func() {
+		defer shadowRuns.Done()
+		defer func() { <-shadowSlots }()
+		defer cancel()
+
+		start := time.Now()
+		shadowResults, err := shadow.run(shadowCtx, q)
+		shadowTook := time.Since(start)
+		mode := string(cfg.mode)
+		if err != nil {
+			metrics.SearchShadow.WithLabelValues(mode, "error").Inc()
+			log.Printf("search shadow: %s search failed: %v", shadow, err)
+			return
+		}
+
+		metrics.SearchShadowLatency.WithLabelValues(served.String(), "served").Observe(took.Seconds())
+		metrics.SearchShadowLatency.WithLabelValues(shadow.String(), "shadow").Observe(shadowTook.Seconds())
+		overlap, outcome := compareResults(results, shadowResults)
+		metrics.SearchShadowOverlap.WithLabelValues(mode).Observe(overlap)
+		metrics.SearchShadow.WithLabelValues(mode, outcome).Inc()
+		if outcome == "diverged" {
+			// Safe logging: no raw query text
+			log.Printf("search shadow: results diverged (query_len=%d): %s %d results in %s, %s %d results in %s, overlap %.2f",
+				len(q.Query), served, len(results), took.Round(time.Microsecond),
+				shadow, len(shadowResults), shadowTook.Round(time.Microsecond), overlap)
+		}
+	}()
+}
+
+// compareResults compares two result lists by page: overlap is the share of pages both
+// contain, relative to the longer list (1 when both are empty), and outcome is "same" (same
+// pages in the same order), "reordered" (same pages) or "diverged".
+func compareResults(a, b []SearchResult) (overlap float64, outcome string) {
+	if len(a) == 0 && len(b) == 0 {
+		return 1, "same"
+	}
+	inA := make(map[int]bool, len(a))
+	for _, r := range a {
+		inA[r.ID] = true
+	}
+	shared, sameOrder := 0, len(a) == len(b)
+	for i, r := range b {
+		if inA[r.ID] {
+			shared++
+		}
+		if sameOrder && a[i].ID != r.ID {
+			sameOrder = false
+		}
+	}
+	overlap = float64(shared) / float64(max(len(a), len(b)))
+	switch {
+	case sameOrder:
+		return overlap, "same"
+	case overlap == 1:
+		return overlap, "reordered"
+	}
+	return overlap, "diverged"
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// searchStatementTimeout caps each search query server-side (SEARCH_STATEMENT_TIMEOUT); 0 = no cap.
+// The request context already cancels queries from the client side; this also stops a query
+// whose cancel request never reaches Postgres (e.g. the replica was restarted mid-query).
+var searchStatementTimeout atomic.Int64
+
+// pgQueryCanceled is SQLSTATE query_canceled, raised for statement_timeout and cancel requests.
+const pgQueryCanceled = "57014"
+
+// SetSearchStatementTimeout sets the Postgres statement_timeout applied to search and suggestion queries.
+func SetSearchStatementTimeout(d time.Duration) {
+	searchStatementTimeout.Store(int64(d))
+}
+
+// querySearch runs a read-only search query on the read pool and hands the rows to scan,
+// which must close them. With a statement timeout configured the query runs in a READ ONLY
+// transaction with SET LOCAL statement_timeout, so the setting never leaks to pooled connections.
+func querySearch(ctx context.Context, scan func(*sql.Rows) error, query string, args ...any) error {
+	timeout := time.Duration(searchStatementTimeout.Load())
+
+	err := withReadPool(ctx, func(pool *sql.DB) error {
+		if timeout <= 0 || sqlDialect != dialect.Postgres { // statement_timeout is PostgreSQL only
+			rows, err := pool.QueryContext(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			return scan(rows)
+		}
+
+		tx, err := pool.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('statement_timeout', $1, true)`, strconv.FormatInt(timeout.Milliseconds(), 10)); err != nil {
+			return err
+		}
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if err := scan(rows); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		countCanceledQuery(ctx, err)
+	}
+	return err
+}
+
+// isQueryCanceled reports whether err means the query was stopped (deadline, client gone,
+// statement_timeout) rather than failed, so callers should not retry it another way.
+func isQueryCanceled(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgQueryCanceled
+}
+
+// countCanceledQuery records why a search query was stopped, if it was.
+func countCanceledQuery(ctx context.Context, err error) {
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		metrics.SearchQueriesCanceled.WithLabelValues("client_disconnect").Inc()
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		metrics.SearchQueriesCanceled.WithLabelValues("deadline").Inc()
+	case isQueryCanceled(ctx, err):
+		metrics.SearchQueriesCanceled.WithLabelValues("statement_timeout").Inc()
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"devops-valgfag/internal/i18n"
+	"devops-valgfag/internal/metrics"
+)
+
+// The search widget lets other sites embed WhoKnows search: /static/widget.js renders a search
+// box into every element with a data-whoknows-search attribute and fetches the results from
+// /api/search/widget. The endpoint is public and readable from any origin, since it serves the
+// same results as the search page and takes no credentials.
+
+const (
+	widgetDefaultLimit = 5
+	widgetMaxLimit     = 10
+	widgetSnippetLen   = 120
+
+	// Results may be cached briefly by browsers and proxies in front of embedding sites.
+	widgetCacheControl = "public, max-age=60"
+)
+
+// SearchWidgetResponse is the compact payload of GET /api/search/widget.
+type SearchWidgetResponse struct {
+	Query   string               `json:"q" example:"docker"`
+	Results []SearchWidgetResult `json:"results"`
+	// More links the full results on the search page.
+	More string `json:"more" example:"https://whoknows.example.com/search?language=en&q=docker"`
+}
+
+// SearchWidgetResult is one result of the search widget. URL is absolute: the WhoKnows page
+// for stored pages, the source for external results.
+type SearchWidgetResult struct {
+	Title   string `json:"title" example:"Docker"`
+	URL     string `json:"url" example:"https://whoknows.example.com/page/42"`
+	Snippet string `json:"snippet,omitempty" example:"Docker is a set of platform as a service products..."`
+}
+
+// APISearchWidgetHandler godoc
+// @Summary      Search widget results
+// @Description  Compact search results for the embeddable widget (/static/widget.js). Public, with Access-Control-Allow-Origin: * so any site can fetch it; local results only.
+// @Tags         Search
+// @Produce      json
+// @Param        q          query  string  true   "Search query"
+// @Param        language   query  string  false  "Language code, en or da (default: lang cookie, saved preference, Accept-Language, then en)"
+// @Param        limit      query  int     false  "Number of results (1-10, default 5)"
+// @Success      200  {object}  SearchWidgetResponse  "Search results"
+// @Failure      400  {object}  APIErrorResponse      "Missing query"
+// @Failure      429  {object}  APIErrorResponse      "Too many requests"
+// @Failure      503  {object}  APIErrorResponse      "Search temporarily unavailable (database down, nothing cached)"
+// @Router       /api/search/widget [get]
+func APISearchWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "q is required", Field: "q"})
+		return
+	}
+	lang := getLanguage(r)
+	limit := widgetDefaultLimit
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		limit = max(1, min(n, widgetMaxLimit))
+	}
+
+	results := runTaggedSearch(r.Context(), q, lang, "", limit, widgetSnippetLen, false)
+	if searchUnavailable(results) {
+		writeSearchUnavailableHeaders(w)
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: errSearchUnavailableMsg})
+		return
+	}
+	if len(results) > 0 {
+		metrics.SearchWithResult.Inc()
+	}
+
+	base := publicURL(r)
+	resp := SearchWidgetResponse{
+		Query:   q,
+		Results: make([]SearchWidgetResult, 0, len(results)),
+		More:    base + searchPath(q, lang),
+	}
+	for _, res := range results {
+		link := res.URL
+		if res.ID > 0 {
+			link = base + "/page/" + strconv.Itoa(res.ID)
+		}
+		resp.Results = append(resp.Results, SearchWidgetResult{Title: res.Title, URL: link, Snippet: res.Description})
+	}
+	w.Header().Set("Cache-Control", widgetCacheControl)
+	varyLanguage(w, r)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// varyLanguage tells shared caches that a response in getLanguage(r) also depends on the lang
+// cookie (or the saved preference of the session) and Accept-Language, unless ?language= set it.
+func varyLanguage(w http.ResponseWriter, r *http.Request) {
+	if _, ok := i18n.Normalize(r.URL.Query().Get(i18n.QueryParam)); !ok {
+		w.Header().Add("Vary", "Accept-Language, Cookie")
+	}
+}
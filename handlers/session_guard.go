@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SessionGuardMiddleware ends sessions that no longer belong to a usable account: the user
+// was deleted, must reset their password, their session_version was bumped since login, or
+// their account is no longer active. It also ends sessions that were signed out from another
+// device (their user_sessions row is gone) and keeps the others' last seen time current (see
+// user_sessions.go). The session is cleared before the handler runs; requests
+// of deleted or reset accounts are then served as anonymous, while a pending, disabled or
+// banned account gets 403 with the reason. Lookup errors fail open; the guard is skipped
+// while the database is down.
+func SessionGuardMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if db != nil && sessionStore != nil && !databaseDown() {
+				if _, err := r.Cookie("session"); err == nil {
+					if status := guardSession(w, r); status != UserStatusActive {
+						writeAccountBlocked(w, r, status)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// guardSession clears the session if it is no longer valid and returns the account status
+// (active when the request may continue, possibly as anonymous).
+func guardSession(w http.ResponseWriter, r *http.Request) string {
+	sess, err := sessionStore.Get(r, "session")
+	if err != nil {
+		return UserStatusActive
+	}
+	userID, ok := sess.Values["user_id"].(int)
+	if !ok {
+		return UserStatusActive
+	}
+	version, _ := sess.Values["session_version"].(int) // sessions from before versioning count as 0
+	key, _ := sess.Values["session_key"].(string)      // "" for sessions from before tracking
+
+	var (
+		current  int
+		status   = UserStatusActive
+		rowID    sql.NullInt64
+		lastSeen sql.NullTime
+	)
+	err = db.QueryRowContext(r.Context(), `
+SELECT u.session_version, u.status, s.id, s.last_seen_at
+FROM users u LEFT JOIN user_sessions s ON s.user_id = u.id AND s.session_key = $2
+WHERE u.id = $1 AND u.deleted_at IS NULL AND u.must_reset_password = FALSE`,
+		userID, key,
+	).Scan(&current, &status, &rowID, &lastSeen)
+	switch {
+	case errors.Is(err, sql.ErrNoRows): // deleted or must reset: continue as anonymous
+	case err != nil:
+		log.Printf("session guard lookup error: %v", err)
+		return UserStatusActive
+	case key != "" && !rowID.Valid: // signed out from another device: continue as anonymous
+	case current == version && status == UserStatusActive:
+		trackSession(w, r, sess, userID, version, rowID, lastSeen)
+		return UserStatusActive
+	default:
+		forgetSession(r.Context(), sess)
+	}
+
+	// sessionStore.Get caches the session per request, so handlers see the cleared values.
+	// The cookie is kept (like logout does) so a login in this same request can reuse it.
+	for k := range sess.Values {
+		delete(sess.Values, k)
+	}
+	if err := sess.Save(r, w); err != nil {
+		log.Printf("session guard revoke error: %v", err)
+	}
+	return status
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Protocol limit: a single sitemap file may list at most 50,000 URLs.
+	// Larger corpora are split into numbered files referenced from a sitemap index.
+	sitemapMaxURLs = 50000
+
+	sitemapXMLNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+	// Generating the sitemap reads the whole pages table, so it gets a more generous timeout than search.
+	sitemapTimeout = 30 * time.Second
+)
+
+// sitemapEntry is one page snapshot taken from the pages table.
+type sitemapEntry struct {
+	URL     string
+	LastMod time.Time
+}
+
+// sitemapState holds the most recent snapshot of the pages table.
+// Entries are rendered per request so absolute URLs can fall back to the request host.
+var sitemapState struct {
+	mu          sync.RWMutex
+	entries     []sitemapEntry
+	generatedAt time.Time
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name         `xml:"sitemapindex"`
+	XMLNS    string           `xml:"xmlns,attr"`
+	Sitemaps []sitemapPointer `xml:"sitemap"`
+}
+
+type sitemapPointer struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// SitemapStatus is returned by the admin regenerate endpoint.
+type SitemapStatus struct {
+	URLs        int       `json:"urls"`
+	Files       int       `json:"files"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// RegenerateSitemap takes a fresh snapshot of the pages table.
+// On error the previous snapshot is kept so /sitemap.xml keeps serving.
+func RegenerateSitemap(ctx context.Context) (SitemapStatus, error) {
+	if db == nil {
+		return SitemapStatus{}, fmt.Errorf("database not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sitemapTimeout)
+	defer cancel()
+
+	// The sitemap describes the default site (PUBLIC_BASE_URL); other tenants' pages are not listed.
+	rows, err := db.QueryContext(ctx, `SELECT url, last_updated FROM pages WHERE deleted_at IS NULL AND tenant_id = $1 ORDER BY id`, defaultTenantID)
+	if err != nil {
+		return SitemapStatus{}, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Println(rowsCloseErrMsg, err)
+		}
+	}()
+
+	entries := make([]sitemapEntry, 0, 64)
+	for rows.Next() {
+		var (
+			e       sitemapEntry
+			lastMod sql.NullTime
+		)
+		if err := rows.Scan(&e.URL, &lastMod); err != nil {
+			log.Println("rows.Scan error:", err)
+			continue
+		}
+		if lastMod.Valid {
+			e.LastMod = lastMod.Time
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return SitemapStatus{}, err
+	}
+
+	now := time.Now().UTC()
+	sitemapState.mu.Lock()
+	sitemapState.entries = entries
+	sitemapState.generatedAt = now
+	sitemapState.mu.Unlock()
+
+	return SitemapStatus{URLs: len(entries), Files: sitemapFileCount(len(entries)), GeneratedAt: now}, nil
+}
+
+// SitemapHandler serves /sitemap.xml.
+// Small corpora get a single <urlset>; above sitemapMaxURLs it becomes a <sitemapindex>
+// pointing at /sitemap-1.xml, /sitemap-2.xml, ...
+func SitemapHandler(w http.ResponseWriter, r *http.Request) {
+	entries, generatedAt, ok := sitemapSnapshot(r.Context())
+	if !ok {
+		http.Error(w, "sitemap unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	base := publicURL(r)
+	if len(entries) <= sitemapMaxURLs {
+		writeXML(w, r, "application/xml", buildURLSet(base, entries))
+		return
+	}
+
+	idx := sitemapIndex{XMLNS: sitemapXMLNS}
+	for i := 1; i <= sitemapFileCount(len(entries)); i++ {
+		idx.Sitemaps = append(idx.Sitemaps, sitemapPointer{
+			Loc:     fmt.Sprintf("%s/sitemap-%d.xml", base, i),
+			LastMod: generatedAt.Format(time.RFC3339),
+		})
+	}
+	writeXML(w, r, "application/xml", idx)
+}
+
+// SitemapPartHandler serves one numbered sitemap file (/sitemap-{n}.xml).
+func SitemapPartHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(mux.Vars(r)["n"])
+	if err != nil || n < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	entries, _, ok := sitemapSnapshot(r.Context())
+	if !ok {
+		http.Error(w, "sitemap unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	start := (n - 1) * sitemapMaxURLs
+	if start >= len(entries) {
+		http.NotFound(w, r)
+		return
+	}
+	end := min(start+sitemapMaxURLs, len(entries))
+
+	writeXML(w, r, "application/xml", buildURLSet(publicURL(r), entries[start:end]))
+}
+
+// AdminRegenerateSitemapHandler godoc
+// @Summary      Regenerate sitemap
+// @Description  Rebuilds the sitemap snapshot from the pages table. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  SitemapStatus
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/sitemap [post]
+func AdminRegenerateSitemapHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := RegenerateSitemap(r.Context())
+	if err != nil {
+		reportError(r, "sitemap regeneration error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "sitemap regeneration failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// sitemapSnapshot returns the current snapshot, generating it on first use.
+func sitemapSnapshot(ctx context.Context) ([]sitemapEntry, time.Time, bool) {
+	sitemapState.mu.RLock()
+	entries, generatedAt := sitemapState.entries, sitemapState.generatedAt
+	sitemapState.mu.RUnlock()
+
+	if !generatedAt.IsZero() {
+		return entries, generatedAt, true
+	}
+
+	if _, err := RegenerateSitemap(ctx); err != nil {
+		log.Println("sitemap regeneration error:", err)
+		return nil, time.Time{}, false
+	}
+
+	sitemapState.mu.RLock()
+	defer sitemapState.mu.RUnlock()
+	return sitemapState.entries, sitemapState.generatedAt, true
+}
+
+// sitemapFileCount is the number of <urlset> files needed for n URLs.
+func sitemapFileCount(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return (n + sitemapMaxURLs - 1) / sitemapMaxURLs
+}
+
+func buildURLSet(base string, entries []sitemapEntry) sitemapURLSet {
+	set := sitemapURLSet{XMLNS: sitemapXMLNS, URLs: make([]sitemapURL, 0, len(entries))}
+	for _, e := range entries {
+		u := sitemapURL{Loc: absoluteURL(base, e.URL)}
+		if !e.LastMod.IsZero() {
+			u.LastMod = e.LastMod.UTC().Format(time.RFC3339)
+		}
+		set.URLs = append(set.URLs, u)
+	}
+	return set
+}
+
+// absoluteURL keeps already-absolute page URLs and prefixes relative ones with the site base URL.
+func absoluteURL(base, raw string) string {
+	if strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://") {
+		return raw
+	}
+	if !strings.HasPrefix(raw, "/") {
+		raw = "/" + raw
+	}
+	return base + raw
+}
+
+// writeXML writes an XML document (with the standard header) using the given media type.
+func writeXML(w http.ResponseWriter, r *http.Request, mediaType string, v any) {
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	_, _ = w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		log.Println("xml encode error:", err)
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Users and pages are soft-deleted: DELETE sets deleted_at, every regular query skips such
+// rows, and an admin can restore them until the retention window has passed. After that the
+// purge_deleted task removes them for good (dependent rows go with them via ON DELETE CASCADE).
+
+// defaultSoftDeleteRetention is how long soft-deleted rows can be restored (SOFT_DELETE_RETENTION).
+const defaultSoftDeleteRetention = 30 * 24 * time.Hour
+
+const (
+	adminDeletedDefaultLimit = 50
+	adminDeletedMaxLimit     = 500
+)
+
+var softDeleteRetention = defaultSoftDeleteRetention
+
+// SetSoftDeleteRetention sets how long soft-deleted users and pages are kept (<= 0 = default).
+func SetSoftDeleteRetention(d time.Duration) {
+	if d <= 0 {
+		d = defaultSoftDeleteRetention
+	}
+	softDeleteRetention = d
+}
+
+// softDeletable describes a table with a deleted_at column. The names are fixed strings,
+// never user input, so building SQL from them is safe.
+type softDeletable struct {
+	table string
+	name  string // column shown in listings
+	noun  string // for error messages
+}
+
+var softDeleteKinds = map[string]softDeletable{
+	"users": {table: "users", name: "username", noun: "user"},
+	"pages": {table: "pages", name: "title", noun: "page"},
+}
+
+// DeletedItem is a soft-deleted user or page.
+type DeletedItem struct {
+	ID         int       `json:"id" example:"7"`
+	Name       string    `json:"name" example:"alice"` // username or page title
+	DeletedAt  time.Time `json:"deleted_at"`
+	PurgeAfter time.Time `json:"purge_after"` // when purge_deleted removes it for good
+}
+
+// AdminDeletedResponse lists restorable soft-deleted users or pages, newest first.
+type AdminDeletedResponse struct {
+	Kind      string        `json:"kind" example:"users"`
+	Retention string        `json:"retention" example:"720h0m0s"`
+	Items     []DeletedItem `json:"items"`
+}
+
+// softDeleteCutoff is the oldest deleted_at that can still be restored.
+func softDeleteCutoff() time.Time {
+	return time.Now().UTC().Add(-softDeleteRetention)
+}
+
+// kindFromRoute resolves the {kind} route variable (users or pages).
+func kindFromRoute(w http.ResponseWriter, r *http.Request) (softDeletable, bool) {
+	kind, ok := softDeleteKinds[mux.Vars(r)["kind"]]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "not found"})
+	}
+	return kind, ok
+}
+
+// AdminSoftDeleteHandler godoc
+// @Summary      Soft-delete a user or page
+// @Description  Marks the user or page as deleted: it disappears from login, search, suggestions and the sitemap, and can be restored until the retention window (SOFT_DELETE_RETENTION) has passed. Admins cannot delete their own account. Admin only.
+// @Tags         Admin
+// @Security     sessionAuth
+// @Param        kind  path  string  true  "users or pages"
+// @Param        id    path  int     true  "User or page ID"
+// @Success      204
+// @Failure      400  {object}  APIErrorResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/{kind}/{id} [delete]
+func AdminSoftDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := kindFromRoute(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: kind.noun + " not found"})
+		return
+	}
+	if self, _ := currentUserID(r); kind.table == "users" && id == self {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "cannot delete your own account"})
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(),
+		`UPDATE `+kind.table+` SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`,
+		time.Now().UTC(), id,
+	)
+	if err != nil {
+		reportError(r, "soft delete error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete " + kind.noun})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: kind.noun + " not found"})
+		return
+	}
+	audit(r, kind.noun+".delete", kind.noun, id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminListDeletedHandler godoc
+// @Summary      List soft-deleted users or pages
+// @Description  Returns soft-deleted users or pages that can still be restored, newest first, with the time each will be purged. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        kind   path   string  true   "users or pages"
+// @Param        limit  query  int     false  "Max items returned (default 50, max 500)"
+// @Success      200  {object}  AdminDeletedResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/{kind}/deleted [get]
+func AdminListDeletedHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := kindFromRoute(w, r)
+	if !ok {
+		return
+	}
+	limit := adminDeletedDefaultLimit
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = min(n, adminDeletedMaxLimit)
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+SELECT id, `+kind.name+`, deleted_at
+FROM `+kind.table+`
+WHERE deleted_at >= $1
+ORDER BY deleted_at DESC, id DESC
+LIMIT $2`, softDeleteCutoff(), limit)
+	if err != nil {
+		reportError(r, "list deleted error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	resp := AdminDeletedResponse{Kind: kind.table, Retention: softDeleteRetention.String(), Items: []DeletedItem{}}
+	for rows.Next() {
+		var it DeletedItem
+		if err := rows.Scan(&it.ID, &it.Name, &it.DeletedAt); err != nil {
+			reportError(r, "list deleted scan error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+			return
+		}
+		it.PurgeAfter = it.DeletedAt.Add(softDeleteRetention)
+		resp.Items = append(resp.Items, it)
+	}
+	if err := rows.Err(); err != nil {
+		reportError(r, "list deleted error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// AdminRestoreHandler godoc
+// @Summary      Restore a soft-deleted user or page
+// @Description  Undoes a soft delete within the retention window. Admin only.
+// @Tags         Admin
+// @Security     sessionAuth
+// @Param        kind  path  string  true  "users or pages"
+// @Param        id    path  int     true  "User or page ID"
+// @Success      204
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse  "Not deleted, unknown or past the retention window"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/{kind}/{id}/restore [post]
+func AdminRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := kindFromRoute(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "deleted " + kind.noun + " not found"})
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(),
+		`UPDATE `+kind.table+` SET deleted_at = NULL WHERE id = $1 AND deleted_at >= $2`,
+		id, softDeleteCutoff(),
+	)
+	if err != nil {
+		reportError(r, "restore error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not restore " + kind.noun})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "deleted " + kind.noun + " not found"})
+		return
+	}
+	audit(r, kind.noun+".restore", kind.noun, id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeDeleted permanently removes users and pages soft-deleted longer ago than the retention.
+func purgeDeleted(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	cutoff := softDeleteCutoff()
+	for _, table := range []string{"users", "pages"} {
+		res, err := db.ExecContext(ctx, `DELETE FROM `+table+` WHERE deleted_at < $1`, cutoff)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("purged %d soft-deleted %s", n, table)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Usage statistics are anonymous: runTaggedSearch logs one search_log row per search (UTC day,
+// a hash of the normalised query, language and result count; no user, IP or query text), and
+// the stats_rollup task aggregates the log into stats_daily and stats_daily_languages for
+// GET /api/stats and the public /stats page. Statistics cover the whole site, all tenants.
+// enforce_retention deletes the raw log after SEARCH_LOG_RETENTION; the rollup is kept.
+
+const (
+	statsDefaultDays = 30
+	statsMaxDays     = 365
+	// Languages listed by GET /api/stats and /stats.
+	statsTopLanguages = 5
+)
+
+// statsLanguagePattern accepts the two-letter codes search_log can store; anything else is
+// logged without a language.
+var statsLanguagePattern = regexp.MustCompile(`^[a-z]{2}$`)
+
+// StatsDay is one day of GET /api/stats.
+type StatsDay struct {
+	Day                 string  `json:"day" example:"2026-10-17"`
+	Searches            int     `json:"searches"`
+	UniqueQueries       int     `json:"unique_queries"`
+	SearchesWithResults int     `json:"searches_with_results"`
+	HitRate             float64 `json:"hit_rate"` // share of searches with at least one result (0-1)
+	NewUsers            int     `json:"new_users"`
+}
+
+// StatsLanguage is a language's share of the searches in GET /api/stats.
+type StatsLanguage struct {
+	Language string  `json:"language" example:"en"`
+	Searches int     `json:"searches"`
+	Share    float64 `json:"share"` // 0-1
+}
+
+// StatsTotals sums the days of GET /api/stats (unique queries cannot be summed across days).
+type StatsTotals struct {
+	Searches            int     `json:"searches"`
+	SearchesWithResults int     `json:"searches_with_results"`
+	HitRate             float64 `json:"hit_rate"`
+	NewUsers            int     `json:"new_users"`
+}
+
+// StatsResponse is returned by GET /api/stats.
+type StatsResponse struct {
+	Days         []StatsDay      `json:"days"` // oldest first
+	Totals       StatsTotals     `json:"totals"`
+	TopLanguages []StatsLanguage `json:"top_languages"`
+}
+
+// logSearch records a search in search_log. Failures are only logged: statistics must never
+// break search.
+func logSearch(ctx context.Context, q, lang string, results int) {
+	if db == nil || databaseDown() {
+		return
+	}
+	if !statsLanguagePattern.MatchString(lang) {
+		lang = ""
+	}
+	sum := sha256.Sum256([]byte(q))
+	now := time.Now().UTC()
+	if _, err := db.ExecContext(context.WithoutCancel(ctx),
+		`INSERT INTO search_log (day, query_hash, language, results, searched_at) VALUES ($1, $2, $3, $4, $5)`,
+		now.Format(time.DateOnly), hex.EncodeToString(sum[:]), lang, results, now,
+	); err != nil {
+		log.Println("search log error:", err)
+	}
+}
+
+// usageDay accumulates one day of the usage rollup.
+type usageDay struct {
+	searches, uniqueQueries, withResults, newUsers int
+	languages                                      map[string]int
+}
+
+// rollupUsageStats recomputes stats_daily and stats_daily_languages for yesterday and today
+// (UTC). Both days are written even without searches, so charts have no gaps.
+func rollupUsageStats(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	since := now.Truncate(24*time.Hour).AddDate(0, 0, -1)
+	days := map[string]*usageDay{}
+	for _, d := range []time.Time{since, now} {
+		days[d.Format(time.DateOnly)] = &usageDay{languages: map[string]int{}}
+	}
+	day := func(key string) *usageDay {
+		d := days[key]
+		if d == nil { // a search logged just after midnight, while the rollup ran
+			d = &usageDay{languages: map[string]int{}}
+			days[key] = d
+		}
+		return d
+	}
+
+	err := queryRows(ctx, `
+SELECT CAST(day AS TEXT), COUNT(*), COUNT(DISTINCT query_hash), SUM(CASE WHEN results > 0 THEN 1 ELSE 0 END)
+FROM search_log
+WHERE day >= $1
+GROUP BY day`, []any{since.Format(time.DateOnly)}, func(scan func(...any) error) error {
+		var (
+			key string
+			s   usageDay
+		)
+		if err := scan(&key, &s.searches, &s.uniqueQueries, &s.withResults); err != nil {
+			return err
+		}
+		d := day(key)
+		d.searches, d.uniqueQueries, d.withResults = s.searches, s.uniqueQueries, s.withResults
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("aggregate searches: %w", err)
+	}
+
+	err = queryRows(ctx, `
+SELECT CAST(day AS TEXT), language, COUNT(*)
+FROM search_log
+WHERE day >= $1 AND language <> ''
+GROUP BY day, language`, []any{since.Format(time.DateOnly)}, func(scan func(...any) error) error {
+		var (
+			key, lang string
+			n         int
+		)
+		if err := scan(&key, &lang, &n); err != nil {
+			return err
+		}
+		day(key).languages[lang] = n
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("aggregate languages: %w", err)
+	}
+
+	// Registrations are bucketed in Go, like the click rollup, so the query stays portable.
+	err = queryRows(ctx, `SELECT created_at FROM users WHERE created_at >= $1`, []any{since},
+		func(scan func(...any) error) error {
+			var created time.Time
+			if err := scan(&created); err != nil {
+				return err
+			}
+			day(created.UTC().Format(time.DateOnly)).newUsers++
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("aggregate registrations: %w", err)
+	}
+
+	for key, d := range days {
+		if err := storeUsageDay(ctx, key, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeUsageDay replaces one day of stats_daily and its language breakdown.
+func storeUsageDay(ctx context.Context, key string, d *usageDay) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO stats_daily (day, searches, unique_queries, searches_with_results, new_users, updated_at)
+VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+ON CONFLICT (day) DO UPDATE SET
+  searches = excluded.searches,
+  unique_queries = excluded.unique_queries,
+  searches_with_results = excluded.searches_with_results,
+  new_users = excluded.new_users,
+  updated_at = excluded.updated_at`,
+		key, d.searches, d.uniqueQueries, d.withResults, d.newUsers,
+	); err != nil {
+		return fmt.Errorf("upsert usage stats: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM stats_daily_languages WHERE day = $1`, key); err != nil {
+		return err
+	}
+	for lang, n := range d.languages {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO stats_daily_languages (day, language, searches) VALUES ($1, $2, $3)`, key, lang, n,
+		); err != nil {
+			return fmt.Errorf("insert language stats: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// queryRows runs query and calls fn with a Scan function for each row.
+func queryRows(ctx context.Context, query string, args []any, fn func(scan func(...any) error) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+	for rows.Next() {
+		if err := fn(rows.Scan); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// loadStats reads the last n days (today included) of the rollup.
+func loadStats(ctx context.Context, n int) (StatsResponse, error) {
+	since := time.Now().UTC().AddDate(0, 0, -(n - 1)).Format(time.DateOnly)
+	resp := StatsResponse{Days: []StatsDay{}, TopLanguages: []StatsLanguage{}}
+
+	err := queryRows(ctx, `
+SELECT CAST(day AS TEXT), searches, unique_queries, searches_with_results, new_users
+FROM stats_daily
+WHERE day >= $1
+ORDER BY day`, []any{since}, func(scan func(...any) error) error {
+		var d StatsDay
+		if err := scan(&d.Day, &d.Searches, &d.UniqueQueries, &d.SearchesWithResults, &d.NewUsers); err != nil {
+			return err
+		}
+		d.HitRate = ratio(d.SearchesWithResults, d.Searches)
+		resp.Days = append(resp.Days, d)
+		resp.Totals.Searches += d.Searches
+		resp.Totals.SearchesWithResults += d.SearchesWithResults
+		resp.Totals.NewUsers += d.NewUsers
+		return nil
+	})
+	if err != nil {
+		return resp, err
+	}
+	resp.Totals.HitRate = ratio(resp.Totals.SearchesWithResults, resp.Totals.Searches)
+
+	var languageTotal int
+	err = queryRows(ctx, `
+SELECT language, SUM(searches)
+FROM stats_daily_languages
+WHERE day >= $1
+GROUP BY language`, []any{since}, func(scan func(...any) error) error {
+		var l StatsLanguage
+		if err := scan(&l.Language, &l.Searches); err != nil {
+			return err
+		}
+		languageTotal += l.Searches
+		resp.TopLanguages = append(resp.TopLanguages, l)
+		return nil
+	})
+	if err != nil {
+		return resp, err
+	}
+	sort.Slice(resp.TopLanguages, func(i, j int) bool {
+		a, b := resp.TopLanguages[i], resp.TopLanguages[j]
+		return a.Searches > b.Searches || (a.Searches == b.Searches && a.Language < b.Language)
+	})
+	resp.TopLanguages = resp.TopLanguages[:min(len(resp.TopLanguages), statsTopLanguages)]
+	for i := range resp.TopLanguages {
+		resp.TopLanguages[i].Share = ratio(resp.TopLanguages[i].Searches, languageTotal)
+	}
+	return resp, nil
+}
+
+// ratio is part/total, or 0 without a total.
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// statsDays reads ?days= (default 30, at most 365).
+func statsDays(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || n <= 0 {
+		return statsDefaultDays
+	}
+	return min(n, statsMaxDays)
+}
+
+// APIStatsHandler godoc
+// @Summary      Usage statistics
+// @Description  Anonymous daily usage statistics (searches, unique queries, hit rate, new registrations) and the top search languages, from the stats_rollup task. Public.
+// @Tags         Stats
+// @Produce      json
+// @Param        days  query  int  false  "Number of days up to today (default 30, max 365)"
+// @Success      200  {object}  StatsResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/stats [get]
+func APIStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := loadStats(r.Context(), statsDays(r))
+	if err != nil {
+		reportError(r, "load stats error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	// The rollup runs hourly, so a few minutes of caching costs nothing.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// statsBar is one bar of a /stats chart.
+type statsBar struct {
+	Label   string
+	Value   string
+	Percent int // bar length relative to the chart's largest value
+}
+
+// statsBars scales values to the largest one.
+func statsBars(labels []string, values []float64, format func(float64) string) []statsBar {
+	var top float64
+	for _, v := range values {
+		top = max(top, v)
+	}
+	bars := make([]statsBar, len(values))
+	for i, v := range values {
+		bars[i] = statsBar{Label: labels[i], Value: format(v)}
+		if top > 0 {
+			bars[i].Percent = int(v / top * 100)
+		}
+	}
+	return bars
+}
+
+// StatsPageHandler serves the public /stats page: the last 30 days as simple bar charts.
+func StatsPageHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]any{"Title": "Statistics"}
+	stats, err := loadStats(r.Context(), statsDefaultDays)
+	if err != nil {
+		reportError(r, "load stats error", err)
+		data["Unavailable"] = true
+		renderTemplate(w, r, "stats", data)
+		return
+	}
+
+	labels := make([]string, len(stats.Days))
+	searches := make([]float64, len(stats.Days))
+	hitRates := make([]float64, len(stats.Days))
+	newUsers := make([]float64, len(stats.Days))
+	for i, d := range stats.Days {
+		labels[i] = d.Day
+		searches[i] = float64(d.Searches)
+		hitRates[i] = d.HitRate * 100
+		newUsers[i] = float64(d.NewUsers)
+	}
+	langLabels := make([]string, len(stats.TopLanguages))
+	langShares := make([]float64, len(stats.TopLanguages))
+	for i, l := range stats.TopLanguages {
+		langLabels[i] = l.Language
+		langShares[i] = l.Share * 100
+	}
+	count := func(v float64) string { return strconv.Itoa(int(v)) }
+	percent := func(v float64) string { return strconv.FormatFloat(v, 'f', 0, 64) + "%" }
+
+	data["Stats"] = stats
+	data["HitRate"] = percent(stats.Totals.HitRate * 100)
+	data["Searches"] = statsBars(labels, searches, count)
+	data["HitRates"] = statsBars(labels, hitRates, percent)
+	data["NewUsers"] = statsBars(labels, newUsers, count)
+	data["Languages"] = statsBars(langLabels, langShares, percent)
+	renderTemplate(w, r, "stats", data)
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// The status page (/status, GET /api/status) combines the health of each dependency with the
+// degraded flags the handlers already track and the incidents admins post through
+// /admin/incidents. Results are cached briefly, so the public page cannot be used to hammer
+// the database with pings; incident changes refresh it immediately.
+
+// Component and overall states.
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusDown        = "down"   // components only
+	StatusOutage      = "outage" // overall: the database is down or a critical incident is open
+)
+
+const (
+	// statusCacheTTL is how long a status snapshot is served before dependencies are checked again.
+	statusCacheTTL = 10 * time.Second
+	// statusCheckTimeout bounds each dependency check.
+	statusCheckTimeout = 2 * time.Second
+	// statusRecentIncidents is how many resolved incidents the status page lists, from the
+	// last statusIncidentHistory.
+	statusRecentIncidents = 10
+	statusIncidentHistory = 30 * 24 * time.Hour
+
+	incidentBodyLimit     = 16 << 10
+	incidentTitleMaxLen   = 200
+	incidentMessageMaxLen = 5000
+)
+
+var (
+	incidentStatuses   = []string{"investigating", "identified", "monitoring", "resolved"}
+	incidentSeverities = []string{"minor", "major", "critical"}
+)
+
+// StatusCheck is an extra dependency shown on the status page (e.g. Redis); a non-nil error
+// reports it down.
+type StatusCheck struct {
+	Name  string // identifier in GET /api/status, e.g. "redis"
+	Label string // shown on /status
+	Check func(ctx context.Context) error
+}
+
+// statusChecks is set by SetStatusChecks.
+var statusChecks []StatusCheck
+
+// statusCache holds the last snapshot, and the last incidents loaded so they can still be
+// shown while the database is down.
+var statusCache struct {
+	mu        sync.Mutex
+	resp      StatusResponse
+	checkedAt time.Time
+	active    []Incident
+	recent    []Incident
+}
+
+// SetStatusChecks sets the dependencies checked for the status page besides the database,
+// read replica, external search and weather, which are always listed.
+func SetStatusChecks(checks ...StatusCheck) {
+	statusChecks = checks
+	invalidateStatus()
+}
+
+// invalidateStatus makes the next status request check everything again.
+func invalidateStatus() {
+	statusCache.mu.Lock()
+	statusCache.checkedAt = time.Time{}
+	statusCache.mu.Unlock()
+}
+
+// StatusComponent is one dependency on the status page.
+type StatusComponent struct {
+	Name    string `json:"name" example:"database"`
+	Label   string `json:"label" example:"Database"`
+	Status  string `json:"status" example:"operational"` // operational, degraded or down
+	Message string `json:"message,omitempty"`
+}
+
+// Incident is a status page incident.
+type Incident struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Message    string     `json:"message"`
+	Status     string     `json:"status" example:"investigating"` // investigating, identified, monitoring or resolved
+	Severity   string     `json:"severity" example:"minor"`       // minor, major or critical
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// StatusResponse is returned by GET /api/status.
+type StatusResponse struct {
+	Status          string            `json:"status" example:"operational"` // operational, degraded or outage
+	Components      []StatusComponent `json:"components"`
+	ActiveIncidents []Incident        `json:"active_incidents"`
+	RecentIncidents []Incident        `json:"recent_incidents"` // resolved in the last 30 days, newest first
+	CheckedAt       time.Time         `json:"checked_at"`
+}
+
+// IncidentRequest creates or changes an incident; omitted fields keep their value (or default).
+type IncidentRequest struct {
+	Title     *string    `json:"title"`
+	Message   *string    `json:"message"`
+	Status    *string    `json:"status"`
+	Severity  *string    `json:"severity"`
+	StartedAt *time.Time `json:"started_at"`
+}
+
+// IncidentsResponse is returned by GET /admin/incidents.
+type IncidentsResponse struct {
+	Incidents []Incident `json:"incidents"`
+}
+
+// currentStatus returns the cached snapshot, or checks every dependency when it has expired.
+func currentStatus(ctx context.Context) StatusResponse {
+	statusCache.mu.Lock()
+	defer statusCache.mu.Unlock()
+	if time.Since(statusCache.checkedAt) < statusCacheTTL {
+		return statusCache.resp
+	}
+
+	resp := StatusResponse{Status: StatusOperational, Components: checkComponents(ctx), CheckedAt: time.Now().UTC()}
+	active, recent, err := loadStatusIncidents(ctx)
+	if err != nil {
+		log.Println("status: load incidents error:", err)
+		active, recent = statusCache.active, statusCache.recent
+	} else {
+		statusCache.active, statusCache.recent = active, recent
+	}
+	resp.ActiveIncidents = append([]Incident{}, active...)
+	resp.RecentIncidents = append([]Incident{}, recent...)
+
+	for _, c := range resp.Components {
+		if c.Status != StatusOperational {
+			resp.Status = StatusDegraded
+		}
+	}
+	for _, i := range resp.ActiveIncidents {
+		if i.Severity == "critical" {
+			resp.Status = StatusOutage
+		} else if resp.Status == StatusOperational {
+			resp.Status = StatusDegraded
+		}
+	}
+	if resp.Components[0].Status == StatusDown { // the database
+		resp.Status = StatusOutage
+	}
+
+	statusCache.resp, statusCache.checkedAt = resp, time.Now()
+	return resp
+}
+
+// checkComponents checks the dependencies; the database always comes first.
+func checkComponents(ctx context.Context) []StatusComponent {
+	components := []StatusComponent{checkComponent(ctx, StatusCheck{Name: "database", Label: "Database", Check: CheckDatabase})}
+	if replicaDB != nil {
+		components = append(components, checkComponent(ctx, StatusCheck{Name: "read_replica", Label: "Read replica", Check: CheckReadReplica}))
+	}
+	for _, c := range statusChecks {
+		components = append(components, checkComponent(ctx, c))
+	}
+
+	// External services are not pinged: their state comes from the last real call.
+	serviceHealth.mu.Lock()
+	externalDown, weatherDown := serviceHealth.degraded[EventExternalSearch], serviceHealth.degraded[EventWeather]
+	serviceHealth.mu.Unlock()
+	if externalEnabled.Load() {
+		components = append(components, flagComponent("external_search", "External search (Wikipedia)", externalDown))
+	}
+	return append(components, flagComponent("weather", "Weather (DMI)", weatherDown))
+}
+
+func checkComponent(ctx context.Context, c StatusCheck) StatusComponent {
+	ctx, cancel := context.WithTimeout(ctx, statusCheckTimeout)
+	defer cancel()
+	label := cmp.Or(c.Label, c.Name)
+	if err := c.Check(ctx); err != nil {
+		log.Printf("status: %s check failed: %v", c.Name, err)
+		return StatusComponent{Name: c.Name, Label: label, Status: StatusDown, Message: "Not reachable"}
+	}
+	return StatusComponent{Name: c.Name, Label: label, Status: StatusOperational}
+}
+
+func flagComponent(name, label string, degraded bool) StatusComponent {
+	if degraded {
+		return StatusComponent{Name: name, Label: label, Status: StatusDegraded, Message: "Failing requests"}
+	}
+	return StatusComponent{Name: name, Label: label, Status: StatusOperational}
+}
+
+// loadStatusIncidents returns the unresolved incidents and the recently resolved ones.
+func loadStatusIncidents(ctx context.Context) (active, recent []Incident, err error) {
+	if db == nil {
+		return nil, nil, errDatabaseNotConfigured
+	}
+	if databaseDown() {
+		return nil, nil, errors.New("database unavailable")
+	}
+	active, err = queryIncidents(ctx, `WHERE status <> 'resolved' ORDER BY started_at DESC, id DESC`)
+	if err != nil {
+		return nil, nil, err
+	}
+	recent, err = queryIncidents(ctx, `WHERE status = 'resolved' AND resolved_at >= $1 ORDER BY resolved_at DESC, id DESC LIMIT $2`,
+		time.Now().UTC().Add(-statusIncidentHistory), statusRecentIncidents)
+	return active, recent, err
+}
+
+// queryIncidents selects incidents with the given WHERE/ORDER BY clause.
+func queryIncidents(ctx context.Context, clause string, args ...any) ([]Incident, error) {
+	incidents := []Incident{}
+	err := queryRows(ctx, `
+SELECT id, title, message, status, severity, started_at, resolved_at, updated_at FROM incidents `+clause,
+		args, func(scan func(...any) error) error {
+			i, err := scanIncident(scan)
+			if err != nil {
+				return err
+			}
+			incidents = append(incidents, i)
+			return nil
+		})
+	return incidents, err
+}
+
+func scanIncident(scan func(...any) error) (Incident, error) {
+	var (
+		i        Incident
+		resolved sql.NullTime
+	)
+	err := scan(&i.ID, &i.Title, &i.Message, &i.Status, &i.Severity, &i.StartedAt, &resolved, &i.UpdatedAt)
+	if resolved.Valid {
+		i.ResolvedAt = &resolved.Time
+	}
+	return i, err
+}
+
+func loadIncident(ctx context.Context, id int) (Incident, error) {
+	return scanIncident(db.QueryRowContext(ctx, `
+SELECT id, title, message, status, severity, started_at, resolved_at, updated_at FROM incidents WHERE id = $1`, id).Scan)
+}
+
+// decodeIncidentRequest reads and validates an IncidentRequest, answering 400 on bad input.
+func decodeIncidentRequest(w http.ResponseWriter, r *http.Request) (IncidentRequest, bool) {
+	var req IncidentRequest
+	if !decodeJSONBody(w, r, incidentBodyLimit, &req) {
+		return req, false
+	}
+	fail := func(msg string) (IncidentRequest, bool) {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: msg})
+		return req, false
+	}
+	if req.Title != nil {
+		title := strings.Join(strings.Fields(*req.Title), " ")
+		if title == "" {
+			return fail("title must not be empty")
+		}
+		if len([]rune(title)) > incidentTitleMaxLen {
+			return fail("title is too long (max 200 characters)")
+		}
+		req.Title = &title
+	}
+	if req.Message != nil {
+		message := strings.TrimSpace(*req.Message)
+		if len([]rune(message)) > incidentMessageMaxLen {
+			return fail("message is too long (max 5000 characters)")
+		}
+		req.Message = &message
+	}
+	if req.Status != nil && !slices.Contains(incidentStatuses, *req.Status) {
+		return fail("status must be one of " + strings.Join(incidentStatuses, ", "))
+	}
+	if req.Severity != nil && !slices.Contains(incidentSeverities, *req.Severity) {
+		return fail("severity must be one of " + strings.Join(incidentSeverities, ", "))
+	}
+	return req, true
+}
+
+// APIStatusHandler godoc
+// @Summary      Service status
+// @Description  Overall status, the state of each dependency (database, read replica, cache, external search, weather) and the active and recently resolved incidents. Checked at most every 10 seconds. Public.
+// @Tags         Health
+// @Produce      json
+// @Success      200  {object}  StatusResponse
+// @Router       /api/status [get]
+func APIStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=10")
+	writeJSON(w, http.StatusOK, currentStatus(r.Context()))
+}
+
+// StatusPageHandler serves the public /status page.
+func StatusPageHandler(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, r, "status", map[string]any{"Title": "Status", "Status": currentStatus(r.Context())})
+}
+
+// AdminIncidentsHandler godoc
+// @Summary      List incidents
+// @Description  Lists all status page incidents, newest first. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  IncidentsResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/incidents [get]
+func AdminIncidentsHandler(w http.ResponseWriter, r *http.Request) {
+	incidents, err := queryIncidents(r.Context(), `ORDER BY started_at DESC, id DESC`)
+	if err != nil {
+		reportError(r, "list incidents error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, IncidentsResponse{Incidents: incidents})
+}
+
+// AdminCreateIncidentHandler godoc
+// @Summary      Create an incident
+// @Description  Posts an incident on the status page. Only the title is required; status defaults to investigating, severity to minor and started_at to now. Admin only.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  IncidentRequest  true  "New incident"
+// @Success      201  {object}  Incident
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/incidents [post]
+func AdminCreateIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeIncidentRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Title == nil {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "title is required"})
+		return
+	}
+	now := time.Now().UTC()
+	i := Incident{Title: *req.Title, Status: "investigating", Severity: "minor", StartedAt: now, UpdatedAt: now}
+	applyIncidentRequest(&i, req, now)
+
+	err := db.QueryRowContext(r.Context(), `
+INSERT INTO incidents (title, message, status, severity, started_at, resolved_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id`, i.Title, i.Message, i.Status, i.Severity, i.StartedAt, i.ResolvedAt, i.UpdatedAt).Scan(&i.ID)
+	if err != nil {
+		reportError(r, "create incident error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not create incident"})
+		return
+	}
+	invalidateStatus()
+	audit(r, "incident.create", "incident", i.ID, map[string]any{"title": i.Title, "status": i.Status, "severity": i.Severity})
+	writeJSON(w, http.StatusCreated, i)
+}
+
+// applyIncidentRequest copies the given fields into i. Resolving stamps resolved_at; any
+// other status reopens the incident.
+func applyIncidentRequest(i *Incident, req IncidentRequest, now time.Time) {
+	if req.Title != nil {
+		i.Title = *req.Title
+	}
+	if req.Message != nil {
+		i.Message = *req.Message
+	}
+	if req.Severity != nil {
+		i.Severity = *req.Severity
+	}
+	if req.StartedAt != nil {
+		i.StartedAt = req.StartedAt.UTC()
+	}
+	if req.Status != nil {
+		i.Status = *req.Status
+	}
+	switch {
+	case i.Status == "resolved" && i.ResolvedAt == nil:
+		i.ResolvedAt = &now
+	case i.Status != "resolved":
+		i.ResolvedAt = nil
+	}
+	i.UpdatedAt = now
+}
+
+// AdminUpdateIncidentHandler godoc
+// @Summary      Update an incident
+// @Description  Changes an incident's title, message, status, severity or start time. Setting status to resolved stamps resolved_at; any other status reopens it. Admin only.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id    path  int              true  "Incident ID"
+// @Param        body  body  IncidentRequest  true  "Fields to change"
+// @Success      200  {object}  Incident
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/incidents/{id} [patch]
+func AdminUpdateIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "incident not found"})
+		return
+	}
+	req, ok := decodeIncidentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	i, err := loadIncident(ctx, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "incident not found"})
+		return
+	case err != nil:
+		reportError(r, "load incident error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	before := i
+	applyIncidentRequest(&i, req, time.Now().UTC())
+
+	if _, err := db.ExecContext(ctx, `
+UPDATE incidents SET title = $1, message = $2, status = $3, severity = $4, started_at = $5, resolved_at = $6, updated_at = $7
+WHERE id = $8`, i.Title, i.Message, i.Status, i.Severity, i.StartedAt, i.ResolvedAt, i.UpdatedAt, i.ID); err != nil {
+		reportError(r, "update incident error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save incident"})
+		return
+	}
+	invalidateStatus()
+
+	changes := map[string]any{}
+	if before.Status != i.Status {
+		changes["status"] = map[string]any{"from": before.Status, "to": i.Status}
+	}
+	if before.Severity != i.Severity {
+		changes["severity"] = map[string]any{"from": before.Severity, "to": i.Severity}
+	}
+	if before.Title != i.Title {
+		changes["title"] = map[string]any{"from": before.Title, "to": i.Title}
+	}
+	audit(r, "incident.update", "incident", i.ID, changes)
+	writeJSON(w, http.StatusOK, i)
+}
+
+// AdminDeleteIncidentHandler godoc
+// @Summary      Delete an incident
+// @Description  Removes an incident from the status page (e.g. one posted by mistake); resolve real incidents instead, so they stay in the history. Admin only.
+// @Tags         Admin
+// @Security     sessionAuth
+// @Param        id  path  int  true  "Incident ID"
+// @Success      204
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/incidents/{id} [delete]
+func AdminDeleteIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "incident not found"})
+		return
+	}
+	res, err := db.ExecContext(r.Context(), `DELETE FROM incidents WHERE id = $1`, id)
+	if err != nil {
+		reportError(r, "delete incident error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete incident"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "incident not found"})
+		return
+	}
+	invalidateStatus()
+	audit(r, "incident.delete", "incident", id, map[string]any{})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+)
+
+// Tags group pages by topic for curated browsing. Admins create tags and assign them to pages;
+// /search?tag=<slug> (and /api/search) filters results by tag, and the search page shows a
+// tag cloud of the most used ones. Tags are addressed by slug, a lowercase form of the name.
+
+const (
+	tagMaxLen      = 40 // runes, of the slug and of the name
+	tagBodyLimit   = 16 << 10
+	maxPageTags    = 20
+	tagCloudLimit  = 30
+	tagCloudLevels = 5 // weight classes tag-1 .. tag-5 in the cloud
+)
+
+// Tag is a topic label. Pages counts the non-deleted pages carrying it (in listings only).
+type Tag struct {
+	ID     int    `json:"id" example:"3"`
+	Slug   string `json:"slug" example:"devops"`
+	Name   string `json:"name" example:"DevOps"`
+	Pages  int    `json:"pages,omitempty" example:"12"`
+	Weight int    `json:"-"` // tag cloud size class, 1 (least used) to tagCloudLevels
+}
+
+// APITagsResponse is returned by GET /api/tags, GET /admin/tags and PUT /api/pages/{id}/tags.
+type APITagsResponse struct {
+	Tags []Tag `json:"tags"`
+}
+
+// TagRequest is the body accepted by POST /admin/tags and PATCH /admin/tags/{id}.
+type TagRequest struct {
+	Name string `json:"name" example:"DevOps"`
+	Slug string `json:"slug,omitempty" example:"devops"` // derived from the name when empty
+}
+
+// PageTagsUpdate is the body accepted by PUT /api/pages/{id}/tags. Unknown tags are created.
+type PageTagsUpdate struct {
+	Tags []string `json:"tags" example:"DevOps,Go"`
+}
+
+// tagSlug normalises a tag name or slug: lowercase letters and digits, with runs of spaces,
+// dashes, underscores and dots turned into a single dash. Other characters are dropped.
+func tagSlug(s string) string {
+	var b strings.Builder
+	n, dash := 0, false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && n > 0 {
+				if n+1 >= tagMaxLen {
+					return b.String()
+				}
+				b.WriteByte('-')
+				n++
+			}
+			dash = false
+			b.WriteRune(r)
+			n++
+			if n == tagMaxLen {
+				return b.String()
+			}
+		case unicode.IsSpace(r) || r == '-' || r == '_' || r == '.':
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// tagName trims and shortens a display name.
+func tagName(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > tagMaxLen {
+		s = strings.TrimSpace(string(r[:tagMaxLen]))
+	}
+	return s
+}
+
+func queryTags(ctx context.Context, query string, args ...any) ([]Tag, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	out := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Slug, &t.Name, &t.Pages); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// pageTags returns the tags of a page, sorted by name.
+func pageTags(ctx context.Context, pageID int) ([]Tag, error) {
+	return queryTags(ctx, `
+SELECT t.id, t.slug, t.name, 0
+FROM tags t
+JOIN page_tags pt ON pt.tag_id = t.id
+WHERE pt.page_id = $1
+ORDER BY t.name`, pageID)
+}
+
+// tagCloud returns the most used tags among the context tenant's live pages in lang (all
+// languages when empty), sorted by slug and weighted by usage for display.
+func tagCloud(ctx context.Context, lang string) ([]Tag, error) {
+	tags, err := queryTags(ctx, `
+SELECT t.id, t.slug, t.name, COUNT(p.id)
+FROM tags t
+JOIN page_tags pt ON pt.tag_id = t.id
+JOIN pages p ON p.id = pt.page_id
+WHERE p.deleted_at IS NULL
+  AND p.tenant_id = $3
+  AND ($1 = '' OR p.language = $1)
+GROUP BY t.id, t.slug, t.name
+ORDER BY COUNT(p.id) DESC, t.slug
+LIMIT $2`, lang, tagCloudLimit, tenantID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	lo, hi := 0, 0
+	for i, t := range tags {
+		if i == 0 || t.Pages < lo {
+			lo = t.Pages
+		}
+		hi = max(hi, t.Pages)
+	}
+	for i := range tags {
+		tags[i].Weight = 1
+		if hi > lo {
+			tags[i].Weight = 1 + (tags[i].Pages-lo)*(tagCloudLevels-1)/(hi-lo)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Slug < tags[j].Slug })
+	return tags, nil
+}
+
+// loadTagCloud is tagCloud for page rendering: failures are logged and show no cloud.
+func loadTagCloud(r *http.Request, lang string) []Tag {
+	if db == nil || databaseDown() {
+		return nil
+	}
+	tags, err := tagCloud(r.Context(), lang)
+	if err != nil {
+		reportError(r, "tag cloud error", err)
+		return nil
+	}
+	return tags
+}
+
+// ensureTag returns the ID of the tag with name's slug, creating it when missing.
+func ensureTag(ctx context.Context, tx *sql.Tx, name string) (int, error) {
+	slug := tagSlug(name)
+	var id int
+	err := tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE slug = $1`, slug).Scan(&id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return id, err
+	}
+	err = tx.QueryRowContext(ctx, `
+INSERT INTO tags (slug, name, created_at) VALUES ($1, $2, $3)
+RETURNING id`, slug, tagName(name), time.Now().UTC()).Scan(&id)
+	return id, err
+}
+
+// decodeTagRequest reads and validates a TagRequest. Missing fields stay empty.
+func decodeTagRequest(w http.ResponseWriter, r *http.Request) (TagRequest, bool) {
+	var req TagRequest
+	if !decodeJSONBody(w, r, tagBodyLimit, &req) {
+		return req, false
+	}
+	req.Name = tagName(req.Name)
+	if req.Slug != "" {
+		req.Slug = tagSlug(req.Slug)
+		if req.Slug == "" {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "slug must contain a letter or digit"})
+			return req, false
+		}
+	}
+	return req, true
+}
+
+// slugTaken reports whether another tag already uses slug.
+func slugTaken(ctx context.Context, slug string, exceptID int) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM tags WHERE slug = $1 AND id <> $2`, slug, exceptID).Scan(&n)
+	return n > 0, err
+}
+
+// APITagsHandler godoc
+// @Summary      Tag cloud
+// @Description  Returns the most used tags (up to 30) with the number of pages carrying each, sorted by slug.
+// @Tags         Tags
+// @Produce      json
+// @Param        language  query  string  false  "Only count pages in this language (en or da)"
+// @Success      200  {object}  APITagsResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/tags [get]
+func APITagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := tagCloud(r.Context(), r.URL.Query().Get("language"))
+	if err != nil {
+		reportError(r, "tag cloud error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APITagsResponse{Tags: tags})
+}
+
+// AdminListTagsHandler godoc
+// @Summary      List tags
+// @Description  Returns every tag, including unused ones, with its page count. Admin only.
+// @Tags         Tags
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  APITagsResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/tags [get]
+func AdminListTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := queryTags(r.Context(), `
+SELECT t.id, t.slug, t.name, COUNT(p.id)
+FROM tags t
+LEFT JOIN page_tags pt ON pt.tag_id = t.id
+LEFT JOIN pages p ON p.id = pt.page_id AND p.deleted_at IS NULL
+GROUP BY t.id, t.slug, t.name
+ORDER BY t.slug`)
+	if err != nil {
+		reportError(r, "list tags error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APITagsResponse{Tags: tags})
+}
+
+// AdminCreateTagHandler godoc
+// @Summary      Create a tag
+// @Description  Creates a tag. The slug is derived from the name unless given. Admin only.
+// @Tags         Tags
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  TagRequest  true  "New tag"
+// @Success      201  {object}  Tag
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse  "Slug already in use"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/tags [post]
+func AdminCreateTagHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeTagRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Slug == "" {
+		req.Slug = tagSlug(req.Name)
+	}
+	if req.Name == "" || req.Slug == "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "name must contain a letter or digit"})
+		return
+	}
+
+	ctx := r.Context()
+	taken, err := slugTaken(ctx, req.Slug, 0)
+	if err != nil {
+		reportError(r, "tag slug check error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	if taken {
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: "tag already exists"})
+		return
+	}
+
+	t := Tag{Slug: req.Slug, Name: req.Name}
+	err = db.QueryRowContext(ctx, `
+INSERT INTO tags (slug, name, created_at) VALUES ($1, $2, $3)
+RETURNING id`, t.Slug, t.Name, time.Now().UTC()).Scan(&t.ID)
+	if err != nil {
+		reportError(r, "create tag error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not create tag"})
+		return
+	}
+	audit(r, "tag.create", "tag", t.ID, map[string]any{"slug": t.Slug, "name": t.Name})
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// AdminUpdateTagHandler godoc
+// @Summary      Rename a tag
+// @Description  Changes the name and/or slug of a tag. Links using the old slug stop matching. Admin only.
+// @Tags         Tags
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id    path  int         true  "Tag ID"
+// @Param        body  body  TagRequest  true  "Fields to change"
+// @Success      200  {object}  Tag
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse  "Slug already in use"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/tags/{id} [patch]
+func AdminUpdateTagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "tag not found"})
+		return
+	}
+	req, ok := decodeTagRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	var t Tag
+	err = db.QueryRowContext(ctx, `SELECT id, slug, name FROM tags WHERE id = $1`, id).Scan(&t.ID, &t.Slug, &t.Name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "tag not found"})
+		return
+	case err != nil:
+		reportError(r, "load tag error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+
+	changes := map[string]any{}
+	if req.Name != "" && req.Name != t.Name {
+		changes["name"] = map[string]any{"from": t.Name, "to": req.Name}
+		t.Name = req.Name
+	}
+	if req.Slug != "" && req.Slug != t.Slug {
+		taken, err := slugTaken(ctx, req.Slug, t.ID)
+		if err != nil {
+			reportError(r, "tag slug check error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+			return
+		}
+		if taken {
+			writeJSON(w, http.StatusConflict, APIErrorResponse{Error: "slug already in use"})
+			return
+		}
+		changes["slug"] = map[string]any{"from": t.Slug, "to": req.Slug}
+		t.Slug = req.Slug
+	}
+	if len(changes) == 0 {
+		writeJSON(w, http.StatusOK, t)
+		return
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE tags SET slug = $1, name = $2 WHERE id = $3`, t.Slug, t.Name, t.ID); err != nil {
+		reportError(r, "update tag error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save tag"})
+		return
+	}
+	audit(r, "tag.update", "tag", t.ID, changes)
+	writeJSON(w, http.StatusOK, t)
+}
+
+// AdminDeleteTagHandler godoc
+// @Summary      Delete a tag
+// @Description  Deletes a tag and removes it from all pages. Admin only.
+// @Tags         Tags
+// @Security     sessionAuth
+// @Param        id  path  int  true  "Tag ID"
+// @Success      204
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/tags/{id} [delete]
+func AdminDeleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "tag not found"})
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		reportError(r, "delete tag error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var slug string
+	err = tx.QueryRowContext(ctx, `SELECT slug FROM tags WHERE id = $1`, id).Scan(&slug)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "tag not found"})
+		return
+	case err != nil:
+		reportError(r, "load tag error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	// page_tags cascades in PostgreSQL; deleting explicitly keeps SQLite (no foreign key
+	// enforcement by default) consistent too.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM page_tags WHERE tag_id = $1`, id); err != nil {
+		reportError(r, "delete tag error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete tag"})
+		return
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = $1`, id); err != nil {
+		reportError(r, "delete tag error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete tag"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		reportError(r, "delete tag error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete tag"})
+		return
+	}
+	audit(r, "tag.delete", "tag", id, map[string]any{"slug": slug})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APISetPageTagsHandler godoc
+// @Summary      Set page tags
+// @Description  Replaces the tags of a page with the given names (at most 20). Tags that do not exist yet are created. Admin only.
+// @Tags         Tags
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id    path  int             true  "Page ID"
+// @Param        body  body  PageTagsUpdate  true  "Tag names"
+// @Success      200  {object}  APITagsResponse  "The page's tags"
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/pages/{id}/tags [put]
+func APISetPageTagsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return
+	}
+	var upd PageTagsUpdate
+	if !decodeJSONBody(w, r, tagBodyLimit, &upd) {
+		return
+	}
+
+	// Deduplicate by slug, keeping the first spelling of each name.
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range upd.Tags {
+		slug := tagSlug(name)
+		if slug == "" {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "tag names must contain a letter or digit"})
+			return
+		}
+		if !seen[slug] {
+			seen[slug] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) > maxPageTags {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "too many tags (max 20)"})
+		return
+	}
+
+	ctx := r.Context()
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pages WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL`, id, tenantID(ctx)).Scan(&exists); err != nil {
+		reportError(r, "page lookup error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	if exists == 0 {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return
+	}
+
+	if err := replacePageTags(ctx, id, names); err != nil {
+		reportError(r, "set page tags error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save tags"})
+		return
+	}
+	tags, err := pageTags(ctx, id)
+	if err != nil {
+		reportError(r, "load page tags error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	slugs := make([]string, len(tags))
+	for i, t := range tags {
+		slugs[i] = t.Slug
+	}
+	audit(r, "page.tags", "page", id, map[string]any{"tags": slugs})
+	writeJSON(w, http.StatusOK, APITagsResponse{Tags: tags})
+}
+
+// replacePageTags sets the tags of a page in one transaction, creating missing tags.
+func replacePageTags(ctx context.Context, pageID int, names []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM page_tags WHERE page_id = $1`, pageID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		tagID, err := ensureTag(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO page_tags (page_id, tag_id) VALUES ($1, $2)`, pageID, tagID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"devops-valgfag/internal/scheduler"
+
+	"github.com/gorilla/mux"
+)
+
+// Scheduled task names registered by RegisterScheduledTasks.
+const (
+	TaskEvictCaches          = "evict_caches"
+	TaskRegenerateSitemap    = "regenerate_sitemap"
+	TaskRunSavedSearches     = "run_saved_searches"
+	TaskStatsRollup          = "stats_rollup"
+	TaskRefreshExternalCache = "refresh_external_cache"
+	TaskCheckReadReplica     = "check_read_replica"
+	TaskCheckDatabase        = "check_database"
+	TaskPurgeDeleted         = "purge_deleted"
+	TaskPromoteExternal      = "promote_external_results"
+	TaskBackupDatabase       = "backup_database"
+	TaskFlushTrafficStats    = "flush_traffic_stats"
+	TaskEnforceRetention     = "enforce_retention"
+)
+
+const (
+	// External results not seen for this long are re-scraped by refresh_external_cache (and
+	// deleted by enforce_retention after EXTERNAL_CACHE_RETENTION).
+	externalCacheRefreshAge = 7 * 24 * time.Hour
+	// Max queries re-scraped per refresh run, to stay polite to Wikipedia.
+	externalRefreshBatch = 20
+)
+
+// taskScheduler is set by SetScheduler; the admin scheduler endpoints return 503 without it.
+var taskScheduler *scheduler.Scheduler
+
+// ScheduleConfig holds the env-configurable task intervals.
+type ScheduleConfig struct {
+	SitemapRefresh      time.Duration
+	SavedSearchInterval time.Duration
+	BackupInterval      time.Duration // 0 disables scheduled backups
+}
+
+// SchedulerStatusResponse is returned by GET /admin/scheduler.
+type SchedulerStatusResponse struct {
+	Enabled bool                   `json:"enabled"` // SCHEDULER_ENABLED on this replica
+	Leader  bool                   `json:"leader"`  // this replica runs the cluster-wide tasks
+	Tasks   []scheduler.TaskStatus `json:"tasks"`
+}
+
+// SetScheduler makes the scheduler available to the admin endpoints.
+func SetScheduler(s *scheduler.Scheduler) {
+	taskScheduler = s
+}
+
+// RegisterScheduledTasks registers the periodic maintenance tasks on s.
+// Sitemap regeneration, cache eviction and the traffic flush touch in-process state, so they run
+// on every replica.
+func RegisterScheduledTasks(s *scheduler.Scheduler, cfg ScheduleConfig) {
+	s.Add(scheduler.Task{
+		Name:     TaskEvictCaches,
+		Interval: 10 * time.Minute,
+		Local:    true,
+		Run:      evictCaches,
+	})
+	s.Add(scheduler.Task{
+		Name:       TaskRegenerateSitemap,
+		Interval:   cfg.SitemapRefresh,
+		RunAtStart: true,
+		Local:      true,
+		Run: func(ctx context.Context) error {
+			status, err := RegenerateSitemap(ctx)
+			if err == nil {
+				log.Printf("sitemap regenerated (urls=%d files=%d)", status.URLs, status.Files)
+			}
+			return err
+		},
+	})
+	s.Add(scheduler.Task{
+		Name:     TaskRunSavedSearches,
+		Interval: cfg.SavedSearchInterval,
+		Run: func(ctx context.Context) error {
+			n, err := RunSavedSearches(ctx)
+			if n > 0 {
+				log.Printf("saved searches: %d notification(s) created", n)
+			}
+			return err
+		},
+	})
+	s.Add(scheduler.Task{
+		Name:     TaskStatsRollup,
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			if err := rollupClickStats(ctx); err != nil {
+				return err
+			}
+			if err := pruneTrafficStats(ctx); err != nil {
+				return err
+			}
+			return rollupUsageStats(ctx)
+		},
+	})
+	s.Add(scheduler.Task{
+		Name:     TaskFlushTrafficStats,
+		Interval: time.Minute,
+		Local:    true,
+		Run:      FlushTrafficStats,
+	})
+	s.Add(scheduler.Task{
+		Name:     TaskRefreshExternalCache,
+		Interval: 6 * time.Hour,
+		Run:      refreshExternalCache,
+	})
+	s.Add(scheduler.Task{
+		Name:     TaskPromoteExternal,
+		Interval: 24 * time.Hour,
+		Run:      promoteExternalResults,
+	})
+	s.Add(scheduler.Task{
+		Name:     TaskEnforceRetention,
+		Interval: time.Hour,
+		Run:      enforceRetention,
+	})
+	s.Add(scheduler.Task{
+		Name:     TaskPurgeDeleted,
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			if err := purgeDeleted(ctx); err != nil {
+				return err
+			}
+			if err := pruneRememberTokens(ctx); err != nil {
+				return err
+			}
+			if err := pruneAPIUsage(ctx); err != nil {
+				return err
+			}
+			return pruneSessions(ctx)
+		},
+	})
+	if cfg.BackupInterval > 0 {
+		s.Add(scheduler.Task{
+			Name:     TaskBackupDatabase,
+			Interval: cfg.BackupInterval,
+			Run:      backupDatabaseTask,
+		})
+	}
+	s.Add(scheduler.Task{
+		Name:     TaskCheckDatabase,
+		Interval: 10 * time.Second,
+		Local:    true,
+		Run:      CheckDatabase,
+	})
+	if replicaDB != nil {
+		s.Add(scheduler.Task{
+			Name:     TaskCheckReadReplica,
+			Interval: 15 * time.Second,
+			Local:    true,
+			Run:      CheckReadReplica,
+		})
+	}
+}
+
+// evictCaches expires the in-memory weather forecast.
+func evictCaches(context.Context) error {
+	weatherService.Evict()
+	return nil
+}
+
+// refreshExternalCache enqueues scrape_external jobs for the stalest cached external queries.
+func refreshExternalCache(ctx context.Context) error {
+	if db == nil || jobQueue == nil || !externalEnabled.Load() {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+SELECT query, language, tenant_id
+FROM external_results
+GROUP BY query, language, tenant_id
+HAVING MAX(created_at) < $1
+ORDER BY MAX(created_at)
+LIMIT $2`, time.Now().UTC().Add(-externalCacheRefreshAge), externalRefreshBatch)
+	if err != nil {
+		return err
+	}
+	// Load everything first: no open cursor while enqueueing below.
+	var stale []ScrapeExternalPayload
+	func() {
+		defer func() {
+			if cerr := rows.Close(); cerr != nil {
+				log.Println(rowsCloseErrMsg, cerr)
+			}
+		}()
+		for rows.Next() {
+			var p ScrapeExternalPayload
+			if err = rows.Scan(&p.Query, &p.Language, &p.TenantID); err != nil {
+				return
+			}
+			stale = append(stale, p)
+		}
+		err = rows.Err()
+	}()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range stale {
+		if _, err := jobQueue.Enqueue(ctx, JobScrapeExternal, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clickStatsKey identifies one row of search_click_stats_daily.
+type clickStatsKey struct {
+	day, query, language string
+}
+
+// rollupClickStats recomputes the daily click rollup for yesterday and today (UTC).
+// Days are bucketed in Go so the same code works on PostgreSQL and SQLite.
+func rollupClickStats(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT query, language, rank, clicked_at FROM search_clicks WHERE clicked_at >= $1`,
+		since,
+	)
+	if err != nil {
+		return err
+	}
+	type agg struct{ clicks, rankSum int }
+	stats := map[clickStatsKey]*agg{}
+	func() {
+		defer func() {
+			if cerr := rows.Close(); cerr != nil {
+				log.Println(rowsCloseErrMsg, cerr)
+			}
+		}()
+		for rows.Next() {
+			var (
+				k         clickStatsKey
+				rank      int
+				clickedAt time.Time
+			)
+			if err = rows.Scan(&k.query, &k.language, &rank, &clickedAt); err != nil {
+				return
+			}
+			k.day = clickedAt.UTC().Format(time.DateOnly)
+			a := stats[k]
+			if a == nil {
+				a = &agg{}
+				stats[k] = a
+			}
+			a.clicks++
+			a.rankSum += rank
+		}
+		err = rows.Err()
+	}()
+	if err != nil {
+		return err
+	}
+
+	for k, a := range stats {
+		_, err := db.ExecContext(ctx, `
+INSERT INTO search_click_stats_daily (day, query, language, clicks, avg_rank, updated_at)
+VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+ON CONFLICT (day, query, language) DO UPDATE SET
+  clicks = excluded.clicks,
+  avg_rank = excluded.avg_rank,
+  updated_at = excluded.updated_at`,
+			k.day, k.query, k.language, a.clicks, float64(a.rankSum)/float64(a.clicks),
+		)
+		if err != nil {
+			return fmt.Errorf("upsert click stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// AdminSchedulerHandler godoc
+// @Summary      Scheduled task status
+// @Description  Lists the periodic tasks with interval, last run, duration, error and next run. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  SchedulerStatusResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /admin/scheduler [get]
+func AdminSchedulerHandler(w http.ResponseWriter, r *http.Request) {
+	if taskScheduler == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "scheduler not configured"})
+		return
+	}
+	writeJSON(w, http.StatusOK, SchedulerStatusResponse{
+		Enabled: taskScheduler.Enabled(),
+		Leader:  taskScheduler.IsLeader(r.Context()),
+		Tasks:   taskScheduler.Status(),
+	})
+}
+
+// AdminRunTaskHandler godoc
+// @Summary      Run scheduled task now
+// @Description  Runs a scheduled task immediately on this replica and returns the updated task list. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        name  path  string  true  "Task name"
+// @Success      200  {object}  SchedulerStatusResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Failure      503  {object}  APIErrorResponse
+// @Router       /admin/scheduler/{name}/run [post]
+func AdminRunTaskHandler(w http.ResponseWriter, r *http.Request) {
+	if taskScheduler == nil {
+		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: "scheduler not configured"})
+		return
+	}
+	name := mux.Vars(r)["name"]
+
+	known := false
+	for _, t := range taskScheduler.Status() {
+		known = known || t.Name == name
+	}
+	if !known {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "task not found"})
+		return
+	}
+
+	started, err := taskScheduler.RunNow(r.Context(), name)
+	switch {
+	case !started:
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: "task is already running"})
+		return
+	case err != nil:
+		// The error itself is logged by the scheduler and shown as last_error in GET /admin/scheduler.
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "task failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, SchedulerStatusResponse{
+		Enabled: taskScheduler.Enabled(),
+		Leader:  taskScheduler.IsLeader(r.Context()),
+		Tasks:   taskScheduler.Status(),
+	})
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// templateReloader re-parses the template glob when a file changes (dev mode only).
+// In prod it stays disabled and renderTemplate uses the set parsed once at startup.
+var templateReloader struct {
+	mu      sync.Mutex
+	enabled atomic.Bool // checked without the mutex so prod renders never contend
+	glob    string
+	funcs   template.FuncMap
+	modTime time.Time
+}
+
+// EnableTemplateReload turns on per-request template hot-reload (TEMPLATE_RELOAD=1).
+// glob and funcs must match what main used to parse the initial set.
+func EnableTemplateReload(glob string, funcs template.FuncMap) {
+	templateReloader.mu.Lock()
+	defer templateReloader.mu.Unlock()
+
+	templateReloader.glob = glob
+	templateReloader.funcs = funcs
+	templateReloader.modTime, _ = latestModTime(glob)
+	templateReloader.enabled.Store(true)
+}
+
+// templates returns the template set to render with.
+// With reload enabled, it re-parses the glob if any file is newer than the last parse;
+// a broken template is logged and the previous set keeps serving.
+func templates() *template.Template {
+	if !templateReloader.enabled.Load() {
+		return tmpl
+	}
+
+	templateReloader.mu.Lock()
+	defer templateReloader.mu.Unlock()
+
+	latest, err := latestModTime(templateReloader.glob)
+	if err != nil {
+		log.Println("template reload: stat error:", err)
+		return tmpl
+	}
+	if !latest.After(templateReloader.modTime) {
+		return tmpl
+	}
+
+	parsed, err := template.New("").Funcs(templateReloader.funcs).ParseGlob(templateReloader.glob)
+	if err != nil {
+		log.Println("template reload: parse error (keeping previous templates):", err)
+		return tmpl
+	}
+
+	log.Println("template reload: templates re-parsed")
+	tmpl = parsed
+	templateReloader.modTime = latest
+	return tmpl
+}
+
+// latestModTime returns the newest modification time among files matching glob.
+func latestModTime(glob string) (time.Time, error) {
+	files, err := filepath.Glob(glob)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
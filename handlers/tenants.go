@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Tenants are separate search corpora hosted by one instance. Every page and cached external
+// result belongs to one; a request is mapped to a tenant by its /t/<slug>/ path prefix or,
+// failing that, by its hostname, and everything else uses the default tenant (id 1), which
+// holds the data from before tenants existed. Search, suggestions, page views and external
+// enrichment only see the request's tenant. Users, tags and admin rights are shared.
+//
+// The path prefix is stripped before routing, so /t/docs/api/search is /api/search for the
+// docs tenant. HTML pages link to unprefixed paths, so the web UI of a tenant is best served
+// on its own hostname; the prefix suits API clients.
+
+const (
+	defaultTenantID  = 1
+	tenantPathPrefix = "/t/"
+	tenantBodyLimit  = 16 << 10
+	tenantNameMaxLen = 100
+	hostnameMaxLen   = 253
+
+	// Tenants are cached per process; changes made on another replica show up after this.
+	tenantRefreshInterval = 30 * time.Second
+)
+
+// Tenant is a search corpus. Pages counts its non-deleted pages (in listings only).
+type Tenant struct {
+	ID        int       `json:"id" example:"2"`
+	Slug      string    `json:"slug" example:"docs"`
+	Name      string    `json:"name" example:"Documentation"`
+	Hostname  string    `json:"hostname,omitempty" example:"docs.example.com"`
+	Pages     int       `json:"pages" example:"120"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APITenantsResponse is returned by GET /admin/tenants.
+type APITenantsResponse struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+// TenantRequest is the body accepted by POST /admin/tenants and PATCH /admin/tenants/{id}.
+// On PATCH, omitted fields are unchanged and an empty hostname removes it.
+type TenantRequest struct {
+	Slug     string  `json:"slug,omitempty" example:"docs"` // derived from the name when empty
+	Name     string  `json:"name" example:"Documentation"`
+	Hostname *string `json:"hostname,omitempty" example:"docs.example.com"`
+}
+
+// tenantRoute is what the middleware needs to resolve a tenant.
+type tenantRoute struct {
+	id int
+}
+
+// tenantRegistry is the per-process snapshot of the tenants table.
+var tenantRegistry struct {
+	sync.RWMutex
+	bySlug   map[string]tenantRoute
+	byHost   map[string]tenantRoute
+	loadedAt time.Time
+}
+
+type tenantKey struct{}
+
+// tenantID returns the tenant of a request context (the default tenant when none was resolved).
+func tenantID(ctx context.Context) int {
+	if t, ok := ctx.Value(tenantKey{}).(tenantRoute); ok {
+		return t.id
+	}
+	return defaultTenantID
+}
+
+// TenantMiddleware resolves the tenant of each request from its /t/<slug>/ path prefix (which
+// it strips) or its hostname. An unknown slug in the prefix is a 404. It has to wrap the
+// router, not be added with Use, since it changes the path the router matches.
+func TenantMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rest, ok := strings.CutPrefix(r.URL.Path, tenantPathPrefix); ok {
+				slug, path, _ := strings.Cut(rest, "/")
+				t, found := lookupTenant(r.Context(), func() (tenantRoute, bool) {
+					t, ok := tenantRegistry.bySlug[slug]
+					return t, ok
+				})
+				if !found {
+					http.NotFound(w, r)
+					return
+				}
+				r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, t))
+				r.URL.Path = "/" + path
+				r.URL.RawPath = ""
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			host := normalizeHostname(r.Host)
+			if t, found := lookupTenant(r.Context(), func() (tenantRoute, bool) {
+				t, ok := tenantRegistry.byHost[host]
+				return t, ok
+			}); found {
+				r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, t))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// lookupTenant runs find on a fresh enough tenant snapshot, reloading it when it is stale.
+// Without a database (or while it is down) the old snapshot is used.
+func lookupTenant(ctx context.Context, find func() (tenantRoute, bool)) (tenantRoute, bool) {
+	tenantRegistry.RLock()
+	stale := time.Since(tenantRegistry.loadedAt) > tenantRefreshInterval
+	tenantRegistry.RUnlock()
+	if stale && db != nil && !databaseDown() {
+		if err := reloadTenants(ctx); err != nil {
+			log.Println("tenant reload error:", err)
+		}
+	}
+
+	tenantRegistry.RLock()
+	defer tenantRegistry.RUnlock()
+	return find()
+}
+
+// reloadTenants replaces the tenant snapshot with the tenants table. A failed load still
+// counts as a refresh, so a broken database is not queried on every request.
+func reloadTenants(ctx context.Context) error {
+	bySlug := map[string]tenantRoute{}
+	byHost := map[string]tenantRoute{}
+	tenants, err := queryTenants(ctx)
+	for _, t := range tenants {
+		route := tenantRoute{id: t.ID}
+		bySlug[t.Slug] = route
+		if t.Hostname != "" {
+			byHost[t.Hostname] = route
+		}
+	}
+
+	tenantRegistry.Lock()
+	defer tenantRegistry.Unlock()
+	tenantRegistry.loadedAt = time.Now()
+	if err != nil {
+		return err
+	}
+	tenantRegistry.bySlug, tenantRegistry.byHost = bySlug, byHost
+	return nil
+}
+
+// invalidateTenants makes the next request reload the tenant snapshot.
+func invalidateTenants() {
+	tenantRegistry.Lock()
+	tenantRegistry.loadedAt = time.Time{}
+	tenantRegistry.Unlock()
+}
+
+// normalizeHostname lowercases a Host header or hostname and drops the port.
+func normalizeHostname(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// validHostname accepts dot-separated labels of letters, digits and dashes.
+func validHostname(host string) bool {
+	if host == "" || len(host) > hostnameMaxLen {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// queryTenants lists all tenants with their page counts, by id.
+func queryTenants(ctx context.Context) ([]Tenant, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT t.id, t.slug, t.name, COALESCE(t.hostname, ''), t.created_at, COUNT(p.id)
+FROM tenants t
+LEFT JOIN pages p ON p.tenant_id = t.id AND p.deleted_at IS NULL
+GROUP BY t.id, t.slug, t.name, t.hostname, t.created_at
+ORDER BY t.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			log.Println(rowsCloseErrMsg, cerr)
+		}
+	}()
+
+	out := []Tenant{}
+	for rows.Next() {
+		var t Tenant
+		if err := rows.Scan(&t.ID, &t.Slug, &t.Name, &t.Hostname, &t.CreatedAt, &t.Pages); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// loadTenant loads one tenant (without its page count).
+func loadTenant(ctx context.Context, id int) (Tenant, error) {
+	var t Tenant
+	err := db.QueryRowContext(ctx, `
+SELECT id, slug, name, COALESCE(hostname, ''), created_at FROM tenants WHERE id = $1`, id,
+	).Scan(&t.ID, &t.Slug, &t.Name, &t.Hostname, &t.CreatedAt)
+	return t, err
+}
+
+// decodeTenantRequest reads and normalises a TenantRequest, answering 400 on bad input.
+func decodeTenantRequest(w http.ResponseWriter, r *http.Request) (TenantRequest, bool) {
+	var req TenantRequest
+	if !decodeJSONBody(w, r, tenantBodyLimit, &req) {
+		return req, false
+	}
+	req.Name = strings.Join(strings.Fields(req.Name), " ")
+	req.Slug = tagSlug(req.Slug)
+	if req.Hostname != nil {
+		host := normalizeHostname(*req.Hostname)
+		if host != "" && !validHostname(host) {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "invalid hostname"})
+			return req, false
+		}
+		req.Hostname = &host
+	}
+	if len([]rune(req.Name)) > tenantNameMaxLen {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "name is too long (max 100 characters)"})
+		return req, false
+	}
+	return req, true
+}
+
+// tenantConflict reports which of slug and hostname another tenant than id already uses
+// ("" when neither is taken). An empty hostname is never taken.
+func tenantConflict(ctx context.Context, slug, hostname string, id int) (string, error) {
+	var n int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM tenants WHERE slug = $1 AND id <> $2`, slug, id).Scan(&n); err != nil {
+		return "", err
+	}
+	if n > 0 {
+		return "slug already in use", nil
+	}
+	if hostname == "" {
+		return "", nil
+	}
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM tenants WHERE hostname = $1 AND id <> $2`, hostname, id).Scan(&n); err != nil {
+		return "", err
+	}
+	if n > 0 {
+		return "hostname already in use", nil
+	}
+	return "", nil
+}
+
+// nullableHostname stores an empty hostname as NULL, so several tenants can go without one.
+func nullableHostname(host string) sql.NullString {
+	return sql.NullString{String: host, Valid: host != ""}
+}
+
+// AdminListTenantsHandler godoc
+// @Summary      List tenants
+// @Description  Lists all tenants (search corpora) with their hostnames and page counts. Admin only.
+// @Tags         Tenants
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  APITenantsResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/tenants [get]
+func AdminListTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	tenants, err := queryTenants(r.Context())
+	if err != nil {
+		reportError(r, "list tenants error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APITenantsResponse{Tenants: tenants})
+}
+
+// AdminCreateTenantHandler godoc
+// @Summary      Create a tenant
+// @Description  Creates a tenant, served under /t/<slug>/ and, if given, on its hostname. The slug is derived from the name unless given. Admin only.
+// @Tags         Tenants
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        body  body  TenantRequest  true  "New tenant"
+// @Success      201  {object}  Tenant
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse  "Slug or hostname already in use"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/tenants [post]
+func AdminCreateTenantHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeTenantRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Slug == "" {
+		req.Slug = tagSlug(req.Name)
+	}
+	if req.Name == "" || req.Slug == "" {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "name must contain a letter or digit"})
+		return
+	}
+	t := Tenant{Slug: req.Slug, Name: req.Name, CreatedAt: time.Now().UTC()}
+	if req.Hostname != nil {
+		t.Hostname = *req.Hostname
+	}
+
+	ctx := r.Context()
+	conflict, err := tenantConflict(ctx, t.Slug, t.Hostname, 0)
+	if err != nil {
+		reportError(r, "tenant conflict check error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	if conflict != "" {
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: conflict})
+		return
+	}
+
+	err = db.QueryRowContext(ctx, `
+INSERT INTO tenants (slug, name, hostname, created_at) VALUES ($1, $2, $3, $4)
+RETURNING id`, t.Slug, t.Name, nullableHostname(t.Hostname), t.CreatedAt).Scan(&t.ID)
+	if err != nil {
+		reportError(r, "create tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not create tenant"})
+		return
+	}
+	invalidateTenants()
+	audit(r, "tenant.create", "tenant", t.ID, map[string]any{"slug": t.Slug, "name": t.Name, "hostname": t.Hostname})
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// AdminUpdateTenantHandler godoc
+// @Summary      Update a tenant
+// @Description  Changes the name, slug and/or hostname of a tenant. The default tenant keeps its slug. Admin only.
+// @Tags         Tenants
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id    path  int            true  "Tenant ID"
+// @Param        body  body  TenantRequest  true  "Fields to change"
+// @Success      200  {object}  Tenant
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse  "Slug or hostname already in use"
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/tenants/{id} [patch]
+func AdminUpdateTenantHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "tenant not found"})
+		return
+	}
+	req, ok := decodeTenantRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	t, err := loadTenant(ctx, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "tenant not found"})
+		return
+	case err != nil:
+		reportError(r, "load tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+
+	changes := map[string]any{}
+	if req.Name != "" && req.Name != t.Name {
+		changes["name"] = map[string]any{"from": t.Name, "to": req.Name}
+		t.Name = req.Name
+	}
+	if req.Slug != "" && req.Slug != t.Slug {
+		if t.ID == defaultTenantID {
+			writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "the default tenant's slug cannot change"})
+			return
+		}
+		changes["slug"] = map[string]any{"from": t.Slug, "to": req.Slug}
+		t.Slug = req.Slug
+	}
+	if req.Hostname != nil && *req.Hostname != t.Hostname {
+		changes["hostname"] = map[string]any{"from": t.Hostname, "to": *req.Hostname}
+		t.Hostname = *req.Hostname
+	}
+	if len(changes) == 0 {
+		writeJSON(w, http.StatusOK, t)
+		return
+	}
+
+	conflict, err := tenantConflict(ctx, t.Slug, t.Hostname, t.ID)
+	if err != nil {
+		reportError(r, "tenant conflict check error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	if conflict != "" {
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: conflict})
+		return
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE tenants SET slug = $1, name = $2, hostname = $3 WHERE id = $4`,
+		t.Slug, t.Name, nullableHostname(t.Hostname), t.ID); err != nil {
+		reportError(r, "update tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save tenant"})
+		return
+	}
+	invalidateTenants()
+	audit(r, "tenant.update", "tenant", t.ID, changes)
+	writeJSON(w, http.StatusOK, t)
+}
+
+// AdminDeleteTenantHandler godoc
+// @Summary      Delete a tenant
+// @Description  Deletes a tenant and its cached external results. Only tenants without pages (including soft-deleted ones) can be deleted, and never the default tenant. Admin only.
+// @Tags         Tenants
+// @Security     sessionAuth
+// @Param        id  path  int  true  "Tenant ID"
+// @Success      204
+// @Failure      400  {object}  APIErrorResponse  "Default tenant"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      409  {object}  APIErrorResponse  "Tenant still has pages"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/tenants/{id} [delete]
+func AdminDeleteTenantHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "tenant not found"})
+		return
+	}
+	if id == defaultTenantID {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "the default tenant cannot be deleted"})
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		reportError(r, "delete tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var slug string
+	err = tx.QueryRowContext(ctx, `SELECT slug FROM tenants WHERE id = $1`, id).Scan(&slug)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "tenant not found"})
+		return
+	case err != nil:
+		reportError(r, "load tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	var pages int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM pages WHERE tenant_id = $1`, id).Scan(&pages); err != nil {
+		reportError(r, "delete tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	if pages > 0 {
+		writeJSON(w, http.StatusConflict, APIErrorResponse{Error: "tenant still has pages"})
+		return
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM external_results WHERE tenant_id = $1`, id); err != nil {
+		reportError(r, "delete tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete tenant"})
+		return
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM saved_searches WHERE tenant_id = $1`, id); err != nil {
+		reportError(r, "delete tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete tenant"})
+		return
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tenants WHERE id = $1`, id); err != nil {
+		reportError(r, "delete tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete tenant"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		reportError(r, "delete tenant error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete tenant"})
+		return
+	}
+	invalidateTenants()
+	audit(r, "tenant.delete", "tenant", id, map[string]any{"slug": slug})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Route budgets (TimeoutMiddleware). A request still running when its budget is spent is
+// answered 504 and its context canceled, which stops its queries and outbound calls.
+const (
+	// DefaultRouteTimeout is the budget of the routes not listed in routeTimeouts.
+	DefaultRouteTimeout = 15 * time.Second
+	// SearchRouteTimeout matches requestTimeout, the budget of the search queries themselves.
+	SearchRouteTimeout = 2 * time.Second
+	// WeatherRouteTimeout bounds the DMI lookup of a request; the refresh_weather job still
+	// waits up to DMI_HTTP_TIMEOUT.
+	WeatherRouteTimeout = 10 * time.Second
+	// AdminRouteTimeout is for admin operations that import or analyze (promotion of external
+	// results, sitemap rebuild, EXPLAIN ANALYZE).
+	AdminRouteTimeout = 60 * time.Second
+)
+
+// routeTimeoutWriteGrace is how long after its budget a response may take to be written.
+const routeTimeoutWriteGrace = 5 * time.Second
+
+// routeTimeouts are the budgets that differ from DefaultRouteTimeout, by route path template.
+// 0 turns the timeout off: streams, and downloads that are copied to the client as they are
+// read (signed files such as backups, static assets, the account export) instead of being held
+// in memory. The search page keeps the default: it also waits for the Wikipedia enrichment.
+var routeTimeouts = map[string]time.Duration{
+	"/api/search":                     SearchRouteTimeout,
+	"/api/suggest":                    SearchRouteTimeout,
+	"/api/search/widget":              SearchRouteTimeout,
+	"/weather":                        WeatherRouteTimeout,
+	"/api/weather":                    WeatherRouteTimeout,
+	"/admin/external-results/promote": AdminRouteTimeout,
+	"/admin/sitemap":                  AdminRouteTimeout,
+	"/api/admin/search/explain":       AdminRouteTimeout,
+	"/events":                         0,
+	"/files/{key:.+}":                 0,
+	"/static/":                        0,
+	"/api/me/export":                  0,
+}
+
+// routeTimeout is the budget of the route r matched.
+func routeTimeout(r *http.Request) time.Duration {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			if d, ok := routeTimeouts[tmpl]; ok {
+				return d
+			}
+		}
+	}
+	return DefaultRouteTimeout
+}
+
+// TimeoutMiddleware runs each request within the budget of its route (see routeTimeouts)
+// instead of one server-wide write timeout that fits no route well. The handler runs with a
+// context that ends with the budget and writes into a buffer; if it has not finished by then,
+// the client gets 504 and whatever the handler writes later is dropped. A handler that flushes
+// sends what it has so far and writes through from then on; it can no longer get a 504, only
+// its context ends with the budget. It also moves the connection's write deadline to the end
+// of the budget, or clears it for routes without one, which would otherwise be cut off by the
+// server-wide WriteTimeout. A panic in the handler is re-raised for RecoverMiddleware, which
+// must come before it.
+func TimeoutMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			budget := routeTimeout(r)
+			// Not supported by every writer (httptest); the server-wide timeout applies then.
+			rc := http.NewResponseController(w)
+			if budget <= 0 {
+				_ = rc.SetWriteDeadline(time.Time{})
+				next.ServeHTTP(w, r)
+				return
+			}
+			_ = rc.SetWriteDeadline(time.Now().Add(budget + routeTimeoutWriteGrace))
+
+			ctx, cancel := context.WithTimeout(r.Context(), budget)
+			defer cancel()
+			tw := &timeoutWriter{w: w, header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+						return
+					}
+					close(done)
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.finish()
+			case <-ctx.Done():
+				streaming := tw.stop()
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					log.Printf("request timed out after %s [request_id=%s method=%s path=%s]", budget, RequestID(r.Context()), r.Method, r.URL.Path)
+					if !streaming {
+						writeGatewayTimeout(w, r)
+					}
+				}
+				// Otherwise the client is gone and there is no one to answer.
+			}
+		})
+	}
+}
+
+// writeGatewayTimeout answers a request that ran out of its route's budget.
+func writeGatewayTimeout(w http.ResponseWriter, r *http.Request) {
+	id := RequestID(r.Context())
+	if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/graphql" || wantsJSON(r) {
+		writeJSON(w, http.StatusGatewayTimeout, map[string]any{"error": "request timed out", "request_id": id})
+		return
+	}
+	http.Error(w, "request timed out (request ID: "+id+")", http.StatusGatewayTimeout)
+}
+
+// timeoutWriter holds a response until the handler has finished within its budget, or until
+// the handler flushes (see Flush).
+type timeoutWriter struct {
+	mu        sync.Mutex
+	w         http.ResponseWriter // the connection's writer
+	header    http.Header
+	body      bytes.Buffer
+	status    int
+	streaming bool // flushed: headers are sent and writes go to w
+	stopped   bool // the budget ran out; further writes are dropped
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.status == 0 && !tw.stopped && !tw.streaming {
+		tw.status = code
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.stopped {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.streaming {
+		return tw.w.Write(b)
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(b)
+}
+
+// Flush sends the held response and switches to writing through, for handlers that stream.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.stopped {
+		return
+	}
+	if !tw.streaming {
+		tw.sendLocked()
+		tw.streaming = true
+	}
+	_ = http.NewResponseController(tw.w).Flush()
+}
+
+// Unwrap exposes the connection's writer to http.ResponseController (e.g. SetWriteDeadline for
+// a long response); Flush is handled by timeoutWriter itself.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// stop drops further writes and reports whether the response was already being streamed.
+func (tw *timeoutWriter) stop() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.stopped = true
+	return tw.streaming
+}
+
+// finish sends the held response, unless it was streamed.
+func (tw *timeoutWriter) finish() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.streaming {
+		tw.sendLocked()
+	}
+}
+
+// sendLocked writes the held status, headers and body to the connection's writer.
+func (tw *timeoutWriter) sendLocked() {
+	w := tw.w
+	dst := w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	w.WriteHeader(tw.status)
+	_, _ = w.Write(tw.body.Bytes())
+	tw.body.Reset()
+}
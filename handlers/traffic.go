@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/traffic"
+
+	"github.com/gorilla/mux"
+)
+
+// Traffic analytics: TrafficMiddleware classifies each request (browser, bot or api client;
+// see internal/traffic) and counts it per route in app_http_client_requests_total, and page
+// views per referrer source in app_http_referrals_total. The same counts are kept in memory
+// per UTC day and added to traffic_daily / referrers_daily by each replica's
+// flush_traffic_stats task, for GET /admin/reports/traffic. Nothing identifies a visitor:
+// only the class, the route template and the referring host are kept.
+
+const (
+	// trafficMaxReferrers bounds the referring hosts kept per day between flushes; the rest
+	// are counted as trafficOtherReferrer.
+	trafficMaxReferrers  = 200
+	trafficOtherReferrer = "(other)"
+	// trafficRetention is how long the daily traffic rows are kept (pruned by stats_rollup).
+	trafficRetention = 90 * 24 * time.Hour
+
+	trafficReportDefaultDays = 7
+	trafficReportMaxDays     = 90
+	trafficReportTop         = 20
+)
+
+// trafficSkipPaths are probes and scrapes, which would drown out real traffic.
+var trafficSkipPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+type trafficKey struct {
+	day, class, path string
+}
+
+type referrerKey struct {
+	day, host string
+}
+
+// trafficCounts accumulates the counts since the last flush.
+var trafficCounts = struct {
+	mu        sync.Mutex
+	requests  map[trafficKey]int
+	referrers map[referrerKey]int
+}{requests: map[trafficKey]int{}, referrers: map[referrerKey]int{}}
+
+// TrafficMiddleware records the client class, route and referrer of each request.
+func TrafficMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recordTraffic(r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func recordTraffic(r *http.Request) {
+	path := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, _ := route.GetPathTemplate(); tmpl != "" {
+			path = tmpl
+		}
+	}
+	if trafficSkipPaths[path] {
+		return
+	}
+	class := traffic.Classify(r.UserAgent(), r.URL.Path)
+	metrics.ClientRequests.WithLabelValues(class, path).Inc()
+
+	day := time.Now().UTC().Format(time.DateOnly)
+	pageView := isPageView(r)
+	var referrer string
+	if pageView {
+		source := traffic.Source(r.Referer(), r.Host, publicHost())
+		metrics.Referrals.WithLabelValues(source).Inc()
+		if source != traffic.SourceDirect && source != traffic.SourceInternal {
+			referrer = traffic.ReferrerHost(r.Referer())
+		}
+	}
+
+	trafficCounts.mu.Lock()
+	defer trafficCounts.mu.Unlock()
+	trafficCounts.requests[trafficKey{day, class, path}]++
+	if referrer != "" {
+		k := referrerKey{day, referrer}
+		if _, ok := trafficCounts.referrers[k]; !ok && len(trafficCounts.referrers) >= trafficMaxReferrers {
+			k.host = trafficOtherReferrer
+		}
+		trafficCounts.referrers[k]++
+	}
+}
+
+// isPageView reports whether r loads an HTML page (not an asset, API call or stream).
+func isPageView(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	for _, prefix := range []string{"/static/", "/api/", "/admin/", "/files/", "/graphql", "/events", "/swagger"} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicHost is the host of PUBLIC_BASE_URL ("" when unset).
+func publicHost() string {
+	if publicBaseURL == "" {
+		return ""
+	}
+	u, err := url.Parse(publicBaseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// FlushTrafficStats adds the counts collected since the last flush to the daily tables. It is
+// the flush_traffic_stats task, run on every replica; counts that fail to save are kept for
+// the next flush.
+func FlushTrafficStats(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	trafficCounts.mu.Lock()
+	requests, referrers := trafficCounts.requests, trafficCounts.referrers
+	trafficCounts.requests, trafficCounts.referrers = map[trafficKey]int{}, map[referrerKey]int{}
+	trafficCounts.mu.Unlock()
+	if len(requests) == 0 && len(referrers) == 0 {
+		return nil
+	}
+
+	err := storeTrafficCounts(ctx, requests, referrers)
+	if err != nil {
+		trafficCounts.mu.Lock()
+		for k, n := range requests {
+			trafficCounts.requests[k] += n
+		}
+		for k, n := range referrers {
+			trafficCounts.referrers[k] += n
+		}
+		trafficCounts.mu.Unlock()
+	}
+	return err
+}
+
+func storeTrafficCounts(ctx context.Context, requests map[trafficKey]int, referrers map[referrerKey]int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for k, n := range requests {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO traffic_daily (day, client_class, path, requests) VALUES ($1, $2, $3, $4)
+ON CONFLICT (day, client_class, path) DO UPDATE SET requests = traffic_daily.requests + excluded.requests`,
+			k.day, k.class, k.path, n,
+		); err != nil {
+			return fmt.Errorf("store traffic: %w", err)
+		}
+	}
+	for k, n := range referrers {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO referrers_daily (day, referrer, requests) VALUES ($1, $2, $3)
+ON CONFLICT (day, referrer) DO UPDATE SET requests = referrers_daily.requests + excluded.requests`,
+			k.day, k.host, n,
+		); err != nil {
+			return fmt.Errorf("store referrers: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// pruneTrafficStats deletes daily traffic rows older than trafficRetention.
+func pruneTrafficStats(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	before := time.Now().UTC().Add(-trafficRetention).Format(time.DateOnly)
+	for _, table := range []string{"traffic_daily", "referrers_daily"} {
+		if _, err := db.ExecContext(ctx, `DELETE FROM `+table+` WHERE day < $1`, before); err != nil {
+			return fmt.Errorf("prune %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// TrafficReportPath is one route in the traffic report.
+type TrafficReportPath struct {
+	Path     string `json:"path" example:"/search"`
+	Browser  int64  `json:"browser"`
+	Bot      int64  `json:"bot"`
+	API      int64  `json:"api"`
+	Requests int64  `json:"requests"`
+}
+
+// TrafficReportReferrer is one referring host in the traffic report.
+type TrafficReportReferrer struct {
+	Referrer string `json:"referrer" example:"google.com"`
+	Requests int64  `json:"requests"`
+}
+
+// TrafficReport is returned by GET /admin/reports/traffic.
+type TrafficReport struct {
+	Since     string                  `json:"since" example:"2026-10-10"`
+	ByClass   map[string]int64        `json:"by_class"` // browser, bot, api
+	BotShare  float64                 `json:"bot_share"`
+	Paths     []TrafficReportPath     `json:"paths"`     // most requested first
+	Referrers []TrafficReportReferrer `json:"referrers"` // external page view referrers, most first
+}
+
+// queryTrafficReport aggregates the daily traffic tables from since (a day) on.
+func queryTrafficReport(ctx context.Context, since string) (TrafficReport, error) {
+	report := TrafficReport{
+		Since:     since,
+		ByClass:   map[string]int64{traffic.ClassBrowser: 0, traffic.ClassBot: 0, traffic.ClassAPI: 0},
+		Paths:     []TrafficReportPath{},
+		Referrers: []TrafficReportReferrer{},
+	}
+	paths := map[string]*TrafficReportPath{}
+	err := queryRows(ctx, `
+SELECT path, client_class, SUM(requests) FROM traffic_daily WHERE day >= $1 GROUP BY path, client_class`,
+		[]any{since}, func(scan func(...any) error) error {
+			var (
+				path, class string
+				n           int64
+			)
+			if err := scan(&path, &class, &n); err != nil {
+				return err
+			}
+			p := paths[path]
+			if p == nil {
+				p = &TrafficReportPath{Path: path}
+				paths[path] = p
+			}
+			switch class {
+			case traffic.ClassBrowser:
+				p.Browser += n
+			case traffic.ClassBot:
+				p.Bot += n
+			case traffic.ClassAPI:
+				p.API += n
+			}
+			p.Requests += n
+			report.ByClass[class] += n
+			return nil
+		})
+	if err != nil {
+		return report, err
+	}
+	for _, p := range paths {
+		report.Paths = append(report.Paths, *p)
+	}
+	sort.Slice(report.Paths, func(i, j int) bool {
+		a, b := report.Paths[i], report.Paths[j]
+		return a.Requests > b.Requests || (a.Requests == b.Requests && a.Path < b.Path)
+	})
+	report.Paths = report.Paths[:min(len(report.Paths), trafficReportTop)]
+
+	var total int64
+	for _, n := range report.ByClass {
+		total += n
+	}
+	if total > 0 {
+		report.BotShare = float64(report.ByClass[traffic.ClassBot]) / float64(total)
+	}
+
+	err = queryRows(ctx, `
+SELECT referrer, SUM(requests) AS n FROM referrers_daily WHERE day >= $1
+GROUP BY referrer ORDER BY n DESC, referrer LIMIT $2`,
+		[]any{since, trafficReportTop}, func(scan func(...any) error) error {
+			var ref TrafficReportReferrer
+			if err := scan(&ref.Referrer, &ref.Requests); err != nil {
+				return err
+			}
+			report.Referrers = append(report.Referrers, ref)
+			return nil
+		})
+	return report, err
+}
+
+// AdminTrafficReportHandler godoc
+// @Summary      Traffic report
+// @Description  Requests per client class (browser, bot, api) and route, and the top external referrers of page views, for the last N days (default 7, max 90). Counts reach the report within a minute. Admin only.
+// @Tags         Admin
+// @Produce      json
+// @Security     sessionAuth
+// @Param        days  query  int  false  "Report window in days"
+// @Success      200  {object}  TrafficReport
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      403  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /admin/reports/traffic [get]
+func AdminTrafficReportHandler(w http.ResponseWriter, r *http.Request) {
+	days := trafficReportDefaultDays
+	if n, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && n > 0 {
+		days = min(n, trafficReportMaxDays)
+	}
+	since := time.Now().UTC().AddDate(0, 0, -(days - 1)).Format(time.DateOnly)
+
+	report, err := queryTrafficReport(r.Context(), since)
+	if err != nil {
+		reportError(r, "traffic report error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not build report"})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
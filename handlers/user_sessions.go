@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+// Session tracking: startSession records each login in user_sessions (device, IP, last seen)
+// and keeps the row's random key in the session. SessionGuardMiddleware logs out sessions
+// whose row is gone, so deleting the row (DELETE /api/me/sessions/{id}, the settings page)
+// signs that device out, together with the remember-me token it logged in with. Sessions from
+// before tracking get a row on their next request.
+
+const (
+	// sessionTouchInterval is how often last_seen_at (and the IP) of a session is updated.
+	sessionTouchInterval = time.Minute
+	// sessionIdleTTL matches the session's max age; rows not seen for longer are pruned.
+	sessionIdleTTL = 30 * 24 * time.Hour
+)
+
+// UserSession is a logged-in session of the current user.
+type UserSession struct {
+	ID         int64     `json:"id" example:"3"`
+	Device     string    `json:"device" example:"Firefox on Linux"`
+	UserAgent  string    `json:"user_agent" example:"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"`
+	IP         string    `json:"ip" example:"203.0.113.7"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current" example:"true"` // the session of this request
+}
+
+// APIUserSessionsResponse is returned by GET /api/me/sessions.
+type APIUserSessionsResponse struct {
+	Sessions []UserSession `json:"sessions"`
+}
+
+// recordSession stores a new session of the user and returns its key.
+func recordSession(r *http.Request, userID, sessionVersion int) (string, error) {
+	key, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	ua := r.UserAgent()
+	if len(ua) > loginDeviceUAMax {
+		ua = ua[:loginDeviceUAMax]
+	}
+	now := time.Now().UTC()
+	_, err = db.ExecContext(r.Context(), `
+INSERT INTO user_sessions (user_id, session_key, session_version, user_agent, ip, created_at, last_seen_at)
+VALUES ($1, $2, $3, $4, $5, $6, $6)`,
+		userID, key, sessionVersion, ua, clientIP(r), now,
+	)
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// trackSession records sess when it has no row yet (a session from before tracking, or its
+// recording failed at login) and otherwise keeps its last_seen_at current.
+func trackSession(w http.ResponseWriter, r *http.Request, sess *sessions.Session, userID, sessionVersion int, rowID sql.NullInt64, lastSeen sql.NullTime) {
+	if !rowID.Valid {
+		key, err := recordSession(r, userID, sessionVersion)
+		if err != nil {
+			log.Printf("record session error: %v", err)
+			return
+		}
+		sess.Values["session_key"] = key
+		if err := sess.Save(r, w); err != nil {
+			log.Printf("record session save error: %v", err)
+		}
+		return
+	}
+	if lastSeen.Valid && time.Since(lastSeen.Time) < sessionTouchInterval {
+		return
+	}
+	if _, err := db.ExecContext(r.Context(),
+		`UPDATE user_sessions SET last_seen_at = $1, ip = $2 WHERE id = $3`,
+		time.Now().UTC(), clientIP(r), rowID.Int64,
+	); err != nil {
+		log.Printf("session touch error: %v", err)
+	}
+}
+
+// forgetSession deletes the row of sess (logout, a new login in the same browser).
+func forgetSession(ctx context.Context, sess *sessions.Session) {
+	key, _ := sess.Values["session_key"].(string)
+	delete(sess.Values, "session_key")
+	if key == "" || db == nil {
+		return
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM user_sessions WHERE session_key = $1`, key); err != nil {
+		log.Printf("session delete error: %v", err)
+	}
+}
+
+// linkRememberToken notes that the request's session was issued or restored from the
+// remember-me token selector, so revoking the session revokes the token too.
+func linkRememberToken(r *http.Request, selector string) {
+	sess, err := sessionStore.Get(r, "session")
+	if err != nil {
+		return
+	}
+	key, _ := sess.Values["session_key"].(string)
+	if key == "" {
+		return
+	}
+	if _, err := db.ExecContext(r.Context(),
+		`UPDATE user_sessions SET remember_selector = $1 WHERE session_key = $2`, selector, key,
+	); err != nil {
+		log.Printf("session remember link error: %v", err)
+	}
+}
+
+// pruneSessions deletes the rows of sessions that have expired or were ended by a
+// session_version change (password change or reset, status change).
+func pruneSessions(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `
+DELETE FROM user_sessions
+WHERE last_seen_at < $1
+   OR session_version <> (SELECT u.session_version FROM users u WHERE u.id = user_sessions.user_id)`,
+		time.Now().UTC().Add(-sessionIdleTTL),
+	)
+	return err
+}
+
+// currentSessionKey is the key of the request's session ("" if untracked).
+func currentSessionKey(r *http.Request) string {
+	sess, err := sessionStore.Get(r, "session")
+	if err != nil {
+		return ""
+	}
+	key, _ := sess.Values["session_key"].(string)
+	return key
+}
+
+// deviceLabel names the browser and OS of a User-Agent, e.g. "Firefox on Linux".
+func deviceLabel(ua string) string {
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	if browser == "" {
+		// Non-browser clients: their product token, e.g. "curl".
+		product, _, _ := strings.Cut(ua, "/")
+		if product = strings.TrimSpace(product); product == "" || strings.ContainsAny(product, " ;(") {
+			return "Unknown device"
+		}
+		return product
+	}
+	for _, o := range []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iOS"}, {"CrOS", "ChromeOS"},
+		{"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			return browser + " on " + o.name
+		}
+	}
+	return browser
+}
+
+// APIListSessionsHandler godoc
+// @Summary      List sessions
+// @Description  Returns the current user's logged-in sessions (device, IP, last seen), most recently seen first; current marks the session of this request. Requires session auth.
+// @Tags         Auth
+// @Produce      json
+// @Security     sessionAuth
+// @Success      200  {object}  APIUserSessionsResponse
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/sessions [get]
+func APIListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	rows, err := db.QueryContext(r.Context(), `
+SELECT s.id, s.session_key, s.user_agent, s.ip, s.created_at, s.last_seen_at
+FROM user_sessions s JOIN users u ON u.id = s.user_id
+WHERE s.user_id = $1 AND s.session_version = u.session_version AND s.last_seen_at >= $2
+ORDER BY s.last_seen_at DESC, s.id DESC`,
+		userID, time.Now().UTC().Add(-sessionIdleTTL),
+	)
+	if err != nil {
+		reportError(r, "list sessions error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	current := currentSessionKey(r)
+	list := []UserSession{}
+	for rows.Next() {
+		var s UserSession
+		var key string
+		if err := rows.Scan(&s.ID, &key, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			reportError(r, "list sessions scan error", err)
+			writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+			return
+		}
+		s.Device = deviceLabel(s.UserAgent)
+		s.Current = key == current
+		list = append(list, s)
+	}
+	if err := rows.Err(); err != nil {
+		reportError(r, "list sessions rows error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIUserSessionsResponse{Sessions: list})
+}
+
+// APIRevokeSessionHandler godoc
+// @Summary      Sign out a session
+// @Description  Ends one of the current user's sessions and the remember-me token it uses; that device is logged out on its next request. Revoking the current session logs this request's browser out right away. Requires session auth.
+// @Tags         Auth
+// @Security     sessionAuth
+// @Param        id  path  int  true  "Session ID"
+// @Success      204
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/me/sessions/{id} [delete]
+func APIRevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "session not found"})
+		return
+	}
+
+	ctx := r.Context()
+	var key string
+	var selector sql.NullString
+	err = db.QueryRowContext(ctx,
+		`SELECT session_key, remember_selector FROM user_sessions WHERE id = $1 AND user_id = $2`, id, userID,
+	).Scan(&key, &selector)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "session not found"})
+		return
+	}
+	if err != nil {
+		reportError(r, "revoke session lookup error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not revoke session"})
+		return
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM user_sessions WHERE id = $1`, id); err != nil {
+		reportError(r, "revoke session error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not revoke session"})
+		return
+	}
+	if selector.Valid {
+		// Otherwise the remember cookie would log the device straight back in.
+		if _, err := db.ExecContext(ctx,
+			`DELETE FROM remember_tokens WHERE selector = $1 AND user_id = $2`, selector.String, userID,
+		); err != nil {
+			reportError(r, "revoke session remember token error", err)
+		}
+	}
+
+	if key == currentSessionKey(r) {
+		if sess, err := sessionStore.Get(r, "session"); err == nil {
+			for k := range sess.Values {
+				delete(sess.Values, k)
+			}
+			if err := sess.Save(r, w); err != nil {
+				reportError(r, "revoke current session save error", err)
+			}
+		}
+		setRememberCookie(w, r, "", 0)
+	}
+	audit(r, "user.session_revoked", "user", userID, map[string]any{"session_id": id})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"devops-valgfag/internal/service"
+)
+
+// sqlUserStore is the service.UserStore of authService, on the users table.
+type sqlUserStore struct{}
+
+func (sqlUserStore) UserByUsername(ctx context.Context, username string) (service.User, error) {
+	var u service.User
+	err := db.QueryRowContext(ctx, `
+SELECT id, username, email, password, session_version, status, must_reset_password
+FROM users WHERE username = $1 AND deleted_at IS NULL`, username,
+	).Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.SessionVersion, &u.Status, &u.MustResetPassword)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.User{}, service.ErrNotFound
+	}
+	return u, err
+}
+
+func (sqlUserStore) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE username = $1`, username).Scan(&n)
+	return n > 0, err
+}
+
+func (sqlUserStore) CreateUser(ctx context.Context, u service.User) error {
+	if u.TermsVersion == "" {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO users (username, email, password, status) VALUES ($1, $2, $3, $4)`,
+			u.Username, u.Email, u.PasswordHash, u.Status,
+		)
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	var id int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO users (username, email, password, status, terms_version) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		u.Username, u.Email, u.PasswordHash, u.Status, u.TermsVersion,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO user_consents (user_id, version, source, accepted_at) VALUES ($1, $2, $3, $4)`,
+		id, u.TermsVersion, consentSourceRegistration, time.Now().UTC(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (sqlUserStore) RecordLogin(ctx context.Context, userID int, at time.Time) error {
+	_, err := db.ExecContext(ctx, `UPDATE users SET last_login_at = $1 WHERE id = $2`, at, userID)
+	return err
+}
+
+func (sqlUserStore) SetPasswordHash(ctx context.Context, userID int, hash string) error {
+	_, err := db.ExecContext(ctx, `UPDATE users SET password = $1 WHERE id = $2`, hash, userID)
+	return err
+}
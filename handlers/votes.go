@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// VoteRequest is the body accepted by PUT /api/pages/{id}/vote.
+type VoteRequest struct {
+	Helpful bool `json:"helpful" example:"true"`
+}
+
+// VoteSummary is the aggregated feedback for one page (plus the caller's own vote).
+type VoteSummary struct {
+	PageID    int `json:"page_id" example:"42"`
+	Helpful   int `json:"helpful" example:"7"`
+	Unhelpful int `json:"unhelpful" example:"1"`
+	YourVote  int `json:"your_vote" example:"1"` // 1, -1 or 0 (no vote)
+}
+
+// APIVoteHandler godoc
+// @Summary      Rate a search result
+// @Description  Marks a result page as helpful or unhelpful (one vote per user and page; voting again replaces it). Votes feed into the FTS ranking. Requires session auth.
+// @Tags         Search
+// @Accept       json
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id    path  int          true  "Page ID"
+// @Param        body  body  VoteRequest  true  "Vote"
+// @Success      200  {object}  VoteSummary
+// @Failure      400  {object}  APIErrorResponse  "Invalid input; an unknown or mistyped JSON field is named in field"
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      413  {object}  APIErrorResponse  "Request body too large"
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/pages/{id}/vote [put]
+func APIVoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, pageID, ok := voteTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var req VoteRequest
+	if !decodeJSONBody(w, r, 1024, &req) {
+		return
+	}
+	vote := -1
+	if req.Helpful {
+		vote = 1
+	}
+
+	_, err := db.ExecContext(r.Context(), `
+INSERT INTO result_votes (user_id, page_id, vote, updated_at)
+VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+ON CONFLICT (user_id, page_id) DO UPDATE SET
+  vote = excluded.vote,
+  updated_at = excluded.updated_at`,
+		userID, pageID, vote,
+	)
+	if err != nil {
+		reportError(r, "save vote error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not save vote"})
+		return
+	}
+
+	writeVoteSummary(w, r, userID, pageID)
+}
+
+// APIDeleteVoteHandler godoc
+// @Summary      Remove result rating
+// @Description  Removes the caller's vote for a result page. Requires session auth.
+// @Tags         Search
+// @Produce      json
+// @Security     sessionAuth
+// @Param        id  path  int  true  "Page ID"
+// @Success      200  {object}  VoteSummary
+// @Failure      401  {object}  APIErrorResponse
+// @Failure      404  {object}  APIErrorResponse
+// @Failure      500  {object}  APIErrorResponse
+// @Router       /api/pages/{id}/vote [delete]
+func APIDeleteVoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, pageID, ok := voteTarget(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := db.ExecContext(r.Context(),
+		`DELETE FROM result_votes WHERE user_id = $1 AND page_id = $2`,
+		userID, pageID,
+	)
+	if err != nil {
+		reportError(r, "delete vote error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "could not delete vote"})
+		return
+	}
+
+	writeVoteSummary(w, r, userID, pageID)
+}
+
+// voteTarget resolves the session user and the {id} page, writing the error response itself.
+func voteTarget(w http.ResponseWriter, r *http.Request) (userID, pageID int, ok bool) {
+	if db == nil {
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database not configured"})
+		return 0, 0, false
+	}
+	userID, ok = currentUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, APIErrorResponse{Error: "unauthorized"})
+		return 0, 0, false
+	}
+
+	pageID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || pageID <= 0 {
+		writeJSON(w, http.StatusBadRequest, APIErrorResponse{Error: "invalid page id"})
+		return 0, 0, false
+	}
+
+	var exists int
+	err = db.QueryRowContext(r.Context(), `SELECT 1 FROM pages WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL`, pageID, tenantID(r.Context())).Scan(&exists)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, APIErrorResponse{Error: "page not found"})
+		return 0, 0, false
+	case err != nil:
+		reportError(r, "vote page lookup error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return 0, 0, false
+	}
+	return userID, pageID, true
+}
+
+func writeVoteSummary(w http.ResponseWriter, r *http.Request, userID, pageID int) {
+	s, err := queryVoteSummary(r.Context(), userID, pageID)
+	if err != nil {
+		reportError(r, "vote summary error", err)
+		writeJSON(w, http.StatusInternalServerError, APIErrorResponse{Error: "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// queryVoteSummary counts a page's votes and looks up the given user's vote.
+func queryVoteSummary(ctx context.Context, userID, pageID int) (VoteSummary, error) {
+	s := VoteSummary{PageID: pageID}
+	err := db.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(CASE WHEN vote > 0 THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN vote < 0 THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN user_id = $2 THEN vote ELSE 0 END), 0)
+FROM result_votes
+WHERE page_id = $1`,
+		pageID, userID,
+	).Scan(&s.Helpful, &s.Unhelpful, &s.YourVote)
+	return s, err
+}
@@ -2,42 +2,22 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"os"
 	"strings"
 	"time"
-)
 
-// ==========
-// Models (DMI EDR GeoJSON subset)
-// ==========
-
-type EDRFeatureCollection struct {
-	Type     string       `json:"type"`
-	Features []EDRFeature `json:"features"`
-}
-
-type EDRFeature struct {
-	Type       string        `json:"type"`
-	Geometry   EDRGeometry   `json:"geometry"`
-	Properties EDRProperties `json:"properties"`
-}
-
-type EDRGeometry struct {
-	Type        string    `json:"type"`
-	Coordinates []float64 `json:"coordinates"` // [lon, lat]
-}
+	"devops-valgfag/internal/httpclient"
+	"devops-valgfag/internal/service"
+)
 
-type EDRProperties struct {
-	Temperature float64 `json:"temperature-2m"`
-	WindSpeed   float64 `json:"wind-speed-10m"`
-	WindDir     float64 `json:"wind-dir-10m"`
-	Step        string  `json:"step"`
-}
+// DMI EDR GeoJSON models, see service.
+type (
+	EDRFeatureCollection = service.EDRFeatureCollection
+	EDRFeature           = service.EDRFeature
+	EDRGeometry          = service.EDRGeometry
+	EDRProperties        = service.EDRProperties
+)
 
 // API response structures
 
@@ -60,69 +40,49 @@ type WeatherForecast struct {
 
 type APIErrorResponse struct {
 	Error string `json:"error"`
+	Field string `json:"field,omitempty" example:"limit"` // the offending field of a rejected JSON body
 }
 
-const (
-	weatherServiceUnavailableMsg = "weather service unavailable"
-	weatherDataIncompleteMsg     = "weather data incomplete"
-)
-
 var (
 	// Default timeout can be overridden via env: DMI_HTTP_TIMEOUT (e.g. "20s", "5s", "1m")
-	weatherTimeout = parseDurationEnv("DMI_HTTP_TIMEOUT", 20*time.Second)
-	weatherClient  = &http.Client{Timeout: weatherTimeout}
+	weatherTimeout                  = parseDurationEnv("DMI_HTTP_TIMEOUT", 20*time.Second)
+	weatherClient  service.HTTPDoer = httpclient.New("dmi", weatherTimeout)
 )
 
-// ==========
-// Weather fetcher
-// ==========
-
-func GetCopenhagenForecast(ctx context.Context) (*EDRFeatureCollection, error) {
-	apiKey := os.Getenv("DMI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("missing DMI_API_KEY environment variable")
-	}
-
-	baseURL := strings.TrimSuffix(os.Getenv("DMI_API_URL"), "/")
-	if baseURL == "" {
-		baseURL = "https://dmigw.govcloud.dk"
+// SetWeatherHTTPClient sends the DMI requests through c (nil restores the default client
+// with DMI_HTTP_TIMEOUT). Tests use it to answer with recorded responses.
+func SetWeatherHTTPClient(c service.HTTPDoer) {
+	if c == nil {
+		c = httpclient.New("dmi", weatherTimeout)
 	}
+	weatherClient = c
+}
 
-	u := fmt.Sprintf(
-		"%s/v1/forecastedr/collections/harmonie_dini_sf/position"+
-			"?coords=POINT(12.561%%2055.715)&crs=crs84"+
-			"&parameter-name=temperature-2m,wind-speed-10m,wind-dir-10m"+
-			"&f=GeoJSON&api-key=%s",
-		baseURL,
-		apiKey,
-	)
+// Copenhagen forecasts are cached briefly; the refresh_weather job keeps the cache warm.
+const weatherCacheTTL = 10 * time.Minute
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+var weatherService = &service.WeatherService{Provider: dmiProvider{}, TTL: weatherCacheTTL}
 
-	resp, err := weatherClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
-	}
-	defer func() {
-		if cerr := resp.Body.Close(); cerr != nil {
-			log.Printf("failed to close weather response body: %v", cerr)
-		}
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, fmt.Errorf("%s (status %d): %s", weatherServiceUnavailableMsg, resp.StatusCode, strings.TrimSpace(string(body)))
-	}
+// ResetWeatherCache drops the cached Copenhagen forecast, e.g. after a test changed
+// DMI_API_URL, so the next request reaches the provider.
+func ResetWeatherCache() {
+	weatherService.Reset()
+}
 
-	var data EDRFeatureCollection
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, fmt.Errorf("JSON decode failed: %w", err)
+// dmiProvider reads DMI_API_KEY and DMI_API_URL on every fetch, so they can change without
+// a restart.
+type dmiProvider struct{}
+
+func (dmiProvider) Forecast(ctx context.Context, lat, lon float64) (*EDRFeatureCollection, error) {
+	c := service.DMIClient{
+		BaseURL:    os.Getenv("DMI_API_URL"),
+		APIKey:     os.Getenv("DMI_API_KEY"),
+		HTTPClient: weatherClient,
+		ReportStatus: func(up bool) {
+			reportServiceStatus(EventWeather, "Weather provider (DMI)", up)
+		},
 	}
-
-	return &data, nil
+	return c.Forecast(ctx, lat, lon)
 }
 
 // parseDurationEnv matches the naming convention used in cmd/server/main.go.
@@ -144,15 +104,13 @@ func parseDurationEnv(key string, fallback time.Duration) time.Duration {
 // ==========
 
 func WeatherPageHandler(w http.ResponseWriter, r *http.Request) {
-	data, err := GetCopenhagenForecast(r.Context())
+	data, err := weatherService.Copenhagen(r.Context())
 	if err != nil {
-		log.Println("Forecast fetch error:", err)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		renderTemplate(w, r, "weather", map[string]any{
+		reportExternalError("dmi", "Forecast fetch error", err)
+		renderPageError(w, r, "weather", map[string]any{
 			"Title":    "Copenhagen Forecast",
 			"Forecast": nil,
-			"Error":    weatherServiceUnavailableMsg, // <-- sanitize (don’t leak err.Error())
-		})
+		}, service.ErrWeatherUnavailable) // reported above; the page must not show err itself
 		return
 	}
 
@@ -181,29 +139,15 @@ func WeatherPageHandler(w http.ResponseWriter, r *http.Request) {
 // @Failure      503  {object}  APIErrorResponse
 // @Router       /api/weather [get]
 func APIWeatherHandler(w http.ResponseWriter, r *http.Request) {
-	data, err := GetCopenhagenForecast(r.Context())
+	data, err := weatherService.Copenhagen(r.Context())
 	if err != nil {
-		log.Println("weather API fetch error:", err)
-		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: weatherServiceUnavailableMsg})
+		reportExternalError("dmi", "weather API fetch error", err)
+		writeAPIError(w, r, service.ErrWeatherUnavailable)
 		return
 	}
-
-	if data == nil {
-		log.Println("weather API: empty response body")
-		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: weatherServiceUnavailableMsg})
-		return
-	}
-
-	if len(data.Features) == 0 {
-		log.Println("weather API: empty feature list")
-		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: weatherServiceUnavailableMsg})
-		return
-	}
-
-	first := data.Features[0]
-	if len(first.Geometry.Coordinates) < 2 {
-		log.Println("weather API: missing coordinates in response")
-		writeJSON(w, http.StatusServiceUnavailable, APIErrorResponse{Error: weatherDataIncompleteMsg})
+	first, err := service.Current(data)
+	if err != nil {
+		writeAPIError(w, r, err)
 		return
 	}
 
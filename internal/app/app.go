@@ -0,0 +1,510 @@
+// Package app builds the WhoKnows server from a Config: it opens the database and Redis,
+// runs the migrations, wires the handlers with their dependencies (templates, sessions,
+// caches, storage, rate limits), sets up the job queue and scheduler and assembles the
+// HTTP and gRPC servers. cmd/server only reads the configuration and runs the App.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"devops-valgfag/docs"
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/cache"
+	"devops-valgfag/internal/dbpool"
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/errortrack"
+	"devops-valgfag/internal/httpclient"
+	"devops-valgfag/internal/i18n"
+	"devops-valgfag/internal/jobs"
+	metrics "devops-valgfag/internal/metrics"
+	migrate "devops-valgfag/internal/migrate"
+	"devops-valgfag/internal/ratelimit"
+	"devops-valgfag/internal/scheduler"
+	"devops-valgfag/internal/sessionstore"
+	"devops-valgfag/internal/slowquery"
+	"devops-valgfag/internal/storage"
+
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+
+	// PostgreSQL driver
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// App is a wired server. Run serves it; Shutdown stops it and releases what New opened.
+type App struct {
+	cfg Config
+
+	DB        *sql.DB
+	Jobs      *jobs.Queue
+	Scheduler *scheduler.Scheduler
+
+	// pools watch the connection pools (wait times, saturation, autotuning) while Run runs.
+	pools []*dbpool.Monitor
+
+	server *http.Server
+	grpc   *grpc.Server
+
+	// stop cancels the job workers, scheduled tasks and pool monitors started by Run; done is
+	// closed once they have returned.
+	stop context.CancelFunc
+	done chan struct{}
+
+	// closers release resources in reverse order of acquisition.
+	closers []func()
+
+	shutdownOnce sync.Once
+}
+
+// New builds the App described by cfg. The handlers package keeps its dependencies in package
+// variables, so there is one App per process. On error everything opened so far is closed.
+func New(cfg Config) (*App, error) {
+	a := &App{cfg: cfg}
+	built := false
+	defer func() {
+		if !built {
+			a.close()
+		}
+	}()
+
+	// Outbound HTTP of every client (proxy, allowlist, rate and connection limits).
+	httpclient.SetPolicy(cfg.Egress)
+
+	if err := errortrack.Init(errortrack.Options{
+		DSN:         cfg.SentryDSN,
+		Release:     cfg.SentryRelease,
+		Environment: cfg.AppEnv,
+	}); err != nil {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: %w", err)
+	}
+
+	tracers, err := a.openDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	// -------------------------
+	// HTTP (templates, sessions, router)
+	// -------------------------
+
+	// Templates
+	funcs := template.FuncMap{
+		"now":   time.Now,
+		"year":  func() int { return time.Now().Year() },
+		"t":     i18n.T,
+		"url":   h.URL,
+		"asset": h.Asset,
+	}
+	tmpl, err := template.New("").Funcs(funcs).ParseGlob(cfg.TemplateGlob)
+	if err != nil {
+		return nil, err
+	}
+
+	// Session store backed by secure cookies, or by Redis when REDIS_URL is set.
+	// The session keys sign cookies so clients cannot tamper with them, and encrypt them
+	// (SESSION_ENC_KEY) so clients cannot read them.
+	var sessionStore sessions.Store = sessions.NewCookieStore(cfg.SessionKeyPairs...)
+	var searchResultCache cache.Cache = cache.NewMemory(1000)
+	newLimiter := func(perMinute int) ratelimit.Limiter {
+		return ratelimit.NewMemory(perMinute, time.Minute)
+	}
+
+	if cfg.RedisURL != "" {
+		redisClient, err := a.connectRedis()
+		if err != nil {
+			return nil, err
+		}
+		sessionStore = sessionstore.NewRedisStore(redisClient, cfg.SessionKeyPairs...)
+		searchResultCache = cache.NewRedis(redisClient, "cache:")
+		h.SetStatusChecks(h.StatusCheck{Name: "redis", Label: "Cache and sessions (Redis)", Check: func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}})
+		newLimiter = func(perMinute int) ratelimit.Limiter {
+			return ratelimit.NewRedis(redisClient, "ratelimit:", perMinute, time.Minute)
+		}
+		log.Println("Using Redis for sessions, search cache and rate limits")
+	}
+
+	// "Wire handlers" = give handlers access to shared dependencies:
+	// - db connection
+	// - parsed HTML templates
+	// - session store
+	h.Init(a.DB, tmpl, sessionStore)
+	h.SetDialect(cfg.Dialect)
+	h.SetRateLimitBackend(newLimiter)
+	h.SetSlowQueryTracers(tracers...)
+	if _, err := h.ApplyRuntimeConfig(cfg.Runtime); err != nil {
+		return nil, err
+	}
+	if cfg.ReloadRuntime != nil {
+		h.SetConfigSource(cfg.ReloadRuntime)
+	}
+	h.SetPublicBaseURL(cfg.PublicBaseURL)
+	h.SetBasePath(cfg.BasePath)
+	if cfg.BasePath != "" {
+		docs.SwaggerInfo.BasePath = cfg.BasePath
+	}
+	h.SetMetricsSummaryToken(cfg.MetricsSummaryToken)
+	if err := h.SetRegistrationGuard(cfg.RegistrationGuard); err != nil {
+		return nil, err
+	}
+	h.SetTerms(cfg.Terms)
+	h.SetRememberMeTTL(cfg.RememberMeTTL)
+	h.SetLoginFailureDelay(cfg.LoginFailureDelay)
+	h.SetSoftDeleteRetention(cfg.SoftDeleteRetention)
+	h.SetRetention(cfg.Retention)
+	if store, err := storage.New(cfg.Storage); err != nil {
+		log.Printf("storage disabled: %v", err)
+	} else {
+		h.SetStorage(store)
+	}
+	h.SetBackupConfig(cfg.Backup)
+	h.SetSearchCache(searchResultCache, cfg.SearchCacheTTL)
+	h.SetRelatedCache(searchResultCache, cfg.RelatedCacheTTL)
+	h.SetSearchStatementTimeout(cfg.SearchStatementTimeout)
+	if err := h.SetOpsACL(cfg.OpsACL, cfg.OpsACLFile); err != nil {
+		return nil, fmt.Errorf("ADMIN_IP_ACL_FILE: %w", err)
+	}
+
+	// TEMPLATE_RELOAD=1 re-parses templates when they change on disk and serves static/ from disk
+	// (dev only; prod keeps the precompiled set and the embedded assets).
+	if cfg.TemplateReload {
+		if cfg.AppEnv == "prod" {
+			log.Println("TEMPLATE_RELOAD ignored in prod")
+		} else {
+			h.EnableTemplateReload(cfg.TemplateGlob, funcs)
+			h.EnableAssetReload(cfg.StaticDir)
+			log.Println("Template hot-reload enabled")
+		}
+	}
+	h.ConfigureRobots(cfg.RobotsDisallowAll, cfg.RobotsDisallow)
+
+	// Persistent background job queue (jobs table); failed jobs are inspectable under /admin/jobs.
+	a.Jobs = jobs.New(a.DB, jobs.Options{Workers: cfg.JobWorkers})
+	h.RegisterJobs(a.Jobs)
+	h.SetJobQueue(a.Jobs)
+
+	// Periodic tasks (sitemap, saved searches, rollups, cache maintenance); status under /admin/scheduler.
+	// Cluster-wide tasks run on one replica: the holder of the scheduler advisory lock.
+	// With SQLite there is a single process, which always leads (nil Elector).
+	var elector scheduler.Elector
+	if cfg.Dialect == dialect.Postgres {
+		advisoryElector := scheduler.NewAdvisoryLockElector(a.DB, scheduler.LeaderLockID)
+		a.closers = append(a.closers, advisoryElector.Close)
+		elector = advisoryElector
+	}
+	a.Scheduler = scheduler.New(scheduler.Options{Enabled: cfg.SchedulerEnabled, Elector: elector})
+	h.RegisterScheduledTasks(a.Scheduler, h.ScheduleConfig{
+		SitemapRefresh:      cfg.SitemapRefresh,
+		SavedSearchInterval: cfg.SavedSearchInterval,
+		BackupInterval:      cfg.BackupInterval,
+	})
+	h.SetScheduler(a.Scheduler)
+
+	// -------------------------
+	// Server
+	// -------------------------
+
+	// http.Server lets us configure timeouts (recommended in production).
+	// Handler: the mux router, behind the BASE_PATH prefix and tenant resolution (hostname or
+	// /t/<slug>/ prefix); both prefixes must be stripped before the router matches the path.
+	a.server = &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           h.BasePathMiddleware()(h.TenantMiddleware()(NewRouter())),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		// Only a backstop for responses outside a route (404s): TimeoutMiddleware gives every
+		// route the write deadline of its own budget.
+		WriteTimeout: h.DefaultRouteTimeout,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	// gRPC runs on its own port next to HTTP (internal consumers + grpc-health-probe).
+	if cfg.GRPCPort != "off" {
+		a.grpc = h.NewGRPCServer()
+	}
+	built = true
+	return a, nil
+}
+
+// Handler is the App's HTTP handler (router behind tenant resolution).
+func (a *App) Handler() http.Handler {
+	return a.server.Handler
+}
+
+// Run starts the job workers, scheduled tasks, pool monitors and gRPC server and serves HTTP
+// until ctx is done, then shuts down within ShutdownTimeout. It returns early with the error
+// of a server that fails, or nil when Shutdown was called.
+func (a *App) Run(ctx context.Context) error {
+	workCtx, stop := context.WithCancel(context.Background())
+	a.stop, a.done = stop, make(chan struct{})
+	var workers sync.WaitGroup
+	if a.cfg.JobWorkers > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			a.Jobs.Run(workCtx)
+		}()
+	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		a.Scheduler.Run(workCtx)
+	}()
+	for _, pool := range a.pools {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			pool.Run(workCtx)
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(a.done)
+	}()
+
+	// Deployment notice for clients connected to /events (they reconnect after a restart).
+	h.Announce(h.EventAnnouncement, "A new version of WhoKnows was deployed")
+
+	errc := make(chan error, 2)
+	if a.grpc != nil {
+		lis, err := net.Listen("tcp", ":"+a.cfg.GRPCPort)
+		if err != nil {
+			return errors.Join(fmt.Errorf("gRPC listen error: %w", err), a.shutdownWithTimeout())
+		}
+		go func() {
+			log.Printf("gRPC server running on :%s", a.cfg.GRPCPort)
+			if err := a.grpc.Serve(lis); err != nil {
+				errc <- fmt.Errorf("gRPC server error: %w", err)
+			}
+		}()
+	}
+	go func() {
+		fmt.Printf("Server running on :%s\n", a.cfg.Port)
+		err := a.server.ListenAndServe()
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			return errors.Join(err, a.shutdownWithTimeout())
+		}
+		return nil
+	case <-ctx.Done():
+		return a.shutdownWithTimeout()
+	}
+}
+
+// ShutdownTimeout bounds how long Run waits for running requests when it stops.
+const ShutdownTimeout = 15 * time.Second
+
+func (a *App) shutdownWithTimeout() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return a.Shutdown(ctx)
+}
+
+// Shutdown stops accepting requests, waits for the running ones (until ctx is done), stops the
+// background work and closes the database and Redis connections.
+func (a *App) Shutdown(ctx context.Context) error {
+	var err error
+	a.shutdownOnce.Do(func() {
+		err = a.server.Shutdown(ctx)
+		if a.grpc != nil {
+			a.grpc.GracefulStop()
+		}
+		if a.stop != nil {
+			a.stop()
+			select {
+			case <-a.done:
+			case <-ctx.Done():
+			}
+		}
+		a.close()
+	})
+	return err
+}
+
+func (a *App) close() {
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		a.closers[i]()
+	}
+	a.closers = nil
+}
+
+// -------------------------
+// Database
+// -------------------------
+
+// openDatabase opens the primary (and read replica), checks the connection and runs the
+// migrations. It returns the slow query tracers of the PostgreSQL pools.
+func (a *App) openDatabase() ([]*slowquery.Tracer, error) {
+	cfg := a.cfg
+	var tracers []*slowquery.Tracer
+	var err error
+	if cfg.Dialect == dialect.SQLite {
+		// SQLite runs in this process only: no read replica, slow query tracing (pgx),
+		// advisory locks or statement timeouts.
+		log.Printf("Using SQLite database %s (single process, demo only)", cfg.SQLitePath)
+		if err := os.MkdirAll(filepath.Dir(cfg.SQLitePath), 0o755); err != nil {
+			return nil, err
+		}
+		a.DB, err = dialect.OpenSQLite(cfg.SQLitePath)
+	} else {
+		// In prod we log LESS to avoid leaking details (even if it's "only" username).
+		meta := cfg.DSNMeta
+		if cfg.AppEnv != "prod" {
+			log.Printf("Using PostgreSQL DSN (source=%s host=%s db=%s user=%s)", meta.Source, meta.Host, meta.DB, meta.User)
+		} else {
+			log.Printf("Using PostgreSQL DSN (source=%s host=%s db=%s)", meta.Source, meta.Host, meta.DB)
+		}
+
+		// Open PostgreSQL using the pgx driver
+		primaryTracer := slowquery.New(slowquery.Options{Pool: "primary", Threshold: cfg.Runtime.SlowQueryThreshold, Explain: cfg.Runtime.SlowQueryExplain})
+		tracers = append(tracers, primaryTracer)
+		a.DB, err = openPostgres(cfg.DSN, primaryTracer)
+		if err == nil {
+			primaryTracer.SetExplainDB(a.DB)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.closeDB("DB", a.DB)
+	a.configurePool("primary", a.DB)
+
+	// Test DB connection
+	if err := a.DB.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Dialect, err)
+	}
+
+	// DATABASE_URL_RO: optional read replica for search, suggestions and reports.
+	// Writes always go to the primary; reads fall back to it while the replica is down.
+	if cfg.ReplicaDSN != "" && cfg.Dialect == dialect.Postgres {
+		roMeta, err := extractDSNMeta(cfg.ReplicaDSN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DATABASE_URL_RO: %w", err)
+		}
+		replicaTracer := slowquery.New(slowquery.Options{Pool: "replica", Threshold: cfg.Runtime.SlowQueryThreshold, Explain: cfg.Runtime.SlowQueryExplain})
+		tracers = append(tracers, replicaTracer)
+		roDB, err := openPostgres(cfg.ReplicaDSN, replicaTracer)
+		if err != nil {
+			return nil, err
+		}
+		replicaTracer.SetExplainDB(roDB)
+		a.closeDB("read replica DB", roDB)
+		a.configurePool("replica", roDB)
+
+		h.SetReadReplica(roDB)
+		metrics.RegisterDBPool("replica", roDB)
+		// A replica that is down at startup is not fatal: reads use the primary until it answers.
+		if err := h.CheckReadReplica(context.Background()); err != nil {
+			log.Printf("read replica (host=%s db=%s) not reachable, reading from primary: %v", roMeta.Host, roMeta.DB, err)
+		} else {
+			log.Printf("Using read replica for search queries (host=%s db=%s)", roMeta.Host, roMeta.DB)
+		}
+	}
+	metrics.RegisterDBPool("primary", a.DB)
+
+	// Run database migrations (migrations/ for PostgreSQL, migrations/sqlite/ for SQLite)
+	log.Println("Running database migrations...")
+	runMigrations := migrate.RunMigrations
+	if cfg.Dialect == dialect.SQLite {
+		runMigrations = migrate.RunSQLiteMigrations
+	}
+	if err := runMigrations(a.DB); err != nil {
+		err = fmt.Errorf("migration error: %w", err)
+		errortrack.CaptureError(err, map[string]string{"kind": "migration"})
+		return nil, err
+	}
+	log.Printf("Connected to %s and migrations applied successfully!", cfg.Dialect)
+	return tracers, nil
+}
+
+func (a *App) configurePool(name string, db *sql.DB) {
+	db.SetConnMaxLifetime(a.cfg.ConnMaxLifetime)
+	db.SetMaxOpenConns(a.cfg.MaxOpenConns)
+	db.SetMaxIdleConns(a.cfg.MaxIdleConns)
+
+	pool := dbpool.New(db, dbpool.Options{
+		Pool:           name,
+		MaxOpenConns:   a.cfg.MaxOpenConns,
+		AutotuneMax:    a.cfg.PoolAutotuneMax,
+		TargetWait:     a.cfg.PoolAutotuneWait,
+		SaturationWarn: a.cfg.PoolSaturationWarn,
+	})
+	if pool.Autotuning() {
+		log.Printf("DB pool %s: autotuning MaxOpenConns between %d and %d", name, a.cfg.MaxOpenConns, a.cfg.PoolAutotuneMax)
+	}
+	a.pools = append(a.pools, pool)
+}
+
+func (a *App) closeDB(name string, db *sql.DB) {
+	a.closers = append(a.closers, func() {
+		if cerr := db.Close(); cerr != nil {
+			log.Printf("error closing %s: %v", name, cerr)
+		}
+	})
+}
+
+// openPostgres opens a pgx-backed *sql.DB for dsn.
+//
+// By default pgx only closes the socket when a query's context is canceled, which leaves the
+// query running on the server. Here a cancel request is sent instead, so a client that
+// disconnects (request context canceled) really stops its ILIKE scan; the socket deadline
+// remains as a fallback if the cancel request does not get through.
+// tracer reports slow queries on this pool.
+func openPostgres(dsn string, tracer *slowquery.Tracer) (*sql.DB, error) {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Tracer = tracer
+	cfg.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{
+			Conn:          conn,
+			DeadlineDelay: 2 * time.Second,
+		}
+	}
+	return stdlib.OpenDB(*cfg), nil
+}
+
+// connectRedis connects to REDIS_URL and checks that it answers.
+func (a *App) connectRedis() (*redis.Client, error) {
+	redisOpts, err := redis.ParseURL(a.cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	redisClient := redis.NewClient(redisOpts)
+	a.closers = append(a.closers, func() {
+		if cerr := redisClient.Close(); cerr != nil {
+			log.Printf("error closing Redis: %v", cerr)
+		}
+	})
+
+	pingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := redisClient.Ping(pingCtx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return redisClient, nil
+}
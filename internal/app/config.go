@@ -0,0 +1,576 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/clientip"
+	"devops-valgfag/internal/config"
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/experiments"
+	"devops-valgfag/internal/httpclient"
+	"devops-valgfag/internal/searchmerge"
+	"devops-valgfag/internal/storage"
+)
+
+// Config is everything New needs. ConfigFromEnv fills it from the environment variables
+// documented in the README; tests can build one directly.
+type Config struct {
+	Port     string // HTTP listen port
+	GRPCPort string // gRPC listen port, "off" disables the gRPC server
+	AppEnv   string // "prod" enables the stricter checks and quieter logs
+
+	SentryDSN     string
+	SentryRelease string
+
+	Dialect         dialect.Dialect
+	DSN             string  // PostgreSQL connection string
+	DSNMeta         DSNMeta // safe-to-log part of DSN
+	SQLitePath      string
+	ReplicaDSN      string // optional PostgreSQL read replica
+	ConnMaxLifetime time.Duration
+	MaxOpenConns    int
+	MaxIdleConns    int
+
+	PoolAutotuneMax    int           // 0 disables pool autotuning
+	PoolAutotuneWait   time.Duration // average wait that makes autotuning grow the pool
+	PoolSaturationWarn time.Duration // 0 disables the saturation warning
+
+	SessionKey string
+	// SessionKeyPairs are the securecookie hash/block key pairs of the session cookie: the
+	// current pair (SESSION_KEY, SESSION_ENC_KEY) signs and encrypts new cookies, a previous
+	// pair only reads cookies written before a key rotation.
+	SessionKeyPairs [][]byte
+
+	// Runtime holds the settings that can be reloaded; ReloadRuntime, if set, re-reads them on
+	// SIGHUP and POST /admin/config/reload.
+	Runtime       h.RuntimeConfig
+	ReloadRuntime func() (h.RuntimeConfig, error)
+
+	TemplateGlob   string
+	StaticDir      string
+	TemplateReload bool
+
+	PublicBaseURL       string
+	BasePath            string // "" or a path prefix such as "/whoknows"
+	MetricsSummaryToken string
+	RegistrationGuard   h.RegistrationGuardConfig
+	Terms               h.TermsConfig
+
+	SitemapRefresh      time.Duration
+	SavedSearchInterval time.Duration
+	RememberMeTTL       time.Duration
+	LoginFailureDelay   time.Duration
+	SoftDeleteRetention time.Duration
+	Retention           h.RetentionConfig
+
+	Storage        storage.Config
+	Backup         h.BackupConfig
+	BackupInterval time.Duration // 0 turns the schedule off
+
+	SchedulerEnabled bool
+	JobWorkers       int
+
+	RedisURL               string
+	SearchCacheTTL         time.Duration // 0 disables the search cache
+	RelatedCacheTTL        time.Duration // 0 disables the related pages cache
+	SearchStatementTimeout time.Duration // 0 disables the server-side cap
+
+	OpsACL     clientip.ACL
+	OpsACLFile string
+
+	Egress httpclient.Policy
+
+	RobotsDisallowAll bool
+	RobotsDisallow    []string
+}
+
+// DSNMeta is safe-to-log info about the DB connection (no password).
+type DSNMeta struct {
+	Source string // DB_HOST / DATABASE_URL / default
+	Host   string
+	DB     string
+	User   string
+}
+
+// ConfigFromEnv reads the configuration from lookup (os.Getenv in main). Invalid values of
+// required or security-relevant settings are errors; other malformed numbers and durations
+// fall back to their defaults.
+func ConfigFromEnv(lookup func(string) string) (Config, error) {
+	e := env(lookup)
+	var c Config
+	var err error
+
+	// PORT: which TCP port the HTTP server listens on (default 8080).
+	c.Port = e.get("PORT", "8080")
+
+	// GRPC_PORT: port for the internal gRPC SearchService + grpc.health.v1 (default 9090, "off" disables).
+	c.GRPCPort = e.get("GRPC_PORT", "9090")
+
+	// APP_ENV: used to toggle "prod" behavior (e.g. safer logging).
+	c.AppEnv = e.get("APP_ENV", "dev")
+
+	// SENTRY_DSN: optional Sentry (or compatible) project DSN; errors, panics, migration failures
+	// and external API failures are reported there. Unset = reporting is a no-op.
+	// SENTRY_RELEASE tags events with the deployed version (default: VCS revision of the build).
+	c.SentryDSN = e.get("SENTRY_DSN", "")
+	c.SentryRelease = e.get("SENTRY_RELEASE", "")
+
+	// DB_DRIVER: postgres (default) or sqlite, which runs everything on one SQLite file
+	// (DATABASE_PATH, default data/whoknows.db) to demo the app without a Postgres container.
+	if c.Dialect, err = dialect.Parse(e.get("DB_DRIVER", "")); err != nil {
+		return Config{}, err
+	}
+	c.SQLitePath = e.get("DATABASE_PATH", "data/whoknows.db")
+
+	// DSN = "Data Source Name" = connection string used by sql.Open().
+	if c.Dialect == dialect.Postgres {
+		if c.DSN, c.DSNMeta, err = resolvePostgresDSN(e); err != nil {
+			return Config{}, err
+		}
+	}
+
+	// DATABASE_URL_RO: optional read replica for search, suggestions and reports.
+	c.ReplicaDSN = e.get("DATABASE_URL_RO", "")
+
+	// Optional connection pool tuning (safe defaults)
+	c.ConnMaxLifetime = e.duration("DB_CONN_MAX_LIFETIME", 30*time.Minute)
+	c.MaxOpenConns = e.int("DB_MAX_OPEN_CONNS", 10)
+	c.MaxIdleConns = e.int("DB_MAX_IDLE_CONNS", 10)
+
+	// DB_POOL_SATURATION_WARN: log a warning (and count app_db_pool_saturation_warnings_total) when
+	// every connection of a pool has been in use with requests waiting for this long (default 10s, "0" disables).
+	// DB_POOL_AUTOTUNE_MAX: let a pool grow up to this many connections while requests wait longer than
+	// DB_POOL_AUTOTUNE_WAIT (default 20ms) on average; it shrinks back to DB_MAX_OPEN_CONNS when they
+	// stop waiting. Unset or not above DB_MAX_OPEN_CONNS = fixed pool size.
+	c.PoolSaturationWarn = e.durationOrOff("DB_POOL_SATURATION_WARN", 10*time.Second)
+	c.PoolAutotuneMax = e.int("DB_POOL_AUTOTUNE_MAX", 0)
+	c.PoolAutotuneWait = e.duration("DB_POOL_AUTOTUNE_WAIT", 20*time.Millisecond)
+
+	// SESSION_KEY is used by gorilla/sessions to sign (and possibly encrypt) cookies.
+	// If it is weak, sessions can be forged. That's why we enforce 32+ bytes in prod.
+	c.SessionKey = e.get("SESSION_KEY", "")
+	if c.SessionKey == "" {
+		return Config{}, errors.New("SESSION_KEY is required")
+	}
+	// Note: len(sessionKey) counts bytes, not characters.
+	if c.AppEnv == "prod" && len(c.SessionKey) < 32 {
+		return Config{}, errors.New("SESSION_KEY must be at least 32 bytes (not characters) in prod")
+	}
+
+	// SESSION_ENC_KEY encrypts the session cookie, so its values (user_id, ...) cannot be read
+	// client-side. It is an AES key of 16, 24 or 32 bytes, required in prod. For a rotation the
+	// old keys go into SESSION_KEY_PREVIOUS (default SESSION_KEY) and SESSION_ENC_KEY_PREVIOUS:
+	// cookies they wrote are still read and are rewritten with the new keys on the next change.
+	// Turning encryption on with SESSION_KEY_PREVIOUS set to SESSION_KEY keeps existing
+	// unencrypted sessions logged in the same way.
+	encKey := e.get("SESSION_ENC_KEY", "")
+	if encKey == "" && c.AppEnv == "prod" {
+		return Config{}, errors.New("SESSION_ENC_KEY is required in prod")
+	}
+	prevKey, prevEncKey := e.get("SESSION_KEY_PREVIOUS", ""), e.get("SESSION_ENC_KEY_PREVIOUS", "")
+	for key, value := range map[string]string{"SESSION_ENC_KEY": encKey, "SESSION_ENC_KEY_PREVIOUS": prevEncKey} {
+		if n := len(value); n != 0 && n != 16 && n != 24 && n != 32 {
+			return Config{}, fmt.Errorf("%s must be 16, 24 or 32 bytes, got %d", key, n)
+		}
+	}
+	c.SessionKeyPairs = [][]byte{[]byte(c.SessionKey), blockKey(encKey)}
+	if prevKey != "" || prevEncKey != "" {
+		if prevKey == "" {
+			prevKey = c.SessionKey
+		}
+		c.SessionKeyPairs = append(c.SessionKeyPairs, []byte(prevKey), blockKey(prevEncKey))
+	}
+
+	// Feature toggles, rate limits, trusted proxies and slow query logging: these can be
+	// changed without a restart (SIGHUP or POST /admin/config/reload, see RuntimeConfigFromEnv).
+	if c.Runtime, err = RuntimeConfigFromEnv(lookup, c.AppEnv, c.Dialect); err != nil {
+		return Config{}, err
+	}
+
+	// TEMPLATE_RELOAD=1 re-parses templates when they change on disk and serves static/ from
+	// disk instead of the embedded copy (dev only).
+	c.TemplateGlob = "./templates/*.html"
+	c.StaticDir = "static"
+	c.TemplateReload = e.get("TEMPLATE_RELOAD", "0") == "1"
+
+	// PUBLIC_BASE_URL: externally visible scheme://host used in absolute links (sitemap, OpenSearch).
+	// When empty, links are derived from each incoming request.
+	c.PublicBaseURL = e.get("PUBLIC_BASE_URL", "")
+
+	// BASE_PATH: path prefix the app is served under behind a reverse proxy (/whoknows).
+	if c.BasePath, err = parseBasePath(e.get("BASE_PATH", "")); err != nil {
+		return Config{}, err
+	}
+
+	// METRICS_SUMMARY_TOKEN: bearer token for GET /api/metrics/summary (dashboards without a
+	// session). When empty, only admins can read the summary.
+	c.MetricsSummaryToken = e.get("METRICS_SUMMARY_TOKEN", "")
+
+	// Registration bot checks: REGISTER_MIN_SUBMIT_TIME rejects register forms submitted faster
+	// than that after rendering (0 disables it); CAPTCHA_PROVIDER ("hcaptcha" or "turnstile")
+	// adds a CAPTCHA with CAPTCHA_SITE_KEY / CAPTCHA_SECRET. The honeypot field is always on.
+	c.RegistrationGuard = h.RegistrationGuardConfig{
+		MinSubmitTime:   e.duration("REGISTER_MIN_SUBMIT_TIME", 3*time.Second),
+		SigningKey:      []byte(c.SessionKey),
+		CaptchaProvider: e.get("CAPTCHA_PROVIDER", ""),
+		CaptchaSiteKey:  e.get("CAPTCHA_SITE_KEY", ""),
+		CaptchaSecret:   e.get("CAPTCHA_SECRET", ""),
+	}
+
+	// TERMS_VERSION: terms of service / privacy policy version users must accept at sign-up and,
+	// when it changes, on their next page view (unset = no consent tracking). TERMS_URL and
+	// PRIVACY_URL are where the documents are published.
+	c.Terms = h.TermsConfig{
+		Version:    e.get("TERMS_VERSION", ""),
+		TermsURL:   e.get("TERMS_URL", ""),
+		PrivacyURL: e.get("PRIVACY_URL", ""),
+	}
+
+	// SITEMAP_REFRESH: how often the sitemap snapshot is rebuilt from the pages table.
+	c.SitemapRefresh = e.duration("SITEMAP_REFRESH", time.Hour)
+
+	// SAVED_SEARCH_INTERVAL: how often saved searches are re-run to notify users about new matches.
+	c.SavedSearchInterval = e.duration("SAVED_SEARCH_INTERVAL", 15*time.Minute)
+
+	// REMEMBER_ME_TTL: how long "remember me" keeps a user logged in without a session.
+	c.RememberMeTTL = e.duration("REMEMBER_ME_TTL", 30*24*time.Hour)
+
+	// LOGIN_FAILURE_DELAY: failed logins are answered after a random delay between this and twice this.
+	c.LoginFailureDelay = e.duration("LOGIN_FAILURE_DELAY", 250*time.Millisecond)
+
+	// SOFT_DELETE_RETENTION: how long soft-deleted users/pages can be restored before purge_deleted removes them.
+	c.SoftDeleteRetention = e.duration("SOFT_DELETE_RETENTION", 30*24*time.Hour)
+
+	// SEARCH_LOG_RETENTION / EXTERNAL_CACHE_RETENTION: how long the anonymous search log and cached
+	// external results are kept before enforce_retention deletes them (e.g. 90d).
+	c.Retention = h.RetentionConfig{
+		SearchLog:     e.duration("SEARCH_LOG_RETENTION", 7*24*time.Hour),
+		ExternalCache: e.duration("EXTERNAL_CACHE_RETENTION", 30*24*time.Hour),
+	}
+
+	// STORAGE_BACKEND: where uploads (avatars) are kept. "filesystem" uses STORAGE_DIR, shared
+	// between replicas; "s3" uses an S3-compatible bucket (Amazon S3, MinIO).
+	// The S3 endpoint defaults to path-style addressing when set, as MinIO expects.
+	s3Endpoint := e.get("S3_ENDPOINT", "")
+	c.Storage = storage.Config{
+		Backend:    e.get("STORAGE_BACKEND", "filesystem"),
+		Dir:        e.get("STORAGE_DIR", "data/storage"),
+		SigningKey: []byte(c.SessionKey),
+		S3: storage.S3Config{
+			Endpoint:        s3Endpoint,
+			Region:          e.get("S3_REGION", "us-east-1"),
+			Bucket:          e.get("S3_BUCKET", ""),
+			AccessKeyID:     e.get("S3_ACCESS_KEY_ID", ""),
+			SecretAccessKey: e.get("S3_SECRET_ACCESS_KEY", ""),
+			PathStyle:       e.get("S3_PATH_STYLE", boolEnvDefault(s3Endpoint != "")) == "1",
+		},
+	}
+
+	// BACKUP_INTERVAL: how often backup_database dumps the database into storage under backups/
+	// (default 24h, "0" disables the schedule; POST /admin/backups still works).
+	// BACKUP_KEEP: how many backups are kept (default 7, "0" keeps all). PG_DUMP_PATH: the pg_dump binary.
+	c.BackupInterval = e.durationOrOff("BACKUP_INTERVAL", 24*time.Hour)
+	c.Backup = h.BackupConfig{
+		DSN:    c.DSN,
+		PGDump: e.get("PG_DUMP_PATH", "pg_dump"),
+		Keep:   e.int("BACKUP_KEEP", 7),
+	}
+
+	// SCHEDULER_ENABLED=0 keeps this replica out of leader election for cluster-wide periodic tasks.
+	c.SchedulerEnabled = e.get("SCHEDULER_ENABLED", "1") == "1"
+
+	// JOB_WORKERS: background job workers in this process (0 = enqueue only, e.g. a web-only replica).
+	c.JobWorkers = e.int("JOB_WORKERS", 2)
+
+	// REDIS_URL (e.g. redis://redis:6379/0): optional shared store for sessions, the search cache and
+	// rate limits so replicas behave as one. Unset = per-process (cookie sessions, in-memory cache/limits).
+	c.RedisURL = e.get("REDIS_URL", "")
+
+	// RELATED_CACHE_TTL: how long "related pages" lists are cached (default 10m, "0" disables).
+	c.RelatedCacheTTL = e.durationOrOff("RELATED_CACHE_TTL", 10*time.Minute)
+
+	// SEARCH_CACHE_TTL: how long search results are cached (default 30s, "0" disables).
+	c.SearchCacheTTL = e.durationOrOff("SEARCH_CACHE_TTL", 30*time.Second)
+
+	// SEARCH_STATEMENT_TIMEOUT: server-side cap (Postgres statement_timeout) per search/suggest query
+	// (default 2s to match the request timeout, "0" disables).
+	c.SearchStatementTimeout = e.durationOrOff("SEARCH_STATEMENT_TIMEOUT", 2*time.Second)
+
+	// Outbound HTTP (Wikipedia, DMI, CAPTCHA, Sentry, S3), see internal/httpclient. HTTP_PROXY /
+	// HTTPS_PROXY / NO_PROXY are honored. EGRESS_ALLOW_HOSTS: hosts requests may go to
+	// ("api.example.com", ".example.com" with subdomains; empty = any). EGRESS_HOST_RATE:
+	// requests per second per host (default 10, "0" = unlimited). EGRESS_MAX_CONNS: connections
+	// per host (default 10). EGRESS_USER_AGENT: sent unless a client sets its own
+	// (WIKI_USER_AGENT for Wikipedia).
+	if c.Egress.AllowHosts, err = httpclient.ParseHosts(e.get("EGRESS_ALLOW_HOSTS", "")); err != nil {
+		return Config{}, err
+	}
+	c.Egress.HostRate = e.int("EGRESS_HOST_RATE", 10)
+	c.Egress.MaxConnsPerHost = e.int("EGRESS_MAX_CONNS", 10)
+	c.Egress.UserAgent = e.get("EGRESS_USER_AGENT", httpclient.DefaultUserAgent)
+
+	// ADMIN_IP_ALLOW / ADMIN_IP_DENY: CIDRs/IPs allowed / denied on /admin, /api/admin, /metrics and /debug
+	// (deny wins; an empty allow list admits everyone else). ADMIN_IP_ACL_FILE adds "allow|deny <cidr>"
+	// lines from a file that is re-read when it changes.
+	if c.OpsACL.Allow, err = clientip.ParsePrefixes(e.get("ADMIN_IP_ALLOW", "")); err != nil {
+		return Config{}, err
+	}
+	if c.OpsACL.Deny, err = clientip.ParsePrefixes(e.get("ADMIN_IP_DENY", "")); err != nil {
+		return Config{}, err
+	}
+	c.OpsACLFile = e.get("ADMIN_IP_ACL_FILE", "")
+
+	// ROBOTS_DISALLOW_ALL: block all crawlers (defaults to on for APP_ENV=staging).
+	// ROBOTS_DISALLOW: comma-separated path prefixes replacing the default /api/, /admin/, /swagger/.
+	c.RobotsDisallowAll = e.get("ROBOTS_DISALLOW_ALL", boolEnvDefault(c.AppEnv == "staging")) == "1"
+	c.RobotsDisallow = splitCSV(e.get("ROBOTS_DISALLOW", ""))
+
+	return c, nil
+}
+
+// resolvePostgresDSN determines how the application should connect to PostgreSQL.
+// Precedence:
+// 1) DB_HOST + POSTGRES_* env vars (Docker / VM / local compose)
+// 2) DATABASE_URL (CI / cloud / managed databases)
+// 3) Fallback to docker-compose default service name
+//
+// It returns:
+// - a full DSN string used to open the DB connection
+// - safe-to-log metadata describing the chosen configuration
+func resolvePostgresDSN(e env) (string, DSNMeta, error) {
+
+	// Case 1: Running in Docker / VM where DB host is provided explicitly
+	if host := e.get("DB_HOST", ""); host != "" {
+		dsn, meta := buildPostgresDSN(e, host, "DB_HOST")
+		return dsn, meta, nil
+	}
+
+	// Case 2: Running in CI/cloud where a full DATABASE_URL is injected (e.g. GitHub Actions env).
+	if dsn := e.get("DATABASE_URL", ""); dsn != "" {
+		meta, err := extractDSNMeta(dsn)
+		if err != nil {
+			return "", DSNMeta{}, fmt.Errorf("invalid DATABASE_URL: %w", err)
+		}
+		meta.Source = "DATABASE_URL"
+		return dsn, meta, nil
+	}
+
+	// Case 3: Local docker-compose fallback (service name resolution)
+	dsn, meta := buildPostgresDSN(e, "postgres_db", "default")
+	return dsn, meta, nil
+}
+
+// buildPostgresDSN constructs a PostgreSQL connection string from individual environment variables.
+// This is used when the environment does NOT provide a full DATABASE_URL.
+func buildPostgresDSN(e env, host, source string) (string, DSNMeta) {
+	port := e.get("POSTGRES_PORT", "5432")
+	user := e.get("POSTGRES_USER", "devops")
+	pass := e.get("POSTGRES_PASSWORD", "devops")
+	dbName := e.get("POSTGRES_DB", "whoknows")
+	sslmode := e.get("POSTGRES_SSLMODE", "disable") // keeps your current behavior by default
+
+	dsn := fmt.Sprintf(
+		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		url.QueryEscape(user),
+		url.QueryEscape(pass),
+		host, // do NOT escape host
+		port,
+		url.QueryEscape(dbName),
+		url.QueryEscape(sslmode),
+	)
+
+	return dsn, DSNMeta{
+		Source: source,
+		Host:   host,
+		DB:     dbName,
+		User:   user,
+	}
+}
+
+func extractDSNMeta(raw string) (DSNMeta, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return DSNMeta{}, err
+	}
+
+	dbName := strings.TrimPrefix(parsed.Path, "/")
+	user := ""
+	if parsed.User != nil {
+		user = parsed.User.Username()
+	}
+
+	return DSNMeta{
+		Host: parsed.Hostname(),
+		DB:   dbName,
+		User: user,
+	}, nil
+}
+
+// RuntimeConfigFromEnv reads the settings that can be reloaded (see h.RuntimeConfig) from
+// lookup. Unlike the startup-only settings, invalid values are errors rather than defaults,
+// so a bad reload is rejected instead of half-applied.
+func RuntimeConfigFromEnv(lookup func(string) string, appEnv string, dbDialect dialect.Dialect) (h.RuntimeConfig, error) {
+	env := env(lookup).get
+	var rc h.RuntimeConfig
+	var errs []error
+	intSetting := func(key string, fallback int) int {
+		n, err := strconv.Atoi(env(key, strconv.Itoa(fallback)))
+		if err != nil || n < 0 {
+			errs = append(errs, fmt.Errorf("%s: want a non-negative integer", key))
+		}
+		return n
+	}
+	durationSetting := func(key string, fallback time.Duration) time.Duration {
+		v := env(key, fallback.String())
+		if v == "0" {
+			return 0
+		}
+		d, err := config.ParseDuration(v)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%s: want a duration like 500ms or 0", key))
+		}
+		return d
+	}
+
+	// Feature toggles. SQLite always has its FTS5 index (migrations/sqlite), so FTS is on by default there.
+	ftsDefault := "0"
+	if dbDialect == dialect.SQLite {
+		ftsDefault = "1"
+	}
+	rc.SearchFTS = env("SEARCH_FTS", ftsDefault) == "1"
+	rc.ExternalSearch = env("EXTERNAL_SEARCH", "1") == "1"
+
+	// SEARCH_MERGE_STRATEGY orders external results among local ones (append, interleave or
+	// score); SEARCH_EXTERNAL_QUOTA slots go to external results even when local ones fill the page.
+	strategy, err := searchmerge.ParseStrategy(env("SEARCH_MERGE_STRATEGY", string(searchmerge.Append)))
+	errs = append(errs, err)
+	rc.SearchMerge = searchmerge.Policy{Strategy: strategy, ExternalQuota: intSetting("SEARCH_EXTERNAL_QUOTA", 2)}
+
+	// SEARCH_SHADOW=path|ranking runs SEARCH_SHADOW_SAMPLE percent (default 100) of the page
+	// searches again on the alternate path in the background and compares the results (metrics only).
+	rc.SearchShadow, err = h.ParseShadowMode(env("SEARCH_SHADOW", ""))
+	errs = append(errs, err)
+	rc.SearchShadowSample = intSetting("SEARCH_SHADOW_SAMPLE", 100)
+	if rc.SearchShadowSample > 100 {
+		errs = append(errs, errors.New("SEARCH_SHADOW_SAMPLE: want a percentage from 0 to 100"))
+	}
+
+	// EXPERIMENTS: search A/B tests, e.g. "search_merge=append:50,interleave:50;search_ranking=v1,v2".
+	// Every replica must get the same value, or visitors switch variants between requests.
+	rc.Experiments, err = experiments.Parse(env("EXPERIMENTS", ""))
+	errs = append(errs, err)
+
+	// REGISTRATION_APPROVAL=1 makes new sign-ups pending until an admin activates them.
+	rc.RegistrationApproval = env("REGISTRATION_APPROVAL", "0") == "1"
+
+	// RATE_LIMIT_AUTH / RATE_LIMIT_API: requests per minute and client IP for login/register and
+	// search/GraphQL (defaults 10 and 120, 0 disables).
+	rc.RateLimitAuth = intSetting("RATE_LIMIT_AUTH", 10)
+	rc.RateLimitAPI = intSetting("RATE_LIMIT_API", 120)
+
+	// API_DAILY_QUOTA: API calls per logged-in user and UTC day on the same routes (default 5000,
+	// 0 disables).
+	rc.APIDailyQuota = intSetting("API_DAILY_QUOTA", 5000)
+
+	// TRUSTED_PROXIES: comma-separated CIDRs/IPs of reverse proxies whose X-Forwarded-For /
+	// X-Real-IP is believed for the client address (rate limits, audit log, logs). Empty = none.
+	rc.TrustedProxies, err = clientip.ParsePrefixes(env("TRUSTED_PROXIES", ""))
+	errs = append(errs, err)
+
+	// SLOW_QUERY_THRESHOLD: log DB queries taking at least this long (default 500ms, "0" disables).
+	// SLOW_QUERY_EXPLAIN=1 also logs their EXPLAIN plan (defaults to on outside prod).
+	rc.SlowQueryThreshold = durationSetting("SLOW_QUERY_THRESHOLD", 500*time.Millisecond)
+	rc.SlowQueryExplain = env("SLOW_QUERY_EXPLAIN", boolEnvDefault(appEnv != "prod")) == "1"
+
+	return rc, errors.Join(errs...)
+}
+
+// env reads settings from a lookup function (os.Getenv, or a map in tests).
+type env func(string) string
+
+// blockKey is a securecookie encryption key; nil (not empty) turns encryption off.
+func blockKey(key string) []byte {
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+// parseBasePath normalizes BASE_PATH to "" (the root) or "/segment[/segment...]" without a
+// trailing slash.
+func parseBasePath(v string) (string, error) {
+	p := strings.Trim(strings.TrimSpace(v), "/")
+	if p == "" {
+		return "", nil
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "" || seg == "." || seg == ".." || url.PathEscape(seg) != seg {
+			return "", fmt.Errorf("invalid BASE_PATH %q: want a path such as /whoknows", v)
+		}
+	}
+	return "/" + p, nil
+}
+
+func (e env) get(key, fallback string) string {
+	if v := e(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (e env) int(key string, fallback int) int {
+	v := e(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+func (e env) duration(key string, fallback time.Duration) time.Duration {
+	v := e(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := config.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// durationOrOff is duration for settings that "0" turns off.
+func (e env) durationOrOff(key string, fallback time.Duration) time.Duration {
+	if e(key) == "0" {
+		return 0
+	}
+	return e.duration(key, fallback)
+}
+
+// boolEnvDefault renders a bool as the "1"/"0" convention used by our feature flags.
+func boolEnvDefault(on bool) string {
+	if on {
+		return "1"
+	}
+	return "0"
+}
+
+// splitCSV splits a comma-separated env value, trimming blanks.
+func splitCSV(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if p := strings.TrimSpace(part); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
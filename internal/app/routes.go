@@ -0,0 +1,191 @@
+package app
+
+import (
+	"net/http"
+
+	_ "devops-valgfag/docs"
+	h "devops-valgfag/handlers"
+	metrics "devops-valgfag/internal/metrics"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	httpSwagger "github.com/swaggo/http-swagger"
+)
+
+// NewRouter builds the HTTP router with its middleware and every route, serving the embedded
+// static files. The handlers must have been wired (see New) before it serves requests.
+func NewRouter() *mux.Router {
+	r := mux.NewRouter()
+
+	// Metrics middleware (outermost, so recovered panics are counted as 500s)
+	r.Use(metrics.RequestMetricsMiddleware())
+	// Request IDs, then panic recovery: a panicking handler answers 500 with its request ID
+	r.Use(h.RequestIDMiddleware())
+	// Client address (behind TRUSTED_PROXIES), for the rate limiter, audit log and panic logs
+	r.Use(h.ClientIPMiddleware())
+	r.Use(h.TrafficMiddleware())
+	r.Use(h.RecoverMiddleware())
+	// Per-route time budgets (handlers/timeout.go): a request over its budget gets 504
+	r.Use(h.TimeoutMiddleware())
+	// Admin/ops routes are limited to ADMIN_IP_ALLOW / ADMIN_IP_DENY / ADMIN_IP_ACL_FILE
+	r.Use(h.OpsACLMiddleware())
+	// A valid remember-me cookie logs in a request without a session (before the guard checks it)
+	r.Use(h.RememberMeMiddleware())
+	// Sessions of deleted or non-active accounts, or with a revoked session_version, are cleared
+	r.Use(h.SessionGuardMiddleware())
+	// Page views of users who have not accepted the current TERMS_VERSION go to /consent
+	r.Use(h.ConsentMiddleware())
+	// Logged-in API calls count against API_DAILY_QUOTA (exempt routes in handlers/api_quota.go)
+	r.Use(h.APIQuotaMiddleware())
+
+	// Routes
+	// - Static assets
+	// - Pages
+	// - API
+	// - Admin (requires users.is_admin)
+	// - Health/metrics
+	// - Swagger
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", h.StaticHandler()))
+
+	r.HandleFunc("/", h.HomePageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/about", h.AboutPageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/login", h.LoginPageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/register", h.RegisterPageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/reset-password", h.ResetPasswordPageHandler).Methods(http.MethodGet)
+	r.HandleFunc("/settings", h.SettingsPageHandler).Methods(http.MethodGet)
+	r.HandleFunc("/consent", h.ConsentPageHandler).Methods(http.MethodGet)
+	r.HandleFunc("/confirm-email", h.ConfirmEmailHandler).Methods(http.MethodGet)
+	r.HandleFunc("/weather", h.WeatherPageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/stats", h.StatsPageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/status", h.StatusPageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/bookmarks", h.BookmarksPageHandler).Methods(http.MethodGet)
+	r.HandleFunc("/page/{id:[0-9]+}", h.ArticlePageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/u/{username}", h.ProfilePageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/u/{username}/avatar", h.AvatarHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/files/{key:.+}", h.SignedFileHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/s/{token:[0-9a-f]+}", h.SharedSearchHandler).Methods(http.MethodGet)
+	r.HandleFunc("/search", h.SearchPageHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/language/{lang}", h.SetLanguageHandler).Methods(http.MethodGet)
+	r.HandleFunc("/opensearch.xml", h.OpenSearchHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/robots.txt", h.RobotsHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/sitemap.xml", h.SitemapHandler).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/sitemap-{n:[0-9]+}.xml", h.SitemapPartHandler).Methods(http.MethodGet, http.MethodHead)
+
+	r.HandleFunc("/api/login", h.RateLimit("auth", h.APILoginHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/api/register", h.RateLimit("auth", h.APIRegisterHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/api/logout", h.APILogoutHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/password-reset", h.RateLimit("auth", h.APIPasswordResetHandler)).Methods(http.MethodPost)
+
+	r.HandleFunc("/api/search", h.RateLimit("api", h.APISearchHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/api/search/batch", h.RateLimit("api", h.APIBatchSearchHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/api/search/click", h.APISearchClickHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/search/widget", h.RateLimit("api", h.APISearchWidgetHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/api/pages/{id:[0-9]+}", h.APIGetPageHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/pages/{id:[0-9]+}/related", h.APIRelatedPagesHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/pages/{id:[0-9]+}/tags", h.RequireAdmin(h.APISetPageTagsHandler)).Methods(http.MethodPut)
+	r.HandleFunc("/api/tags", h.APITagsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/stats", h.APIStatsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/status", h.APIStatusHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/pages/{id:[0-9]+}", h.RequireAdmin(h.APIUpdatePageHandler)).Methods(http.MethodPut)
+	r.HandleFunc("/api/pages/{id:[0-9]+}/vote", h.APIVoteHandler).Methods(http.MethodPut)
+	r.HandleFunc("/api/pages/{id:[0-9]+}/vote", h.APIDeleteVoteHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/api/suggest", h.APISuggestHandler).Methods(http.MethodGet)
+
+	r.HandleFunc("/api/weather", h.APIWeatherHandler).Methods(http.MethodGet)
+
+	r.HandleFunc("/graphql", h.RateLimit("api", h.GraphQLHandler)).Methods(http.MethodPost)
+
+	r.HandleFunc("/api/me", h.APIMeHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/me/preferences", h.APIGetPreferencesHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/me/preferences", h.APIUpdatePreferencesHandler).Methods(http.MethodPut)
+	r.HandleFunc("/api/me/password", h.RateLimit("auth", h.APIChangePasswordHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/email", h.RateLimit("auth", h.APIChangeEmailHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/bookmarks", h.APIListBookmarksHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/me/bookmarks", h.APICreateBookmarkHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/bookmarks/{id:[0-9]+}", h.APIUpdateBookmarkHandler).Methods(http.MethodPatch)
+	r.HandleFunc("/api/me/bookmarks/{id:[0-9]+}", h.APIDeleteBookmarkHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/api/me/avatar", h.APIUploadAvatarHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/avatar", h.APIDeleteAvatarHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/api/me/saved-searches", h.APIListSavedSearchesHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/me/saved-searches", h.APICreateSavedSearchHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/saved-searches/{id:[0-9]+}", h.APIDeleteSavedSearchHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/api/me/notifications", h.APIListNotificationsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/me/notifications/read", h.APIMarkNotificationsReadHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/sessions", h.APIListSessionsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/api/me/sessions/{id:[0-9]+}", h.APIRevokeSessionHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/api/me/consent", h.APIAcceptTermsHandler).Methods(http.MethodPost)
+	r.HandleFunc("/api/me/export", h.APIAccountExportHandler).Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/sitemap", h.RequireAdmin(h.AdminRegenerateSitemapHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/announcements", h.RequireAdmin(h.AdminAnnouncementHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/reports/clicks", h.RequireAdmin(h.AdminClickReportHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/reports/traffic", h.RequireAdmin(h.AdminTrafficReportHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/experiments", h.RequireAdmin(h.AdminExperimentsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/search/explain", h.RequireAdmin(h.AdminSearchExplainHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/config/reload", h.RequireAdmin(h.AdminReloadConfigHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/jobs", h.RequireAdmin(h.AdminJobsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/jobs/{id:[0-9]+}/requeue", h.RequireAdmin(h.AdminRequeueJobHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/external-results/promote", h.RequireAdmin(h.AdminPromoteExternalHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/maintenance", h.RequireAdmin(h.AdminMaintenanceHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/maintenance/{operation}", h.RequireAdmin(h.AdminStartMaintenanceHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/retention", h.RequireAdmin(h.AdminRetentionHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/retention/run", h.RequireAdmin(h.AdminRunRetentionHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/backups", h.RequireAdmin(h.AdminBackupsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/backups", h.RequireAdmin(h.AdminCreateBackupHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/incidents", h.RequireAdmin(h.AdminIncidentsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/incidents", h.RequireAdmin(h.AdminCreateIncidentHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/incidents/{id:[0-9]+}", h.RequireAdmin(h.AdminUpdateIncidentHandler)).Methods(http.MethodPatch)
+	r.HandleFunc("/admin/incidents/{id:[0-9]+}", h.RequireAdmin(h.AdminDeleteIncidentHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/admin/scheduler", h.RequireAdmin(h.AdminSchedulerHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/scheduler/{name}/run", h.RequireAdmin(h.AdminRunTaskHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/audit", h.RequireAdmin(h.AdminAuditLogHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/tags", h.RequireAdmin(h.AdminListTagsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/tags", h.RequireAdmin(h.AdminCreateTagHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/tags/{id:[0-9]+}", h.RequireAdmin(h.AdminUpdateTagHandler)).Methods(http.MethodPatch)
+	r.HandleFunc("/admin/tags/{id:[0-9]+}", h.RequireAdmin(h.AdminDeleteTagHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/admin/tenants", h.RequireAdmin(h.AdminListTenantsHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/tenants", h.RequireAdmin(h.AdminCreateTenantHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/tenants/{id:[0-9]+}", h.RequireAdmin(h.AdminUpdateTenantHandler)).Methods(http.MethodPatch)
+	r.HandleFunc("/admin/tenants/{id:[0-9]+}", h.RequireAdmin(h.AdminDeleteTenantHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/admin/users", h.RequireAdmin(h.AdminListUsersHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/users", h.RequireAdmin(h.AdminCreateUserHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/users/{id:[0-9]+}", h.RequireAdmin(h.AdminGetUserHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/users/{id:[0-9]+}", h.RequireAdmin(h.AdminUpdateUserHandler)).Methods(http.MethodPatch)
+	r.HandleFunc("/admin/users/{id:[0-9]+}/disable", h.RequireAdmin(h.AdminDisableUserHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/users/{id:[0-9]+}/status", h.RequireAdmin(h.AdminSetUserStatusHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/users/{id:[0-9]+}/enable", h.RequireAdmin(h.AdminEnableUserHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/users/{id:[0-9]+}/reset-password", h.RequireAdmin(h.AdminResetPasswordHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/{kind:users|pages}/deleted", h.RequireAdmin(h.AdminListDeletedHandler)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/{kind:users|pages}/{id:[0-9]+}", h.RequireAdmin(h.AdminSoftDeleteHandler)).Methods(http.MethodDelete)
+	r.HandleFunc("/admin/{kind:users|pages}/{id:[0-9]+}/restore", h.RequireAdmin(h.AdminRestoreHandler)).Methods(http.MethodPost)
+
+	r.HandleFunc("/events", h.EventsHandler).Methods(http.MethodGet)
+
+	r.HandleFunc("/healthz", h.Healthz).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/readyz", h.Readyz).Methods(http.MethodGet, http.MethodHead)
+
+	r.Handle("/metrics", promhttp.Handler())
+	r.HandleFunc("/api/metrics/summary", h.RequireMetricsToken(h.APIMetricsSummaryHandler)).Methods(http.MethodGet)
+
+	swaggerHandler := httpSwagger.WrapHandler
+	// Support both /swagger and /swagger/index.html (avoids 404 without trailing slash).
+	r.HandleFunc("/swagger", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, h.URL("/swagger/index.html"), http.StatusFound)
+	}).Methods(http.MethodGet, http.MethodHead)
+
+	r.PathPrefix("/swagger/").Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			r2 := r.Clone(r.Context())
+			r2.Method = http.MethodGet
+			swaggerHandler.ServeHTTP(w, r2)
+			return
+		}
+		swaggerHandler.ServeHTTP(w, r)
+	})).Methods(http.MethodGet, http.MethodHead)
+
+	// 404/405 pages (after all routes: their prefixes label app_http_not_found_total)
+	h.RegisterMethodHandlers(r)
+	h.RegisterErrorHandlers(r)
+
+	return r
+}
@@ -0,0 +1,94 @@
+// Package apperror is the error type shared by handlers and the code they call: a Kind that
+// decides the HTTP status, a Message that is safe to show to users, and the internal Cause,
+// which is logged and reported but never shown. Handlers turn any error into a response with
+// one call (JSON for the API, the page's Error for forms), so status codes and wording no
+// longer depend on which handler ran into the problem.
+package apperror
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Kind classifies an error by what the client can do about it.
+type Kind uint8
+
+const (
+	Internal     Kind = iota // unexpected failure (database, bcrypt); the zero value
+	Invalid                  // bad input
+	Unauthorized             // not logged in or wrong credentials
+	Forbidden                // logged in or authenticated, but not allowed
+	NotFound                 // the thing does not exist
+	Conflict                 // clashes with existing data (username taken)
+	Unavailable              // a dependency (CAPTCHA, DMI) cannot be reached
+)
+
+var kindNames = [...]string{"internal", "invalid", "unauthorized", "forbidden", "not_found", "conflict", "unavailable"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "unknown"
+}
+
+// HTTPStatus is the status code a kind is answered with.
+func (k Kind) HTTPStatus() int {
+	switch k {
+	case Invalid:
+		return http.StatusBadRequest
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case Forbidden:
+		return http.StatusForbidden
+	case NotFound:
+		return http.StatusNotFound
+	case Conflict:
+		return http.StatusConflict
+	case Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error is an error with a kind and a user-facing message.
+type Error struct {
+	Kind    Kind
+	Message string // shown to the user (and translated by the templates)
+	Cause   error  // internal detail, may be nil
+}
+
+// Error returns the user message only, so passing an *Error on as a string can't leak the cause.
+func (e *Error) Error() string { return e.Message }
+
+// Unwrap returns the cause.
+func (e *Error) Unwrap() error { return e.Cause }
+
+// New returns an error without an internal cause.
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Wrap returns an error that shows message and keeps cause for the logs.
+func Wrap(kind Kind, message string, cause error) *Error {
+	return &Error{Kind: kind, Message: message, Cause: cause}
+}
+
+// InternalMessage is shown for errors that are not an *Error.
+const InternalMessage = "Internal server error"
+
+// From returns err as an *Error. Any other error becomes an Internal one with a generic message,
+// so its text is never shown to users.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Wrap(Internal, InternalMessage, err)
+}
+
+// KindOf returns the kind of err (Internal unless it is an *Error).
+func KindOf(err error) Kind {
+	return From(err).Kind
+}
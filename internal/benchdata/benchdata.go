@@ -0,0 +1,123 @@
+// Package benchdata generates deterministic search datasets and query streams for
+// benchmarks (handlers/search_bench_test.go) and the load generator (cmd/loadgen).
+//
+// Pages and queries are drawn from the same vocabulary with a Zipf distribution, so a few
+// terms are very common (many matches, cache-friendly) and most are rare, like real traffic.
+package benchdata
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// vocabulary is the word pool for titles, content and queries.
+var vocabulary = strings.Fields(`
+	go golang docker kubernetes postgres redis linux network search index query cache
+	server client request response database table column vector ranking latency metric
+	prometheus grafana alert deploy release container image volume cluster replica leader
+	lock queue worker job schedule cron backup restore migration schema trigger function
+	python java rust javascript typescript html css template session cookie token login
+	weather copenhagen denmark europe history science music sport football film book
+	author article wikipedia encyclopedia language english danish translation dictionary
+	algorithm graph tree hash sort binary stream channel goroutine mutex atomic pool
+	memory garbage profile benchmark allocation pointer slice map struct interface method
+	http grpc graphql rest json xml yaml proto compile build test coverage lint format
+	security password encryption certificate firewall proxy gateway balancer router
+	ocean river mountain forest city island climate energy solar wind battery planet
+`)
+
+// Options controls dataset generation.
+type Options struct {
+	Rows         int     // number of pages to insert
+	Language     string  // page language (default "en")
+	ContentWords int     // words of content per page (default 80)
+	Seed         int64   // random seed; the same seed yields the same dataset
+	ZipfS        float64 // Zipf skew (> 1, default 1.2)
+}
+
+func (o Options) withDefaults() Options {
+	if o.Language == "" {
+		o.Language = "en"
+	}
+	if o.ContentWords <= 0 {
+		o.ContentWords = 80
+	}
+	if o.ZipfS <= 1 {
+		o.ZipfS = 1.2
+	}
+	return o
+}
+
+// words draws vocabulary entries with a Zipf distribution.
+type words struct {
+	zipf *rand.Zipf
+}
+
+func newWords(r *rand.Rand, s float64) words {
+	return words{zipf: rand.NewZipf(r, s, 1, uint64(len(vocabulary)-1))}
+}
+
+func (w words) next() string {
+	return vocabulary[w.zipf.Uint64()]
+}
+
+// Seed inserts opts.Rows generated pages in batches. URLs are /bench/<n>, so calling Seed
+// again on a seeded table fails on the unique constraint instead of duplicating data.
+// It only uses portable SQL and works on PostgreSQL and SQLite.
+func Seed(ctx context.Context, db *sql.DB, opts Options) error {
+	opts = opts.withDefaults()
+	r := rand.New(rand.NewSource(opts.Seed))
+	w := newWords(r, opts.ZipfS)
+
+	const batch = 200
+	for start := 0; start < opts.Rows; start += batch {
+		n := min(batch, opts.Rows-start)
+
+		var sb strings.Builder
+		sb.WriteString(`INSERT INTO pages (title, url, language, last_updated, content) VALUES `)
+		args := make([]any, 0, n*4)
+		for i := 0; i < n; i++ {
+			id := start + i
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			p := len(args)
+			fmt.Fprintf(&sb, "($%d, $%d, $%d, CURRENT_TIMESTAMP, $%d)", p+1, p+2, p+3, p+4)
+
+			content := make([]string, opts.ContentWords)
+			for j := range content {
+				content[j] = w.next()
+			}
+			title := fmt.Sprintf("%s %s %d", w.next(), w.next(), id)
+			args = append(args, title, fmt.Sprintf("/bench/%d", id), opts.Language, strings.Join(content, " "))
+		}
+
+		if _, err := db.ExecContext(ctx, sb.String(), args...); err != nil {
+			return fmt.Errorf("seed rows %d-%d: %w", start, start+n-1, err)
+		}
+	}
+	return nil
+}
+
+// Queries returns n search queries with a realistic skew: mostly single terms, some
+// two-term queries, popular terms repeating often.
+func Queries(n int, seed int64, zipfS float64) []string {
+	if zipfS <= 1 {
+		zipfS = 1.2
+	}
+	r := rand.New(rand.NewSource(seed))
+	w := newWords(r, zipfS)
+
+	out := make([]string, n)
+	for i := range out {
+		if r.Intn(4) == 0 {
+			out[i] = w.next() + " " + w.next()
+		} else {
+			out[i] = w.next()
+		}
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+// Package cache is a small byte-oriented TTL cache with an in-memory and a Redis backend.
+//
+// The in-memory cache is per process; the Redis cache (REDIS_URL) is shared by all replicas.
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache stores values for a limited time. A miss is (nil, false, nil).
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Memory is an in-process Cache holding at most maxEntries values.
+type Memory struct {
+	mu         sync.Mutex
+	maxEntries int
+	items      map[string]memoryItem
+}
+
+type memoryItem struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemory creates an in-memory cache. maxEntries <= 0 means 1000.
+func NewMemory(maxEntries int) *Memory {
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	return &Memory{maxEntries: maxEntries, items: map[string]memoryItem{}}
+}
+
+// Get returns the value for key unless it is missing or expired.
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(it.expiresAt) {
+		delete(m.items, key)
+		return nil, false, nil
+	}
+	return it.value, true, nil
+}
+
+// Set stores value for ttl. When full, expired entries are dropped first, then arbitrary ones.
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.items[key]; !exists && len(m.items) >= m.maxEntries {
+		now := time.Now()
+		for k, it := range m.items {
+			if now.After(it.expiresAt) {
+				delete(m.items, k)
+			}
+		}
+		for k := range m.items {
+			if len(m.items) < m.maxEntries {
+				break
+			}
+			delete(m.items, k)
+		}
+	}
+	m.items[key] = memoryItem{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Redis is a Cache shared across replicas. Keys are namespaced with prefix.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis creates a Redis-backed cache.
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+// Get returns the value for key; redis.Nil is reported as a miss.
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+// Set stores value with a Redis expiry of ttl.
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+}
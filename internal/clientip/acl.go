@@ -0,0 +1,79 @@
+package clientip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// ACL is an allow/deny list of networks. Deny wins; a non-empty allow list admits only the
+// addresses in it, an empty one admits everyone not denied.
+type ACL struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// Empty reports whether the ACL admits everyone.
+func (a ACL) Empty() bool {
+	return len(a.Allow) == 0 && len(a.Deny) == 0
+}
+
+// Permits reports whether ip may pass. An unparsable ip only passes an empty ACL.
+func (a ACL) Permits(ip string) bool {
+	if a.Empty() {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	if contains(addr, a.Deny) {
+		return false
+	}
+	return len(a.Allow) == 0 || contains(addr, a.Allow)
+}
+
+// Merge returns a with the entries of b added.
+func (a ACL) Merge(b ACL) ACL {
+	return ACL{
+		Allow: append(append([]netip.Prefix(nil), a.Allow...), b.Allow...),
+		Deny:  append(append([]netip.Prefix(nil), a.Deny...), b.Deny...),
+	}
+}
+
+// ParseACL reads an ACL file: one "allow <cidr|ip>" or "deny <cidr|ip>" per line; blank
+// lines and # comments are ignored.
+//
+//	# office and VPN
+//	allow 192.0.2.0/24
+//	allow 10.8.0.0/16
+//	deny 10.8.0.13
+func ParseACL(r io.Reader) (ACL, error) {
+	var acl ACL
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return ACL{}, fmt.Errorf("clientip: line %d: want \"allow|deny <network>\"", n)
+		}
+		p, err := parsePrefix(fields[1])
+		if err != nil {
+			return ACL{}, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			acl.Allow = append(acl.Allow, p)
+		case "deny":
+			acl.Deny = append(acl.Deny, p)
+		default:
+			return ACL{}, fmt.Errorf("clientip: line %d: unknown rule %q", n, fields[0])
+		}
+	}
+	return acl, sc.Err()
+}
@@ -0,0 +1,136 @@
+// Package clientip finds a request's client address behind reverse proxies. Forwarding
+// headers (X-Forwarded-For, X-Real-IP) are only believed when the connection comes from a
+// trusted proxy; anyone else could set them to dodge rate limits or forge audit entries.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParsePrefixes parses a comma-separated list of CIDRs and single addresses
+// ("10.0.0.0/8, 127.0.0.1"), e.g. the trusted proxies. An empty list yields no prefixes.
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		p, err := parsePrefix(field)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// parsePrefix parses a CIDR, or a single address as a one-address prefix.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("clientip: invalid network %q: %w", s, err)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("clientip: invalid address %q: %w", s, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Resolve returns the client IP of a request received from remoteAddr ("host:port").
+//
+// Unless the peer is trusted it is the client. Otherwise X-Forwarded-For is walked from the
+// right (the entry the nearest proxy appended) past trusted proxies; the first other address
+// is the client. Entries left of it are client-controlled and ignored. Without
+// X-Forwarded-For, X-Real-IP is used. An unparsable entry stops the walk at the last trusted hop.
+func Resolve(remoteAddr string, header http.Header, trusted []netip.Prefix) string {
+	peer := host(remoteAddr)
+	if !Trusted(remoteAddr, trusted) {
+		return peer
+	}
+	addr, _ := netip.ParseAddr(peer)
+
+	hops := forwardedFor(header)
+	if len(hops) == 0 {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap().String()
+		}
+		return peer
+	}
+	client := addr.Unmap()
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !contains(client, trusted) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// Trusted reports whether the peer remoteAddr ("host:port") is one of the trusted proxies,
+// whose other forwarding headers (X-Forwarded-Proto) may be believed as well.
+func Trusted(remoteAddr string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(host(remoteAddr))
+	return err == nil && contains(addr, trusted)
+}
+
+// forwardedFor returns the X-Forwarded-For entries of all header lines, in order.
+func forwardedFor(header http.Header) []string {
+	var hops []string
+	for _, line := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(line, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+func contains(addr netip.Addr, prefixes []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// host strips the port from remoteAddr, leaving it as is when it has none.
+func host(remoteAddr string) string {
+	h, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return h
+}
+
+// Network returns the network of an address for coarse grouping without keeping the exact
+// address: the /24 of an IPv4 and the /48 of an IPv6 address ("" when ip is not an address).
+func Network(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	p, _ := addr.Prefix(bits)
+	return p.String()
+}
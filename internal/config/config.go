@@ -0,0 +1,337 @@
+// Package config reads the optional YAML config file (CONFIG_FILE, see config.example.yaml).
+//
+// The file holds the same settings as the environment variables, so there is one list of
+// settings to document and every package keeps reading os.Getenv. Keys are the variable
+// names in lowercase, and may be nested by their underscore-separated prefix:
+//
+//	search:
+//	  fts: true          # SEARCH_FTS=1
+//	  cache_ttl: 30s     # SEARCH_CACHE_TTL=30s
+//	rate_limit:
+//	  auth: 10           # RATE_LIMIT_AUTH=10
+//	trusted_proxies:     # TRUSTED_PROXIES=10.0.0.0/8,127.0.0.1
+//	  - 10.0.0.0/8
+//	  - 127.0.0.1
+//
+// Apply exports the settings into the environment, skipping variables that are already set:
+// the environment overrides the file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/clientip"
+	"devops-valgfag/internal/experiments"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kind is how a setting's YAML value is validated and rendered as an environment value.
+type kind int
+
+const (
+	kindString      kind = iota
+	kindBool             // true/false (or 1/0), rendered as "1"/"0"
+	kindInt              // non-negative integer
+	kindDuration         // Go duration ("30s", "15m"), whole days ("90d") or 0
+	kindList             // sequence (or comma-separated string), rendered comma-separated
+	kindNetworks         // kindList of CIDRs/IPs
+	kindExperiments      // EXPERIMENTS string, or a map of experiment -> variants
+)
+
+// settings are the known environment variables. Keys outside this list are rejected, so a
+// typo fails at startup instead of being silently ignored.
+var settings = map[string]kind{
+	"PORT":                     kindString,
+	"GRPC_PORT":                kindString,
+	"APP_ENV":                  kindString,
+	"PUBLIC_BASE_URL":          kindString,
+	"BASE_PATH":                kindString,
+	"SESSION_KEY":              kindString,
+	"SESSION_ENC_KEY":          kindString,
+	"SESSION_KEY_PREVIOUS":     kindString,
+	"SESSION_ENC_KEY_PREVIOUS": kindString,
+	"TEMPLATE_RELOAD":          kindBool,
+	"SENTRY_DSN":               kindString,
+	"SENTRY_RELEASE":           kindString,
+	"DB_HOST":                  kindString,
+	"DATABASE_URL":             kindString,
+	"DATABASE_URL_RO":          kindString,
+	"DB_MAX_OPEN_CONNS":        kindInt,
+	"DB_MAX_IDLE_CONNS":        kindInt,
+	"DB_CONN_MAX_LIFETIME":     kindDuration,
+	"DB_POOL_AUTOTUNE_MAX":     kindInt,
+	"DB_POOL_AUTOTUNE_WAIT":    kindDuration,
+	"DB_POOL_SATURATION_WARN":  kindDuration,
+	"POSTGRES_USER":            kindString,
+	"POSTGRES_PASSWORD":        kindString,
+	"POSTGRES_DB":              kindString,
+	"POSTGRES_PORT":            kindString,
+	"POSTGRES_SSLMODE":         kindString,
+	"REDIS_URL":                kindString,
+	"SEARCH_FTS":               kindBool,
+	"EXTERNAL_SEARCH":          kindBool,
+	"SEARCH_MERGE_STRATEGY":    kindString,
+	"SEARCH_EXTERNAL_QUOTA":    kindInt,
+	"SEARCH_SHADOW":            kindString,
+	"SEARCH_SHADOW_SAMPLE":     kindInt,
+	"SEARCH_CACHE_TTL":         kindDuration,
+	"SEARCH_STATEMENT_TIMEOUT": kindDuration,
+	"RELATED_CACHE_TTL":        kindDuration,
+	"EXPERIMENTS":              kindExperiments,
+	"WIKI_USER_AGENT":          kindString,
+	"WIKIPEDIA_API_URL":        kindString,
+	"EGRESS_ALLOW_HOSTS":       kindList,
+	"EGRESS_HOST_RATE":         kindInt,
+	"EGRESS_MAX_CONNS":         kindInt,
+	"EGRESS_USER_AGENT":        kindString,
+	"HTTP_PROXY":               kindString,
+	"HTTPS_PROXY":              kindString,
+	"NO_PROXY":                 kindString,
+	"RATE_LIMIT_AUTH":          kindInt,
+	"RATE_LIMIT_API":           kindInt,
+	"API_DAILY_QUOTA":          kindInt,
+	"TRUSTED_PROXIES":          kindNetworks,
+	"ADMIN_IP_ALLOW":           kindNetworks,
+	"ADMIN_IP_DENY":            kindNetworks,
+	"ADMIN_IP_ACL_FILE":        kindString,
+	"REGISTRATION_APPROVAL":    kindBool,
+	"TERMS_VERSION":            kindString,
+	"TERMS_URL":                kindString,
+	"PRIVACY_URL":              kindString,
+	"SCHEDULER_ENABLED":        kindBool,
+	"JOB_WORKERS":              kindInt,
+	"SAVED_SEARCH_INTERVAL":    kindDuration,
+	"SITEMAP_REFRESH":          kindDuration,
+	"SOFT_DELETE_RETENTION":    kindDuration,
+	"SEARCH_LOG_RETENTION":     kindDuration,
+	"EXTERNAL_CACHE_RETENTION": kindDuration,
+	"SLOW_QUERY_THRESHOLD":     kindDuration,
+	"SLOW_QUERY_EXPLAIN":       kindBool,
+	"ROBOTS_DISALLOW":          kindList,
+	"ROBOTS_DISALLOW_ALL":      kindBool,
+	"STORAGE_BACKEND":          kindString,
+	"STORAGE_DIR":              kindString,
+	"S3_ENDPOINT":              kindString,
+	"S3_REGION":                kindString,
+	"S3_BUCKET":                kindString,
+	"S3_ACCESS_KEY_ID":         kindString,
+	"S3_SECRET_ACCESS_KEY":     kindString,
+	"S3_PATH_STYLE":            kindBool,
+	"DMI_API_KEY":              kindString,
+	"DMI_API_URL":              kindString,
+	"DMI_HTTP_TIMEOUT":         kindDuration,
+	"SMTP_ADDR":                kindString,
+	"SMTP_FROM":                kindString,
+	"SMTP_USERNAME":            kindString,
+	"SMTP_PASSWORD":            kindString,
+}
+
+// Load reads and validates the YAML file at path (see Parse). A missing file is reported
+// as an error wrapping fs.ErrNotExist.
+func Load(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// Parse validates YAML settings and returns them as environment values by variable name.
+func Parse(data []byte) (map[string]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if len(doc.Content) == 0 {
+		return values, nil // empty file
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("top level must be a mapping")
+	}
+	if err := flatten(root, "", values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// flatten adds the settings of mapping node m, whose keys are prefixed with prefix.
+func flatten(m *yaml.Node, prefix string, values map[string]string) error {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, val := m.Content[i], m.Content[i+1]
+		name := strings.ToUpper(key.Value)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		k, known := settings[name]
+		switch {
+		case known:
+			v, err := render(k, val)
+			if err != nil {
+				return fmt.Errorf("line %d: %s: %w", key.Line, name, err)
+			}
+			if _, dup := values[name]; dup {
+				return fmt.Errorf("line %d: %s is set twice", key.Line, name)
+			}
+			values[name] = v
+		case val.Kind == yaml.MappingNode:
+			if err := flatten(val, name, values); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("line %d: unknown setting %q (%s)", key.Line, key.Value, name)
+		}
+	}
+	return nil
+}
+
+// render validates node as a k setting and returns its environment value.
+func render(k kind, node *yaml.Node) (string, error) {
+	switch k {
+	case kindList, kindNetworks:
+		list, err := scalarList(node)
+		if err != nil {
+			return "", err
+		}
+		if k == kindNetworks {
+			if _, err := clientip.ParsePrefixes(list); err != nil {
+				return "", err
+			}
+		}
+		return list, nil
+	case kindExperiments:
+		spec, err := experimentSpec(node)
+		if err != nil {
+			return "", err
+		}
+		if _, err := experiments.Parse(spec); err != nil {
+			return "", err
+		}
+		return spec, nil
+	}
+
+	if node.Kind != yaml.ScalarNode {
+		return "", errors.New("want a single value")
+	}
+	v := strings.TrimSpace(node.Value)
+	switch k {
+	case kindBool:
+		switch strings.ToLower(v) {
+		case "true", "yes", "on", "1":
+			return "1", nil
+		case "false", "no", "off", "0":
+			return "0", nil
+		}
+		return "", fmt.Errorf("want true or false, got %q", v)
+	case kindInt:
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			return "", fmt.Errorf("want a non-negative integer, got %q", v)
+		}
+	case kindDuration:
+		if d, err := ParseDuration(v); v != "0" && (err != nil || d <= 0) {
+			return "", fmt.Errorf("want a duration like 30s, 90d or 0, got %q", v)
+		}
+	}
+	return v, nil
+}
+
+// scalarList renders a sequence of scalars (or a single scalar) comma-separated.
+func scalarList(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return strings.TrimSpace(node.Value), nil
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", errors.New("want a list of values")
+			}
+			items = append(items, strings.TrimSpace(item.Value))
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", errors.New("want a list of values")
+}
+
+// experimentSpec renders EXPERIMENTS: a string as is, or a mapping of experiment to its
+// variants ("append:50,interleave:50" or a list of "variant:weight").
+func experimentSpec(node *yaml.Node) (string, error) {
+	if node.Kind == yaml.ScalarNode {
+		return strings.TrimSpace(node.Value), nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return "", errors.New("want a string or a mapping of experiment to variants")
+	}
+	var specs []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		variants, err := scalarList(node.Content[i+1])
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", node.Content[i].Value, err)
+		}
+		specs = append(specs, node.Content[i].Value+"="+variants)
+	}
+	return strings.Join(specs, ";"), nil
+}
+
+// Apply sets the environment variables in values that are not already set, and returns
+// the names of those left alone because the environment overrides them.
+func Apply(values map[string]string) (overridden []string, err error) {
+	for name, v := range values {
+		if _, set := os.LookupEnv(name); set {
+			overridden = append(overridden, name)
+			continue
+		}
+		if err := os.Setenv(name, v); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(overridden)
+	return overridden, nil
+}
+
+// Environ returns a snapshot of the environment, to layer a re-read config file under with
+// Lookup once Apply has filled in the previous file's values.
+func Environ() map[string]string {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if name, v, ok := strings.Cut(kv, "="); ok {
+			env[name] = v
+		}
+	}
+	return env
+}
+
+// Lookup returns a getenv for values layered under env, as Apply does: env wins where set.
+func Lookup(env, values map[string]string) func(string) string {
+	return func(name string) string {
+		if v, ok := env[name]; ok {
+			return v
+		}
+		return values[name]
+	}
+}
+
+// ParseDuration parses a Go duration ("15m", "720h") or a whole number of days ("90d"), the
+// natural unit for retention settings.
+func ParseDuration(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(v)
+}
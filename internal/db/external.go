@@ -1,47 +1,53 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"log"
 )
 
+// The external_results queries use $n placeholders and ON CONFLICT, which both PostgreSQL
+// (pgx) and SQLite (tests, DB_DRIVER=sqlite) understand, so they need no dialect switch.
+
 type ExternalResult struct {
 	Title   string
 	URL     string
 	Snippet string
 }
 
-// ExternalExists checks if results already exist for a query+language.
-func ExternalExists(database *sql.DB, query, language string) bool {
-	var count int
-	err := database.QueryRow(
-		`SELECT COUNT(*) FROM external_results WHERE query = $1 AND language = $2`,
-		query, language,
-	).Scan(&count)
-	if err != nil {
-		log.Println("ExternalExists error:", err)
-		return false
-	}
-	return count > 0
+// ExternalExists checks if results already exist for a query+language in a tenant.
+func ExternalExists(ctx context.Context, database *sql.DB, tenant int, query, language string) (bool, error) {
+	var exists bool
+	err := database.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM external_results WHERE tenant_id = $1 AND query = $2 AND language = $3)`,
+		tenant, query, language,
+	).Scan(&exists)
+	return exists, err
 }
 
-// InsertExternal saves scraped results to the database.
-func InsertExternal(database *sql.DB, query, lang string, items []ExternalResult) error {
+// InsertExternal saves scraped results for a tenant to the database, in one transaction.
+// Re-scraped results refresh title/snippet and created_at, so created_at is the time last seen.
+func InsertExternal(ctx context.Context, database *sql.DB, tenant int, query, lang string, items []ExternalResult) error {
 	if len(items) == 0 {
 		return nil
 	}
 
-	tx, err := database.Begin()
+	tx, err := database.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = tx.Rollback() // no-op after Commit
+	}()
 
-	stmt, err := tx.Prepare(`
-INSERT INTO external_results (query, language, title, url, snippet)
-VALUES ($1, $2, $3, $4, $5)
-ON CONFLICT (query, language, url) DO NOTHING`)
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO external_results (tenant_id, query, language, title, url, snippet)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (tenant_id, query, language, url) DO UPDATE SET
+  title = excluded.title,
+  snippet = excluded.snippet,
+  created_at = CURRENT_TIMESTAMP`)
 	if err != nil {
-		_ = tx.Rollback()
 		return err
 	}
 	defer func() {
@@ -49,26 +55,21 @@ ON CONFLICT (query, language, url) DO NOTHING`)
 	}()
 
 	for _, r := range items {
-		if _, err := stmt.Exec(query, lang, r.Title, r.URL, r.Snippet); err != nil {
-			log.Println("InsertExternal exec error:", err)
-			_ = tx.Rollback()
+		if _, err := stmt.ExecContext(ctx, tenant, query, lang, r.Title, r.URL, r.Snippet); err != nil {
 			return err
 		}
 	}
-
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-	return nil
+	return tx.Commit()
 }
 
-// GetExternal loads external results from the database.
-func GetExternal(database *sql.DB, query, lang string) ([]ExternalResult, error) {
-	rows, err := database.Query(
+// GetExternal loads a tenant's external results from the database.
+func GetExternal(ctx context.Context, database *sql.DB, tenant int, query, lang string) ([]ExternalResult, error) {
+	rows, err := database.QueryContext(ctx,
 		`SELECT title, url, snippet
          FROM external_results
-         WHERE query = $1 AND language = $2`,
-		query, lang,
+         WHERE tenant_id = $1 AND query = $2 AND language = $3
+         ORDER BY id`,
+		tenant, query, lang,
 	)
 	if err != nil {
 		return nil, err
@@ -7,9 +7,40 @@ CREATE TABLE IF NOT EXISTS users (
   id        INTEGER PRIMARY KEY AUTOINCREMENT,
   username  TEXT NOT NULL UNIQUE,
   email     TEXT NOT NULL UNIQUE,
-  password  TEXT NOT NULL
+  password  TEXT NOT NULL,
+  is_admin  BOOLEAN NOT NULL DEFAULT FALSE,
+  deleted_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  last_login_at TIMESTAMP,
+  status    TEXT NOT NULL CHECK(status IN ('pending', 'active', 'disabled', 'banned')) DEFAULT 'active',
+  status_reason TEXT NOT NULL DEFAULT '',
+  status_changed_at TIMESTAMP,
+  must_reset_password BOOLEAN NOT NULL DEFAULT FALSE,
+  password_reset_hash TEXT,
+  password_reset_expires TIMESTAMP,
+  session_version INTEGER NOT NULL DEFAULT 0,
+  avatar_key TEXT,
+  pending_email TEXT,
+  email_change_hash TEXT,
+  email_change_expires TIMESTAMP,
+  terms_version TEXT
 );
 
+-- ===============================
+-- Drop and recreate tenants table (search corpora; pages default to tenant 1)
+-- ===============================
+DROP TABLE IF EXISTS tenants;
+
+CREATE TABLE IF NOT EXISTS tenants (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  slug       TEXT NOT NULL UNIQUE,
+  name       TEXT NOT NULL,
+  hostname   TEXT UNIQUE,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO tenants (id, slug, name) VALUES (1, 'default', 'Default');
+
 -- ===============================
 -- Drop and recreate pages table
 -- ===============================
@@ -17,13 +48,21 @@ DROP TABLE IF EXISTS pages;
 
 CREATE TABLE IF NOT EXISTS pages (
   id           INTEGER PRIMARY KEY AUTOINCREMENT,
-  title        TEXT UNIQUE,
-  url          TEXT UNIQUE,
+  title        TEXT,
+  url          TEXT,
   language     TEXT NOT NULL CHECK(language IN ('en', 'da')) DEFAULT 'en',
   last_updated TIMESTAMP,
-  content      TEXT NOT NULL
+  content      TEXT NOT NULL,
+  deleted_at   TIMESTAMP,
+  version      INTEGER NOT NULL DEFAULT 1,
+  tenant_id    INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
+  UNIQUE(tenant_id, title),
+  UNIQUE(tenant_id, url)
 );
 
+CREATE INDEX IF NOT EXISTS idx_pages_tenant_language_id
+  ON pages (tenant_id, language, id) WHERE deleted_at IS NULL;
+
 -- Sample content
 INSERT INTO pages (title, url, language, last_updated, content)
 VALUES
@@ -45,8 +84,382 @@ CREATE TABLE IF NOT EXISTS external_results (
   url        TEXT NOT NULL,
   snippet    TEXT NOT NULL,
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-  UNIQUE(query, language, url)                  
+  tenant_id  INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
+  UNIQUE(tenant_id, query, language, url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_external_tenant_query_lang
+  ON external_results (tenant_id, query, language);
+
+-- ===============================
+-- Drop and recreate user_preferences table
+-- ===============================
+DROP TABLE IF EXISTS user_preferences;
+
+CREATE TABLE IF NOT EXISTS user_preferences (
+  user_id          INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  theme            TEXT NOT NULL CHECK(theme IN ('system', 'light', 'dark')) DEFAULT 'system',
+  language         TEXT NOT NULL CHECK(language IN ('en', 'da')) DEFAULT 'en',
+  results_per_page INTEGER NOT NULL CHECK(results_per_page BETWEEN 5 AND 100) DEFAULT 50,
+  login_alerts     BOOLEAN NOT NULL DEFAULT TRUE,
+  language_set     BOOLEAN NOT NULL DEFAULT FALSE,
+  updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ===============================
+-- Drop and recreate search_clicks table
+-- ===============================
+DROP TABLE IF EXISTS search_clicks;
+
+CREATE TABLE IF NOT EXISTS search_clicks (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  query      TEXT NOT NULL,
+  language   TEXT NOT NULL DEFAULT 'en',
+  url        TEXT NOT NULL,
+  rank       INTEGER NOT NULL CHECK(rank >= 1),
+  page_id    INTEGER REFERENCES pages(id) ON DELETE SET NULL,
+  user_id    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  clicked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  variants   TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_clicks_query_lang
+  ON search_clicks (query, language);
+
+-- ===============================
+-- Drop and recreate result_votes table
+-- ===============================
+DROP TABLE IF EXISTS result_votes;
+
+CREATE TABLE IF NOT EXISTS result_votes (
+  user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  page_id    INTEGER NOT NULL REFERENCES pages(id) ON DELETE CASCADE,
+  vote       INTEGER NOT NULL CHECK(vote IN (-1, 1)),
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, page_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_result_votes_page
+  ON result_votes (page_id);
+
+-- ===============================
+-- Drop and recreate bookmarks table
+-- ===============================
+DROP TABLE IF EXISTS bookmarks;
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  title      TEXT NOT NULL,
+  url        TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  is_public  BOOLEAN NOT NULL DEFAULT FALSE,
+  UNIQUE(user_id, url)
+);
+
+-- ===============================
+-- Drop and recreate saved_searches / notifications tables
+-- ===============================
+DROP TABLE IF EXISTS saved_searches;
+
+CREATE TABLE IF NOT EXISTS saved_searches (
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id           INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name              TEXT NOT NULL,
+  query             TEXT NOT NULL,
+  language          TEXT NOT NULL CHECK(language IN ('en', 'da')) DEFAULT 'en',
+  share_token       TEXT NOT NULL UNIQUE,
+  last_seen_page_id INTEGER NOT NULL DEFAULT 0,
+  last_run_at       TIMESTAMP,
+  created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  tenant_id         INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
+  UNIQUE(user_id, name)
+);
+
+DROP TABLE IF EXISTS notifications;
+
+CREATE TABLE IF NOT EXISTS notifications (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  message    TEXT NOT NULL,
+  url        TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  read_at    TIMESTAMP
+);
+
+-- ===============================
+-- Drop and recreate jobs table
+-- ===============================
+DROP TABLE IF EXISTS jobs;
+
+CREATE TABLE IF NOT EXISTS jobs (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  type         TEXT NOT NULL,
+  payload      TEXT NOT NULL DEFAULT '{}',
+  status       TEXT NOT NULL CHECK(status IN ('queued', 'running', 'done', 'failed')) DEFAULT 'queued',
+  attempts     INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 5,
+  run_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  locked_until TIMESTAMP,
+  leased_by    TEXT,
+  last_error   TEXT,
+  created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status_run_at
+  ON jobs (status, run_at);
+
+-- ===============================
+-- Drop and recreate search_click_stats_daily table
+-- ===============================
+DROP TABLE IF EXISTS search_click_stats_daily;
+
+CREATE TABLE IF NOT EXISTS search_click_stats_daily (
+  day        TEXT NOT NULL,
+  query      TEXT NOT NULL,
+  language   TEXT NOT NULL DEFAULT 'en',
+  clicks     INTEGER NOT NULL,
+  avg_rank   REAL NOT NULL,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (day, query, language)
+);
+
+-- ===============================
+-- Drop and recreate audit_log table
+-- ===============================
+DROP TABLE IF EXISTS audit_log;
+
+CREATE TABLE IF NOT EXISTS audit_log (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  actor_id    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  action      TEXT NOT NULL,
+  target_type TEXT NOT NULL,
+  target_id   INTEGER,
+  details     TEXT NOT NULL DEFAULT '{}',
+  client_ip   TEXT,
+  created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at
+  ON audit_log (created_at);
+
+-- ===============================
+-- Drop and recreate tags and page_tags tables
+-- ===============================
+DROP TABLE IF EXISTS page_tags;
+DROP TABLE IF EXISTS tags;
+
+CREATE TABLE IF NOT EXISTS tags (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  slug       TEXT NOT NULL UNIQUE,
+  name       TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS page_tags (
+  page_id INTEGER NOT NULL REFERENCES pages(id) ON DELETE CASCADE,
+  tag_id  INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  PRIMARY KEY (page_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_page_tags_tag
+  ON page_tags (tag_id);
+
+-- ===============================
+-- Drop and recreate maintenance_runs table
+-- ===============================
+DROP TABLE IF EXISTS maintenance_runs;
+
+CREATE TABLE IF NOT EXISTS maintenance_runs (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  operation   TEXT NOT NULL,
+  status      TEXT NOT NULL CHECK(status IN ('queued', 'running', 'done', 'failed')) DEFAULT 'queued',
+  done        INTEGER NOT NULL DEFAULT 0,
+  total       INTEGER NOT NULL DEFAULT 0,
+  last_error  TEXT,
+  created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  started_at  TIMESTAMP,
+  finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_runs_status
+  ON maintenance_runs (status);
+
+-- ===============================
+-- Drop and recreate usage statistics tables
+-- ===============================
+DROP TABLE IF EXISTS search_log;
+DROP TABLE IF EXISTS stats_daily;
+DROP TABLE IF EXISTS stats_daily_languages;
+
+CREATE TABLE IF NOT EXISTS search_log (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  day         TEXT NOT NULL,
+  query_hash  TEXT NOT NULL,
+  language    TEXT NOT NULL DEFAULT 'en',
+  results     INTEGER NOT NULL,
+  searched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_log_day
+  ON search_log (day);
+
+CREATE TABLE IF NOT EXISTS stats_daily (
+  day                   TEXT PRIMARY KEY,
+  searches              INTEGER NOT NULL,
+  unique_queries        INTEGER NOT NULL,
+  searches_with_results INTEGER NOT NULL,
+  new_users             INTEGER NOT NULL,
+  updated_at            TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS stats_daily_languages (
+  day      TEXT NOT NULL,
+  language TEXT NOT NULL,
+  searches INTEGER NOT NULL,
+  PRIMARY KEY (day, language)
+);
+
+-- ===============================
+-- Drop and recreate status page incidents
+-- ===============================
+DROP TABLE IF EXISTS incidents;
+
+CREATE TABLE IF NOT EXISTS incidents (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  title       TEXT NOT NULL,
+  message     TEXT NOT NULL DEFAULT '',
+  status      TEXT NOT NULL DEFAULT 'investigating'
+    CHECK (status IN ('investigating', 'identified', 'monitoring', 'resolved')),
+  severity    TEXT NOT NULL DEFAULT 'minor'
+    CHECK (severity IN ('minor', 'major', 'critical')),
+  started_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  resolved_at TIMESTAMP,
+  updated_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_incidents_started_at
+  ON incidents (started_at DESC);
+
+-- ===============================
+-- Drop and recreate daily traffic analytics
+-- ===============================
+DROP TABLE IF EXISTS traffic_daily;
+DROP TABLE IF EXISTS referrers_daily;
+
+CREATE TABLE IF NOT EXISTS traffic_daily (
+  day          TEXT NOT NULL,
+  client_class TEXT NOT NULL,
+  path         TEXT NOT NULL,
+  requests     INTEGER NOT NULL,
+  PRIMARY KEY (day, client_class, path)
+);
+
+CREATE TABLE IF NOT EXISTS referrers_daily (
+  day      TEXT NOT NULL,
+  referrer TEXT NOT NULL,
+  requests INTEGER NOT NULL,
+  PRIMARY KEY (day, referrer)
+);
+
+-- ===============================
+-- Drop and recreate login devices (new device login emails)
+-- ===============================
+DROP TABLE IF EXISTS user_devices;
+
+CREATE TABLE IF NOT EXISTS user_devices (
+  user_id       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  fingerprint   TEXT NOT NULL,
+  user_agent    TEXT NOT NULL DEFAULT '',
+  first_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, fingerprint)
+);
+
+-- ===============================
+-- Drop and recreate remember-me tokens
+-- ===============================
+DROP TABLE IF EXISTS remember_tokens;
+
+CREATE TABLE IF NOT EXISTS remember_tokens (
+  id              INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id         INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  selector        TEXT NOT NULL UNIQUE,
+  validator_hash  TEXT NOT NULL,
+  session_version INTEGER NOT NULL,
+  expires_at      TIMESTAMP NOT NULL,
+  created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_used_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_remember_tokens_user_id
+  ON remember_tokens (user_id);
+
+-- ===============================
+-- Drop and recreate logged-in sessions (session listing and revocation)
+-- ===============================
+DROP TABLE IF EXISTS user_sessions;
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id           INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  session_key       TEXT NOT NULL UNIQUE,
+  session_version   INTEGER NOT NULL,
+  user_agent        TEXT NOT NULL DEFAULT '',
+  ip                TEXT NOT NULL DEFAULT '',
+  remember_selector TEXT,
+  created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id
+  ON user_sessions (user_id);
+
+-- ===============================
+-- Drop and recreate terms of service / privacy policy consents
+-- ===============================
+DROP TABLE IF EXISTS user_consents;
+
+CREATE TABLE IF NOT EXISTS user_consents (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  version     TEXT NOT NULL,
+  source      TEXT NOT NULL,
+  accepted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_consents_user_id
+  ON user_consents (user_id);
+
+-- ===============================
+-- Drop and recreate daily API usage (quotas)
+-- ===============================
+DROP TABLE IF EXISTS api_usage;
+
+CREATE TABLE IF NOT EXISTS api_usage (
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  day     TEXT NOT NULL,
+  calls   INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (user_id, day)
+);
+
+-- ===============================
+-- Drop and recreate data retention runs
+-- ===============================
+DROP TABLE IF EXISTS retention_runs;
+
+CREATE TABLE IF NOT EXISTS retention_runs (
+  id                       INTEGER PRIMARY KEY AUTOINCREMENT,
+  trigger_source           TEXT NOT NULL,
+  status                   TEXT NOT NULL CHECK(status IN ('queued', 'running', 'done', 'failed')) DEFAULT 'queued',
+  search_log_deleted       INTEGER NOT NULL DEFAULT 0,
+  external_results_deleted INTEGER NOT NULL DEFAULT 0,
+  last_error               TEXT,
+  created_at               TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  started_at               TIMESTAMP,
+  finished_at              TIMESTAMP
 );
 
-CREATE INDEX IF NOT EXISTS idx_external_query_lang
-  ON external_results (query, language);
+CREATE INDEX IF NOT EXISTS idx_retention_runs_status
+  ON retention_runs (status);
@@ -0,0 +1,155 @@
+// Package dbpool watches a database/sql connection pool.
+//
+// A Monitor samples the pool's stats every interval: it exports how long connection requests
+// waited (app_db_pool_wait_seconds), warns once the pool has been saturated (every
+// connection in use and requests waiting) for longer than SaturationWarn, and with
+// autotuning on grows MaxOpenConns while requests wait longer than TargetWait, shrinking it
+// back to the configured size once they no longer wait. Without it, a pool that is too
+// small only shows up as latency nobody can explain.
+package dbpool
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+)
+
+// DefaultInterval is how often the pool is sampled when Options.Interval is zero.
+const DefaultInterval = time.Second
+
+// shrinkAfter is how many samples in a row without waits it takes to give back one
+// autotuned connection.
+const shrinkAfter = 60
+
+// Options configures a Monitor.
+type Options struct {
+	Pool           string        // label for logs and metrics (e.g. "primary", "replica")
+	MaxOpenConns   int           // the configured pool size; autotuning never goes below it
+	AutotuneMax    int           // upper bound for autotuning; <= MaxOpenConns disables it
+	TargetWait     time.Duration // autotuning grows the pool while the average wait exceeds this
+	SaturationWarn time.Duration // warn after this long saturated; 0 disables the warning
+	Interval       time.Duration // how often the pool is sampled (default DefaultInterval)
+}
+
+// Monitor samples one pool.
+type Monitor struct {
+	db   *sql.DB
+	opts Options
+
+	mu             sync.Mutex
+	last           sql.DBStats
+	size           int       // current MaxOpenConns
+	saturatedSince time.Time // zero while not saturated
+	warned         bool      // the current saturation has been reported
+	quiet          int       // samples in a row without waits
+}
+
+// New creates a monitor for db. It does not change the pool until Check or Run is called.
+func New(db *sql.DB, opts Options) *Monitor {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	return &Monitor{db: db, opts: opts, last: db.Stats(), size: opts.MaxOpenConns}
+}
+
+// Autotuning reports whether the monitor adjusts MaxOpenConns.
+func (m *Monitor) Autotuning() bool {
+	return m.opts.MaxOpenConns > 0 && m.opts.AutotuneMax > m.opts.MaxOpenConns
+}
+
+// Size is the pool's current MaxOpenConns as set by the monitor.
+func (m *Monitor) Size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.size
+}
+
+// Run samples the pool every interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.Check(now)
+		}
+	}
+}
+
+// Check takes one sample at now: it updates the metrics, the saturation state and, with
+// autotuning on, the pool size. Run calls it; tests call it directly.
+func (m *Monitor) Check(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.db.Stats()
+	waits := stats.WaitCount - m.last.WaitCount
+	waited := stats.WaitDuration - m.last.WaitDuration
+	m.last = stats
+
+	// WaitCount goes up when a request starts waiting, WaitDuration when it gets a connection,
+	// so a wait spanning two samples is counted in the first and timed in the second.
+	avgWait := waited / time.Duration(max(waits, 1))
+	metrics.DBPoolWait.WithLabelValues(m.opts.Pool).Set(avgWait.Seconds())
+
+	m.checkSaturation(now, stats, waits > 0)
+	if m.Autotuning() {
+		m.autotune(waits, avgWait)
+	}
+}
+
+// checkSaturation tracks how long every connection has been in use with requests waiting
+// and warns (once per episode) when that lasts longer than SaturationWarn.
+func (m *Monitor) checkSaturation(now time.Time, stats sql.DBStats, waited bool) {
+	saturated := stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections && waited
+	if !saturated {
+		if m.warned {
+			log.Printf("db pool %s: no longer saturated after %s", m.opts.Pool, now.Sub(m.saturatedSince).Round(time.Second))
+		}
+		m.saturatedSince, m.warned = time.Time{}, false
+		metrics.DBPoolSaturated.WithLabelValues(m.opts.Pool).Set(0)
+		return
+	}
+	if m.saturatedSince.IsZero() {
+		m.saturatedSince = now
+	}
+	took := now.Sub(m.saturatedSince)
+	metrics.DBPoolSaturated.WithLabelValues(m.opts.Pool).Set(took.Seconds())
+	if m.opts.SaturationWarn > 0 && took >= m.opts.SaturationWarn && !m.warned {
+		m.warned = true
+		metrics.DBPoolSaturationWarnings.WithLabelValues(m.opts.Pool).Inc()
+		log.Printf("WARNING db pool %s: saturated for %s (%d/%d connections in use, %d requests waited %s in total); raise DB_MAX_OPEN_CONNS or enable DB_POOL_AUTOTUNE_MAX",
+			m.opts.Pool, took.Round(time.Second), stats.InUse, stats.MaxOpenConnections, stats.WaitCount, stats.WaitDuration.Round(time.Millisecond))
+	}
+}
+
+// autotune grows the pool by a quarter (at least one connection) when requests waited
+// longer than TargetWait on average, and gives back one connection after shrinkAfter quiet
+// samples.
+func (m *Monitor) autotune(waits int64, avgWait time.Duration) {
+	if waits > 0 || avgWait > 0 {
+		m.quiet = 0
+		if avgWait > m.opts.TargetWait && m.size < m.opts.AutotuneMax {
+			m.resize(min(m.size+max(m.size/4, 1), m.opts.AutotuneMax), "grow", avgWait)
+		}
+		return
+	}
+	m.quiet++
+	if m.quiet >= shrinkAfter && m.size > m.opts.MaxOpenConns {
+		m.quiet = 0
+		m.resize(m.size-1, "shrink", 0)
+	}
+}
+
+func (m *Monitor) resize(size int, direction string, avgWait time.Duration) {
+	log.Printf("db pool %s: MaxOpenConns %d -> %d (average wait %s)", m.opts.Pool, m.size, size, avgWait.Round(time.Microsecond))
+	m.size = size
+	m.db.SetMaxOpenConns(size)
+	metrics.DBPoolResizes.WithLabelValues(m.opts.Pool, direction).Inc()
+}
@@ -0,0 +1,29 @@
+// Package dialect names the SQL databases the app runs on: PostgreSQL in production and
+// SQLite for the single-binary demo (DB_DRIVER=sqlite) and the tests. Most queries are
+// written to run on both; the few that cannot (full-text search, statement timeouts,
+// advisory locks) branch on the Dialect.
+package dialect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect is a database flavour.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// Parse reads DB_DRIVER ("" means postgres).
+func Parse(s string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "postgres", "postgresql", "pgx":
+		return Postgres, nil
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	}
+	return "", fmt.Errorf("dialect: unknown DB_DRIVER %q (want postgres or sqlite)", s)
+}
@@ -0,0 +1,60 @@
+package dialect
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"devops-valgfag/internal/textnorm"
+
+	"modernc.org/sqlite"
+)
+
+// The SQLite driver gets the SQL functions PostgreSQL has from migrations, so the same
+// queries run on both. Registration applies to every SQLite connection opened afterwards.
+func init() {
+	// f_unaccent(text): see migrations/0021_unaccent.sql. Fold also lowercases, which is
+	// harmless since queries compare f_unaccent(LOWER(...)) values.
+	sqlite.MustRegisterDeterministicScalarFunction("f_unaccent", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		switch v := args[0].(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return textnorm.Fold(v), nil
+		case []byte:
+			return textnorm.Fold(string(v)), nil
+		default:
+			return v, nil
+		}
+	})
+	// f_strip_tags(text): see migrations/0023_external_results_search.sql.
+	sqlite.MustRegisterDeterministicScalarFunction("f_strip_tags", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		switch v := args[0].(type) {
+		case string:
+			return htmlTag.ReplaceAllString(v, ""), nil
+		case []byte:
+			return htmlTag.ReplaceAllString(string(v), ""), nil
+		default:
+			return v, nil
+		}
+	})
+}
+
+// htmlTag matches what f_strip_tags removes on PostgreSQL.
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// OpenSQLite opens (creating if needed) the SQLite database file at path, with foreign keys
+// enforced, WAL journaling so readers do not block the writer, and a busy timeout so
+// concurrent writers wait instead of failing.
+func OpenSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("dialect: empty SQLite path")
+	}
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	return sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+}
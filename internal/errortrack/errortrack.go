@@ -0,0 +1,332 @@
+// Package errortrack reports errors and panics to Sentry or a compatible service (GlitchTip,
+// self-hosted Sentry) through the envelope HTTP API.
+//
+// The package-wide Tracker is a no-op until Init is called with a DSN (SENTRY_DSN), so callers
+// can report unconditionally. Events are sent in the background by one worker; when the
+// queue is full they are dropped rather than slowing requests down.
+package errortrack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/httpclient"
+	"devops-valgfag/internal/logscrub"
+	"devops-valgfag/internal/metrics"
+)
+
+const (
+	queueSize   = 100
+	sendTimeout = 5 * time.Second
+	clientName  = "devops-valgfag-errortrack/1.0"
+)
+
+// Levels understood by Sentry.
+const (
+	LevelError = "error"
+	LevelFatal = "fatal"
+)
+
+// Options configures a Sentry tracker.
+type Options struct {
+	DSN         string // https://<key>@<host>/<project>; empty = no-op tracker
+	Release     string // e.g. the git SHA; defaults to the VCS revision in the build info
+	Environment string // APP_ENV
+}
+
+// Event is one error report.
+type Event struct {
+	Err       error
+	Message   string // used when Err is nil (e.g. a recovered panic value)
+	Level     string // LevelError (default) or LevelFatal
+	Stack     []byte // optional goroutine stack (runtime/debug.Stack)
+	Request   *http.Request
+	RequestID string
+	Tags      map[string]string // e.g. kind=migration, service=dmi
+}
+
+// Tracker reports events to an error tracking service.
+type Tracker interface {
+	Capture(ev Event)
+	// Flush waits up to timeout for queued events to be sent and reports whether all were.
+	Flush(timeout time.Duration) bool
+}
+
+// Nop discards every event.
+type Nop struct{}
+
+// Capture implements Tracker.
+func (Nop) Capture(Event) {}
+
+// Flush implements Tracker.
+func (Nop) Flush(time.Duration) bool { return true }
+
+type holder struct{ Tracker }
+
+var current atomic.Value // holder
+
+// Init configures the package-wide tracker from opts. With an empty DSN it stays a no-op.
+func Init(opts Options) error {
+	t, err := New(opts)
+	if err != nil {
+		return err
+	}
+	SetDefault(t)
+	return nil
+}
+
+// SetDefault replaces the package-wide tracker (nil restores the no-op one).
+func SetDefault(t Tracker) {
+	if t == nil {
+		t = Nop{}
+	}
+	current.Store(holder{t})
+}
+
+// Default returns the package-wide tracker.
+func Default() Tracker {
+	if h, ok := current.Load().(holder); ok {
+		return h.Tracker
+	}
+	return Nop{}
+}
+
+// Capture reports ev with the package-wide tracker.
+func Capture(ev Event) {
+	Default().Capture(ev)
+}
+
+// CaptureError reports a background error (no request) with the given tags.
+func CaptureError(err error, tags map[string]string) {
+	if err == nil {
+		return
+	}
+	Capture(Event{Err: err, Tags: tags})
+}
+
+// Flush waits for the package-wide tracker's queued events (e.g. before exiting).
+func Flush(timeout time.Duration) bool {
+	return Default().Flush(timeout)
+}
+
+// New creates a tracker for opts.DSN, or a Nop when it is empty.
+func New(opts Options) (Tracker, error) {
+	if strings.TrimSpace(opts.DSN) == "" {
+		return Nop{}, nil
+	}
+	endpoint, key, err := parseDSN(opts.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Release == "" {
+		opts.Release = buildRevision()
+	}
+	host, _ := os.Hostname()
+
+	s := &sentry{
+		opts:       opts,
+		endpoint:   endpoint,
+		auth:       fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", clientName, key),
+		serverName: host,
+		client:     httpclient.New("sentry", sendTimeout),
+		queue:      make(chan []byte, queueSize),
+	}
+	go s.run()
+	return s, nil
+}
+
+// parseDSN turns a DSN into the envelope endpoint and public key.
+func parseDSN(dsn string) (endpoint, key string, err error) {
+	u, err := url.Parse(strings.TrimSpace(dsn))
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", "", errors.New("errortrack: invalid DSN")
+	}
+	key = u.User.Username()
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	project := path[i+1:]
+	if key == "" || project == "" {
+		return "", "", errors.New("errortrack: DSN needs a public key and a project ID")
+	}
+	return fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:i], project), key, nil
+}
+
+func buildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// sentry sends events to the envelope endpoint from a single background worker.
+type sentry struct {
+	opts       Options
+	endpoint   string
+	auth       string
+	serverName string
+	client     *http.Client
+
+	queue   chan []byte
+	pending sync.WaitGroup
+}
+
+// Capture implements Tracker. The event is serialized right away (the request may be gone
+// by the time it is sent) and queued; a full queue drops it.
+func (s *sentry) Capture(ev Event) {
+	body, err := s.envelope(ev)
+	if err != nil {
+		log.Printf("errortrack: cannot encode event: %v", err)
+		return
+	}
+	s.pending.Add(1)
+	select {
+	case s.queue <- body:
+	default:
+		s.pending.Done()
+		metrics.ErrorReports.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Flush implements Tracker.
+func (s *sentry) Flush(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (s *sentry) run() {
+	for body := range s.queue {
+		result := "sent"
+		if err := s.send(body); err != nil {
+			log.Printf("errortrack: send failed: %v", err)
+			result = "failed"
+		}
+		metrics.ErrorReports.WithLabelValues(result).Inc()
+		s.pending.Done()
+	}
+}
+
+func (s *sentry) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// envelope builds the request body: envelope header, item header, event payload.
+func (s *sentry) envelope(ev Event) ([]byte, error) {
+	id := eventID()
+	payload, err := json.Marshal(s.event(id, ev))
+	if err != nil {
+		return nil, err
+	}
+	header, _ := json.Marshal(map[string]string{"event_id": id, "sent_at": time.Now().UTC().Format(time.RFC3339)})
+	item, _ := json.Marshal(map[string]any{"type": "event", "length": len(payload)})
+
+	var b bytes.Buffer
+	b.Write(header)
+	b.WriteByte('\n')
+	b.Write(item)
+	b.WriteByte('\n')
+	b.Write(payload)
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// event maps ev to a Sentry event payload. Only non-sensitive request data is included:
+// method, path and user agent (no query string, cookies or other headers).
+func (s *sentry) event(id string, ev Event) map[string]any {
+	level := ev.Level
+	if level == "" {
+		level = LevelError
+	}
+	tags := map[string]string{}
+	for k, v := range ev.Tags {
+		tags[k] = v
+	}
+	if ev.RequestID != "" {
+		tags["request_id"] = ev.RequestID
+	}
+
+	excType, value := "message", ev.Message
+	if ev.Err != nil {
+		excType, value = fmt.Sprintf("%T", ev.Err), ev.Err.Error()
+		if ev.Message != "" {
+			value = ev.Message + ": " + value
+		}
+	}
+
+	out := map[string]any{
+		"event_id":    id,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       level,
+		"server_name": s.serverName,
+		"exception": map[string]any{
+			"values": []map[string]string{{"type": excType, "value": logscrub.String(value)}},
+		},
+		"tags": tags,
+	}
+	if s.opts.Release != "" {
+		out["release"] = s.opts.Release
+	}
+	if s.opts.Environment != "" {
+		out["environment"] = s.opts.Environment
+	}
+	if len(ev.Stack) > 0 {
+		out["extra"] = map[string]string{"stack": string(ev.Stack)}
+	}
+	if r := ev.Request; r != nil {
+		out["transaction"] = r.Method + " " + r.URL.Path
+		out["request"] = map[string]any{
+			"method":  r.Method,
+			"url":     r.URL.Path,
+			"headers": map[string]string{"User-Agent": r.UserAgent()},
+		}
+	}
+	return out
+}
+
+func eventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
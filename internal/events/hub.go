@@ -0,0 +1,97 @@
+// Package events is a small in-process broadcast hub for Server-Sent Events.
+//
+// Publishers (handlers, background jobs) call Publish; every connected SSE
+// client gets the event. A short history is kept so reconnecting clients can
+// resume from their Last-Event-ID without missing announcements.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is one message pushed to clients.
+type Event struct {
+	ID   int64     `json:"id"`
+	Type string    `json:"type"` // e.g. announcement, external_search, weather
+	Data string    `json:"data"` // human-readable message
+	Time time.Time `json:"time"`
+}
+
+// Hub fans out events to subscribers.
+type Hub struct {
+	mu      sync.Mutex
+	nextID  int64
+	history []Event
+	maxHist int
+	subs    map[chan Event]struct{}
+}
+
+// subscriberBuffer is how many events a slow client may lag behind before events are dropped for it.
+const subscriberBuffer = 16
+
+// NewHub creates a hub that remembers the last historySize events for replay.
+func NewHub(historySize int) *Hub {
+	return &Hub{
+		maxHist: historySize,
+		subs:    make(map[chan Event]struct{}),
+	}
+}
+
+// Publish assigns an ID to the event and delivers it to all subscribers.
+// Delivery never blocks: a subscriber with a full buffer misses the event.
+func (h *Hub) Publish(eventType, data string) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	ev := Event{ID: h.nextID, Type: eventType, Data: data, Time: time.Now().UTC()}
+
+	h.history = append(h.history, ev)
+	if len(h.history) > h.maxHist {
+		h.history = h.history[len(h.history)-h.maxHist:]
+	}
+
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	return ev
+}
+
+// Subscribe registers a new subscriber and returns its channel plus any
+// buffered events newer than lastID (0 = no replay).
+// Call Unsubscribe when the client goes away.
+func (h *Hub) Subscribe(lastID int64) (chan Event, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	h.subs[ch] = struct{}{}
+
+	var missed []Event
+	if lastID > 0 {
+		for _, ev := range h.history {
+			if ev.ID > lastID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+	return ch, missed
+}
+
+// Unsubscribe removes a subscriber.
+func (h *Hub) Unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+}
+
+// Subscribers returns the number of connected subscribers.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
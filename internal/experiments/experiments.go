@@ -0,0 +1,195 @@
+// Package experiments runs A/B tests: it deterministically assigns a unit (a visitor ID) to one
+// variant per experiment, by weight, and carries the assignment through request contexts so
+// code paths can branch on it and tag metrics and events with it.
+//
+// The same unit always lands in the same variant of an experiment, on every replica, as long
+// as the experiment's variants and weights are unchanged. Different experiments are hashed
+// independently, so their assignments do not correlate.
+package experiments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Variant is one arm of an experiment. Weight is its relative share of units.
+type Variant struct {
+	Name   string `json:"name" example:"interleave"`
+	Weight int    `json:"weight" example:"50"`
+}
+
+// Experiment is a named test with at least two variants.
+type Experiment struct {
+	Name     string    `json:"name" example:"search_merge"`
+	Variants []Variant `json:"variants"`
+}
+
+// Validate checks names and weights.
+func (e Experiment) Validate() error {
+	if !validName(e.Name) {
+		return fmt.Errorf("experiments: invalid experiment name %q", e.Name)
+	}
+	if len(e.Variants) < 2 {
+		return fmt.Errorf("experiments: %s needs at least two variants", e.Name)
+	}
+	seen := map[string]bool{}
+	total := 0
+	for _, v := range e.Variants {
+		switch {
+		case !validName(v.Name):
+			return fmt.Errorf("experiments: %s: invalid variant name %q", e.Name, v.Name)
+		case seen[v.Name]:
+			return fmt.Errorf("experiments: %s: duplicate variant %q", e.Name, v.Name)
+		case v.Weight < 0:
+			return fmt.Errorf("experiments: %s: negative weight for %q", e.Name, v.Name)
+		}
+		seen[v.Name] = true
+		total += v.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("experiments: %s: weights add up to zero", e.Name)
+	}
+	return nil
+}
+
+// Assign returns the variant of unit. It hashes the experiment name with the unit, so the
+// result is stable and independent of other experiments.
+func (e Experiment) Assign(unit string) string {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(e.Name + "\x00" + unit))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, v := range e.Variants {
+		if bucket < v.Weight {
+			return v.Name
+		}
+		bucket -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1].Name
+}
+
+// Parse reads experiments from a spec such as
+//
+//	search_merge=append:50,interleave:50;search_ranking=v1:90,v2:10
+//
+// Experiments are separated by ";", variants by ","; a variant without ":weight" has weight 1.
+func Parse(spec string) ([]Experiment, error) {
+	var out []Experiment
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, variants, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("experiments: %q: want name=variant:weight,...", part)
+		}
+		e := Experiment{Name: strings.TrimSpace(name)}
+		for _, v := range strings.Split(variants, ",") {
+			vname, weight, hasWeight := strings.Cut(strings.TrimSpace(v), ":")
+			w := 1
+			if hasWeight {
+				n, err := strconv.Atoi(strings.TrimSpace(weight))
+				if err != nil {
+					return nil, fmt.Errorf("experiments: %s: invalid weight %q", e.Name, weight)
+				}
+				w = n
+			}
+			e.Variants = append(e.Variants, Variant{Name: strings.TrimSpace(vname), Weight: w})
+		}
+		if err := e.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("experiments: %s defined twice", e.Name)
+		}
+		seen[e.Name] = true
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Assignment maps experiment names to the variants a unit is in.
+type Assignment map[string]string
+
+// AssignAll assigns unit in every experiment.
+func AssignAll(exps []Experiment, unit string) Assignment {
+	a := make(Assignment, len(exps))
+	for _, e := range exps {
+		a[e.Name] = e.Assign(unit)
+	}
+	return a
+}
+
+// String renders the assignment as "name=variant" pairs sorted by name and joined by ",",
+// e.g. for cache keys and stored events. The empty assignment renders as "".
+func (a Assignment) String() string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + a[name]
+	}
+	return strings.Join(names, ",")
+}
+
+type ctxKey struct{}
+
+// WithAssignment returns a context carrying a.
+func WithAssignment(ctx context.Context, a Assignment) context.Context {
+	return context.WithValue(ctx, ctxKey{}, a)
+}
+
+// FromContext returns the assignment in ctx (nil if there is none).
+func FromContext(ctx context.Context) Assignment {
+	a, _ := ctx.Value(ctxKey{}).(Assignment)
+	return a
+}
+
+// VariantOf returns the variant of experiment in ctx, or "" when the request is not in it.
+func VariantOf(ctx context.Context, experiment string) string {
+	return FromContext(ctx)[experiment]
+}
+
+// ErrUnknownVariant is returned by CheckVariants for variants the code does not implement.
+var ErrUnknownVariant = errors.New("experiments: unknown variant")
+
+// CheckVariants verifies that e only uses variants from allowed.
+func CheckVariants(e Experiment, allowed ...string) error {
+	for _, v := range e.Variants {
+		ok := false
+		for _, a := range allowed {
+			ok = ok || v.Name == a
+		}
+		if !ok {
+			return fmt.Errorf("%w %q in %s (want one of %s)", ErrUnknownVariant, v.Name, e.Name, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+func validName(s string) bool {
+	if s == "" || len(s) > 64 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,240 @@
+// Package httpclient builds the HTTP clients for every outbound call of the app (Wikipedia,
+// DMI, CAPTCHA verification, error reports, S3), so they share one egress policy:
+//
+//   - one connection pool (MaxConnsPerHost) behind HTTP_PROXY / HTTPS_PROXY / NO_PROXY,
+//   - a host allowlist: requests (and redirects) to other hosts fail with ErrHostNotAllowed,
+//   - a per-host request rate, which callers wait for,
+//   - a User-Agent for requests that do not set their own.
+//
+// The allowlist is what keeps a URL that ends up in an outbound request, e.g. from user
+// input, from reaching internal services (SSRF); clients for such URLs (NewUntrusted) also
+// refuse private addresses whatever the allowlist (see urlcheck). Requests are counted in
+// app_egress_requests_total{client,result}.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/urlcheck"
+)
+
+// DefaultUserAgent identifies the app to the services it calls.
+const DefaultUserAgent = "WhoKnowsBot/1.0 (+https://github.com/GitDenGas123456/DevOps-Valgfag)"
+
+// ErrHostNotAllowed is returned for requests to hosts outside Policy.AllowHosts.
+var ErrHostNotAllowed = errors.New("httpclient: host not allowed by the egress policy")
+
+// Policy is the egress policy shared by all clients. The zero value allows every host
+// without a rate limit, with the default User-Agent and pool size.
+type Policy struct {
+	// AllowHosts are the hosts requests may go to: "api.example.com" matches that host,
+	// ".example.com" (or "*.example.com") it and its subdomains. Empty allows any host.
+	AllowHosts []string
+	// HostRate is how many requests per second may start per host (bursts up to the same
+	// number); 0 is unlimited.
+	HostRate int
+	// MaxConnsPerHost bounds the connections per host (default 10).
+	MaxConnsPerHost int
+	// UserAgent is sent when a request has none (default DefaultUserAgent).
+	UserAgent string
+}
+
+// ParseHosts parses a comma-separated allowlist (EGRESS_ALLOW_HOSTS).
+func ParseHosts(s string) ([]string, error) {
+	var hosts []string
+	for _, h := range strings.Split(s, ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h == "" {
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(h, "*"), ".")
+		if name == "" || strings.ContainsAny(name, "/:*@ ") {
+			return nil, fmt.Errorf("EGRESS_ALLOW_HOSTS: invalid host %q", h)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// egress is the policy in effect with its transports and rate limiter.
+type egress struct {
+	policy    Policy
+	transport *http.Transport
+	untrusted *http.Transport // for NewUntrusted: direct, public addresses only
+	limiter   *hostLimiter
+}
+
+var current atomic.Pointer[egress]
+
+func init() {
+	SetPolicy(Policy{})
+}
+
+// SetPolicy replaces the egress policy of all clients, including those already created.
+// It is meant for startup: requests in flight keep the previous connection pool.
+func SetPolicy(p Policy) {
+	if p.MaxConnsPerHost <= 0 {
+		p.MaxConnsPerHost = 10
+	}
+	if p.UserAgent == "" {
+		p.UserAgent = DefaultUserAgent
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	t.MaxConnsPerHost = p.MaxConnsPerHost
+	t.MaxIdleConnsPerHost = p.MaxConnsPerHost
+	// A proxy would hide the address connected to from urlcheck.Control.
+	u := t.Clone()
+	u.Proxy = nil
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: urlcheck.Control}
+	u.DialContext = dialer.DialContext
+	e := &egress{policy: p, transport: t, untrusted: u}
+	if p.HostRate > 0 {
+		e.limiter = newHostLimiter(p.HostRate)
+	}
+	if prev := current.Swap(e); prev != nil {
+		prev.transport.CloseIdleConnections()
+		prev.untrusted.CloseIdleConnections()
+	}
+}
+
+// New returns a client for the outbound calls of name (the metrics label, e.g. "wikipedia")
+// with the given overall timeout per request (0 = none).
+func New(name string, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: &transport{name: name}}
+}
+
+// NewUntrusted is New for URLs that come from outside (the Wikipedia article fetches of
+// promoted external results, whose wiki host comes from the result URL): on top of the
+// egress policy, each request URL (redirects included) must pass urlcheck.Check, and
+// connections go directly, never via the proxy, to public addresses only (urlcheck.Control),
+// so a name that re-resolves to an internal address is refused too.
+func NewUntrusted(name string, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: &transport{name: name, untrusted: true}}
+}
+
+// transport applies the current policy to each request, redirects included.
+type transport struct {
+	name      string
+	untrusted bool
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := current.Load()
+	host := strings.ToLower(req.URL.Hostname())
+	if !e.policy.allows(host) {
+		closeBody(req)
+		metrics.EgressRequests.WithLabelValues(t.name, "blocked").Inc()
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	rt := e.transport
+	if t.untrusted {
+		if _, err := urlcheck.Check(req.Context(), req.URL.String()); err != nil {
+			closeBody(req)
+			metrics.EgressRequests.WithLabelValues(t.name, "blocked").Inc()
+			return nil, err
+		}
+		rt = e.untrusted
+	}
+	if e.limiter != nil {
+		if err := e.limiter.wait(req.Context(), host); err != nil {
+			closeBody(req)
+			metrics.EgressRequests.WithLabelValues(t.name, "error").Inc()
+			return nil, err
+		}
+	}
+	if req.Header.Get("User-Agent") == "" {
+		// A RoundTripper must not modify the caller's request.
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", e.policy.UserAgent)
+	}
+	resp, err := rt.RoundTrip(req)
+	result := "ok"
+	if errors.Is(err, urlcheck.ErrPrivateAddress) {
+		result = "blocked"
+	} else if err != nil {
+		result = "error"
+	}
+	metrics.EgressRequests.WithLabelValues(t.name, result).Inc()
+	return resp, err
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+func (p Policy) allows(host string) bool {
+	if len(p.AllowHosts) == 0 {
+		return true
+	}
+	for _, h := range p.AllowHosts {
+		if suffix, ok := strings.CutPrefix(strings.TrimPrefix(h, "*"), "."); ok {
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// hostLimiter is a token bucket per host: rate tokens per second, at most rate stored.
+type hostLimiter struct {
+	rate float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newHostLimiter(rate int) *hostLimiter {
+	return &hostLimiter{rate: float64(rate), buckets: map[string]*bucket{}}
+}
+
+// wait takes a token for host, waiting for one if necessary, unless ctx ends first.
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &bucket{tokens: l.rate, last: now}
+		l.buckets[host] = b
+	}
+	b.tokens = min(l.rate, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	// Taking the token up front (possibly going negative) reserves the caller's turn.
+	b.tokens--
+	delay := time.Duration(-b.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		b.tokens++ // give the reserved turn back
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,193 @@
+package i18n
+
+// da is the Danish UI catalog, keyed by the English source text.
+var da = map[string]string{
+	// Navigation / layout
+	"Home":     "Forside",
+	"Search":   "Søg",
+	"Weather":  "Vejr",
+	"About":    "Om",
+	"Login":    "Log ind",
+	"Logout":   "Log ud",
+	"Sign Up":  "Opret konto",
+	"Sign In":  "Log ind",
+	"Language": "Sprog",
+
+	"Toggle dark mode": "Skift mørk tilstand",
+
+	// Search
+	"Search the web":   "Søg på nettet",
+	"Search anything.": "Søg efter hvad som helst.",
+	"No results":       "Ingen resultater",
+	"Helpful":          "Nyttig",
+	"Not helpful":      "Ikke nyttig",
+
+	// Degraded mode (database down)
+	"Search is temporarily unavailable. Please try again in a moment.":     "Søgningen er midlertidigt utilgængelig. Prøv igen om lidt.",
+	"Search is running in limited mode; these results may be out of date.": "Søgningen kører i begrænset tilstand; resultaterne er måske ikke opdaterede.",
+
+	// Saved searches
+	"Save search":      "Gem søgning",
+	"Name this search": "Navngiv søgningen",
+	"Saved":            "Gemt",
+
+	// Bookmarks
+	"Bookmark":          "Bogmærk",
+	"Bookmarks":         "Bogmærker",
+	"No bookmarks yet.": "Ingen bogmærker endnu.",
+	"Remove":            "Fjern",
+
+	// Login / register
+	"Log In":            "Log ind",
+	"Error:":            "Fejl:",
+	"Username":          "Brugernavn",
+	"Password":          "Adgangskode",
+	"E-Mail":            "E-mail",
+	"Password (repeat)": "Adgangskode (gentag)",
+	"Create account":    "Opret konto",
+	"Remember me":       "Husk mig",
+
+	// Auth errors (rendered from handlers)
+	"Bad request":                      "Ugyldig forespørgsel",
+	"Invalid username or password":     "Forkert brugernavn eller adgangskode",
+	"Internal server error":            "Intern serverfejl",
+	"All fields required":              "Alle felter skal udfyldes",
+	"Passwords do not match":           "Adgangskoderne er ikke ens",
+	"Database error":                   "Databasefejl",
+	"Username already in use":          "Brugernavnet er allerede i brug",
+	"Internal error, please try again": "Intern fejl, prøv igen",
+	"Registration failed":              "Registrering mislykkedes",
+
+	// Registration bot checks
+	"The form has expired, please try again":         "Formularen er udløbet, prøv igen",
+	"Please take a moment and submit the form again": "Vent et øjeblik, og send formularen igen",
+	"Please confirm that you are not a robot":        "Bekræft venligst, at du ikke er en robot",
+
+	// Account status and password reset
+	"This account has been disabled":                                  "Denne konto er deaktiveret",
+	"This account has been banned":                                    "Denne konto er udelukket",
+	"Your account is awaiting approval":                               "Din konto afventer godkendelse",
+	"Password reset required. Use the link in the email we sent you.": "Du skal nulstille din adgangskode. Brug linket i den e-mail, vi har sendt dig.",
+	"This reset link is invalid or has expired":                       "Linket til nulstilling er ugyldigt eller udløbet",
+	"Reset password":   "Nulstil adgangskode",
+	"New password":     "Ny adgangskode",
+	"Set new password": "Gem ny adgangskode",
+
+	// Article view
+	"Read full page": "Læs hele siden",
+	"Last updated":   "Senest opdateret",
+	"Related pages":  "Relaterede sider",
+
+	// Tags
+	"Browse by tag": "Gennemse efter emne",
+	"Tagged":        "Emne:",
+	"Clear tag":     "Fjern emne",
+
+	// Profile
+	"Joined":               "Medlem siden",
+	"Change avatar":        "Skift profilbillede",
+	"Upload":               "Upload",
+	"Public bookmarks":     "Offentlige bogmærker",
+	"No public bookmarks.": "Ingen offentlige bogmærker.",
+	"Show on my profile":   "Vis på min profil",
+
+	// About
+	"Our mission": "Vores mission",
+	"We intend to build the world's best search engine!": "Vi vil bygge verdens bedste søgemaskine!",
+	"Quick links (Demo)":          "Genveje (demo)",
+	"Swagger API docs":            "Swagger API-dokumentation",
+	"Explore endpoints & schemas": "Udforsk endpoints og skemaer",
+	"Metrics":                     "Metrikker",
+	"Prometheus scrape output":    "Prometheus scrape-output",
+	"Grafana":                     "Grafana",
+	"Dashboards":                  "Dashboards",
+	"Our team":                    "Vores team",
+
+	// Statistics
+	"Statistics": "Statistik",
+	"Anonymous usage over the last 30 days, updated every hour.": "Anonym brug over de seneste 30 dage, opdateret hver time.",
+	"Statistics are unavailable right now.":                      "Statistikken er ikke tilgængelig lige nu.",
+	"searches":                                                   "søgninger",
+	"with results":                                               "med resultater",
+	"new users":                                                  "nye brugere",
+	"Searches per day":                                           "Søgninger pr. dag",
+	"Searches with results":                                      "Søgninger med resultater",
+	"New registrations":                                          "Nye tilmeldinger",
+	"Top languages":                                              "Mest brugte sprog",
+	"No statistics yet.":                                         "Ingen statistik endnu.",
+
+	// Status page
+	"Status":                            "Status",
+	"All systems operational":           "Alle systemer kører normalt",
+	"Some systems are degraded":         "Nogle systemer kører med nedsat funktion",
+	"Major outage":                      "Større nedbrud",
+	"Last checked":                      "Senest tjekket",
+	"Active incidents":                  "Aktuelle hændelser",
+	"Components":                        "Komponenter",
+	"Past incidents":                    "Tidligere hændelser",
+	"No incidents in the last 30 days.": "Ingen hændelser de seneste 30 dage.",
+	"operational":                       "kører",
+	"degraded":                          "nedsat funktion",
+	"down":                              "nede",
+	"investigating":                     "undersøges",
+	"identified":                        "årsag fundet",
+	"monitoring":                        "overvåges",
+	"resolved":                          "løst",
+	"Database":                          "Database",
+	"Read replica":                      "Læsereplika",
+	"Cache and sessions (Redis)":        "Cache og sessioner (Redis)",
+	"External search (Wikipedia)":       "Ekstern søgning (Wikipedia)",
+	"Weather (DMI)":                     "Vejr (DMI)",
+	"Not reachable":                     "Kan ikke nås",
+	"Failing requests":                  "Forespørgsler fejler",
+
+	// Error page
+	"Something went wrong":                                           "Noget gik galt",
+	"The page could not be shown. Please try again later.":           "Siden kunne ikke vises. Prøv igen senere.",
+	"Page not found":                                                 "Siden blev ikke fundet",
+	"The page you are looking for does not exist or has been moved.": "Siden, du leder efter, findes ikke eller er blevet flyttet.",
+	"Method not allowed":                                             "Metoden er ikke tilladt",
+	"This page cannot be requested this way.":                        "Siden kan ikke hentes på denne måde.",
+	"Request ID:":                                                    "Forespørgsels-ID:",
+
+	// Account settings
+	"Settings":                            "Indstillinger",
+	"Change password":                     "Skift adgangskode",
+	"Change email":                        "Skift e-mail",
+	"Current password":                    "Nuværende adgangskode",
+	"New email":                           "Ny e-mail",
+	"Waiting for confirmation of":         "Afventer bekræftelse af",
+	"Your email address has been changed": "Din e-mailadresse er blevet ændret",
+	"This confirmation link is invalid or has expired": "Bekræftelseslinket er ugyldigt eller udløbet",
+	"Could not change the email address":               "E-mailadressen kunne ikke ændres",
+
+	// Sessions (settings)
+	"Signed-in devices": "Enheder, der er logget ind",
+	"This device":       "Denne enhed",
+	"Sign out":          "Log ud",
+	"Last seen":         "Sidst set",
+	"Sign out devices you do not recognize or no longer use.": "Log enheder ud, som du ikke genkender eller ikke længere bruger.",
+
+	// Terms of service
+	"Terms of service":    "Servicevilkår",
+	"terms of service":    "servicevilkårene",
+	"privacy policy":      "privatlivspolitikken",
+	"I accept the":        "Jeg accepterer",
+	"and the":             "og",
+	"Version":             "Version",
+	"Accept and continue": "Acceptér og fortsæt",
+	"Please review and accept them to continue.":              "Læs og acceptér dem for at fortsætte.",
+	"Our terms of service and privacy policy have changed.":   "Vores servicevilkår og privatlivspolitik er ændret.",
+	"You must accept the terms of service and privacy policy": "Du skal acceptere servicevilkårene og privatlivspolitikken",
+
+	// Weather
+	"Copenhagen Forecast":         "Vejrudsigt for København",
+	"Error fetching forecast:":    "Fejl ved hentning af vejrudsigt:",
+	"weather service unavailable": "vejrtjenesten er utilgængelig",
+	"Temperature:":                "Temperatur:",
+	"Wind Speed:":                 "Vindhastighed:",
+	"Wind Direction:":             "Vindretning:",
+	"Step:":                       "Tidspunkt:",
+	"No forecast data available.": "Ingen vejrdata tilgængelige.",
+	"← Back home":                 "← Tilbage til forsiden",
+}
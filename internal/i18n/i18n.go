@@ -0,0 +1,101 @@
+// Package i18n provides the UI message catalogs (English/Danish) and the
+// request language negotiation shared by the HTML templates and search.
+//
+// Catalogs are gettext-style: the English source text is the message ID,
+// so English needs no catalog and untranslated strings fall back to English.
+package i18n
+
+import (
+	"fmt"
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	// CookieName stores the user's explicit UI language choice.
+	CookieName = "lang"
+
+	// Default is used when nothing in the request matches a supported language.
+	Default = "en"
+)
+
+// Supported lists the UI languages in preference order (first = default).
+var Supported = []string{"en", "da"}
+
+var matcher = language.NewMatcher([]language.Tag{language.English, language.Danish})
+
+// catalogs maps language -> (English message ID -> translation).
+var catalogs = map[string]map[string]string{
+	"da": da,
+}
+
+// T translates msg into lang. Optional args are applied with fmt.Sprintf.
+// Unknown languages or missing entries return the English message.
+func T(lang, msg string, args ...any) string {
+	out := msg
+	if tr, ok := catalogs[lang][msg]; ok {
+		out = tr
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(out, args...)
+	}
+	return out
+}
+
+// Normalize returns the supported language code for code, if any.
+func Normalize(code string) (string, bool) {
+	for _, s := range Supported {
+		if s == code {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// QueryParam selects the language of a single request (?language=da).
+const QueryParam = "language"
+
+// Detect picks the language for a request without a stored preference; see Negotiate.
+func Detect(r *http.Request) string {
+	return Negotiate(r, nil)
+}
+
+// Negotiate picks the language for a request, considering only supported languages:
+//  1. the "language" query parameter
+//  2. the "lang" cookie
+//  3. stored, the user's saved preference ("" when none); it is only called when needed
+//  4. the best match from the Accept-Language header (quality values respected)
+//  5. Default
+func Negotiate(r *http.Request, stored func() string) string {
+	if lang, ok := Normalize(r.URL.Query().Get(QueryParam)); ok {
+		return lang
+	}
+	if c, err := r.Cookie(CookieName); err == nil {
+		if lang, ok := Normalize(c.Value); ok {
+			return lang
+		}
+	}
+	if stored != nil {
+		if lang, ok := Normalize(stored()); ok {
+			return lang
+		}
+	}
+	return FromAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// FromAcceptLanguage returns the best supported language for an Accept-Language header value.
+func FromAcceptLanguage(header string) string {
+	if header == "" {
+		return Default
+	}
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+	_, idx, conf := matcher.Match(tags...)
+	if conf == language.No {
+		return Default
+	}
+	return Supported[idx]
+}
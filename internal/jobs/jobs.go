@@ -0,0 +1,464 @@
+// Package jobs is a small persistent background job queue backed by the jobs table.
+//
+// Jobs are leased by workers (status=running + locked_until + a leased_by token), retried
+// with exponential backoff on failure, and marked failed after max_attempts. While a job
+// runs its worker renews the lease every Lease/3, so jobs may run longer than Lease. A lease
+// that expires (e.g. the process crashed mid-job) makes the job available again; the old
+// worker then no longer owns it: its context is cancelled and its result is discarded.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+)
+
+// Job statuses stored in jobs.status.
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// ErrNotFound is returned by Requeue when no failed job has the given id.
+var ErrNotFound = errors.New("job not found")
+
+// ErrLeaseLost is returned by RunOnce when the job's lease expired and another worker took
+// the job over before this one finished it. The other worker's result stands.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Handler processes one job payload. Returning an error schedules a retry.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Job is one row of the jobs table.
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload" swaggertype:"object"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+
+	leasedBy string // lease token while this worker runs the job
+}
+
+// Options tune the worker pool. Zero values use the defaults below.
+type Options struct {
+	Workers      int           // concurrent workers (default 2)
+	PollInterval time.Duration // idle wait between lease attempts (default 2s)
+	Lease        time.Duration // how long a lease lasts unless renewed (default 5m)
+	BaseBackoff  time.Duration // first retry delay, doubled per attempt (default 10s)
+	MaxBackoff   time.Duration // retry delay cap (default 1h)
+	MaxAttempts  int           // attempts before a job is marked failed (default 5)
+}
+
+func (o Options) withDefaults() Options {
+	if o.Workers <= 0 {
+		o.Workers = 2
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 2 * time.Second
+	}
+	if o.Lease <= 0 {
+		o.Lease = 5 * time.Minute
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 10 * time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	return o
+}
+
+// Queue enqueues jobs and runs registered handlers for them.
+type Queue struct {
+	db   *sql.DB
+	opts Options
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// New creates a queue on db (the jobs table must exist, see migrations).
+func New(db *sql.DB, opts Options) *Queue {
+	return &Queue{db: db, opts: opts.withDefaults(), handlers: map[string]Handler{}}
+}
+
+// Register sets the handler for a job type. Jobs of unregistered types stay queued.
+func (q *Queue) Register(jobType string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = h
+}
+
+// Types returns the registered job types.
+func (q *Queue) Types() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	out := make([]string, 0, len(q.handlers))
+	for t := range q.handlers {
+		out = append(out, t)
+	}
+	return out
+}
+
+// Enqueue adds a job that is due immediately.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload any) (int64, error) {
+	return q.EnqueueAt(ctx, jobType, payload, time.Now())
+}
+
+// EnqueueAt adds a job that becomes due at runAt. payload is JSON-encoded.
+func (q *Queue) EnqueueAt(ctx context.Context, jobType string, payload any, runAt time.Time) (int64, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encode payload: %w", err)
+	}
+	now := time.Now().UTC()
+
+	var id int64
+	err = q.db.QueryRowContext(ctx, `
+INSERT INTO jobs (type, payload, status, attempts, max_attempts, run_at, created_at, updated_at)
+VALUES ($1, $2, $3, 0, $4, $5, $6, $6)
+RETURNING id`,
+		jobType, string(raw), StatusQueued, q.opts.MaxAttempts, runAt.UTC(), now,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue %s: %w", jobType, err)
+	}
+	return id, nil
+}
+
+// Run starts the worker pool and blocks until ctx is cancelled.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.worker(ctx)
+		}()
+	}
+
+	// Queue depth is sampled here rather than per worker.
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		q.recordDepth(ctx)
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) worker(ctx context.Context) {
+	for ctx.Err() == nil {
+		worked, err := q.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Println("jobs: worker error:", err)
+		}
+		if worked {
+			continue // drain the queue before sleeping
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(q.opts.PollInterval):
+		}
+	}
+}
+
+// RunOnce leases and processes at most one due job.
+// It reports whether a job was processed.
+func (q *Queue) RunOnce(ctx context.Context) (bool, error) {
+	job, ok, err := q.lease(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	q.mu.RLock()
+	h := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	heartbeat := q.heartbeat(runCtx, cancel, job)
+	start := time.Now()
+	runErr := q.safeRun(runCtx, h, job)
+	metrics.JobDuration.WithLabelValues(job.Type).Observe(time.Since(start).Seconds())
+	cancel()
+	<-heartbeat
+
+	if runErr == nil {
+		if err := q.finish(ctx, job); err != nil {
+			return true, err
+		}
+		metrics.JobsProcessed.WithLabelValues(job.Type, "done").Inc()
+		return true, nil
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		if err := q.fail(ctx, job, runErr, StatusFailed, time.Now()); err != nil {
+			return true, err
+		}
+		metrics.JobsProcessed.WithLabelValues(job.Type, "failed").Inc()
+		log.Printf("jobs: %s #%d failed permanently after %d attempts: %v", job.Type, job.ID, job.Attempts, runErr)
+		return true, nil
+	}
+
+	retryAt := time.Now().Add(q.backoff(job.Attempts))
+	if err := q.fail(ctx, job, runErr, StatusQueued, retryAt); err != nil {
+		return true, err
+	}
+	metrics.JobsProcessed.WithLabelValues(job.Type, "retry").Inc()
+	return true, nil
+}
+
+// heartbeat renews the job's lease every Lease/3 until ctx is done. If the lease was lost
+// (another worker took the job over) it calls lost to cancel the handler. The returned
+// channel is closed when the heartbeat has stopped.
+func (q *Queue) heartbeat(ctx context.Context, lost context.CancelFunc, job Job) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(q.opts.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			now := time.Now().UTC()
+			res, err := q.db.ExecContext(ctx,
+				`UPDATE jobs SET locked_until = $1, updated_at = $2 WHERE id = $3 AND leased_by = $4`,
+				now.Add(q.opts.Lease), now, job.ID, job.leasedBy,
+			)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("jobs: renew lease of %s #%d: %v", job.Type, job.ID, err)
+				}
+				continue // the lease holds until it expires; retry on the next tick
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				log.Printf("jobs: %s #%d lost its lease", job.Type, job.ID)
+				lost()
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// safeRun calls the handler, turning panics into errors so one bad job cannot kill a worker.
+func (q *Queue) safeRun(ctx context.Context, h Handler, job Job) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return h(ctx, job.Payload)
+}
+
+// backoff returns BaseBackoff * 2^(attempts-1), capped at MaxBackoff.
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.opts.BaseBackoff
+	for i := 1; i < attempts && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, q.opts.MaxBackoff)
+}
+
+// lease claims the oldest due job of a registered type.
+//
+// Claiming is a compare-and-set on attempts (UPDATE ... WHERE attempts = seen), so two
+// workers or replicas racing for the same row cannot both win. Expired leases of
+// running jobs are treated as due. The winner stores a fresh token in leased_by.
+func (q *Queue) lease(ctx context.Context) (Job, bool, error) {
+	types := q.Types()
+	if len(types) == 0 {
+		return Job{}, false, nil
+	}
+	now := time.Now().UTC()
+
+	rows, err := q.db.QueryContext(ctx, `
+SELECT id, type, payload, attempts, max_attempts, run_at, created_at
+FROM jobs
+WHERE (status = $1 AND run_at <= $3)
+   OR (status = $2 AND locked_until < $3)
+ORDER BY run_at, id
+LIMIT 20`, StatusQueued, StatusRunning, now)
+	if err != nil {
+		return Job{}, false, err
+	}
+	candidates, err := scanJobs(rows, false)
+	if err != nil {
+		return Job{}, false, err
+	}
+
+	registered := make(map[string]bool, len(types))
+	for _, t := range types {
+		registered[t] = true
+	}
+
+	for _, job := range candidates {
+		if !registered[job.Type] {
+			continue
+		}
+		token := rand.Text()
+		res, err := q.db.ExecContext(ctx, `
+UPDATE jobs
+SET status = $1, attempts = attempts + 1, locked_until = $2, leased_by = $3, updated_at = $4
+WHERE id = $5 AND attempts = $6`,
+			StatusRunning, now.Add(q.opts.Lease), token, now, job.ID, job.Attempts,
+		)
+		if err != nil {
+			return Job{}, false, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			job.Attempts++
+			job.Status = StatusRunning
+			job.leasedBy = token
+			return job, true, nil
+		}
+	}
+	return Job{}, false, nil
+}
+
+// finish marks the job done if this worker still holds its lease (ErrLeaseLost otherwise).
+func (q *Queue) finish(ctx context.Context, job Job) error {
+	res, err := q.db.ExecContext(ctx, `
+UPDATE jobs SET status = $1, locked_until = NULL, leased_by = NULL, last_error = NULL, updated_at = $2
+WHERE id = $3 AND leased_by = $4`,
+		StatusDone, time.Now().UTC(), job.ID, job.leasedBy,
+	)
+	return checkLease(res, err)
+}
+
+// fail records a failed attempt if this worker still holds the lease (ErrLeaseLost otherwise).
+func (q *Queue) fail(ctx context.Context, job Job, runErr error, status string, runAt time.Time) error {
+	res, err := q.db.ExecContext(ctx, `
+UPDATE jobs SET status = $1, run_at = $2, locked_until = NULL, leased_by = NULL, last_error = $3, updated_at = $4
+WHERE id = $5 AND leased_by = $6`,
+		status, runAt.UTC(), runErr.Error(), time.Now().UTC(), job.ID, job.leasedBy,
+	)
+	return checkLease(res, err)
+}
+
+func checkLease(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// List returns the newest jobs with the given status (all statuses when empty).
+func (q *Queue) List(ctx context.Context, status string, limit int) ([]Job, error) {
+	rows, err := q.db.QueryContext(ctx, `
+SELECT id, type, payload, status, attempts, max_attempts, run_at, COALESCE(last_error, ''), created_at
+FROM jobs
+WHERE $1 = '' OR status = $1
+ORDER BY id DESC
+LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows, true)
+}
+
+// Requeue resets a failed job so it runs again with a fresh attempt budget.
+func (q *Queue) Requeue(ctx context.Context, id int64) error {
+	now := time.Now().UTC()
+	res, err := q.db.ExecContext(ctx, `
+UPDATE jobs
+SET status = $1, attempts = 0, run_at = $2, locked_until = NULL, leased_by = NULL, updated_at = $2
+WHERE id = $3 AND status = $4`,
+		StatusQueued, now, id, StatusFailed,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Depth returns the number of jobs per status.
+func (q *Queue) Depth(ctx context.Context) (map[string]int, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := map[string]int{StatusQueued: 0, StatusRunning: 0, StatusDone: 0, StatusFailed: 0}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		out[status] = n
+	}
+	return out, rows.Err()
+}
+
+func (q *Queue) recordDepth(ctx context.Context) {
+	depth, err := q.Depth(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Println("jobs: depth query error:", err)
+		}
+		return
+	}
+	for status, n := range depth {
+		metrics.JobsQueueDepth.WithLabelValues(status).Set(float64(n))
+	}
+}
+
+// scanJobs reads job rows; full selects also include status and last_error.
+func scanJobs(rows *sql.Rows, full bool) ([]Job, error) {
+	defer func() { _ = rows.Close() }()
+
+	out := []Job{}
+	for rows.Next() {
+		var j Job
+		var payload string
+		var err error
+		if full {
+			err = rows.Scan(&j.ID, &j.Type, &payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.LastError, &j.CreatedAt)
+		} else {
+			err = rows.Scan(&j.ID, &j.Type, &payload, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.CreatedAt)
+		}
+		if err != nil {
+			return nil, err
+		}
+		j.Payload = json.RawMessage(payload)
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
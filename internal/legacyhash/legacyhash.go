@@ -0,0 +1,44 @@
+// Package legacyhash handles passwords imported from the legacy Python app, which stored
+// unsalted MD5 hex digests. cmd/dbmigrate wraps each digest in bcrypt, so the database never
+// holds the bare MD5, and login verifies the wrapped hash until the user's next successful
+// login replaces it with a plain bcrypt hash of the password.
+package legacyhash
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Prefix marks a bcrypt hash of a legacy MD5 digest in users.password.
+const Prefix = "md5+bcrypt:"
+
+// Wrap returns the stored form of a legacy MD5 hex digest.
+func Wrap(md5Hex string) (string, error) {
+	digest := strings.ToLower(strings.TrimSpace(md5Hex))
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != md5.Size {
+		return "", errors.New("not an MD5 hex digest")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(digest), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return Prefix + string(hash), nil
+}
+
+// IsWrapped reports whether a stored password hash came from Wrap.
+func IsWrapped(stored string) bool {
+	return strings.HasPrefix(stored, Prefix)
+}
+
+// Verify reports whether password matches a hash returned by Wrap.
+func Verify(stored, password string) bool {
+	if !IsWrapped(stored) {
+		return false
+	}
+	sum := md5.Sum([]byte(password))
+	return bcrypt.CompareHashAndPassword([]byte(strings.TrimPrefix(stored, Prefix)), []byte(hex.EncodeToString(sum[:]))) == nil
+}
@@ -0,0 +1,353 @@
+// Package legacyimport copies users, pages and cached external results from the legacy
+// Python app's SQLite database (src/database/whoknows.db) into the current schema. It is the
+// engine behind cmd/dbmigrate.
+//
+// Legacy tables are read by column name, so older and newer legacy files both work as long
+// as the required columns exist. Rows that already exist in the target (same username or
+// email, page title or URL, or cached result) are skipped, so an import can be re-run.
+package legacyimport
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"devops-valgfag/internal/legacyhash"
+)
+
+// PasswordMode says what happens to the legacy users' unsalted MD5 password hashes.
+type PasswordMode string
+
+const (
+	// PasswordsRehash wraps each MD5 digest in bcrypt (see internal/legacyhash): users keep
+	// their password, and their first login replaces the hash with a plain bcrypt one.
+	PasswordsRehash PasswordMode = "rehash"
+	// PasswordsReset also wraps the digests but marks every account must_reset_password, so
+	// users have to choose a new password from a reset link before they can log in.
+	PasswordsReset PasswordMode = "reset"
+)
+
+// unusablePassword is stored for legacy users whose hash is not an MD5 digest: it never
+// matches, and the account is marked must_reset_password.
+const unusablePassword = "!"
+
+// ParsePasswordMode validates a -passwords flag value.
+func ParsePasswordMode(s string) (PasswordMode, error) {
+	switch m := PasswordMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case PasswordsRehash, PasswordsReset:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown password mode %q (want rehash or reset)", s)
+}
+
+// Options configure Run.
+type Options struct {
+	Tenant    int          // tenant the pages and external results belong to (default 1)
+	Passwords PasswordMode // default PasswordsRehash
+	// DryRun reads and maps every row and, with a target, inserts them in transactions that
+	// are rolled back, so the report shows what a real run would do.
+	DryRun bool
+	// BatchSize is the number of rows between Progress calls (default 500).
+	BatchSize int
+	// Progress, if set, is called after every BatchSize rows and at the end of each table.
+	Progress func(table string, done, total int)
+}
+
+// TableReport counts what happened to one legacy table's rows.
+type TableReport struct {
+	Table    string
+	Read     int // rows read from the legacy table
+	Inserted int // rows written (or that would be, in a dry run)
+	Skipped  int // rows already in the target
+	Invalid  int // rows that cannot be mapped (see the log)
+	Missing  bool
+}
+
+// table describes how one legacy table maps onto the current schema.
+type table struct {
+	name     string
+	required []string
+	optional []string
+	insert   string
+	// args maps a legacy row (required then optional columns; missing optional ones are nil)
+	// to the insert's arguments, or returns an error for an invalid row.
+	args func(row []any, opts Options) ([]any, error)
+}
+
+var tables = []table{
+	{
+		name:     "users",
+		required: []string{"username", "email", "password"},
+		insert: `INSERT INTO users (username, email, password, must_reset_password)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT DO NOTHING`,
+		args: func(row []any, opts Options) ([]any, error) {
+			username, email := text(row[0]), text(row[1])
+			if username == "" || email == "" {
+				return nil, errors.New("empty username or email")
+			}
+			password, err := legacyhash.Wrap(text(row[2]))
+			mustReset := opts.Passwords == PasswordsReset
+			if err != nil {
+				log.Printf("users: %s: legacy password is not an MD5 digest; the account must reset its password", username)
+				password, mustReset = unusablePassword, true
+			}
+			return []any{username, email, password, mustReset}, nil
+		},
+	},
+	{
+		name:     "pages",
+		required: []string{"title", "url", "content"},
+		optional: []string{"language", "last_updated"},
+		insert: `INSERT INTO pages (tenant_id, title, url, content, language, last_updated)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT DO NOTHING`,
+		args: func(row []any, opts Options) ([]any, error) {
+			title, url := text(row[0]), text(row[1])
+			if title == "" || url == "" {
+				return nil, errors.New("empty title or url")
+			}
+			lang, err := language(row[3])
+			if err != nil {
+				return nil, err
+			}
+			updated, err := timestamp(row[4])
+			if err != nil {
+				return nil, err
+			}
+			return []any{opts.Tenant, title, url, text(row[2]), lang, updated}, nil
+		},
+	},
+	{
+		name:     "external_results",
+		required: []string{"query", "language", "title", "url"},
+		optional: []string{"snippet", "created_at"},
+		insert: `INSERT INTO external_results (tenant_id, query, language, title, url, snippet, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, CURRENT_TIMESTAMP))
+ON CONFLICT DO NOTHING`,
+		args: func(row []any, opts Options) ([]any, error) {
+			query, url := text(row[0]), text(row[3])
+			if query == "" || url == "" {
+				return nil, errors.New("empty query or url")
+			}
+			lang, err := language(row[1])
+			if err != nil {
+				return nil, err
+			}
+			created, err := timestamp(row[5])
+			if err != nil {
+				return nil, err
+			}
+			return []any{opts.Tenant, query, lang, text(row[2]), url, text(row[4]), created}, nil
+		},
+	},
+}
+
+// Run copies the legacy tables from src into dst. dst may be nil in a dry run, which then
+// only reads and maps the rows. Each table is copied in one transaction, so a failed table
+// leaves nothing behind; tables already copied stay.
+func Run(ctx context.Context, src, dst *sql.DB, opts Options) ([]TableReport, error) {
+	if opts.Tenant == 0 {
+		opts.Tenant = 1
+	}
+	if opts.Passwords == "" {
+		opts.Passwords = PasswordsRehash
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if dst == nil && !opts.DryRun {
+		return nil, errors.New("a target database is required unless this is a dry run")
+	}
+
+	var reports []TableReport
+	for _, t := range tables {
+		rep, err := copyTable(ctx, src, dst, t, opts)
+		reports = append(reports, rep)
+		if err != nil {
+			return reports, fmt.Errorf("%s: %w", t.name, err)
+		}
+	}
+	return reports, nil
+}
+
+func copyTable(ctx context.Context, src, dst *sql.DB, t table, opts Options) (rep TableReport, err error) {
+	rep.Table = t.name
+	cols, err := legacyColumns(ctx, src, t.name)
+	if err != nil {
+		return rep, err
+	}
+	if len(cols) == 0 {
+		rep.Missing = true
+		return rep, nil
+	}
+
+	selects := make([]string, 0, len(t.required)+len(t.optional))
+	for _, c := range t.required {
+		if !cols[c] {
+			return rep, fmt.Errorf("legacy table has no %s column", c)
+		}
+		selects = append(selects, c)
+	}
+	for _, c := range t.optional {
+		if cols[c] {
+			selects = append(selects, c)
+		} else {
+			selects = append(selects, "NULL")
+		}
+	}
+
+	var total int
+	if err := src.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+t.name).Scan(&total); err != nil {
+		return rep, err
+	}
+
+	var (
+		tx   *sql.Tx
+		stmt *sql.Stmt
+	)
+	if dst != nil {
+		if tx, err = dst.BeginTx(ctx, nil); err != nil {
+			return rep, err
+		}
+		defer func() {
+			if err != nil || opts.DryRun {
+				_ = tx.Rollback()
+			}
+		}()
+		if stmt, err = tx.PrepareContext(ctx, t.insert); err != nil {
+			return rep, err
+		}
+		defer func() { _ = stmt.Close() }()
+	}
+
+	rows, err := src.QueryContext(ctx, `SELECT `+strings.Join(selects, ", ")+` FROM `+t.name+` ORDER BY rowid`)
+	if err != nil {
+		return rep, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		row := make([]any, len(selects))
+		ptrs := make([]any, len(row))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return rep, err
+		}
+		rep.Read++
+
+		args, mapErr := t.args(row, opts)
+		switch {
+		case mapErr != nil:
+			rep.Invalid++
+			log.Printf("%s: skipping row %d: %v", t.name, rep.Read, mapErr)
+		case stmt == nil:
+			rep.Inserted++
+		default:
+			res, err := stmt.ExecContext(ctx, args...)
+			if err != nil {
+				return rep, fmt.Errorf("row %d: %w", rep.Read, err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				rep.Inserted++
+			} else {
+				rep.Skipped++
+			}
+		}
+
+		if opts.Progress != nil && rep.Read%opts.BatchSize == 0 {
+			opts.Progress(t.name, rep.Read, total)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+	if opts.Progress != nil && rep.Read%opts.BatchSize != 0 {
+		opts.Progress(t.name, rep.Read, total)
+	}
+
+	if tx != nil && !opts.DryRun {
+		if err := tx.Commit(); err != nil {
+			return rep, err
+		}
+	}
+	return rep, nil
+}
+
+// legacyColumns returns the column names of a legacy table, or none if it does not exist.
+func legacyColumns(ctx context.Context, src *sql.DB, name string) (map[string]bool, error) {
+	rows, err := src.QueryContext(ctx, `SELECT name FROM pragma_table_info($1)`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	cols := map[string]bool{}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		cols[strings.ToLower(c)] = true
+	}
+	return cols, rows.Err()
+}
+
+// text converts a scanned SQLite value to a trimmed string ("" for NULL).
+func text(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return strings.TrimSpace(string(v))
+	case string:
+		return strings.TrimSpace(v)
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+}
+
+// language maps a legacy language code onto the supported ones; a missing one means "en".
+func language(v any) (string, error) {
+	switch lang := strings.ToLower(text(v)); lang {
+	case "":
+		return "en", nil
+	case "en", "da":
+		return lang, nil
+	default:
+		return "", fmt.Errorf("unsupported language %q", lang)
+	}
+}
+
+// legacyTimeLayouts are the formats the legacy app (Python's str(datetime)) and SQLite's
+// CURRENT_TIMESTAMP wrote.
+var legacyTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// timestamp converts a legacy timestamp (UTC) to a time, or nil when it is missing.
+func timestamp(v any) (any, error) {
+	if t, ok := v.(time.Time); ok {
+		return t.UTC(), nil
+	}
+	s := text(v)
+	if s == "" {
+		return nil, nil
+	}
+	for _, layout := range legacyTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return nil, fmt.Errorf("unreadable timestamp %q", s)
+}
@@ -0,0 +1,162 @@
+// Package lock provides distributed locks built on PostgreSQL session-level advisory locks.
+//
+// A lock is held by one dedicated pool connection; Postgres releases it automatically if that
+// connection (or the whole process) dies, so a crashed replica never leaves a lock behind.
+// Use WithLock for "run this exactly once across replicas" and Acquire/TryAcquire when the
+// lock must be held for longer (e.g. scheduler leadership).
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+)
+
+// DefaultTimeout bounds how long Acquire waits when ctx has no earlier deadline.
+const DefaultTimeout = 30 * time.Second
+
+// pollInterval is the wait between pg_try_advisory_lock attempts while blocking.
+const pollInterval = 100 * time.Millisecond
+
+var (
+	// ErrNotAcquired is returned by TryAcquire/TryWithLock when another session holds the lock.
+	ErrNotAcquired = errors.New("lock: held by another session")
+	// ErrTimeout is returned by Acquire/WithLock when the lock was not free within the timeout.
+	ErrTimeout = errors.New("lock: timed out waiting for lock")
+)
+
+// Key derives a stable advisory lock key from a name (e.g. "scrape:en:golang").
+func Key(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// Lock is a held advisory lock. Release it exactly once (extra calls are no-ops).
+type Lock struct {
+	key        int64
+	conn       *sql.Conn
+	acquiredAt time.Time
+	once       sync.Once
+}
+
+// Conn is the connection holding the lock; work done on it runs in the lock's session.
+func (l *Lock) Conn() *sql.Conn {
+	return l.conn
+}
+
+// Held reports whether the holding connection is still alive (and thus still owns the lock).
+func (l *Lock) Held(ctx context.Context) bool {
+	return l.conn.PingContext(ctx) == nil
+}
+
+// Release unlocks and returns the connection to the pool.
+func (l *Lock) Release() error {
+	var err error
+	l.once.Do(func() {
+		// Background: best-effort unlock even when the caller's ctx is already cancelled.
+		_, err = l.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, l.key)
+		if cerr := l.conn.Close(); err == nil {
+			err = cerr
+		}
+		metrics.LockHeldSeconds.Observe(time.Since(l.acquiredAt).Seconds())
+	})
+	return err
+}
+
+// TryAcquire takes the lock if it is free and returns ErrNotAcquired otherwise.
+func TryAcquire(ctx context.Context, db *sql.DB, key int64) (*Lock, error) {
+	l, err := tryAcquire(ctx, db, key)
+	switch {
+	case err != nil:
+		metrics.LockAcquisitions.WithLabelValues("error").Inc()
+	case l == nil:
+		metrics.LockAcquisitions.WithLabelValues("not_acquired").Inc()
+		return nil, ErrNotAcquired
+	default:
+		metrics.LockAcquisitions.WithLabelValues("acquired").Inc()
+	}
+	return l, err
+}
+
+// Acquire waits for the lock until ctx is done or DefaultTimeout passes (ErrTimeout).
+func Acquire(ctx context.Context, db *sql.DB, key int64) (*Lock, error) {
+	start := time.Now()
+	waitCtx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	for {
+		l, err := tryAcquire(waitCtx, db, key)
+		if l != nil {
+			metrics.LockAcquisitions.WithLabelValues("acquired").Inc()
+			metrics.LockWaitSeconds.Observe(time.Since(start).Seconds())
+			return l, nil
+		}
+		if err != nil && waitCtx.Err() == nil {
+			metrics.LockAcquisitions.WithLabelValues("error").Inc()
+			return nil, err
+		}
+
+		select {
+		case <-waitCtx.Done():
+			metrics.LockAcquisitions.WithLabelValues("timeout").Inc()
+			metrics.LockWaitSeconds.Observe(time.Since(start).Seconds())
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, ErrTimeout
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// WithLock runs fn while holding the lock, waiting for it like Acquire.
+func WithLock(ctx context.Context, db *sql.DB, key int64, fn func(ctx context.Context) error) error {
+	l, err := Acquire(ctx, db, key)
+	if err != nil {
+		return err
+	}
+	return run(ctx, l, fn)
+}
+
+// TryWithLock runs fn only if the lock is free; otherwise it returns ErrNotAcquired without waiting.
+func TryWithLock(ctx context.Context, db *sql.DB, key int64, fn func(ctx context.Context) error) error {
+	l, err := TryAcquire(ctx, db, key)
+	if err != nil {
+		return err
+	}
+	return run(ctx, l, fn)
+}
+
+func run(ctx context.Context, l *Lock, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if rerr := l.Release(); rerr != nil && err == nil {
+		err = fmt.Errorf("lock: release: %w", rerr)
+	}
+	return err
+}
+
+// tryAcquire returns (nil, nil) when the lock is held elsewhere.
+func tryAcquire(ctx context.Context, db *sql.DB, key int64) (*Lock, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("lock: get connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("lock: try lock %d: %w", key, err)
+	}
+	if !acquired {
+		_ = conn.Close()
+		return nil, nil
+	}
+	return &Lock{key: key, conn: conn, acquiredAt: time.Now()}, nil
+}
@@ -1,11 +1,13 @@
 package metrics
 
 import (
+	"database/sql"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
@@ -66,3 +68,323 @@ func (r *statusRecorder) WriteHeader(code int) {
 	r.status = code
 	r.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap exposes the underlying writer so http.ResponseController can reach
+// Flush / SetWriteDeadline (needed for streaming responses like SSE).
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// ClientRequests counts requests by client class (browser, bot, api; see internal/traffic)
+// and route template, to tell human traffic from crawlers and scrapers.
+var ClientRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_http_client_requests_total",
+	Help: "Total HTTP requests by client class and path",
+}, []string{"class", "path"})
+
+// Referrals counts page views by referrer source (direct, internal, search, social, other).
+var Referrals = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_http_referrals_total",
+	Help: "Total page views by referrer source",
+}, []string{"source"})
+
+// SearchClicks counts result clicks; CTR = rate(app_search_clicks_total) / rate(app_search_total).
+var SearchClicks = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "app_search_clicks_total",
+	Help: "Total number of clicked search results",
+})
+
+// SearchClickRank tracks the position of clicked results (1 = top result).
+var SearchClickRank = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "app_search_click_rank",
+	Help:    "Rank (1-based position) of clicked search results",
+	Buckets: []float64{1, 2, 3, 5, 10, 20, 50},
+})
+
+// ExperimentSearches counts searches by A/B experiment and variant (exposures).
+var ExperimentSearches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_experiment_searches_total",
+	Help: "Total number of searches by experiment and variant",
+}, []string{"experiment", "variant"})
+
+// ExperimentClicks counts result clicks by experiment and variant; CTR per variant =
+// rate(app_experiment_clicks_total) / rate(app_experiment_searches_total).
+var ExperimentClicks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_experiment_clicks_total",
+	Help: "Total number of clicked search results by experiment and variant",
+}, []string{"experiment", "variant"})
+
+// JobsQueueDepth is the number of jobs per status (sampled by the worker pool).
+var JobsQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "app_jobs_queue_depth",
+	Help: "Number of background jobs by status",
+}, []string{"status"})
+
+// JobsProcessed counts job runs by type and result (done, retry, failed).
+var JobsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_jobs_processed_total",
+	Help: "Total number of background job runs",
+}, []string{"type", "result"})
+
+// JobDuration tracks how long job handlers take.
+var JobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "app_job_duration_seconds",
+	Help:    "Background job processing latency in seconds",
+	Buckets: prometheus.DefBuckets,
+}, []string{"type"})
+
+// SchedulerTaskRuns counts scheduled task ticks by result (ok, error, skipped, not_leader).
+var SchedulerTaskRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_scheduler_task_runs_total",
+	Help: "Total number of scheduled task ticks by result",
+}, []string{"task", "result"})
+
+// SchedulerTaskDuration tracks how long scheduled tasks take.
+var SchedulerTaskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "app_scheduler_task_duration_seconds",
+	Help:    "Scheduled task run time in seconds",
+	Buckets: prometheus.DefBuckets,
+}, []string{"task"})
+
+// LockAcquisitions counts advisory lock attempts by result (acquired, not_acquired, timeout, error).
+var LockAcquisitions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_lock_acquisitions_total",
+	Help: "Total number of advisory lock acquisition attempts by result",
+}, []string{"result"})
+
+// LockWaitSeconds tracks how long blocking lock acquisitions waited.
+var LockWaitSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "app_lock_wait_seconds",
+	Help:    "Time spent waiting for advisory locks in seconds",
+	Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30},
+})
+
+// LockHeldSeconds tracks how long advisory locks were held.
+var LockHeldSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "app_lock_held_seconds",
+	Help:    "Time advisory locks were held in seconds",
+	Buckets: prometheus.DefBuckets,
+})
+
+// CacheRequests counts cache lookups by cache name and result (hit, miss, error, stale = expired
+// entry served in degraded mode).
+var CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_cache_requests_total",
+	Help: "Total number of cache lookups by cache and result",
+}, []string{"cache", "result"})
+
+// ConditionalRequests counts GETs of resources with validators (ETag, Last-Modified) by
+// route and result: not_modified (answered 304), modified (validators sent but stale) and
+// unconditional (none sent).
+var ConditionalRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_http_conditional_requests_total",
+	Help: "Total number of GETs of cacheable resources by route and conditional result",
+}, []string{"route", "result"})
+
+// RateLimited counts requests rejected with 429 by rate limit scope.
+var RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_rate_limited_total",
+	Help: "Total number of requests rejected by the rate limiter",
+}, []string{"scope"})
+
+// DBQueries counts read-only queries by connection pool (primary, replica) and result (ok, error).
+var DBQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_db_queries_total",
+	Help: "Total number of read-only DB queries by pool and result",
+}, []string{"pool", "result"})
+
+// DBQueryDuration observes read-only queries by connection pool (see DBQueries); the JSON
+// summary (GET /api/metrics/summary) reports its percentiles.
+var DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "app_db_query_duration_seconds",
+	Help:    "Read-only DB query latency in seconds by pool",
+	Buckets: prometheus.ExponentialBuckets(0.001, 2, 14), // 1ms .. ~8s
+}, []string{"pool"})
+
+// DBReplicaFallbacks counts reads retried on the primary because the replica was unreachable.
+var DBReplicaFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "app_db_replica_fallbacks_total",
+	Help: "Total number of read queries that fell back from the replica to the primary",
+})
+
+// DBReplicaUp is 1 while reads are routed to the read replica, 0 when it is down or not configured.
+var DBReplicaUp = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "app_db_replica_up",
+	Help: "Whether the read replica is healthy and receiving reads",
+})
+
+// RegisterDBPool exports connection pool stats (go_sql_* metrics, label db_name=name) for db.
+func RegisterDBPool(name string, db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// DBPoolWait is the average time a connection request waited for a free connection during
+// the last pool sample (internal/dbpool), by pool; go_sql_wait_duration_seconds_total is the total.
+var DBPoolWait = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "app_db_pool_wait_seconds",
+	Help: "Average wait for a DB connection in the last sample interval by pool",
+}, []string{"pool"})
+
+// DBPoolSaturated is how long a pool has been saturated (every connection in use, requests
+// waiting), 0 while it is not.
+var DBPoolSaturated = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "app_db_pool_saturated_seconds",
+	Help: "How long the DB connection pool has been saturated by pool (0 = not saturated)",
+}, []string{"pool"})
+
+// DBPoolSaturationWarnings counts saturations that lasted longer than DB_POOL_SATURATION_WARN.
+var DBPoolSaturationWarnings = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_db_pool_saturation_warnings_total",
+	Help: "Total number of DB pool saturations longer than the warning threshold by pool",
+}, []string{"pool"})
+
+// DBPoolResizes counts MaxOpenConns changes made by pool autotuning, by pool and direction
+// (grow, shrink).
+var DBPoolResizes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_db_pool_resizes_total",
+	Help: "Total number of DB pool size changes made by autotuning by pool and direction",
+}, []string{"pool", "direction"})
+
+// EgressRequests counts outbound HTTP requests (internal/httpclient) by client (wikipedia,
+// dmi, captcha, sentry, s3) and result: ok, error, or blocked by the egress allowlist.
+var EgressRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_egress_requests_total",
+	Help: "Total number of outbound HTTP requests by client and result",
+}, []string{"client", "result"})
+
+// SearchQueriesCanceled counts search/suggestion queries stopped early, by reason
+// (client_disconnect, deadline, statement_timeout).
+var SearchQueriesCanceled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_search_queries_canceled_total",
+	Help: "Total number of search DB queries canceled before completion by reason",
+}, []string{"reason"})
+
+// SlowQueries counts DB queries slower than SLOW_QUERY_THRESHOLD by connection pool.
+var SlowQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_slow_queries_total",
+	Help: "Total number of DB queries exceeding the slow query threshold",
+}, []string{"pool"})
+
+// SearchShadow counts shadow searches (SEARCH_SHADOW) by mode and outcome: same (identical
+// results), reordered (same pages, other order), diverged (other pages), error, or skipped
+// (sampled out of a full slot pool).
+var SearchShadow = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_search_shadow_total",
+	Help: "Total number of shadow searches by mode and outcome",
+}, []string{"mode", "result"})
+
+// SearchShadowOverlap is the share of result pages the shadow path had in common with the
+// served path (1 = the same pages), by mode.
+var SearchShadowOverlap = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "app_search_shadow_overlap_ratio",
+	Help:    "Result overlap between the served and the shadow search path",
+	Buckets: []float64{0, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 1},
+}, []string{"mode"})
+
+// SearchShadowLatency is the page query latency of both sides of a shadow comparison, by
+// search path (ilike, fts, fts_v1, fts_v2) and role (served, shadow).
+var SearchShadowLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "app_search_shadow_duration_seconds",
+	Help:    "Page query latency of shadow-compared searches by path and role",
+	Buckets: prometheus.DefBuckets,
+}, []string{"path", "role"})
+
+// SearchDeduplicated counts searches answered by joining an identical in-flight lookup.
+var SearchDeduplicated = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "app_search_deduplicated_total",
+	Help: "Total number of searches served by a concurrent identical lookup (singleflight)",
+})
+
+// DegradedMode is 1 while the primary database is unreachable and the app serves degraded
+// responses (cached search results, "temporarily unavailable" notices).
+var DegradedMode = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "app_degraded_mode",
+	Help: "Whether the app is in degraded mode because the database is unreachable",
+})
+
+// NotFound counts 404s for unknown paths by first path segment ("/api"; "other" for a
+// segment no route starts with), to spot broken links.
+var NotFound = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_http_not_found_total",
+	Help: "Total number of requests for unknown paths by path prefix",
+}, []string{"prefix"})
+
+// TemplateErrors counts HTML templates that failed to execute, by template name; the
+// request is answered with the 500 error page instead.
+var TemplateErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_template_errors_total",
+	Help: "Total number of HTML template execution errors by template",
+}, []string{"template"})
+
+// AuthFailures counts rejected form logins, registrations and re-authentications by action
+// (login, register, reauth) and the status code they were answered with.
+var AuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_auth_failures_total",
+	Help: "Total number of failed logins and registrations by action and status code",
+}, []string{"action", "code"})
+
+// RegistrationBlocked counts registrations rejected as automated by reason (honeypot,
+// too_fast, form_token, captcha, captcha_unavailable).
+var RegistrationBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_registration_blocked_total",
+	Help: "Total number of registrations blocked by the bot checks by reason",
+}, []string{"reason"})
+
+// PanicsTotal counts handler panics recovered by the recover middleware.
+var PanicsTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "app_panics_total",
+	Help: "Total number of recovered panics in HTTP handlers",
+})
+
+// ErrorReports counts events sent to the error tracker (SENTRY_DSN) by result
+// (sent, failed, dropped = queue full).
+var ErrorReports = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_error_reports_total",
+	Help: "Total number of error tracking events by result",
+}, []string{"result"})
+
+// ConfigReloads counts runtime config reloads (SIGHUP or POST /admin/config/reload) by
+// result (success, failure); a failed reload keeps the previous config.
+var ConfigReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_config_reloads_total",
+	Help: "Total number of runtime config reloads by result",
+}, []string{"result"})
+
+// RetentionPurged counts rows deleted by the data retention runs, by table (search_log,
+// external_results).
+var RetentionPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "app_retention_purged_rows_total",
+	Help: "Total number of rows deleted by data retention, by table",
+}, []string{"table"})
+
+// MigrationDuration is how long the last migration run took (startup or cmd/migrate).
+var MigrationDuration = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "app_migration_duration_seconds",
+	Help: "Duration of the last database migration run in seconds",
+})
+
+// MigrationsApplied and MigrationsPending are the migration files recorded in
+// schema_migrations and those not applied yet, as of the last run. Pending stays above 0
+// after a failed run, so comparing them across environments shows schema drift.
+var MigrationsApplied = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "app_migrations_applied",
+	Help: "Number of migration files recorded in schema_migrations",
+})
+
+var MigrationsPending = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "app_migrations_pending",
+	Help: "Number of migration files not applied yet",
+})
+
+// MigrationLastVersion is the highest number of an applied migration file (36 for
+// 0036_retention_runs; SQLite migrations are numbered separately), 0 if none.
+var MigrationLastVersion = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "app_migration_last_version",
+	Help: "Highest number of an applied migration file",
+})
+
+// MigrationFailures counts migration runs that failed.
+var MigrationFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "app_migration_failures_total",
+	Help: "Total number of failed database migration runs",
+})
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Snapshot is the gathered state of a registry by metric name, for JSON summaries of the
+// metrics (GET /api/metrics/summary) where Prometheus cannot be queried.
+type Snapshot map[string]*dto.MetricFamily
+
+// Gather collects g (prometheus.DefaultGatherer when nil).
+func Gather(g prometheus.Gatherer) (Snapshot, error) {
+	if g == nil {
+		g = prometheus.DefaultGatherer
+	}
+	families, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+	s := make(Snapshot, len(families))
+	for _, f := range families {
+		s[f.GetName()] = f
+	}
+	return s, nil
+}
+
+// Labels are the label values of one series.
+type Labels map[string]string
+
+// Sum adds up the counter, gauge or untyped series of name whose labels match (all of them
+// when match is nil). A metric that has not been observed yet sums to 0.
+func (s Snapshot) Sum(name string, match func(Labels) bool) float64 {
+	var sum float64
+	for _, m := range s.series(name, match) {
+		switch {
+		case m.Counter != nil:
+			sum += m.Counter.GetValue()
+		case m.Gauge != nil:
+			sum += m.Gauge.GetValue()
+		case m.Untyped != nil:
+			sum += m.Untyped.GetValue()
+		}
+	}
+	return sum
+}
+
+// Histogram merges the histogram series of name whose labels match into one (series of a
+// vector share their buckets). It returns nil when there is no such series.
+func (s Snapshot) Histogram(name string, match func(Labels) bool) *dto.Histogram {
+	var merged *dto.Histogram
+	for _, m := range s.series(name, match) {
+		h := m.GetHistogram()
+		if h == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &dto.Histogram{SampleCount: new(uint64), SampleSum: new(float64)}
+			for _, b := range h.GetBucket() {
+				merged.Bucket = append(merged.Bucket, &dto.Bucket{UpperBound: b.UpperBound, CumulativeCount: new(uint64)})
+			}
+		}
+		*merged.SampleCount += h.GetSampleCount()
+		*merged.SampleSum += h.GetSampleSum()
+		for i, b := range h.GetBucket() {
+			if i < len(merged.Bucket) {
+				*merged.Bucket[i].CumulativeCount += b.GetCumulativeCount()
+			}
+		}
+	}
+	return merged
+}
+
+func (s Snapshot) series(name string, match func(Labels) bool) []*dto.Metric {
+	f := s[name]
+	if f == nil {
+		return nil
+	}
+	if match == nil {
+		return f.GetMetric()
+	}
+	var out []*dto.Metric
+	for _, m := range f.GetMetric() {
+		labels := make(Labels, len(m.GetLabel()))
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if match(labels) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Quantile estimates the q-quantile (0 <= q <= 1) of h the way PromQL's histogram_quantile
+// does: linear interpolation inside the bucket the rank falls into. Observations above the
+// largest bucket report that bucket's upper bound. An empty or nil histogram yields 0.
+func Quantile(q float64, h *dto.Histogram) float64 {
+	total := h.GetSampleCount()
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var lower, prevCount float64
+	for _, b := range h.GetBucket() {
+		upper, count := b.GetUpperBound(), float64(b.GetCumulativeCount())
+		if count >= rank {
+			if count == prevCount {
+				return upper
+			}
+			return lower + (upper-lower)*(rank-prevCount)/(count-prevCount)
+		}
+		lower, prevCount = upper, count
+	}
+	return lower
+}
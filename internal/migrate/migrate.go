@@ -7,76 +7,212 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"devops-valgfag/internal/lock"
+	"devops-valgfag/internal/metrics"
 )
 
 const migrationLockID int64 = 8675309
 
+// migrationTimeout is the deadline of each step of a run: opening the connection, creating the
+// ledger, and checking and applying one file. It is per file, so a slow file does not use up
+// the time of the files after it; a no-transaction file has no deadline at all. A variable
+// for tests.
+var migrationTimeout = 30 * time.Second
+
+// noTransactionDirective, in the leading comments of a migration file, runs the file outside a
+// transaction: for statements PostgreSQL refuses in one, such as CREATE INDEX CONCURRENTLY.
+const noTransactionDirective = "-- migrate:no-transaction"
+
 // RunMigrations applies all pending .sql migrations found in the migrations/ folder.
 //
 // Key properties:
 //  1) Safe under concurrency: uses a PostgreSQL advisory lock so only one process runs migrations at a time.
 //  2) Deterministic: applies migrations in sorted filename order (e.g., 0001_..., 0002_...).
 //  3) Idempotent: records applied versions in schema_migrations so reruns skip already-applied files.
-//  4) Atomic: each migration file runs inside a DB transaction (all-or-nothing).
+//  4) Atomic: each migration file runs inside a DB transaction (all-or-nothing), unless it
+//     starts with the -- migrate:no-transaction directive (see applyWithoutTransaction).
 func RunMigrations(db *sql.DB) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	return RunMigrationsFrom(db, "migrations")
+}
 
-	// Use a single dedicated connection so the advisory lock is held consistently for the whole run.
-	conn, err := db.Conn(ctx)
+// RunMigrationsFrom is RunMigrations with the migrations read from dir (tests run in their
+// package directory, not the repository root).
+func RunMigrationsFrom(db *sql.DB, dir string) error {
+	start := time.Now()
+	return observeRun(start, runPostgres(db, dir))
+}
+
+func runPostgres(db *sql.DB, dir string) error {
+	// Acquire bounds its wait itself (lock.DefaultTimeout); applyPending sets the other deadlines.
+	ctx := context.Background()
+
+	// Advisory lock prevents concurrent migration runners (e.g., multiple app replicas starting together).
+	// Everything below runs on the lock's dedicated connection so the lock is held consistently for the whole run.
+	l, err := lock.Acquire(ctx, db, migrationLockID)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration advisory lock: %w", err)
+	}
+	// Release unlocks even on error/panic paths.
+	defer func() { _ = l.Release() }()
+	conn := l.Conn()
+
+	_, err = applyPending(ctx, conn, dir, true, true)
+	return err
+}
+
+// RunSQLiteMigrations applies the SQLite migrations in migrations/sqlite/ (DB_DRIVER=sqlite),
+// with the same schema_migrations ledger as RunMigrations.
+//
+// There is no lock: SQLite has no advisory locks and the demo runs as a single process.
+// Files run as a whole, because SQLite trigger bodies (BEGIN ...; END) contain semicolons
+// that splitSQLStatements would break apart.
+func RunSQLiteMigrations(db *sql.DB) error {
+	return RunSQLiteMigrationsFrom(db, filepath.Join("migrations", "sqlite"))
+}
+
+// RunSQLiteMigrationsFrom is RunSQLiteMigrations with the migrations read from dir.
+func RunSQLiteMigrationsFrom(db *sql.DB, dir string) error {
+	start := time.Now()
+	conn, err := openConn(db)
 	if err != nil {
-		return fmt.Errorf("failed to get DB connection for migrations: %w", err)
+		return observeRun(start, err)
 	}
 	defer func() { _ = conn.Close() }()
 
-	// Track lock state so we always release it on exit (even on error/panic paths).
-	locked := false
-	defer func() {
-		if locked {
-			// Unlock uses Background so we attempt best-effort unlock even if ctx is cancelled/timed out.
-			_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
-		}
-	}()
+	_, err = applyPending(context.Background(), conn, dir, false, true)
+	return observeRun(start, err)
+}
 
-	// Advisory lock prevents concurrent migration runners (e.g., multiple app replicas starting together).
-	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
-		return fmt.Errorf("failed to acquire migration advisory lock: %w", err)
+// Report compares the schema_migrations ledger with the migration files of a directory.
+// Every run exports it as the app_migrations_applied, app_migrations_pending and
+// app_migration_last_version metrics.
+type Report struct {
+	Applied     int    // files recorded in schema_migrations
+	Pending     int    // files not applied yet
+	LastVersion string // applied file with the highest version, e.g. 0036_retention_runs; "" if none
+}
+
+// Status returns the Report for the migrations in dir without applying any (cmd/migrate -status).
+// It exports the metrics like a run, except the run duration.
+func Status(db *sql.DB, dir string) (Report, error) {
+	conn, err := openConn(db)
+	if err != nil {
+		return Report{}, err
 	}
-	locked = true
+	defer func() { _ = conn.Close() }()
 
+	return applyPending(context.Background(), conn, dir, false, false)
+}
+
+// openConn takes the connection a run without advisory lock (SQLite, Status) works on.
+func openConn(db *sql.DB) (*sql.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migration connection: %w", err)
+	}
+	return conn, nil
+}
+
+// observeRun records the duration of a migration run started at start and counts it as a
+// failure if err is set. It returns err.
+func observeRun(start time.Time, err error) error {
+	metrics.MigrationDuration.Set(time.Since(start).Seconds())
+	if err != nil {
+		metrics.MigrationFailures.Inc()
+	}
+	return err
+}
+
+// export sets the ledger metrics to the report.
+func (r Report) export() {
+	metrics.MigrationsApplied.Set(float64(r.Applied))
+	metrics.MigrationsPending.Set(float64(r.Pending))
+	metrics.MigrationLastVersion.Set(float64(versionNumber(r.LastVersion)))
+}
+
+// versionNumber is the leading number of a version (36 for 0036_retention_runs), 0 if there
+// is none.
+func versionNumber(version string) int {
+	digits := len(version) - len(strings.TrimLeft(version, "0123456789"))
+	n, _ := strconv.Atoi(version[:digits])
+	return n
+}
+
+// applyPending applies the migrations in dir that schema_migrations does not list yet, or
+// only lists them without apply. With split, files are executed statement by statement (see
+// splitSQLStatements). The report, also exported on failure, counts the files applied so far.
+// Each step gets its own migrationTimeout from ctx.
+func applyPending(ctx context.Context, conn *sql.Conn, dir string, split, apply bool) (report Report, err error) {
 	// Ensure the bookkeeping table exists before checking/recording migration versions.
-	if err := ensureSchemaMigrationsTable(ctx, conn); err != nil {
-		return err
+	stepCtx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	err = ensureSchemaMigrationsTable(stepCtx, conn)
+	cancel()
+	if err != nil {
+		return report, err
 	}
 
 	// Load all migration files from disk (sorted for deterministic order).
-	files, err := loadMigrationFiles("migrations")
+	files, err := loadMigrationFiles(dir)
 	if err != nil {
-		return err
+		return report, err
 	}
+	defer func() {
+		report.Pending = len(files) - report.Applied
+		report.export()
+	}()
 
 	// Apply each migration exactly once (skip if its version is already recorded).
 	for _, file := range files {
 		version := migrationVersionFromFile(file)
 
-		applied, err := migrationApplied(ctx, conn, version)
+		applied, err := migrateFile(ctx, conn, version, file, split, apply)
 		if err != nil {
-			return err
+			return report, err
 		}
 		if applied {
-			fmt.Println("Skipping migration:", version)
-			continue
+			report.Applied++
+			if versionNumber(version) >= versionNumber(report.LastVersion) {
+				report.LastVersion = version
+			}
 		}
+	}
 
-		if err := applyMigrationFile(ctx, conn, version, file); err != nil {
-			return err
-		}
+	if apply {
+		fmt.Println("All migrations applied successfully.")
 	}
+	return report, nil
+}
 
-	fmt.Println("All migrations applied successfully.")
-	return nil
+// migrateFile applies one file unless it is recorded already (or only reports it without
+// apply), within its own migrationTimeout. It reports whether the file is applied afterwards.
+func migrateFile(ctx context.Context, conn *sql.Conn, version, file string, split, apply bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+
+	applied, err := migrationApplied(ctx, conn, version)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case applied:
+		if apply {
+			fmt.Println("Skipping migration:", version)
+		}
+		return true, nil
+	case !apply:
+		fmt.Println("Pending migration:", version)
+		return false, nil
+	}
+	if err := applyMigrationFile(ctx, conn, version, file, split); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // ensureSchemaMigrationsTable makes sure the schema_migrations table exists.
@@ -135,10 +271,13 @@ func migrationApplied(ctx context.Context, conn *sql.Conn, version string) (bool
 //
 // Flow:
 //  1) Read file content.
-//  2) Split into executable SQL statements (careful: don't split inside strings or $$ blocks).
+//  2) Split into executable SQL statements (careful: don't split inside strings or $$ blocks),
+//     unless split is false and the driver runs the whole file at once.
 //  3) Execute statements in a transaction (rollback on first error).
 //  4) Record the version in schema_migrations and commit.
-func applyMigrationFile(ctx context.Context, conn *sql.Conn, version, file string) error {
+//
+// Files with the no-transaction directive skip 3) and 4); see applyWithoutTransaction.
+func applyMigrationFile(ctx context.Context, conn *sql.Conn, version, file string, split bool) error {
 	content, err := os.ReadFile(file)
 	if err != nil {
 		return fmt.Errorf("failed to read migration %s: %w", file, err)
@@ -146,17 +285,25 @@ func applyMigrationFile(ctx context.Context, conn *sql.Conn, version, file strin
 
 	fmt.Println("Applying migration:", version)
 
-	tx, err := conn.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction for migration %s: %w", version, err)
-	}
-
 	// Split file into statements safely.
 	// We can't just strings.Split(..., ";") because migration files may contain:
 	// - string literals: 'text; with semicolon'
 	// - dollar-quoted blocks: $$ BEGIN ...; ... END $$ (functions/triggers)
 	// Those semicolons must NOT terminate the statement.
-	statements := splitSQLStatements(string(content))
+	statements := []string{string(content)}
+	if split {
+		statements = splitSQLStatements(string(content))
+	}
+
+	if hasNoTransactionDirective(string(content)) {
+		return applyWithoutTransaction(ctx, conn, version, statements)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for migration %s: %w", version, err)
+	}
+
 	for _, stmt := range statements {
 		if _, err := tx.ExecContext(ctx, stmt); err != nil {
 			_ = tx.Rollback()
@@ -182,12 +329,98 @@ func applyMigrationFile(ctx context.Context, conn *sql.Conn, version, file strin
 	return nil
 }
 
+// hasNoTransactionDirective reports whether the comments at the top of a migration file (before
+// its first statement) include the no-transaction directive.
+func hasNoTransactionDirective(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == noTransactionDirective {
+			return true
+		}
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return false
+}
+
+// applyWithoutTransaction runs the statements of a no-transaction migration one by one, each
+// committing on its own, and then records the version.
+//
+// A failure cannot be rolled back. The statements before it stay applied, the version stays
+// unrecorded, and the failed statement and error go to schema_migration_failures (with the
+// number of attempts), so the next start runs the whole file again. Such files must be safe to
+// rerun: IF NOT EXISTS, and DROP INDEX CONCURRENTLY IF EXISTS before a concurrent index build,
+// because a failed build leaves an INVALID index behind that IF NOT EXISTS would keep.
+//
+// The file's deadline (migrationTimeout) does not apply: building an index on a large table
+// takes as long as it takes, and the concurrent build does not block writes meanwhile. The
+// files after it get a fresh deadline of their own.
+func applyWithoutTransaction(ctx context.Context, conn *sql.Conn, version string, statements []string) error {
+	ctx = context.WithoutCancel(ctx)
+	if err := ensureMigrationFailuresTable(ctx, conn); err != nil {
+		return err
+	}
+
+	for n, stmt := range statements {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			recordMigrationFailure(ctx, conn, version, n+1, err)
+			return fmt.Errorf("migration %s (no transaction) failed at statement %d, earlier statements stay applied: %w", version, n+1, err)
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+		return fmt.Errorf("failed to insert migration record %s: %w", version, err)
+	}
+	if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migration_failures WHERE version = $1", version); err != nil {
+		return fmt.Errorf("failed to clear failure record %s: %w", version, err)
+	}
+	return nil
+}
+
+// ensureMigrationFailuresTable makes sure schema_migration_failures exists: the last failure of
+// each no-transaction migration that has not been applied yet.
+func ensureMigrationFailuresTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migration_failures (
+			version   VARCHAR(255) PRIMARY KEY,
+			statement INTEGER NOT NULL,
+			error     TEXT NOT NULL,
+			attempts  INTEGER NOT NULL DEFAULT 1,
+			failed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to ensure schema_migration_failures: %w", err)
+	}
+	return nil
+}
+
+// recordMigrationFailure stores the failed statement (1-based) and error of a no-transaction
+// migration. It only logs its own errors: the migration error is the one to return.
+func recordMigrationFailure(ctx context.Context, conn *sql.Conn, version string, statement int, cause error) {
+	_, err := conn.ExecContext(ctx, `
+		INSERT INTO schema_migration_failures (version, statement, error, attempts, failed_at)
+		VALUES ($1, $2, $3, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (version) DO UPDATE SET
+			statement = EXCLUDED.statement,
+			error     = EXCLUDED.error,
+			attempts  = schema_migration_failures.attempts + 1,
+			failed_at = EXCLUDED.failed_at
+	`, version, statement, cause.Error())
+	if err != nil {
+		fmt.Println("Failed to record migration failure:", version, err)
+	}
+}
+
 // splitState tracks whether the SQL parser is currently inside:
 // - a single-quoted string: '...'
 // - a dollar-quoted block: $$...$$ or $tag$...$tag$
 // When inside either, semicolons should NOT end a statement.
+// Comments are consumed whole (see trySkipComment) and need no state.
 type splitState struct {
 	inSingle  bool
+	escapes   bool // the single-quoted string is an E'...' string, where \ escapes
 	inDollar  bool
 	dollarTag string
 }
@@ -203,9 +436,15 @@ type dollarParse struct {
 // splitSQLStatements breaks a migration file into individual statements.
 //
 // Core rule: split on ';' only when we are NOT inside:
-//  - single quotes ('...'), or
+//  - single quotes ('...', or E'...' with backslash escapes such as \'), or
 //  - dollar-quoted blocks ($$...$$ / $tag$...$tag$).
 //
+// In plain '...' strings a backslash is an ordinary character (standard_conforming_strings,
+// the PostgreSQL default).
+//
+// Comments outside those (-- to end of line, /* */ with nesting as in PostgreSQL) are
+// dropped, so quotes, dollars or semicolons in them are ignored.
+//
 // This is a small state machine that walks the file byte-by-byte, buffering output,
 // and "emits" a statement whenever it finds a safe semicolon boundary.
 func splitSQLStatements(content string) []string {
@@ -218,11 +457,21 @@ func splitSQLStatements(content string) []string {
 	for i := 0; i < len(content); i++ {
 		ch := content[i]
 
+		// Skip comments, which may contain quotes and semicolons.
+		if trySkipComment(content, &i, &st, &buf) {
+			continue
+		}
+
 		// Handle entering/leaving dollar-quoted blocks ($$ or $tag$).
 		if tryHandleDollarStartOrEnd(content, &i, ch, &st, &buf) {
 			continue
 		}
 
+		// Copy backslash escapes in E'...' strings whole, so \' does not end the string.
+		if tryHandleBackslashEscape(content, &i, ch, &st, &buf) {
+			continue
+		}
+
 		// Handle entering/leaving single-quoted strings (including escaped quotes '').
 		if tryHandleSingleQuote(content, &i, ch, &st, &buf) {
 			continue
@@ -241,6 +490,48 @@ func splitSQLStatements(content string) []string {
 	return statements
 }
 
+// trySkipComment skips a -- or /* */ comment starting at i, leaving i on its last byte. A line
+// comment keeps its newline and a block comment becomes a space, so the tokens around it stay
+// apart. Block comments nest; an unterminated comment runs to the end of the file.
+func trySkipComment(content string, i *int, st *splitState, buf *strings.Builder) bool {
+	if st.inSingle || st.inDollar || *i+1 >= len(content) {
+		return false
+	}
+
+	switch content[*i : *i+2] {
+	case "--":
+		end := strings.IndexByte(content[*i:], '\n')
+		if end < 0 {
+			*i = len(content) - 1
+			return true
+		}
+		*i += end
+		buf.WriteByte('\n')
+		return true
+
+	case "/*":
+		depth := 0
+		j := *i
+		for ; j+1 < len(content); j++ {
+			switch content[j : j+2] {
+			case "/*":
+				depth++
+				j++
+			case "*/":
+				depth--
+				j++
+			}
+			if depth == 0 {
+				break
+			}
+		}
+		*i = min(j, len(content)-1)
+		buf.WriteByte(' ')
+		return true
+	}
+	return false
+}
+
 // tryHandleDollarStartOrEnd detects $$ or $tag$ delimiters and toggles dollar-quote state.
 // - When not inDollar, a delimiter starts a dollar block.
 // - When inDollar, only the matching delimiter ends the block.
@@ -314,10 +605,31 @@ func tryHandleSingleQuote(content string, i *int, ch byte, st *splitState, buf *
 			return true
 		}
 		st.inSingle = false
+		st.escapes = false
 		return true
 	}
 
 	st.inSingle = true
+	st.escapes = isEscapeStringStart(content, *i)
+	return true
+}
+
+// isEscapeStringStart reports whether the quote at i opens an escape string: E'...' or e'...',
+// where the E is a token of its own (not the end of an identifier such as name'...').
+func isEscapeStringStart(content string, i int) bool {
+	if i == 0 || (content[i-1] != 'E' && content[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isDollarTagChar(content[i-2])
+}
+
+// tryHandleBackslashEscape copies a backslash and the byte it escapes inside an E'...' string.
+func tryHandleBackslashEscape(content string, i *int, ch byte, st *splitState, buf *strings.Builder) bool {
+	if !st.inSingle || !st.escapes || ch != '\\' || *i+1 >= len(content) {
+		return false
+	}
+	writeRange(buf, content, *i, *i+1)
+	*i++
 	return true
 }
 
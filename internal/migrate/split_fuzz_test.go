@@ -0,0 +1,41 @@
+package migrate
+
+// Fuzz target for the migration statement splitter. It lives in the package (unlike the tests
+// in tests/) because splitSQLStatements is unexported.
+//
+//	go test ./internal/migrate -run '^$' -fuzz FuzzSplitSQLStatements -fuzztime 30s
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzSplitSQLStatements(f *testing.F) {
+	for _, seed := range []string{
+		"CREATE TABLE a (id INT); INSERT INTO a VALUES (1)",
+		"INSERT INTO t VALUES ('a;b', 'it''s; fine');",
+		"CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN NEW.x := 1; RETURN NEW; END $$ LANGUAGE plpgsql;",
+		"DO $outer$ BEGIN EXECUTE $inner$ SELECT 1; $inner$; END $outer$; SELECT 2",
+		"-- don't split here; or here\nSELECT 1; /* nor ; here /* nested; */ still; */ SELECT 2",
+		"SELECT '-- not a comment;' ; SELECT $$/* nor this; $$",
+		"SELECT 1 -- trailing comment without newline",
+		"SELECT '\\'; SELECT E'\\'';",
+		"/* unterminated ; comment",
+		"SELECT $1; SELECT $a$ unterminated ;",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, content string) {
+		statements := splitSQLStatements(content)
+		for _, stmt := range statements {
+			if stmt == "" || stmt != strings.TrimSpace(stmt) {
+				t.Fatalf("statement %q is empty or not trimmed", stmt)
+			}
+			// A statement holds no boundary and no comment, so splitting it again is a no-op.
+			if again := splitSQLStatements(stmt); len(again) != 1 || again[0] != stmt {
+				t.Fatalf("re-splitting %q gave %q", stmt, again)
+			}
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package migrate
+
+// Like split_fuzz_test.go, these tests live in the package because splitSQLStatements is
+// unexported.
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"plain", "CREATE TABLE a (id INT);\nINSERT INTO a VALUES (1);", []string{"CREATE TABLE a (id INT)", "INSERT INTO a VALUES (1)"}},
+		{"no trailing semicolon", "SELECT 1; SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"empty statements", " ; ;\n;SELECT 1;;", []string{"SELECT 1"}},
+		{"quoted semicolon", "INSERT INTO t VALUES ('a;b'); SELECT 1", []string{"INSERT INTO t VALUES ('a;b')", "SELECT 1"}},
+		{"doubled quote", "SELECT 'it''s; fine'; SELECT 2", []string{"SELECT 'it''s; fine'", "SELECT 2"}},
+		{"backslash in plain string", `SELECT 'C:\'; SELECT 2`, []string{`SELECT 'C:\'`, "SELECT 2"}},
+		{"escape string", `SELECT E'it\'s; fine'; SELECT 2`, []string{`SELECT E'it\'s; fine'`, "SELECT 2"}},
+		{"escaped backslash", `SELECT e'\\'; SELECT 2`, []string{`SELECT e'\\'`, "SELECT 2"}},
+		{"identifier ending in e", `SELECT name'x\'; SELECT 2`, []string{`SELECT name'x\'`, "SELECT 2"}},
+		{"dollar quote", "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; SELECT 2",
+			[]string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "SELECT 2"}},
+		{"nested dollar tags", "DO $a$ BEGIN EXECUTE $b$ SELECT 1; $b$; END $a$; SELECT 2",
+			[]string{"DO $a$ BEGIN EXECUTE $b$ SELECT 1; $b$; END $a$", "SELECT 2"}},
+		{"quote in dollar quote", "SELECT $$it's;$$; SELECT 2", []string{"SELECT $$it's;$$", "SELECT 2"}},
+		{"line comment", "-- don't split; here\nSELECT 1; -- trailing; comment\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"comment at end of file", "SELECT 1; -- done", []string{"SELECT 1"}},
+		{"block comment", "SELECT /* a; 'b */ 1; SELECT 2", []string{"SELECT   1", "SELECT 2"}},
+		{"nested block comment", "/* outer /* inner; */ still; */ SELECT 1;", []string{"SELECT 1"}},
+		{"comment markers in strings", "SELECT '-- x; /* y'; SELECT $$ -- z; $$", []string{"SELECT '-- x; /* y'", "SELECT $$ -- z; $$"}},
+		{"comment separates tokens", "SELECT 1/**/FROM t", []string{"SELECT 1 FROM t"}},
+		{"unterminated block comment", "SELECT 1; /* never closed; SELECT 2", []string{"SELECT 1"}},
+		{"placeholder is not a dollar quote", "SELECT $1; SELECT 2", []string{"SELECT $1", "SELECT 2"}},
+	} {
+		if got := splitSQLStatements(c.in); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: splitSQLStatements(%q)\n got %q\nwant %q", c.name, c.in, got, c.want)
+		}
+	}
+}
+
+// The fixtures in testdata are whole Postgres files with semicolons in strings and
+// dollar-quoted blocks.
+func TestSplitSQLStatements_Fixtures(t *testing.T) {
+	for file, want := range map[string]int{"migration_smoke_test.sql": 3, "parser_edgecases.sql": 5} {
+		content, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := splitSQLStatements(string(content))
+		if len(got) != want {
+			t.Errorf("%s: expected %d statements, got %d: %q", file, want, len(got), got)
+		}
+		for _, stmt := range got {
+			if strings.HasPrefix(stmt, "--") || strings.TrimSpace(stmt) == "" {
+				t.Errorf("%s: unexpected statement %q", file, stmt)
+			}
+		}
+	}
+}
+
+func TestHasNoTransactionDirective(t *testing.T) {
+	for in, want := range map[string]bool{
+		"-- migrate:no-transaction\nCREATE INDEX CONCURRENTLY i ON t (c);":                      true,
+		"-- 0031_x.sql\n\n  -- migrate:no-transaction  \nCREATE INDEX CONCURRENTLY i ON t (c);": true,
+		"CREATE TABLE t (c INT);\n-- migrate:no-transaction":                                    false,
+		"-- migrate:no-transactions\nSELECT 1;":                                                 false,
+		"":                                                                                      false,
+	} {
+		if got := hasNoTransactionDirective(in); got != want {
+			t.Errorf("hasNoTransactionDirective(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -1,5 +1,6 @@
 -- Migration smoke test
--- This migration exists only to verify that the migration system works end-to-end.
+-- Not a migration: a fixture for TestSplitSQLStatements_Fixtures (split_test.go). It used to
+-- live in migrations/ as 9998_migration_smoke_test.sql.
 
 CREATE TABLE IF NOT EXISTS migration_smoke_test (
     id SERIAL PRIMARY KEY,
@@ -1,6 +1,7 @@
--- 9999_parser_edgecases.sql
+-- parser_edgecases.sql
 -- Parser edge cases smoke test
--- Only to validate splitSQLStatements() handles tricky Postgres syntax.
+-- Only to validate splitSQLStatements() handles tricky Postgres syntax; a fixture for
+-- TestSplitSQLStatements_Fixtures (split_test.go), formerly migrations/9999_parser_edgecases.sql.
 
 -- Ensure test table exists (so this file can run standalone).
 CREATE TABLE IF NOT EXISTS migration_smoke_test (
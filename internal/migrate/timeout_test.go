@@ -0,0 +1,50 @@
+package migrate
+
+// In the package because migrationTimeout is unexported.
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/dialect"
+)
+
+// A no-transaction file that runs longer than the per-file deadline does not leave the files
+// after it without time.
+func TestMigrationTimeout_PerFile(t *testing.T) {
+	db, err := dialect.OpenSQLite(filepath.Join(t.TempDir(), "timeout.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"0001_slow.sql": noTransactionDirective + "\n" +
+			"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000) SELECT COUNT(*) FROM c;",
+		"0002_after.sql": "CREATE TABLE after_slow (id INTEGER PRIMARY KEY);",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := migrationTimeout
+	migrationTimeout = 50 * time.Millisecond
+	defer func() { migrationTimeout = old }()
+
+	start := time.Now()
+	if err := RunSQLiteMigrationsFrom(db, dir); err != nil {
+		t.Fatalf("expected every file to be applied, got %v", err)
+	}
+	if time.Since(start) < migrationTimeout {
+		t.Skip("the slow migration finished within the deadline; nothing to check")
+	}
+	report, err := Status(db, dir)
+	if err != nil || report.Pending != 0 {
+		t.Fatalf("expected nothing pending, got %+v (%v)", report, err)
+	}
+}
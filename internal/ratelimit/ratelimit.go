@@ -0,0 +1,88 @@
+// Package ratelimit implements fixed-window request limits with an in-memory and a Redis backend.
+//
+// Each key (e.g. "login:<client ip>") may be used limit times per window. The Redis limiter
+// shares counters across replicas, so the limit holds for the whole deployment.
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Limiter decides whether one more request for key is allowed in the current window.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (bool, error)
+}
+
+// Memory is an in-process fixed-window limiter.
+type Memory struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]memoryWindow
+}
+
+type memoryWindow struct {
+	start time.Time
+	count int
+}
+
+// NewMemory creates an in-memory limiter allowing limit requests per window and key.
+func NewMemory(limit int, window time.Duration) *Memory {
+	return &Memory{limit: limit, window: window, windows: map[string]memoryWindow{}}
+}
+
+// Allow counts the request and reports whether it is within the limit.
+func (m *Memory) Allow(_ context.Context, key string) (bool, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.windows[key]
+	if !ok || now.Sub(w.start) >= m.window {
+		// Opportunistic cleanup keeps the map bounded by the number of active keys.
+		if len(m.windows) > 10000 {
+			for k, old := range m.windows {
+				if now.Sub(old.start) >= m.window {
+					delete(m.windows, k)
+				}
+			}
+		}
+		w = memoryWindow{start: now}
+	}
+	w.count++
+	m.windows[key] = w
+	return w.count <= m.limit, nil
+}
+
+// Redis is a fixed-window limiter shared across replicas.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+// NewRedis creates a Redis-backed limiter. Keys are namespaced with prefix.
+func NewRedis(client *redis.Client, prefix string, limit int, window time.Duration) *Redis {
+	return &Redis{client: client, prefix: prefix, limit: limit, window: window}
+}
+
+// Allow increments the counter of the current window (INCR + EXPIRE in one round trip).
+func (l *Redis) Allow(ctx context.Context, key string) (bool, error) {
+	bucket := time.Now().UnixNano() / int64(l.window)
+	k := l.prefix + key + ":" + strconv.FormatInt(bucket, 10)
+
+	pipe := l.client.TxPipeline()
+	incr := pipe.Incr(ctx, k)
+	pipe.Expire(ctx, k, l.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return incr.Val() <= int64(l.limit), nil
+}
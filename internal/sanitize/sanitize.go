@@ -0,0 +1,189 @@
+// Package sanitize turns untrusted HTML (stored page content) into markup that is safe to
+// embed in our pages. It works on an allowlist: known formatting tags survive with a few
+// harmless attributes, script-like elements are removed with their content, and every other
+// tag is dropped while its text is kept.
+package sanitize
+
+import (
+	"html"
+	"net/url"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedTags maps the tags that are kept to the attributes kept on them.
+var allowedTags = map[atom.Atom][]string{
+	atom.P: nil, atom.Br: nil, atom.Hr: nil, atom.Div: nil, atom.Span: nil,
+	atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Strong: nil, atom.B: nil, atom.Em: nil, atom.I: nil, atom.U: nil, atom.S: nil,
+	atom.Sub: nil, atom.Sup: nil, atom.Small: nil, atom.Mark: nil,
+	atom.Code: nil, atom.Pre: nil, atom.Blockquote: nil,
+	atom.Ul: nil, atom.Ol: nil, atom.Li: nil, atom.Dl: nil, atom.Dt: nil, atom.Dd: nil,
+	atom.Table: nil, atom.Thead: nil, atom.Tbody: nil, atom.Tr: nil,
+	atom.Th: {"colspan", "rowspan"}, atom.Td: {"colspan", "rowspan"},
+	atom.A: {"href", "title"},
+}
+
+// droppedWithContent are removed together with everything inside them.
+var droppedWithContent = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true,
+	atom.Embed: true, atom.Noscript: true, atom.Template: true, atom.Svg: true,
+	atom.Math: true, atom.Textarea: true, atom.Select: true, atom.Title: true, atom.Head: true,
+}
+
+// HTML returns the allowed subset of s. Links keep only http, https, mailto and relative
+// targets and get rel="nofollow noopener". Unclosed tags are closed at the end, so the
+// result cannot break the surrounding markup.
+func HTML(s string) string {
+	var (
+		b     strings.Builder
+		open  []atom.Atom // allowed elements currently open, innermost last
+		skip  int         // depth inside a droppedWithContent element
+		z     = xhtml.NewTokenizer(strings.NewReader(s))
+		depth = map[atom.Atom]int{}
+	)
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		tok := z.Token()
+		switch tt {
+		case xhtml.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(tok.Data))
+			}
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			if droppedWithContent[tok.DataAtom] {
+				if tt == xhtml.StartTagToken {
+					skip++
+					depth[tok.DataAtom]++
+				}
+				continue
+			}
+			attrs, ok := allowedTags[tok.DataAtom]
+			if !ok || skip > 0 {
+				continue
+			}
+			writeStartTag(&b, tok, attrs)
+			if !isVoid(tok.DataAtom) && tt == xhtml.StartTagToken {
+				open = append(open, tok.DataAtom)
+			}
+		case xhtml.EndTagToken:
+			if droppedWithContent[tok.DataAtom] {
+				if depth[tok.DataAtom] > 0 {
+					depth[tok.DataAtom]--
+					skip--
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			// Close up to the matching open element; a stray end tag is dropped.
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != tok.DataAtom {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j].String() + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+		// Comments and doctypes are dropped.
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i].String() + ">")
+	}
+	return b.String()
+}
+
+// Paragraphs renders plain text as HTML: blank lines separate paragraphs and single line
+// breaks become <br>.
+func Paragraphs(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "\r\n", "\n")
+	var b strings.Builder
+	for _, para := range strings.Split(s, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		lines := strings.Split(para, "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(strings.TrimSpace(line))
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>") + "</p>")
+	}
+	return b.String()
+}
+
+// Content renders stored content: markup is sanitized, plain text is split into paragraphs.
+func Content(s string) string {
+	if looksLikeHTML(s) {
+		return HTML(s)
+	}
+	return Paragraphs(s)
+}
+
+// looksLikeHTML reports whether s contains something shaped like a tag.
+func looksLikeHTML(s string) bool {
+	for i := strings.IndexByte(s, '<'); i >= 0 && i+1 < len(s); {
+		c := s[i+1]
+		if c == '/' || c == '!' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+			return true
+		}
+		next := strings.IndexByte(s[i+1:], '<')
+		if next < 0 {
+			break
+		}
+		i += 1 + next
+	}
+	return false
+}
+
+func writeStartTag(b *strings.Builder, tok xhtml.Token, allowed []string) {
+	b.WriteString("<" + tok.DataAtom.String())
+	for _, a := range tok.Attr {
+		if a.Namespace != "" || !contains(allowed, a.Key) {
+			continue
+		}
+		if a.Key == "href" && !safeURL(a.Val) {
+			continue
+		}
+		b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+	}
+	if tok.DataAtom == atom.A {
+		b.WriteString(` rel="nofollow noopener"`)
+	}
+	b.WriteString(">")
+}
+
+// safeURL allows relative URLs and the http, https and mailto schemes.
+func safeURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+func isVoid(a atom.Atom) bool {
+	return a == atom.Br || a == atom.Hr
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
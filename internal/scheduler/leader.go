@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+
+	"devops-valgfag/internal/lock"
+)
+
+// LeaderLockID is the advisory lock key for scheduler leadership (the migration lock is 8675309).
+const LeaderLockID int64 = 8675310
+
+// AdvisoryLockElector elects a leader by holding a Postgres advisory lock (see internal/lock).
+//
+// The lock stays held for as long as this replica leads; if its connection dies, Postgres
+// releases the lock and another replica takes over on its next check.
+type AdvisoryLockElector struct {
+	db  *sql.DB
+	key int64
+
+	mu   sync.Mutex
+	held *lock.Lock
+}
+
+// NewAdvisoryLockElector creates an elector for the given advisory lock key.
+func NewAdvisoryLockElector(db *sql.DB, key int64) *AdvisoryLockElector {
+	return &AdvisoryLockElector{db: db, key: key}
+}
+
+// IsLeader reports whether this replica holds the lock, trying to acquire it if not.
+func (e *AdvisoryLockElector) IsLeader(ctx context.Context) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.held != nil {
+		if e.held.Held(ctx) {
+			return true
+		}
+		log.Println("scheduler: lost leader connection")
+		_ = e.held.Release()
+		e.held = nil
+	}
+
+	l, err := lock.TryAcquire(ctx, e.db, e.key)
+	if err != nil {
+		if !errors.Is(err, lock.ErrNotAcquired) {
+			log.Println("scheduler: leader election error:", err)
+		}
+		return false
+	}
+	log.Println("scheduler: this replica is now the leader")
+	e.held = l
+	return true
+}
+
+// Close releases leadership (if held).
+func (e *AdvisoryLockElector) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.held != nil {
+		_ = e.held.Release()
+		e.held = nil
+	}
+}
@@ -0,0 +1,249 @@
+// Package scheduler runs registered periodic tasks inside the server process.
+//
+// Each task runs on its own interval (plus random jitter so replicas and tasks don't fire in
+// lockstep). A run that is still in progress when the next one is due is skipped, not stacked.
+// Cluster-wide tasks only run on the elected leader; Local tasks refresh in-process state
+// (e.g. caches) and run on every replica.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+)
+
+// Task is a periodic job.
+type Task struct {
+	Name       string
+	Interval   time.Duration
+	Jitter     time.Duration // max random delay added to every wait (default Interval/10, negative = none)
+	RunAtStart bool          // run once right away instead of after the first interval
+	Local      bool          // runs on every replica (in-process state), regardless of leadership
+	Run        func(ctx context.Context) error
+}
+
+// TaskStatus is the last-run bookkeeping for one task.
+type TaskStatus struct {
+	Name         string    `json:"name"`
+	Interval     string    `json:"interval"`
+	Local        bool      `json:"local"`
+	Running      bool      `json:"running"`
+	Runs         int       `json:"runs"`
+	Failures     int       `json:"failures"`
+	Skipped      int       `json:"skipped"` // due while the previous run was still going
+	LastStart    time.Time `json:"last_start,omitzero"`
+	LastDuration string    `json:"last_duration,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	NextRun      time.Time `json:"next_run,omitzero"`
+}
+
+// Elector decides whether this replica is the leader for cluster-wide tasks.
+type Elector interface {
+	IsLeader(ctx context.Context) bool
+}
+
+// Options configure a Scheduler.
+type Options struct {
+	// Enabled=false keeps cluster-wide tasks off on this replica (SCHEDULER_ENABLED=0); Local tasks still run.
+	Enabled bool
+	// Elector picks one leader among enabled replicas. Nil means this replica always leads.
+	Elector Elector
+}
+
+type taskState struct {
+	task   Task
+	mu     sync.Mutex
+	status TaskStatus
+}
+
+// Scheduler owns the registered tasks and their status.
+type Scheduler struct {
+	opts  Options
+	mu    sync.Mutex
+	tasks []*taskState
+}
+
+// New creates an empty scheduler.
+func New(opts Options) *Scheduler {
+	return &Scheduler{opts: opts}
+}
+
+// Add registers a task. Call before Run.
+func (s *Scheduler) Add(t Task) {
+	if t.Jitter == 0 {
+		t.Jitter = t.Interval / 10
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, &taskState{task: t, status: TaskStatus{
+		Name:     t.Name,
+		Interval: t.Interval.String(),
+		Local:    t.Local,
+	}})
+}
+
+// Enabled reports whether cluster-wide tasks may run on this replica.
+func (s *Scheduler) Enabled() bool {
+	return s.opts.Enabled
+}
+
+// Run starts one loop per task and blocks until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	tasks := append([]*taskState(nil), s.tasks...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, ts := range tasks {
+		if !ts.task.Local && !s.opts.Enabled {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, ts)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, ts *taskState) {
+	wait := ts.task.Interval
+	if ts.task.RunAtStart {
+		wait = 0
+	}
+	for {
+		wait += jitter(ts.task.Jitter)
+		ts.mu.Lock()
+		ts.status.NextRun = time.Now().Add(wait).UTC()
+		ts.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = ts.task.Interval
+
+		if !ts.task.Local && !s.isLeader(ctx) {
+			metrics.SchedulerTaskRuns.WithLabelValues(ts.task.Name, "not_leader").Inc()
+			continue
+		}
+		if !s.start(ts) {
+			metrics.SchedulerTaskRuns.WithLabelValues(ts.task.Name, "skipped").Inc()
+			continue
+		}
+		// Runs in the background so a slow run shows up as skipped ticks rather than drift.
+		go func() { _ = s.execute(ctx, ts) }()
+	}
+}
+
+func (s *Scheduler) isLeader(ctx context.Context) bool {
+	if s.opts.Elector == nil {
+		return true
+	}
+	return s.opts.Elector.IsLeader(ctx)
+}
+
+// start marks the task running; false means the previous run has not finished.
+func (s *Scheduler) start(ts *taskState) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.status.Running {
+		ts.status.Skipped++
+		return false
+	}
+	ts.status.Running = true
+	ts.status.LastStart = time.Now().UTC()
+	return true
+}
+
+func (s *Scheduler) execute(ctx context.Context, ts *taskState) error {
+	start := time.Now()
+	err := safeRun(ctx, ts.task.Run)
+	elapsed := time.Since(start)
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("scheduler: task %s failed: %v", ts.task.Name, err)
+		}
+	}
+	metrics.SchedulerTaskRuns.WithLabelValues(ts.task.Name, result).Inc()
+	metrics.SchedulerTaskDuration.WithLabelValues(ts.task.Name).Observe(elapsed.Seconds())
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.status.Running = false
+	ts.status.Runs++
+	ts.status.LastDuration = elapsed.Round(time.Millisecond).String()
+	ts.status.LastError = ""
+	if err != nil {
+		ts.status.Failures++
+		ts.status.LastError = err.Error()
+	}
+	return err
+}
+
+// RunNow runs a task synchronously (e.g. from an admin endpoint or a test).
+// It returns false when the task is unknown or already running.
+func (s *Scheduler) RunNow(ctx context.Context, name string) (bool, error) {
+	s.mu.Lock()
+	var ts *taskState
+	for _, t := range s.tasks {
+		if t.task.Name == name {
+			ts = t
+		}
+	}
+	s.mu.Unlock()
+
+	if ts == nil || !s.start(ts) {
+		return false, nil
+	}
+	return true, s.execute(ctx, ts)
+}
+
+// Status returns a snapshot of every task's last-run status, sorted by name.
+func (s *Scheduler) Status() []TaskStatus {
+	s.mu.Lock()
+	tasks := append([]*taskState(nil), s.tasks...)
+	s.mu.Unlock()
+
+	out := make([]TaskStatus, 0, len(tasks))
+	for _, ts := range tasks {
+		ts.mu.Lock()
+		out = append(out, ts.status)
+		ts.mu.Unlock()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// IsLeader reports whether this replica currently runs cluster-wide tasks.
+func (s *Scheduler) IsLeader(ctx context.Context) bool {
+	return s.opts.Enabled && s.isLeader(ctx)
+}
+
+func safeRun(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = errors.New("panic in scheduled task")
+			log.Printf("scheduler: recovered panic: %v", rec)
+		}
+	}()
+	return fn(ctx)
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
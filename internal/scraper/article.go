@@ -0,0 +1,128 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"devops-valgfag/internal/urlcheck"
+)
+
+// Article is the plain text of a Wikipedia article.
+type Article struct {
+	Title    string
+	URL      string // the URL it was fetched for
+	Language string // the wiki's language code, e.g. "en" for en.wikipedia.org
+	Text     string
+}
+
+// ErrNotWikipedia is returned by WikipediaArticle for URLs that are not Wikipedia articles.
+var ErrNotWikipedia = errors.New("not a Wikipedia article URL")
+
+// wikipediaAPI is the API endpoint for a wiki language; SetWikipediaAPI overrides it (tests).
+var wikipediaAPI = defaultWikipediaAPI
+
+// defaultWikipediaAPI is the wiki of lang, or WIKIPEDIA_API_URL for every language when set
+// (read on every fetch, like DMI_API_URL), e.g. to point a test deployment at a mock.
+func defaultWikipediaAPI(lang string) string {
+	if endpoint := strings.TrimSpace(os.Getenv("WIKIPEDIA_API_URL")); endpoint != "" {
+		return endpoint
+	}
+	return wikiAPI(lang)
+}
+
+// wikiAPI is the API endpoint on the wiki of lang itself.
+func wikiAPI(lang string) string {
+	return "https://" + lang + ".wikipedia.org/w/api.php"
+}
+
+// SetWikipediaAPI makes WikipediaSearch and WikipediaArticle use endpoint for every language
+// ("" restores the default). It is meant for tests and must not race with fetches.
+func SetWikipediaAPI(endpoint string) {
+	if endpoint == "" {
+		wikipediaAPI = defaultWikipediaAPI
+		return
+	}
+	wikipediaAPI = func(string) string { return endpoint }
+}
+
+type extractResponse struct {
+	Query struct {
+		Pages map[string]struct {
+			Title   string  `json:"title"`
+			Extract string  `json:"extract"`
+			Missing *string `json:"missing"`
+		} `json:"pages"`
+	} `json:"query"`
+}
+
+// WikipediaArticle fetches the full plain text of the article at pageURL, which is either a
+// ?curid= URL (as stored by WikipediaSearch) or a /wiki/<Title> URL.
+func WikipediaArticle(ctx context.Context, pageURL string) (Article, error) {
+	u, err := urlcheck.Parse(pageURL)
+	if err != nil {
+		return Article{}, fmt.Errorf("%w: %v", ErrNotWikipedia, err)
+	}
+	host := strings.ToLower(u.Hostname())
+	lang, ok := strings.CutSuffix(host, ".wikipedia.org")
+	if !ok || lang == "" || strings.Contains(lang, ".") {
+		return Article{}, ErrNotWikipedia
+	}
+
+	q := url.Values{}
+	q.Set("action", "query")
+	q.Set("prop", "extracts")
+	q.Set("explaintext", "1")
+	q.Set("redirects", "1")
+	q.Set("format", "json")
+	switch {
+	case u.Query().Get("curid") != "":
+		q.Set("pageids", u.Query().Get("curid"))
+	case strings.HasPrefix(u.Path, "/wiki/") && len(u.Path) > len("/wiki/"):
+		q.Set("titles", strings.ReplaceAll(strings.TrimPrefix(u.Path, "/wiki/"), "_", " "))
+	default:
+		return Article{}, ErrNotWikipedia
+	}
+
+	endpoint := wikipediaAPI(lang)
+	// The host of the wiki comes from pageURL, so unless the endpoint is configured the
+	// request goes through the untrusted client, which only connects to public addresses.
+	client := articleClient
+	if endpoint == wikiAPI(lang) {
+		client = wikiClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return Article{}, err
+	}
+	setUserAgent(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Article{}, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return Article{}, fmt.Errorf("wikipedia API returned status %d", resp.StatusCode)
+	}
+
+	var data extractResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return Article{}, err
+	}
+	for _, p := range data.Query.Pages {
+		text := strings.TrimSpace(p.Extract)
+		if p.Missing != nil || text == "" {
+			break
+		}
+		return Article{Title: p.Title, URL: pageURL, Language: lang, Text: text}, nil
+	}
+	return Article{}, fmt.Errorf("wikipedia article %s has no text", pageURL)
+}
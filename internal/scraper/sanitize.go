@@ -0,0 +1,33 @@
+package scraper
+
+import (
+	"html"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Wikipedia search snippets are HTML: the matched words are wrapped in
+// <span class="searchmatch">, and entities are already escaped. Snippets are cleaned
+// with these policies before they are stored or shown.
+
+// snippetPolicy keeps only the search highlight markup; everything else is reduced to text.
+// bluemonday policies are safe for concurrent use once built.
+var snippetPolicy = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^searchmatch$`)).OnElements("span")
+	return p
+}()
+
+// textPolicy removes all markup.
+var textPolicy = bluemonday.StrictPolicy()
+
+// SanitizeSnippet returns s as safe HTML in which only <span class="searchmatch"> survives.
+func SanitizeSnippet(s string) string {
+	return snippetPolicy.Sanitize(s)
+}
+
+// SnippetText returns the plain text of a snippet: no markup, entities decoded.
+func SnippetText(s string) string {
+	return html.UnescapeString(textPolicy.Sanitize(s))
+}
@@ -8,8 +8,37 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"devops-valgfag/internal/httpclient"
 )
 
+// HTTPDoer is the part of *http.Client the scraper needs. SetHTTPClient swaps it, so tests
+// can answer requests without reaching Wikipedia.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+var (
+	searchClient  HTTPDoer = httpclient.New("wikipedia", 5*time.Second)
+	articleClient HTTPDoer = httpclient.New("wikipedia", 10*time.Second)
+	// wikiClient fetches articles from the wiki named by the article URL's host, which comes
+	// from outside (cached external results, the admin promote API).
+	wikiClient HTTPDoer = httpclient.NewUntrusted("wikipedia", 10*time.Second)
+)
+
+// SetHTTPClient sends the requests of WikipediaSearch and WikipediaArticle through c (nil
+// restores the default clients, with 5 s and 10 s timeouts). It is meant for tests and must
+// not race with fetches.
+func SetHTTPClient(c HTTPDoer) {
+	if c == nil {
+		searchClient = httpclient.New("wikipedia", 5*time.Second)
+		articleClient = httpclient.New("wikipedia", 10*time.Second)
+		wikiClient = httpclient.NewUntrusted("wikipedia", 10*time.Second)
+		return
+	}
+	searchClient, articleClient, wikiClient = c, c, c
+}
+
 type ScrapedResult struct {
 	Title   string
 	URL     string
@@ -28,7 +57,7 @@ type wikiResponse struct {
 
 // WikipediaSearch queries the Wikipedia API for a search term.
 func WikipediaSearch(query string, limit int) ([]ScrapedResult, error) {
-	endpoint := "https://en.wikipedia.org/w/api.php"
+	endpoint := wikipediaAPI("en")
 
 	// Validate limit parameter
 	if limit <= 0 {
@@ -50,18 +79,9 @@ func WikipediaSearch(query string, limit int) ([]ScrapedResult, error) {
 	q.Add("srlimit", fmt.Sprintf("%d", limit))
 	req.URL.RawQuery = q.Encode()
 
-	ua := strings.TrimSpace(os.Getenv("WIKI_USER_AGENT"))
-	if ua == "" {
-		ua = "WhoKnowsBot/1.0 (+https://github.com/GitDenGas123456/DevOps-Valgfag)"
-	}
-	req.Header.Set("User-Agent", ua)
-
-	// Use a client with timeout instead of http.DefaultClient
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
+	setUserAgent(req)
 
-	resp, err := client.Do(req)
+	resp, err := searchClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +103,7 @@ func WikipediaSearch(query string, limit int) ([]ScrapedResult, error) {
 		results = append(results, ScrapedResult{
 			Title:   r.Title,
 			URL:     fmt.Sprintf("https://en.wikipedia.org/?curid=%d", r.PageID),
-			Snippet: r.Snippet, // html/template escapes on render
+			Snippet: SanitizeSnippet(r.Snippet), // highlight markup only
 		})
 	}
 
@@ -92,3 +112,11 @@ func WikipediaSearch(query string, limit int) ([]ScrapedResult, error) {
 
 	return results, nil
 }
+
+// setUserAgent sets WIKI_USER_AGENT on req, if configured; otherwise the client sends the
+// egress policy's User-Agent (httpclient.DefaultUserAgent).
+func setUserAgent(req *http.Request) {
+	if ua := strings.TrimSpace(os.Getenv("WIKI_USER_AGENT")); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+}
@@ -0,0 +1,83 @@
+// Package searchmerge combines local search results with external (enrichment) results.
+//
+// Appending external results after local ones hides them whenever local results fill the
+// limit. A Policy guarantees external results a quota of slots and decides the order: after
+// the local ones, alternating with them, or by a weighted reciprocal-rank score.
+package searchmerge
+
+import "fmt"
+
+// Strategy is how local and external results are ordered.
+type Strategy string
+
+const (
+	Append     Strategy = "append"     // local results, then external ones
+	Interleave Strategy = "interleave" // alternate local and external, local first
+	Score      Strategy = "score"      // by reciprocal rank, external results weighted down
+)
+
+// ExternalWeight scales the reciprocal rank of external results under Score: the top
+// external result ties with the second local one (and ties go to local results).
+const ExternalWeight = 0.5
+
+// ParseStrategy validates a strategy name.
+func ParseStrategy(s string) (Strategy, error) {
+	switch st := Strategy(s); st {
+	case Append, Interleave, Score:
+		return st, nil
+	}
+	return "", fmt.Errorf("searchmerge: unknown strategy %q (want append, interleave or score)", s)
+}
+
+// Policy configures Merge. The zero value appends external results to the slots local
+// results leave free.
+type Policy struct {
+	Strategy Strategy
+	// ExternalQuota is the number of slots external results get even when there are
+	// enough local results to fill the limit.
+	ExternalQuota int
+}
+
+// WantsExternal reports whether external results can show up next to nLocal local results,
+// so callers can skip fetching them.
+func (p Policy) WantsExternal(nLocal, limit int) bool {
+	return nLocal < limit || p.ExternalQuota > 0
+}
+
+// Merge returns at most limit results. External results get the slots local results leave
+// free and at least min(ExternalQuota, limit) if they have that many; both lists keep their
+// own order.
+func Merge[T any](p Policy, local, external []T, limit int) []T {
+	limit = max(limit, 0)
+	nExt := min(len(external), max(min(p.ExternalQuota, limit), limit-len(local)))
+	nLocal := min(len(local), limit-nExt)
+	local, external = local[:nLocal], external[:nExt]
+
+	out := make([]T, 0, nLocal+nExt)
+	switch p.Strategy {
+	case Interleave:
+		for i := 0; i < max(nLocal, nExt); i++ {
+			if i < nLocal {
+				out = append(out, local[i])
+			}
+			if i < nExt {
+				out = append(out, external[i])
+			}
+		}
+	case Score:
+		// Local result i scores 1/(i+1), external result j ExternalWeight/(j+1).
+		i, j := 0, 0
+		for i < nLocal || j < nExt {
+			if j == nExt || (i < nLocal && 1/float64(i+1) >= ExternalWeight/float64(j+1)) {
+				out = append(out, local[i])
+				i++
+				continue
+			}
+			out = append(out, external[j])
+			j++
+		}
+	default:
+		out = append(append(out, local...), external...)
+	}
+	return out
+}
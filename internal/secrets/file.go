@@ -0,0 +1,31 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Files reads <KEY>_FILE: the path of a file holding the value of KEY, as mounted by Docker
+// secrets (/run/secrets/...) or a Kubernetes secret volume. A trailing newline is dropped.
+type Files struct{}
+
+func (Files) Name() string { return "file" }
+
+// Lookup reads the file named by key+"_FILE", if set.
+func (Files) Lookup(_ context.Context, key string) (string, bool, error) {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", false, fmt.Errorf("%s is empty", path)
+	}
+	return value, true, nil
+}
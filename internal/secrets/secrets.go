@@ -0,0 +1,69 @@
+// Package secrets fills secret settings (SESSION_KEY, POSTGRES_PASSWORD, ...) from outside the
+// environment: files mounted by Docker or Kubernetes (SESSION_KEY_FILE=/run/secrets/session_key)
+// and, optionally, HashiCorp Vault. Resolved values are exported as the plain environment
+// variables, so the rest of the app keeps reading os.Getenv.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Keys are the settings that may be provided as secrets.
+var Keys = []string{
+	"SESSION_KEY",
+	"SESSION_ENC_KEY",
+	"SESSION_KEY_PREVIOUS",
+	"SESSION_ENC_KEY_PREVIOUS",
+	"POSTGRES_PASSWORD",
+	"DATABASE_URL",
+	"DATABASE_URL_RO",
+	"REDIS_URL",
+	"DMI_API_KEY",
+	"SMTP_PASSWORD",
+	"S3_ACCESS_KEY_ID",
+	"S3_SECRET_ACCESS_KEY",
+	"SENTRY_DSN",
+	"METRICS_SUMMARY_TOKEN",
+	"CAPTCHA_SECRET",
+}
+
+// Provider looks up secret values by setting name.
+type Provider interface {
+	// Name identifies the provider in logs ("file", "vault").
+	Name() string
+	// Lookup returns the value of key; ok is false when the provider does not have it.
+	Lookup(ctx context.Context, key string) (value string, ok bool, err error)
+}
+
+// Apply resolves each of keys that is not set in the environment from the first provider
+// that has it and sets it. It returns the provider name per key it set. Any provider error
+// is returned: a secret that is configured but unreadable must stop startup. Setting both
+// KEY and KEY_FILE is an error too, since it is unclear which one is meant.
+func Apply(ctx context.Context, keys []string, providers ...Provider) (map[string]string, error) {
+	applied := map[string]string{}
+	for _, key := range keys {
+		if os.Getenv(key) != "" {
+			if os.Getenv(key+"_FILE") != "" {
+				return nil, fmt.Errorf("secrets: both %s and %s_FILE are set", key, key)
+			}
+			continue
+		}
+		for _, p := range providers {
+			value, ok, err := p.Lookup(ctx, key)
+			if err != nil {
+				return nil, fmt.Errorf("secrets: %s from %s: %w", key, p.Name(), err)
+			}
+			if !ok {
+				continue
+			}
+			if err := os.Setenv(key, value); err != nil {
+				return nil, err
+			}
+			applied[key] = p.Name()
+			break
+		}
+	}
+	return applied, nil
+}
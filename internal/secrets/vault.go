@@ -0,0 +1,94 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Vault reads secrets from one HashiCorp Vault KV secret (version 1 or 2), e.g. path
+// "secret/data/whoknows" holding SESSION_KEY, POSTGRES_PASSWORD, ... Field names match the
+// setting name, or its lowercase form. The secret is fetched once, on the first lookup.
+type Vault struct {
+	addr   string
+	token  string
+	path   string
+	client *http.Client
+
+	once sync.Once
+	data map[string]string
+	err  error
+}
+
+// NewVault returns a provider for the secret at path on the Vault server at addr
+// (VAULT_ADDR), authenticating with token (VAULT_TOKEN). client may be nil.
+func NewVault(addr, token, path string, client *http.Client) *Vault {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Vault{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		path:   strings.Trim(path, "/"),
+		client: client,
+	}
+}
+
+func (v *Vault) Name() string { return "vault" }
+
+// Lookup returns key from the secret; a failed fetch is returned for every lookup.
+func (v *Vault) Lookup(ctx context.Context, key string) (string, bool, error) {
+	v.once.Do(func() { v.data, v.err = v.fetch(ctx) })
+	if v.err != nil {
+		return "", false, v.err
+	}
+	if value, ok := v.data[key]; ok {
+		return value, true, nil
+	}
+	value, ok := v.data[strings.ToLower(key)]
+	return value, ok, nil
+}
+
+// fetch reads the secret. KV v2 nests the fields in data.data, KV v1 returns them in data.
+func (v *Vault) fetch(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+v.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", v.path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("GET %s: %w", v.path, err)
+	}
+	fields := body.Data
+	if nested, ok := body.Data["data"]; ok {
+		var kv2 map[string]json.RawMessage
+		if err := json.Unmarshal(nested, &kv2); err == nil {
+			fields = kv2
+		}
+	}
+
+	out := make(map[string]string, len(fields))
+	for name, raw := range fields {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			continue // not a string field (e.g. KV v2 metadata)
+		}
+		out[name] = s
+	}
+	return out, nil
+}
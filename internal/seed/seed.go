@@ -0,0 +1,219 @@
+// Package seed fills a database with generated data: pages in English and Danish, demo users
+// and cached external results. It is the engine behind cmd/seed, for local development, demos
+// and benchmark-sized datasets, and runs on PostgreSQL and SQLite.
+//
+// The data is deterministic for a given Seed. Rows that already exist (same page URL,
+// username or cached result) are skipped, so seeding can be re-run, or re-run with larger
+// counts to top a database up.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultPassword is the password of the demo users unless Options.Password is set.
+const DefaultPassword = "demo-password"
+
+// Options configure Run. A zero count seeds nothing for that table.
+type Options struct {
+	Pages     int      // pages, spread over Languages
+	Languages []string // page languages, "en" and/or "da" (default both)
+	Users     int      // demo users demo1..demoN; demo1 is an admin
+	Password  string   // password of the demo users (default DefaultPassword)
+	External  int      // cached external results
+	Tenant    int      // tenant of the pages and external results (default 1)
+	Seed      int64    // random seed; the same seed yields the same data
+	// BatchSize is the number of rows per transaction and between Progress calls (default 500).
+	BatchSize int
+	// Progress, if set, is called after every batch.
+	Progress func(table string, done, total int)
+}
+
+func (o Options) withDefaults() Options {
+	if len(o.Languages) == 0 {
+		o.Languages = []string{"en", "da"}
+	}
+	if o.Password == "" {
+		o.Password = DefaultPassword
+	}
+	if o.Tenant <= 0 {
+		o.Tenant = 1
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 500
+	}
+	return o
+}
+
+// Report counts what happened to one table.
+type Report struct {
+	Table    string
+	Inserted int
+	Skipped  int // rows that already existed
+}
+
+// table is one kind of generated row.
+type table struct {
+	name   string
+	insert string
+	count  func(Options) int
+	// rows generates the insert arguments of every row.
+	rows func(opts Options) ([][]any, error)
+}
+
+var tables = []table{
+	{
+		name: "users",
+		insert: `INSERT INTO users (username, email, password, is_admin, status)
+VALUES ($1, $2, $3, $4, 'active')
+ON CONFLICT DO NOTHING`,
+		count: func(o Options) int { return o.Users },
+		rows:  userRows,
+	},
+	{
+		name: "pages",
+		insert: `INSERT INTO pages (tenant_id, title, url, language, last_updated, content)
+VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, $5)
+ON CONFLICT DO NOTHING`,
+		count: func(o Options) int { return o.Pages },
+		rows:  pageRows,
+	},
+	{
+		name: "external_results",
+		insert: `INSERT INTO external_results (tenant_id, query, language, title, url, snippet)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT DO NOTHING`,
+		count: func(o Options) int { return o.External },
+		rows:  externalRows,
+	},
+}
+
+// Run seeds db, which must already be migrated, and reports per table. On error the reports
+// cover the tables done so far.
+func Run(ctx context.Context, db *sql.DB, opts Options) ([]Report, error) {
+	opts = opts.withDefaults()
+	for _, lang := range opts.Languages {
+		if _, ok := vocabs[lang]; !ok {
+			return nil, fmt.Errorf("seed: unsupported language %q (want en or da)", lang)
+		}
+	}
+
+	var reports []Report
+	for _, t := range tables {
+		if t.count(opts) <= 0 {
+			continue
+		}
+		rows, err := t.rows(opts)
+		if err != nil {
+			return reports, fmt.Errorf("%s: %w", t.name, err)
+		}
+		r, err := insertRows(ctx, db, t, rows, opts)
+		reports = append(reports, r)
+		if err != nil {
+			return reports, fmt.Errorf("%s: %w", t.name, err)
+		}
+	}
+	return reports, nil
+}
+
+// insertRows writes rows in transactions of opts.BatchSize.
+func insertRows(ctx context.Context, db *sql.DB, t table, rows [][]any, opts Options) (Report, error) {
+	r := Report{Table: t.name}
+	for start := 0; start < len(rows); start += opts.BatchSize {
+		batch := rows[start:min(start+opts.BatchSize, len(rows))]
+		inserted, err := insertBatch(ctx, db, t.insert, batch)
+		if err != nil {
+			return r, fmt.Errorf("rows %d-%d: %w", start, start+len(batch)-1, err)
+		}
+		r.Inserted += inserted
+		r.Skipped += len(batch) - inserted
+		if opts.Progress != nil {
+			opts.Progress(t.name, start+len(batch), len(rows))
+		}
+	}
+	return r, nil
+}
+
+func insertBatch(ctx context.Context, db *sql.DB, insert string, batch [][]any) (inserted int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, insert)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, args := range batch {
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			inserted += int(n)
+		}
+	}
+	return inserted, tx.Commit()
+}
+
+// userRows returns demo1..demoN, all with opts.Password (hashed once) and demo1 an admin.
+func userRows(opts Options) ([][]any, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("bcrypt.GenerateFromPassword: %w", err)
+	}
+	rows := make([][]any, opts.Users)
+	for i := range rows {
+		name := fmt.Sprintf("demo%d", i+1)
+		rows[i] = []any{name, name + "@example.com", string(hash), i == 0}
+	}
+	return rows, nil
+}
+
+// pageRows returns opts.Pages pages with URLs /seed/<language>/<n>, the languages taking turns.
+// Titles are made unique per tenant, as the schema requires, by numbering repeats.
+func pageRows(opts Options) ([][]any, error) {
+	r := rand.New(rand.NewSource(opts.Seed))
+	seen := map[string]int{}
+	rows := make([][]any, opts.Pages)
+	for i := range rows {
+		lang := opts.Languages[i%len(opts.Languages)]
+		v := vocabs[lang]
+		topic, title := v.title(r)
+		if seen[title]++; seen[title] > 1 {
+			title = fmt.Sprintf("%s (%d)", title, seen[title])
+		}
+		rows[i] = []any{opts.Tenant, title, fmt.Sprintf("/seed/%s/%d", lang, i+1), lang, v.content(r, topic)}
+	}
+	return rows, nil
+}
+
+// externalRows returns cached Wikipedia-style results: a few per topic, for the topic as query.
+func externalRows(opts Options) ([][]any, error) {
+	r := rand.New(rand.NewSource(opts.Seed + 1))
+	rows := make([][]any, opts.External)
+	for i := range rows {
+		lang := opts.Languages[i%len(opts.Languages)]
+		v := vocabs[lang]
+		n := i / len(opts.Languages)
+		topic := v.topics[n%len(v.topics)]
+		aspect := v.aspects[(n/len(v.topics))%len(v.aspects)]
+		title := topic + " (" + aspect + ")"
+		url := fmt.Sprintf("https://%s.wikipedia.org/wiki/%s", lang, strings.ReplaceAll(title, " ", "_"))
+		rows[i] = []any{opts.Tenant, strings.ToLower(topic), lang, title, url, v.sentence(r, topic)}
+	}
+	return rows, nil
+}
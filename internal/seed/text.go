@@ -0,0 +1,88 @@
+package seed
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// vocab is the word pool of one language for generated titles and prose.
+type vocab struct {
+	topics     []string // title subjects and search terms
+	aspects    []string // second half of titles
+	subjects   []string
+	verbs      []string
+	objects    []string
+	adverbials []string
+	titleJoin  string // joins topic and aspect in a title
+}
+
+// vocabs holds the supported page languages. Danish includes æ, ø and å, so seeded data
+// exercises accent-insensitive search.
+var vocabs = map[string]vocab{
+	"en": {
+		topics: strings.Fields(`Kubernetes Docker PostgreSQL Redis Linux Prometheus Grafana Go Python Rust
+			JavaScript GraphQL Copenhagen Denmark Europe Wikipedia Climate Football Jazz Photography
+			Astronomy Bicycles Coffee Chess Volcanoes Glaciers Typography Encryption Firewalls Compilers`),
+		aspects: []string{"history", "basics", "in practice", "for beginners", "performance",
+			"common mistakes", "best practices", "internals", "a short guide", "frequently asked questions"},
+		subjects: []string{"The project", "Most teams", "A small cluster", "The community", "Every release",
+			"The default setup", "An experienced operator", "The documentation", "A typical workload", "The scheduler"},
+		verbs: []string{"depends on", "improves", "replaces", "documents", "monitors", "simplifies",
+			"stores", "describes", "protects", "measures"},
+		objects: []string{"the configuration", "every request", "the network layer", "old backups",
+			"the search index", "user sessions", "the build pipeline", "local caches", "the data model", "long-running jobs"},
+		adverbials: []string{"in production", "during the night", "without downtime", "on every commit",
+			"across regions", "with little effort", "in most cases", "since version two", "behind a proxy", "at scale"},
+		titleJoin: ": ",
+	},
+	"da": {
+		topics: strings.Fields(`Kubernetes Docker PostgreSQL København Aarhus Ærø Bornholm Fjorde Øresund
+			Smørrebrød Rugbrød Æbleskiver Cykler Vikinger Fodbold Jazz Fotografi Astronomi Kaffe Skak
+			Gletsjere Klima Vindmøller Søer Skove Grønland Færøerne Strande Højskoler Biblioteker`),
+		aspects: []string{"historie", "grundbegreber", "i praksis", "for begyndere", "ydeevne",
+			"typiske fejl", "gode råd", "bag om", "en kort guide", "ofte stillede spørgsmål"},
+		subjects: []string{"Projektet", "De fleste hold", "En lille klynge", "Fællesskabet", "Hver udgivelse",
+			"Standardopsætningen", "En erfaren driftsperson", "Dokumentationen", "Et typisk arbejde", "Planlæggeren"},
+		verbs: []string{"afhænger af", "forbedrer", "erstatter", "beskriver", "overvåger", "forenkler",
+			"gemmer", "dokumenterer", "beskytter", "måler"},
+		objects: []string{"konfigurationen", "hver forespørgsel", "netværkslaget", "gamle backups",
+			"søgeindekset", "brugernes sessioner", "byggeprocessen", "lokale caches", "datamodellen", "lange kørsler"},
+		adverbials: []string{"i drift", "om natten", "uden nedetid", "ved hvert commit",
+			"på tværs af regioner", "med lille indsats", "i de fleste tilfælde", "siden version to", "bag en proxy", "i stor skala"},
+		titleJoin: " – ",
+	},
+}
+
+func pick(r *rand.Rand, words []string) string {
+	return words[r.Intn(len(words))]
+}
+
+// title returns a page title such as "Kubernetes: best practices".
+func (v vocab) title(r *rand.Rand) (topic, title string) {
+	topic = pick(r, v.topics)
+	return topic, topic + v.titleJoin + pick(r, v.aspects)
+}
+
+// sentence returns one sentence, mentioning topic with a fixed probability so pages match
+// searches for their title.
+func (v vocab) sentence(r *rand.Rand, topic string) string {
+	subject := pick(r, v.subjects)
+	if r.Intn(3) == 0 {
+		subject = topic
+	}
+	return subject + " " + pick(r, v.verbs) + " " + pick(r, v.objects) + " " + pick(r, v.adverbials) + "."
+}
+
+// content returns paragraphs of prose about topic, separated by blank lines as page content is
+// stored (see sanitize.Paragraphs).
+func (v vocab) content(r *rand.Rand, topic string) string {
+	paragraphs := make([]string, 2+r.Intn(3))
+	for i := range paragraphs {
+		sentences := make([]string, 3+r.Intn(4))
+		for j := range sentences {
+			sentences[j] = v.sentence(r, topic)
+		}
+		paragraphs[i] = strings.Join(sentences, " ")
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/apperror"
+	"devops-valgfag/internal/legacyhash"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account states (users.status). Only active accounts can log in.
+const (
+	UserStatusPending  = "pending"
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusBanned   = "banned"
+)
+
+// User is an account as the auth service sees it.
+type User struct {
+	ID                int
+	Username          string
+	Email             string
+	PasswordHash      string // bcrypt, or a legacy MD5 digest wrapped in bcrypt (legacyhash)
+	SessionVersion    int
+	Status            string
+	MustResetPassword bool
+	TermsVersion      string // accepted terms of service / privacy policy version, set by Register
+}
+
+// Registration is the input of Register.
+type Registration struct {
+	Username  string
+	Email     string
+	Password  string
+	Password2 string
+	Status    string // status of the new account: pending when sign-ups need approval
+	// TermsVersion is the terms of service / privacy policy version accepted at sign-up ("" = none).
+	TermsVersion string
+}
+
+// ErrNotFound is returned by stores when the row does not exist.
+var ErrNotFound = errors.New("not found")
+
+// UserStore is the user storage the auth service needs.
+type UserStore interface {
+	// UserByUsername returns the account (not soft-deleted) or ErrNotFound.
+	UserByUsername(ctx context.Context, username string) (User, error)
+	UsernameTaken(ctx context.Context, username string) (bool, error)
+	// CreateUser inserts u (PasswordHash already set), recording u.TermsVersion as accepted
+	// when set.
+	CreateUser(ctx context.Context, u User) error
+	RecordLogin(ctx context.Context, userID int, at time.Time) error
+	SetPasswordHash(ctx context.Context, userID int, hash string) error
+}
+
+// Authenticator is the login and sign-up logic shared by the web forms, GraphQL and the
+// admin API.
+type Authenticator interface {
+	Login(ctx context.Context, username, password string) (User, error)
+	Register(ctx context.Context, in Registration) error
+	// VerifyPassword checks a password of an already known account (re-authentication).
+	VerifyPassword(ctx context.Context, stored, password string) bool
+}
+
+// ErrInvalidCredentials and the account state errors are the messages users see at login.
+// Unknown users and wrong passwords get the same one, to avoid username enumeration; the
+// account state is only revealed once the password has been checked.
+var (
+	ErrInvalidCredentials    = apperror.New(apperror.Unauthorized, "Invalid username or password")
+	ErrAccountPending        = apperror.New(apperror.Forbidden, "Your account is awaiting approval")
+	ErrAccountDisabled       = apperror.New(apperror.Forbidden, "This account has been disabled")
+	ErrAccountBanned         = apperror.New(apperror.Forbidden, "This account has been banned")
+	ErrPasswordResetRequired = apperror.New(apperror.Forbidden, "Password reset required. Use the link in the email we sent you.")
+)
+
+// AccountStatusError is the user-facing error for an account that is not active.
+func AccountStatusError(status string) *apperror.Error {
+	switch status {
+	case UserStatusPending:
+		return ErrAccountPending
+	case UserStatusBanned:
+		return ErrAccountBanned
+	default:
+		return ErrAccountDisabled
+	}
+}
+
+// AuthService implements Authenticator on top of a UserStore.
+//
+// A failed login must not tell an attacker whether the username exists: unknown users are
+// checked against a dummy bcrypt hash of the same cost as real ones, so both kinds of failure
+// spend the same time in bcrypt, and every failure then waits FailureDelay plus a random extra
+// of up to the same amount. The jitter hides what timing differences are left and slows down
+// password guessing on top of the rate limit.
+type AuthService struct {
+	Users        UserStore
+	FailureDelay time.Duration // 0 turns the delay off
+	// Sleep waits for d or until ctx is done (default: a timer); tests replace it to see the
+	// delays without waiting for them.
+	Sleep func(ctx context.Context, d time.Duration)
+	// ComparePassword checks a password against a stored hash (default: CheckPassword); tests
+	// replace it to count the bcrypt comparisons.
+	ComparePassword func(stored, password string) bool
+}
+
+// Login checks username and password and returns the account. On success it records the
+// login time and replaces a legacy password hash with a bcrypt one.
+func (s *AuthService) Login(ctx context.Context, username, password string) (User, error) {
+	u, err := s.Users.UserByUsername(ctx, username)
+	if !s.checkPasswordConstantTime(u.PasswordHash, password, err == nil) {
+		s.waitAfterFailure(ctx)
+		return User{}, ErrInvalidCredentials
+	}
+	switch {
+	case u.Status != UserStatusActive:
+		return User{}, AccountStatusError(u.Status)
+	case u.MustResetPassword:
+		return User{}, ErrPasswordResetRequired
+	}
+
+	if err := s.Users.RecordLogin(ctx, u.ID, time.Now().UTC()); err != nil {
+		log.Printf("last_login_at update error: %v", err)
+	}
+	if legacyhash.IsWrapped(u.PasswordHash) {
+		s.upgradeLegacyPassword(ctx, u.ID, password)
+	}
+	return u, nil
+}
+
+// Register validates the sign-up and creates the account with a bcrypt hash. Every returned
+// error is an *apperror.Error.
+func (s *AuthService) Register(ctx context.Context, in Registration) error {
+	if in.Username == "" || in.Email == "" || in.Password == "" {
+		return apperror.New(apperror.Invalid, "All fields required")
+	}
+	if in.Password != in.Password2 {
+		return apperror.New(apperror.Invalid, "Passwords do not match")
+	}
+
+	taken, err := s.Users.UsernameTaken(ctx, in.Username)
+	if err != nil {
+		return apperror.Wrap(apperror.Internal, "Database error", fmt.Errorf("register exists query: %w", err))
+	}
+	if taken {
+		return apperror.New(apperror.Conflict, "Username already in use")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return apperror.Wrap(apperror.Internal, "Internal error, please try again", fmt.Errorf("bcrypt.GenerateFromPassword: %w", err))
+	}
+	err = s.Users.CreateUser(ctx, User{
+		Username: in.Username, Email: in.Email, PasswordHash: string(hash), Status: in.Status, TermsVersion: in.TermsVersion,
+	})
+	if err != nil {
+		return apperror.Wrap(apperror.Internal, "Registration failed", fmt.Errorf("register insert: %w", err))
+	}
+	return nil
+}
+
+// VerifyPassword reports whether password matches the stored hash, waiting like a failed
+// login when it does not.
+func (s *AuthService) VerifyPassword(ctx context.Context, stored, password string) bool {
+	if password != "" && s.comparePassword(stored, password) {
+		return true
+	}
+	s.waitAfterFailure(ctx)
+	return false
+}
+
+// upgradeLegacyPassword replaces an imported legacy hash with a bcrypt hash of the password
+// the user just logged in with. A failure is logged; the legacy hash keeps working.
+func (s *AuthService) upgradeLegacyPassword(ctx context.Context, userID int, password string) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err == nil {
+		err = s.Users.SetPasswordHash(ctx, userID, string(hash))
+	}
+	if err != nil {
+		log.Printf("legacy password upgrade error: %v", err)
+	}
+}
+
+// waitAfterFailure sleeps for a jittered FailureDelay, or until ctx is done.
+func (s *AuthService) waitAfterFailure(ctx context.Context) {
+	d := s.FailureDelay
+	if d <= 0 {
+		return
+	}
+	d += rand.N(d)
+	if s.Sleep != nil {
+		s.Sleep(ctx, d)
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// CheckPassword compares password with a stored bcrypt hash, or with a legacy MD5 digest
+// wrapped in bcrypt by cmd/dbmigrate.
+func CheckPassword(stored, password string) bool {
+	if legacyhash.IsWrapped(stored) {
+		return legacyhash.Verify(stored, password)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+}
+
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy password for unknown users"), bcrypt.DefaultCost)
+	if err != nil {
+		panic("bcrypt dummy hash: " + err.Error())
+	}
+	return string(hash)
+})
+
+// checkPasswordConstantTime is comparePassword for a user that may not exist (found false):
+// bcrypt runs either way, and an unusable stored hash also falls back to the dummy hash.
+func (s *AuthService) checkPasswordConstantTime(stored, password string, found bool) bool {
+	if !found {
+		stored = dummyPasswordHash()
+	} else if _, err := bcrypt.Cost([]byte(strings.TrimPrefix(stored, legacyhash.Prefix))); err != nil {
+		stored, found = dummyPasswordHash(), false
+	}
+	return s.comparePassword(stored, password) && found
+}
+
+func (s *AuthService) comparePassword(stored, password string) bool {
+	if s.ComparePassword != nil {
+		return s.ComparePassword(stored, password)
+	}
+	return CheckPassword(stored, password)
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"strconv"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/experiments"
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/searchmerge"
+	"devops-valgfag/internal/textnorm"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultSnippetLength is the snippet length in runes when the client does not pick one.
+const DefaultSnippetLength = 200
+
+// SearchResult is the normalized result shape used by both UI and API.
+// Local DB results use a real ID; external cached results set ID=0.
+type SearchResult struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Language    string `json:"language"`
+	Description string `json:"description"` // Snippet (local content or external snippet), plain text
+
+	// DescriptionHTML is the external snippet with its search highlights, for the HTML page
+	// only; it went through scraper.SanitizeSnippet.
+	DescriptionHTML template.HTML `json:"-"`
+}
+
+// SearchQuery is one search.
+type SearchQuery struct {
+	Query           string // normalised by Search (NFC, lowercase)
+	Language        string
+	Tag             string // tag slug; "" for no filter
+	Limit           int
+	SnippetLength   int  // runes; DefaultSnippetLength if 0
+	IncludeExternal bool // add Wikipedia results (web UI only)
+}
+
+// SearchBackend is what the search service needs from the database and the outside world.
+type SearchBackend interface {
+	// Local searches the pages (and cached external results) of the context's tenant. Without
+	// a query it lists the pages carrying q.Tag.
+	Local(ctx context.Context, q SearchQuery) ([]SearchResult, error)
+	// External returns Wikipedia results for the query, best effort (nil on failure).
+	External(ctx context.Context, q SearchQuery) []SearchResult
+	ExternalEnabled() bool
+	// MergePolicy places external results among local ones (it may depend on the experiment
+	// variant in ctx).
+	MergePolicy(ctx context.Context) searchmerge.Policy
+	// CacheScope prefixes cache keys with whatever else changes results for ctx (tenant,
+	// experiment variant).
+	CacheScope(ctx context.Context) string
+	// Degraded reports whether the database is known to be down.
+	Degraded() bool
+	// QueryFailed is told about a failed local lookup (it may switch to degraded mode).
+	QueryFailed(ctx context.Context, err error)
+	// LogSearch records a search with a query for the usage statistics.
+	LogSearch(ctx context.Context, q, lang string, results int)
+}
+
+// SearchCache stores results by key. Entries stay usable after they stop being fresh, so
+// they can be served while the database is down.
+type SearchCache interface {
+	Get(ctx context.Context, key string) (results []SearchResult, fresh, ok bool)
+	Set(ctx context.Context, key string, results []SearchResult)
+}
+
+// Searcher runs searches for the web UI, the REST, GraphQL and gRPC APIs.
+type Searcher interface {
+	Search(ctx context.Context, q SearchQuery) []SearchResult
+}
+
+// SearchService implements Searcher. It never fails: a search the database cannot answer
+// returns the stale cached results, or none (check Backend.Degraded to tell the two apart).
+type SearchService struct {
+	Backend SearchBackend
+	Cache   SearchCache   // nil disables caching
+	Timeout time.Duration // upper bound per search, also for the shared lookup
+
+	flights   singleflight.Group
+	flightsMu sync.Mutex
+	waiters   map[string]*flightWaiters
+}
+
+// Search normalises the query (accents are then ignored by the database), answers from the
+// cache when it can and otherwise runs one shared lookup for all concurrent identical
+// searches. With a tag, an empty query lists the tagged pages and external results are never
+// added, since they cannot carry tags.
+func (s *SearchService) Search(ctx context.Context, q SearchQuery) (results []SearchResult) {
+	q.Query = textnorm.Query(q.Query)
+	if q.SnippetLength == 0 {
+		q.SnippetLength = DefaultSnippetLength
+	}
+	if q.Query == "" && q.Tag == "" {
+		return []SearchResult{}
+	}
+	if q.Query != "" {
+		defer func() { s.Backend.LogSearch(ctx, q.Query, q.Language, len(results)) }()
+	}
+
+	metrics.SearchTotal.Inc()
+	for name, variant := range experiments.FromContext(ctx) {
+		metrics.ExperimentSearches.WithLabelValues(name, variant).Inc()
+	}
+	timer := prometheus.NewTimer(metrics.SearchLatency)
+	defer timer.ObserveDuration()
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	q.IncludeExternal = q.IncludeExternal && s.Backend.ExternalEnabled() && q.Tag == ""
+	key := s.cacheKey(ctx, q)
+	cached, fresh, cachedOK := s.cached(ctx, key)
+	if fresh {
+		return cached
+	}
+
+	// Degraded mode: answer from the stale cache (or not at all) without waiting on the database.
+	if s.Backend.Degraded() {
+		return staleSearch(cached, cachedOK)
+	}
+
+	results, err := s.shared(ctx, key, func(ctx context.Context) ([]SearchResult, error) {
+		return s.lookup(ctx, q, key)
+	})
+	if err != nil {
+		s.Backend.QueryFailed(ctx, err)
+		if s.Backend.Degraded() {
+			return staleSearch(cached, cachedOK)
+		}
+	}
+	if results == nil {
+		return []SearchResult{}
+	}
+	return results
+}
+
+func (s *SearchService) cacheKey(ctx context.Context, q SearchQuery) string {
+	key := fmt.Sprintf("search:%s:%d:%t:%s", q.Language, q.Limit, q.IncludeExternal, q.Query)
+	if q.Tag != "" {
+		key = fmt.Sprintf("search-tag:%s:%s:%d:%s", q.Tag, q.Language, q.Limit, q.Query)
+	}
+	if q.SnippetLength != DefaultSnippetLength {
+		key += ":snippet=" + strconv.Itoa(q.SnippetLength)
+	}
+	return s.Backend.CacheScope(ctx) + key
+}
+
+func (s *SearchService) cached(ctx context.Context, key string) ([]SearchResult, bool, bool) {
+	if s.Cache == nil {
+		return nil, false, false
+	}
+	return s.Cache.Get(ctx, key)
+}
+
+// staleSearch serves an expired cache entry while the database is down (empty if there is none).
+func staleSearch(cached []SearchResult, ok bool) []SearchResult {
+	if !ok {
+		return []SearchResult{}
+	}
+	metrics.CacheRequests.WithLabelValues("search", "stale").Inc()
+	return cached
+}
+
+// lookup queries the database (plus optional enrichment) and caches the outcome. It runs
+// once per group of concurrent identical searches (see shared). A local error is returned
+// alongside the (external-only) results.
+func (s *SearchService) lookup(ctx context.Context, q SearchQuery, key string) ([]SearchResult, error) {
+	local, err := s.Backend.Local(ctx, q)
+	if err != nil {
+		local = make([]SearchResult, 0, q.Limit)
+	}
+
+	// The merge policy places external results (free slots plus their quota) within the limit.
+	if policy := s.Backend.MergePolicy(ctx); q.IncludeExternal && policy.WantsExternal(len(local), q.Limit) {
+		external := WithoutURLs(s.Backend.External(ctx, q), local)
+		local = searchmerge.Merge(policy, local, external, q.Limit)
+	}
+
+	// Failed lookups are not cached, so the next request retries the database.
+	if err == nil && s.Cache != nil {
+		s.Cache.Set(ctx, key, local)
+	}
+	return local, err
+}
+
+// WithoutURLs drops the results whose URL is already in shown.
+func WithoutURLs(results, shown []SearchResult) []SearchResult {
+	seen := make(map[string]bool, len(shown))
+	for _, r := range shown {
+		seen[r.URL] = true
+	}
+	out := results[:0:0]
+	for _, r := range results {
+		if !seen[r.URL] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+
+	"devops-valgfag/internal/metrics"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Concurrent identical searches (same cache key: language, limit, external flag, query) are
+// collapsed into one lookup via singleflight, so a burst of users searching a trending topic
+// costs one DB query (and at most one Wikipedia fetch) instead of one per request.
+//
+// The shared lookup runs on its own context so one impatient client cannot fail it for the
+// others; it is canceled once every waiting client has gone, keeping the "abandoned queries
+// are canceled server-side" guarantee.
+
+// flightWaiters tracks the clients waiting for a key and the context of their lookup.
+type flightWaiters struct {
+	n      int
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// shared runs lookup once for all concurrent callers with the same key and returns its
+// outcome. The returned slice may be shared between callers and must not be modified.
+func (s *SearchService) shared(ctx context.Context, key string, lookup func(context.Context) ([]SearchResult, error)) ([]SearchResult, error) {
+	s.flightsMu.Lock()
+	if s.waiters == nil {
+		s.waiters = map[string]*flightWaiters{}
+	}
+	w, ok := s.waiters[key]
+	if !ok {
+		fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.Timeout)
+		w = &flightWaiters{ctx: fctx, cancel: cancel}
+		s.waiters[key] = w
+	}
+	w.n++
+	s.flightsMu.Unlock()
+
+	leader := false
+	ch := s.flights.DoChan(key, func() (any, error) {
+		leader = true
+		return lookup(w.ctx)
+	})
+
+	var res singleflight.Result
+	left := false
+	select {
+	case res = <-ch:
+		if !leader {
+			metrics.SearchDeduplicated.Inc()
+		}
+	case <-ctx.Done():
+		res.Err = ctx.Err()
+		left = true
+	}
+
+	s.flightsMu.Lock()
+	w.n--
+	if w.n == 0 {
+		delete(s.waiters, key)
+		w.cancel()
+		if left {
+			// Everyone left before the lookup finished: new callers must start a fresh one
+			// instead of joining the canceled flight.
+			s.flights.Forget(key)
+		}
+	}
+	s.flightsMu.Unlock()
+
+	results, _ := res.Val.([]SearchResult)
+	return results, res.Err
+}
@@ -0,0 +1,9 @@
+// Package service holds the application logic that does not depend on HTTP: the login and
+// sign-up rules, the search pipeline (normalising, caching, de-duplicating, merging external
+// results) and the weather lookup. Each service reaches storage and outside APIs through a
+// small interface (UserStore, SearchBackend, ForecastProvider), so it can be tested with
+// in-memory fakes and reused by every transport: the web forms and REST API in handlers, the
+// GraphQL API and the gRPC SearchService all call the same service.
+//
+// Errors meant for users are *apperror.Error values; handlers map them to responses.
+package service
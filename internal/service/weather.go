@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-valgfag/internal/apperror"
+)
+
+// ==========
+// Models (DMI EDR GeoJSON subset)
+// ==========
+
+type EDRFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []EDRFeature `json:"features"`
+}
+
+type EDRFeature struct {
+	Type       string        `json:"type"`
+	Geometry   EDRGeometry   `json:"geometry"`
+	Properties EDRProperties `json:"properties"`
+}
+
+type EDRGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"` // [lon, lat]
+}
+
+type EDRProperties struct {
+	Temperature float64 `json:"temperature-2m"`
+	WindSpeed   float64 `json:"wind-speed-10m"`
+	WindDir     float64 `json:"wind-dir-10m"`
+	Step        string  `json:"step"`
+}
+
+// Messages of the weather errors users see.
+const (
+	WeatherUnavailableMsg    = "weather service unavailable"
+	WeatherDataIncompleteMsg = "weather data incomplete"
+)
+
+// ErrWeatherUnavailable is returned to users when the forecast could not be fetched; the
+// cause is reported separately, users must not see it.
+var ErrWeatherUnavailable = apperror.New(apperror.Unavailable, WeatherUnavailableMsg)
+
+// Copenhagen coordinates used by the /weather page and /api/weather.
+const (
+	CopenhagenLat = 55.715
+	CopenhagenLon = 12.561
+)
+
+// ForecastProvider fetches the forecast for a position (WGS84 lat/lon).
+type ForecastProvider interface {
+	Forecast(ctx context.Context, lat, lon float64) (*EDRFeatureCollection, error)
+}
+
+// HTTPDoer is the part of *http.Client that DMIClient needs, so tests can answer its
+// requests without reaching DMI.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DMIClient is the ForecastProvider for the DMI forecast EDR API (HARMONIE model).
+type DMIClient struct {
+	BaseURL    string // "" for https://dmigw.govcloud.dk
+	APIKey     string
+	HTTPClient HTTPDoer // nil for http.DefaultClient
+	// ReportStatus, if set, is told whether the provider answered (a 4xx is our request or key
+	// and counts as up).
+	ReportStatus func(up bool)
+}
+
+// Forecast fetches the DMI HARMONIE forecast for an arbitrary position.
+func (c DMIClient) Forecast(ctx context.Context, lat, lon float64) (*EDRFeatureCollection, error) {
+	if c.APIKey == "" {
+		return nil, fmt.Errorf("missing DMI_API_KEY environment variable")
+	}
+
+	baseURL := strings.TrimSuffix(c.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = "https://dmigw.govcloud.dk"
+	}
+
+	u := fmt.Sprintf(
+		"%s/v1/forecastedr/collections/harmonie_dini_sf/position"+
+			"?coords=POINT(%s%%20%s)&crs=crs84"+
+			"&parameter-name=temperature-2m,wind-speed-10m,wind-dir-10m"+
+			"&f=GeoJSON&api-key=%s",
+		baseURL,
+		strconv.FormatFloat(lon, 'f', -1, 64), // POINT(lon lat)
+		strconv.FormatFloat(lat, 'f', -1, 64),
+		c.APIKey,
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		c.reportStatus(false)
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			log.Printf("failed to close weather response body: %v", cerr)
+		}
+	}()
+
+	// 5xx means the provider is down; 4xx is our request/key and not an outage.
+	c.reportStatus(resp.StatusCode < http.StatusInternalServerError)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s (status %d): %s", WeatherUnavailableMsg, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var data EDRFeatureCollection
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("JSON decode failed: %w", err)
+	}
+
+	return &data, nil
+}
+
+func (c DMIClient) reportStatus(up bool) {
+	if c.ReportStatus != nil {
+		c.ReportStatus(up)
+	}
+}
+
+// WeatherService serves forecasts from a ForecastProvider and keeps the Copenhagen forecast,
+// which every page view needs, cached for TTL.
+type WeatherService struct {
+	Provider ForecastProvider
+	TTL      time.Duration
+
+	mu        sync.Mutex
+	data      *EDRFeatureCollection
+	fetchedAt time.Time
+}
+
+// Copenhagen returns the forecast for central Copenhagen (cached for TTL).
+func (s *WeatherService) Copenhagen(ctx context.Context) (*EDRFeatureCollection, error) {
+	s.mu.Lock()
+	data, fetchedAt := s.data, s.fetchedAt
+	s.mu.Unlock()
+	if data != nil && time.Since(fetchedAt) < s.TTL {
+		return data, nil
+	}
+	return s.Refresh(ctx)
+}
+
+// Refresh fetches the Copenhagen forecast and replaces the cached copy.
+func (s *WeatherService) Refresh(ctx context.Context) (*EDRFeatureCollection, error) {
+	data, err := s.Provider.Forecast(ctx, CopenhagenLat, CopenhagenLon)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.data, s.fetchedAt = data, time.Now()
+	s.mu.Unlock()
+	return data, nil
+}
+
+// Evict drops the cached forecast once it is older than TTL.
+func (s *WeatherService) Evict() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data != nil && time.Since(s.fetchedAt) >= s.TTL {
+		s.data = nil
+	}
+}
+
+// Reset drops the cached forecast, so the next Copenhagen call fetches it.
+func (s *WeatherService) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = nil
+}
+
+// At fetches the forecast for an arbitrary position; it is not cached.
+func (s *WeatherService) At(ctx context.Context, lat, lon float64) (*EDRFeatureCollection, error) {
+	return s.Provider.Forecast(ctx, lat, lon)
+}
+
+// Current returns the first forecast step of data, which must have a position. The errors
+// are Unavailable *apperror.Error values describing what was missing.
+func Current(data *EDRFeatureCollection) (EDRFeature, error) {
+	if data == nil {
+		return EDRFeature{}, apperror.Wrap(apperror.Unavailable, WeatherUnavailableMsg, errors.New("weather: empty response body"))
+	}
+	if len(data.Features) == 0 {
+		return EDRFeature{}, apperror.Wrap(apperror.Unavailable, WeatherUnavailableMsg, errors.New("weather: empty feature list"))
+	}
+	first := data.Features[0]
+	if len(first.Geometry.Coordinates) < 2 {
+		return EDRFeature{}, apperror.Wrap(apperror.Unavailable, WeatherDataIncompleteMsg, errors.New("weather: missing coordinates in response"))
+	}
+	return first, nil
+}
@@ -0,0 +1,142 @@
+// Package sessionstore provides a gorilla/sessions Store backed by Redis.
+//
+// The cookie only carries a signed random session ID; the values live in Redis, so every
+// replica sees the same session and logging out invalidates it server-side.
+package sessionstore
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "session:"
+
+// Redis operations get their own short timeout so a slow Redis cannot stall a request indefinitely.
+const redisTimeout = 2 * time.Second
+
+var idEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// RedisStore stores session values in Redis (see sessions.FilesystemStore for the model).
+type RedisStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options // default configuration
+	client  *redis.Client
+}
+
+// NewRedisStore creates a store using keyPairs for signing the session ID cookie
+// (same meaning as in sessions.NewCookieStore). Sessions last 30 days by default.
+func NewRedisStore(client *redis.Client, keyPairs ...[]byte) *RedisStore {
+	s := &RedisStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+		client: client,
+	}
+	s.MaxAge(s.Options.MaxAge)
+	return s
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *RedisStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+// A session ID that is unknown to Redis (expired or logged out) yields a fresh session.
+func (s *RedisStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	found, err := s.load(r.Context(), session)
+	if err != nil {
+		return session, err
+	}
+	if !found {
+		session.ID = ""
+		return session, nil
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save writes the session to Redis and sets the ID cookie.
+// Options.MaxAge <= 0 deletes the session from Redis and expires the cookie.
+func (s *RedisStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx, cancel := context.WithTimeout(r.Context(), redisTimeout)
+	defer cancel()
+
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if err := s.client.Del(ctx, keyPrefix+session.ID).Err(); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = idEncoding.EncodeToString(securecookie.GenerateRandomKey(32))
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(session.Options.MaxAge) * time.Second
+	if err := s.client.Set(ctx, keyPrefix+session.ID, encoded, ttl).Err(); err != nil {
+		return err
+	}
+
+	cookie, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), cookie, session.Options))
+	return nil
+}
+
+// MaxAge sets the maximum age for the store, the Redis expiry and the signed cookies.
+func (s *RedisStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+func (s *RedisStore) load(ctx context.Context, session *sessions.Session) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, keyPrefix+session.ID).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := securecookie.DecodeMulti(session.Name(), data, &session.Values, s.Codecs...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
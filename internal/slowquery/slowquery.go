@@ -0,0 +1,192 @@
+// Package slowquery logs database queries that exceed a time threshold.
+//
+// Tracer plugs into pgx (ConnConfig.Tracer), so it sees every query sent through the pool,
+// including those issued via database/sql. Parameters are logged in sanitized form; with
+// Explain on (dev), the plan of a slow SELECT is captured with EXPLAIN (no ANALYZE, so the
+// query is not executed again).
+package slowquery
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"devops-valgfag/internal/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxArgLen is how many characters of a string parameter are logged.
+const maxArgLen = 40
+
+// explainTimeout bounds the EXPLAIN run for a slow query.
+const explainTimeout = 5 * time.Second
+
+// Options configures a Tracer.
+type Options struct {
+	Pool      string        // label for logs and metrics (e.g. "primary", "replica")
+	Threshold time.Duration // queries taking at least this long are logged; <= 0 disables the tracer
+	Explain   bool          // capture EXPLAIN plans for slow SELECTs (dev only: costs an extra round trip)
+}
+
+// Tracer is a pgx.QueryTracer that reports slow queries.
+type Tracer struct {
+	pool      string
+	threshold atomic.Int64 // time.Duration
+	explainOn atomic.Bool
+
+	explainDB  atomic.Pointer[sql.DB]
+	explaining atomic.Bool // at most one EXPLAIN in flight per pool
+}
+
+type traceKey struct{}
+
+type traceData struct {
+	start time.Time
+	sql   string
+	args  []any
+}
+
+// New creates a tracer.
+func New(opts Options) *Tracer {
+	t := &Tracer{pool: opts.Pool}
+	t.Configure(opts.Threshold, opts.Explain)
+	return t
+}
+
+// Configure changes the threshold and Explain of a running tracer (config reload).
+func (t *Tracer) Configure(threshold time.Duration, explain bool) {
+	t.threshold.Store(int64(threshold))
+	t.explainOn.Store(explain)
+}
+
+// SetExplainDB sets the pool used to run EXPLAIN (the pool this tracer is attached to).
+// It is set after opening since the tracer has to exist before the pool does.
+func (t *Tracer) SetExplainDB(db *sql.DB) {
+	t.explainDB.Store(db)
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *Tracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if t.threshold.Load() <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, traceData{start: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *Tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	td, ok := ctx.Value(traceKey{}).(traceData)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(td.start)
+	if elapsed < time.Duration(t.threshold.Load()) {
+		return
+	}
+
+	metrics.SlowQueries.WithLabelValues(t.pool).Inc()
+	status := "ok"
+	if data.Err != nil {
+		status = data.Err.Error()
+	}
+	log.Printf("slow query (pool=%s duration=%s status=%s): %s args=%s",
+		t.pool, elapsed.Round(time.Millisecond), status, compactSQL(td.sql), SanitizeArgs(td.sql, td.args))
+
+	if t.explainOn.Load() && isSelect(td.sql) {
+		t.explain(td)
+	}
+}
+
+// explain logs the plan of a slow query in the background. It is skipped while another
+// EXPLAIN is still running, so a burst of slow queries cannot double the load.
+func (t *Tracer) explain(td traceData) {
+	db := t.explainDB.Load()
+	if db == nil || !t.explaining.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer t.explaining.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+		defer cancel()
+
+		rows, err := db.QueryContext(ctx, "EXPLAIN "+td.sql, td.args...)
+		if err != nil {
+			log.Printf("slow query explain failed (pool=%s): %v", t.pool, err)
+			return
+		}
+		defer func() { _ = rows.Close() }()
+
+		var plan []string
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				log.Printf("slow query explain failed (pool=%s): %v", t.pool, err)
+				return
+			}
+			plan = append(plan, line)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("slow query explain failed (pool=%s): %v", t.pool, err)
+			return
+		}
+		log.Printf("slow query plan (pool=%s): %s\n%s", t.pool, compactSQL(td.sql), strings.Join(plan, "\n"))
+	}()
+}
+
+// SanitizeArgs renders query parameters for logging. Long strings are truncated, binary
+// values are reduced to their size, and every string is redacted when the statement touches
+// credentials (passwords, tokens, secrets) so they never end up in logs.
+func SanitizeArgs(query string, args []any) string {
+	if len(args) == 0 {
+		return "[]"
+	}
+	lower := strings.ToLower(query)
+	sensitive := strings.Contains(lower, "password") || strings.Contains(lower, "token") || strings.Contains(lower, "secret")
+
+	parts := make([]string, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case nil:
+			parts[i] = "NULL"
+		case []byte:
+			parts[i] = fmt.Sprintf("<%d bytes>", len(v))
+		case string:
+			parts[i] = sanitizeString(v, sensitive)
+		case time.Time:
+			parts[i] = v.UTC().Format(time.RFC3339)
+		case fmt.Stringer:
+			parts[i] = sanitizeString(v.String(), sensitive)
+		default:
+			parts[i] = fmt.Sprint(v)
+		}
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func sanitizeString(s string, redact bool) string {
+	if redact {
+		return "[redacted]"
+	}
+	if utf8.RuneCountInString(s) > maxArgLen {
+		s = string([]rune(s)[:maxArgLen]) + "..."
+	}
+	return fmt.Sprintf("%q", s)
+}
+
+// compactSQL collapses whitespace so multi-line statements fit on one log line.
+func compactSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// isSelect reports whether query is a read statement that is safe to EXPLAIN.
+func isSelect(query string) bool {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(q, "SELECT") || strings.HasPrefix(q, "WITH")
+}
@@ -0,0 +1,135 @@
+// Package snippet cuts result snippets out of page content. Lengths are counted in runes, so a
+// snippet never ends in a broken UTF-8 sequence, and cuts are moved to word boundaries where
+// possible. A cut is marked with an ellipsis, which counts toward the length.
+package snippet
+
+import (
+	"strings"
+	"unicode"
+
+	"devops-valgfag/internal/textnorm"
+)
+
+// Ellipsis marks text cut off at the start or end of a snippet.
+const Ellipsis = "…"
+
+// Cuts are moved back to a word boundary when one lies within this share of the length.
+const wordSlack = 5 // 1/5 of n
+
+// Truncate returns the start of s, cut to at most n runes. Runs of whitespace are collapsed.
+func Truncate(s string, n int) string {
+	r := []rune(collapse(s))
+	if len(r) <= n || n <= 0 {
+		return string(r)
+	}
+	end := cutEnd(r, 0, n-1)
+	return strings.TrimRightFunc(string(r[:end]), unicode.IsSpace) + Ellipsis
+}
+
+// Around returns at most n runes of text around the first match of query, ignoring case and
+// accents (textnorm.Fold), trying the whole query first and then its words in order. The
+// match starts about a third into the snippet. Without a match it returns Truncate(text, n).
+func Around(text, query string, n int) string {
+	r := []rune(collapse(text))
+	if len(r) <= n || n <= 0 {
+		return string(r)
+	}
+	at := find(r, query)
+	if at < 0 || n < 2 {
+		// A window needs room for the leading ellipsis and at least one rune.
+		return Truncate(string(r), n)
+	}
+
+	start := max(at-n/3, 0)
+	if start > 0 {
+		start = cutStart(r, start, at)
+	}
+	budget := n
+	if start > 0 {
+		budget-- // leading ellipsis
+	}
+	if start+budget >= len(r) {
+		// The rest fits: show the end of the text, starting earlier if that fills the snippet.
+		start = max(len(r)-budget, 0)
+		if start > 0 {
+			start = cutStart(r, start, at)
+		}
+		return prefix(start) + string(r[start:])
+	}
+	end := cutEnd(r, start, budget-1)
+	return prefix(start) + strings.TrimRightFunc(string(r[start:end]), unicode.IsSpace) + Ellipsis
+}
+
+func prefix(start int) string {
+	if start > 0 {
+		return Ellipsis
+	}
+	return ""
+}
+
+// cutEnd returns the end index for a cut of at most n runes from start, moved back to the
+// last space when one is near.
+func cutEnd(r []rune, start, n int) int {
+	end := start + n
+	for i := end; i > end-n/wordSlack && i > start; i-- {
+		if unicode.IsSpace(r[i]) {
+			return i
+		}
+	}
+	return end
+}
+
+// cutStart moves start forward past a partial word, but not beyond limit.
+func cutStart(r []rune, start, limit int) int {
+	if unicode.IsSpace(r[start-1]) {
+		return start
+	}
+	for i := start; i < limit; i++ {
+		if unicode.IsSpace(r[i]) {
+			return i + 1
+		}
+	}
+	return start
+}
+
+// find returns the rune index of the first match of query, or of its first matching word.
+// Text and query are compared folded; folding can change the number of runes (æ is "ae"),
+// so origin maps each folded rune back to the rune of r it came from.
+func find(r []rune, query string) int {
+	var folded []rune
+	var origin []int
+	for i, c := range r {
+		for _, f := range textnorm.FoldRune(c) {
+			folded = append(folded, f)
+			origin = append(origin, i)
+		}
+	}
+	terms := append([]string{query}, strings.Fields(query)...)
+	for _, term := range terms {
+		if at := index(folded, []rune(textnorm.Fold(strings.TrimSpace(term)))); at >= 0 {
+			return origin[at]
+		}
+	}
+	return -1
+}
+
+func index(s, sub []rune) int {
+	if len(sub) == 0 {
+		return -1
+	}
+outer:
+	for i := 0; i+len(sub) <= len(s); i++ {
+		for j, c := range sub {
+			if s[i+j] != c {
+				continue outer
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+// collapse trims s and turns runs of whitespace into single spaces.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilesURLPrefix is where the application serves signed filesystem downloads
+// (see Filesystem.VerifySignedURL).
+const FilesURLPrefix = "/files/"
+
+// Filesystem stores objects as files below a root directory. The content type is derived
+// from the key's extension, so keys should carry one.
+type Filesystem struct {
+	root       string
+	signingKey []byte
+}
+
+// NewFilesystem creates the root directory if needed. signingKey signs download URLs.
+func NewFilesystem(root string, signingKey []byte) (*Filesystem, error) {
+	if len(signingKey) == 0 {
+		return nil, errors.New("storage: filesystem backend needs a signing key")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	// Derive a key of our own instead of reusing the caller's secret directly.
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte("storage signed urls"))
+	return &Filesystem{root: root, signingKey: mac.Sum(nil)}, nil
+}
+
+func (f *Filesystem) path(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the object to a temporary file and renames it into place, so readers never
+// see a partial object.
+func (f *Filesystem) Put(_ context.Context, key string, r io.Reader, _ string) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // no-op after a successful rename
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Get opens the object file.
+func (f *Filesystem) Get(_ context.Context, key string) (*Object, error) {
+	p, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &Object{Body: file, ContentType: contentType, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the object file.
+func (f *Filesystem) Delete(_ context.Context, key string) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks the directory holding prefix. Temporary files of unfinished Puts are skipped.
+func (f *Filesystem) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	dir := f.root
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		p, err := f.path(prefix[:i])
+		if err != nil {
+			return nil, err
+		}
+		dir = p
+	}
+
+	var out []ObjectInfo
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(f.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// SignedURL returns a path below FilesURLPrefix carrying an expiry and an HMAC of key and
+// expiry; the application serves it after VerifySignedURL.
+func (f *Filesystem) SignedURL(_ context.Context, key string, ttl time.Duration) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	return FilesURLPrefix + key + "?" + url.Values{
+		"expires":   {expires},
+		"signature": {f.sign(key, expires)},
+	}.Encode(), nil
+}
+
+// VerifySignedURL checks the expires and signature query parameters of a URL made by SignedURL.
+func (f *Filesystem) VerifySignedURL(key string, query url.Values) error {
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(f.sign(key, expires))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (f *Filesystem) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, f.signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,101 @@
+// Package storage stores binary objects (avatars, data export archives, crawler artifacts,
+// database backups) under slash-separated keys.
+//
+// Two backends exist, selected by STORAGE_BACKEND: the filesystem backend keeps objects in a
+// local directory (STORAGE_DIR), which must be a persistent volume shared by all replicas;
+// the S3 backend talks to Amazon S3 or any compatible server such as MinIO.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Key prefixes, one per kind of object, so a bucket can get per-prefix lifecycle rules.
+const (
+	AvatarPrefix  = "avatars/"
+	ExportPrefix  = "exports/" // data export archives
+	CrawlerPrefix = "crawler/" // raw fetched pages and other crawler artifacts
+	BackupPrefix  = "backups/" // database dumps
+)
+
+// ErrNotFound is returned by Get for a key that does not exist.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ErrInvalidSignature is returned when a signed URL was tampered with or has expired.
+var ErrInvalidSignature = errors.New("storage: invalid or expired signature")
+
+// ErrInvalidKey is returned for keys that are empty, absolute or contain "..".
+var ErrInvalidKey = errors.New("storage: invalid key")
+
+// Storage keeps objects by key. Keys look like "avatars/7-3f9a.png".
+type Storage interface {
+	// Put stores the object, replacing any existing one with the same key.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the object; the caller must close Object.Body.
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the object. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that lets anyone holding it download the object until ttl passes.
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// List returns the objects whose key starts with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// Object is an opened stored object.
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// ObjectInfo describes a stored object without opening it.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)*$`)
+
+// ValidateKey rejects keys that could escape the storage root.
+func ValidateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// Config selects and configures a backend.
+type Config struct {
+	Backend string // "filesystem" (default) or "s3"
+
+	// Filesystem backend.
+	Dir        string
+	SigningKey []byte // signs the backend's download URLs; required
+
+	S3 S3Config
+}
+
+// New opens the backend selected by cfg.Backend.
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "", "filesystem":
+		return NewFilesystem(cfg.Dir, cfg.SigningKey)
+	case "s3":
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q (want filesystem or s3)", cfg.Backend)
+	}
+}
@@ -0,0 +1,186 @@
+// Package testutil holds helpers shared by the integration tests. ExternalAPIs is a local
+// stand-in for the Wikipedia and DMI APIs that answers with recorded responses (see
+// fixtures/) or a chosen failure, so search enrichment and the weather pages can be exercised
+// end to end without the network.
+package testutil
+
+import (
+	"embed"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// Fixture returns the recorded response fixtures/name, e.g. "wikipedia_search.json". It
+// panics if there is no such fixture.
+func Fixture(name string) []byte {
+	b, err := fixtures.ReadFile("fixtures/" + name)
+	if err != nil {
+		panic("testutil: " + err.Error())
+	}
+	return b
+}
+
+// Scenario is how a mocked API answers.
+type Scenario string
+
+const (
+	// OK answers with the recorded responses.
+	OK Scenario = "ok"
+	// Empty answers 200 with no results: no search hits, no forecast steps.
+	Empty Scenario = "empty"
+	// ServerError answers 503, an outage of the provider.
+	ServerError Scenario = "server_error"
+	// Unauthorized answers 401 as for a wrong API key (for DMI, the recorded body).
+	Unauthorized Scenario = "unauthorized"
+	// Malformed answers 200 with a truncated JSON body.
+	Malformed Scenario = "malformed"
+	// Timeout never answers; the request ends when the client gives up (or the mock closes).
+	Timeout Scenario = "timeout"
+)
+
+// Names of the mocked APIs, for Requests.
+const (
+	Wikipedia = "wikipedia"
+	DMI       = "dmi"
+)
+
+// DMIKey is the API key the mocked DMI API accepts; any other key gets the 401 response.
+const DMIKey = "test-dmi-key"
+
+// The DMI forecast path the app requests (see service.DMIClient).
+const dmiForecastPath = "/v1/forecastedr/collections/harmonie_dini_sf/position"
+
+// ExternalAPIs serves both mocked APIs from one local server. Both start in the OK scenario.
+type ExternalAPIs struct {
+	// URL is the server's base URL: DMI_API_URL, and WikipediaURL below it.
+	URL string
+
+	mu       sync.Mutex
+	scenario map[string]Scenario
+	requests map[string]int
+	closed   chan struct{} // releases Timeout requests when the test ends
+}
+
+// NewExternalAPIs starts the mock servers for the duration of tb.
+func NewExternalAPIs(tb testing.TB) *ExternalAPIs {
+	tb.Helper()
+	m := &ExternalAPIs{
+		scenario: map[string]Scenario{Wikipedia: OK, DMI: OK},
+		requests: map[string]int{},
+		closed:   make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/w/api.php", m.wikipedia)
+	mux.HandleFunc(dmiForecastPath, m.dmi)
+	srv := httptest.NewServer(mux)
+	m.URL = srv.URL
+	// Cleanups run last-in first-out: release hanging requests, then wait for them.
+	tb.Cleanup(srv.Close)
+	tb.Cleanup(func() { close(m.closed) })
+	return m
+}
+
+// WikipediaURL is the mocked MediaWiki API endpoint (WIKIPEDIA_API_URL).
+func (m *ExternalAPIs) WikipediaURL() string {
+	return m.URL + "/w/api.php"
+}
+
+// Setenv points the app at the mocks for the duration of tb: WIKIPEDIA_API_URL, DMI_API_URL
+// and a DMI_API_KEY they accept. The scraper and the weather client read these on every request.
+func (m *ExternalAPIs) Setenv(tb testing.TB) {
+	tb.Helper()
+	tb.Setenv("WIKIPEDIA_API_URL", m.WikipediaURL())
+	tb.Setenv("DMI_API_URL", m.URL)
+	tb.Setenv("DMI_API_KEY", DMIKey)
+}
+
+// Set makes api (Wikipedia or DMI) answer according to s from now on.
+func (m *ExternalAPIs) Set(api string, s Scenario) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scenario[api] = s
+}
+
+// Requests is the number of requests api (Wikipedia or DMI) has received.
+func (m *ExternalAPIs) Requests(api string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests[api]
+}
+
+// begin counts a request to api and returns its scenario.
+func (m *ExternalAPIs) begin(api string) Scenario {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[api]++
+	return m.scenario[api]
+}
+
+// fail answers the failure scenarios shared by both APIs; it reports whether it answered.
+func (m *ExternalAPIs) fail(w http.ResponseWriter, r *http.Request, s Scenario) bool {
+	switch s {
+	case ServerError:
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+	case Malformed:
+		writeJSON(w, http.StatusOK, []byte(`{"query": {"search": [`))
+	case Timeout:
+		select {
+		case <-r.Context().Done():
+		case <-m.closed:
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (m *ExternalAPIs) wikipedia(w http.ResponseWriter, r *http.Request) {
+	s := m.begin(Wikipedia)
+	if m.fail(w, r, s) {
+		return
+	}
+	if s == Unauthorized {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	switch {
+	case q.Get("list") == "search" && s == Empty:
+		writeJSON(w, http.StatusOK, []byte(`{"batchcomplete": "", "query": {"search": []}}`))
+	case q.Get("list") == "search":
+		writeJSON(w, http.StatusOK, Fixture("wikipedia_search.json"))
+	case q.Get("prop") == "extracts" && s != Empty && (q.Get("pageids") == "48441598" || q.Get("titles") == "Kubernetes"):
+		writeJSON(w, http.StatusOK, Fixture("wikipedia_article.json"))
+	case q.Get("prop") == "extracts":
+		writeJSON(w, http.StatusOK, Fixture("wikipedia_article_missing.json"))
+	default:
+		http.Error(w, "unsupported query", http.StatusBadRequest)
+	}
+}
+
+func (m *ExternalAPIs) dmi(w http.ResponseWriter, r *http.Request) {
+	s := m.begin(DMI)
+	if m.fail(w, r, s) {
+		return
+	}
+	switch {
+	case s == Unauthorized || r.URL.Query().Get("api-key") != DMIKey:
+		writeJSON(w, http.StatusUnauthorized, Fixture("dmi_unauthorized.json"))
+	case s == Empty:
+		writeJSON(w, http.StatusOK, []byte(`{"type": "FeatureCollection", "features": []}`))
+	default:
+		writeJSON(w, http.StatusOK, Fixture("dmi_forecast.json"))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
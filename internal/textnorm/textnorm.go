@@ -0,0 +1,50 @@
+// Package textnorm normalises search text. Query puts queries in one canonical form (NFC,
+// lowercase), so the same words typed on different keyboards or platforms hit the same cache
+// entries; Fold goes further and removes accents the way PostgreSQL's unaccent does, which is
+// how the database matches accent-insensitively (see migrations/0021_unaccent.sql).
+package textnorm
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// letters are the unaccent rules for letters that do not decompose into a base letter and
+// combining marks (å and é do; æ and ø do not).
+var letters = map[rune]string{
+	'æ': "ae", 'ø': "o", 'œ': "oe", 'ß': "ss", 'ð': "d", 'đ': "d", 'þ': "th", 'ł': "l", 'ı': "i",
+}
+
+// Query returns q in NFC, lowercased, with runs of whitespace collapsed to single spaces.
+func Query(q string) string {
+	return strings.Join(strings.Fields(strings.ToLower(norm.NFC.String(q))), " ")
+}
+
+// Fold returns s lowercased and without accents: "Blåbærgrød" becomes "blabaergrod".
+func Fold(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteString(FoldRune(r))
+	}
+	return b.String()
+}
+
+// FoldRune returns the folded form of a single rune (empty for a combining mark).
+func FoldRune(r rune) string {
+	r = unicode.ToLower(r)
+	if s, ok := letters[r]; ok {
+		return s
+	}
+	if r < 0x80 {
+		return string(r)
+	}
+	var b strings.Builder
+	for _, c := range norm.NFD.String(string(r)) {
+		if !unicode.Is(unicode.Mn, c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+// Package traffic classifies requests for traffic analytics: the kind of client (from the
+// User-Agent) and where a visit came from (from the Referer). Both return a small fixed set
+// of values so they can be used as Prometheus labels.
+package traffic
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Client classes.
+const (
+	ClassBrowser = "browser" // a person using a web browser
+	ClassBot     = "bot"     // crawlers, link previews, monitors and unidentified scrapers
+	ClassAPI     = "api"     // HTTP libraries and command-line tools
+)
+
+// Referrer sources.
+const (
+	SourceDirect   = "direct"   // no Referer
+	SourceInternal = "internal" // a link on this site
+	SourceSearch   = "search"   // a search engine
+	SourceSocial   = "social"   // a social network
+	SourceOther    = "other"
+)
+
+// botTokens identify crawlers and other automated browsers (matched case-insensitively).
+var botTokens = []string{
+	"bot", "crawl", "spider", "slurp", "scrapy", "headless", "phantomjs", "facebookexternalhit",
+	"embedly", "preview", "monitor", "uptime", "lighthouse", "archive.org",
+}
+
+// apiTokens identify HTTP libraries and tools (matched case-insensitively).
+var apiTokens = []string{
+	"curl/", "wget/", "httpie/", "python-requests", "python-urllib", "aiohttp", "go-http-client",
+	"okhttp", "axios", "node-fetch", "undici", "postmanruntime", "insomnia", "java/", "libwww-perl",
+	"grpc-", "k6/",
+}
+
+// searchEngines and socialSites are matched against the referring host and its parent domains.
+var (
+	searchEngines = []string{"google", "bing.com", "duckduckgo.com", "yahoo", "yandex", "ecosia.org", "baidu.com", "startpage.com", "qwant.com", "search.brave.com"}
+	socialSites   = []string{"facebook.com", "t.co", "twitter.com", "x.com", "linkedin.com", "lnkd.in", "reddit.com", "instagram.com", "youtube.com", "mastodon.social", "bsky.app"}
+)
+
+// Classify returns the client class of a request with the given User-Agent to path. Browsers
+// announce themselves as Mozilla (or Opera); anything else that is not a known tool is
+// counted as a bot on pages, but as an API client under /api/ and /graphql.
+func Classify(userAgent, path string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return ClassBot
+	}
+	for _, token := range botTokens {
+		if strings.Contains(ua, token) {
+			return ClassBot
+		}
+	}
+	for _, token := range apiTokens {
+		if strings.Contains(ua, token) {
+			return ClassAPI
+		}
+	}
+	if strings.HasPrefix(ua, "mozilla/") || strings.HasPrefix(ua, "opera/") {
+		return ClassBrowser
+	}
+	if strings.HasPrefix(path, "/api/") || path == "/graphql" {
+		return ClassAPI
+	}
+	return ClassBot
+}
+
+// ReferrerHost returns the host of a Referer header, lowercased and without "www." and port
+// ("" when it is missing or not an http(s) URL).
+func ReferrerHost(referer string) string {
+	u, err := url.Parse(strings.TrimSpace(referer))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// Source returns where a visit with the given Referer came from. ownHosts are this site's
+// hostnames (the request's Host and the public base URL); links from them are internal.
+func Source(referer string, ownHosts ...string) string {
+	if strings.TrimSpace(referer) == "" {
+		return SourceDirect
+	}
+	host := ReferrerHost(referer)
+	if host == "" {
+		return SourceOther
+	}
+	for _, own := range ownHosts {
+		if own != "" && host == ReferrerHost("http://"+own) {
+			return SourceInternal
+		}
+	}
+	switch {
+	case matchesSite(host, searchEngines):
+		return SourceSearch
+	case matchesSite(host, socialSites):
+		return SourceSocial
+	}
+	return SourceOther
+}
+
+// matchesSite reports whether host is one of sites or a subdomain of one. Sites without a
+// dot (e.g. "google") match any of that name's domains (google.com, google.dk, ...).
+func matchesSite(host string, sites []string) bool {
+	for _, site := range sites {
+		if !strings.Contains(site, ".") {
+			labels := strings.Split(host, ".")
+			for _, l := range labels[:len(labels)-1] {
+				if l == site {
+					return true
+				}
+			}
+			continue
+		}
+		if host == site || strings.HasSuffix(host, "."+site) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+// Package urlcheck validates URLs the app is asked to fetch on someone else's behalf (external
+// results promoted into pages, by the promote job or an admin), so they cannot be aimed at
+// the app's own network (SSRF): only absolute http(s) URLs without credentials, whose host is
+// or resolves to public addresses only, pass.
+//
+// Checking the name before the request is not enough on its own: DNS may answer with a
+// public address for the check and a private one for the connection (DNS rebinding). Control
+// closes that gap by checking the address actually being connected to; clients for such URLs
+// (httpclient.NewUntrusted) use both.
+package urlcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+var (
+	// ErrScheme is returned for URLs that are not absolute http or https URLs.
+	ErrScheme = errors.New("urlcheck: only http and https URLs are allowed")
+	// ErrCredentials is returned for URLs with a user name or password.
+	ErrCredentials = errors.New("urlcheck: URLs with credentials are not allowed")
+	// ErrHost is returned for URLs without a usable host name.
+	ErrHost = errors.New("urlcheck: invalid host")
+	// ErrPrivateAddress is returned when a host is or resolves to a non-public address.
+	ErrPrivateAddress = errors.New("urlcheck: address is not public")
+)
+
+// nonPublic are special-purpose ranges netip has no predicate for (RFC 6890 and successors).
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation (TEST-NET-1)
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation (TEST-NET-3)
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, broadcast
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments (Teredo, ORCHID, ...)
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// PublicAddr reports whether ip is a public unicast address. IPv4 addresses embedded in
+// IPv6 (mapped, NAT64, 6to4) are judged by the IPv4 address.
+func PublicAddr(ip netip.Addr) bool {
+	ip = embeddedIPv4(ip.Unmap())
+	if !ip.IsValid() || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublic {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// embeddedIPv4 returns the IPv4 address inside a NAT64 (64:ff9b::/96) or 6to4 (2002::/16)
+// address, and any other address unchanged.
+func embeddedIPv4(ip netip.Addr) netip.Addr {
+	if !ip.Is6() {
+		return ip
+	}
+	b := ip.As16()
+	switch {
+	case netip.MustParsePrefix("64:ff9b::/96").Contains(ip):
+		return netip.AddrFrom4([4]byte(b[12:16]))
+	case netip.MustParsePrefix("2002::/16").Contains(ip):
+		return netip.AddrFrom4([4]byte(b[2:6]))
+	}
+	return ip
+}
+
+// Parse checks what can be checked without DNS: raw must be an absolute http(s) URL without
+// credentials, and a host given as an IP address must be public.
+func Parse(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("urlcheck: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, ErrScheme
+	}
+	if u.User != nil {
+		return nil, ErrCredentials
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" || strings.ContainsAny(host, "%_ ") {
+		return nil, ErrHost
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !PublicAddr(ip) {
+			return nil, fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+		}
+	} else if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return u, nil
+}
+
+// Check is Parse plus DNS: every address the host resolves to must be public, since the
+// connection may use any of them.
+func Check(ctx context.Context, raw string) (*url.URL, error) {
+	u, err := Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		return u, nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("urlcheck: resolve %s: %w", host, err)
+	}
+	for _, ip := range addrs {
+		if !PublicAddr(ip) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrPrivateAddress, host, ip)
+		}
+	}
+	return u, nil
+}
+
+// Control is a net.Dialer Control function that refuses connections to non-public addresses.
+// It runs after name resolution, for the address actually connected to.
+func Control(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("urlcheck: %w", err)
+	}
+	if !PublicAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ap.Addr())
+	}
+	return nil
+}
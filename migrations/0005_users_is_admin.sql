@@ -0,0 +1,5 @@
+-- 0005_users_is_admin.sql
+-- Admin flag for users (guards /admin/* endpoints)
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,13 @@
+-- 0006_user_preferences.sql
+-- Per-user display preferences (anonymous users keep theirs in a cookie instead)
+
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id          INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    theme            VARCHAR(16) NOT NULL DEFAULT 'system'
+                       CHECK (theme IN ('system', 'light', 'dark')),
+    language         VARCHAR(2) NOT NULL DEFAULT 'en'
+                       CHECK (language IN ('en', 'da')),
+    results_per_page INTEGER NOT NULL DEFAULT 50
+                       CHECK (results_per_page BETWEEN 5 AND 100),
+    updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,19 @@
+-- 0007_search_clicks.sql
+-- Which result (rank, URL) users clicked for a query; used for relevance tuning / CTR reports
+
+CREATE TABLE IF NOT EXISTS search_clicks (
+    id         BIGSERIAL PRIMARY KEY,
+    query      TEXT NOT NULL,
+    language   VARCHAR(2) NOT NULL DEFAULT 'en',
+    url        TEXT NOT NULL,
+    rank       INTEGER NOT NULL CHECK (rank >= 1),
+    page_id    INTEGER REFERENCES pages (id) ON DELETE SET NULL,
+    user_id    INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    clicked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_clicks_query_lang
+  ON search_clicks (query, language);
+
+CREATE INDEX IF NOT EXISTS idx_search_clicks_clicked_at
+  ON search_clicks (clicked_at);
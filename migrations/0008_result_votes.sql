@@ -0,0 +1,13 @@
+-- 0008_result_votes.sql
+-- Helpful (+1) / unhelpful (-1) votes on search results; aggregated into the FTS ranking
+
+CREATE TABLE IF NOT EXISTS result_votes (
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    page_id    INTEGER NOT NULL REFERENCES pages (id) ON DELETE CASCADE,
+    vote       SMALLINT NOT NULL CHECK (vote IN (-1, 1)),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, page_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_result_votes_page
+  ON result_votes (page_id);
@@ -0,0 +1,11 @@
+-- 0009_bookmarks.sql
+-- Saved search results per user (one bookmark per user and URL)
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title      TEXT NOT NULL,
+    url        TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT bookmarks_user_url_unique UNIQUE (user_id, url)
+);
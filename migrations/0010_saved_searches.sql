@@ -0,0 +1,28 @@
+-- 0010_saved_searches.sql
+-- Named saved searches (shareable via token) and in-app notifications about new matches
+
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id                BIGSERIAL PRIMARY KEY,
+    user_id           INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name              TEXT NOT NULL,
+    query             TEXT NOT NULL,
+    language          VARCHAR(2) NOT NULL DEFAULT 'en'
+                        CHECK (language IN ('en', 'da')),
+    share_token       TEXT NOT NULL UNIQUE,
+    last_seen_page_id INTEGER NOT NULL DEFAULT 0, -- pages with a higher id are "new" on the next run
+    last_run_at       TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT saved_searches_user_name_unique UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    message    TEXT NOT NULL,
+    url        TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    read_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created
+  ON notifications (user_id, created_at DESC);
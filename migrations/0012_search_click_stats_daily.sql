@@ -0,0 +1,12 @@
+-- 0012_search_click_stats_daily.sql
+-- Daily per-query click rollup (built from search_clicks by the scheduler's stats_rollup task)
+
+CREATE TABLE IF NOT EXISTS search_click_stats_daily (
+    day        DATE NOT NULL,
+    query      TEXT NOT NULL,
+    language   VARCHAR(2) NOT NULL DEFAULT 'en',
+    clicks     INTEGER NOT NULL,
+    avg_rank   DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT search_click_stats_daily_pkey PRIMARY KEY (day, query, language)
+);
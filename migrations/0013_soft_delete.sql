@@ -0,0 +1,13 @@
+-- 0013_soft_delete.sql
+-- Soft delete for users and pages: deleted rows keep deleted_at until the purge_deleted task
+-- removes them after the retention window (SOFT_DELETE_RETENTION)
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+ALTER TABLE pages
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Admin listings and the purge only look at deleted rows
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_pages_deleted_at ON pages (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,6 @@
+-- 0014_pages_version.sql
+-- Optimistic concurrency for page edits: PUT /api/pages/{id} must name the version it edits
+-- (If-Match or body) and bumps it, so concurrent editors get 409 instead of overwriting
+
+ALTER TABLE pages
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
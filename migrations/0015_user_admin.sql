@@ -0,0 +1,33 @@
+-- 0015_user_admin.sql
+-- Admin user management: account status, forced password resets, session revocation
+-- and an audit log of admin actions
+
+-- created_at stays NULL for accounts that existed before this migration
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+ALTER TABLE users
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS must_reset_password BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS password_reset_hash TEXT,          -- sha256 of the emailed reset token
+    ADD COLUMN IF NOT EXISTS password_reset_expires TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS session_version INTEGER NOT NULL DEFAULT 0; -- bump to revoke sessions
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    action      TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id   INTEGER,
+    details     JSONB NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at
+  ON audit_log (created_at);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_target
+  ON audit_log (target_type, target_id);
@@ -0,0 +1,21 @@
+-- 0016_account_status.sql
+-- Account status lifecycle (pending, active, disabled, banned) replacing users.disabled_at
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '',  -- why an admin set the status
+    ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users
+    ADD CONSTRAINT users_status_check CHECK (status IN ('pending', 'active', 'disabled', 'banned'));
+
+UPDATE users
+SET status = 'disabled', status_changed_at = disabled_at
+WHERE disabled_at IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
+
+-- Admins list pending sign-ups and blocked accounts; active ones are the bulk
+CREATE INDEX IF NOT EXISTS idx_users_status
+  ON users (status) WHERE status <> 'active';
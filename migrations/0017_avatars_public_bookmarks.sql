@@ -0,0 +1,11 @@
+-- 0017_avatars_public_bookmarks.sql
+-- Uploaded avatars (object storage key) and bookmarks shown on public profile pages
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS avatar_key TEXT;  -- NULL = Gravatar fallback
+
+ALTER TABLE bookmarks
+    ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_public
+  ON bookmarks (user_id, created_at) WHERE is_public;
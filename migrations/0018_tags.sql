@@ -0,0 +1,18 @@
+-- 0018_tags.sql
+-- Tags for curated topical browsing: admins tag pages, search can filter by tag
+
+CREATE TABLE IF NOT EXISTS tags (
+    id         SERIAL PRIMARY KEY,
+    slug       TEXT NOT NULL UNIQUE,   -- lowercase, used in /search?tag=<slug>
+    name       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS page_tags (
+    page_id INTEGER NOT NULL REFERENCES pages (id) ON DELETE CASCADE,
+    tag_id  INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (page_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_page_tags_tag
+  ON page_tags (tag_id);
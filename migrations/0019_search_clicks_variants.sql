@@ -0,0 +1,5 @@
+-- 0019_search_clicks_variants.sql
+-- A/B experiments: the variants a click's visitor was in ("experiment=variant,..."; '' = none)
+
+ALTER TABLE search_clicks
+    ADD COLUMN IF NOT EXISTS variants TEXT NOT NULL DEFAULT '';
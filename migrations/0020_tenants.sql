@@ -0,0 +1,36 @@
+-- 0020_tenants.sql
+-- Multi-site support: every page and cached external result belongs to a tenant (search corpus).
+-- Requests are mapped to a tenant by hostname or /t/<slug>/ path prefix; existing data stays in
+-- the default tenant (id 1).
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id         SERIAL PRIMARY KEY,
+    slug       TEXT NOT NULL UNIQUE,   -- lowercase, used in the /t/<slug>/ path prefix
+    name       TEXT NOT NULL,
+    hostname   TEXT UNIQUE,            -- optional, e.g. docs.example.com (lowercase, no port)
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO tenants (id, slug, name) VALUES (1, 'default', 'Default')
+ON CONFLICT (id) DO NOTHING;
+SELECT setval(pg_get_serial_sequence('tenants', 'id'), (SELECT MAX(id) FROM tenants));
+
+ALTER TABLE pages
+    ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants (id);
+
+-- Titles and URLs only need to be unique within a tenant
+ALTER TABLE pages DROP CONSTRAINT IF EXISTS pages_title_key;
+ALTER TABLE pages DROP CONSTRAINT IF EXISTS pages_url_key;
+ALTER TABLE pages ADD CONSTRAINT pages_tenant_title_key UNIQUE (tenant_id, title);
+ALTER TABLE pages ADD CONSTRAINT pages_tenant_url_key UNIQUE (tenant_id, url);
+
+ALTER TABLE external_results
+    ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants (id);
+
+ALTER TABLE external_results DROP CONSTRAINT IF EXISTS external_results_unique_result;
+ALTER TABLE external_results
+    ADD CONSTRAINT external_results_unique_result UNIQUE (tenant_id, query, language, url);
+
+DROP INDEX IF EXISTS idx_external_query_lang;
+CREATE INDEX IF NOT EXISTS idx_external_tenant_query_lang
+  ON external_results (tenant_id, query, language);
@@ -0,0 +1,39 @@
+-- 0021_unaccent.sql
+-- Accent-insensitive search: "blabaergrod" finds "Blåbærgrød" and the other way round.
+-- Queries are NFC-normalised and lowercased by the application (internal/textnorm).
+
+CREATE EXTENSION IF NOT EXISTS unaccent;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- 1) unaccent() is only STABLE (its dictionary could change), so it cannot be used in an
+--    index. Pinning the dictionary makes an IMMUTABLE wrapper safe.
+CREATE OR REPLACE FUNCTION f_unaccent(text)
+RETURNS text AS $$
+  SELECT public.unaccent('public.unaccent'::regdictionary, $1)
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+
+-- 2) Index unaccented text for FTS (see 0003_pages_fts.sql)
+CREATE OR REPLACE FUNCTION pages_tsv_trigger()
+RETURNS trigger AS $$
+BEGIN
+  NEW.content_tsv :=
+    to_tsvector(
+      'simple',
+      f_unaccent(coalesce(NEW.title, '') || ' ' || coalesce(NEW.content, ''))
+    );
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+-- 3) Rebuild existing vectors
+UPDATE pages
+SET content_tsv = to_tsvector(
+    'simple',
+    f_unaccent(coalesce(title, '') || ' ' || coalesce(content, ''))
+);
+
+-- 4) Trigram indexes for the substring (ILIKE fallback) search
+CREATE INDEX IF NOT EXISTS idx_pages_title_unaccent_trgm
+  ON pages USING GIN (f_unaccent(lower(title)) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_pages_content_unaccent_trgm
+  ON pages USING GIN (f_unaccent(lower(content)) gin_trgm_ops);
@@ -0,0 +1,5 @@
+-- 0022_audit_client_ip.sql
+-- Record the client address of admin actions (resolved behind trusted proxies, TRUSTED_PROXIES)
+
+ALTER TABLE audit_log
+    ADD COLUMN IF NOT EXISTS client_ip TEXT;
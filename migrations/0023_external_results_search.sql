@@ -0,0 +1,22 @@
+-- 0023_external_results_search.sql
+-- Search the cached external results (Wikipedia) by title and snippet, so results fetched
+-- for one query also show up for related ones (see handlers/search_external_cache.go).
+
+-- 1) Cached snippets keep Wikipedia's highlight markup (<span class="searchmatch">), which
+--    must not be searchable. The SQLite driver registers the same function (internal/dialect).
+CREATE OR REPLACE FUNCTION f_strip_tags(text)
+RETURNS text AS $$
+  SELECT regexp_replace($1, '<[^>]*>', '', 'g')
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+
+-- 2) Full-text index (SEARCH_FTS) on the same unaccented text as pages (0021_unaccent.sql)
+CREATE INDEX IF NOT EXISTS idx_external_results_tsv
+  ON external_results USING GIN (
+    to_tsvector('simple', f_unaccent(title || ' ' || f_strip_tags(snippet)))
+  );
+
+-- 3) Trigram index for the substring search
+CREATE INDEX IF NOT EXISTS idx_external_results_unaccent_trgm
+  ON external_results USING GIN (
+    f_unaccent(lower(title || ' ' || f_strip_tags(snippet))) gin_trgm_ops
+  );
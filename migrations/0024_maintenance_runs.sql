@@ -0,0 +1,20 @@
+-- 0024_maintenance_runs.sql
+-- Database maintenance started from the admin API (handlers/maintenance.go): rebuilding
+-- pages.content_tsv, reindexing the full-text indexes and analyzing pages. One row per run,
+-- with its progress; the db_maintenance job that does the work updates it.
+
+CREATE TABLE IF NOT EXISTS maintenance_runs (
+    id          BIGSERIAL PRIMARY KEY,
+    operation   TEXT NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'queued',
+    done        BIGINT NOT NULL DEFAULT 0,  -- rows (rebuild_fts) or steps done so far
+    total       BIGINT NOT NULL DEFAULT 0,
+    last_error  TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at  TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    CONSTRAINT maintenance_runs_status_check CHECK (status IN ('queued', 'running', 'done', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_runs_status
+  ON maintenance_runs (status);
@@ -0,0 +1,33 @@
+-- 0025_usage_stats.sql
+-- Anonymous usage statistics for GET /api/stats and /stats.
+-- search_log keeps one row per search without user, IP or query text (only a hash, to count
+-- unique queries); stats_rollup aggregates it into stats_daily / stats_daily_languages and
+-- deletes rows older than a week.
+
+CREATE TABLE IF NOT EXISTS search_log (
+    id          BIGSERIAL PRIMARY KEY,
+    day         DATE NOT NULL,                 -- UTC day of the search
+    query_hash  TEXT NOT NULL,                 -- sha256 of the normalised query
+    language    VARCHAR(2) NOT NULL DEFAULT 'en',
+    results     INTEGER NOT NULL,
+    searched_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_log_day
+  ON search_log (day);
+
+CREATE TABLE IF NOT EXISTS stats_daily (
+    day                   DATE PRIMARY KEY,
+    searches              INTEGER NOT NULL,
+    unique_queries        INTEGER NOT NULL,
+    searches_with_results INTEGER NOT NULL,
+    new_users             INTEGER NOT NULL,
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS stats_daily_languages (
+    day      DATE NOT NULL,
+    language VARCHAR(2) NOT NULL,
+    searches INTEGER NOT NULL,
+    CONSTRAINT stats_daily_languages_pkey PRIMARY KEY (day, language)
+);
@@ -0,0 +1,21 @@
+-- 0026_incidents.sql
+-- Incidents shown on the public status page (/status, GET /api/status), written by admins
+-- through /admin/incidents. An incident is active until its status is 'resolved'.
+
+CREATE TABLE IF NOT EXISTS incidents (
+    id          SERIAL PRIMARY KEY,
+    title       TEXT NOT NULL,
+    message     TEXT NOT NULL DEFAULT '',
+    status      VARCHAR(16) NOT NULL DEFAULT 'investigating',
+    severity    VARCHAR(16) NOT NULL DEFAULT 'minor',
+    started_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT incidents_status_check
+      CHECK (status IN ('investigating', 'identified', 'monitoring', 'resolved')),
+    CONSTRAINT incidents_severity_check
+      CHECK (severity IN ('minor', 'major', 'critical'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_incidents_started_at
+  ON incidents (started_at DESC);
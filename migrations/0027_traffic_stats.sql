@@ -0,0 +1,19 @@
+-- 0027_traffic_stats.sql
+-- Daily traffic analytics for GET /admin/reports/traffic.
+-- Each replica adds its in-memory counts every minute (flush_traffic_stats); only the client
+-- class, route template and referring host are stored. stats_rollup deletes rows after 90 days.
+
+CREATE TABLE IF NOT EXISTS traffic_daily (
+    day          DATE NOT NULL,                -- UTC day
+    client_class VARCHAR(16) NOT NULL,         -- browser, bot or api
+    path         TEXT NOT NULL,                -- route template, e.g. /pages/{slug}
+    requests     BIGINT NOT NULL,
+    CONSTRAINT traffic_daily_pkey PRIMARY KEY (day, client_class, path)
+);
+
+CREATE TABLE IF NOT EXISTS referrers_daily (
+    day      DATE NOT NULL,
+    referrer TEXT NOT NULL,                    -- external referring host of page views
+    requests BIGINT NOT NULL,
+    CONSTRAINT referrers_daily_pkey PRIMARY KEY (day, referrer)
+);
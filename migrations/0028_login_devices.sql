@@ -0,0 +1,16 @@
+-- 0028_login_devices.sql
+-- Devices users have logged in from, to email them about logins from a new one.
+-- A device is a hash of the User-Agent and the client's network (/24 or /48); the address
+-- itself is not stored. user_preferences.login_alerts turns the emails off.
+
+CREATE TABLE IF NOT EXISTS user_devices (
+    user_id       INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    fingerprint   VARCHAR(64) NOT NULL,        -- sha256 of User-Agent + network
+    user_agent    TEXT NOT NULL DEFAULT '',    -- shown in the email, truncated
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT user_devices_pkey PRIMARY KEY (user_id, fingerprint)
+);
+
+ALTER TABLE user_preferences
+  ADD COLUMN IF NOT EXISTS login_alerts BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,20 @@
+-- 0029_remember_tokens.sql
+-- Persistent "remember me" logins (selector + validator; only the validator's hash is stored).
+-- session_version is the account's at issue time: tokens stop working when it changes.
+
+CREATE TABLE IF NOT EXISTS remember_tokens (
+    id              BIGSERIAL PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    selector        VARCHAR(24) NOT NULL UNIQUE,
+    validator_hash  VARCHAR(64) NOT NULL,      -- sha256 of the validator, rotated on each use
+    session_version INTEGER NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_remember_tokens_user_id
+  ON remember_tokens (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_remember_tokens_expires_at
+  ON remember_tokens (expires_at);
@@ -0,0 +1,11 @@
+-- 0030_email_change.sql
+-- Pending email changes: the new address is only applied once the link mailed to it is opened.
+-- Like password_reset_hash, only a hash of the confirmation token is stored.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS pending_email TEXT,
+    ADD COLUMN IF NOT EXISTS email_change_hash VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS email_change_expires TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_users_email_change_hash
+  ON users (email_change_hash) WHERE email_change_hash IS NOT NULL;
@@ -0,0 +1,11 @@
+-- 0031_pages_adjacent_index.sql
+-- migrate:no-transaction
+-- Previous/next links on article pages walk pages by id within a tenant and language
+-- (adjacentPage). Built CONCURRENTLY so writes to pages continue during the build, which is
+-- why this file runs outside a transaction. A failed build leaves an INVALID index; the DROP
+-- removes it when the file is run again.
+
+DROP INDEX CONCURRENTLY IF EXISTS idx_pages_tenant_language_id;
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_pages_tenant_language_id
+  ON pages (tenant_id, language, id) WHERE deleted_at IS NULL;
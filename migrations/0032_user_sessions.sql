@@ -0,0 +1,23 @@
+-- 0032_user_sessions.sql
+-- Logged-in sessions, so users can list theirs and sign out single ones. The session cookie
+-- (or Redis entry) holds session_key; a session whose row is gone is logged out on its next
+-- request. remember_selector links the remember-me token the session was started with or
+-- issued, which is revoked with it.
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id                BIGSERIAL PRIMARY KEY,
+    user_id           INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    session_key       VARCHAR(32) NOT NULL UNIQUE,  -- random, stored in the session
+    session_version   INTEGER NOT NULL,             -- the account's at login
+    user_agent        TEXT NOT NULL DEFAULT '',     -- truncated
+    ip                VARCHAR(45) NOT NULL DEFAULT '',
+    remember_selector VARCHAR(24),
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id
+  ON user_sessions (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_last_seen_at
+  ON user_sessions (last_seen_at);
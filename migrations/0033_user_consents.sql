@@ -0,0 +1,17 @@
+-- 0033_user_consents.sql
+-- Terms of service / privacy policy consent (TERMS_VERSION). users.terms_version is the version
+-- the user accepted last; user_consents keeps every acceptance for the account export.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS terms_version VARCHAR(64);
+
+CREATE TABLE IF NOT EXISTS user_consents (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    version     VARCHAR(64) NOT NULL,
+    source      VARCHAR(16) NOT NULL,        -- registration | consent (the interstitial)
+    accepted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_consents_user_id
+  ON user_consents (user_id);
@@ -0,0 +1,9 @@
+-- 0034_preferences_language_set.sql
+-- user_preferences.language_set records whether the user chose the language themselves; until
+-- then requests negotiate it from Accept-Language. Existing rows only count as chosen when
+-- they differ from the default.
+
+ALTER TABLE user_preferences
+    ADD COLUMN IF NOT EXISTS language_set BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE user_preferences SET language_set = TRUE WHERE language <> 'en';
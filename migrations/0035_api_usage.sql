@@ -0,0 +1,13 @@
+-- 0035_api_usage.sql
+-- API calls per user and UTC day, counted against API_DAILY_QUOTA and shown in GET /api/me.
+-- purge_deleted deletes days older than 30 days.
+
+CREATE TABLE IF NOT EXISTS api_usage (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    day     DATE NOT NULL,
+    calls   INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT api_usage_pkey PRIMARY KEY (user_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_usage_day
+  ON api_usage (day);
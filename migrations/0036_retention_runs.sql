@@ -0,0 +1,24 @@
+-- 0036_retention_runs.sql
+-- Data retention runs (handlers/retention.go): the hourly enforce_retention task and runs
+-- started from the admin API delete search_log and external_results rows past
+-- SEARCH_LOG_RETENTION / EXTERNAL_CACHE_RETENTION. One row per run, with the rows it deleted.
+
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id                       BIGSERIAL PRIMARY KEY,
+    trigger_source           TEXT NOT NULL,              -- scheduled | admin
+    status                   TEXT NOT NULL DEFAULT 'queued',
+    search_log_deleted       BIGINT NOT NULL DEFAULT 0,
+    external_results_deleted BIGINT NOT NULL DEFAULT 0,
+    last_error               TEXT,
+    created_at               TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at               TIMESTAMPTZ,
+    finished_at              TIMESTAMPTZ,
+    CONSTRAINT retention_runs_status_check CHECK (status IN ('queued', 'running', 'done', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_retention_runs_status
+  ON retention_runs (status);
+
+-- The batched deletes look up the oldest rows by creation time.
+CREATE INDEX IF NOT EXISTS idx_external_results_created_at
+  ON external_results (created_at);
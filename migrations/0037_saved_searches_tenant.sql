@@ -0,0 +1,7 @@
+-- 0037_saved_searches_tenant.sql
+-- A saved search belongs to the tenant it was saved in: run_saved_searches only counts that
+-- tenant's new pages and links to its search. Existing saved searches stay in the default
+-- tenant (id 1), which held every page before tenants existed.
+
+ALTER TABLE saved_searches
+    ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants (id);
@@ -0,0 +1,6 @@
+-- 0038_jobs_leased_by.sql
+-- The lease token of a running job. A worker only finishes, fails or renews the job while the
+-- token is still its own, so a worker whose lease expired and was taken over cannot overwrite
+-- the new owner's result.
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS leased_by TEXT;
@@ -0,0 +1,232 @@
+-- 0001_baseline.sql
+-- SQLite schema for DB_DRIVER=sqlite (single-binary demo), matching the PostgreSQL
+-- migrations up to 0022. Keep internal/db/schema.sql (tests) and this file in step; schema
+-- changes after the baseline get their own numbered file here, next to the PostgreSQL one.
+
+-- ===============================
+-- users table
+-- ===============================
+CREATE TABLE IF NOT EXISTS users (
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  username  TEXT NOT NULL UNIQUE,
+  email     TEXT NOT NULL UNIQUE,
+  password  TEXT NOT NULL,
+  is_admin  BOOLEAN NOT NULL DEFAULT FALSE,
+  deleted_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  last_login_at TIMESTAMP,
+  status    TEXT NOT NULL CHECK(status IN ('pending', 'active', 'disabled', 'banned')) DEFAULT 'active',
+  status_reason TEXT NOT NULL DEFAULT '',
+  status_changed_at TIMESTAMP,
+  must_reset_password BOOLEAN NOT NULL DEFAULT FALSE,
+  password_reset_hash TEXT,
+  password_reset_expires TIMESTAMP,
+  session_version INTEGER NOT NULL DEFAULT 0,
+  avatar_key TEXT
+);
+
+-- ===============================
+-- tenants table (search corpora; pages default to tenant 1)
+-- ===============================
+CREATE TABLE IF NOT EXISTS tenants (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  slug       TEXT NOT NULL UNIQUE,
+  name       TEXT NOT NULL,
+  hostname   TEXT UNIQUE,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO tenants (id, slug, name) VALUES (1, 'default', 'Default');
+
+-- ===============================
+-- pages table
+-- ===============================
+CREATE TABLE IF NOT EXISTS pages (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  title        TEXT,
+  url          TEXT,
+  language     TEXT NOT NULL CHECK(language IN ('en', 'da')) DEFAULT 'en',
+  last_updated TIMESTAMP,
+  content      TEXT NOT NULL,
+  deleted_at   TIMESTAMP,
+  version      INTEGER NOT NULL DEFAULT 1,
+  tenant_id    INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
+  UNIQUE(tenant_id, title),
+  UNIQUE(tenant_id, url)
+);
+
+-- Sample content
+INSERT OR IGNORE INTO pages (title, url, language, last_updated, content)
+VALUES
+  ('Welcome', '/welcome', 'en', CURRENT_TIMESTAMP,
+   'Welcome to WhoKnows, the best search engine!'),
+  ('About Us', '/about', 'en', CURRENT_TIMESTAMP,
+   'We intend to build the world’s best search engine.');
+
+-- ===============================
+-- external_results table (Wikipedia / external cache)
+-- ===============================
+CREATE TABLE IF NOT EXISTS external_results (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  query      TEXT NOT NULL,
+  language   TEXT NOT NULL,
+  title      TEXT NOT NULL,
+  url        TEXT NOT NULL,
+  snippet    TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  tenant_id  INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id),
+  UNIQUE(tenant_id, query, language, url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_external_tenant_query_lang
+  ON external_results (tenant_id, query, language);
+
+-- ===============================
+-- user_preferences table
+-- ===============================
+CREATE TABLE IF NOT EXISTS user_preferences (
+  user_id          INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  theme            TEXT NOT NULL CHECK(theme IN ('system', 'light', 'dark')) DEFAULT 'system',
+  language         TEXT NOT NULL CHECK(language IN ('en', 'da')) DEFAULT 'en',
+  results_per_page INTEGER NOT NULL CHECK(results_per_page BETWEEN 5 AND 100) DEFAULT 50,
+  updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ===============================
+-- search_clicks table
+-- ===============================
+CREATE TABLE IF NOT EXISTS search_clicks (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  query      TEXT NOT NULL,
+  language   TEXT NOT NULL DEFAULT 'en',
+  url        TEXT NOT NULL,
+  rank       INTEGER NOT NULL CHECK(rank >= 1),
+  page_id    INTEGER REFERENCES pages(id) ON DELETE SET NULL,
+  user_id    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  clicked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  variants   TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_clicks_query_lang
+  ON search_clicks (query, language);
+
+-- ===============================
+-- result_votes table
+-- ===============================
+CREATE TABLE IF NOT EXISTS result_votes (
+  user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  page_id    INTEGER NOT NULL REFERENCES pages(id) ON DELETE CASCADE,
+  vote       INTEGER NOT NULL CHECK(vote IN (-1, 1)),
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, page_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_result_votes_page
+  ON result_votes (page_id);
+
+-- ===============================
+-- bookmarks table
+-- ===============================
+CREATE TABLE IF NOT EXISTS bookmarks (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  title      TEXT NOT NULL,
+  url        TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  is_public  BOOLEAN NOT NULL DEFAULT FALSE,
+  UNIQUE(user_id, url)
+);
+
+-- ===============================
+-- saved_searches / notifications tables
+-- ===============================
+CREATE TABLE IF NOT EXISTS saved_searches (
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id           INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name              TEXT NOT NULL,
+  query             TEXT NOT NULL,
+  language          TEXT NOT NULL CHECK(language IN ('en', 'da')) DEFAULT 'en',
+  share_token       TEXT NOT NULL UNIQUE,
+  last_seen_page_id INTEGER NOT NULL DEFAULT 0,
+  last_run_at       TIMESTAMP,
+  created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE(user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  message    TEXT NOT NULL,
+  url        TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  read_at    TIMESTAMP
+);
+
+-- ===============================
+-- jobs table
+-- ===============================
+CREATE TABLE IF NOT EXISTS jobs (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  type         TEXT NOT NULL,
+  payload      TEXT NOT NULL DEFAULT '{}',
+  status       TEXT NOT NULL CHECK(status IN ('queued', 'running', 'done', 'failed')) DEFAULT 'queued',
+  attempts     INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 5,
+  run_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  locked_until TIMESTAMP,
+  last_error   TEXT,
+  created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status_run_at
+  ON jobs (status, run_at);
+
+-- ===============================
+-- search_click_stats_daily table
+-- ===============================
+CREATE TABLE IF NOT EXISTS search_click_stats_daily (
+  day        TEXT NOT NULL,
+  query      TEXT NOT NULL,
+  language   TEXT NOT NULL DEFAULT 'en',
+  clicks     INTEGER NOT NULL,
+  avg_rank   REAL NOT NULL,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (day, query, language)
+);
+
+-- ===============================
+-- audit_log table
+-- ===============================
+CREATE TABLE IF NOT EXISTS audit_log (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  actor_id    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  action      TEXT NOT NULL,
+  target_type TEXT NOT NULL,
+  target_id   INTEGER,
+  details     TEXT NOT NULL DEFAULT '{}',
+  client_ip   TEXT,
+  created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at
+  ON audit_log (created_at);
+
+-- ===============================
+-- tags and page_tags tables
+-- ===============================
+CREATE TABLE IF NOT EXISTS tags (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  slug       TEXT NOT NULL UNIQUE,
+  name       TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS page_tags (
+  page_id INTEGER NOT NULL REFERENCES pages(id) ON DELETE CASCADE,
+  tag_id  INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  PRIMARY KEY (page_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_page_tags_tag
+  ON page_tags (tag_id);
@@ -0,0 +1,29 @@
+-- 0002_pages_fts.sql
+-- Full-text search for SQLite (the counterpart of 0003_pages_fts.sql / 0021_unaccent.sql):
+-- an FTS5 index over pages.title and pages.content, kept in sync by triggers.
+-- unicode61 with remove_diacritics folds accents that decompose (å, é), so matching is
+-- accent-insensitive like f_unaccent; letters such as æ and ø are kept as they are.
+
+CREATE VIRTUAL TABLE IF NOT EXISTS pages_fts USING fts5(
+  title,
+  content,
+  content = 'pages',
+  content_rowid = 'id',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS pages_fts_insert AFTER INSERT ON pages BEGIN
+  INSERT INTO pages_fts (rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS pages_fts_delete AFTER DELETE ON pages BEGIN
+  INSERT INTO pages_fts (pages_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS pages_fts_update AFTER UPDATE OF title, content ON pages BEGIN
+  INSERT INTO pages_fts (pages_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+  INSERT INTO pages_fts (rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+-- Index the pages that already exist (the baseline's sample content).
+INSERT INTO pages_fts (pages_fts) VALUES ('rebuild');
@@ -0,0 +1,17 @@
+-- 0003_maintenance_runs.sql
+-- Progress of admin-started database maintenance (the counterpart of 0024_maintenance_runs.sql).
+
+CREATE TABLE IF NOT EXISTS maintenance_runs (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  operation   TEXT NOT NULL,
+  status      TEXT NOT NULL CHECK(status IN ('queued', 'running', 'done', 'failed')) DEFAULT 'queued',
+  done        INTEGER NOT NULL DEFAULT 0,
+  total       INTEGER NOT NULL DEFAULT 0,
+  last_error  TEXT,
+  created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  started_at  TIMESTAMP,
+  finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_runs_status
+  ON maintenance_runs (status);
@@ -0,0 +1,30 @@
+-- 0004_usage_stats.sql
+-- Anonymous usage statistics (the counterpart of 0025_usage_stats.sql).
+
+CREATE TABLE IF NOT EXISTS search_log (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  day         TEXT NOT NULL,
+  query_hash  TEXT NOT NULL,
+  language    TEXT NOT NULL DEFAULT 'en',
+  results     INTEGER NOT NULL,
+  searched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_log_day
+  ON search_log (day);
+
+CREATE TABLE IF NOT EXISTS stats_daily (
+  day                   TEXT PRIMARY KEY,
+  searches              INTEGER NOT NULL,
+  unique_queries        INTEGER NOT NULL,
+  searches_with_results INTEGER NOT NULL,
+  new_users             INTEGER NOT NULL,
+  updated_at            TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS stats_daily_languages (
+  day      TEXT NOT NULL,
+  language TEXT NOT NULL,
+  searches INTEGER NOT NULL,
+  PRIMARY KEY (day, language)
+);
@@ -0,0 +1,18 @@
+-- 0005_incidents.sql
+-- Status page incidents (the counterpart of 0026_incidents.sql).
+
+CREATE TABLE IF NOT EXISTS incidents (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  title       TEXT NOT NULL,
+  message     TEXT NOT NULL DEFAULT '',
+  status      TEXT NOT NULL DEFAULT 'investigating'
+    CHECK (status IN ('investigating', 'identified', 'monitoring', 'resolved')),
+  severity    TEXT NOT NULL DEFAULT 'minor'
+    CHECK (severity IN ('minor', 'major', 'critical')),
+  started_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  resolved_at TIMESTAMP,
+  updated_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_incidents_started_at
+  ON incidents (started_at DESC);
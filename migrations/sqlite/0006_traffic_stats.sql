@@ -0,0 +1,17 @@
+-- 0006_traffic_stats.sql
+-- Daily traffic analytics (the counterpart of 0027_traffic_stats.sql).
+
+CREATE TABLE IF NOT EXISTS traffic_daily (
+  day          TEXT NOT NULL,
+  client_class TEXT NOT NULL,
+  path         TEXT NOT NULL,
+  requests     INTEGER NOT NULL,
+  PRIMARY KEY (day, client_class, path)
+);
+
+CREATE TABLE IF NOT EXISTS referrers_daily (
+  day      TEXT NOT NULL,
+  referrer TEXT NOT NULL,
+  requests INTEGER NOT NULL,
+  PRIMARY KEY (day, referrer)
+);
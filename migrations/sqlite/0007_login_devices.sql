@@ -0,0 +1,13 @@
+-- 0007_login_devices.sql
+-- Devices users have logged in from (the counterpart of 0028_login_devices.sql).
+
+CREATE TABLE IF NOT EXISTS user_devices (
+  user_id       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  fingerprint   TEXT NOT NULL,
+  user_agent    TEXT NOT NULL DEFAULT '',
+  first_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, fingerprint)
+);
+
+ALTER TABLE user_preferences ADD COLUMN login_alerts BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,19 @@
+-- 0008_remember_tokens.sql
+-- Persistent "remember me" logins (the counterpart of 0029_remember_tokens.sql).
+
+CREATE TABLE IF NOT EXISTS remember_tokens (
+  id              INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id         INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  selector        TEXT NOT NULL UNIQUE,
+  validator_hash  TEXT NOT NULL,
+  session_version INTEGER NOT NULL,
+  expires_at      TIMESTAMP NOT NULL,
+  created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_used_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_remember_tokens_user_id
+  ON remember_tokens (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_remember_tokens_expires_at
+  ON remember_tokens (expires_at);
@@ -0,0 +1,6 @@
+-- 0009_email_change.sql
+-- Pending email changes (the counterpart of 0030_email_change.sql).
+
+ALTER TABLE users ADD COLUMN pending_email TEXT;
+ALTER TABLE users ADD COLUMN email_change_hash TEXT;
+ALTER TABLE users ADD COLUMN email_change_expires TIMESTAMP;
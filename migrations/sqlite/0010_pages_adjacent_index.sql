@@ -0,0 +1,6 @@
+-- 0010_pages_adjacent_index.sql
+-- Previous/next links on article pages (the counterpart of 0031_pages_adjacent_index.sql,
+-- which builds it concurrently).
+
+CREATE INDEX IF NOT EXISTS idx_pages_tenant_language_id
+  ON pages (tenant_id, language, id) WHERE deleted_at IS NULL;
@@ -0,0 +1,20 @@
+-- 0011_user_sessions.sql
+-- Logged-in sessions (the counterpart of 0032_user_sessions.sql).
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id           INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  session_key       TEXT NOT NULL UNIQUE,
+  session_version   INTEGER NOT NULL,
+  user_agent        TEXT NOT NULL DEFAULT '',
+  ip                TEXT NOT NULL DEFAULT '',
+  remember_selector TEXT,
+  created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id
+  ON user_sessions (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_last_seen_at
+  ON user_sessions (last_seen_at);
@@ -0,0 +1,15 @@
+-- 0012_user_consents.sql
+-- Terms of service / privacy policy consent (the counterpart of 0033_user_consents.sql).
+
+ALTER TABLE users ADD COLUMN terms_version TEXT;
+
+CREATE TABLE IF NOT EXISTS user_consents (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  version     TEXT NOT NULL,
+  source      TEXT NOT NULL,
+  accepted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_consents_user_id
+  ON user_consents (user_id);
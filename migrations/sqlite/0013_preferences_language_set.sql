@@ -0,0 +1,6 @@
+-- 0013_preferences_language_set.sql
+-- Whether the user chose their language (the counterpart of 0034_preferences_language_set.sql).
+
+ALTER TABLE user_preferences ADD COLUMN language_set BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE user_preferences SET language_set = TRUE WHERE language <> 'en';
@@ -0,0 +1,12 @@
+-- 0014_api_usage.sql
+-- API calls per user and UTC day (the counterpart of 0035_api_usage.sql).
+
+CREATE TABLE IF NOT EXISTS api_usage (
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  day     TEXT NOT NULL,
+  calls   INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (user_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_usage_day
+  ON api_usage (day);
@@ -0,0 +1,20 @@
+-- 0015_retention_runs.sql
+-- Data retention runs (the counterpart of 0036_retention_runs.sql).
+
+CREATE TABLE IF NOT EXISTS retention_runs (
+  id                       INTEGER PRIMARY KEY AUTOINCREMENT,
+  trigger_source           TEXT NOT NULL,
+  status                   TEXT NOT NULL CHECK(status IN ('queued', 'running', 'done', 'failed')) DEFAULT 'queued',
+  search_log_deleted       INTEGER NOT NULL DEFAULT 0,
+  external_results_deleted INTEGER NOT NULL DEFAULT 0,
+  last_error               TEXT,
+  created_at               TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  started_at               TIMESTAMP,
+  finished_at              TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_retention_runs_status
+  ON retention_runs (status);
+
+CREATE INDEX IF NOT EXISTS idx_external_results_created_at
+  ON external_results (created_at);
@@ -0,0 +1,4 @@
+-- 0016_saved_searches_tenant.sql
+-- The tenant of a saved search (the counterpart of 0037_saved_searches_tenant.sql).
+
+ALTER TABLE saved_searches ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
@@ -0,0 +1,4 @@
+-- 0017_jobs_leased_by.sql
+-- The lease token of a running job (the counterpart of 0038_jobs_leased_by.sql).
+
+ALTER TABLE jobs ADD COLUMN leased_by TEXT;
@@ -0,0 +1,11 @@
+// Package static embeds the files served under /static/ (CSS, images) into the binary, so a
+// deploy cannot pair a new binary with old assets. handlers serves them fingerprinted.
+package static
+
+import "embed"
+
+// FS holds every file of this directory. Go files (this one) are not served; a .br or .gz
+// file is the precompressed variant of the file without that extension.
+//
+//go:embed *
+var FS embed.FS
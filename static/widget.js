@@ -0,0 +1,64 @@
+// WhoKnows search widget. Embed it with
+//
+//   <div data-whoknows-search data-language="en" data-limit="5"></div>
+//   <script src="https://whoknows.example.com/static/widget.js" async></script>
+//
+// Every element with data-whoknows-search gets a search box; results come from
+// /api/search/widget next to this script, so the app can be mounted under a BASE_PATH.
+(() => {
+  'use strict';
+
+  const script = document.currentScript;
+  if (!script) return;
+  const endpoint = new URL('../api/search/widget', script.src);
+
+  const el = (tag, props = {}) => Object.assign(document.createElement(tag), props);
+
+  const render = (list, data) => {
+    list.replaceChildren();
+    if (data.results.length === 0) {
+      list.append(el('li', {className: 'whoknows-empty', textContent: 'No results'}));
+    }
+    for (const r of data.results) {
+      const item = el('li', {className: 'whoknows-result'});
+      item.append(el('a', {href: r.url, textContent: r.title, target: '_blank', rel: 'noopener'}));
+      if (r.snippet) item.append(el('p', {textContent: r.snippet}));
+      list.append(item);
+    }
+    const more = el('li', {className: 'whoknows-more'});
+    more.append(el('a', {href: data.more, textContent: 'All results on WhoKnows', target: '_blank', rel: 'noopener'}));
+    list.append(more);
+  };
+
+  const setup = (box) => {
+    const form = el('form', {className: 'whoknows-form', role: 'search'});
+    const input = el('input', {type: 'search', name: 'q', placeholder: 'Search WhoKnows', required: true});
+    form.append(input, el('button', {type: 'submit', textContent: 'Search'}));
+    const list = el('ul', {className: 'whoknows-results'});
+    list.setAttribute('aria-live', 'polite');
+    box.append(form, list);
+
+    form.addEventListener('submit', async (ev) => {
+      ev.preventDefault();
+      const url = new URL(endpoint);
+      url.searchParams.set('q', input.value.trim());
+      if (box.dataset.language) url.searchParams.set('language', box.dataset.language);
+      if (box.dataset.limit) url.searchParams.set('limit', box.dataset.limit);
+      try {
+        const res = await fetch(url, {credentials: 'omit'});
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        render(list, await res.json());
+      } catch (err) {
+        list.replaceChildren(el('li', {className: 'whoknows-error', textContent: 'Search is unavailable right now.'}));
+        console.warn('whoknows widget:', err);
+      }
+    });
+
+    if (box.dataset.query) {
+      input.value = box.dataset.query;
+      form.requestSubmit();
+    }
+  };
+
+  document.querySelectorAll('[data-whoknows-search]').forEach(setup);
+})();
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/jobs"
+)
+
+// accountPost sends a JSON body to one of the /api/me account endpoints.
+func accountPost(t *testing.T, router http.Handler, cookies []*http.Cookie, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Changing the password needs the current one, keeps the session it was made from, signs
+// out every other session and emails the account.
+func TestChangePassword(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetJobQueue(jobs.New(db, jobs.Options{}))
+	defer h.SetJobQueue(nil)
+
+	other := registerAndLogin(t, router, "mira", "secret123")
+	form := url.Values{"username": {"mira"}, "password": {"secret123"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	current := rr.Result().Cookies()
+
+	if rr := accountPost(t, router, current, "/api/me/password",
+		`{"current_password":"wrong","new_password":"n3w-secret","new_password2":"n3w-secret"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("wrong current password: expected 403, got %d", rr.Code)
+	}
+	if rr := accountPost(t, router, current, "/api/me/password",
+		`{"current_password":"secret123","new_password":"n3w-secret","new_password2":"other"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("mismatched passwords: expected 400, got %d", rr.Code)
+	}
+	rr = accountPost(t, router, current, "/api/me/password",
+		`{"current_password":"secret123","new_password":"n3w-secret","new_password2":"n3w-secret"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"email_queued":true`) {
+		t.Fatalf("change password: got %d %s", rr.Code, rr.Body.String())
+	}
+	if c := findCookie(rr.Result().Cookies(), "session"); c != nil {
+		current = []*http.Cookie{c}
+	}
+
+	bookmarks := func(cookies []*http.Cookie) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/me/bookmarks", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := bookmarks(current); code != http.StatusOK {
+		t.Fatalf("the session that changed the password must stay logged in, got %d", code)
+	}
+	if code := bookmarks(other); code != http.StatusUnauthorized {
+		t.Fatalf("other sessions must be signed out, got %d", code)
+	}
+
+	var to string
+	if err := db.QueryRow(`SELECT payload FROM jobs WHERE type = $1`, h.JobSendEmail).Scan(&to); err != nil ||
+		!strings.Contains(to, "mira@example.com") {
+		t.Fatalf("expected a notification email, got %q (%v)", to, err)
+	}
+	var audited int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = 'user.password_changed'`).Scan(&audited); err != nil || audited != 1 {
+		t.Fatalf("expected 1 audit entry, got %d (%v)", audited, err)
+	}
+}
+
+// A new email only takes effect once the link mailed to it is opened; addresses of other
+// accounts are refused.
+func TestChangeEmail(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetJobQueue(jobs.New(db, jobs.Options{}))
+	defer h.SetJobQueue(nil)
+
+	registerAndLogin(t, router, "taken", "secret123")
+	cookies := registerAndLogin(t, router, "noor", "secret123")
+
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`{"current_password":"wrong","email":"noor@example.org"}`, http.StatusForbidden},
+		{`{"current_password":"secret123","email":"not an email"}`, http.StatusBadRequest},
+		{`{"current_password":"secret123","email":"noor@example.com"}`, http.StatusBadRequest},
+		{`{"current_password":"secret123","email":"taken@example.com"}`, http.StatusConflict},
+		{`{"current_password":"secret123","email":"noor@example.org"}`, http.StatusAccepted},
+	} {
+		if rr := accountPost(t, router, cookies, "/api/me/email", tc.body); rr.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d %s", tc.body, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	var email string
+	if err := db.QueryRow(`SELECT email FROM users WHERE username = 'noor'`).Scan(&email); err != nil || email != "noor@example.com" {
+		t.Fatalf("the email must not change before confirmation, got %q (%v)", email, err)
+	}
+
+	rows, err := db.Query(`SELECT payload FROM jobs WHERE type = $1 ORDER BY id`, h.JobSendEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var link string
+	var notified bool
+	for rows.Next() {
+		var raw string
+		var m h.SendEmailPayload
+		if err := rows.Scan(&raw); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(raw), &m); err != nil {
+			t.Fatal(err)
+		}
+		switch m.To {
+		case "noor@example.org":
+			if i := strings.Index(m.Body, "/confirm-email?token="); i >= 0 {
+				link = strings.Fields(m.Body[i:])[0]
+			}
+		case "noor@example.com":
+			notified = true
+		}
+	}
+	_ = rows.Close()
+	if link == "" || !notified {
+		t.Fatalf("expected a confirmation link to the new address and a notice to the old one (link %q, notified %v)", link, notified)
+	}
+
+	confirm := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, link, nil))
+		return rr
+	}
+	if rr := confirm(); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Your email address has been changed") {
+		t.Fatalf("confirm: got %d", rr.Code)
+	}
+	if err := db.QueryRow(`SELECT email FROM users WHERE username = 'noor'`).Scan(&email); err != nil || email != "noor@example.org" {
+		t.Fatalf("expected the new email, got %q (%v)", email, err)
+	}
+	if rr := confirm(); !strings.Contains(rr.Body.String(), "invalid or has expired") {
+		t.Fatal("the link must only work once")
+	}
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// With registration approval, sign-ups are pending until an admin activates them; a ban
+// ends the user's session with 403 and the reason is audit-logged.
+func TestAccountStatus_Lifecycle(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "statusadmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'statusadmin'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+	admin := adminClient(router, cookies)
+
+	h.SetRegistrationApproval(true)
+	defer h.SetRegistrationApproval(false)
+
+	form := "username=dave&email=dave@example.com&password=secret&password2=secret"
+	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect after register, got %d", rr.Code)
+	}
+	if code := loginStatus(router, "dave", "secret"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a pending account, got %d", code)
+	}
+	if code := loginStatus(router, "dave", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password must not reveal the account status, got %d", code)
+	}
+
+	var daveID int
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'dave'`).Scan(&daveID); err != nil {
+		t.Fatal(err)
+	}
+	davePath := "/admin/users/" + strconv.Itoa(daveID) + "/status"
+
+	if rr := admin(http.MethodPost, davePath, `{"status":"disabled","reason":"x"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for pending -> disabled, got %d", rr.Code)
+	}
+	rr = admin(http.MethodPost, davePath, `{"status":"active"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var u h.AdminUser
+	if err := json.Unmarshal(rr.Body.Bytes(), &u); err != nil || u.Status != h.UserStatusActive || u.StatusChangedAt == nil {
+		t.Fatalf("unexpected user after approval: %+v (err %v)", u, err)
+	}
+
+	form = "username=dave&password=secret"
+	req = httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("approved user cannot log in, got %d", rr.Code)
+	}
+	dave := adminClient(router, rr.Result().Cookies())
+
+	if rr := admin(http.MethodPost, davePath, `{"status":"banned"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a ban without reason, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPost, davePath, `{"status":"banned","reason":"spam"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = dave(http.MethodGet, "/bookmarks", "")
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "This account has been banned") {
+		t.Fatalf("expected HTML 403 with the reason, got %d", rr.Code)
+	}
+	// Replaying the old cookie does not help.
+	if rr := dave(http.MethodGet, "/api/me/bookmarks", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for the replayed session, got %d", rr.Code)
+	}
+	if code := loginStatus(router, "dave", "secret"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a banned account, got %d", code)
+	}
+	if rr := admin(http.MethodPost, davePath, `{"status":"disabled","reason":"x"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for banned -> disabled, got %d", rr.Code)
+	}
+
+	rr = admin(http.MethodGet, "/admin/users?status=banned", "")
+	var list h.AdminUserListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || list.Total != 1 || list.Users[0].StatusReason != "spam" {
+		t.Fatalf("unexpected banned users: %s", rr.Body.String())
+	}
+
+	var details string
+	if err := db.QueryRow(`SELECT details FROM audit_log WHERE action = 'user.status' AND target_id = $1 ORDER BY id DESC LIMIT 1`, daveID).Scan(&details); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(details, `"reason":"spam"`) || !strings.Contains(details, `"from":"active"`) {
+		t.Fatalf("unexpected audit details: %s", details)
+	}
+}
+
+// A session of a disabled user answers API requests with a JSON 403.
+func TestAccountStatus_DisabledSessionJSON(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "erin", "secret")
+	if _, err := db.Exec(`UPDATE users SET status = 'disabled' WHERE username = 'erin'`); err != nil {
+		t.Fatal(err)
+	}
+	rr := adminClient(router, cookies)(http.MethodGet, "/api/me/preferences", "")
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	var body h.APIErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Error != "This account has been disabled" {
+		t.Fatalf("unexpected body: %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/jobs"
+)
+
+// adminClient sends requests to router with the given session cookies.
+func adminClient(router http.Handler, cookies []*http.Cookie) func(method, path, body string) *httptest.ResponseRecorder {
+	return func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+}
+
+// Listing with filters and pagination, the activity summary, and disable/enable: disabling
+// ends the user's session and blocks login, and both changes are audit-logged.
+func TestAdminUsers_ListDetailDisableEnable(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "useradmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'useradmin'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+	aliceCookies := registerAndLogin(t, router, "alice", "secret")
+	registerAndLogin(t, router, "bob", "secret")
+	admin := adminClient(router, cookies)
+
+	var adminID, aliceID int
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'useradmin'`).Scan(&adminID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'alice'`).Scan(&aliceID); err != nil {
+		t.Fatal(err)
+	}
+	alicePath := "/admin/users/" + strconv.Itoa(aliceID)
+
+	list := func(query string) h.AdminUserListResponse {
+		t.Helper()
+		rr := admin(http.MethodGet, "/admin/users"+query, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET /admin/users%s: expected 200, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var resp h.AdminUserListResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return resp
+	}
+	if resp := list("?q=ALI"); resp.Total != 1 || len(resp.Users) != 1 || resp.Users[0].Username != "alice" {
+		t.Fatalf("unexpected search result: %+v", resp)
+	}
+	for _, wildcard := range []string{"%25", "_"} {
+		if resp := list("?q=" + wildcard); resp.Total != 0 {
+			t.Fatalf("q=%s must match literally, got %+v", wildcard, resp)
+		}
+	}
+	if resp := list("?limit=1&offset=1"); resp.Total != 3 || len(resp.Users) != 1 || resp.Users[0].Username != "alice" {
+		t.Fatalf("unexpected page: %+v", resp)
+	}
+	if resp := list("?admin=true"); resp.Total != 1 || resp.Users[0].ID != adminID {
+		t.Fatalf("unexpected admin filter result: %+v", resp)
+	}
+	if rr := admin(http.MethodGet, "/admin/users?status=bogus", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown status, got %d", rr.Code)
+	}
+
+	if _, err := db.Exec(`INSERT INTO bookmarks (user_id, title, url) VALUES ($1, 'Go', '/go')`, aliceID); err != nil {
+		t.Fatal(err)
+	}
+	rr := admin(http.MethodGet, alicePath, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var detail h.AdminUserDetail
+	if err := json.Unmarshal(rr.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if detail.Status != h.UserStatusActive || detail.LastLoginAt == nil || detail.Activity.Bookmarks != 1 {
+		t.Fatalf("unexpected detail: %+v", detail)
+	}
+
+	if rr := admin(http.MethodPost, "/admin/users/"+strconv.Itoa(adminID)+"/disable", `{"reason":"test"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when disabling own account, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPost, alicePath+"/disable", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a reason, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPost, alicePath+"/disable", `{"reason":"compromised"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := adminClient(router, aliceCookies)(http.MethodGet, "/api/me/bookmarks", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("disabled user's session still works, got %d", rr.Code)
+	}
+	if code := loginStatus(router, "alice", "secret"); code == http.StatusFound {
+		t.Fatal("disabled user could still log in")
+	}
+	if resp := list("?status=disabled"); resp.Total != 1 || resp.Users[0].ID != aliceID {
+		t.Fatalf("unexpected disabled users: %+v", resp)
+	}
+
+	if rr := admin(http.MethodPost, alicePath+"/enable", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if code := loginStatus(router, "alice", "secret"); code != http.StatusFound {
+		t.Fatalf("re-enabled user cannot log in, got %d", code)
+	}
+
+	rr = admin(http.MethodGet, "/admin/audit?target_type=user&target_id="+strconv.Itoa(aliceID), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var auditLog h.AdminAuditLogResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &auditLog); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(auditLog.Entries) != 2 || auditLog.Entries[0].Details["to"] != h.UserStatusActive ||
+		auditLog.Entries[1].Details["to"] != h.UserStatusDisabled || auditLog.Entries[1].Details["reason"] != "compromised" {
+		t.Fatalf("unexpected audit log: %+v", auditLog)
+	}
+	if e := auditLog.Entries[1]; e.ActorID == nil || *e.ActorID != adminID {
+		t.Fatalf("audit entry without the acting admin: %+v", e)
+	}
+}
+
+// A forced reset ends the session and blocks login until the user sets a new password
+// through the emailed single-use link.
+func TestAdminUsers_ForcedPasswordReset(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	h.SetJobQueue(jobs.New(db, jobs.Options{}))
+	defer h.SetJobQueue(nil)
+
+	cookies := registerAndLogin(t, router, "resetadmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'resetadmin'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+	bobCookies := registerAndLogin(t, router, "bob", "secret")
+	var bobID int
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'bob'`).Scan(&bobID); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := adminClient(router, cookies)(http.MethodPost, "/admin/users/"+strconv.Itoa(bobID)+"/reset-password", "")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp h.AdminPasswordResetResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || !resp.EmailQueued {
+		t.Fatalf("expected a queued email, got %+v (err %v)", resp, err)
+	}
+	if rr := adminClient(router, bobCookies)(http.MethodGet, "/api/me/bookmarks", ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("session survived the password reset, got %d", rr.Code)
+	}
+	if code := loginStatus(router, "bob", "secret"); code == http.StatusFound {
+		t.Fatal("user could log in with the old password after a forced reset")
+	}
+
+	var raw string
+	if err := db.QueryRow(`SELECT payload FROM jobs WHERE type = $1`, h.JobSendEmail).Scan(&raw); err != nil {
+		t.Fatal(err)
+	}
+	var mail h.SendEmailPayload
+	if err := json.Unmarshal([]byte(raw), &mail); err != nil {
+		t.Fatalf("invalid email payload: %v", err)
+	}
+	_, rest, ok := strings.Cut(mail.Body, "/reset-password?token=")
+	if mail.To != "bob@example.com" || !ok {
+		t.Fatalf("unexpected reset email: %+v", mail)
+	}
+	token, _, _ := strings.Cut(rest, "\n")
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/reset-password?token="+token, nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), token) {
+		t.Fatalf("reset page should carry the token, got %d", rr.Code)
+	}
+
+	submit := func(tok string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {tok}, "password": {"new-secret"}, "password2": {"new-secret"}}
+		req := httptest.NewRequest(http.MethodPost, "/api/password-reset", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := submit(token); rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect after reset, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if code := loginStatus(router, "bob", "new-secret"); code != http.StatusFound {
+		t.Fatalf("login with the new password failed, got %d", code)
+	}
+	if rr := submit(token); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid or has expired") {
+		t.Fatalf("reset token was accepted twice, got %d", rr.Code)
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE target_id = $1 AND action IN ('user.reset_password', 'user.password_reset_completed')`, bobID).Scan(&n); err != nil || n != 2 {
+		t.Fatalf("expected 2 audit entries, got %d (err %v)", n, err)
+	}
+}
+
+// Admins can create users and change their email and admin flag, but not their own.
+func TestAdminUsers_CreateAndUpdate(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "crudadmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'crudadmin'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+	admin := adminClient(router, cookies)
+
+	rr := admin(http.MethodPost, "/admin/users", `{"username":"carol","email":"carol@example.com","password":"pw","is_admin":true}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var carol h.AdminUser
+	if err := json.Unmarshal(rr.Body.Bytes(), &carol); err != nil || !carol.IsAdmin || carol.Status != h.UserStatusActive {
+		t.Fatalf("unexpected created user: %+v (err %v)", carol, err)
+	}
+	if rr := admin(http.MethodPost, "/admin/users", `{"username":"carol","email":"other@example.com","password":"pw"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a taken username, got %d", rr.Code)
+	}
+
+	rr = admin(http.MethodPatch, "/admin/users/"+strconv.Itoa(carol.ID), `{"email":"c@example.com","is_admin":false}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &carol); err != nil || carol.IsAdmin || carol.Email != "c@example.com" {
+		t.Fatalf("unexpected updated user: %+v (err %v)", carol, err)
+	}
+
+	var selfID int
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'crudadmin'`).Scan(&selfID); err != nil {
+		t.Fatal(err)
+	}
+	if rr := admin(http.MethodPatch, "/admin/users/"+strconv.Itoa(selfID), `{"is_admin":false}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when demoting yourself, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPatch, "/admin/users/"+strconv.Itoa(carol.ID), `{"email":"crudadmin@example.com"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a taken email, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/dialect"
+)
+
+// Logged-in users get API_DAILY_QUOTA calls per day; the count is shown in /api/me.
+func TestAPIQuota_DailyLimit(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetDialect(dialect.SQLite)
+	defer h.SetDialect(dialect.Postgres)
+	h.SetAPIDailyQuota(2)
+	defer h.SetAPIDailyQuota(0)
+
+	cookies := registerAndLogin(t, router, "quota", "secret")
+	get := func(path string, withCookies bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if withCookies {
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, want := range []string{"1", "0"} {
+		rr := get("/api/search?q=go", true)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("call %d: expected 200, got %d: %s", i+1, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("X-RateLimit-Remaining"); got != want {
+			t.Fatalf("call %d: X-RateLimit-Remaining = %q, want %q", i+1, got, want)
+		}
+		if rr.Header().Get("X-RateLimit-Limit") != "2" || rr.Header().Get("X-RateLimit-Reset") == "" {
+			t.Fatalf("call %d: missing quota headers: %v", i+1, rr.Header())
+		}
+	}
+
+	rr := get("/api/search?q=go", true)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After over the quota, got %d %v", rr.Code, rr.Header())
+	}
+
+	rr = get("/api/me", true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("/api/me: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var me h.MeResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &me); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	u := me.APIUsage
+	if me.Username != "quota" || u.Calls != 2 || u.Limit != 2 || u.Remaining == nil || *u.Remaining != 0 {
+		t.Fatalf("unexpected /api/me: %+v (usage %+v)", me, u)
+	}
+
+	// Anonymous calls are not counted.
+	rr = get("/api/search/widget?q=go", false)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != "" {
+		t.Fatalf("anonymous call: got %d with quota headers %v", rr.Code, rr.Header())
+	}
+}
+
+// The quota covers every API route, not only search; /api/me itself is not counted.
+func TestAPIQuota_CountsOtherAPIRoutes(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetDialect(dialect.SQLite)
+	defer h.SetDialect(dialect.Postgres)
+	h.SetAPIDailyQuota(3)
+	defer h.SetAPIDailyQuota(0)
+
+	cookies := registerAndLogin(t, router, "quotaroutes", "secret")
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, path := range []string{"/api/me/bookmarks", "/api/tags"} {
+		rr := get(path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+		if got, want := rr.Header().Get("X-RateLimit-Remaining"), strconv.Itoa(2-i); got != want {
+			t.Fatalf("%s: X-RateLimit-Remaining = %q, want %q", path, got, want)
+		}
+	}
+
+	for range 2 {
+		rr := get("/api/me")
+		if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != "" {
+			t.Fatalf("/api/me: got %d with quota headers %v", rr.Code, rr.Header())
+		}
+		var me h.MeResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &me); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if me.APIUsage.Calls != 2 {
+			t.Fatalf("expected 2 counted calls, got %+v", me.APIUsage)
+		}
+	}
+}
+
+func TestAPIMe_RequiresLogin(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/me", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+}
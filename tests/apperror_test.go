@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"devops-valgfag/internal/apperror"
+)
+
+// Every kind maps to one status code, and only the user message of an error is ever shown.
+func TestAppError_StatusAndMessage(t *testing.T) {
+	for kind, want := range map[apperror.Kind]int{
+		apperror.Invalid:      http.StatusBadRequest,
+		apperror.Unauthorized: http.StatusUnauthorized,
+		apperror.Forbidden:    http.StatusForbidden,
+		apperror.NotFound:     http.StatusNotFound,
+		apperror.Conflict:     http.StatusConflict,
+		apperror.Unavailable:  http.StatusServiceUnavailable,
+		apperror.Internal:     http.StatusInternalServerError,
+	} {
+		if got := kind.HTTPStatus(); got != want {
+			t.Errorf("%s: expected %d, got %d", kind, want, got)
+		}
+	}
+
+	cause := errors.New("pq: duplicate key value violates unique constraint")
+	err := apperror.Wrap(apperror.Conflict, "Username already in use", cause)
+	if err.Error() != "Username already in use" || !errors.Is(err, cause) {
+		t.Fatalf("expected the message only, with the cause unwrappable; got %q", err.Error())
+	}
+	if e := apperror.From(err); e.Kind != apperror.Conflict {
+		t.Fatalf("expected the kind to be kept, got %s", e.Kind)
+	}
+
+	plain := apperror.From(cause)
+	if plain.Kind != apperror.Internal || plain.Message != apperror.InternalMessage || !errors.Is(plain, cause) {
+		t.Fatalf("a plain error must become a generic internal error, got %+v", plain)
+	}
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/cache"
+)
+
+// The article view renders sanitized full content with related pages and prev/next links,
+// for anonymous visitors, as HTML and JSON.
+func TestArticle_View(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES
+		('Gopher Basics', '/gopher-basics', 'en', '<p>Gophers <b>dig</b>.</p><script>alert(1)</script><a href="javascript:alert(2)">x</a>'),
+		('Gopher Advanced', '/gopher-advanced', 'en', 'More about gophers.'),
+		('Dansk side', '/dansk', 'da', 'Gopher på dansk')`); err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]int{}
+	rows, err := db.Query(`SELECT id, title FROM pages`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id int
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			t.Fatal(err)
+		}
+		ids[title] = id
+	}
+	_ = rows.Close()
+	get := adminClient(router, nil)
+
+	rr := get(http.MethodGet, "/api/pages/"+strconv.Itoa(ids["Gopher Basics"]), "")
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"1"` {
+		t.Fatalf("expected 200 with ETag, got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+	var v h.PageView
+	if err := json.Unmarshal(rr.Body.Bytes(), &v); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if v.ContentHTML != `<p>Gophers <b>dig</b>.</p><a rel="nofollow noopener">x</a>` {
+		t.Fatalf("unexpected content_html: %s", v.ContentHTML)
+	}
+	if len(v.Related) != 1 || v.Related[0].ID != ids["Gopher Advanced"] {
+		t.Fatalf("expected the other English gopher page as related, got %+v", v.Related)
+	}
+	if v.Prev == nil || v.Prev.ID != ids["About Us"] || v.Next == nil || v.Next.ID != ids["Gopher Advanced"] {
+		t.Fatalf("unexpected prev/next: %+v / %+v", v.Prev, v.Next)
+	}
+
+	rr = get(http.MethodGet, "/page/"+strconv.Itoa(ids["Gopher Basics"]), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "Gophers <b>dig</b>.") || strings.Contains(body, "alert(") ||
+		!strings.Contains(body, `href="/page/`+strconv.Itoa(ids["Gopher Advanced"])+`"`) {
+		t.Fatalf("unexpected article page:\n%s", body)
+	}
+
+	// Plain text becomes paragraphs; the last page has no next link.
+	rr = get(http.MethodGet, "/api/pages/"+strconv.Itoa(ids["Gopher Advanced"]), "")
+	var last h.PageView
+	if err := json.Unmarshal(rr.Body.Bytes(), &last); err != nil || last.ContentHTML != "<p>More about gophers.</p>" || last.Next != nil {
+		t.Fatalf("unexpected page: %s", rr.Body.String())
+	}
+
+	if rr := get(http.MethodGet, "/page/999999", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	if _, err := db.Exec(`UPDATE pages SET deleted_at = CURRENT_TIMESTAMP WHERE title = 'Gopher Advanced'`); err != nil {
+		t.Fatal(err)
+	}
+	if rr := get(http.MethodGet, "/api/pages/"+strconv.Itoa(ids["Gopher Advanced"]), ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted page, got %d", rr.Code)
+	}
+}
+
+// Related pages are capped by limit and cached per page.
+func TestArticle_RelatedCached(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetRelatedCache(cache.NewMemory(10), time.Minute)
+	defer h.SetRelatedCache(nil, 0)
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES
+		('Kubernetes', '/k8s', 'en', 'Container orchestration'),
+		('Kubernetes Pods', '/pods', 'en', 'Pods run containers'),
+		('Kubernetes Services', '/services', 'en', 'Services expose pods'),
+		('Cooking', '/cooking', 'en', 'Recipes')`); err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := db.QueryRow(`SELECT id FROM pages WHERE title = 'Kubernetes'`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/pages/" + strconv.Itoa(id) + "/related"
+	get := adminClient(router, nil)
+	related := func(query string) []h.PageLink {
+		t.Helper()
+		rr := get(http.MethodGet, path+query, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp h.APIRelatedPagesResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Related
+	}
+
+	if got := related(""); len(got) != 2 {
+		t.Fatalf("expected the two other Kubernetes pages, got %+v", got)
+	}
+	if got := related("?limit=1"); len(got) != 1 {
+		t.Fatalf("expected limit to cap the list, got %+v", got)
+	}
+
+	// A new matching page is not visible until the cached list expires.
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES ('Kubernetes Ingress', '/ingress', 'en', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	if got := related(""); len(got) != 2 {
+		t.Fatalf("expected the cached list, got %+v", got)
+	}
+
+	if rr := get(http.MethodGet, "/api/pages/999999/related", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/app"
+)
+
+// Static files are linked by content hash and cached for a year under that name; the plain
+// name gets a short lifetime, and precompressed variants go to clients accepting them.
+func TestAssets_FingerprintsAndCaching(t *testing.T) {
+	_, db := setupTestServer(t)
+	defer closeDB(t, db)
+	router := app.NewRouter()
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	css := h.Asset("style.css")
+	if !regexp.MustCompile(`^/static/style\.[0-9a-f]{10}\.css$`).MatchString(css) {
+		t.Fatalf("expected a fingerprinted URL, got %q", css)
+	}
+	rec := get(css, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" ||
+		rec.Header().Get("Content-Type") != "text/css; charset=utf-8" {
+		t.Fatalf("fingerprinted asset: got %d %v", rec.Code, rec.Header())
+	}
+	etag := rec.Header().Get("ETag")
+	if rec := get(css, http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for a matching ETag, got %d", rec.Code)
+	}
+	if rec := get("/static/style.css", nil); rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Fatalf("plain name: got %d %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+	if rec := get("/static/style.0123456789.css", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("stale fingerprint: expected 404, got %d", rec.Code)
+	}
+	if got := h.Asset("missing.css"); got != "/static/missing.css" {
+		t.Fatalf("unknown asset: got %q", got)
+	}
+
+	// Precompressed variants (static/ on disk, as with TEMPLATE_RELOAD=1).
+	dir := t.TempDir()
+	for name, body := range map[string]string{"app.css": "body{}", "app.css.gz": "gzipped", "app.css.br": "brotli"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.EnableAssetReload(dir)
+	defer h.EnableAssetReload("")
+	for accept, want := range map[string]string{"gzip, br": "brotli", "gzip": "gzipped", "br;q=0, gzip": "gzipped", "": "body{}", "*": "brotli"} {
+		rec := get("/static/app.css", http.Header{"Accept-Encoding": {accept}})
+		if rec.Body.String() != want || rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: got %q (Content-Encoding %q), want %q",
+				accept, rec.Body.String(), rec.Header().Get("Content-Encoding"), want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Failed logins and registrations still render the HTML form, but with an error status.
+func TestAuth_FailureStatusCodes(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	registerAndLogin(t, router, "erin", "secret")
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	register := func(user, pw2 string) url.Values {
+		return url.Values{"username": {user}, "email": {user + "@example.com"}, "password": {"secret"}, "password2": {pw2}}
+	}
+
+	for _, tc := range []struct {
+		name, path string
+		form       url.Values
+		code       int
+		message    string
+	}{
+		{"wrong password", "/api/login", url.Values{"username": {"erin"}, "password": {"nope"}}, http.StatusUnauthorized, "Invalid username or password"},
+		{"unknown user", "/api/login", url.Values{"username": {"ghost"}, "password": {"secret"}}, http.StatusUnauthorized, "Invalid username or password"},
+		{"missing fields", "/api/register", url.Values{"username": {"frank"}}, http.StatusBadRequest, "All fields required"},
+		{"password mismatch", "/api/register", register("frank", "other"), http.StatusBadRequest, "Passwords do not match"},
+		{"taken username", "/api/register", register("erin", "secret"), http.StatusConflict, "Username already in use"},
+	} {
+		action := strings.TrimPrefix(tc.path, "/api/")
+		counter := metrics.AuthFailures.WithLabelValues(action, strconv.Itoa(tc.code))
+		start := testutil.ToFloat64(counter)
+
+		rr := post(tc.path, tc.form)
+		if rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.code, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Fatalf("%s: expected an HTML page, got %q", tc.name, ct)
+		}
+		if body := rr.Body.String(); !strings.Contains(body, tc.message) || !strings.Contains(body, `name="username"`) {
+			t.Fatalf("%s: expected the form with %q, got %s", tc.name, tc.message, body)
+		}
+		if got := testutil.ToFloat64(counter) - start; got != 1 {
+			t.Fatalf("%s: expected app_auth_failures_total to grow by 1, got %v", tc.name, got)
+		}
+	}
+
+	// A valid registration still redirects.
+	if rr := post("/api/register", register("frank", "secret")); rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect after register, got %d", rr.Code)
+	}
+}
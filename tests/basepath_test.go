@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+func TestBasePath_Config(t *testing.T) {
+	for in, want := range map[string]string{"": "", "/": "", "whoknows": "/whoknows", "/whoknows/": "/whoknows", "/a/b": "/a/b"} {
+		cfg, err := sessionConfig(t, map[string]string{"SESSION_KEY": testSessionKey, "BASE_PATH": in})
+		if err != nil || cfg.BasePath != want {
+			t.Errorf("BASE_PATH=%q: got %q (%v), want %q", in, cfg.BasePath, err, want)
+		}
+	}
+	for _, in := range []string{"/who knows", "/a//b", "/../etc", "/q?x=1"} {
+		if _, err := sessionConfig(t, map[string]string{"SESSION_KEY": testSessionKey, "BASE_PATH": in}); err == nil {
+			t.Errorf("BASE_PATH=%q: expected an error", in)
+		}
+	}
+}
+
+// Under BASE_PATH the prefix is stripped before routing, and links and redirects carry it.
+func TestBasePath_PrefixedDeployment(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetBasePath("/whoknows")
+	defer h.SetBasePath("")
+	handler := h.BasePathMiddleware()(router)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr := get("/whoknows/about")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 under the prefix, got %d", rr.Code)
+	}
+	for _, want := range []string{`href="/whoknows/static/style.`, `href="/whoknows/search"`, `'\/whoknows\/events'`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected the page to contain %s", want)
+		}
+	}
+
+	if rr := get("/whoknows?q=go"); rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != "/whoknows/?q=go" {
+		t.Fatalf("bare prefix: got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := get("/whoknows/?q=go"); rr.Code != http.StatusFound || rr.Header().Get("Location") != "/whoknows/search?q=go" {
+		t.Fatalf("home redirect: got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	// Unprefixed requests (health probes, proxies that strip the prefix) still work.
+	if rr := get("/healthz"); rr.Code != http.StatusOK {
+		t.Fatalf("unprefixed /healthz: got %d", rr.Code)
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+func bookmarkRequest(router *mux.Router, method, path, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Save (idempotent per URL), list, render the page and delete; other users cannot delete.
+func TestBookmarks_CRUD(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	if rr := bookmarkRequest(router, http.MethodGet, "/api/me/bookmarks", "", nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", rr.Code)
+	}
+
+	alice := registerAndLogin(t, router, "alice", "secret")
+	body := `{"title":"Golang","url":"https://go.dev"}`
+
+	rr := bookmarkRequest(router, http.MethodPost, "/api/me/bookmarks", body, alice)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created h.Bookmark
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.ID == 0 {
+		t.Fatalf("invalid bookmark: %v %s", err, rr.Body.String())
+	}
+
+	// Same URL again returns the existing bookmark.
+	rr = bookmarkRequest(router, http.MethodPost, "/api/me/bookmarks", body, alice)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for duplicate, got %d", rr.Code)
+	}
+
+	rr = bookmarkRequest(router, http.MethodGet, "/api/me/bookmarks", "", alice)
+	var list h.APIBookmarksResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Bookmarks) != 1 {
+		t.Fatalf("expected 1 bookmark, got %s", rr.Body.String())
+	}
+
+	rr = bookmarkRequest(router, http.MethodGet, "/bookmarks", "", alice)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "https://go.dev") {
+		t.Fatalf("bookmarks page missing entry: %d", rr.Code)
+	}
+
+	path := "/api/me/bookmarks/" + strconv.FormatInt(created.ID, 10)
+	bob := registerAndLogin(t, router, "bob", "secret")
+	if rr := bookmarkRequest(router, http.MethodDelete, path, "", bob); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 deleting another user's bookmark, got %d", rr.Code)
+	}
+	if rr := bookmarkRequest(router, http.MethodDelete, path, "", alice); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// Clicks are recorded (normalized query) and aggregated in the admin report.
+func TestSearchClicks_RecordAndReport(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	for _, body := range []string{
+		`{"query":"Go","url":"/golang","rank":1}`,
+		`{"query":" go ","url":"/gophers","rank":3}`,
+		`{"query":"docker","url":"/docker","rank":1,"language":"en"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/search/click", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected 204 for %s, got %d: %s", body, rr.Code, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/search/click", strings.NewReader(`{"query":"go","url":"/x","rank":0}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for rank 0, got %d", rr.Code)
+	}
+
+	// Report is admin only.
+	cookies := registerAndLogin(t, router, "clickadmin", "secret")
+	req = httptest.NewRequest(http.MethodGet, "/admin/reports/clicks", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", rr.Code)
+	}
+
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'clickadmin'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for admin, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var report h.ClickReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if report.TotalClicks != 3 || len(report.Queries) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	top := report.Queries[0]
+	if top.Query != "go" || top.Clicks != 2 || top.AvgRank != 2 || top.TopRankRate != 0.5 {
+		t.Fatalf("unexpected top query: %+v", top)
+	}
+}
+
+// A page_id that is not a page of the tenant is stored as null instead of failing the click.
+func TestSearchClicks_UnknownPageID(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	for _, body := range []string{
+		`{"query":"welcome","url":"/welcome","rank":1,"page_id":1}`,
+		`{"query":"welcome","url":"/gone","rank":2,"page_id":99999}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/search/click", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected 204 for %s, got %d: %s", body, rr.Code, rr.Body.String())
+		}
+	}
+
+	for url, want := range map[string]string{"/welcome": "1", "/gone": "null"} {
+		var pageID sql.NullInt64
+		if err := db.QueryRow(`SELECT page_id FROM search_clicks WHERE url = $1`, url).Scan(&pageID); err != nil {
+			t.Fatal(err)
+		}
+		got := "null"
+		if pageID.Valid {
+			got = strconv.FormatInt(pageID.Int64, 10)
+		}
+		if got != want {
+			t.Errorf("%s: page_id = %s, want %s", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/clientip"
+)
+
+func TestClientIP_Resolve(t *testing.T) {
+	trusted, err := clientip.ParsePrefixes(" 10.0.0.0/8, 127.0.0.1 ,")
+	if err != nil || len(trusted) != 2 {
+		t.Fatalf("unexpected trusted list %v (%v)", trusted, err)
+	}
+	for _, bad := range []string{"10.0.0.0/33", "proxy.local"} {
+		if _, err := clientip.ParsePrefixes(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, remote, xff, realIP, want string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.9:5000", "198.51.100.1", "198.51.100.2", "203.0.113.9"},
+		{"trusted peer, single hop", "10.0.0.2:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed entries left of the client are ignored", "10.0.0.2:5000", "1.2.3.4, 198.51.100.1", "", "198.51.100.1"},
+		{"chain of trusted proxies", "127.0.0.1:5000", "198.51.100.1, 10.1.1.1, 10.2.2.2", "", "198.51.100.1"},
+		{"all hops trusted", "10.0.0.2:5000", "10.3.3.3", "", "10.3.3.3"},
+		{"garbage stops at the last trusted hop", "10.0.0.2:5000", "198.51.100.1, not-an-ip", "", "10.0.0.2"},
+		{"X-Real-IP without X-Forwarded-For", "10.0.0.2:5000", "", "198.51.100.7", "198.51.100.7"},
+		{"no headers", "10.0.0.2:5000", "", "", "10.0.0.2"},
+		{"IPv6 peer", "[2001:db8::1]:5000", "198.51.100.1", "", "2001:db8::1"},
+	} {
+		header := http.Header{}
+		if tc.xff != "" {
+			header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.realIP != "" {
+			header.Set("X-Real-IP", tc.realIP)
+		}
+		if got := clientip.Resolve(tc.remote, header, trusted); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// Audit entries record the client address resolved behind a trusted proxy.
+func TestClientIP_Audited(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")})
+	defer h.SetTrustedProxies(nil)
+
+	cookies := registerAndLogin(t, router, "auditor", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'auditor'`); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/admin/tags", strings.NewReader(`{"name":"Ops"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", "6.6.6.6, 198.51.100.23")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = adminClient(router, cookies)(http.MethodGet, "/admin/audit?target_type=tag", "")
+	var out h.AdminAuditLogResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil || len(out.Entries) != 1 || out.Entries[0].ClientIP != "198.51.100.23" {
+		t.Fatalf("expected the forwarded client IP in the audit log, got %s", rr.Body.String())
+	}
+}
+
+// Absolute links follow X-Forwarded-Proto only when a trusted proxy sent it.
+func TestClientIP_ForwardedProto(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	more := func() string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/search/widget?q=proto&language=en", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var resp h.SearchWidgetResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("widget: %d %s", rr.Code, rr.Body.String())
+		}
+		return resp.More
+	}
+	if got := more(); !strings.HasPrefix(got, "http://example.com/") {
+		t.Fatalf("untrusted peer: expected an http link, got %q", got)
+	}
+	h.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")})
+	defer h.SetTrustedProxies(nil)
+	if got := more(); !strings.HasPrefix(got, "https://example.com/") {
+		t.Fatalf("trusted proxy: expected an https link, got %q", got)
+	}
+}
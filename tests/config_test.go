@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"devops-valgfag/internal/config"
+)
+
+func TestConfig_ParseAndValidate(t *testing.T) {
+	values, err := config.Parse([]byte(`
+search:
+  fts: true
+  cache_ttl: 0
+external_search: off
+rate_limit:
+  auth: 5
+trusted_proxies: [10.0.0.0/8, 127.0.0.1]
+experiments:
+  search_merge: [append:50, interleave:50]
+robots_disallow: /admin
+search_log_retention: 90d
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"SEARCH_FTS":           "1",
+		"SEARCH_CACHE_TTL":     "0",
+		"EXTERNAL_SEARCH":      "0",
+		"RATE_LIMIT_AUTH":      "5",
+		"TRUSTED_PROXIES":      "10.0.0.0/8,127.0.0.1",
+		"EXPERIMENTS":          "search_merge=append:50,interleave:50",
+		"ROBOTS_DISALLOW":      "/admin",
+		"SEARCH_LOG_RETENTION": "90d",
+	}
+	if len(values) != len(want) {
+		t.Fatalf("got %v", values)
+	}
+	for k, v := range want {
+		if values[k] != v {
+			t.Errorf("%s = %q, want %q", k, values[k], v)
+		}
+	}
+
+	for _, bad := range []string{
+		"serach_fts: true",                // typo
+		"search: {fts: maybe}",            // not a bool
+		"rate_limit: {api: -1}",           // negative
+		"search: {cache_ttl: soon}",       // not a duration
+		"search_log_retention: 1.5d",      // days must be whole
+		"trusted_proxies: [10.0.0.0/99]",  // not a network
+		"experiments: {search_merge: ''}", // no variants
+		"port: [8080]",                    // not a single value
+		"search_fts: true\nsearch: {fts: false}",
+		"- just a list",
+	} {
+		if _, err := config.Parse([]byte(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+// The example file stays valid, and the environment overrides the file.
+func TestConfig_ExampleAndApply(t *testing.T) {
+	values, err := config.Load("../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(values["EXPERIMENTS"], "search_ranking=v1:90,v2:10") || values["ADMIN_IP_ALLOW"] != "10.0.0.0/8" {
+		t.Fatalf("unexpected example settings: %v", values)
+	}
+
+	t.Setenv("RATE_LIMIT_API", "7")
+	t.Setenv("RATE_LIMIT_AUTH", "") // restored after the test
+	if err := os.Unsetenv("RATE_LIMIT_AUTH"); err != nil {
+		t.Fatal(err)
+	}
+	overridden, err := config.Apply(map[string]string{"RATE_LIMIT_API": "120", "RATE_LIMIT_AUTH": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overridden) != 1 || overridden[0] != "RATE_LIMIT_API" {
+		t.Fatalf("unexpected overridden keys %v", overridden)
+	}
+	if os.Getenv("RATE_LIMIT_API") != "7" || os.Getenv("RATE_LIMIT_AUTH") != "10" {
+		t.Fatalf("environment should win: api=%q auth=%q", os.Getenv("RATE_LIMIT_API"), os.Getenv("RATE_LIMIT_AUTH"))
+	}
+}
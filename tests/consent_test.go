@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// With TERMS_VERSION set, sign-up requires accepting the terms; a new version sends page views
+// to the interstitial (APIs keep working) until it is accepted, and the export lists every
+// acceptance.
+func TestConsent_RegistrationInterstitialAndExport(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetTerms(h.TermsConfig{Version: "v1", TermsURL: "https://example.com/terms"})
+	t.Cleanup(func() { h.SetTerms(h.TermsConfig{}) })
+
+	post := func(path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := bookmarkRequest(router, http.MethodGet, "/register", "", nil); !strings.Contains(rr.Body.String(), `name="accept_terms"`) ||
+		!strings.Contains(rr.Body.String(), "https://example.com/terms") {
+		t.Fatal("expected the register form to ask for the terms")
+	}
+	form := url.Values{"username": {"maja"}, "email": {"maja@example.com"}, "password": {"secret123"}, "password2": {"secret123"}}
+	if rr := post("/api/register", form, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("register without accepting: expected 400, got %d", rr.Code)
+	}
+	form.Set("accept_terms", "1")
+	if rr := post("/api/register", form, nil); rr.Code != http.StatusFound {
+		t.Fatalf("register: expected 302, got %d", rr.Code)
+	}
+	rr := post("/api/login", url.Values{"username": {"maja"}, "password": {"secret123"}}, nil)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("login: expected 302, got %d", rr.Code)
+	}
+	cookies := rr.Result().Cookies()
+
+	if rr := bookmarkRequest(router, http.MethodGet, "/about", "", cookies); rr.Code != http.StatusOK {
+		t.Fatalf("accepted terms: expected 200, got %d", rr.Code)
+	}
+
+	h.SetTerms(h.TermsConfig{Version: "v2"})
+	rr = bookmarkRequest(router, http.MethodGet, "/about", "", cookies)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/consent?next=%2Fabout" {
+		t.Fatalf("new terms: expected the interstitial, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := bookmarkRequest(router, http.MethodGet, "/api/me/bookmarks", "", cookies); rr.Code != http.StatusOK {
+		t.Fatalf("APIs must keep working, got %d", rr.Code)
+	}
+	if rr := bookmarkRequest(router, http.MethodGet, "/consent?next=/about", "", cookies); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `value="v2"`) {
+		t.Fatalf("interstitial: expected 200 with the version, got %d", rr.Code)
+	}
+
+	if rr := post("/api/me/consent", url.Values{"version": {"v1"}}, cookies); rr.Code != http.StatusConflict {
+		t.Fatalf("stale version: expected 409, got %d", rr.Code)
+	}
+	rr = post("/api/me/consent", url.Values{"version": {"v2"}, "next": {"//evil.example"}}, cookies)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+		t.Fatalf("accept: expected a local redirect, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := bookmarkRequest(router, http.MethodGet, "/about", "", cookies); rr.Code != http.StatusOK {
+		t.Fatalf("after accepting: expected 200, got %d", rr.Code)
+	}
+
+	rr = bookmarkRequest(router, http.MethodGet, "/api/me/export", "", cookies)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("export: expected a 200 download, got %d", rr.Code)
+	}
+	var export h.AccountExport
+	if err := json.Unmarshal(rr.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Account.Username != "maja" || export.Account.TermsVersion != "v2" || len(export.Consents) != 2 ||
+		export.Consents[0].Version != "v1" || export.Consents[0].Source != "registration" ||
+		export.Consents[1].Version != "v2" || export.Consents[1].Source != "consent" {
+		t.Fatalf("unexpected export: %+v", export)
+	}
+}
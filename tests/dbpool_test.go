@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/dbpool"
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// A pool whose only connection is taken while requests queue up is reported as saturated
+// once that lasts SaturationWarn; the waits make autotuning grow it, and it shrinks back
+// after a quiet minute of samples.
+func TestDBPool_SaturationAndAutotune(t *testing.T) {
+	db, err := dialect.OpenSQLite(filepath.Join(t.TempDir(), "pool.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDB(t, db)
+	db.SetMaxOpenConns(1)
+
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(prev)
+
+	m := dbpool.New(db, dbpool.Options{Pool: "pooltest", MaxOpenConns: 1, AutotuneMax: 3, TargetWait: time.Millisecond, SaturationWarn: 5 * time.Second})
+	if !m.Autotuning() {
+		t.Fatal("expected autotuning with AutotuneMax above MaxOpenConns")
+	}
+	warnings := metrics.DBPoolSaturationWarnings.WithLabelValues("pooltest")
+	grown := metrics.DBPoolResizes.WithLabelValues("pooltest", "grow")
+	before, grownBefore := testutil.ToFloat64(warnings), testutil.ToFloat64(grown)
+
+	ctx := context.Background()
+	held, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wait queues a request for a connection, which it returns as soon as it gets one.
+	done := make(chan error, 2)
+	wait := func(n int64) {
+		go func() {
+			c, err := db.Conn(ctx)
+			if err == nil {
+				err = c.Close()
+			}
+			done <- err
+		}()
+		for db.Stats().WaitCount < n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	t0 := time.Now()
+	wait(1)
+	m.Check(t0)
+	wait(2)
+	m.Check(t0.Add(2 * time.Second))
+	if testutil.ToFloat64(warnings) != before {
+		t.Fatal("a saturation shorter than SaturationWarn must not warn")
+	}
+	wait(3)
+	m.Check(t0.Add(5 * time.Second))
+	if testutil.ToFloat64(warnings) != before+1 || !strings.Contains(buf.String(), "WARNING db pool pooltest: saturated for 5s") {
+		t.Fatalf("expected a saturation warning, got:\n%s", buf.String())
+	}
+	if got := testutil.ToFloat64(metrics.DBPoolSaturated.WithLabelValues("pooltest")); got != 5 {
+		t.Fatalf("expected 5s saturated, got %v", got)
+	}
+
+	// The waiters get the connection after waiting well over TargetWait.
+	time.Sleep(5 * time.Millisecond)
+	if err := held.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Check(t0.Add(6 * time.Second))
+	if !strings.Contains(buf.String(), "db pool pooltest: no longer saturated") {
+		t.Fatalf("expected the end of the saturation logged, got:\n%s", buf.String())
+	}
+	if m.Size() != 2 || db.Stats().MaxOpenConnections != 2 || testutil.ToFloat64(grown) != grownBefore+1 {
+		t.Fatalf("expected the pool grown to 2, got %d (pool %d)", m.Size(), db.Stats().MaxOpenConnections)
+	}
+	if testutil.ToFloat64(metrics.DBPoolWait.WithLabelValues("pooltest")) < 0.001 {
+		t.Fatal("expected the average wait exported")
+	}
+
+	for i := range 60 {
+		m.Check(t0.Add(time.Duration(7+i) * time.Second))
+	}
+	if m.Size() != 1 || db.Stats().MaxOpenConnections != 1 {
+		t.Fatalf("expected the pool back at its configured size after a quiet minute, got %d", m.Size())
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/cache"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// enterDegradedMode closes the handlers' database and returns once degraded mode is on.
+// Degraded mode is left again (on a fresh database) when the test ends.
+func enterDegradedMode(t *testing.T) {
+	t.Helper()
+	db := setupTestHandlers(t)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.CheckDatabase(context.Background()); err == nil {
+		t.Fatal("expected CheckDatabase to fail on a closed database")
+	}
+	t.Cleanup(func() {
+		fresh, err := sql.Open("sqlite", ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = fresh.Close() }()
+		h.Init(fresh, nil, nil)
+		if err := h.CheckDatabase(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestDegraded_SearchUnavailableWithoutCache(t *testing.T) {
+	h.SetSearchCache(nil, 0)
+	enterDegradedMode(t)
+
+	if got := testutil.ToFloat64(metrics.DegradedMode); got != 1 {
+		t.Fatalf("expected app_degraded_mode 1, got %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	h.SearchPageHandler(rec, httptest.NewRequest(http.MethodGet, "/search?q=golang&format=json", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After header")
+	}
+	if !strings.Contains(rec.Body.String(), "search temporarily unavailable") {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+
+	// An empty query is not a failed search.
+	rec = httptest.NewRecorder()
+	h.SearchPageHandler(rec, httptest.NewRequest(http.MethodGet, "/search?format=json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for empty query, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "degraded") {
+		t.Fatalf("expected degraded readyz, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDegraded_ServesStaleCachedResults(t *testing.T) {
+	h.EnableExternalSearch(false)
+	c := cache.NewMemory(10)
+	h.SetSearchCache(c, time.Minute)
+	t.Cleanup(func() { h.SetSearchCache(nil, 0) })
+
+	// An expired entry as written by an earlier successful search (anonymous, default page size).
+	entry, err := json.Marshal(map[string]any{
+		"fresh_until": time.Now().Add(-time.Minute),
+		"results":     []h.SearchResult{{ID: 1, Title: "Stale Golang", URL: "/golang", Language: "en"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(context.Background(), "search:en:50:false:golang", entry, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	enterDegradedMode(t)
+	stale := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("search", "stale"))
+
+	rec := httptest.NewRecorder()
+	h.SearchPageHandler(rec, httptest.NewRequest(http.MethodGet, "/search?q=golang&format=json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "Stale Golang") {
+		t.Fatalf("expected stale cached result, got %s", rec.Body.String())
+	}
+	if got := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("search", "stale")) - stale; got != 1 {
+		t.Fatalf("expected one stale cache hit, got %v", got)
+	}
+}
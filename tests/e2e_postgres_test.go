@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/app"
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/i18n"
+
+	"github.com/gorilla/sessions"
+)
+
+// The full register -> login -> search flow on PostgreSQL, through the production router:
+// migrations (advisory lock), bcrypt accounts, full-text search with f_unaccent, the ILIKE
+// fallback and the search log all run against the real dialect.
+func TestE2EPostgres_RegisterLoginSearch(t *testing.T) {
+	db := postgresDB(t)
+
+	funcs := template.FuncMap{
+		"now":   time.Now,
+		"year":  func() int { return time.Now().Year() },
+		"t":     i18n.T,
+		"url":   h.URL,
+		"asset": h.Asset,
+	}
+	tmpl := template.Must(template.New("").Funcs(funcs).ParseGlob("../templates/*.html"))
+	h.Init(db, tmpl, sessions.NewCookieStore([]byte("test-key")))
+	h.SetDialect(dialect.Postgres)
+	h.EnableExternalSearch(false)
+	h.SetLoginFailureDelay(0)
+	t.Cleanup(func() { h.EnableFTSSearch(false) })
+	router := app.NewRouter()
+
+	for _, p := range []struct{ title, url, content string }{
+		{"Kubernetes Ingress", "/e2e/ingress", "An ingress routes external HTTP traffic to services in Zürich and elsewhere."},
+		{"Docker Compose", "/e2e/compose", "Compose runs multi-container applications from one YAML file."},
+	} {
+		if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES ($1, $2, 'en', $3)`, p.title, p.url, p.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cookies := registerAndLogin(t, router, "e2e-alice", "correct horse battery")
+
+	search := func(q string) []h.SearchResult {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/search?q="+url.QueryEscape(q), nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("search %q: expected 200, got %d: %s", q, rec.Code, rec.Body.String())
+		}
+		var resp h.APISearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.SearchResults
+	}
+
+	h.EnableFTSSearch(true)
+	// "zurich" only matches "Zürich" through f_unaccent in the tsquery.
+	if got := search("ingress zurich"); len(got) != 1 || got[0].Title != "Kubernetes Ingress" {
+		t.Fatalf("FTS: expected the ingress page, got %+v", got)
+	}
+
+	h.EnableFTSSearch(false)
+	// ILIKE also matches inside words, which the tsvector does not.
+	if got := search("ontainer"); len(got) != 1 || got[0].Title != "Docker Compose" {
+		t.Fatalf("ILIKE: expected the compose page, got %+v", got)
+	}
+
+	var logged int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM search_log`).Scan(&logged); err != nil || logged != 2 {
+		t.Fatalf("expected both searches in search_log, got %d (%v)", logged, err)
+	}
+}
+
+// The admin explain endpoint runs EXPLAIN (ANALYZE, BUFFERS) of the search statement on
+// PostgreSQL, for either path.
+func TestE2EPostgres_SearchExplain(t *testing.T) {
+	db := postgresDB(t)
+	h.Init(db, nil, sessions.NewCookieStore([]byte("test-key")))
+	h.SetDialect(dialect.Postgres)
+	h.SetLoginFailureDelay(0)
+	router := app.NewRouter()
+
+	cookies := registerAndLogin(t, router, "e2e-admin", "correct horse battery")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'e2e-admin'`); err != nil {
+		t.Fatal(err)
+	}
+	admin := adminClient(router, cookies)
+
+	for path, node := range map[string]string{"fts": "content_tsv", "ilike": "f_unaccent"} {
+		rec := admin(http.MethodGet, "/api/admin/search/explain?q=ingress&path="+path, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+		var resp h.SearchExplainResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		plan := strings.Join(resp.Plan, "\n")
+		if !resp.Analyze || !strings.Contains(plan, "actual time=") || !strings.Contains(plan, "Execution Time") {
+			t.Errorf("%s: expected an ANALYZE plan, got:\n%s", path, plan)
+		}
+		if !strings.Contains(resp.Query, node) {
+			t.Errorf("%s: unexpected statement %s", path, resp.Query)
+		}
+	}
+}
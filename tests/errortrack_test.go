@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/errortrack"
+)
+
+// captureTracker records events instead of sending them.
+type captureTracker struct {
+	mu     sync.Mutex
+	events []errortrack.Event
+}
+
+func (c *captureTracker) Capture(ev errortrack.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, ev)
+}
+
+func (c *captureTracker) Flush(time.Duration) bool { return true }
+
+func (c *captureTracker) Events() []errortrack.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]errortrack.Event(nil), c.events...)
+}
+
+// useCaptureTracker installs a captureTracker as the package-wide tracker for the test.
+func useCaptureTracker(t *testing.T) *captureTracker {
+	t.Helper()
+	c := &captureTracker{}
+	errortrack.SetDefault(c)
+	t.Cleanup(func() { errortrack.SetDefault(nil) })
+	return c
+}
+
+func TestErrortrack_NoDSNIsNop(t *testing.T) {
+	tr, err := errortrack.New(errortrack.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tr.(errortrack.Nop); !ok {
+		t.Fatalf("expected Nop tracker, got %T", tr)
+	}
+	if _, err := errortrack.New(errortrack.Options{DSN: "not a dsn"}); err == nil {
+		t.Fatal("expected invalid DSN error")
+	}
+}
+
+func TestErrortrack_SendsEnvelope(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		path string
+		auth string
+		body string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		path, auth, body = r.URL.Path, r.Header.Get("X-Sentry-Auth"), string(b)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	dsn := strings.Replace(srv.URL, "http://", "http://publickey@", 1) + "/42"
+	tr, err := errortrack.New(errortrack.Options{DSN: dsn, Release: "abc123", Environment: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/weather?api-key=secret", nil)
+	tr.Capture(errortrack.Event{
+		Err:       errors.New(`Get "https://dmi.example/edr?api-key=hunter2&f=json": timeout`),
+		Message:   "weather fetch error",
+		Request:   req,
+		RequestID: "req-123456",
+		Tags:      map[string]string{"service": "dmi"},
+	})
+	if !tr.Flush(5 * time.Second) {
+		t.Fatal("flush timed out")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/api/42/envelope/" {
+		t.Fatalf("unexpected endpoint %q", path)
+	}
+	if !strings.Contains(auth, "sentry_key=publickey") {
+		t.Fatalf("unexpected auth header %q", auth)
+	}
+	for _, want := range []string{`"release":"abc123"`, `"environment":"test"`, `"request_id":"req-123456"`, `"service":"dmi"`, `"url":"/api/weather"`, "weather fetch error"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("envelope missing %s: %s", want, body)
+		}
+	}
+	if strings.Contains(body, "hunter2") || strings.Contains(body, "secret") {
+		t.Fatalf("envelope leaks credentials: %s", body)
+	}
+}
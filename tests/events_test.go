@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"testing"
+
+	"devops-valgfag/internal/events"
+)
+
+func TestEventsHub_PublishAndReplay(t *testing.T) {
+	hub := events.NewHub(2)
+
+	hub.Publish("announcement", "one")
+	hub.Publish("announcement", "two")
+	hub.Publish("announcement", "three") // "one" falls out of the history
+
+	ch, missed := hub.Subscribe(1)
+	defer hub.Unsubscribe(ch)
+
+	if len(missed) != 2 || missed[0].Data != "two" || missed[1].Data != "three" {
+		t.Fatalf("unexpected replay: %+v", missed)
+	}
+
+	ev := hub.Publish("weather", "down")
+	got := <-ch
+	if got.ID != ev.ID || got.Type != "weather" {
+		t.Fatalf("expected live event %+v, got %+v", ev, got)
+	}
+
+	hub.Unsubscribe(ch)
+	if hub.Subscribers() != 0 {
+		t.Fatalf("expected 0 subscribers after unsubscribe, got %d", hub.Subscribers())
+	}
+}
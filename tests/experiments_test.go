@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/experiments"
+)
+
+func TestExperiments_AssignAndParse(t *testing.T) {
+	exps, err := experiments.Parse("search_merge=append:90,interleave:10; search_ranking=v1,v2")
+	if err != nil || len(exps) != 2 {
+		t.Fatalf("Parse: %v %+v", err, exps)
+	}
+	merge := exps[0]
+	if merge.Assign("visitor-1") != merge.Assign("visitor-1") {
+		t.Fatal("assignment must be deterministic")
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		counts[merge.Assign(fmt.Sprintf("unit-%d", i))]++
+	}
+	if n := counts["interleave"]; n < 800 || n > 1200 {
+		t.Fatalf("expected about 10%% interleave, got %d of 10000", n)
+	}
+
+	if got := experiments.AssignAll(exps, "u").String(); !strings.HasPrefix(got, "search_merge=") || !strings.Contains(got, ",search_ranking=v") {
+		t.Fatalf("unexpected assignment string %q", got)
+	}
+
+	for _, bad := range []string{"x=a", "x=a:1,a:2", "x=a:0,b:0", "x", "x=a:-1,b", "X=a,b", "x=a,b;x=a,b"} {
+		if _, err := experiments.Parse(bad); err == nil {
+			t.Errorf("Parse(%q): expected an error", bad)
+		}
+	}
+	if err := h.SetExperiments([]experiments.Experiment{{Name: "search_merge", Variants: []experiments.Variant{{Name: "append", Weight: 1}, {Name: "shuffle", Weight: 1}}}}); err == nil {
+		t.Error("expected an error for a variant the code does not implement")
+	}
+}
+
+// Searches issue the bucketing cookie; clicks are tagged with the variants and reported per
+// variant to admins.
+func TestExperiments_ClicksTagged(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	exps, err := experiments.Parse("search_merge=append,interleave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetExperiments(exps); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.SetExperiments(nil) }()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/search?q=welcome", nil))
+	var expCookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == "exp_id" {
+			expCookie = c
+		}
+	}
+	if expCookie == nil {
+		t.Fatal("expected an exp_id cookie")
+	}
+	want := experiments.AssignAll(exps, expCookie.Value).String()
+
+	click := `{"query":"welcome","url":"/welcome","rank":2}`
+	if rr := adminClient(router, []*http.Cookie{expCookie})(http.MethodPost, "/api/search/click", click); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if rr := adminClient(router, nil)(http.MethodPost, "/api/search/click", click); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	var tagged, untagged int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM search_clicks WHERE variants = ?`, want).Scan(&tagged); err != nil || tagged != 1 {
+		t.Fatalf("expected one click tagged %q, got %d (%v)", want, tagged, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM search_clicks WHERE variants = ''`).Scan(&untagged); err != nil || untagged != 1 {
+		t.Fatalf("a click without exp_id cookie must not be tagged, got %d (%v)", untagged, err)
+	}
+
+	cookies := registerAndLogin(t, router, "scientist", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'scientist'`); err != nil {
+		t.Fatal(err)
+	}
+	rr = adminClient(router, cookies)(http.MethodGet, "/admin/experiments", "")
+	var report h.AdminExperimentsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil || len(report.Experiments) != 1 {
+		t.Fatalf("unexpected report (%d): %s", rr.Code, rr.Body.String())
+	}
+	for _, v := range report.Experiments[0].Variants {
+		clicks := 0
+		if "search_merge="+v.Name == want {
+			clicks = 1
+		}
+		if v.Clicks != clicks || (clicks == 1 && v.AvgRank != 2) {
+			t.Fatalf("unexpected variant stats %+v (assigned %s)", v, want)
+		}
+	}
+	if len(report.Available["search_ranking"]) != 2 {
+		t.Fatalf("expected the available experiments, got %+v", report.Available)
+	}
+}
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	dbx "devops-valgfag/internal/db"
+)
+
+// The external cache upserts by (tenant, query, language, url), keeps tenants apart and
+// honours the caller's context.
+func TestExternalCache_UpsertAndContext(t *testing.T) {
+	_, db := setupTestServer(t)
+	defer closeDB(t, db)
+	ctx := context.Background()
+
+	if ok, err := dbx.ExternalExists(ctx, db, 1, "gopher", "en"); err != nil || ok {
+		t.Fatalf("empty cache: exists=%v err=%v", ok, err)
+	}
+
+	first := []dbx.ExternalResult{
+		{Title: "Gopher", URL: "https://en.wikipedia.org/wiki/Gopher", Snippet: "old"},
+		{Title: "Go", URL: "https://en.wikipedia.org/wiki/Go", Snippet: "language"},
+	}
+	if err := dbx.InsertExternal(ctx, db, 1, "gopher", "en", first); err != nil {
+		t.Fatal(err)
+	}
+	rescraped := []dbx.ExternalResult{{Title: "Gopher (animal)", URL: "https://en.wikipedia.org/wiki/Gopher", Snippet: "new"}}
+	if err := dbx.InsertExternal(ctx, db, 1, "gopher", "en", rescraped); err != nil {
+		t.Fatalf("re-scrape must update, not fail: %v", err)
+	}
+
+	got, err := dbx.GetExternal(ctx, db, 1, "gopher", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Title != "Gopher (animal)" || got[0].Snippet != "new" {
+		t.Fatalf("unexpected cache contents %+v", got)
+	}
+
+	if ok, err := dbx.ExternalExists(ctx, db, 2, "gopher", "en"); err != nil || ok {
+		t.Fatalf("other tenant: exists=%v err=%v", ok, err)
+	}
+	if ok, err := dbx.ExternalExists(ctx, db, 1, "gopher", "en"); err != nil || !ok {
+		t.Fatalf("cached query: exists=%v err=%v", ok, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := dbx.InsertExternal(canceled, db, 1, "rust", "en", first); err == nil {
+		t.Fatal("expected an error with a canceled context")
+	}
+	if ok, _ := dbx.ExternalExists(ctx, db, 1, "rust", "en"); ok {
+		t.Fatal("a canceled insert must not leave rows behind")
+	}
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	dbx "devops-valgfag/internal/db"
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/scraper"
+	"devops-valgfag/internal/testutil"
+)
+
+func getPage(t *testing.T, router http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// The search page enriches results from the (mocked) Wikipedia API, configured only through
+// WIKIPEDIA_API_URL, caches them, and still answers with local results when the API fails or
+// hangs.
+func TestExternalMock_SearchEnrichment(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetDialect(dialect.SQLite)
+	defer h.SetDialect(dialect.Postgres)
+	h.EnableExternalSearch(true)
+	defer h.EnableExternalSearch(false)
+	ctx := context.Background()
+
+	apis := testutil.NewExternalAPIs(t)
+	apis.Setenv(t)
+
+	rec := getPage(t, router, "/search?q=kubernetes&language=en")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "OpenShift") || !strings.Contains(body, "https://en.wikipedia.org/?curid=48441598") {
+		t.Fatalf("expected the Wikipedia results on the page, got %d:\n%s", rec.Code, body)
+	}
+	if strings.Contains(body, "alert(1)") {
+		t.Fatal("the snippet's script must not reach the page")
+	}
+	if cached, err := dbx.ExternalExists(ctx, db, 1, "kubernetes", "en"); err != nil || !cached {
+		t.Fatalf("expected the results cached, got %v (%v)", cached, err)
+	}
+	getPage(t, router, "/search?q=kubernetes&language=en")
+	if n := apis.Requests(testutil.Wikipedia); n != 1 {
+		t.Fatalf("the repeated search must use the cache, got %d Wikipedia requests", n)
+	}
+
+	// Promotion fetches full articles from the same endpoint.
+	if a, err := scraper.WikipediaArticle(ctx, "https://en.wikipedia.org/?curid=48441598"); err != nil || a.Title != "Kubernetes" {
+		t.Fatalf("expected the article from the mock, got %+v (%v)", a, err)
+	}
+
+	scraper.SetHTTPClient(&http.Client{Timeout: 100 * time.Millisecond})
+	defer scraper.SetHTTPClient(nil)
+	// Each scenario searches another word of the sample page, so none is answered from the cache.
+	for query, s := range map[string]testutil.Scenario{
+		"welcome":  testutil.ServerError,
+		"best":     testutil.Unauthorized,
+		"search":   testutil.Malformed,
+		"engine":   testutil.Empty,
+		"whoknows": testutil.Timeout,
+	} {
+		apis.Set(testutil.Wikipedia, s)
+		rec := getPage(t, router, "/search?q="+query+"&language=en")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/page/1") || strings.Contains(rec.Body.String(), "OpenShift") {
+			t.Errorf("%s: expected only the local result, got %d:\n%s", s, rec.Code, rec.Body.String())
+		}
+		if cached, _ := dbx.ExternalExists(ctx, db, 1, query, "en"); cached {
+			t.Errorf("%s: nothing may be cached", s)
+		}
+	}
+}
+
+// The weather API and page read the (mocked) DMI API through DMI_API_URL and turn every kind
+// of provider failure into 503.
+func TestExternalMock_Weather(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	apis := testutil.NewExternalAPIs(t)
+	apis.Setenv(t)
+	h.ResetWeatherCache()
+	t.Cleanup(h.ResetWeatherCache) // keep the mocked forecast from other tests
+
+	rec := getPage(t, router, "/api/weather")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got h.WeatherAPIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Location.Latitude != 55.715 || got.Location.Longitude != 12.561 || got.Forecast.Temperature != 284.65 {
+		t.Fatalf("unexpected forecast %+v", got)
+	}
+	if rec := getPage(t, router, "/weather"); rec.Code != http.StatusOK {
+		t.Fatalf("weather page: expected 200, got %d", rec.Code)
+	}
+	if n := apis.Requests(testutil.DMI); n != 1 {
+		t.Fatalf("the Copenhagen forecast must be cached, got %d DMI requests", n)
+	}
+
+	h.SetWeatherHTTPClient(&http.Client{Timeout: 100 * time.Millisecond})
+	defer h.SetWeatherHTTPClient(nil)
+	for _, s := range []testutil.Scenario{testutil.ServerError, testutil.Unauthorized, testutil.Malformed, testutil.Empty, testutil.Timeout} {
+		apis.Set(testutil.DMI, s)
+		h.ResetWeatherCache()
+		if rec := getPage(t, router, "/api/weather"); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected 503, got %d: %s", s, rec.Code, rec.Body.String())
+		}
+		// An empty forecast is still an answer: the page renders without one.
+		want := http.StatusServiceUnavailable
+		if s == testutil.Empty {
+			want = http.StatusOK
+		}
+		if rec := getPage(t, router, "/weather"); rec.Code != want {
+			t.Errorf("%s: weather page: expected %d, got %d", s, want, rec.Code)
+		}
+	}
+
+	apis.Set(testutil.DMI, testutil.OK)
+	h.ResetWeatherCache()
+	t.Setenv("DMI_API_KEY", "wrong-key")
+	if rec := getPage(t, router, "/api/weather"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("wrong key: expected 503, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/dialect"
+)
+
+// updateGolden rewrites the golden files from the current output instead of comparing:
+//
+//	go test ./tests -run TestGoldenPages -update
+//
+// Review the diff of tests/testdata/golden before committing it.
+var updateGolden = flag.Bool("update", false, "rewrite tests/testdata/golden from the current output")
+
+// Values that change from run to run, replaced before comparing.
+var goldenVolatile = []struct {
+	re   *regexp.Regexp
+	with string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:?\d{2})?`), "DATETIME"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}`), "DATE"},
+	{regexp.MustCompile(`Joined \d{1,2} \w+ \d{4}`), "Joined DATE"},
+	{regexp.MustCompile(`&copy; ` + strconv.Itoa(time.Now().Year())), "&copy; YEAR"},
+	// Asset fingerprints change with every CSS edit.
+	{regexp.MustCompile(`(/static/[^"]+)\.[0-9a-f]{10}(\.\w+")`), "$1.HASH$2"},
+}
+
+// normalizeGolden makes rendered HTML comparable: volatile values are replaced, lines are
+// trimmed and blank lines (left behind by template actions) are dropped.
+func normalizeGolden(body string) string {
+	for _, v := range goldenVolatile {
+		body = v.re.ReplaceAllString(body, v.with)
+	}
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Every page template rendered with representative data, compared with tests/testdata/golden.
+// A template change that alters a page fails here with a diff; if the change is intended,
+// run with -update and commit the new golden files.
+func TestGoldenPages(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	// The test schema is SQLite: give search its SQLite queries so results render.
+	h.SetDialect(dialect.SQLite)
+	defer h.SetDialect(dialect.Postgres)
+
+	cookies := registerAndLogin(t, router, "golden", "golden-password")
+	// A tag on the sample page, so the tag cloud and the result's tags render.
+	if _, err := db.Exec(`INSERT INTO tags (slug, name) VALUES ('guide', 'Guide')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO page_tags (page_id, tag_id) VALUES (1, 1)`); err != nil {
+		t.Fatal(err)
+	}
+
+	form := func(values url.Values) *strings.Reader { return strings.NewReader(values.Encode()) }
+	cases := []struct {
+		name     string
+		method   string
+		path     string
+		body     *strings.Reader
+		loggedIn bool
+		header   map[string]string
+		status   int
+	}{
+		{name: "home_with_tags", path: "/", status: http.StatusOK},
+		{name: "home_logged_in", path: "/", loggedIn: true, status: http.StatusOK},
+		{name: "search_results", path: "/search?q=welcome", status: http.StatusOK},
+		{name: "search_results_logged_in", path: "/search?q=welcome", loggedIn: true, status: http.StatusOK},
+		{name: "search_no_results", path: "/search?q=zzzqqq", status: http.StatusOK},
+		{name: "search_results_fragment", path: "/search?q=welcome", header: map[string]string{"HX-Request": "true"}, status: http.StatusOK},
+		{name: "about_danish", path: "/about", header: map[string]string{"Accept-Language": "da"}, status: http.StatusOK},
+		{name: "login", path: "/login", status: http.StatusOK},
+		{name: "login_failed", method: http.MethodPost, path: "/api/login",
+			body: form(url.Values{"username": {"golden"}, "password": {"wrong"}}), status: http.StatusUnauthorized},
+		{name: "register", path: "/register", status: http.StatusOK},
+		{name: "register_invalid", method: http.MethodPost, path: "/api/register",
+			body: form(url.Values{"username": {"someone"}, "email": {"someone@example.com"}, "password": {"a"}, "password2": {"b"}}), status: http.StatusBadRequest},
+		{name: "reset_password", path: "/reset-password?token=abc", status: http.StatusOK},
+		{name: "reset_password_mismatch", method: http.MethodPost, path: "/api/password-reset",
+			body: form(url.Values{"token": {"abc"}, "password": {"new-password-1"}, "password2": {"new-password-2"}}), status: http.StatusBadRequest},
+		{name: "article", path: "/page/1", status: http.StatusOK},
+		{name: "settings", path: "/settings", loggedIn: true, status: http.StatusOK},
+		{name: "bookmarks_empty", path: "/bookmarks", loggedIn: true, status: http.StatusOK},
+		{name: "profile", path: "/u/golden", status: http.StatusOK},
+		{name: "weather_unavailable", path: "/weather", status: http.StatusServiceUnavailable},
+		{name: "not_found", path: "/no-such-page", status: http.StatusNotFound},
+		{name: "stats", path: "/stats", status: http.StatusOK},
+	}
+
+	t.Setenv("DMI_API_KEY", "") // the weather page shows its error state
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			method := c.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			var req *http.Request
+			if c.body != nil {
+				req = httptest.NewRequest(method, c.path, c.body)
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(method, c.path, nil)
+			}
+			req.Header.Set("X-Request-ID", "golden-request") // shown on error pages
+			for k, v := range c.header {
+				req.Header.Set(k, v)
+			}
+			if c.loggedIn {
+				for _, ck := range cookies {
+					req.AddCookie(ck)
+				}
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != c.status {
+				t.Fatalf("%s %s: expected %d, got %d", method, c.path, c.status, rec.Code)
+			}
+
+			got := normalizeGolden(rec.Body.String())
+			path := filepath.Join("testdata", "golden", c.name+".html")
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("%s differs from %s (run with -update if the change is intended):\n%s", c.name, path, lineDiff(string(want), got))
+			}
+		})
+	}
+}
+
+// lineDiff reports the first lines where want and got differ, with a little context.
+func lineDiff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < max(len(w), len(g)); i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			var b strings.Builder
+			for j := max(i-2, 0); j < i; j++ {
+				b.WriteString("  " + w[j] + "\n")
+			}
+			b.WriteString("- " + wl + "\n+ " + gl + "\n")
+			return "line " + strconv.Itoa(i+1) + ":\n" + b.String()
+		}
+	}
+	return "(no line differs)"
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/ratelimit"
+
+	"github.com/gorilla/mux"
+)
+
+type graphQLResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, router *mux.Router, query string, cookies []*http.Cookie) (graphQLResponse, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp graphQLResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return resp, rr
+}
+
+// Register + login through mutations, then search/me with the session cookie they set.
+func TestGraphQL_RegisterLoginSearch(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	resp, _ := postGraphQL(t, router, `mutation { register(username:"gql", email:"gql@example.com", password:"pw", password2:"pw") { ok message } }`, nil)
+	if !strings.Contains(string(resp.Data["register"]), `"ok":true`) {
+		t.Fatalf("register failed: %s", resp.Data["register"])
+	}
+
+	// Search requires a session, same as /api/search.
+	resp, _ = postGraphQL(t, router, `{ search(q:"test") { title } }`, nil)
+	if len(resp.Errors) == 0 || resp.Errors[0].Message != "unauthorized" {
+		t.Fatalf("expected unauthorized error, got %+v", resp.Errors)
+	}
+
+	resp, rr := postGraphQL(t, router, `mutation { login(username:"gql", password:"pw") { ok user { username } } }`, nil)
+	if !strings.Contains(string(resp.Data["login"]), `"username":"gql"`) {
+		t.Fatalf("login failed: %s", resp.Data["login"])
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("expected session cookie from login mutation")
+	}
+
+	resp, _ = postGraphQL(t, router, `{ me { username email } search(q:"test", limit:5) { title url } }`, cookies)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("unexpected errors: %+v", resp.Errors)
+	}
+	if !strings.Contains(string(resp.Data["me"]), `"email":"gql@example.com"`) {
+		t.Fatalf("unexpected me: %s", resp.Data["me"])
+	}
+	if string(resp.Data["search"]) == "" || string(resp.Data["search"]) == "null" {
+		t.Fatalf("expected search list, got %s", resp.Data["search"])
+	}
+}
+
+// Every aliased login in a document is charged to the auth rate limit.
+func TestGraphQL_LoginRateLimitedPerMutation(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetRateLimiter("auth", ratelimit.NewMemory(2, time.Minute))
+	defer h.SetRateLimiter("auth", nil)
+
+	resp, _ := postGraphQL(t, router, `mutation {
+		a: login(username:"nobody", password:"one") { ok message }
+		b: login(username:"nobody", password:"two") { ok message }
+		c: login(username:"nobody", password:"three") { ok message }
+	}`, nil)
+	if strings.Contains(string(resp.Data["b"]), "Too many requests") {
+		t.Fatalf("second login unexpectedly limited: %s", resp.Data["b"])
+	}
+	if !strings.Contains(string(resp.Data["c"]), "Too many requests") {
+		t.Fatalf("expected the third login to be rate limited, got %s", resp.Data["c"])
+	}
+}
+
+// The register mutation runs the register form's bot checks: without the signed form token
+// no account is created.
+func TestGraphQL_RegisterRunsBotChecks(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	if err := h.SetRegistrationGuard(h.RegistrationGuardConfig{MinSubmitTime: time.Second, SigningKey: []byte("test-key")}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.SetRegistrationGuard(h.RegistrationGuardConfig{}) }()
+
+	resp, _ := postGraphQL(t, router, `mutation { register(username:"bot", email:"bot@example.com", password:"pw", password2:"pw", formToken:"123.forged") { ok message } }`, nil)
+	if !strings.Contains(string(resp.Data["register"]), `"ok":false`) {
+		t.Fatalf("expected the forged form token to be rejected, got %s", resp.Data["register"])
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE username = 'bot'`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("expected no account, got %d (%v)", n, err)
+	}
+}
+
+// With TERMS_VERSION set, the register mutation needs acceptTerms and records the version.
+func TestGraphQL_RegisterRequiresTerms(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetTerms(h.TermsConfig{Version: "v1"})
+	defer h.SetTerms(h.TermsConfig{})
+
+	const register = `mutation { register(username:"gqlterms", email:"gqlterms@example.com", password:"pw", password2:"pw"%s) { ok message } }`
+	resp, _ := postGraphQL(t, router, fmt.Sprintf(register, ""), nil)
+	if !strings.Contains(string(resp.Data["register"]), `"ok":false`) {
+		t.Fatalf("expected registration without accepting the terms to fail, got %s", resp.Data["register"])
+	}
+
+	resp, _ = postGraphQL(t, router, fmt.Sprintf(register, ", acceptTerms:true"), nil)
+	if !strings.Contains(string(resp.Data["register"]), `"ok":true`) {
+		t.Fatalf("register failed: %s", resp.Data["register"])
+	}
+	var version string
+	if err := db.QueryRow(`SELECT terms_version FROM users WHERE username = 'gqlterms'`).Scan(&version); err != nil || version != "v1" {
+		t.Fatalf("expected terms_version v1, got %q (%v)", version, err)
+	}
+}
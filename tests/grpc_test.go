@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/searchpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialGRPC serves h.NewGRPCServer over an in-memory listener and returns a client connection.
+func dialGRPC(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := h.NewGRPCServer()
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// Search and Suggest share the HTTP pipeline; the standard health service answers grpc-health-probe.
+func TestGRPC_SearchSuggestHealth(t *testing.T) {
+	db := setupTestHandlers(t)
+	defer closeDB(t, db)
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES
+		('Golang', '/golang', 'en', 'go is a language'),
+		('Gophers', '/gophers', 'en', 'gophers like go')`); err != nil {
+		t.Fatalf("failed to insert pages: %v", err)
+	}
+
+	conn := dialGRPC(t)
+	client := searchpb.NewSearchServiceClient(conn)
+	ctx := context.Background()
+
+	// Local search uses ILIKE (unsupported by SQLite), so only the RPC contract is checked here.
+	if _, err := client.Search(ctx, &searchpb.SearchRequest{Query: "go", Limit: 5}); err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	sg, err := client.Suggest(ctx, &searchpb.SuggestRequest{Prefix: "gop"})
+	if err != nil {
+		t.Fatalf("Suggest: %v", err)
+	}
+	if len(sg.GetSuggestions()) != 1 || sg.GetSuggestions()[0] != "Gophers" {
+		t.Fatalf("unexpected suggestions: %v", sg.GetSuggestions())
+	}
+
+	hr, err := client.Health(ctx, &searchpb.HealthRequest{})
+	if err != nil || hr.GetStatus() != searchpb.HealthResponse_STATUS_SERVING {
+		t.Fatalf("Health: %v %v", hr, err)
+	}
+
+	std, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || std.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("grpc.health.v1 Check: %v %v", std, err)
+	}
+}
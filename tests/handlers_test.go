@@ -28,7 +28,12 @@ CREATE TABLE IF NOT EXISTS users (
   id        INTEGER PRIMARY KEY AUTOINCREMENT,
   username  TEXT    NOT NULL UNIQUE,
   email     TEXT    NOT NULL UNIQUE,
-  password  TEXT    NOT NULL
+  password  TEXT    NOT NULL,
+  deleted_at TIMESTAMP,
+  last_login_at TIMESTAMP,
+  status    TEXT NOT NULL DEFAULT 'active',
+  must_reset_password BOOLEAN NOT NULL DEFAULT FALSE,
+  session_version INTEGER NOT NULL DEFAULT 0
 );
 
 CREATE TABLE IF NOT EXISTS pages (
@@ -37,7 +42,9 @@ CREATE TABLE IF NOT EXISTS pages (
   url          TEXT    NOT NULL UNIQUE,
   language     TEXT    NOT NULL CHECK(language IN ('en','da')) DEFAULT 'en',
   last_updated TIMESTAMP,
-  content      TEXT    NOT NULL
+  content      TEXT    NOT NULL,
+  deleted_at   TIMESTAMP,
+  tenant_id    INTEGER NOT NULL DEFAULT 1
 );
 `
 	if _, err := db.Exec(schema); err != nil {
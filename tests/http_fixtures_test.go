@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"devops-valgfag/internal/scraper"
+	"devops-valgfag/internal/service"
+	"devops-valgfag/internal/testutil"
+)
+
+// fixtureResponse is a canned answer: a status code with a testutil fixture (or an inline
+// body), or a transport error.
+type fixtureResponse struct {
+	status int
+	file   string
+	body   string
+	err    error
+}
+
+// fixtureDoer is an HTTPDoer for the scraper and the DMI client that replays recorded
+// responses by URL path instead of reaching the real hosts, and keeps the requests it got.
+type fixtureDoer struct {
+	t      *testing.T
+	routes map[string]fixtureResponse // by request URL path
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (d *fixtureDoer) Do(req *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	d.requests = append(d.requests, req)
+	d.mu.Unlock()
+
+	r, ok := d.routes[req.URL.Path]
+	if !ok {
+		d.t.Errorf("unexpected request %s", req.URL)
+		r = fixtureResponse{status: http.StatusNotFound}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	body := []byte(r.body)
+	if r.file != "" {
+		body = testutil.Fixture(r.file)
+	}
+	return &http.Response{
+		StatusCode: r.status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(body))),
+		Request:    req,
+	}, nil
+}
+
+func (d *fixtureDoer) lastRequest() *http.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.requests) == 0 {
+		return nil
+	}
+	return d.requests[len(d.requests)-1]
+}
+
+func TestScraper_WikipediaSearchWithFixtures(t *testing.T) {
+	doer := &fixtureDoer{t: t, routes: map[string]fixtureResponse{
+		"/w/api.php": {status: http.StatusOK, file: "wikipedia_search.json"},
+	}}
+	scraper.SetHTTPClient(doer)
+	defer scraper.SetHTTPClient(nil)
+	t.Setenv("WIKI_USER_AGENT", "fixture-test/1.0")
+
+	results, err := scraper.WikipediaSearch("kubernetes", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Title != "Kubernetes" || results[0].URL != "https://en.wikipedia.org/?curid=48441598" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if s := results[0].Snippet; strings.Contains(s, "<script") || !strings.Contains(s, `<span class="searchmatch">Kubernetes</span>`) {
+		t.Errorf("snippet must keep only the highlight markup, got %q", s)
+	}
+	req := doer.lastRequest()
+	if q := req.URL.Query(); q.Get("srsearch") != "kubernetes" || q.Get("srlimit") != "3" || req.Header.Get("User-Agent") != "fixture-test/1.0" {
+		t.Errorf("unexpected request %s (User-Agent %q)", req.URL, req.Header.Get("User-Agent"))
+	}
+
+	for name, r := range map[string]fixtureResponse{
+		"server error":   {status: http.StatusServiceUnavailable},
+		"malformed JSON": {status: http.StatusOK, body: `{"query": {"search": [`},
+		"transport":      {err: errors.New("dial tcp: connection refused")},
+	} {
+		doer.routes["/w/api.php"] = r
+		if results, err := scraper.WikipediaSearch("kubernetes", 3); err == nil {
+			t.Errorf("%s: expected an error, got %+v", name, results)
+		}
+	}
+}
+
+func TestScraper_WikipediaArticleWithFixtures(t *testing.T) {
+	doer := &fixtureDoer{t: t, routes: map[string]fixtureResponse{
+		"/w/api.php": {status: http.StatusOK, file: "wikipedia_article.json"},
+	}}
+	scraper.SetHTTPClient(doer)
+	defer scraper.SetHTTPClient(nil)
+	ctx := context.Background()
+
+	a, err := scraper.WikipediaArticle(ctx, "https://en.wikipedia.org/?curid=48441598")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Title != "Kubernetes" || a.Language != "en" || !strings.Contains(a.Text, "\n\nOriginally designed by Google") {
+		t.Fatalf("unexpected article: %+v", a)
+	}
+	if req := doer.lastRequest(); req.URL.Host != "en.wikipedia.org" || req.URL.Query().Get("pageids") != "48441598" {
+		t.Errorf("unexpected request %s", req.URL)
+	}
+
+	if _, err := scraper.WikipediaArticle(ctx, "https://da.wikipedia.org/wiki/Bl%C3%A5b%C3%A6r"); err != nil {
+		t.Fatal(err)
+	}
+	if req := doer.lastRequest(); req.URL.Host != "da.wikipedia.org" || req.URL.Query().Get("titles") != "Blåbær" {
+		t.Errorf("a /wiki/ URL must be fetched by title from its own wiki, got %s", req.URL)
+	}
+
+	doer.routes["/w/api.php"] = fixtureResponse{status: http.StatusOK, file: "wikipedia_article_missing.json"}
+	if _, err := scraper.WikipediaArticle(ctx, "https://en.wikipedia.org/wiki/No_such_article"); err == nil {
+		t.Error("a missing article must be an error")
+	}
+	doer.routes["/w/api.php"] = fixtureResponse{status: http.StatusTooManyRequests}
+	if _, err := scraper.WikipediaArticle(ctx, "https://en.wikipedia.org/wiki/Kubernetes"); err == nil {
+		t.Error("a 429 must be an error")
+	}
+	if _, err := scraper.WikipediaArticle(ctx, "https://example.com/wiki/Kubernetes"); !errors.Is(err, scraper.ErrNotWikipedia) {
+		t.Errorf("expected ErrNotWikipedia without a request, got %v", err)
+	}
+}
+
+func TestDMIClient_ForecastWithFixtures(t *testing.T) {
+	const path = "/v1/forecastedr/collections/harmonie_dini_sf/position"
+	doer := &fixtureDoer{t: t, routes: map[string]fixtureResponse{
+		path: {status: http.StatusOK, file: "dmi_forecast.json"},
+	}}
+	var statuses []bool
+	client := service.DMIClient{
+		APIKey:       "fixture-key",
+		HTTPClient:   doer,
+		ReportStatus: func(up bool) { statuses = append(statuses, up) },
+	}
+	ctx := context.Background()
+
+	data, err := client.Forecast(ctx, service.CopenhagenLat, service.CopenhagenLon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := service.Current(data)
+	if err != nil || len(data.Features) != 2 || cur.Properties.Temperature != 284.65 || cur.Properties.WindDir != 245 {
+		t.Fatalf("unexpected forecast %+v (%v)", data, err)
+	}
+	req := doer.lastRequest()
+	if req.URL.Host != "dmigw.govcloud.dk" || req.URL.Query().Get("api-key") != "fixture-key" ||
+		req.URL.Query().Get("coords") != "POINT(12.561 55.715)" {
+		t.Errorf("unexpected request %s", req.URL)
+	}
+
+	// A 4xx is our key or request (the provider is up); a 5xx or transport error is an outage.
+	for _, c := range []struct {
+		r  fixtureResponse
+		up bool
+	}{
+		{fixtureResponse{status: http.StatusUnauthorized, file: "dmi_unauthorized.json"}, true},
+		{fixtureResponse{status: http.StatusBadGateway}, false},
+		{fixtureResponse{err: errors.New("i/o timeout")}, false},
+	} {
+		statuses = nil
+		doer.routes[path] = c.r
+		if _, err := client.Forecast(ctx, service.CopenhagenLat, service.CopenhagenLon); err == nil {
+			t.Errorf("%+v: expected an error", c.r)
+		}
+		if len(statuses) != 1 || statuses[0] != c.up {
+			t.Errorf("%+v: expected the provider reported up=%v, got %v", c.r, c.up, statuses)
+		}
+	}
+
+	requests := len(doer.requests)
+	if _, err := (service.DMIClient{HTTPClient: doer}).Forecast(ctx, 1, 2); err == nil || len(doer.requests) != requests {
+		t.Errorf("without an API key there must be an error and no request, got %v", err)
+	}
+}
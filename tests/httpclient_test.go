@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/httpclient"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Clients only reach allowlisted hosts, redirects included, send the policy's User-Agent and
+// wait for the per-host rate.
+func TestHTTPClient_EgressPolicy(t *testing.T) {
+	var hits atomic.Int32
+	var userAgent atomic.Value
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		userAgent.Store(r.UserAgent())
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)+"/", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	t.Cleanup(func() { httpclient.SetPolicy(httpclient.Policy{}) })
+
+	client := httpclient.New("egresstest", 5*time.Second)
+	blocked := metrics.EgressRequests.WithLabelValues("egresstest", "blocked")
+	get := func(path string) error {
+		resp, err := client.Get(srv.URL + path)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+
+	httpclient.SetPolicy(httpclient.Policy{AllowHosts: []string{"127.0.0.1"}})
+	if err := get("/"); err != nil {
+		t.Fatal(err)
+	}
+	if ua := userAgent.Load(); ua != httpclient.DefaultUserAgent {
+		t.Fatalf("expected the default User-Agent, got %q", ua)
+	}
+	before := testutil.ToFloat64(blocked)
+	if err := get("/redirect"); !errors.Is(err, httpclient.ErrHostNotAllowed) {
+		t.Fatalf("a redirect to another host must be blocked, got %v", err)
+	}
+
+	httpclient.SetPolicy(httpclient.Policy{AllowHosts: []string{".example.com"}, UserAgent: "custom/1.0"})
+	n := hits.Load()
+	if err := get("/"); !errors.Is(err, httpclient.ErrHostNotAllowed) {
+		t.Fatalf("expected ErrHostNotAllowed, got %v", err)
+	}
+	if hits.Load() != n || testutil.ToFloat64(blocked) != before+2 {
+		t.Fatal("a blocked request must not be sent, and must be counted")
+	}
+
+	httpclient.SetPolicy(httpclient.Policy{HostRate: 2, UserAgent: "custom/1.0"})
+	start := time.Now()
+	for range 4 {
+		if err := get("/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if took := time.Since(start); took < 900*time.Millisecond {
+		t.Fatalf("2 requests per second: 4 requests must take about 1s, took %s", took)
+	}
+	if ua := userAgent.Load(); ua != "custom/1.0" {
+		t.Fatalf("expected the policy's User-Agent, got %q", ua)
+	}
+}
+
+func TestHTTPClient_ParseHosts(t *testing.T) {
+	hosts, err := httpclient.ParseHosts(" en.wikipedia.org, .wikipedia.org,*.govcloud.dk ,")
+	if err != nil || len(hosts) != 3 || hosts[2] != "*.govcloud.dk" {
+		t.Fatalf("unexpected hosts %q (%v)", hosts, err)
+	}
+	for _, bad := range []string{"https://example.com", "example.com:443", "*", "."} {
+		if _, err := httpclient.ParseHosts(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"devops-valgfag/internal/i18n"
+)
+
+func TestI18nDetect_CookieBeatsAcceptLanguage(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "da-DK,da;q=0.9")
+	req.AddCookie(&http.Cookie{Name: i18n.CookieName, Value: "en"})
+
+	if got := i18n.Detect(req); got != "en" {
+		t.Fatalf("expected cookie language en, got %s", got)
+	}
+}
+
+func TestI18nFromAcceptLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":                   "en",
+		"da-DK,da;q=0.9":     "da",
+		"fr-FR,da;q=0.5":     "da",
+		"de-DE":              "en",
+		"en-US,en;q=0.9,da":  "en",
+		"not a valid header": "en",
+	}
+	for header, want := range cases {
+		if got := i18n.FromAcceptLanguage(header); got != want {
+			t.Errorf("FromAcceptLanguage(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
+
+// Pages render in Danish when the browser prefers Danish.
+func TestIntegration_AboutPageDanish(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "/about", nil)
+	req.Header.Set("Accept-Language", "da")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for /about, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, `<html lang="da"`) || !strings.Contains(body, "Vores mission") {
+		t.Fatalf("expected Danish about page, got %s", body)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/app"
+	"devops-valgfag/internal/i18n"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
@@ -23,7 +25,7 @@ import (
 // - In-memory SQLite DB: fast + isolated per test (no shared state, no external services)
 // - Real templates: catches missing template funcs/fields and verifies rendered HTML
 // - Cookie-based session store: tests auth flow + cookies realistically
-// - Gorilla mux router: validates route wiring + HTTP methods (GET/POST) like production
+// - The production router (app.NewRouter): validates the route wiring + HTTP methods that ship
 func setupTestServer(t *testing.T) (*mux.Router, *sql.DB) {
 	t.Helper()
 
@@ -42,8 +44,11 @@ func setupTestServer(t *testing.T) (*mux.Router, *sql.DB) {
 
 	// Template funcs used by templates (must match production, otherwise rendering may fail)
 	funcs := template.FuncMap{
-		"now":  time.Now,
-		"year": func() int { return time.Now().Year() },
+		"now":   time.Now,
+		"year":  func() int { return time.Now().Year() },
+		"t":     i18n.T,
+		"url":   h.URL,
+		"asset": h.Asset,
 	}
 
 	// Parse templates from disk so we test actual HTML output and template wiring.
@@ -58,28 +63,11 @@ func setupTestServer(t *testing.T) (*mux.Router, *sql.DB) {
 	// Keep tests deterministic: avoid calling external services (Wikipedia enrichment etc.).
 	h.EnableExternalSearch(false)
 
-	// Router mirrors the routes we support in the application.
-	r := mux.NewRouter()
-
-	// Pages (HTML)
-	r.HandleFunc("/", h.HomePageHandler).Methods(http.MethodGet)
-	r.HandleFunc("/search", h.SearchPageHandler).Methods(http.MethodGet)
-	r.HandleFunc("/about", h.AboutPageHandler).Methods(http.MethodGet)
-	r.HandleFunc("/login", h.LoginPageHandler).Methods(http.MethodGet)
-	r.HandleFunc("/register", h.RegisterPageHandler).Methods(http.MethodGet)
-	r.HandleFunc("/weather", h.WeatherPageHandler).Methods(http.MethodGet)
-
-	// API (auth + search)
-	r.HandleFunc("/api/login", h.APILoginHandler).Methods(http.MethodPost)
-	r.HandleFunc("/api/register", h.APIRegisterHandler).Methods(http.MethodPost)
-	r.HandleFunc("/api/logout", h.APILogoutHandler).Methods(http.MethodPost)
-	r.HandleFunc("/api/search", h.APISearchHandler).Methods(http.MethodGet)
-	r.HandleFunc("/api/weather", h.APIWeatherHandler).Methods(http.MethodGet)
-
-	// Ops endpoints
-	r.HandleFunc("/healthz", h.Healthz).Methods(http.MethodGet)
-	r.HandleFunc("/readyz", h.Readyz).Methods(http.MethodGet)
+	// Failed logins are delayed in production; login_timing_test.go covers that on its own.
+	h.SetLoginFailureDelay(0)
 
+	// The production router (internal/app), so the tests cover the routes that ship.
+	r := app.NewRouter()
 	return r, db
 }
 
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/clientip"
+)
+
+func TestOpsACL_Rules(t *testing.T) {
+	acl, err := clientip.ParseACL(strings.NewReader("# office\nallow 192.0.2.0/24\n\nDENY 192.0.2.13 # laptop\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{"192.0.2.7": true, "192.0.2.13": false, "198.51.100.1": false, "garbage": false} {
+		if got := acl.Permits(ip); got != want {
+			t.Errorf("Permits(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	if deny := (clientip.ACL{Deny: acl.Deny}); !deny.Permits("198.51.100.1") || deny.Permits("192.0.2.13") {
+		t.Error("a deny-only ACL should admit everyone else")
+	}
+	if !(clientip.ACL{}).Permits("garbage") {
+		t.Error("an empty ACL admits everyone")
+	}
+	for _, bad := range []string{"allow", "permit 10.0.0.0/8", "allow 10.0.0.0/40", "allow 10.0.0.1 10.0.0.2"} {
+		if _, err := clientip.ParseACL(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+// Admin routes are only served to permitted networks; rejections are audited and the rule
+// file can be changed at runtime.
+func TestOpsACL_Middleware(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "opsadmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'opsadmin'`); err != nil {
+		t.Fatal(err)
+	}
+	h.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")})
+	defer h.SetTrustedProxies(nil)
+
+	file := filepath.Join(t.TempDir(), "ops.acl")
+	if err := os.WriteFile(file, []byte("allow 198.51.100.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetOpsACL(clientip.ACL{Deny: []netip.Prefix{netip.MustParsePrefix("198.51.100.66/32")}}, file); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.SetOpsACL(clientip.ACL{}, "") }()
+
+	get := func(path, ip string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := get("/admin/tags", "198.51.100.5"); code != http.StatusOK {
+		t.Fatalf("expected an allowed network to pass, got %d", code)
+	}
+	if code := get("/admin/tags", "203.0.113.5"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 outside the allow list, got %d", code)
+	}
+	if code := get("/admin/tags", "198.51.100.66"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a denied address, got %d", code)
+	}
+	if code := get("/api/admin/search/explain?q=x", "203.0.113.5"); code != http.StatusForbidden {
+		t.Fatalf("expected the admin API under /api/admin to be restricted, got %d", code)
+	}
+	if code := get("/api/search?q=x", "203.0.113.5"); code == http.StatusForbidden {
+		t.Fatal("public routes must not be restricted")
+	}
+	var denied int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = 'access.denied' AND client_ip IN ('203.0.113.5', '198.51.100.66')`).Scan(&denied); err != nil || denied != 3 {
+		t.Fatalf("expected 3 audited rejections, got %d (%v)", denied, err)
+	}
+
+	// A broken edit keeps the previous rules; a valid one applies on reload.
+	if err := os.WriteFile(file, []byte("allow nonsense\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ReloadOpsACL(); err == nil {
+		t.Fatal("expected an error for an invalid rule file")
+	}
+	if code := get("/admin/tags", "198.51.100.5"); code != http.StatusOK {
+		t.Fatalf("previous rules should still apply, got %d", code)
+	}
+	if err := os.WriteFile(file, []byte("allow 203.0.113.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ReloadOpsACL(); err != nil {
+		t.Fatal(err)
+	}
+	if code := get("/admin/tags", "203.0.113.5"); code != http.StatusOK {
+		t.Fatalf("expected the reloaded rules to admit 203.0.113.5, got %d", code)
+	}
+	if code := get("/admin/tags", "198.51.100.5"); code != http.StatusForbidden {
+		t.Fatalf("expected the reloaded rules to reject 198.51.100.5, got %d", code)
+	}
+}
@@ -0,0 +1,248 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/jobs"
+)
+
+// Jobs run once, failing jobs are retried with backoff, exhausted jobs end up failed
+// and can be requeued through the admin endpoints.
+func TestJobs_RetryFailAndRequeue(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+	ctx := context.Background()
+
+	q := jobs.New(db, jobs.Options{BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxAttempts: 2})
+	h.SetJobQueue(q)
+	defer h.SetJobQueue(nil)
+
+	var greeted []string
+	q.Register("greet", func(_ context.Context, raw json.RawMessage) error {
+		var p struct{ Name string }
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return err
+		}
+		greeted = append(greeted, p.Name)
+		return nil
+	})
+	brokenCalls := 0
+	q.Register("broken", func(context.Context, json.RawMessage) error {
+		brokenCalls++
+		return errors.New("boom")
+	})
+
+	if _, err := q.Enqueue(ctx, "greet", map[string]string{"name": "gopher"}); err != nil {
+		t.Fatalf("enqueue greet: %v", err)
+	}
+	brokenID, err := q.Enqueue(ctx, "broken", nil)
+	if err != nil {
+		t.Fatalf("enqueue broken: %v", err)
+	}
+	// Not due yet: must not be picked up.
+	if _, err := q.EnqueueAt(ctx, "greet", map[string]string{"name": "later"}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("enqueue later: %v", err)
+	}
+
+	// A few rounds; idle rounds sleep so the retry backoff passes.
+	for i := 0; i < 6; i++ {
+		worked, err := q.RunOnce(ctx)
+		if err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+		if !worked {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if len(greeted) != 1 || greeted[0] != "gopher" {
+		t.Fatalf("expected one greet run for gopher, got %v", greeted)
+	}
+	if brokenCalls != 2 {
+		t.Fatalf("expected broken job to run max_attempts (2) times, got %d", brokenCalls)
+	}
+
+	depth, err := q.Depth(ctx)
+	if err != nil {
+		t.Fatalf("depth: %v", err)
+	}
+	if depth[jobs.StatusDone] != 1 || depth[jobs.StatusFailed] != 1 || depth[jobs.StatusQueued] != 1 {
+		t.Fatalf("unexpected depth: %v", depth)
+	}
+
+	// Admin endpoints.
+	cookies := registerAndLogin(t, router, "jobadmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'jobadmin'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+	adminRequest := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := adminRequest(http.MethodGet, "/admin/jobs?status=failed")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp h.AdminJobsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Jobs) != 1 || resp.Jobs[0].ID != brokenID || resp.Jobs[0].LastError != "boom" || resp.Jobs[0].Attempts != 2 {
+		t.Fatalf("unexpected failed jobs: %+v", resp.Jobs)
+	}
+
+	if rr := adminRequest(http.MethodGet, "/admin/jobs?status=bogus"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid status, got %d", rr.Code)
+	}
+
+	requeuePath := "/admin/jobs/" + strconv.FormatInt(brokenID, 10) + "/requeue"
+	if rr := adminRequest(http.MethodPost, requeuePath); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 on requeue, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// Only failed jobs can be requeued.
+	if rr := adminRequest(http.MethodPost, requeuePath); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 on second requeue, got %d", rr.Code)
+	}
+
+	if worked, err := q.RunOnce(ctx); err != nil || !worked {
+		t.Fatalf("expected requeued job to run, worked=%v err=%v", worked, err)
+	}
+	if brokenCalls != 3 {
+		t.Fatalf("expected requeued job to run again, got %d calls", brokenCalls)
+	}
+}
+
+// A worker whose lease expired loses the job: another worker takes it over and the old
+// worker's result is discarded instead of overwriting the new owner's.
+func TestJobs_ExpiredLeaseTakeover(t *testing.T) {
+	_, db := setupTestServer(t)
+	defer closeDB(t, db)
+	db.SetMaxOpenConns(1) // one connection = one in-memory database
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stale := jobs.New(db, jobs.Options{})
+	stale.Register("slow", func(context.Context, json.RawMessage) error {
+		close(started)
+		<-release
+		return nil
+	})
+	var takeovers int
+	fresh := jobs.New(db, jobs.Options{})
+	fresh.Register("slow", func(context.Context, json.RawMessage) error {
+		takeovers++
+		return errors.New("boom")
+	})
+
+	id, err := stale.Enqueue(ctx, "slow", nil)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	type result struct {
+		worked bool
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		worked, err := stale.RunOnce(ctx)
+		done <- result{worked, err}
+	}()
+	<-started
+
+	// The stale worker stopped renewing (e.g. the process was paused): its lease expires.
+	if _, err := db.Exec(`UPDATE jobs SET locked_until = $1 WHERE id = $2`, time.Now().Add(-time.Minute).UTC(), id); err != nil {
+		t.Fatalf("expire lease: %v", err)
+	}
+	if worked, err := fresh.RunOnce(ctx); err != nil || !worked {
+		t.Fatalf("expected the expired job to be taken over, worked=%v err=%v", worked, err)
+	}
+	if takeovers != 1 {
+		t.Fatalf("expected the new owner to run the job once, got %d", takeovers)
+	}
+
+	close(release)
+	res := <-done
+	if !res.worked || !errors.Is(res.err, jobs.ErrLeaseLost) {
+		t.Fatalf("expected ErrLeaseLost for the stale worker, got worked=%v err=%v", res.worked, res.err)
+	}
+
+	// The new owner's failed attempt stands; the stale "done" did not overwrite it.
+	var status, lastError string
+	var attempts int
+	if err := db.QueryRow(`SELECT status, attempts, COALESCE(last_error, '') FROM jobs WHERE id = $1`, id).Scan(&status, &attempts, &lastError); err != nil {
+		t.Fatalf("load job: %v", err)
+	}
+	if status != jobs.StatusQueued || attempts != 2 || lastError != "boom" {
+		t.Fatalf("unexpected job after takeover: status=%s attempts=%d last_error=%q", status, attempts, lastError)
+	}
+}
+
+// A running job renews its lease, so it may run longer than Lease without being taken over.
+func TestJobs_HeartbeatRenewsLease(t *testing.T) {
+	_, db := setupTestServer(t)
+	defer closeDB(t, db)
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+
+	const lease = 60 * time.Millisecond
+	started := make(chan struct{})
+	release := make(chan struct{})
+	owner := jobs.New(db, jobs.Options{Lease: lease})
+	owner.Register("slow", func(context.Context, json.RawMessage) error {
+		close(started)
+		<-release
+		return nil
+	})
+	other := jobs.New(db, jobs.Options{Lease: lease})
+	other.Register("slow", func(context.Context, json.RawMessage) error {
+		t.Error("job was taken over while its owner was still running it")
+		return nil
+	})
+
+	id, err := owner.Enqueue(ctx, "slow", nil)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := owner.RunOnce(ctx)
+		done <- err
+	}()
+	<-started
+
+	time.Sleep(3 * lease)
+	if worked, err := other.RunOnce(ctx); err != nil || worked {
+		t.Fatalf("expected the renewed lease to hold, worked=%v err=%v", worked, err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("owner RunOnce: %v", err)
+	}
+
+	var status string
+	if err := db.QueryRow(`SELECT status FROM jobs WHERE id = $1`, id).Scan(&status); err != nil {
+		t.Fatalf("load job: %v", err)
+	}
+	if status != jobs.StatusDone {
+		t.Fatalf("expected the job to be done, got %s", status)
+	}
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// JSON bodies are decoded strictly: unknown fields, wrong types, trailing data and oversized
+// bodies are rejected with a message (and field) saying what is wrong.
+func TestJSONBody_StrictDecoding(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	cookies := registerAndLogin(t, router, "jonas", "secret123")
+
+	cases := []struct {
+		name, path, body string
+		status           int
+		error, field     string
+	}{
+		{"unknown field", "/api/search/batch", `{"queries":["go"],"lmit":5}`,
+			http.StatusBadRequest, `unknown field "lmit"`, "lmit"},
+		{"wrong type", "/api/search/batch", `{"queries":["go"],"limit":"5"}`,
+			http.StatusBadRequest, `field "limit": want integer, got string`, "limit"},
+		{"wrong element type", "/api/search/batch", `{"queries":[1]}`,
+			http.StatusBadRequest, `field "queries.0": want string, got number`, "queries.0"},
+		{"syntax error", "/api/search/batch", `{"queries":["go"],}`,
+			http.StatusBadRequest, "invalid JSON body: syntax error at byte 19", ""},
+		{"truncated", "/api/search/batch", `{"queries":["go"`,
+			http.StatusBadRequest, "invalid JSON body: unexpected end of input", ""},
+		{"trailing data", "/api/search/batch", `{"queries":["go"]} {"queries":["docker"]}`,
+			http.StatusBadRequest, "invalid JSON body: unexpected data after the JSON value", ""},
+		{"empty", "/api/search/batch", "",
+			http.StatusBadRequest, "request body is empty", ""},
+		{"too large", "/api/search/batch", `{"queries":["` + strings.Repeat("a", 17<<10) + `"]}`,
+			http.StatusRequestEntityTooLarge, "request body too large (max 16384 bytes)", ""},
+		{"other endpoint", "/api/me/bookmarks", `{"title":"Go","url":"https://go.dev","tags":["x"]}`,
+			http.StatusBadRequest, `unknown field "tags"`, "tags"},
+	}
+	for _, c := range cases {
+		rr := bookmarkRequest(router, http.MethodPost, c.path, c.body, cookies)
+		var resp h.APIErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v (%s)", c.name, err, rr.Body.String())
+		}
+		if rr.Code != c.status || resp.Error != c.error || resp.Field != c.field {
+			t.Errorf("%s: got %d %+v, want %d %q (field %q)", c.name, rr.Code, resp, c.status, c.error, c.field)
+		}
+	}
+
+	// Trailing whitespace is fine.
+	if rr := bookmarkRequest(router, http.MethodPost, "/api/search/batch", `{"queries":["go"]}`+"\n", cookies); rr.Code != http.StatusOK {
+		t.Fatalf("valid body: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
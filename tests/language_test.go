@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"devops-valgfag/internal/i18n"
+)
+
+func TestI18nNegotiate_Order(t *testing.T) {
+	stored := func(lang string) func() string { return func() string { return lang } }
+	cases := []struct {
+		name   string
+		target string
+		cookie string
+		stored func() string
+		accept string
+		want   string
+	}{
+		{"query wins", "/?language=da", "en", stored("en"), "en", "da"},
+		{"unsupported query ignored", "/?language=fr", "", nil, "da", "da"},
+		{"cookie before preference", "/", "en", stored("da"), "da", "en"},
+		{"preference before Accept-Language", "/", "", stored("da"), "en", "da"},
+		{"no preference uses Accept-Language", "/", "", stored(""), "fr;q=1, da;q=0.8, en;q=0.5", "da"},
+		{"quality values", "/", "", nil, "en;q=0.3, da;q=0.7", "da"},
+		{"default", "/", "", nil, "de-DE", "en"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: i18n.CookieName, Value: tc.cookie})
+			}
+			req.Header.Set("Accept-Language", tc.accept)
+			if got := i18n.Negotiate(req, tc.stored); got != tc.want {
+				t.Fatalf("Negotiate = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// ?language= picks the language of the whole page, not only of the search.
+func TestLanguage_QueryParamSetsUI(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	req := httptest.NewRequest(http.MethodGet, "/about?language=da", nil)
+	req.Header.Set("Accept-Language", "en")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), `<html lang="da"`) {
+		t.Fatalf("expected Danish page for ?language=da")
+	}
+}
+
+// Changing only the theme does not pin the language: Accept-Language still decides until the
+// user picks a language in their preferences.
+func TestLanguage_StoredPreferenceOnlyWhenChosen(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "sprog", "secret")
+	put := func(body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/api/me/preferences", strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("PUT preferences %s: %d %s", body, rr.Code, rr.Body.String())
+		}
+	}
+	lang := func() string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/about", nil)
+		req.Header.Set("Accept-Language", "da-DK,da;q=0.9")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		body := rr.Body.String()
+		start := strings.Index(body, `<html lang="`)
+		if start < 0 {
+			t.Fatalf("no <html lang> in page")
+		}
+		return body[start+len(`<html lang="`) : start+len(`<html lang="`)+2]
+	}
+
+	put(`{"theme":"dark"}`)
+	if got := lang(); got != "da" {
+		t.Fatalf("theme only: expected Accept-Language da, got %s", got)
+	}
+
+	put(`{"language":"en"}`)
+	if got := lang(); got != "en" {
+		t.Fatalf("chosen language: expected en over Accept-Language, got %s", got)
+	}
+}
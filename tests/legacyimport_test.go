@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"devops-valgfag/internal/legacyhash"
+	"devops-valgfag/internal/legacyimport"
+)
+
+// legacySchema is the legacy Python app's schema (src/database/schema.sql) plus the
+// external_results cache of its later versions.
+const legacySchema = `
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username TEXT NOT NULL UNIQUE,
+  email TEXT NOT NULL UNIQUE,
+  password TEXT NOT NULL
+);
+CREATE TABLE pages (
+  title TEXT PRIMARY KEY UNIQUE,
+  url TEXT NOT NULL UNIQUE,
+  language TEXT NOT NULL CHECK(language IN ('en', 'da')) DEFAULT 'en',
+  last_updated TIMESTAMP,
+  content TEXT NOT NULL
+);
+CREATE TABLE external_results (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  query TEXT NOT NULL,
+  language TEXT NOT NULL,
+  title TEXT NOT NULL,
+  url TEXT NOT NULL,
+  snippet TEXT
+);`
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// legacyDB writes a legacy whoknows.db with a few rows, including one invalid page.
+func legacyDB(t *testing.T) *sql.DB {
+	t.Helper()
+	src, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "whoknows.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeDB(t, src) })
+
+	stmts := []string{
+		legacySchema,
+		`INSERT INTO users (username, email, password) VALUES ('admin', 'keamonk1@stud.kea.dk', '` + md5Hex("password") + `')`,
+		`INSERT INTO users (username, email, password) VALUES ('olduser', 'old@example.com', '` + md5Hex("hunter2") + `')`,
+		`INSERT INTO users (username, email, password) VALUES ('broken', 'broken@example.com', 'not-a-digest')`,
+		`INSERT INTO pages VALUES ('Legacy page', 'https://example.com/legacy', 'en', '2009-02-13 23:31:30', 'Imported from the old app')`,
+		`INSERT INTO pages VALUES ('Gammel side', 'https://example.com/gammel', 'da', NULL, 'Fra den gamle app')`,
+		`INSERT INTO pages VALUES ('Bad date', 'https://example.com/bad', 'en', 'yesterday', 'x')`,
+		`INSERT INTO external_results (query, language, title, url, snippet) VALUES ('go', 'en', 'Go', 'https://en.wikipedia.org/wiki/Go', 'A language')`,
+	}
+	for _, s := range stmts {
+		if _, err := src.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src
+}
+
+func TestLegacyImport_CopiesAndRerunsSkip(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	src := legacyDB(t)
+
+	var progress int
+	reports, err := legacyimport.Run(context.Background(), src, db, legacyimport.Options{
+		BatchSize: 1,
+		Progress:  func(string, int, int) { progress++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []legacyimport.TableReport{
+		{Table: "users", Read: 3, Inserted: 3},
+		{Table: "pages", Read: 3, Inserted: 2, Invalid: 1},
+		{Table: "external_results", Read: 1, Inserted: 1},
+	}
+	for i, w := range want {
+		if reports[i] != w {
+			t.Fatalf("report %d = %+v, want %+v", i, reports[i], w)
+		}
+	}
+	if progress != 7 {
+		t.Fatalf("expected a progress report per row, got %d", progress)
+	}
+
+	var stored string
+	if err := db.QueryRow(`SELECT password FROM users WHERE username = 'olduser'`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !legacyhash.IsWrapped(stored) || strings.Contains(stored, md5Hex("hunter2")) {
+		t.Fatalf("legacy hash not wrapped: %q", stored)
+	}
+
+	// The user logs in with the old password, which upgrades the hash to plain bcrypt.
+	if code := loginStatus(router, "olduser", "hunter2"); code != http.StatusFound {
+		t.Fatalf("legacy login: expected 302, got %d", code)
+	}
+	if err := db.QueryRow(`SELECT password FROM users WHERE username = 'olduser'`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if legacyhash.IsWrapped(stored) {
+		t.Fatal("expected the legacy hash to be replaced after login")
+	}
+	if code := loginStatus(router, "olduser", "hunter2"); code != http.StatusFound {
+		t.Fatalf("login after upgrade: expected 302, got %d", code)
+	}
+	if code := loginStatus(router, "broken", "not-a-digest"); code == http.StatusFound {
+		t.Fatal("an account without a usable legacy hash must not log in")
+	}
+
+	reports, err = legacyimport.Run(context.Background(), src, db, legacyimport.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reports[0].Skipped != 3 || reports[1].Skipped != 2 || reports[2].Skipped != 1 {
+		t.Fatalf("re-run should skip every row, got %+v", reports)
+	}
+}
+
+func TestLegacyImport_DryRunAndResetMode(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	src := legacyDB(t)
+
+	var before int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pages`).Scan(&before); err != nil {
+		t.Fatal(err)
+	}
+	reports, err := legacyimport.Run(context.Background(), src, db, legacyimport.Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reports[1].Inserted != 2 {
+		t.Fatalf("dry run should report the pages it would insert, got %+v", reports[1])
+	}
+	var after int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pages`).Scan(&after); err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Fatalf("dry run wrote %d pages", after-before)
+	}
+	if _, err := legacyimport.Run(context.Background(), src, nil, legacyimport.Options{DryRun: true}); err != nil {
+		t.Fatalf("dry run without a target: %v", err)
+	}
+
+	if _, err := legacyimport.Run(context.Background(), src, db, legacyimport.Options{Passwords: legacyimport.PasswordsReset}); err != nil {
+		t.Fatal(err)
+	}
+	if code := loginStatus(router, "olduser", "hunter2"); code != http.StatusForbidden {
+		t.Fatalf("reset mode: expected 403 (password reset required), got %d", code)
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/lock"
+	"devops-valgfag/internal/scheduler"
+
+	"modernc.org/sqlite"
+)
+
+// SQLite stand-ins for the Postgres advisory lock functions (process-wide, not per session).
+var fakeAdvisoryLocks = struct {
+	sync.Mutex
+	held map[int64]bool
+}{held: map[int64]bool{}}
+
+func init() {
+	sqlite.MustRegisterScalarFunction("pg_try_advisory_lock", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		fakeAdvisoryLocks.Lock()
+		defer fakeAdvisoryLocks.Unlock()
+		key := args[0].(int64)
+		if fakeAdvisoryLocks.held[key] {
+			return int64(0), nil
+		}
+		fakeAdvisoryLocks.held[key] = true
+		return int64(1), nil
+	})
+	sqlite.MustRegisterScalarFunction("pg_advisory_unlock", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		fakeAdvisoryLocks.Lock()
+		defer fakeAdvisoryLocks.Unlock()
+		key := args[0].(int64)
+		was := fakeAdvisoryLocks.held[key]
+		delete(fakeAdvisoryLocks.held, key)
+		if was {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	})
+}
+
+func openLockDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLock_TryWithLockAndWait(t *testing.T) {
+	db := openLockDB(t)
+	defer closeDB(t, db)
+	ctx := context.Background()
+	key := lock.Key("test:try")
+
+	held, err := lock.TryAcquire(ctx, db, key)
+	if err != nil {
+		t.Fatalf("TryAcquire: %v", err)
+	}
+
+	ran := false
+	err = lock.TryWithLock(ctx, db, key, func(context.Context) error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, lock.ErrNotAcquired) || ran {
+		t.Fatalf("expected ErrNotAcquired without running fn, got err=%v ran=%v", err, ran)
+	}
+
+	// A short deadline gives up while the lock is still held.
+	shortCtx, cancel := context.WithTimeout(ctx, 150*time.Millisecond)
+	defer cancel()
+	if err := lock.WithLock(shortCtx, db, key, func(context.Context) error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// WithLock waits until the holder releases.
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		_ = held.Release()
+	}()
+	start := time.Now()
+	fnErr := errors.New("fn result")
+	err = lock.WithLock(ctx, db, key, func(context.Context) error {
+		ran = true
+		return fnErr
+	})
+	if !errors.Is(err, fnErr) || !ran {
+		t.Fatalf("expected fn to run and its error to be returned, got err=%v ran=%v", err, ran)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("expected WithLock to wait for the holder")
+	}
+
+	// Released by WithLock (and Release is idempotent).
+	if err := held.Release(); err != nil {
+		t.Fatalf("second Release: %v", err)
+	}
+	if err := lock.TryWithLock(ctx, db, key, func(context.Context) error { return nil }); err != nil {
+		t.Fatalf("expected lock to be free again, got %v", err)
+	}
+}
+
+// Only one elector leads; leadership moves when the leader steps down.
+func TestLock_SchedulerLeaderElection(t *testing.T) {
+	db := openLockDB(t)
+	defer closeDB(t, db)
+	ctx := context.Background()
+	key := lock.Key("test:leader")
+
+	a := scheduler.NewAdvisoryLockElector(db, key)
+	b := scheduler.NewAdvisoryLockElector(db, key)
+	defer b.Close()
+
+	if !a.IsLeader(ctx) || !a.IsLeader(ctx) {
+		t.Fatal("expected first elector to become and stay leader")
+	}
+	if b.IsLeader(ctx) {
+		t.Fatal("expected second elector not to lead while the first holds the lock")
+	}
+
+	a.Close()
+	if !b.IsLeader(ctx) {
+		t.Fatal("expected second elector to take over")
+	}
+}
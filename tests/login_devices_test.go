@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/jobs"
+)
+
+// The first device of an account is recorded silently; a login from another one is emailed
+// and audit-logged unless login_alerts is off. Another address in the same /24 is the same device.
+func TestLoginDevices_NewDeviceAlert(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetJobQueue(jobs.New(db, jobs.Options{}))
+	defer h.SetJobQueue(nil)
+
+	const laptop = "Mozilla/5.0 (X11; Linux x86_64) Firefox/131.0"
+	const phone = "Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X) Safari/604.1"
+	cookies := registerAndLogin(t, router, "kim", "secret123") // no User-Agent, 192.0.2.1
+
+	login := func(ua, remoteAddr string) {
+		t.Helper()
+		form := url.Values{"username": {"kim"}, "password": {"secret123"}}
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", ua)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusFound {
+			t.Fatalf("login: expected 302, got %d", rr.Code)
+		}
+	}
+	mails := func() []h.SendEmailPayload {
+		t.Helper()
+		rows, err := db.Query(`SELECT payload FROM jobs WHERE type = $1 ORDER BY id`, h.JobSendEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = rows.Close() }()
+		var out []h.SendEmailPayload
+		for rows.Next() {
+			var raw string
+			var m h.SendEmailPayload
+			if err := rows.Scan(&raw); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(raw), &m); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, m)
+		}
+		return out
+	}
+
+	if got := mails(); len(got) != 0 {
+		t.Fatalf("the first device must not be emailed, got %+v", got)
+	}
+
+	login(laptop, "198.51.100.7:4000")
+	login(laptop, "198.51.100.42:4000") // same device, same network
+	got := mails()
+	if len(got) != 1 || got[0].To != "kim@example.com" || !strings.Contains(got[0].Body, "Firefox/131.0") ||
+		!strings.Contains(got[0].Body, "198.51.100.0/24") || strings.Contains(got[0].Body, "198.51.100.7") {
+		t.Fatalf("expected one alert for the new device, got %+v", got)
+	}
+	var audited int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = 'user.login_new_device'`).Scan(&audited); err != nil || audited != 1 {
+		t.Fatalf("expected 1 audit entry, got %d (%v)", audited, err)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/me/preferences", strings.NewReader(`{"login_alerts":false}`))
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"login_alerts":false`) {
+		t.Fatalf("disable login alerts: got %d %s", rr.Code, rr.Body.String())
+	}
+
+	login(phone, "203.0.113.9:4000")
+	if got := mails(); len(got) != 1 {
+		t.Fatalf("expected no email with login_alerts off, got %d", len(got))
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = 'user.login_new_device'`).Scan(&audited); err != nil || audited != 2 {
+		t.Fatalf("the new device must still be audit-logged, got %d (%v)", audited, err)
+	}
+	var devices int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM user_devices`).Scan(&devices); err != nil || devices != 3 {
+		t.Fatalf("expected 3 devices, got %d (%v)", devices, err)
+	}
+}
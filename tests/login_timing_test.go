@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/service"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// An unknown username costs a bcrypt comparison just like a wrong password, so the two can't
+// be told apart by response time.
+func TestLoginTiming_UnknownUserRunsBcrypt(t *testing.T) {
+	store := &memUserStore{users: map[string]service.User{}}
+	var compared []string
+	auth := &service.AuthService{
+		Users: store,
+		ComparePassword: func(stored, password string) bool {
+			compared = append(compared, stored)
+			return service.CheckPassword(stored, password)
+		},
+	}
+	ctx := context.Background()
+	if err := auth.Register(ctx, service.Registration{
+		Username: "ada", Email: "ada@example.com", Password: "secret123", Password2: "secret123", Status: service.UserStatusActive,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, username := range []string{"nobody", "ada"} {
+		compared = nil
+		if _, err := auth.Login(ctx, username, "wrong-password"); !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Fatalf("%s: expected invalid credentials, got %v", username, err)
+		}
+		if len(compared) != 1 {
+			t.Fatalf("%s: expected one bcrypt comparison, got %d", username, len(compared))
+		}
+		if _, err := bcrypt.Cost([]byte(compared[0])); err != nil {
+			t.Fatalf("%s: compared against %q, not a bcrypt hash: %v", username, compared[0], err)
+		}
+	}
+	if compared[0] != store.users["ada"].PasswordHash {
+		t.Fatal("a wrong password must be compared against the user's own hash")
+	}
+}
+
+// Failed logins wait a jittered FailureDelay (LOGIN_FAILURE_DELAY); successful ones don't.
+func TestLoginTiming_FailureDelay(t *testing.T) {
+	store := &memUserStore{users: map[string]service.User{}}
+	var slept []time.Duration
+	const delay = 300 * time.Millisecond
+	auth := &service.AuthService{
+		Users:        store,
+		FailureDelay: delay,
+		Sleep:        func(_ context.Context, d time.Duration) { slept = append(slept, d) },
+	}
+	ctx := context.Background()
+	if err := auth.Register(ctx, service.Registration{
+		Username: "ada", Email: "ada@example.com", Password: "secret123", Password2: "secret123", Status: service.UserStatusActive,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 5 {
+		for _, username := range []string{"ada", "nobody"} {
+			if _, err := auth.Login(ctx, username, "wrong-password"); !errors.Is(err, service.ErrInvalidCredentials) {
+				t.Fatalf("%s: expected invalid credentials, got %v", username, err)
+			}
+		}
+	}
+	if len(slept) != 10 {
+		t.Fatalf("expected a delay for each of the 10 failures, got %v", slept)
+	}
+	seen := map[time.Duration]bool{}
+	for _, d := range slept {
+		if d < delay || d >= 2*delay {
+			t.Fatalf("delay %v outside [%v, %v)", d, delay, 2*delay)
+		}
+		seen[d] = true
+	}
+	if len(seen) == 1 {
+		t.Fatal("expected the delay to vary between failures")
+	}
+
+	slept = nil
+	if _, err := auth.Login(ctx, "ada", "secret123"); err != nil {
+		t.Fatal(err)
+	}
+	if len(slept) != 0 {
+		t.Fatalf("a successful login must not be delayed, got %v", slept)
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/jobs"
+)
+
+// Maintenance operations are queued as jobs, one at a time, and report their progress; a
+// rebuild restores a full-text index that lost its entries.
+func TestMaintenance_QueueRunAndProgress(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	ctx := context.Background()
+	seedFTSPages(t, db)
+
+	cookies := registerAndLogin(t, router, "maintadmin", "secret123")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'maintadmin'`); err != nil {
+		t.Fatal(err)
+	}
+	admin := adminClient(router, cookies)
+
+	if rr := admin(http.MethodPost, "/admin/maintenance/analyze", ""); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without a job queue: expected 503, got %d", rr.Code)
+	}
+	q := jobs.New(db, jobs.Options{})
+	h.RegisterJobs(q)
+	h.SetJobQueue(q)
+	defer h.SetJobQueue(nil)
+
+	listRuns := func() []h.MaintenanceRun {
+		t.Helper()
+		rr := admin(http.MethodGet, "/admin/maintenance", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("list: expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp h.MaintenanceRunsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Runs
+	}
+	start := func(operation string) h.MaintenanceRun {
+		t.Helper()
+		rr := admin(http.MethodPost, "/admin/maintenance/"+operation, "")
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("start %s: expected 202, got %d: %s", operation, rr.Code, rr.Body.String())
+		}
+		var run h.MaintenanceRun
+		if err := json.Unmarshal(rr.Body.Bytes(), &run); err != nil {
+			t.Fatal(err)
+		}
+		return run
+	}
+	runJob := func() {
+		t.Helper()
+		if worked, err := q.RunOnce(ctx); err != nil || !worked {
+			t.Fatalf("expected a maintenance job to run, got worked=%v err=%v", worked, err)
+		}
+	}
+
+	if runs := listRuns(); len(runs) != 0 {
+		t.Fatalf("expected no runs yet, got %+v", runs)
+	}
+	if rr := admin(http.MethodPost, "/admin/maintenance/vacuum_everything", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown operation: expected 404, got %d", rr.Code)
+	}
+
+	// Empty the FTS index behind the triggers' back: search no longer finds the pages.
+	if _, err := db.Exec(`INSERT INTO pages_fts (pages_fts) VALUES ('delete-all')`); err != nil {
+		t.Fatal(err)
+	}
+	searchCookies := registerAndLogin(t, router, "maintsearch", "secret123")
+	if got := searchAPI(t, router, searchCookies, "q=zymurgy&language=en"); len(got) != 0 {
+		t.Fatalf("expected an empty index, got %v", resultURLs(got))
+	}
+
+	run := start(h.MaintenanceRebuildFTS)
+	if run.Status != "queued" || run.Operation != h.MaintenanceRebuildFTS {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+	if rr := admin(http.MethodPost, "/admin/maintenance/"+h.MaintenanceAnalyze, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("second operation while one is queued: expected 409, got %d", rr.Code)
+	}
+	runJob()
+
+	var pages int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pages`).Scan(&pages); err != nil {
+		t.Fatal(err)
+	}
+	runs := listRuns()
+	if len(runs) != 1 || runs[0].Status != "done" || runs[0].Done != pages || runs[0].Total != pages ||
+		runs[0].StartedAt == nil || runs[0].FinishedAt == nil {
+		t.Fatalf("unexpected runs after rebuild: %+v", runs)
+	}
+	if got := searchAPI(t, router, searchCookies, "q=zymurgy&language=en"); len(got) != 2 {
+		t.Fatalf("expected the rebuilt index to find both pages, got %v", resultURLs(got))
+	}
+
+	for _, operation := range []string{h.MaintenanceReindexFTS, h.MaintenanceAnalyze} {
+		run := start(operation)
+		runJob()
+		if runs := listRuns(); runs[0].ID != run.ID || runs[0].Status != "done" || runs[0].Done != runs[0].Total {
+			t.Fatalf("%s: unexpected run %+v", operation, runs[0])
+		}
+	}
+	if runs := listRuns(); len(runs) != 3 {
+		t.Fatalf("expected three runs, got %+v", runs)
+	}
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Percentiles interpolate inside the bucket the rank falls into, like histogram_quantile.
+func TestMetrics_Quantile(t *testing.T) {
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Buckets: []float64{1, 2, 4}})
+	for _, v := range []float64{0.5, 0.5, 1.5, 1.5} {
+		hist.Observe(v)
+	}
+	read := func() *dto.Histogram {
+		var m dto.Metric
+		if err := hist.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram()
+	}
+
+	if got := metrics.Quantile(0.5, nil); got != 0 {
+		t.Fatalf("empty histogram: expected 0, got %v", got)
+	}
+	for _, tc := range []struct{ q, want float64 }{{0.5, 1}, {0.75, 1.5}, {0.25, 0.5}} {
+		if got := metrics.Quantile(tc.q, read()); got != tc.want {
+			t.Fatalf("q=%v: expected %v, got %v", tc.q, tc.want, got)
+		}
+	}
+	hist.Observe(10) // above the largest bucket
+	if got := metrics.Quantile(0.99, read()); got != 4 {
+		t.Fatalf("expected the largest bucket bound, got %v", got)
+	}
+}
+
+// The summary needs an admin session or the bearer token, and reflects the counters.
+func TestMetrics_SummaryEndpoint(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetMetricsSummaryToken("dash-token")
+	defer h.SetMetricsSummaryToken("")
+
+	get := func(cookies []*http.Cookie, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/metrics/summary", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	summary := func() h.MetricsSummaryResponse {
+		t.Helper()
+		rr := get(nil, "Bearer dash-token")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("with token: expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp h.MetricsSummaryResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if rr := get(nil, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: expected 401, got %d", rr.Code)
+	}
+	if rr := get(nil, "Bearer wrong"); rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("wrong token: expected 401 with a challenge, got %d", rr.Code)
+	}
+	cookies := registerAndLogin(t, router, "metricsuser", "secret123")
+	if rr := get(cookies, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: expected 403, got %d", rr.Code)
+	}
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'metricsuser'`); err != nil {
+		t.Fatal(err)
+	}
+	if rr := get(cookies, ""); rr.Code != http.StatusOK {
+		t.Fatalf("admin: expected 200, got %d", rr.Code)
+	}
+
+	before := summary()
+	metrics.SearchTotal.Add(4)
+	metrics.SearchWithResult.Add(3)
+	metrics.HTTPRequestsTotal.WithLabelValues("/test", "503").Inc()
+	after := summary()
+
+	if after.Search.Total-before.Search.Total != 4 || after.Search.WithResults-before.Search.WithResults != 3 {
+		t.Fatalf("unexpected search counters: before %+v, after %+v", before.Search, after.Search)
+	}
+	if after.Search.HitRate <= 0 || after.Search.HitRate > 1 {
+		t.Fatalf("hit rate out of range: %v", after.Search.HitRate)
+	}
+	if after.Requests.ByClass["5xx"] <= before.Requests.ByClass["5xx"] || after.Requests.ErrorRate <= 0 {
+		t.Fatalf("expected the 503 to count as an error: %+v", after.Requests)
+	}
+	if after.Requests.Total < after.Requests.ByClass["2xx"]+after.Requests.ByClass["5xx"] {
+		t.Fatalf("total below its classes: %+v", after.Requests)
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/migrate"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// A migration run exports the applied and pending files, the last version and failures.
+func TestMigrate_Metrics(t *testing.T) {
+	db, err := dialect.OpenSQLite(filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDB(t, db)
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("0001_a.sql", "CREATE TABLE a (id INTEGER PRIMARY KEY);")
+	write("0002_b.sql", "CREATE TABLE b (id INTEGER PRIMARY KEY);")
+	write("0003_broken.sql", "CREATE TABLE nope (;")
+
+	expect := func(applied, pending, last float64) {
+		t.Helper()
+		if got := testutil.ToFloat64(metrics.MigrationsApplied); got != applied {
+			t.Fatalf("applied = %v, want %v", got, applied)
+		}
+		if got := testutil.ToFloat64(metrics.MigrationsPending); got != pending {
+			t.Fatalf("pending = %v, want %v", got, pending)
+		}
+		if got := testutil.ToFloat64(metrics.MigrationLastVersion); got != last {
+			t.Fatalf("last version = %v, want %v", got, last)
+		}
+	}
+
+	report, err := migrate.Status(db, dir)
+	if err != nil || report.Pending != 3 || report.LastVersion != "" {
+		t.Fatalf("status before: %+v, %v", report, err)
+	}
+	expect(0, 3, 0)
+
+	failures := testutil.ToFloat64(metrics.MigrationFailures)
+	if err := migrate.RunSQLiteMigrationsFrom(db, dir); err == nil {
+		t.Fatal("expected the broken migration to fail")
+	}
+	if got := testutil.ToFloat64(metrics.MigrationFailures) - failures; got != 1 {
+		t.Fatalf("expected 1 failure, got %v", got)
+	}
+	expect(2, 1, 2)
+
+	write("0003_broken.sql", "CREATE TABLE fixed (id INTEGER PRIMARY KEY);")
+	if err := migrate.RunSQLiteMigrationsFrom(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	expect(3, 0, 3)
+	if testutil.ToFloat64(metrics.MigrationDuration) <= 0 {
+		t.Fatal("expected the run duration to be set")
+	}
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/migrate"
+)
+
+// A -- migrate:no-transaction file runs statement by statement without a transaction: a failure
+// keeps the earlier statements, is recorded in schema_migration_failures, and the file runs
+// again on the next start.
+func TestMigrate_NoTransactionDirective(t *testing.T) {
+	dir := t.TempDir()
+	db, err := dialect.OpenSQLite(filepath.Join(dir, "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDB(t, db)
+
+	t.Chdir(dir)
+	if err := os.MkdirAll(filepath.Join("migrations", "sqlite"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, sql string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join("migrations", "sqlite", name), []byte(sql), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("0001_items.sql", "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT);")
+	write("0002_backfill.sql", "-- 0002_backfill.sql\n-- migrate:no-transaction\n\nINSERT INTO items (name) VALUES ('kept');\nINSERT INTO missing_table VALUES (1);")
+
+	if err := migrate.RunSQLiteMigrations(db); err == nil {
+		t.Fatal("expected the second migration to fail")
+	}
+	var kept, applied, attempts int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&kept); err != nil || kept != 1 {
+		t.Fatalf("statements before the failure must stay applied: %d rows (%v)", kept, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = '0002_backfill'`).Scan(&applied); err != nil || applied != 0 {
+		t.Fatalf("a failed migration must not be recorded as applied: %d (%v)", applied, err)
+	}
+	if err := db.QueryRow(`SELECT attempts FROM schema_migration_failures WHERE version = '0002_backfill'`).Scan(&attempts); err != nil || attempts != 1 {
+		t.Fatalf("expected one recorded failure, got %d (%v)", attempts, err)
+	}
+
+	// Fixed and written to be rerunnable, the file applies and its failure record goes away.
+	write("0002_backfill.sql", "-- migrate:no-transaction\nINSERT INTO items (name) SELECT 'kept' WHERE NOT EXISTS (SELECT 1 FROM items);")
+	if err := migrate.RunSQLiteMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	var failures int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migration_failures`).Scan(&failures); err != nil || failures != 0 {
+		t.Fatalf("expected the failure record to be cleared, got %d (%v)", failures, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = '0002_backfill'`).Scan(&applied); err != nil || applied != 1 {
+		t.Fatalf("expected the migration to be recorded: %d (%v)", applied, err)
+	}
+}
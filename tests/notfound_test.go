@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Unknown paths and wrong methods get branded pages (JSON under /api/) with the request ID,
+// and 404s are counted by path prefix.
+func TestNotFound_PagesAndMetrics(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	anon := adminClient(router, nil)
+
+	countOf := func(prefix string) float64 {
+		return testutil.ToFloat64(metrics.NotFound.WithLabelValues(prefix))
+	}
+	apiBefore, otherBefore := countOf("/api"), countOf("other")
+
+	rr := anon(http.MethodGet, "/no/such/page", "")
+	if rr.Code != http.StatusNotFound || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected an HTML 404, got %d (%s)", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	id := rr.Header().Get("X-Request-ID")
+	if body := rr.Body.String(); id == "" || !strings.Contains(body, "Page not found") || !strings.Contains(body, id) {
+		t.Fatalf("expected the 404 page with request ID %q, got %s", id, body)
+	}
+
+	rr = anon(http.MethodGet, "/api/nope", "")
+	var apiErr h.APIErrorResponse
+	if rr.Code != http.StatusNotFound || json.Unmarshal(rr.Body.Bytes(), &apiErr) != nil || apiErr.Error != "page not found" {
+		t.Fatalf("expected a JSON 404, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Request-ID") == "" {
+		t.Fatal("expected a request ID on API 404s")
+	}
+	if got := countOf("/api") - apiBefore; got != 1 {
+		t.Fatalf("expected one /api 404, got %v", got)
+	}
+	if got := countOf("other") - otherBefore; got != 1 {
+		t.Fatalf("expected one other 404, got %v", got)
+	}
+
+	rr = anon(http.MethodDelete, "/about", "")
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET, HEAD, OPTIONS" || !strings.Contains(rr.Body.String(), "Method not allowed") {
+		t.Fatalf("expected an HTML 405 with Allow: GET, HEAD, OPTIONS, got %d %q: %s", rr.Code, rr.Header().Get("Allow"), rr.Body.String())
+	}
+	rr = anon(http.MethodGet, "/api/login", "")
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "POST, OPTIONS" || !strings.Contains(rr.Body.String(), `"method not allowed"`) {
+		t.Fatalf("expected a JSON 405 with Allow: POST, OPTIONS, got %d %q: %s", rr.Code, rr.Header().Get("Allow"), rr.Body.String())
+	}
+}
+
+// Paths with a GET route answer HEAD, and OPTIONS lists every method a path accepts.
+func TestMethods_HeadAndOptions(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	anon := adminClient(router, nil)
+
+	rr := anon(http.MethodHead, "/about", "")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected HEAD to answer like GET, got %d (%s)", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	cases := map[string]string{
+		"/api/search":          "GET, HEAD, OPTIONS",
+		"/api/login":           "POST, OPTIONS",
+		"/admin/tags/1":        "PATCH, DELETE, OPTIONS",
+		"/admin/users/7":       "GET, HEAD, PATCH, OPTIONS",
+		"/admin/pages/deleted": "GET, HEAD, OPTIONS",
+	}
+	for path, want := range cases {
+		rr := anon(http.MethodOptions, path, "")
+		if rr.Code != http.StatusNoContent || rr.Header().Get("Allow") != want || rr.Body.Len() != 0 {
+			t.Errorf("OPTIONS %s: got %d Allow %q, want 204 Allow %q", path, rr.Code, rr.Header().Get("Allow"), want)
+		}
+	}
+
+	if rr := anon(http.MethodOptions, "/no/such/page", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("OPTIONS on an unknown path: expected 404, got %d", rr.Code)
+	}
+}
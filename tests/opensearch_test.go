@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// The OpenSearch descriptor must point browsers at absolute search + suggest URLs.
+func TestOpenSearchHandler_Descriptor(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://whoknows.test/opensearch.xml", nil)
+	rec := httptest.NewRecorder()
+
+	h.OpenSearchHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/opensearchdescription+xml") {
+		t.Fatalf("unexpected Content-Type: %s", ct)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"http://whoknows.test/search?q={searchTerms}",
+		"http://whoknows.test/api/suggest?q={searchTerms}",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected descriptor to contain %q, got %s", want, body)
+		}
+	}
+}
+
+// Suggestions are returned as [query, [titles...]] and match on title prefix.
+func TestAPISuggestHandler_PrefixMatch(t *testing.T) {
+	db := setupTestHandlers(t)
+	defer closeDB(t, db)
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES
+		('Golang', '/golang', 'en', 'go'),
+		('Gophers', '/gophers', 'en', 'go'),
+		('Python', '/python', 'en', 'py')`); err != nil {
+		t.Fatalf("failed to insert pages: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/suggest?q=go", nil)
+	rec := httptest.NewRecorder()
+
+	h.APISuggestHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var got []json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 2 {
+		t.Fatalf("expected [query, suggestions], got %s", rec.Body.String())
+	}
+
+	var titles []string
+	if err := json.Unmarshal(got[1], &titles); err != nil {
+		t.Fatalf("failed to decode suggestions: %v", err)
+	}
+	if len(titles) != 2 || titles[0] != "Golang" || titles[1] != "Gophers" {
+		t.Fatalf("unexpected suggestions: %v", titles)
+	}
+}
+
+// % and _ in the prefix match themselves, not any characters.
+func TestAPISuggestHandler_WildcardsMatchLiterally(t *testing.T) {
+	db := setupTestHandlers(t)
+	defer closeDB(t, db)
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES
+		('100% Go', '/100-go', 'en', 'go'),
+		('1000 tips', '/1000-tips', 'en', 'tips'),
+		('snake_case', '/snake-case', 'en', 'naming'),
+		('snakeXcase', '/snakexcase', 'en', 'naming'),
+		('back\slash', '/backslash', 'en', 'path')`); err != nil {
+		t.Fatalf("failed to insert pages: %v", err)
+	}
+
+	for q, want := range map[string]string{
+		"100%":   `["100% Go"]`,
+		"%":      `[]`,
+		"snake_": `["snake_case"]`,
+		"_":      `[]`,
+		`back\`:  `["back\\slash"]`,
+	} {
+		rec := httptest.NewRecorder()
+		h.APISuggestHandler(rec, httptest.NewRequest(http.MethodGet, "/api/suggest?q="+url.QueryEscape(q), nil))
+		var got []json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 2 {
+			t.Fatalf("%q: expected [query, suggestions], got %s", q, rec.Body.String())
+		}
+		if string(got[1]) != want {
+			t.Errorf("%q: suggestions %s, want %s", q, got[1], want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Two editors starting from the same version: the second save is rejected with the current version.
+func TestPageEdit_OptimisticConcurrency(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "editor", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'editor'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+	var id int
+	if err := db.QueryRow(`SELECT id FROM pages WHERE title = 'Welcome'`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/pages/" + strconv.Itoa(id)
+	do := func(method, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodGet, "", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	etag := rr.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+
+	if rr := do(http.MethodPut, "", `{"title":"Welcome","content":"no version"}`); rr.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 without a version, got %d", rr.Code)
+	}
+
+	// First editor saves with If-Match.
+	rr = do(http.MethodPut, etag, `{"title":"Welcome","content":"first edit"}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected 200 with ETag \"2\", got %d %q: %s", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+	var page h.Page
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if page.Version != 2 || page.Content != "first edit" || page.URL != "/welcome" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+
+	// Second editor still holds version 1 (given in the body this time).
+	rr = do(http.MethodPut, "", `{"title":"Welcome","content":"second edit","version":1}`)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var conflict h.APIVersionConflictResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &conflict); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if conflict.CurrentVersion != 2 || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("unexpected conflict response: %+v (ETag %q)", conflict, rr.Header().Get("ETag"))
+	}
+
+	var content string
+	if err := db.QueryRow(`SELECT content FROM pages WHERE id = $1`, id).Scan(&content); err != nil {
+		t.Fatal(err)
+	}
+	if content != "first edit" {
+		t.Fatalf("first edit was overwritten: %q", content)
+	}
+
+	if rr := do(http.MethodPut, `"2"`, `{"title":"Welcome","content":"x","version":1}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when If-Match and version disagree, got %d", rr.Code)
+	}
+	if rr := do(http.MethodPut, `W/"2"`, `{"title":"About Us","content":"x"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a duplicate title, got %d", rr.Code)
+	}
+}
+
+// GET /api/pages/{id} answers 304 while the client's ETag or Last-Modified is current, and the
+// full page again once it was edited.
+func TestPageGet_ConditionalRequests(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	modified := time.Date(2026, 3, 1, 12, 30, 15, 500e6, time.UTC)
+	var id int
+	if err := db.QueryRow(`SELECT id FROM pages WHERE title = 'Welcome'`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE pages SET last_updated = $1 WHERE id = $2`, modified, id); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/pages/" + strconv.Itoa(id)
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	notModified := metrics.ConditionalRequests.WithLabelValues("pages", "not_modified")
+	start := testutil.ToFloat64(notModified)
+
+	rr := get("", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"1"` || rr.Header().Get("Last-Modified") != "Sun, 01 Mar 2026 12:30:15 GMT" {
+		t.Fatalf("expected 200 with validators, got %d %v", rr.Code, rr.Header())
+	}
+	lastModified := rr.Header().Get("Last-Modified")
+
+	for _, c := range []struct{ header, value string }{
+		{"If-None-Match", `"1"`},
+		{"If-None-Match", `W/"0", W/"1"`},
+		{"If-None-Match", "*"},
+		{"If-Modified-Since", lastModified},
+	} {
+		rr := get(c.header, c.value)
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 || rr.Header().Get("ETag") != `"1"` {
+			t.Fatalf("%s: %s: expected an empty 304 with the ETag, got %d", c.header, c.value, rr.Code)
+		}
+	}
+	if got := testutil.ToFloat64(notModified) - start; got != 4 {
+		t.Fatalf("expected 4 not_modified requests counted, got %v", got)
+	}
+
+	for _, c := range []struct{ header, value string }{
+		{"If-None-Match", `"0"`},
+		{"If-Modified-Since", modified.Add(-time.Second).Format(http.TimeFormat)},
+		{"If-Modified-Since", "yesterday"},
+	} {
+		if rr := get(c.header, c.value); rr.Code != http.StatusOK {
+			t.Fatalf("%s: %s: expected 200, got %d", c.header, c.value, rr.Code)
+		}
+	}
+
+	// An edit bumps the version, so the old ETag no longer matches.
+	if _, err := db.Exec(`UPDATE pages SET version = version + 1, last_updated = $1 WHERE id = $2`, modified.Add(time.Hour), id); err != nil {
+		t.Fatal(err)
+	}
+	if rr := get("If-None-Match", `"1"`); rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("after an edit: expected 200 with ETag \"2\", got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+	if rr := get("If-Modified-Since", lastModified); rr.Code != http.StatusOK {
+		t.Fatalf("after an edit: expected 200 for If-Modified-Since, got %d", rr.Code)
+	}
+
+	path = "/api/pages/999999"
+	if rr := get("If-None-Match", "*"); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown page: expected 404, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/migrate"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresDB returns a fresh, migrated PostgreSQL database for the end-to-end tests of the code
+// SQLite cannot cover (tsvector search, f_unaccent, ILIKE, advisory locks, $N placeholders).
+//
+// It uses the server at TEST_DATABASE_URL (the postgres service in CI) or else starts a
+// disposable postgres:16 container with docker. Every call creates its own database, dropped
+// when the test ends. Without either (or with -short) the test is skipped.
+func postgresDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Postgres end-to-end test skipped with -short")
+	}
+	serverURL := os.Getenv("TEST_DATABASE_URL")
+	if serverURL == "" {
+		serverURL = startPostgresContainer(t)
+	}
+
+	admin := openPostgres(t, serverURL)
+	t.Cleanup(func() { _ = admin.Close() })
+	name := "whoknows_e2e_" + randomSuffix(t)
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatalf("create test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)"); err != nil {
+			t.Logf("drop test database %s: %v", name, err)
+		}
+	})
+
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = "/" + name
+	db := openPostgres(t, u.String())
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := migrate.RunMigrationsFrom(db, "../migrations"); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return db
+}
+
+// startPostgresContainer runs postgres:16 on a random local port and returns its URL. The
+// container is removed when the test ends.
+func startPostgresContainer(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("Postgres end-to-end test needs TEST_DATABASE_URL or docker")
+	}
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-e", "POSTGRES_PASSWORD=e2e", "-p", "127.0.0.1::5432", "postgres:16").Output()
+	if err != nil {
+		t.Skipf("Postgres end-to-end test: docker run failed: %v", err)
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() { _ = exec.Command("docker", "rm", "-f", id).Run() })
+
+	out, err = exec.Command("docker", "port", id, "5432/tcp").Output()
+	if err != nil {
+		t.Fatalf("docker port: %v", err)
+	}
+	hostPort, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	serverURL := "postgres://postgres:e2e@" + hostPort + "/postgres?sslmode=disable"
+
+	// The image restarts the server once after initdb; wait until it accepts TCP connections.
+	db := openPostgres(t, serverURL)
+	defer db.Close()
+	deadline := time.Now().Add(60 * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return serverURL
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("postgres container not ready: %v", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func openPostgres(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func randomSuffix(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
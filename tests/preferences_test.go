@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// Anonymous users get their preferences round-tripped through the prefs cookie.
+func TestPreferences_AnonymousCookie(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/me/preferences", strings.NewReader(`{"theme":"dark","results_per_page":20}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/me/preferences", nil)
+	for _, c := range rr.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var got h.Preferences
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got.Theme != "dark" || got.ResultsPerPage != 20 || got.Language != "en" {
+		t.Fatalf("unexpected preferences: %+v", got)
+	}
+}
+
+// Logged-in users' preferences are stored in user_preferences and shown in rendered pages.
+func TestPreferences_LoggedInPersisted(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	cookies := registerAndLogin(t, router, "bob", "secret")
+
+	req := httptest.NewRequest(http.MethodPut, "/api/me/preferences", strings.NewReader(`{"theme":"dark"}`))
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var theme string
+	if err := db.QueryRow(`SELECT theme FROM user_preferences`).Scan(&theme); err != nil || theme != "dark" {
+		t.Fatalf("expected stored theme dark, got %q (err=%v)", theme, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/about", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), `data-theme="dark"`) {
+		t.Fatalf("expected dark theme in rendered page")
+	}
+}
+
+func TestPreferences_InvalidValueRejected(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/me/preferences", strings.NewReader(`{"theme":"neon"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+}
+
+// registerAndLogin creates a user through the real endpoints and returns the session cookies.
+func registerAndLogin(t *testing.T, router http.Handler, username, password string) []*http.Cookie {
+	t.Helper()
+
+	form := url.Values{}
+	form.Set("username", username)
+	form.Set("email", username+"@example.com")
+	form.Set("password", password)
+	form.Set("password2", password)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect after register, got %d", rr.Code)
+	}
+
+	form = url.Values{}
+	form.Set("username", username)
+	form.Set("password", password)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect after login, got %d", rr.Code)
+	}
+	return rr.Result().Cookies()
+}
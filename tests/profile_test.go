@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/storage"
+)
+
+func pngBytes(t *testing.T, w, hgt int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, hgt))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func uploadAvatar(router http.Handler, cookies []*http.Cookie, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("avatar", "avatar.png")
+	_, _ = part.Write(data)
+	_ = mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/me/avatar", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Uploads are validated by content, stored, served back and replaced; without an upload
+// the avatar redirects to Gravatar.
+func TestProfile_AvatarUpload(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	store, err := storage.NewFilesystem(t.TempDir(), []byte("test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetStorage(store)
+	defer h.SetStorage(nil)
+
+	cookies := registerAndLogin(t, router, "frank", "secret")
+	get := adminClient(router, nil)
+
+	rr := get(http.MethodGet, "/u/frank/avatar?s=64", "")
+	if rr.Code != http.StatusFound || !strings.HasPrefix(rr.Header().Get("Location"), "https://www.gravatar.com/avatar/") ||
+		!strings.Contains(rr.Header().Get("Location"), "s=64") {
+		t.Fatalf("expected Gravatar redirect, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if rr := uploadAvatar(router, nil, pngBytes(t, 8, 8)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", rr.Code)
+	}
+	if rr := uploadAvatar(router, cookies, []byte("<svg xmlns='http://www.w3.org/2000/svg'/>")); rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 for a non-image, got %d", rr.Code)
+	}
+	if rr := uploadAvatar(router, cookies, append(pngBytes(t, 8, 8), make([]byte, 1<<20)...)); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for an oversized upload, got %d", rr.Code)
+	}
+	if rr := uploadAvatar(router, cookies, pngBytes(t, 4096, 1)); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for oversized dimensions, got %d", rr.Code)
+	}
+
+	first := pngBytes(t, 8, 8)
+	rr = uploadAvatar(router, cookies, first)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp h.AvatarResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.AvatarURL != "/u/frank/avatar" {
+		t.Fatalf("unexpected response: %s", rr.Body.String())
+	}
+	rr = get(http.MethodGet, "/u/frank/avatar", "")
+	signed := rr.Header().Get("Location")
+	if rr.Code != http.StatusFound || !strings.HasPrefix(signed, storage.FilesURLPrefix+storage.AvatarPrefix) {
+		t.Fatalf("expected redirect to a signed URL, got %d %q", rr.Code, signed)
+	}
+	rr = get(http.MethodGet, signed, "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" || !bytes.Equal(rr.Body.Bytes(), first) {
+		t.Fatalf("unexpected avatar: %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if rr := get(http.MethodGet, strings.Replace(signed, "signature=", "signature=0", 1), ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a tampered signature, got %d", rr.Code)
+	}
+
+	var firstKey string
+	if err := db.QueryRow(`SELECT avatar_key FROM users WHERE username = 'frank'`).Scan(&firstKey); err != nil {
+		t.Fatal(err)
+	}
+	if rr := uploadAvatar(router, cookies, pngBytes(t, 16, 16)); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for replacement, got %d", rr.Code)
+	}
+	if _, err := store.Get(t.Context(), firstKey); err != storage.ErrNotFound {
+		t.Fatalf("replaced avatar should be deleted, got %v", err)
+	}
+
+	if rr := adminClient(router, cookies)(http.MethodDelete, "/api/me/avatar", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if rr := get(http.MethodGet, "/u/frank/avatar", ""); rr.Code != http.StatusFound {
+		t.Fatalf("expected Gravatar after removal, got %d", rr.Code)
+	}
+}
+
+// The profile page lists only public bookmarks and hides inactive accounts.
+func TestProfile_PublicBookmarks(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "grace", "secret")
+	grace := adminClient(router, cookies)
+	anon := adminClient(router, nil)
+
+	rr := grace(http.MethodPost, "/api/me/bookmarks", `{"title":"Public Go","url":"https://go.dev/","public":true}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = grace(http.MethodPost, "/api/me/bookmarks", `{"title":"Secret Rust","url":"https://rust-lang.org/"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rr.Code)
+	}
+	var private h.Bookmark
+	if err := json.Unmarshal(rr.Body.Bytes(), &private); err != nil || private.Public {
+		t.Fatalf("bookmarks must default to private: %s", rr.Body.String())
+	}
+
+	rr = anon(http.MethodGet, "/u/grace", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	page := rr.Body.String()
+	if !strings.Contains(page, "Public Go") || strings.Contains(page, "Secret Rust") || !strings.Contains(page, "/u/grace/avatar") {
+		t.Fatalf("unexpected profile page:\n%s", page)
+	}
+
+	path := "/api/me/bookmarks/" + strconv.FormatInt(private.ID, 10)
+	if rr := anon(http.MethodPatch, path, `{"public":true}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+	rr = grace(http.MethodPatch, path, `{"public":true}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := anon(http.MethodGet, "/u/grace", ""); !strings.Contains(rr.Body.String(), "Secret Rust") {
+		t.Fatal("bookmark made public should be listed")
+	}
+	if rr := grace(http.MethodPatch, "/api/me/bookmarks/99999", `{"public":true}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+
+	if rr := anon(http.MethodGet, "/u/nobody", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown user, got %d", rr.Code)
+	}
+	if _, err := db.Exec(`UPDATE users SET status = 'banned' WHERE username = 'grace'`); err != nil {
+		t.Fatal(err)
+	}
+	if rr := anon(http.MethodGet, "/u/grace", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a banned user, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	dbx "devops-valgfag/internal/db"
+	"devops-valgfag/internal/jobs"
+	"devops-valgfag/internal/scraper"
+)
+
+// Cached external results returned for enough queries are promoted into pages with the full
+// article text, in the wiki's language; admins can also promote a single cached result.
+func TestPromoteExternal_FrequentResultsBecomePages(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	ctx := context.Background()
+
+	wiki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("prop") != "extracts" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("pageids") {
+		case "42":
+			_, _ = w.Write([]byte(`{"query":{"pages":{"42":{"pageid":42,"title":"Gopher","extract":"Gophers are burrowing rodents.\n\nThey live in North America."}}}}`))
+		case "7":
+			_, _ = w.Write([]byte(`{"query":{"pages":{"7":{"pageid":7,"title":"Rodent","extract":"Rodents are mammals."}}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"query":{"pages":{"-1":{"missing":""}}}}`))
+		}
+	}))
+	defer wiki.Close()
+	scraper.SetWikipediaAPI(wiki.URL)
+	defer scraper.SetWikipediaAPI("")
+
+	q := jobs.New(db, jobs.Options{})
+	h.RegisterJobs(q)
+	h.SetJobQueue(q)
+	defer h.SetJobQueue(nil)
+
+	gopher := dbx.ExternalResult{Title: "Gopher", URL: "https://en.wikipedia.org/?curid=42", Snippet: "burrowing rodents"}
+	rodent := dbx.ExternalResult{Title: "Rodent", URL: "https://en.wikipedia.org/?curid=7", Snippet: "mammals"}
+	welcome := dbx.ExternalResult{Title: "Welcome", URL: "/welcome", Snippet: "already a page"}
+	for _, c := range []struct {
+		query, lang string
+		items       []dbx.ExternalResult
+	}{
+		{"gopher", "en", []dbx.ExternalResult{gopher, rodent, welcome}},
+		{"gophers", "en", []dbx.ExternalResult{gopher, welcome}},
+		{"gopher", "da", []dbx.ExternalResult{gopher, welcome}},
+	} {
+		if err := dbx.InsertExternal(ctx, db, 1, c.query, c.lang, c.items); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cookies := registerAndLogin(t, router, "promoteadmin", "secret123")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'promoteadmin'`); err != nil {
+		t.Fatal(err)
+	}
+	admin := adminClient(router, cookies)
+	runJobs := func() {
+		t.Helper()
+		for {
+			worked, err := q.RunOnce(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !worked {
+				return
+			}
+		}
+	}
+	promote := func(body string) []h.PromoteExternalPayload {
+		t.Helper()
+		rr := admin(http.MethodPost, "/admin/external-results/promote", body)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("promote %s: expected 202, got %d: %s", body, rr.Code, rr.Body.String())
+		}
+		var resp h.PromoteExternalResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Queued
+	}
+
+	// Only the gopher article was returned for three queries and is not a page yet.
+	if queued := promote(""); len(queued) != 1 || queued[0].URL != gopher.URL {
+		t.Fatalf("expected the gopher article to be queued, got %+v", queued)
+	}
+	runJobs()
+
+	var title, lang, content string
+	if err := db.QueryRow(`SELECT title, language, content FROM pages WHERE url = $1`, gopher.URL).Scan(&title, &lang, &content); err != nil {
+		t.Fatalf("promoted page: %v", err)
+	}
+	if title != "Gopher" || lang != "en" || content != "Gophers are burrowing rodents.\n\nThey live in North America." {
+		t.Fatalf("unexpected page %q (%s): %q", title, lang, content)
+	}
+	if queued := promote("{}"); len(queued) != 0 {
+		t.Fatalf("promoted articles must not be queued again, got %+v", queued)
+	}
+
+	if queued := promote(`{"url":"` + rodent.URL + `"}`); len(queued) != 1 {
+		t.Fatalf("expected the rodent article to be queued, got %+v", queued)
+	}
+	runJobs()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pages WHERE url = $1 AND title = 'Rodent'`, rodent.URL).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected the rodent page, got %d (%v)", n, err)
+	}
+
+	if rr := admin(http.MethodPost, "/admin/external-results/promote", `{"url":"https://en.wikipedia.org/?curid=404"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("uncached url: expected 404, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPost, "/admin/external-results/promote", `{"url":"http://169.254.169.254/latest/meta-data"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("internal url: expected 400, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPost, "/admin/external-results/promote", `{`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad JSON: expected 400, got %d", rr.Code)
+	}
+}
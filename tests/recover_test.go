@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/errortrack"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func panicRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(h.RequestIDMiddleware())
+	r.Use(h.RecoverMiddleware())
+	r.HandleFunc("/boom", func(http.ResponseWriter, *http.Request) { panic("boom") })
+	r.HandleFunc("/api/boom", func(http.ResponseWriter, *http.Request) { panic("boom") })
+	r.HandleFunc("/ok", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("ok")) })
+	return r
+}
+
+func TestRecover_PanicBecomes500WithRequestID(t *testing.T) {
+	r := panicRouter()
+	tracker := useCaptureTracker(t)
+	before := testutil.ToFloat64(metrics.PanicsTotal)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	id := rec.Header().Get("X-Request-ID")
+	if id == "" || !strings.Contains(rec.Body.String(), id) {
+		t.Fatalf("expected request ID in header and body, got %q / %q", id, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/boom", nil)
+	req.Header.Set("X-Request-ID", "proxy-assigned-id")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("expected JSON 500, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `"request_id":"proxy-assigned-id"`) {
+		t.Fatalf("expected proxy request ID in body, got %s", rec.Body.String())
+	}
+
+	if got := testutil.ToFloat64(metrics.PanicsTotal) - before; got != 2 {
+		t.Fatalf("expected 2 counted panics, got %v", got)
+	}
+	events := tracker.Events()
+	if len(events) != 2 || events[0].RequestID != id || events[1].RequestID != "proxy-assigned-id" {
+		t.Fatalf("unexpected reports: %+v", events)
+	}
+	for _, ev := range events {
+		if ev.Message != "panic: boom" || ev.Level != errortrack.LevelFatal || len(ev.Stack) == 0 || ev.Request == nil {
+			t.Fatalf("unexpected panic report: %+v", ev)
+		}
+	}
+}
+
+func TestRecover_RequestIDOnNormalResponses(t *testing.T) {
+	r := panicRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Fatalf("unexpected response: %d %q", rec.Code, rec.Body.String())
+	}
+	if id := rec.Header().Get("X-Request-ID"); id == "" || id == "bad id\n" {
+		t.Fatalf("expected a generated request ID, got %q", id)
+	}
+}
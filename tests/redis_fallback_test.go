@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/cache"
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/ratelimit"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Without REDIS_URL the in-memory backends are used; these cover their behavior
+// and the handler wiring (the Redis backends share the same interfaces).
+
+func TestMemoryCache_TTLAndCapacity(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemory(2)
+
+	if err := c.Set(ctx, "a", []byte("1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, _ := c.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Fatalf("expected hit for a, got %q %v", v, ok)
+	}
+
+	_ = c.Set(ctx, "short", []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := c.Get(ctx, "short"); ok {
+		t.Fatal("expected expired entry to miss")
+	}
+
+	// Capacity is respected.
+	_ = c.Set(ctx, "b", []byte("2"), time.Minute)
+	_ = c.Set(ctx, "c", []byte("3"), time.Minute)
+	hits := 0
+	for _, k := range []string{"a", "b", "c"} {
+		if _, ok, _ := c.Get(ctx, k); ok {
+			hits++
+		}
+	}
+	if hits > 2 {
+		t.Fatalf("expected at most 2 entries, got %d", hits)
+	}
+}
+
+func TestRateLimit_AuthScope(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	h.SetRateLimiter("auth", ratelimit.NewMemory(2, time.Minute))
+	defer h.SetRateLimiter("auth", nil)
+	// httptest requests come from 192.0.2.1, which stands in for the reverse proxy.
+	h.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")})
+	defer h.SetTrustedProxies(nil)
+
+	login := func(ip string) int {
+		form := url.Values{"username": {"nobody"}, "password": {"wrong"}}
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-For", ip)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := login("203.0.113.1"); code == http.StatusTooManyRequests {
+			t.Fatalf("request %d unexpectedly rate limited", i+1)
+		}
+	}
+	if code := login("203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 on third attempt, got %d", code)
+	}
+	// Other clients have their own budget.
+	if code := login("203.0.113.2"); code == http.StatusTooManyRequests {
+		t.Fatal("expected a different client not to be limited")
+	}
+}
+
+// Search on SQLite fails (no ILIKE); failed lookups must not be cached so the next request retries.
+func TestSearchCache_SkipsFailedLookups(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	h.SetSearchCache(cache.NewMemory(10), time.Minute)
+	defer h.SetSearchCache(nil, 0)
+
+	cookies := registerAndLogin(t, router, "cacheuser", "secret")
+	hits := metrics.CacheRequests.WithLabelValues("search", "hit")
+	misses := metrics.CacheRequests.WithLabelValues("search", "miss")
+	hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/search?q=cachetest&language=en", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	if got := testutil.ToFloat64(misses) - missesBefore; got != 2 {
+		t.Fatalf("expected two cache misses, got %v", got)
+	}
+	if got := testutil.ToFloat64(hits) - hitsBefore; got != 0 {
+		t.Fatalf("expected no cache hits for failed lookups, got %v", got)
+	}
+}
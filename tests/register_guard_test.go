@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var formTokenRe = regexp.MustCompile(`name="form_token" value="([^"]+)"`)
+
+func registerForm(user string) url.Values {
+	return url.Values{"username": {user}, "email": {user + "@example.com"}, "password": {"secret"}, "password2": {"secret"}}
+}
+
+func postRegister(router http.Handler, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// registerFormToken renders /register and returns its form token.
+func registerFormToken(t *testing.T, router http.Handler) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/register", nil))
+	m := formTokenRe.FindStringSubmatch(rr.Body.String())
+	if m == nil {
+		t.Fatalf("no form token on /register: %s", rr.Body.String())
+	}
+	return m[1]
+}
+
+// A filled-in honeypot looks like a successful signup but creates no user.
+func TestRegisterGuard_Honeypot(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/register", nil))
+	if !strings.Contains(rr.Body.String(), `name="website"`) {
+		t.Fatal("expected the honeypot field on /register")
+	}
+
+	blocked := metrics.RegistrationBlocked.WithLabelValues("honeypot")
+	start := testutil.ToFloat64(blocked)
+	form := registerForm("spambot")
+	form.Set("website", "http://spam.example")
+	if rr := postRegister(router, form); rr.Code != http.StatusFound || rr.Header().Get("Location") != "/login" {
+		t.Fatalf("expected the success redirect, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE username = 'spambot'`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("expected no user, got %d (%v)", n, err)
+	}
+	if got := testutil.ToFloat64(blocked) - start; got != 1 {
+		t.Fatalf("expected 1 blocked registration, got %v", got)
+	}
+}
+
+// With a minimum submit time the form needs a valid token from /register that is old enough.
+func TestRegisterGuard_MinSubmitTime(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	if err := h.SetRegistrationGuard(h.RegistrationGuardConfig{MinSubmitTime: 300 * time.Millisecond, SigningKey: []byte("test-key")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.SetRegistrationGuard(h.RegistrationGuardConfig{}) })
+
+	tooFast := metrics.RegistrationBlocked.WithLabelValues("too_fast")
+	badToken := metrics.RegistrationBlocked.WithLabelValues("form_token")
+	startFast, startToken := testutil.ToFloat64(tooFast), testutil.ToFloat64(badToken)
+
+	form := registerForm("ivan")
+	if rr := postRegister(router, form); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "The form has expired") {
+		t.Fatalf("without a token: expected 400, got %d", rr.Code)
+	}
+	token := registerFormToken(t, router)
+	form.Set("form_token", token[:len(token)-1]+"0")
+	if rr := postRegister(router, form); rr.Code != http.StatusBadRequest {
+		t.Fatalf("with a tampered token: expected 400, got %d", rr.Code)
+	}
+	form.Set("form_token", token)
+	rr := postRegister(router, form)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "Please take a moment") {
+		t.Fatalf("submitted right away: expected 400, got %d", rr.Code)
+	}
+	if !formTokenRe.MatchString(rr.Body.String()) {
+		t.Fatal("expected a fresh form token on the re-rendered form")
+	}
+	if testutil.ToFloat64(tooFast)-startFast != 1 || testutil.ToFloat64(badToken)-startToken != 2 {
+		t.Fatal("expected the blocked registrations to be counted")
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if rr := postRegister(router, form); rr.Code != http.StatusFound {
+		t.Fatalf("after the minimum time: expected 302, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// With a CAPTCHA provider the widget is shown and its response is verified server-side.
+func TestRegisterGuard_Captcha(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	var verified url.Values
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		verified = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("response") == "human" {
+			_, _ = w.Write([]byte(`{"success": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer verifier.Close()
+
+	if err := h.SetRegistrationGuard(h.RegistrationGuardConfig{CaptchaProvider: "turnstile"}); err == nil {
+		t.Fatal("expected an error without site key and secret")
+	}
+	if err := h.SetRegistrationGuard(h.RegistrationGuardConfig{
+		CaptchaProvider:  "turnstile",
+		CaptchaSiteKey:   "site-key",
+		CaptchaSecret:    "captcha-secret",
+		CaptchaVerifyURL: verifier.URL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.SetRegistrationGuard(h.RegistrationGuardConfig{}) })
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/register", nil))
+	if body := rr.Body.String(); !strings.Contains(body, `class="cf-turnstile" data-sitekey="site-key"`) ||
+		!strings.Contains(body, "challenges.cloudflare.com/turnstile/v0/api.js") {
+		t.Fatalf("expected the Turnstile widget on /register: %s", body)
+	}
+
+	form := registerForm("judy")
+	if rr := postRegister(router, form); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "not a robot") {
+		t.Fatalf("without a CAPTCHA response: expected 400, got %d", rr.Code)
+	}
+	form.Set("cf-turnstile-response", "robot")
+	if rr := postRegister(router, form); rr.Code != http.StatusBadRequest {
+		t.Fatalf("with a failed CAPTCHA: expected 400, got %d", rr.Code)
+	}
+	form.Set("cf-turnstile-response", "human")
+	if rr := postRegister(router, form); rr.Code != http.StatusFound {
+		t.Fatalf("with a passed CAPTCHA: expected 302, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if verified.Get("secret") != "captcha-secret" || verified.Get("remoteip") == "" {
+		t.Fatalf("unexpected verification request: %v", verified)
+	}
+}
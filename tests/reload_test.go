@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/experiments"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// A reload applies new limits and flags; an invalid config is rejected, counted and leaves
+// the previous one in effect.
+func TestConfigReload(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "reloadadmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'reloadadmin'`); err != nil {
+		t.Fatal(err)
+	}
+	admin := adminClient(router, cookies)
+
+	// httptest requests come from 192.0.2.1, which stands in for the reverse proxy.
+	next := h.RuntimeConfig{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")}}
+	var sourceErr error
+	h.SetConfigSource(func() (h.RuntimeConfig, error) { return next, sourceErr })
+	if _, err := h.ApplyRuntimeConfig(next); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		h.SetConfigSource(nil)
+		_, _ = h.ApplyRuntimeConfig(h.RuntimeConfig{})
+	}()
+
+	login := func(ip string) int {
+		form := url.Values{"username": {"nobody"}, "password": {"wrong"}}
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-For", ip)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	for i := 0; i < 3; i++ {
+		if code := login("203.0.113.9"); code == http.StatusTooManyRequests {
+			t.Fatal("no rate limit configured yet")
+		}
+	}
+
+	next.RateLimitAuth = 1
+	next.RegistrationApproval = true
+	rr := admin(http.MethodPost, "/admin/config/reload", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp h.ConfigReloadResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(resp.Changed, ",") != "REGISTRATION_APPROVAL,RATE_LIMIT_AUTH" {
+		t.Fatalf("unexpected changed settings %v", resp.Changed)
+	}
+	if code := login("203.0.113.9"); code == http.StatusTooManyRequests {
+		t.Fatal("first request after the reload should pass")
+	}
+	if code := login("203.0.113.9"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the reloaded limit to apply, got %d", code)
+	}
+
+	failures := testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("failure"))
+	bad := next
+	bad.RateLimitAuth = 0
+	bad.Experiments = []experiments.Experiment{{Name: "no_such_experiment", Variants: []experiments.Variant{{Name: "a", Weight: 1}}}}
+	next = bad
+	if rr := admin(http.MethodPost, "/admin/config/reload", ""); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an invalid config, got %d", rr.Code)
+	}
+	sourceErr = errors.New("config.yaml: line 3: unknown setting")
+	if _, err := h.ReloadConfig(); err == nil {
+		t.Fatal("expected the source error")
+	}
+	if got := testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("failure")) - failures; got != 2 {
+		t.Fatalf("expected 2 failed reloads counted, got %v", got)
+	}
+	if code := login("203.0.113.9"); code != http.StatusTooManyRequests {
+		t.Fatal("a rejected reload must keep the previous limits")
+	}
+
+	var audited int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action IN ('config.reload', 'config.reload_failed')`).Scan(&audited); err != nil || audited != 2 {
+		t.Fatalf("expected 2 audited reloads, got %d (%v)", audited, err)
+	}
+	if rr := adminClient(router, nil)(http.MethodPost, "/admin/config/reload", ""); rr.Code == http.StatusOK {
+		t.Fatal("reload must be admin only")
+	}
+}
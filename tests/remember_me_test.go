@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// A remember-me cookie alone logs the user back in and is rotated on use; the old value
+// stops working, and logout and password resets revoke the token.
+func TestRememberMe_RestoresAndRotates(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	registerAndLogin(t, router, "lena", "secret123")
+
+	login := func(remember bool) *http.Cookie {
+		t.Helper()
+		form := url.Values{"username": {"lena"}, "password": {"secret123"}}
+		if remember {
+			form.Set("remember", "1")
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusFound {
+			t.Fatalf("login: expected 302, got %d", rr.Code)
+		}
+		return findCookie(rr.Result().Cookies(), "remember")
+	}
+	// bookmarks answers 401 without a logged-in user; it returns the cookies it was sent back.
+	bookmarks := func(c *http.Cookie) (int, *http.Cookie, *http.Cookie) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/me/bookmarks", nil)
+		req.AddCookie(c)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		cookies := rr.Result().Cookies()
+		return rr.Code, findCookie(cookies, "remember"), findCookie(cookies, "session")
+	}
+
+	if c := login(false); c != nil {
+		t.Fatalf("expected no remember cookie without the checkbox, got %v", c)
+	}
+	remember := login(true)
+	if remember == nil || !remember.HttpOnly || remember.MaxAge <= 0 {
+		t.Fatalf("expected a persistent HttpOnly remember cookie, got %v", remember)
+	}
+	var stored string
+	if err := db.QueryRow(`SELECT validator_hash FROM remember_tokens`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, validator, _ := strings.Cut(remember.Value, ":"); strings.Contains(stored, validator) {
+		t.Fatal("the validator must only be stored hashed")
+	}
+
+	code, rotated, session := bookmarks(remember)
+	if code != http.StatusOK || rotated == nil || rotated.Value == remember.Value || session == nil {
+		t.Fatalf("expected a restored session and a rotated cookie, got %d %v %v", code, rotated, session)
+	}
+	if code, _, _ := bookmarks(remember); code != http.StatusUnauthorized {
+		t.Fatalf("the old cookie value must stop working, got %d", code)
+	}
+
+	// Logout deletes the token.
+	req := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	req.AddCookie(session)
+	req.AddCookie(rotated)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if code, _, _ := bookmarks(rotated); code != http.StatusUnauthorized {
+		t.Fatalf("expected the token to be revoked by logout, got %d", code)
+	}
+
+	// A change of session_version (password reset, status change) revokes the rest.
+	remember = login(true)
+	if _, err := db.Exec(`UPDATE users SET session_version = session_version + 1 WHERE username = 'lena'`); err != nil {
+		t.Fatal(err)
+	}
+	code, cleared, _ := bookmarks(remember)
+	if code != http.StatusUnauthorized || cleared == nil || cleared.MaxAge >= 0 {
+		t.Fatalf("expected 401 and a cleared cookie, got %d %v", code, cleared)
+	}
+	var left int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM remember_tokens`).Scan(&left); err != nil || left != 0 {
+		t.Fatalf("expected no tokens left, got %d (%v)", left, err)
+	}
+}
+
+func findCookie(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, c := range cookies {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func suggestTitles(t *testing.T, q string) []string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.APISuggestHandler(rec, httptest.NewRequest(http.MethodGet, "/api/suggest?q="+q, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var got []json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 2 {
+		t.Fatalf("expected [query, suggestions], got %s", rec.Body.String())
+	}
+	var titles []string
+	if err := json.Unmarshal(got[1], &titles); err != nil {
+		t.Fatalf("failed to decode suggestions: %v", err)
+	}
+	return titles
+}
+
+// Reads go to the replica while it is up and fall back to the primary once it is unreachable.
+func TestReadReplica_RoutingAndFallback(t *testing.T) {
+	primary := setupTestHandlers(t)
+	defer closeDB(t, primary)
+
+	replica, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "replica.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.InitSchema(replica); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := primary.Exec(`INSERT INTO pages (title, url, language, content) VALUES ('Primary page', '/p', 'en', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replica.Exec(`INSERT INTO pages (title, url, language, content) VALUES ('Replica page', '/r', 'en', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+
+	h.SetReadReplica(replica)
+	defer h.SetReadReplica(nil)
+
+	if titles := suggestTitles(t, "replica"); len(titles) != 1 {
+		t.Fatalf("expected suggestion from the replica, got %v", titles)
+	}
+
+	fallbacks := testutil.ToFloat64(metrics.DBReplicaFallbacks)
+	if err := replica.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if titles := suggestTitles(t, "primary"); len(titles) != 1 {
+		t.Fatalf("expected suggestion from the primary after replica failure, got %v", titles)
+	}
+	if got := testutil.ToFloat64(metrics.DBReplicaFallbacks) - fallbacks; got != 1 {
+		t.Fatalf("expected one fallback, got %v", got)
+	}
+	if testutil.ToFloat64(metrics.DBReplicaUp) != 0 {
+		t.Fatal("expected replica to be marked down")
+	}
+
+	// Later reads skip the replica entirely until a health check succeeds.
+	if titles := suggestTitles(t, "primary"); len(titles) != 1 {
+		t.Fatalf("expected primary to keep serving reads, got %v", titles)
+	}
+	if got := testutil.ToFloat64(metrics.DBReplicaFallbacks) - fallbacks; got != 1 {
+		t.Fatalf("expected no further fallbacks, got %v", got)
+	}
+}
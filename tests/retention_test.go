@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/jobs"
+)
+
+// Retention runs delete search log rows and cached external results past their retention
+// period in batches, and are listed with the rows they deleted.
+func TestRetention_AdminRun(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	ctx := context.Background()
+	h.SetRetention(h.RetentionConfig{SearchLog: 90 * 24 * time.Hour, ExternalCache: 10 * 24 * time.Hour})
+	defer h.SetRetention(h.RetentionConfig{})
+
+	now := time.Now().UTC()
+	// More than one batch of expired search log rows, plus rows to keep.
+	for i := 0; i < 1005; i++ {
+		if _, err := db.Exec(`INSERT INTO search_log (day, query_hash, language, results) VALUES ($1, 'x', 'en', 1)`,
+			now.AddDate(0, 0, -100).Format(time.DateOnly)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO search_log (day, query_hash, language, results) VALUES ($1, 'y', 'en', 1)`,
+		now.AddDate(0, 0, -30).Format(time.DateOnly)); err != nil {
+		t.Fatal(err)
+	}
+	for i, age := range []int{20, 2} {
+		if _, err := db.Exec(`INSERT INTO external_results (query, language, title, url, snippet, created_at) VALUES ('go', 'en', 'Go', $1, '', $2)`,
+			fmt.Sprintf("https://en.wikipedia.org/?curid=%d", i), now.AddDate(0, 0, -age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cookies := registerAndLogin(t, router, "retadmin", "secret123")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'retadmin'`); err != nil {
+		t.Fatal(err)
+	}
+	admin := adminClient(router, cookies)
+
+	if rr := admin(http.MethodPost, "/admin/retention/run", ""); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without a job queue: expected 503, got %d", rr.Code)
+	}
+	q := jobs.New(db, jobs.Options{})
+	h.RegisterJobs(q)
+	h.SetJobQueue(q)
+	defer h.SetJobQueue(nil)
+
+	rr := admin(http.MethodPost, "/admin/retention/run", "")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("start: expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := admin(http.MethodPost, "/admin/retention/run", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("second start while queued: expected 409, got %d", rr.Code)
+	}
+	if worked, err := q.RunOnce(ctx); err != nil || !worked {
+		t.Fatalf("expected the retention job to run, got worked=%v err=%v", worked, err)
+	}
+
+	var logRows, extRows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM search_log`).Scan(&logRows); err != nil || logRows != 1 {
+		t.Fatalf("expected 1 search log row kept, got %d (%v)", logRows, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM external_results`).Scan(&extRows); err != nil || extRows != 1 {
+		t.Fatalf("expected 1 external result kept, got %d (%v)", extRows, err)
+	}
+
+	rr = admin(http.MethodGet, "/admin/retention", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp h.RetentionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.SearchLogRetention != (90*24*time.Hour).String() || len(resp.Runs) != 1 {
+		t.Fatalf("unexpected retention status: %+v", resp)
+	}
+	run := resp.Runs[0]
+	if run.Status != "done" || run.Trigger != "admin" || run.SearchLogDeleted != 1005 || run.ExternalResultsDeleted != 1 || run.FinishedAt == nil {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+}
+
+// A run left queued or running (its job lost, the process killed) is marked failed after an
+// hour instead of blocking new runs, and finished runs are pruned after 30 days.
+func TestRetention_StaleRunsExpireAndArePruned(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, run := range []struct {
+		status string
+		age    time.Duration
+	}{
+		{"running", 2 * time.Hour},
+		{"done", 40 * 24 * time.Hour},
+		{"failed", 24 * time.Hour},
+	} {
+		if _, err := db.Exec(`INSERT INTO retention_runs (trigger_source, status, created_at) VALUES ('scheduled', $1, $2)`,
+			run.status, now.Add(-run.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cookies := registerAndLogin(t, router, "retadmin", "secret123")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'retadmin'`); err != nil {
+		t.Fatal(err)
+	}
+	admin := adminClient(router, cookies)
+	q := jobs.New(db, jobs.Options{})
+	h.RegisterJobs(q)
+	h.SetJobQueue(q)
+	defer h.SetJobQueue(nil)
+
+	if rr := admin(http.MethodPost, "/admin/retention/run", ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("start with an abandoned run: expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var status, lastErr string
+	if err := db.QueryRow(`SELECT status, COALESCE(last_error, '') FROM retention_runs WHERE id = 1`).Scan(&status, &lastErr); err != nil {
+		t.Fatal(err)
+	}
+	if status != "failed" || lastErr == "" {
+		t.Fatalf("expected the abandoned run to be failed with an error, got %q %q", status, lastErr)
+	}
+
+	if worked, err := q.RunOnce(ctx); err != nil || !worked {
+		t.Fatalf("expected the retention job to run, got worked=%v err=%v", worked, err)
+	}
+	var ids []int
+	rows, err := db.Query(`SELECT id FROM retention_runs ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[1 3 4]" {
+		t.Fatalf("expected the 40 day old run to be pruned, got runs %v", ids)
+	}
+}
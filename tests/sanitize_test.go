@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	dbx "devops-valgfag/internal/db"
+	"devops-valgfag/internal/sanitize"
+	"devops-valgfag/internal/scraper"
+)
+
+func TestSanitize_HTML(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{`<p onclick="x()">Hi <em>there</em></p>`, `<p>Hi <em>there</em></p>`},
+		{`<script>alert(1)</script>ok`, `ok`},
+		{`<style>p{}</style><iframe src="//evil"></iframe>text`, `text`},
+		{`<a href="https://go.dev" target="_blank">Go</a>`, `<a href="https://go.dev" rel="nofollow noopener">Go</a>`},
+		{`<a href=" JavaScript:alert(1)">x</a>`, `<a rel="nofollow noopener">x</a>`},
+		{`<img src=x onerror=alert(1)>caption`, `caption`},
+		{`<b>unclosed <i>tags`, `<b>unclosed <i>tags</i></b>`},
+		{`stray</div> end`, `stray end`},
+		{`a &lt; b &amp; <!-- comment -->c`, `a &lt; b &amp; c`},
+		{`<td colspan="2" style="x">cell</td>`, `<td colspan="2">cell</td>`},
+	}
+	for _, c := range cases {
+		if got := sanitize.HTML(c.in); got != c.want {
+			t.Errorf("HTML(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSanitize_Content(t *testing.T) {
+	if got := sanitize.Content("First line\nsecond\n\n1 < 2 & x"); got != "<p>First line<br>second</p><p>1 &lt; 2 &amp; x</p>" {
+		t.Fatalf("plain text: %q", got)
+	}
+	if got := sanitize.Content("<p>markup</p>"); got != "<p>markup</p>" {
+		t.Fatalf("markup: %q", got)
+	}
+}
+
+func TestSanitize_Snippet(t *testing.T) {
+	in := `The <span class="searchmatch">Go</span> &quot;gopher&quot; <b>mascot</b><script>alert(1)</script> <span class="x" onclick="y()">a</span> &amp; <a href="//evil">b</a>`
+	if got, want := scraper.SanitizeSnippet(in), `The <span class="searchmatch">Go</span> &#34;gopher&#34; mascot <span>a</span> &amp; b`; got != want {
+		t.Errorf("SanitizeSnippet = %q, want %q", got, want)
+	}
+	if got, want := scraper.SnippetText(in), `The Go "gopher" mascot a & b`; got != want {
+		t.Errorf("SnippetText = %q, want %q", got, want)
+	}
+}
+
+// External snippets keep their highlights on the search page and are plain text in JSON.
+func TestSanitize_ExternalSnippets(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.EnableExternalSearch(true)
+	defer h.EnableExternalSearch(false)
+
+	// Stored raw, as rows scraped before sanitizing on scrape were.
+	if err := dbx.InsertExternal(context.Background(), db, 1, "gopher", "en", []dbx.ExternalResult{{
+		Title:   "Gopher",
+		URL:     "https://en.wikipedia.org/?curid=1",
+		Snippet: `The <span class="searchmatch">gopher</span> &amp; friends<img src=x onerror=alert(1)>`,
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	get := adminClient(router, nil)
+
+	page := get(http.MethodGet, "/search?q=gopher", "").Body.String()
+	if !strings.Contains(page, `The <span class="searchmatch">gopher</span> &amp; friends`) || strings.Contains(page, "onerror") {
+		t.Fatalf("expected highlighted, sanitized snippet:\n%s", page)
+	}
+
+	rr := get(http.MethodGet, "/search?q=gopher&format=json", "")
+	var res h.APISearchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil || len(res.SearchResults) != 1 {
+		t.Fatalf("unexpected JSON (%d): %s", rr.Code, rr.Body.String())
+	}
+	if got := res.SearchResults[0].Description; got != "The gopher & friends" {
+		t.Fatalf("expected plain text description, got %q", got)
+	}
+	if strings.Contains(rr.Body.String(), "searchmatch") {
+		t.Fatalf("JSON must not carry markup: %s", rr.Body.String())
+	}
+}
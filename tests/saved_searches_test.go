@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// A saved search notifies its owner once about pages added after it was saved,
+// and its share link redirects to the search page.
+func TestSavedSearches_NotifyOnNewMatches(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	alice := registerAndLogin(t, router, "alice", "secret")
+
+	rr := bookmarkRequest(router, http.MethodPost, "/api/me/saved-searches", `{"name":"Go","query":"golang"}`, alice)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var saved h.SavedSearch
+	if err := json.Unmarshal(rr.Body.Bytes(), &saved); err != nil || saved.ShareURL == "" {
+		t.Fatalf("invalid saved search: %v %s", err, rr.Body.String())
+	}
+
+	if rr := bookmarkRequest(router, http.MethodPost, "/api/me/saved-searches", `{"name":"Go","query":"other"}`, alice); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate name, got %d", rr.Code)
+	}
+
+	// Nothing new yet.
+	if n, err := h.RunSavedSearches(context.Background()); err != nil || n != 0 {
+		t.Fatalf("expected no notifications, got %d (%v)", n, err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES
+		('Golang 2', '/golang-2', 'en', 'all about golang'),
+		('Rust', '/rust', 'en', 'not matching')`); err != nil {
+		t.Fatalf("failed to insert pages: %v", err)
+	}
+
+	if n, err := h.RunSavedSearches(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected 1 notification, got %d (%v)", n, err)
+	}
+	// Already-seen pages do not notify again.
+	if n, err := h.RunSavedSearches(context.Background()); err != nil || n != 0 {
+		t.Fatalf("expected no repeat notification, got %d (%v)", n, err)
+	}
+
+	rr = bookmarkRequest(router, http.MethodGet, "/api/me/notifications", "", alice)
+	var notes h.APINotificationsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &notes); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if notes.Unread != 1 || len(notes.Notifications) != 1 || notes.Notifications[0].URL != "/search?language=en&q=golang" {
+		t.Fatalf("unexpected notifications: %+v", notes)
+	}
+
+	if rr := bookmarkRequest(router, http.MethodPost, "/api/me/notifications/read", "", alice); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 marking read, got %d", rr.Code)
+	}
+
+	// Share links work without a session.
+	rr = bookmarkRequest(router, http.MethodGet, saved.ShareURL, "", nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/search?language=en&q=golang" {
+		t.Fatalf("unexpected share redirect: %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+// A saved search only counts new pages of the tenant it was saved in and links to that
+// tenant's search.
+func TestSavedSearches_ScopedToTenant(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	handler := h.TenantMiddleware()(router)
+	if _, err := db.Exec(`INSERT INTO tenants (id, slug, name) VALUES (2, 'docs', 'Docs')`); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := registerAndLogin(t, router, "alice", "secret")
+	rr := adminClient(handler, alice)(http.MethodPost, "/t/docs/api/me/saved-searches", `{"name":"Go","query":"golang"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var saved h.SavedSearch
+	if err := json.Unmarshal(rr.Body.Bytes(), &saved); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content, tenant_id) VALUES ('Golang elsewhere', '/golang-elsewhere', 'en', 'golang', 1)`); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := h.RunSavedSearches(context.Background()); err != nil || n != 0 {
+		t.Fatalf("expected no notification for another tenant's page, got %d (%v)", n, err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content, tenant_id) VALUES ('Golang docs', '/golang-docs', 'en', 'golang', 2)`); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := h.RunSavedSearches(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected 1 notification, got %d (%v)", n, err)
+	}
+	rr = bookmarkRequest(router, http.MethodGet, "/api/me/notifications", "", alice)
+	var notes h.APINotificationsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &notes); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes.Notifications) != 1 || notes.Notifications[0].URL != "/t/docs/search?language=en&q=golang" {
+		t.Fatalf("unexpected notifications: %+v", notes)
+	}
+
+	rr = bookmarkRequest(router, http.MethodGet, saved.ShareURL, "", nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/t/docs/search?language=en&q=golang" {
+		t.Fatalf("unexpected share redirect: %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+// % and _ in a saved query match themselves, so unrelated pages do not notify.
+func TestSavedSearches_WildcardsMatchLiterally(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	alice := registerAndLogin(t, router, "alice", "secret")
+
+	for _, body := range []string{`{"name":"Percent","query":"100%"}`, `{"name":"Underscore","query":"a_b"}`} {
+		if rr := bookmarkRequest(router, http.MethodPost, "/api/me/saved-searches", body, alice); rr.Code != http.StatusCreated {
+			t.Fatalf("expected 201 for %s, got %d: %s", body, rr.Code, rr.Body.String())
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES
+		('Thousand', '/thousand', 'en', '1000 ways'),
+		('Axb', '/axb', 'en', 'axb notation')`); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := h.RunSavedSearches(context.Background()); err != nil || n != 0 {
+		t.Fatalf("expected no notifications for unrelated pages, got %d (%v)", n, err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES
+		('Full effort', '/full', 'en', 'give it 100%')`); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := h.RunSavedSearches(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected 1 notification for the literal match, got %d (%v)", n, err)
+	}
+}
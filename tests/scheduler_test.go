@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/scheduler"
+)
+
+// Tasks run on their interval, overlapping runs are skipped, and cluster-wide tasks
+// stay off when the scheduler is disabled on this replica.
+func TestScheduler_IntervalsOverlapAndEnabled(t *testing.T) {
+	var fast, shared atomic.Int32
+	release := make(chan struct{})
+
+	s := scheduler.New(scheduler.Options{Enabled: false})
+	s.Add(scheduler.Task{Name: "fast", Interval: 5 * time.Millisecond, Jitter: -1, Local: true, Run: func(context.Context) error {
+		fast.Add(1)
+		return nil
+	}})
+	s.Add(scheduler.Task{Name: "shared", Interval: 5 * time.Millisecond, Jitter: -1, Run: func(context.Context) error {
+		shared.Add(1)
+		return nil
+	}})
+	s.Add(scheduler.Task{Name: "slow", Interval: 5 * time.Millisecond, Jitter: -1, Local: true, Run: func(ctx context.Context) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	status := s.Status() // snapshot while the slow run is still blocked
+	cancel()
+	<-done
+	close(release)
+
+	if fast.Load() < 3 {
+		t.Fatalf("expected fast task to run repeatedly, got %d runs", fast.Load())
+	}
+	if shared.Load() != 0 {
+		t.Fatalf("expected cluster-wide task not to run with scheduler disabled, got %d runs", shared.Load())
+	}
+	for _, st := range status {
+		if st.Name == "slow" && (st.Skipped == 0 || !st.Running || st.Runs != 0) {
+			t.Fatalf("expected slow task to be running with skipped ticks, got %+v", st)
+		}
+	}
+	if ok, _ := s.RunNow(context.Background(), "missing"); ok {
+		t.Fatal("expected RunNow to report unknown task")
+	}
+}
+
+// The stats rollup aggregates clicks per day/query, and admins can see and trigger tasks.
+func TestScheduler_StatsRollupAndAdmin(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	s := scheduler.New(scheduler.Options{Enabled: true})
+	h.RegisterScheduledTasks(s, h.ScheduleConfig{SitemapRefresh: time.Hour, SavedSearchInterval: time.Hour})
+	h.SetScheduler(s)
+	defer h.SetScheduler(nil)
+
+	for _, rank := range []int{1, 3} {
+		if _, err := db.Exec(`INSERT INTO search_clicks (query, language, url, rank) VALUES ('go', 'en', '/go', $1)`, rank); err != nil {
+			t.Fatalf("insert click: %v", err)
+		}
+	}
+
+	cookies := registerAndLogin(t, router, "scheduleradmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'scheduleradmin'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+	adminRequest := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := adminRequest(http.MethodPost, "/admin/scheduler/"+h.TaskStatsRollup+"/run")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var clicks int
+	var avgRank float64
+	err := db.QueryRow(`SELECT clicks, avg_rank FROM search_click_stats_daily WHERE query = 'go' AND language = 'en'`).Scan(&clicks, &avgRank)
+	if err != nil {
+		t.Fatalf("read rollup: %v", err)
+	}
+	if clicks != 2 || avgRank != 2 {
+		t.Fatalf("expected 2 clicks with avg rank 2, got %d / %v", clicks, avgRank)
+	}
+
+	if rr := adminRequest(http.MethodPost, "/admin/scheduler/nope/run"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown task, got %d", rr.Code)
+	}
+
+	rr = adminRequest(http.MethodGet, "/admin/scheduler")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp h.SchedulerStatusResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !resp.Enabled || !resp.Leader || len(resp.Tasks) != 10 {
+		t.Fatalf("unexpected scheduler status: %+v", resp)
+	}
+	for _, task := range resp.Tasks {
+		if task.Name == h.TaskStatsRollup && (task.Runs != 1 || task.LastError != "") {
+			t.Fatalf("unexpected rollup status: %+v", task)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+func postBatch(router *mux.Router, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/search/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Batch search requires a session, validates the batch size and keeps request order.
+func TestAPIBatchSearch(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	if rr := postBatch(router, `{"queries":["go"]}`, nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", rr.Code)
+	}
+
+	cookies := registerAndLogin(t, router, "batch", "secret")
+
+	if rr := postBatch(router, `{"queries":[]}`, cookies); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for empty batch, got %d", rr.Code)
+	}
+	tooMany := `{"queries":["` + strings.TrimSuffix(strings.Repeat(`q","`, 21), `","`) + `"]}`
+	if rr := postBatch(router, tooMany, cookies); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for oversized batch, got %d", rr.Code)
+	}
+	for _, lang := range []string{"xx", "EN", "en-US"} {
+		rr := postBatch(router, `{"queries":["go"],"language":"`+lang+`"}`, cookies)
+		var apiErr h.APIErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &apiErr); err != nil || rr.Code != http.StatusBadRequest || apiErr.Field != "language" {
+			t.Fatalf("language %q: expected 400 naming language, got %d: %s", lang, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := postBatch(router, `{"queries":["go"],"language":" da "}`, cookies); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a supported language, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := postBatch(router, `{"queries":["alpha","beta","gamma"],"limit":3}`, cookies)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp h.APIBatchSearchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("expected 3 result sets, got %d", len(resp.Results))
+	}
+	for i, want := range []string{"alpha", "beta", "gamma"} {
+		if resp.Results[i].Query != want {
+			t.Fatalf("result %d: expected query %q, got %q", i, want, resp.Results[i].Query)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// GET /api/admin/search/explain returns the plan of the statement the search runs, for the
+// path SEARCH_FTS selects or the one asked for. Admin only.
+func TestSearchExplain_PlansTheSearchStatement(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES ('Harbour baths', 'https://example.com/baths', 'en', 'Swimming in the harbour')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := adminClient(router, nil)(http.MethodGet, "/api/admin/search/explain?q=harbour", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: expected 401, got %d", rec.Code)
+	}
+	cookies := registerAndLogin(t, router, "explainer", "secret123")
+	admin := adminClient(router, cookies)
+	if rec := admin(http.MethodGet, "/api/admin/search/explain?q=harbour", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: expected 403, got %d", rec.Code)
+	}
+	if _, err := db.Exec(`UPDATE users SET is_admin = 1 WHERE username = 'explainer'`); err != nil {
+		t.Fatal(err)
+	}
+
+	explain := func(query string) h.SearchExplainResponse {
+		t.Helper()
+		rec := admin(http.MethodGet, "/api/admin/search/explain?"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var resp h.SearchExplainResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// SQLite mode searches with FTS5; its statement gets the quoted match expression.
+	resp := explain("q=Harbour&language=en&limit=5")
+	if resp.Path != "fts" || resp.Pool != "primary" || resp.Analyze || !strings.Contains(resp.Query, "pages_fts MATCH") {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if len(resp.Args) < 4 || resp.Args[0] != "en" || resp.Args[1] != `"harbour"` || resp.Args[3] != float64(5) {
+		t.Errorf("unexpected arguments %v", resp.Args)
+	}
+	if plan := strings.Join(resp.Plan, "\n"); !strings.Contains(plan, "pages_fts") {
+		t.Errorf("expected the FTS index in the plan, got:\n%s", plan)
+	}
+
+	resp = explain("q=harbour&path=ilike")
+	if resp.Path != "ilike" || !strings.Contains(resp.Query, "LIKE f_unaccent($2)") || resp.Args[1] != "%harbour%" || len(resp.Plan) == 0 {
+		t.Fatalf("unexpected ILIKE response %+v", resp)
+	}
+
+	for query, want := range map[string]int{
+		"q=":                   http.StatusBadRequest,
+		"q=%21%21%21":          http.StatusBadRequest, // no words for FTS5
+		"q=harbour&path=bm25":  http.StatusBadRequest,
+		"q=harbour&ranking=v3": http.StatusBadRequest,
+		"q=harbour&limit=0":    http.StatusBadRequest,
+	} {
+		if rec := admin(http.MethodGet, "/api/admin/search/explain?"+query, ""); rec.Code != want {
+			t.Errorf("%s: expected %d, got %d: %s", query, want, rec.Code, rec.Body.String())
+		}
+	}
+}
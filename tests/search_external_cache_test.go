@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	dbx "devops-valgfag/internal/db"
+)
+
+// Results cached for one query are found by related queries: they fill the slots pages leave
+// free, once per URL, without their highlight markup being searchable.
+func TestSearch_ReusesCachedExternalResults(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	ctx := context.Background()
+
+	goArticle := dbx.ExternalResult{
+		Title:   "Go (programming language)",
+		URL:     "https://en.wikipedia.org/wiki/Go_(programming_language)",
+		Snippet: `<span class="searchmatch">Go</span> is a statically typed, compiled language`,
+	}
+	if err := dbx.InsertExternal(ctx, db, 1, "golang", "en", []dbx.ExternalResult{goArticle}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbx.InsertExternal(ctx, db, 1, "go language", "en", []dbx.ExternalResult{goArticle}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO tenants (id, slug, name) VALUES (2, 'other', 'Other')`); err != nil {
+		t.Fatal(err)
+	}
+	other := dbx.ExternalResult{Title: "Statically typed", URL: "https://en.wikipedia.org/wiki/Type_system", Snippet: "Other tenant"}
+	if err := dbx.InsertExternal(ctx, db, 2, "types", "en", []dbx.ExternalResult{other}); err != nil {
+		t.Fatal(err)
+	}
+	cookies := registerAndLogin(t, router, "cacheuser", "secret123")
+
+	got := searchAPI(t, router, cookies, "q=statically+typed&language=en")
+	if len(got) != 1 || got[0].URL != goArticle.URL || got[0].ID != 0 {
+		t.Fatalf("expected the cached article once, got %+v", got)
+	}
+	if got[0].Description != "Go is a statically typed, compiled language" {
+		t.Fatalf("expected a plain-text snippet, got %q", got[0].Description)
+	}
+
+	if got := searchAPI(t, router, cookies, "q=searchmatch&language=en"); len(got) != 0 {
+		t.Fatalf("highlight markup must not match, got %v", resultURLs(got))
+	}
+	for _, wildcard := range []string{"%25", "_", "statically%25typed"} {
+		if got := searchAPI(t, router, cookies, "q="+wildcard+"&language=en"); len(got) != 0 {
+			t.Fatalf("%s must match literally, got %v", wildcard, resultURLs(got))
+		}
+	}
+	if got := searchAPI(t, router, cookies, "q=statically+typed&language=da"); len(got) != 0 {
+		t.Fatalf("other language matched: %v", resultURLs(got))
+	}
+
+	// A page with the same URL (e.g. a promoted article) is shown instead of the cache entry.
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES ($1, $2, 'en', 'Go is statically typed.')`, goArticle.Title, goArticle.URL); err != nil {
+		t.Fatal(err)
+	}
+	got = searchAPI(t, router, cookies, "q=statically+typed&language=en")
+	if len(got) != 1 || got[0].ID == 0 {
+		t.Fatalf("expected only the page, got %+v", got)
+	}
+}
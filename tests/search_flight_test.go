@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Identical searches issued at the same time share one database lookup.
+func TestSearch_ConcurrentIdenticalQueriesShareLookup(t *testing.T) {
+	db := setupTestHandlers(t)
+	defer closeDB(t, db)
+	h.SetSearchCache(nil, 0)
+
+	// Hold the only connection so the first lookup blocks while the others arrive.
+	db.SetMaxOpenConns(1)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := metrics.DBQueries.WithLabelValues("primary", "error")
+	deduplicated := testutil.ToFloat64(metrics.SearchDeduplicated)
+	before := testutil.ToFloat64(queries) + testutil.ToFloat64(metrics.DBQueries.WithLabelValues("primary", "ok"))
+
+	const clients = 5
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.SearchPageHandler(rec, httptest.NewRequest(http.MethodGet, "/search?q=trending&format=json", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected 200, got %d", rec.Code)
+			}
+		}()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	after := testutil.ToFloat64(queries) + testutil.ToFloat64(metrics.DBQueries.WithLabelValues("primary", "ok"))
+	if got := after - before; got != 1 {
+		t.Fatalf("expected one database lookup for %d identical searches, got %v", clients, got)
+	}
+	if got := testutil.ToFloat64(metrics.SearchDeduplicated) - deduplicated; got != clients-1 {
+		t.Fatalf("expected %d deduplicated searches, got %v", clients-1, got)
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	h "devops-valgfag/handlers"
+)
+
+// seedFTSPages adds pages about zymurgy (a word the sample pages don't use) for the FTS tests.
+func seedFTSPages(t *testing.T, db *sql.DB) {
+	t.Helper()
+	pages := []struct{ title, url, lang, content string }{
+		{"Zymurgy basics", "https://example.com/zymurgy", "en", "Zymurgy is the chemistry of fermentation. Zymurgy covers brewing, zymurgy covers baking."},
+		{"Brewing at home", "https://example.com/brewing", "en", strings.Repeat("Malt, hops and water. ", 30) + "Home brewers study zymurgy too."},
+		{"Bread", "https://example.com/bread", "en", "Yeast makes bread rise."},
+		{"Zymurgi", "https://example.com/da/zymurgi", "da", "Zymurgy på dansk: læren om gæring."},
+	}
+	for _, p := range pages {
+		if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES ($1, $2, $3, $4)`, p.title, p.url, p.lang, p.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func resultURLs(results []h.SearchResult) []string {
+	urls := make([]string, 0, len(results))
+	for _, r := range results {
+		urls = append(urls, r.URL)
+	}
+	return urls
+}
+
+// The FTS5 path returns the same result shape as the LIKE fallback (and the PostgreSQL FTS
+// path): real page IDs, the requested language, and a plain-text snippet around the match.
+func TestSQLiteFTS_ResultShapeMatchesFallback(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	seedFTSPages(t, db)
+	cookies := registerAndLogin(t, router, "ftsuser", "secret123")
+
+	fts := searchAPI(t, router, cookies, "q=zymurgy&language=en")
+	h.EnableFTSSearch(false)
+	like := searchAPI(t, router, cookies, "q=zymurgy&language=en")
+
+	gotFTS, gotLike := resultURLs(fts), resultURLs(like)
+	slices.Sort(gotFTS)
+	slices.Sort(gotLike)
+	if want := []string{"https://example.com/brewing", "https://example.com/zymurgy"}; !slices.Equal(gotFTS, want) || !slices.Equal(gotLike, want) {
+		t.Fatalf("expected %v from both paths, got FTS %v and LIKE %v", want, gotFTS, gotLike)
+	}
+
+	for _, r := range append(fts, like...) {
+		if r.ID <= 0 || r.Title == "" || r.Language != "en" {
+			t.Fatalf("incomplete result %+v", r)
+		}
+		if n := utf8.RuneCountInString(r.Description); n == 0 || n > 200 {
+			t.Fatalf("snippet of %d runes for %s", n, r.URL)
+		}
+		if !strings.Contains(strings.ToLower(r.Description), "zymurgy") {
+			t.Fatalf("snippet %q does not show the match", r.Description)
+		}
+		if strings.ContainsAny(r.Description, "<>") {
+			t.Fatalf("snippet %q is not plain text", r.Description)
+		}
+	}
+}
+
+// bm25 ranks the page that is about the query above the one that mentions it once, and
+// several words must all match, like plainto_tsquery.
+func TestSQLiteFTS_RankingAndAllWords(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	seedFTSPages(t, db)
+	cookies := registerAndLogin(t, router, "ftsuser", "secret123")
+
+	got := resultURLs(searchAPI(t, router, cookies, "q=zymurgy&language=en"))
+	if len(got) != 2 || got[0] != "https://example.com/zymurgy" {
+		t.Fatalf("expected the zymurgy page first, got %v", got)
+	}
+
+	got = resultURLs(searchAPI(t, router, cookies, "q=zymurgy+brewers&language=en"))
+	if !slices.Equal(got, []string{"https://example.com/brewing"}) {
+		t.Fatalf("expected only the page with both words, got %v", got)
+	}
+
+	got = resultURLs(searchAPI(t, router, cookies, "q=zymurgy&language=da"))
+	if !slices.Equal(got, []string{"https://example.com/da/zymurgi"}) {
+		t.Fatalf("expected only the Danish page, got %v", got)
+	}
+}
+
+// FTS5 query syntax in the search box is taken literally: no errors, and punctuation alone
+// matches nothing.
+func TestSQLiteFTS_QuerySyntaxIsLiteral(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	seedFTSPages(t, db)
+	cookies := registerAndLogin(t, router, "ftsuser", "secret123")
+
+	for _, q := range []string{"NEAR(zymurgy+bread)", "%22zymurgy", "zymurgy+OR", "title:zymurgy", "zymurgy*", "-zymurgy", "%5E", "%22%22"} {
+		searchAPI(t, router, cookies, "q="+q+"&language=en") // fails the test on a non-200
+	}
+
+	if got := searchAPI(t, router, cookies, "q=title:zymurgy&language=en"); len(got) != 0 {
+		t.Fatalf("column filters must not apply, got %v", resultURLs(got))
+	}
+	if got := searchAPI(t, router, cookies, "q=-zymurgy&language=en"); len(got) != 2 {
+		t.Fatalf("expected \"-zymurgy\" to search for zymurgy, got %v", resultURLs(got))
+	}
+}
+
+// The triggers keep the FTS5 index in step with edits and deletes; soft-deleted pages are
+// filtered like everywhere else.
+func TestSQLiteFTS_IndexFollowsPageChanges(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	seedFTSPages(t, db)
+	cookies := registerAndLogin(t, router, "ftsuser", "secret123")
+
+	if _, err := db.Exec(`UPDATE pages SET content = 'Yeast and sourdough starters.' WHERE url = 'https://example.com/brewing'`); err != nil {
+		t.Fatal(err)
+	}
+	if got := resultURLs(searchAPI(t, router, cookies, "q=sourdough&language=en")); !slices.Equal(got, []string{"https://example.com/brewing"}) {
+		t.Fatalf("expected the edited page, got %v", got)
+	}
+	if got := resultURLs(searchAPI(t, router, cookies, "q=zymurgy&language=en")); !slices.Equal(got, []string{"https://example.com/zymurgy"}) {
+		t.Fatalf("old content still indexed: %v", got)
+	}
+
+	if _, err := db.Exec(`UPDATE pages SET deleted_at = CURRENT_TIMESTAMP WHERE url = 'https://example.com/zymurgy'`); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchAPI(t, router, cookies, "q=zymurgy&language=en"); len(got) != 0 {
+		t.Fatalf("soft-deleted page found: %v", resultURLs(got))
+	}
+
+	if _, err := db.Exec(`DELETE FROM pages WHERE url = 'https://example.com/bread'`); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pages_fts WHERE pages_fts MATCH 'bread'`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("deleted page still in the index (%d rows)", n)
+	}
+}
@@ -0,0 +1,46 @@
+package tests
+
+// Fuzz targets for the search query path: normalisation (cache keys, logging) and snippet
+// windows around the query. Run one with
+//
+//	go test ./tests -run '^$' -fuzz FuzzSnippetAround -fuzztime 30s
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"devops-valgfag/internal/snippet"
+	"devops-valgfag/internal/textnorm"
+)
+
+func FuzzSearchQueryNormalize(f *testing.F) {
+	for _, seed := range []string{"", "  Go  Lang ", "BLÅBÆRGRØD", "école", "straße\tİstanbul", "\xff\xfe"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, q string) {
+		got := textnorm.Query(q)
+		if utf8.ValidString(q) && !utf8.ValidString(got) {
+			t.Fatalf("Query(%q) = %q is not valid UTF-8", q, got)
+		}
+		if len(got) > 0 && (got[0] == ' ' || got[len(got)-1] == ' ') {
+			t.Fatalf("Query(%q) = %q is not trimmed", q, got)
+		}
+		_ = textnorm.Fold(got)
+	})
+}
+
+func FuzzSnippetAround(f *testing.F) {
+	f.Add("the Kubernetes operator reconciles state", "kubernetes", 20)
+	f.Add("Blåbærgrød med fløde på æbleskiver", "blabaergrod flode", 12)
+	f.Add("a b c d e f g h", "h", 1)
+	f.Fuzz(func(t *testing.T, text, query string, n int) {
+		n %= 500
+		got := snippet.Around(text, query, n)
+		if utf8.ValidString(text) && !utf8.ValidString(got) {
+			t.Fatalf("Around(%q, %q, %d) = %q is not valid UTF-8", text, query, n, got)
+		}
+		if n > 0 && utf8.RuneCountInString(got) > n {
+			t.Fatalf("Around(%q, %q, %d) = %q is longer than %d runes", text, query, n, got, n)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package tests
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	h "devops-valgfag/handlers"
@@ -84,3 +85,53 @@ func TestSearchPageHandler_WithQuery_OK(t *testing.T) {
 		t.Fatalf("expected non-empty body")
 	}
 }
+
+// With HX-Request the search page returns only the results fragment (no layout).
+func TestIntegration_SearchPagePartial(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "/search?q=welcome", nil)
+	req.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `id="search-results"`) {
+		t.Fatalf("expected results fragment, got %s", body)
+	}
+	if strings.Contains(body, "<html") {
+		t.Fatalf("expected fragment without layout, got %s", body)
+	}
+}
+
+// ?format=json returns the same JSON contract as /api/search.
+func TestIntegration_SearchPageJSON(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "/search?q=welcome&format=json", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("expected JSON, got Content-Type %s", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "search_results") {
+		t.Fatalf("expected search_results in body, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// With SEARCH_SHADOW=path every search also runs on the other path (here ILIKE behind the
+// SQLite FTS index) in the background; the comparison is counted, users get the FTS results.
+func TestSearchShadow_ComparesPaths(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	for _, p := range []struct{ title, url, content string }{
+		{"Harbour baths", "https://example.com/baths", "Swimming in the harbour of Copenhagen"},
+		{"Shipping containers", "https://example.com/containers", "Containers are shipped from the harbour"},
+	} {
+		if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES ($1, $2, 'en', $3)`, p.title, p.url, p.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cookies := registerAndLogin(t, router, "shadowuser", "secret123")
+
+	count := func(mode, result string) float64 {
+		return testutil.ToFloat64(metrics.SearchShadow.WithLabelValues(mode, result))
+	}
+	search := func(query string) []h.SearchResult {
+		t.Helper()
+		results := searchAPI(t, router, cookies, "q="+query+"&language=en")
+		h.WaitSearchShadow()
+		return results
+	}
+
+	h.SetSearchShadow(h.ShadowPath, 100)
+	defer h.SetSearchShadow(h.ShadowOff, 0)
+
+	same := count("path", "same")
+	if got := search("swimming"); len(got) != 1 || got[0].URL != "https://example.com/baths" {
+		t.Fatalf("unexpected results %v", resultURLs(got))
+	}
+	if count("path", "same") != same+1 {
+		t.Fatal("a search both paths answer alike must count as same")
+	}
+
+	// ILIKE matches substrings, FTS whole words: the shadow finds the containers page too,
+	// but the user still gets the FTS results.
+	diverged := count("path", "diverged")
+	if got := search("contain"); len(got) != 0 {
+		t.Fatalf("expected the FTS results (none), got %v", resultURLs(got))
+	}
+	if count("path", "diverged") != diverged+1 {
+		t.Fatal("a search only the shadow path answers must count as diverged")
+	}
+
+	// SQLite has a single FTS ranking, so there is nothing to compare; sample 0 shadows nothing.
+	h.SetSearchShadow(h.ShadowRanking, 100)
+	before := count("ranking", "same") + count("ranking", "diverged") + count("ranking", "reordered")
+	search("harbour")
+	if after := count("ranking", "same") + count("ranking", "diverged") + count("ranking", "reordered"); after != before {
+		t.Fatal("ranking shadow must not run on SQLite")
+	}
+	h.SetSearchShadow(h.ShadowPath, 0)
+	same = count("path", "same") + count("path", "reordered") + count("path", "diverged")
+	search("harbour")
+	if count("path", "same")+count("path", "reordered")+count("path", "diverged") != same {
+		t.Fatal("a 0% sample must not shadow")
+	}
+}
+
+// SEARCH_SHADOW and SEARCH_SHADOW_SAMPLE are reloadable and validated with the rest of the config.
+func TestSearchShadow_RuntimeConfig(t *testing.T) {
+	defer func() { _, _ = h.ApplyRuntimeConfig(h.RuntimeConfig{}) }()
+	if _, err := h.ApplyRuntimeConfig(h.RuntimeConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := h.ApplyRuntimeConfig(h.RuntimeConfig{SearchShadow: h.ShadowPath, SearchShadowSample: 10})
+	if err != nil || len(changed) != 2 || changed[0] != "SEARCH_SHADOW" || changed[1] != "SEARCH_SHADOW_SAMPLE" {
+		t.Fatalf("unexpected reload result %v (%v)", changed, err)
+	}
+	for _, bad := range []h.RuntimeConfig{
+		{SearchShadow: "sometimes"},
+		{SearchShadow: h.ShadowPath, SearchShadowSample: 101},
+		{SearchShadow: h.ShadowPath, SearchShadowSample: -1},
+	} {
+		if _, err := h.ApplyRuntimeConfig(bad); err == nil {
+			t.Errorf("%+v: expected an error", bad)
+		}
+	}
+	if _, err := h.ParseShadowMode("off"); err != nil {
+		t.Error(err)
+	}
+}
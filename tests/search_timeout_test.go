@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"modernc.org/sqlite"
+)
+
+// SQLite stand-in for Postgres set_config; records the settings applied by search queries.
+var fakeSettings = struct {
+	sync.Mutex
+	values map[string]string
+}{values: map[string]string{}}
+
+func init() {
+	sqlite.MustRegisterScalarFunction("set_config", 3, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		fakeSettings.Lock()
+		defer fakeSettings.Unlock()
+		name, _ := args[0].(string)
+		value, _ := args[1].(string)
+		fakeSettings.values[name] = value
+		return value, nil
+	})
+}
+
+// With a statement timeout configured, suggestions run in a transaction that sets it locally.
+func TestSearchStatementTimeout_AppliedPerQuery(t *testing.T) {
+	db := setupTestHandlers(t)
+	defer closeDB(t, db)
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES ('Timeout page', '/t', 'en', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+
+	h.SetSearchStatementTimeout(1500 * time.Millisecond)
+	defer h.SetSearchStatementTimeout(0)
+
+	if titles := suggestTitles(t, "timeout"); len(titles) != 1 {
+		t.Fatalf("expected one suggestion, got %v", titles)
+	}
+
+	fakeSettings.Lock()
+	got := fakeSettings.values["statement_timeout"]
+	fakeSettings.Unlock()
+	if got != "1500" {
+		t.Fatalf("expected statement_timeout 1500 (ms), got %q", got)
+	}
+}
+
+// A request whose client went away does not query the database and is counted as canceled.
+func TestSearchQuery_ClientDisconnect(t *testing.T) {
+	db := setupTestHandlers(t)
+	defer closeDB(t, db)
+
+	canceled := metrics.SearchQueriesCanceled.WithLabelValues("client_disconnect")
+	before := testutil.ToFloat64(canceled)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/suggest?q=go", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h.APISuggestHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if got := testutil.ToFloat64(canceled) - before; got != 1 {
+		t.Fatalf("expected one client_disconnect cancellation, got %v", got)
+	}
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/app"
+	"devops-valgfag/internal/dialect"
+)
+
+// The widget endpoint is public and cross-origin, and links results back absolutely.
+func TestSearchWidget(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetDialect(dialect.SQLite)
+	defer h.SetDialect(dialect.Postgres)
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES
+		('Widgetron basics', '/widgetron', 'en', 'Widgetron is a gadget for embedding search.'),
+		('Widgetron advanced', '/widgetron-2', 'en', 'More about widgetron.'),
+		('Widgetron på dansk', '/widgetron-da', 'da', 'Widgetron på dansk.')`); err != nil {
+		t.Fatal(err)
+	}
+	anon := adminClient(router, nil)
+
+	rr := anon(http.MethodGet, "/api/search/widget?q=widgetron&limit=1", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("expected a public CORS response, got %d %v: %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	var resp h.SearchWidgetResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || !strings.HasPrefix(resp.Results[0].Title, "Widgetron") {
+		t.Fatalf("expected one Widgetron result, got %+v", resp.Results)
+	}
+	if r := resp.Results[0]; !strings.HasPrefix(r.URL, "http://example.com/page/") || r.Snippet == "" {
+		t.Fatalf("expected an absolute page link and a snippet, got %+v", r)
+	}
+	if resp.More != "http://example.com/search?language=en&q=widgetron" {
+		t.Fatalf("unexpected more link %q", resp.More)
+	}
+	// The language came from the request headers, so shared caches must key on them.
+	if vary := rr.Header().Get("Vary"); vary != "Accept-Language, Cookie" {
+		t.Fatalf("expected Vary: Accept-Language, Cookie, got %q", vary)
+	}
+
+	rr = anon(http.MethodGet, "/api/search/widget?q=widgetron&language=da", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Results) != 1 {
+		t.Fatalf("expected the Danish page only, got %s (%v)", rr.Body.String(), err)
+	}
+	if vary := rr.Header().Get("Vary"); vary != "" {
+		t.Fatalf("expected no Vary with ?language=, got %q", vary)
+	}
+
+	rr = anon(http.MethodGet, "/api/search/widget", "")
+	var apiErr h.APIErrorResponse
+	if rr.Code != http.StatusBadRequest || json.Unmarshal(rr.Body.Bytes(), &apiErr) != nil || apiErr.Field != "q" {
+		t.Fatalf("expected 400 naming q, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The embeddable script is a static asset of the production router.
+	if rr := adminClient(app.NewRouter(), nil)(http.MethodGet, "/static/widget.js", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "/api/search/widget") {
+		t.Fatalf("expected the widget script, got %d", rr.Code)
+	}
+}
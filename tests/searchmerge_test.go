@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"slices"
+	"testing"
+
+	"devops-valgfag/internal/searchmerge"
+)
+
+func TestSearchMerge_Strategies(t *testing.T) {
+	local := []string{"L1", "L2", "L3", "L4", "L5"}
+	external := []string{"E1", "E2", "E3"}
+
+	cases := []struct {
+		name     string
+		policy   searchmerge.Policy
+		local    []string
+		external []string
+		limit    int
+		want     []string
+	}{
+		{"append without quota fills free slots", searchmerge.Policy{}, local[:3], external, 5, []string{"L1", "L2", "L3", "E1", "E2"}},
+		{"append without quota hides external", searchmerge.Policy{}, local, external, 5, []string{"L1", "L2", "L3", "L4", "L5"}},
+		{"append with quota", searchmerge.Policy{Strategy: searchmerge.Append, ExternalQuota: 2}, local, external, 5, []string{"L1", "L2", "L3", "E1", "E2"}},
+		{"interleave with quota", searchmerge.Policy{Strategy: searchmerge.Interleave, ExternalQuota: 2}, local, external, 5, []string{"L1", "E1", "L2", "E2", "L3"}},
+		{"interleave fills free slots", searchmerge.Policy{Strategy: searchmerge.Interleave}, local[:1], external, 4, []string{"L1", "E1", "E2", "E3"}},
+		{"score", searchmerge.Policy{Strategy: searchmerge.Score, ExternalQuota: 3}, local, external, 6, []string{"L1", "L2", "E1", "L3", "E2", "E3"}},
+		{"quota capped by limit", searchmerge.Policy{ExternalQuota: 10}, local, external, 2, []string{"E1", "E2"}},
+		{"no external results", searchmerge.Policy{ExternalQuota: 2}, local, nil, 3, []string{"L1", "L2", "L3"}},
+	}
+	for _, c := range cases {
+		if got := searchmerge.Merge(c.policy, c.local, c.external, c.limit); !slices.Equal(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	if (searchmerge.Policy{}).WantsExternal(5, 5) || !(searchmerge.Policy{ExternalQuota: 1}).WantsExternal(5, 5) {
+		t.Error("external results are only worth fetching with free slots or a quota")
+	}
+	if _, err := searchmerge.ParseStrategy("random"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"devops-valgfag/internal/secrets"
+)
+
+func TestSecrets_Files(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "session_key")
+	if err := os.WriteFile(file, []byte("from-a-mounted-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SESSION_KEY", "")
+	t.Setenv("SESSION_KEY_FILE", file)
+
+	applied, err := secrets.Apply(context.Background(), []string{"SESSION_KEY"}, secrets.Files{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("SESSION_KEY"); got != "from-a-mounted-secret" {
+		t.Fatalf("SESSION_KEY = %q", got)
+	}
+	if applied["SESSION_KEY"] != "file" {
+		t.Fatalf("expected SESSION_KEY from file, got %v", applied)
+	}
+
+	// SESSION_KEY is now set as well as SESSION_KEY_FILE: ambiguous.
+	if _, err := secrets.Apply(context.Background(), []string{"SESSION_KEY"}, secrets.Files{}); err == nil {
+		t.Fatal("expected an error when both KEY and KEY_FILE are set")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DMI_API_KEY", "")
+	t.Setenv("DMI_API_KEY_FILE", empty)
+	if _, err := secrets.Apply(context.Background(), []string{"DMI_API_KEY"}, secrets.Files{}); err == nil {
+		t.Fatal("expected an error for an empty secret file")
+	}
+}
+
+func TestSecrets_Vault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/whoknows" || r.Header.Get("X-Vault-Token") != "s.test" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"data":{"POSTGRES_PASSWORD":"pg-secret","dmi_api_key":"dmi-secret"},"metadata":{"version":3}}}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("POSTGRES_PASSWORD", "")
+	t.Setenv("DMI_API_KEY", "")
+	t.Setenv("SMTP_PASSWORD", "")
+	t.Setenv("REDIS_URL", "redis://from-env:6379/0")
+
+	keys := []string{"POSTGRES_PASSWORD", "DMI_API_KEY", "SMTP_PASSWORD", "REDIS_URL"}
+	vault := secrets.NewVault(srv.URL, "s.test", "/secret/data/whoknows", srv.Client())
+	applied, err := secrets.Apply(context.Background(), keys, secrets.Files{}, vault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv("POSTGRES_PASSWORD") != "pg-secret" || os.Getenv("DMI_API_KEY") != "dmi-secret" {
+		t.Fatalf("secrets not applied: %v", applied)
+	}
+	if os.Getenv("SMTP_PASSWORD") != "" || os.Getenv("REDIS_URL") != "redis://from-env:6379/0" {
+		t.Fatal("keys missing from Vault or set in the environment must be left alone")
+	}
+	if len(applied) != 2 || applied["POSTGRES_PASSWORD"] != "vault" {
+		t.Fatalf("unexpected applied keys %v", applied)
+	}
+
+	t.Setenv("POSTGRES_PASSWORD", "")
+	denied := secrets.NewVault(srv.URL, "wrong", "secret/data/whoknows", srv.Client())
+	if _, err := secrets.Apply(context.Background(), keys, denied); err == nil {
+		t.Fatal("expected an error when Vault rejects the token")
+	}
+}
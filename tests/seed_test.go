@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"devops-valgfag/internal/seed"
+)
+
+// Generated data lands in the schema, is searchable, the demo users can log in, and a second
+// run only inserts what is new.
+func TestSeed_GeneratesAndReruns(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	ctx := context.Background()
+
+	opts := seed.Options{Pages: 40, Users: 2, External: 10, Seed: 7}
+	reports, err := seed.Run(ctx, db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"users": 2, "pages": 40, "external_results": 10}
+	for _, r := range reports {
+		if r.Inserted != want[r.Table] || r.Skipped != 0 {
+			t.Errorf("%s: %+v, want %d inserted", r.Table, r, want[r.Table])
+		}
+	}
+
+	var da, admins int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pages WHERE language = 'da' AND url LIKE '/seed/da/%'`).Scan(&da); err != nil || da != 20 {
+		t.Fatalf("expected the pages split between en and da, got %d Danish (%v)", da, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE username LIKE 'demo%' AND is_admin`).Scan(&admins); err != nil || admins != 1 {
+		t.Fatalf("expected demo1 to be the only admin, got %d (%v)", admins, err)
+	}
+
+	form := url.Values{"username": {"demo2"}, "password": {seed.DefaultPassword}}
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("demo user login: expected 302, got %d", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	var title string
+	if err := db.QueryRow(`SELECT title FROM pages WHERE url = '/seed/en/1'`).Scan(&title); err != nil {
+		t.Fatal(err)
+	}
+	topic, _, _ := strings.Cut(title, ":")
+	if results := searchAPI(t, router, cookies, "q="+url.QueryEscape(topic)+"&language=en"); len(results) == 0 {
+		t.Fatalf("expected seeded pages to match %q", topic)
+	}
+
+	opts.Pages = 50
+	if reports, err = seed.Run(ctx, db, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reports {
+		if r.Table == "pages" && (r.Inserted != 10 || r.Skipped != 40) {
+			t.Errorf("re-run with more pages: %+v, want 10 inserted and 40 skipped", r)
+		}
+		if r.Table != "pages" && r.Inserted != 0 {
+			t.Errorf("re-run: %+v, want nothing new", r)
+		}
+	}
+
+	if _, err := seed.Run(ctx, db, seed.Options{Pages: 1, Languages: []string{"sv"}}); err == nil {
+		t.Fatal("expected an unsupported language to fail")
+	}
+}
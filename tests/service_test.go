@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/apperror"
+	"devops-valgfag/internal/searchmerge"
+	"devops-valgfag/internal/service"
+)
+
+// The services run against in-memory fakes: no database, no HTTP.
+
+type memUserStore struct {
+	mu     sync.Mutex
+	users  map[string]service.User
+	logins int
+}
+
+func (s *memUserStore) UserByUsername(_ context.Context, username string) (service.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return service.User{}, service.ErrNotFound
+	}
+	return u, nil
+}
+
+func (s *memUserStore) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	_, err := s.UserByUsername(ctx, username)
+	return err == nil, nil
+}
+
+func (s *memUserStore) CreateUser(_ context.Context, u service.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.ID = len(s.users) + 1
+	s.users[u.Username] = u
+	return nil
+}
+
+func (s *memUserStore) RecordLogin(context.Context, int, time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logins++
+	return nil
+}
+
+func (s *memUserStore) SetPasswordHash(_ context.Context, userID int, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, u := range s.users {
+		if u.ID == userID {
+			u.PasswordHash = hash
+			s.users[name] = u
+		}
+	}
+	return nil
+}
+
+func TestAuthService_RegisterAndLogin(t *testing.T) {
+	store := &memUserStore{users: map[string]service.User{}}
+	auth := &service.AuthService{Users: store}
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		in   service.Registration
+		kind apperror.Kind
+	}{
+		{service.Registration{Username: "alice", Password: "pw", Password2: "pw"}, apperror.Invalid},
+		{service.Registration{Username: "alice", Email: "a@example.com", Password: "pw", Password2: "other"}, apperror.Invalid},
+	} {
+		if err := auth.Register(ctx, c.in); apperror.KindOf(err) != c.kind {
+			t.Errorf("register %+v: expected %s, got %v", c.in, c.kind, err)
+		}
+	}
+
+	reg := service.Registration{Username: "alice", Email: "a@example.com", Password: "secret", Password2: "secret", Status: service.UserStatusActive}
+	if err := auth.Register(ctx, reg); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := auth.Register(ctx, reg); apperror.KindOf(err) != apperror.Conflict {
+		t.Fatalf("expected a taken username to conflict, got %v", err)
+	}
+	if store.users["alice"].PasswordHash == "secret" {
+		t.Fatal("the password must be stored hashed")
+	}
+
+	u, err := auth.Login(ctx, "alice", "secret")
+	if err != nil || u.Username != "alice" || store.logins != 1 {
+		t.Fatalf("login: user %+v, err %v, logins %d", u, err, store.logins)
+	}
+	if _, err := auth.Login(ctx, "alice", "wrong"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Errorf("wrong password: expected invalid credentials, got %v", err)
+	}
+	if _, err := auth.Login(ctx, "bob", "secret"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Errorf("unknown user: expected invalid credentials, got %v", err)
+	}
+
+	reg.Username, reg.Status = "carol", service.UserStatusPending
+	if err := auth.Register(ctx, reg); err != nil {
+		t.Fatalf("register pending: %v", err)
+	}
+	if _, err := auth.Login(ctx, "carol", "secret"); !errors.Is(err, service.ErrAccountPending) {
+		t.Errorf("pending account: expected %v, got %v", service.ErrAccountPending, err)
+	}
+	if _, err := auth.Login(ctx, "carol", "wrong"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Errorf("the account state must only show after a correct password, got %v", err)
+	}
+}
+
+type fakeSearchBackend struct {
+	mu       sync.Mutex
+	local    []service.SearchResult
+	external []service.SearchResult
+	err      error
+	degraded bool
+	queries  []string
+	logged   int
+}
+
+func (b *fakeSearchBackend) Local(_ context.Context, q service.SearchQuery) ([]service.SearchResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queries = append(b.queries, q.Query)
+	if b.err != nil {
+		return nil, b.err
+	}
+	return append([]service.SearchResult(nil), b.local...), nil
+}
+
+func (b *fakeSearchBackend) External(context.Context, service.SearchQuery) []service.SearchResult {
+	return b.external
+}
+
+func (b *fakeSearchBackend) ExternalEnabled() bool { return true }
+
+func (b *fakeSearchBackend) MergePolicy(context.Context) searchmerge.Policy {
+	return searchmerge.Policy{}
+}
+
+func (b *fakeSearchBackend) CacheScope(context.Context) string { return "" }
+
+func (b *fakeSearchBackend) Degraded() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.degraded
+}
+
+func (b *fakeSearchBackend) QueryFailed(context.Context, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.degraded = true
+}
+
+func (b *fakeSearchBackend) LogSearch(context.Context, string, string, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.logged++
+}
+
+type memSearchCache struct {
+	entries map[string][]service.SearchResult
+	fresh   bool
+}
+
+func (c *memSearchCache) Get(_ context.Context, key string) ([]service.SearchResult, bool, bool) {
+	r, ok := c.entries[key]
+	return r, ok && c.fresh, ok
+}
+
+func (c *memSearchCache) Set(_ context.Context, key string, results []service.SearchResult) {
+	c.entries[key] = results
+}
+
+func TestSearchService_CacheAndDegradedMode(t *testing.T) {
+	backend := &fakeSearchBackend{
+		local:    []service.SearchResult{{ID: 1, Title: "Go", URL: "https://example.com/go"}},
+		external: []service.SearchResult{{Title: "Go (wiki)", URL: "https://example.com/go"}, {Title: "Golang", URL: "https://wiki.example/golang"}},
+	}
+	cache := &memSearchCache{entries: map[string][]service.SearchResult{}, fresh: true}
+	s := &service.SearchService{Backend: backend, Cache: cache, Timeout: time.Second}
+	ctx := context.Background()
+
+	if got := s.Search(ctx, service.SearchQuery{Query: "  ", Language: "en", Limit: 10}); len(got) != 0 || len(backend.queries) != 0 {
+		t.Fatalf("an empty query must not search, got %v", got)
+	}
+
+	q := service.SearchQuery{Query: "  GO ", Language: "en", Limit: 10, IncludeExternal: true}
+	got := s.Search(ctx, q)
+	if len(got) != 2 || got[0].ID != 1 || got[1].URL != "https://wiki.example/golang" {
+		t.Fatalf("expected the local result plus the one new external URL, got %+v", got)
+	}
+	if backend.queries[0] != "go" || backend.logged != 1 {
+		t.Fatalf("expected the normalised query to be searched and logged, got %v (logged %d)", backend.queries, backend.logged)
+	}
+
+	s.Search(ctx, q)
+	if len(backend.queries) != 1 {
+		t.Fatalf("a fresh cache entry must answer without the backend, got %d lookups", len(backend.queries))
+	}
+
+	// Stale entries are only served once the database fails.
+	cache.fresh = false
+	backend.err = errors.New("connection refused")
+	if got := s.Search(ctx, q); len(got) != 2 || !backend.Degraded() {
+		t.Fatalf("expected the stale results in degraded mode, got %+v", got)
+	}
+	if got := s.Search(ctx, service.SearchQuery{Query: "rust", Language: "en", Limit: 10}); len(got) != 0 || len(backend.queries) != 2 {
+		t.Fatalf("degraded mode without a cache entry must answer empty without a lookup, got %+v (%d lookups)", got, len(backend.queries))
+	}
+}
+
+type fakeForecast struct {
+	data  *service.EDRFeatureCollection
+	err   error
+	calls int
+}
+
+func (f *fakeForecast) Forecast(context.Context, float64, float64) (*service.EDRFeatureCollection, error) {
+	f.calls++
+	return f.data, f.err
+}
+
+func TestWeatherService_CacheAndValidation(t *testing.T) {
+	provider := &fakeForecast{data: &service.EDRFeatureCollection{Features: []service.EDRFeature{{
+		Geometry:   service.EDRGeometry{Coordinates: []float64{12.561, 55.715}},
+		Properties: service.EDRProperties{Temperature: 11.5},
+	}}}}
+	weather := &service.WeatherService{Provider: provider, TTL: time.Minute}
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := weather.Copenhagen(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if provider.calls != 1 {
+		t.Fatalf("expected the Copenhagen forecast to be cached, got %d fetches", provider.calls)
+	}
+
+	data, _ := weather.Copenhagen(ctx)
+	if cur, err := service.Current(data); err != nil || cur.Properties.Temperature != 11.5 {
+		t.Fatalf("current: %+v, %v", cur, err)
+	}
+	for _, c := range []struct {
+		data *service.EDRFeatureCollection
+		msg  string
+	}{
+		{nil, service.WeatherUnavailableMsg},
+		{&service.EDRFeatureCollection{}, service.WeatherUnavailableMsg},
+		{&service.EDRFeatureCollection{Features: []service.EDRFeature{{}}}, service.WeatherDataIncompleteMsg},
+	} {
+		_, err := service.Current(c.data)
+		if apperror.KindOf(err) != apperror.Unavailable || err.Error() != c.msg {
+			t.Errorf("%+v: expected unavailable %q, got %v", c.data, c.msg, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"devops-valgfag/internal/app"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	testSessionKey = "session-signing-key-0123456789-abcdef"
+	testEncKey     = "0123456789abcdef0123456789abcdef"
+)
+
+func sessionConfig(t *testing.T, env map[string]string) (app.Config, error) {
+	t.Helper()
+	env["DB_DRIVER"] = "sqlite"
+	return app.ConfigFromEnv(func(key string) string { return env[key] })
+}
+
+// saveSession writes a session holding user_id with store and returns its cookie.
+func saveSession(t *testing.T, store sessions.Store, userID int) *http.Cookie {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	sess, _ := store.New(req, "session")
+	sess.Values["user_id"] = userID
+	rec := httptest.NewRecorder()
+	if err := sess.Save(req, rec); err != nil {
+		t.Fatal(err)
+	}
+	return findCookie(rec.Result().Cookies(), "session")
+}
+
+// readsUserID reports whether the cookie's payload shows user_id in the clear (a signed-only
+// securecookie is base64(date|base64(gob)|mac)).
+func readsUserID(t *testing.T, c *http.Cookie) bool {
+	t.Helper()
+	outer, err := base64.URLEncoding.DecodeString(c.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := bytes.SplitN(outer, []byte("|"), 3)
+	payload, err := base64.URLEncoding.DecodeString(string(parts[1]))
+	return err == nil && bytes.Contains(payload, []byte("user_id"))
+}
+
+func TestSessionKeys_Config(t *testing.T) {
+	env := map[string]string{"SESSION_KEY": testSessionKey, "APP_ENV": "prod"}
+	if _, err := sessionConfig(t, env); err == nil || !strings.Contains(err.Error(), "SESSION_ENC_KEY") {
+		t.Fatalf("prod without SESSION_ENC_KEY: expected an error, got %v", err)
+	}
+	env["SESSION_ENC_KEY"] = "too-short"
+	if _, err := sessionConfig(t, env); err == nil {
+		t.Fatal("expected an error for an invalid AES key length")
+	}
+	env["SESSION_ENC_KEY"] = testEncKey
+	cfg, err := sessionConfig(t, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.SessionKeyPairs) != 2 || string(cfg.SessionKeyPairs[1]) != testEncKey {
+		t.Fatalf("unexpected key pairs: %q", cfg.SessionKeyPairs)
+	}
+
+	// A previous encryption key alone reuses SESSION_KEY for signing.
+	env["SESSION_ENC_KEY_PREVIOUS"] = "fedcba9876543210"
+	if cfg, err = sessionConfig(t, env); err != nil || len(cfg.SessionKeyPairs) != 4 || string(cfg.SessionKeyPairs[2]) != testSessionKey {
+		t.Fatalf("previous pair: %q, %v", cfg.SessionKeyPairs, err)
+	}
+}
+
+// Cookies are encrypted; after a rotation (or when encryption is turned on) the cookies
+// written with the previous keys are still read, while unknown keys are rejected.
+func TestSessionKeys_EncryptionAndRotation(t *testing.T) {
+	oldCfg, err := sessionConfig(t, map[string]string{"SESSION_KEY": testSessionKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStore := sessions.NewCookieStore(oldCfg.SessionKeyPairs...)
+	legacy := saveSession(t, oldStore, 42)
+	if !readsUserID(t, legacy) {
+		t.Fatal("expected the signed-only cookie to expose user_id (sanity check)")
+	}
+
+	cfg, err := sessionConfig(t, map[string]string{
+		"SESSION_KEY":          "rotated-signing-key-0123456789-abcdef",
+		"SESSION_ENC_KEY":      testEncKey,
+		"SESSION_KEY_PREVIOUS": testSessionKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := sessions.NewCookieStore(cfg.SessionKeyPairs...)
+	if fresh := saveSession(t, store, 42); readsUserID(t, fresh) {
+		t.Fatal("expected the cookie to be encrypted")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(legacy)
+	sess, err := store.Get(req, "session")
+	if err != nil || sess.Values["user_id"] != 42 {
+		t.Fatalf("expected the previous keys to read the old cookie, got %v (%v)", sess.Values, err)
+	}
+
+	stranger := sessions.NewCookieStore([]byte("someone-elses-key"), []byte(testEncKey))
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(saveSession(t, stranger, 1))
+	if _, err := sessions.NewCookieStore(cfg.SessionKeyPairs...).Get(req, "session"); err == nil {
+		t.Fatal("expected a cookie signed with an unknown key to be rejected")
+	}
+}
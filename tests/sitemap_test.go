@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// The sitemap lists every page with an absolute URL built from the request host.
+func TestSitemapHandler_ListsPages(t *testing.T) {
+	_, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	status, err := h.RegenerateSitemap(context.Background())
+	if err != nil {
+		t.Fatalf("RegenerateSitemap failed: %v", err)
+	}
+	if status.URLs != 2 || status.Files != 1 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://whoknows.test/sitemap.xml", nil)
+	rec := httptest.NewRecorder()
+	h.SitemapHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "<urlset") {
+		t.Fatalf("expected <urlset>, got %s", body)
+	}
+	if !strings.Contains(body, "<loc>http://whoknows.test/welcome</loc>") {
+		t.Fatalf("expected absolute page URL, got %s", body)
+	}
+}
+
+// Admin endpoints must reject anonymous users.
+func TestAdminRegenerateSitemap_RequiresLogin(t *testing.T) {
+	_, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/sitemap", nil)
+	rec := httptest.NewRecorder()
+	h.RequireAdmin(h.AdminRegenerateSitemapHandler)(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+}
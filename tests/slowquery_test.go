@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/slowquery"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSlowQuery_SanitizeArgs(t *testing.T) {
+	got := slowquery.SanitizeArgs(`SELECT id FROM pages WHERE language = $1 AND title ILIKE $2 LIMIT $3`,
+		[]any{"en", strings.Repeat("x", 60), 10, nil, []byte("abc")})
+	want := `["en", "` + strings.Repeat("x", 40) + `...", 10, NULL, <3 bytes>]`
+	if got != want {
+		t.Fatalf("unexpected args:\n got %s\nwant %s", got, want)
+	}
+
+	got = slowquery.SanitizeArgs(`UPDATE users SET password = $1 WHERE username = $2`, []any{"$2a$10$hash", "alice"})
+	if got != `[[redacted], [redacted]]` {
+		t.Fatalf("expected credentials to be redacted, got %s", got)
+	}
+}
+
+// Only queries at or over the threshold are logged and counted.
+func TestSlowQuery_TracerThreshold(t *testing.T) {
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(prev)
+
+	tr := slowquery.New(slowquery.Options{Pool: "test", Threshold: 20 * time.Millisecond})
+	counter := metrics.SlowQueries.WithLabelValues("test")
+	before := testutil.ToFloat64(counter)
+
+	run := func(d time.Duration) {
+		ctx := tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+			SQL:  "SELECT *\n  FROM pages\n  WHERE id = $1",
+			Args: []any{42},
+		})
+		time.Sleep(d)
+		tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	}
+
+	run(0)
+	if got := testutil.ToFloat64(counter) - before; got != 0 {
+		t.Fatalf("expected fast query not to be counted, got %v", got)
+	}
+
+	run(30 * time.Millisecond)
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("expected one slow query, got %v", got)
+	}
+	if !strings.Contains(buf.String(), "SELECT * FROM pages WHERE id = $1 args=[42]") {
+		t.Fatalf("expected slow query log line, got %q", buf.String())
+	}
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/snippet"
+)
+
+func TestSnippet_TruncateAndAround(t *testing.T) {
+	danish := strings.Repeat("Blåbærgrød med fløde på æbleskiver. ", 20)
+	for n := 10; n <= 120; n += 7 {
+		got := snippet.Truncate(danish, n)
+		if !utf8.ValidString(got) || utf8.RuneCountInString(got) > n || !strings.HasSuffix(got, snippet.Ellipsis) {
+			t.Fatalf("Truncate(n=%d) = %q", n, got)
+		}
+	}
+	if got := snippet.Truncate("  short \n text ", 50); got != "short text" {
+		t.Fatalf("short text should only be collapsed, got %q", got)
+	}
+
+	text := strings.Repeat("filler words here ", 30) + "the Kubernetes operator reconciles state " + strings.Repeat("trailing words ", 30)
+	got := snippet.Around(text, "kubernetes", 80)
+	if !strings.Contains(got, "Kubernetes operator") || !strings.HasPrefix(got, snippet.Ellipsis) ||
+		!strings.HasSuffix(got, snippet.Ellipsis) || utf8.RuneCountInString(got) > 80 {
+		t.Fatalf("expected a window around the match, got %q", got)
+	}
+	if i := strings.Index(got, "Kubernetes"); i < 10 || i > 50 {
+		t.Fatalf("match should sit about a third into the snippet, at %d in %q", i, got)
+	}
+
+	// The words of a query are tried when the phrase does not occur; without a match the
+	// snippet is the start of the text.
+	if got := snippet.Around(text, "helm kubernetes", 80); !strings.Contains(got, "Kubernetes") {
+		t.Fatalf("expected a match on a query word, got %q", got)
+	}
+	if got := snippet.Around(text, "nomatch", 40); !strings.HasPrefix(got, "filler words") {
+		t.Fatalf("expected the start of the text, got %q", got)
+	}
+	// A match near the end shows the end of the text without a trailing ellipsis.
+	if got := snippet.Around(text+" final ÆØÅ", "æøå", 60); !strings.HasSuffix(got, "final ÆØÅ") || !utf8.ValidString(got) {
+		t.Fatalf("expected the end of the text, got %q", got)
+	}
+}
+
+// ?snippet_length= picks the snippet length within bounds.
+func TestSnippet_LengthParam(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	content := strings.Repeat("Rødgrød med fløde og æbler. ", 40)
+	res, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES ('Dessert', '/dessert', 'en', ?)`, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	cookies := registerAndLogin(t, router, "cook", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'cook'`); err != nil {
+		t.Fatal(err)
+	}
+	client := adminClient(router, cookies)
+	if rr := client(http.MethodPut, "/api/pages/"+strconv.Itoa(int(id))+"/tags", `{"tags":["food"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	for _, tc := range []struct {
+		param string
+		max   int
+	}{
+		{"", 200},
+		{"&snippet_length=80", 80},
+		{"&snippet_length=5", 50},
+		{"&snippet_length=100000", 500},
+		{"&snippet_length=abc", 200},
+	} {
+		rr := client(http.MethodGet, "/api/search?tag=food"+tc.param, "")
+		var out h.APISearchResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil || len(out.SearchResults) != 1 {
+			t.Fatalf("%q: unexpected response (%d): %s", tc.param, rr.Code, rr.Body.String())
+		}
+		d := out.SearchResults[0].Description
+		if n := utf8.RuneCountInString(d); n > tc.max || n < tc.max-tc.max/5-1 || !utf8.ValidString(d) || !strings.HasSuffix(d, snippet.Ellipsis) {
+			t.Fatalf("%q: expected a snippet of up to %d runes, got %d: %q", tc.param, tc.max, n, d)
+		}
+	}
+}
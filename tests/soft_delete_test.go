@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/scheduler"
+)
+
+func loginStatus(router http.Handler, username, password string) int {
+	form := url.Values{}
+	form.Set("username", username)
+	form.Set("password", password)
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+// Deleted users cannot log in and deleted pages leave search suggestions, until an admin restores them.
+func TestSoftDelete_DeleteListRestore(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "trashadmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'trashadmin'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+	registerAndLogin(t, router, "victim", "secret")
+	adminRequest := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var adminID, victimID, pageID int
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'trashadmin'`).Scan(&adminID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'victim'`).Scan(&victimID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT id FROM pages WHERE title = 'Welcome'`).Scan(&pageID); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := adminRequest(http.MethodDelete, "/admin/users/"+strconv.Itoa(adminID)); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when deleting own account, got %d", rr.Code)
+	}
+	if rr := adminRequest(http.MethodDelete, "/admin/users/"+strconv.Itoa(victimID)); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := adminRequest(http.MethodDelete, "/admin/users/"+strconv.Itoa(victimID)); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for already deleted user, got %d", rr.Code)
+	}
+	if code := loginStatus(router, "victim", "secret"); code == http.StatusFound {
+		t.Fatal("deleted user could still log in")
+	}
+
+	if rr := adminRequest(http.MethodDelete, "/admin/pages/"+strconv.Itoa(pageID)); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, title := range suggestTitles(t, "wel") {
+		if title == "Welcome" {
+			t.Fatal("deleted page still suggested")
+		}
+	}
+
+	rr := adminRequest(http.MethodGet, "/admin/users/deleted")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var list h.AdminDeletedResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(list.Items) != 1 || list.Items[0].Name != "victim" || !list.Items[0].PurgeAfter.After(list.Items[0].DeletedAt) {
+		t.Fatalf("unexpected deleted users: %+v", list)
+	}
+
+	if rr := adminRequest(http.MethodPost, "/admin/users/"+strconv.Itoa(victimID)+"/restore"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if code := loginStatus(router, "victim", "secret"); code != http.StatusFound {
+		t.Fatalf("restored user cannot log in, got %d", code)
+	}
+	if rr := adminRequest(http.MethodPost, "/admin/pages/"+strconv.Itoa(pageID)+"/restore"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if titles := suggestTitles(t, "wel"); len(titles) != 1 || titles[0] != "Welcome" {
+		t.Fatalf("expected restored page in suggestions, got %v", titles)
+	}
+}
+
+// Rows deleted longer ago than the retention cannot be restored and are purged.
+func TestSoftDelete_RetentionAndPurge(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	cookies := registerAndLogin(t, router, "purgeadmin", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'purgeadmin'`); err != nil {
+		t.Fatalf("failed to promote admin: %v", err)
+	}
+
+	h.SetSoftDeleteRetention(time.Hour)
+	defer h.SetSoftDeleteRetention(0)
+
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	if _, err := db.Exec(`UPDATE pages SET deleted_at = $1 WHERE title = 'Welcome'`, old); err != nil {
+		t.Fatal(err)
+	}
+	var pageID int
+	if err := db.QueryRow(`SELECT id FROM pages WHERE title = 'Welcome'`).Scan(&pageID); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/pages/"+strconv.Itoa(pageID)+"/restore", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 past the retention window, got %d", rr.Code)
+	}
+
+	s := scheduler.New(scheduler.Options{Enabled: true})
+	h.RegisterScheduledTasks(s, h.ScheduleConfig{SitemapRefresh: time.Hour, SavedSearchInterval: time.Hour})
+	if ok, err := s.RunNow(context.Background(), h.TaskPurgeDeleted); !ok || err != nil {
+		t.Fatalf("purge_deleted: ran=%v err=%v", ok, err)
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pages WHERE id = $1`, pageID).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatal("expected page to be purged")
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE username = 'purgeadmin'`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("purge removed a live user (count=%d err=%v)", n, err)
+	}
+}
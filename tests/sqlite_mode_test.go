@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/dialect"
+	"devops-valgfag/internal/migrate"
+
+	"github.com/gorilla/sessions"
+)
+
+// setupSQLiteMode points the handlers at a file database migrated with migrations/sqlite, as
+// cmd/server does with DB_DRIVER=sqlite, and routes through setupTestServer's router. FTS is on.
+func setupSQLiteMode(t *testing.T) (http.Handler, *sql.DB) {
+	t.Helper()
+	router, testDB := setupTestServer(t)
+	t.Cleanup(func() { closeDB(t, testDB) })
+
+	db, err := dialect.OpenSQLite(filepath.Join(t.TempDir(), "whoknows.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeDB(t, db) })
+
+	t.Chdir("..") // migrations/sqlite is relative to the repo root, like in the container
+	if err := migrate.RunSQLiteMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same cookie key as setupTestServer, so the router's sessions stay valid.
+	h.Init(db, nil, sessions.NewCookieStore([]byte("test-key")))
+	h.SetDialect(dialect.SQLite)
+	h.EnableFTSSearch(true)
+	t.Cleanup(func() {
+		h.SetDialect(dialect.Postgres)
+		h.EnableFTSSearch(false)
+	})
+	return router, db
+}
+
+// searchAPI runs GET /api/search?<query> as the given session and decodes the results.
+func searchAPI(t *testing.T, router http.Handler, cookies []*http.Cookie, query string) []h.SearchResult {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/search?"+query, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: expected 200, got %d: %s", query, rec.Code, rec.Body.String())
+	}
+	var resp h.APISearchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.SearchResults
+}
+
+// DB_DRIVER=sqlite: the SQLite migrations apply (and re-apply) on a file database, the app
+// runs on it, and SEARCH_FTS uses the FTS5 index, accent-insensitive like f_unaccent on PostgreSQL.
+func TestSQLiteMode_MigrationsAndFTSSearch(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	if err := migrate.RunSQLiteMigrations(db); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO pages (title, url, language, content) VALUES ('Café culture', 'https://example.com/cafe', 'en', 'Coffee houses and their history')`); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := registerAndLogin(t, router, "sqliteuser", "secret123")
+	results := searchAPI(t, router, cookies, "q=cafe&language=en")
+	if len(results) == 0 || results[0].Title != "Café culture" {
+		t.Fatalf("expected the accented page for \"cafe\", got %+v", results)
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/scheduler"
+)
+
+// Searches are logged anonymously, rolled up by stats_rollup and published on /api/stats and
+// /stats; enforce_retention prunes the raw log after a week.
+func TestStats_RollupAndPublicPage(t *testing.T) {
+	router, db := setupSQLiteMode(t)
+	seedFTSPages(t, db)
+
+	s := scheduler.New(scheduler.Options{Enabled: true})
+	h.RegisterScheduledTasks(s, h.ScheduleConfig{SitemapRefresh: time.Hour, SavedSearchInterval: time.Hour})
+	h.SetScheduler(s)
+	defer h.SetScheduler(nil)
+
+	old := time.Now().UTC().AddDate(0, 0, -10).Format(time.DateOnly)
+	if _, err := db.Exec(`INSERT INTO search_log (day, query_hash, language, results) VALUES ($1, 'x', 'en', 1)`, old); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := registerAndLogin(t, router, "statsuser", "secret123")
+	for _, query := range []string{
+		"q=zymurgy&language=en",
+		"q=Zymurgy&language=en",
+		"q=nothingmatches&language=en",
+		"q=zymurgy&language=da",
+	} {
+		searchAPI(t, router, cookies, query)
+	}
+	var logged int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM search_log WHERE query_hash LIKE '%zymurgy%'`).Scan(&logged); err != nil || logged != 0 {
+		t.Fatalf("the search log must not contain query text, got %d (%v)", logged, err)
+	}
+
+	adminCookies := registerAndLogin(t, router, "statsadmin", "secret123")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'statsadmin'`); err != nil {
+		t.Fatal(err)
+	}
+	if rr := adminClient(router, adminCookies)(http.MethodPost, "/admin/scheduler/"+h.TaskStatsRollup+"/run", ""); rr.Code != http.StatusOK {
+		t.Fatalf("run rollup: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := adminClient(router, adminCookies)(http.MethodPost, "/admin/scheduler/"+h.TaskEnforceRetention+"/run", ""); rr.Code != http.StatusOK {
+		t.Fatalf("run retention: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var users int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM search_log WHERE day = $1`, old).Scan(&logged); err != nil || logged != 0 {
+		t.Fatalf("expected old search log rows to be pruned, got %d (%v)", logged, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stats?days=7", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("api stats: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if cc := rr.Header().Get("Cache-Control"); !strings.Contains(cc, "public") {
+		t.Fatalf("expected a public Cache-Control, got %q", cc)
+	}
+	var stats h.StatsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Days) != 2 {
+		t.Fatalf("expected yesterday and today, got %+v", stats.Days)
+	}
+	today := stats.Days[1]
+	if today.Day != time.Now().UTC().Format(time.DateOnly) || today.Searches != 4 || today.UniqueQueries != 2 ||
+		today.SearchesWithResults != 3 || today.HitRate != 0.75 || today.NewUsers != users {
+		t.Fatalf("unexpected stats for today: %+v (users %d)", today, users)
+	}
+	if stats.Totals.Searches != 4 || stats.Totals.NewUsers != users {
+		t.Fatalf("unexpected totals: %+v", stats.Totals)
+	}
+	if len(stats.TopLanguages) != 2 || stats.TopLanguages[0].Language != "en" || stats.TopLanguages[0].Share != 0.75 {
+		t.Fatalf("unexpected languages: %+v", stats.TopLanguages)
+	}
+}
+
+// /stats draws the rollup as bar charts, scaled to the busiest day.
+func TestStats_PageCharts(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	get := func() string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/stats", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("stats page: expected 200, got %d", rr.Code)
+		}
+		return rr.Body.String()
+	}
+	if body := get(); strings.Contains(body, `class="bar-chart"`) {
+		t.Fatal("expected no charts without statistics")
+	}
+
+	today := time.Now().UTC()
+	for i, searches := range []int{10, 40} {
+		day := today.AddDate(0, 0, i-1).Format(time.DateOnly)
+		if _, err := db.Exec(`INSERT INTO stats_daily (day, searches, unique_queries, searches_with_results, new_users) VALUES ($1, $2, $2, $2, 1)`, day, searches); err != nil {
+			t.Fatal(err)
+		}
+	}
+	body := get()
+	if !strings.Contains(body, `class="bar-chart"`) || !strings.Contains(body, "width: 25%") || !strings.Contains(body, "width: 100%") {
+		t.Fatalf("expected scaled bar charts, got:\n%s", body)
+	}
+}
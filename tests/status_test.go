@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// The status page combines dependency checks with the incidents admins post; resolving an
+// incident moves it to the history.
+func TestStatus_ComponentsAndIncidents(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	h.SetStatusChecks(h.StatusCheck{Name: "redis", Check: func(context.Context) error { return errors.New("connection refused") }})
+	defer h.SetStatusChecks()
+
+	status := func() h.StatusResponse {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status: expected 200, got %d", rr.Code)
+		}
+		var resp h.StatusResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	component := func(resp h.StatusResponse, name string) h.StatusComponent {
+		t.Helper()
+		for _, c := range resp.Components {
+			if c.Name == name {
+				return c
+			}
+		}
+		t.Fatalf("no %s component in %+v", name, resp.Components)
+		return h.StatusComponent{}
+	}
+
+	resp := status()
+	if resp.Status != h.StatusDegraded || component(resp, "database").Status != h.StatusOperational ||
+		component(resp, "redis").Status != h.StatusDown || len(resp.ActiveIncidents) != 0 {
+		t.Fatalf("expected a degraded status with Redis down, got %+v", resp)
+	}
+	h.SetStatusChecks()
+	if resp := status(); resp.Status != h.StatusOperational {
+		t.Fatalf("expected operational without failing checks, got %+v", resp)
+	}
+
+	cookies := registerAndLogin(t, router, "statusadmin", "secret123")
+	admin := adminClient(router, cookies)
+	if rr := admin(http.MethodPost, "/admin/incidents", `{"title": "x"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: expected 403, got %d", rr.Code)
+	}
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'statusadmin'`); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"message": "no title"}`, `{"title": "x", "severity": "apocalyptic"}`, `{"title": "  "}`} {
+		if rr := admin(http.MethodPost, "/admin/incidents", body); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, rr.Code)
+		}
+	}
+
+	rr := admin(http.MethodPost, "/admin/incidents", `{"title": "Search is down", "message": "We are on it.", "severity": "critical"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var incident h.Incident
+	if err := json.Unmarshal(rr.Body.Bytes(), &incident); err != nil {
+		t.Fatal(err)
+	}
+	if incident.Status != "investigating" || incident.ResolvedAt != nil {
+		t.Fatalf("unexpected incident: %+v", incident)
+	}
+	resp = status()
+	if resp.Status != h.StatusOutage || len(resp.ActiveIncidents) != 1 || resp.ActiveIncidents[0].Title != "Search is down" {
+		t.Fatalf("expected an outage with the incident, got %+v", resp)
+	}
+
+	rrPage := httptest.NewRecorder()
+	router.ServeHTTP(rrPage, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rrPage.Code != http.StatusOK || !strings.Contains(rrPage.Body.String(), "Search is down") {
+		t.Fatalf("status page: expected 200 with the incident, got %d", rrPage.Code)
+	}
+
+	path := "/admin/incidents/" + strconv.Itoa(incident.ID)
+	if rr := admin(http.MethodPatch, "/admin/incidents/999999", `{"status": "resolved"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown incident: expected 404, got %d", rr.Code)
+	}
+	rr = admin(http.MethodPatch, path, `{"status": "resolved"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("resolve: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	resp = status()
+	if resp.Status != h.StatusOperational || len(resp.ActiveIncidents) != 0 || len(resp.RecentIncidents) != 1 ||
+		resp.RecentIncidents[0].ResolvedAt == nil {
+		t.Fatalf("expected the incident in the history, got %+v", resp)
+	}
+
+	if rr := admin(http.MethodDelete, path, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", rr.Code)
+	}
+	if resp := status(); len(resp.RecentIncidents) != 0 {
+		t.Fatalf("expected no incidents after delete, got %+v", resp.RecentIncidents)
+	}
+	var audits int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action LIKE 'incident.%'`).Scan(&audits); err != nil || audits != 3 {
+		t.Fatalf("expected 3 incident audit entries, got %d (%v)", audits, err)
+	}
+}
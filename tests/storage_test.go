@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/storage"
+)
+
+// fakeS3 is a minimal in-memory S3 server for path-style requests. It checks that requests
+// are SigV4-signed and that the signed payload hash matches the body.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		http.Error(w, "<Error><Code>AccessDenied</Code><Message>unsigned</Message></Error>", http.StatusForbidden)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	if sum := sha256.Sum256(body); r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "<Error><Code>XAmzContentSHA256Mismatch</Code><Message>hash</Message></Error>", http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = body
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		if r.URL.Query().Get("list-type") == "2" {
+			f.list(w, r)
+			return
+		}
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[r.URL.Path])
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// list answers ListObjectsV2 for the bucket in the path, one key per page to exercise paging.
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	bucket := strings.TrimSuffix(r.URL.Path, "/") + "/"
+	var keys []string
+	for p := range f.objects {
+		key := strings.TrimPrefix(p, bucket)
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) && key > r.URL.Query().Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	w.Header().Set("Content-Type", "application/xml")
+	if len(keys) == 0 {
+		_, _ = io.WriteString(w, "<ListBucketResult><IsTruncated>false</IsTruncated></ListBucketResult>")
+		return
+	}
+	_, _ = fmt.Fprintf(w, "<ListBucketResult><IsTruncated>%t</IsTruncated><NextContinuationToken>%s</NextContinuationToken>"+
+		"<Contents><Key>%s</Key><Size>%d</Size><LastModified>2026-01-02T03:04:05.000Z</LastModified></Contents></ListBucketResult>",
+		len(keys) > 1, keys[0], keys[0], len(f.objects[bucket+keys[0]]))
+}
+
+func TestStorage_S3RoundTrip(t *testing.T) {
+	srv := httptest.NewServer(&fakeS3{objects: map[string][]byte{}, types: map[string]string{}})
+	defer srv.Close()
+
+	s, err := storage.New(storage.Config{Backend: "s3", S3: storage.S3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "whoknows",
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio-secret",
+		PathStyle:       true,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := storage.ExportPrefix + "7/archive.zip"
+
+	if err := s.Put(ctx, key, bytes.NewReader([]byte("zip bytes")), "application/zip"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	obj, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, _ := io.ReadAll(obj.Body)
+	_ = obj.Body.Close()
+	if string(data) != "zip bytes" || obj.ContentType != "application/zip" {
+		t.Fatalf("unexpected object: %q %q", data, obj.ContentType)
+	}
+
+	other := storage.ExportPrefix + "8/archive.zip"
+	if err := s.Put(ctx, other, strings.NewReader("more zip bytes"), "application/zip"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := s.Put(ctx, storage.AvatarPrefix+"7.png", strings.NewReader("png"), "image/png"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	listed, err := s.List(ctx, storage.ExportPrefix)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(listed) != 2 || listed[0].Key != key || listed[0].Size != 9 || listed[1].Key != other || listed[1].ModTime.IsZero() {
+		t.Fatalf("unexpected listing: %+v", listed)
+	}
+
+	signed, err := s.SignedURL(ctx, key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil || u.Path != "/whoknows/"+key || u.Query().Get("X-Amz-Expires") != "3600" || u.Query().Get("X-Amz-Signature") == "" {
+		t.Fatalf("unexpected presigned URL: %s", signed)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Get(ctx, key); err != storage.ErrNotFound {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := s.Put(ctx, "../escape", strings.NewReader("x"), ""); err != storage.ErrInvalidKey {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestStorage_FilesystemSignedURL(t *testing.T) {
+	s, err := storage.NewFilesystem(t.TempDir(), []byte("test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := storage.CrawlerPrefix + "page.html"
+	if err := s.Put(context.Background(), key, strings.NewReader("<html></html>"), "text/html"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := s.SignedURL(context.Background(), key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+	if u.Path != storage.FilesURLPrefix+key {
+		t.Fatalf("unexpected path %q", u.Path)
+	}
+	if err := s.VerifySignedURL(key, u.Query()); err != nil {
+		t.Fatalf("valid URL rejected: %v", err)
+	}
+	if err := s.VerifySignedURL(storage.CrawlerPrefix+"other.html", u.Query()); err != storage.ErrInvalidSignature {
+		t.Fatalf("signature must be bound to the key, got %v", err)
+	}
+	expired, _ := s.SignedURL(context.Background(), key, -time.Minute)
+	u, _ = url.Parse(expired)
+	if err := s.VerifySignedURL(key, u.Query()); err != storage.ErrInvalidSignature {
+		t.Fatalf("expected expired URL to be rejected, got %v", err)
+	}
+
+	if _, err := storage.New(storage.Config{Backend: "ftp"}); err == nil {
+		t.Fatal("expected an error for an unknown backend")
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// Admins manage tags and tag pages; tag browsing lists the tagged pages and the tag cloud
+// counts them.
+func TestTags_AdminAndBrowse(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	var welcome, about int
+	if err := db.QueryRow(`SELECT id FROM pages WHERE url = '/welcome'`).Scan(&welcome); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT id FROM pages WHERE url = '/about'`).Scan(&about); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := registerAndLogin(t, router, "tagger", "secret")
+	user := adminClient(router, cookies)
+	anon := adminClient(router, nil)
+	if rr := user(http.MethodPost, "/admin/tags", `{"name":"DevOps"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", rr.Code)
+	}
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'tagger'`); err != nil {
+		t.Fatal(err)
+	}
+	admin := user
+
+	rr := admin(http.MethodPost, "/admin/tags", `{"name":"  Dev Ops  "}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var devops h.Tag
+	if err := json.Unmarshal(rr.Body.Bytes(), &devops); err != nil || devops.Slug != "dev-ops" || devops.Name != "Dev Ops" {
+		t.Fatalf("unexpected tag: %s", rr.Body.String())
+	}
+	if rr := admin(http.MethodPost, "/admin/tags", `{"name":"dev_ops"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate slug, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPost, "/admin/tags", `{"name":"!!!"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty slug, got %d", rr.Code)
+	}
+	tagPath := "/admin/tags/" + strconv.Itoa(devops.ID)
+	rr = admin(http.MethodPatch, tagPath, `{"name":"DevOps","slug":"devops"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"slug":"devops"`) {
+		t.Fatalf("expected renamed tag, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Unknown names are created; duplicates (by slug) are collapsed.
+	rr = admin(http.MethodPut, "/api/pages/"+strconv.Itoa(welcome)+"/tags", `{"tags":["devops","Go","GO"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var set h.APITagsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &set); err != nil || len(set.Tags) != 2 {
+		t.Fatalf("expected two tags, got %s", rr.Body.String())
+	}
+	if rr := admin(http.MethodPut, "/api/pages/"+strconv.Itoa(about)+"/tags", `{"tags":["DevOps"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPut, "/api/pages/99999/tags", `{"tags":["x"]}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	if rr := anon(http.MethodPut, "/api/pages/"+strconv.Itoa(about)+"/tags", `{"tags":[]}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+
+	rr = anon(http.MethodGet, "/api/pages/"+strconv.Itoa(welcome), "")
+	var page h.PageView
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil || len(page.Tags) != 2 {
+		t.Fatalf("expected page with two tags, got %s", rr.Body.String())
+	}
+
+	rr = anon(http.MethodGet, "/api/tags", "")
+	var cloud h.APITagsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &cloud); err != nil || len(cloud.Tags) != 2 {
+		t.Fatalf("unexpected tag cloud: %s", rr.Body.String())
+	}
+	if cloud.Tags[0].Slug != "devops" || cloud.Tags[0].Pages != 2 || cloud.Tags[1].Slug != "go" || cloud.Tags[1].Pages != 1 {
+		t.Fatalf("unexpected tag cloud: %+v", cloud.Tags)
+	}
+
+	rr = user(http.MethodGet, "/api/search?tag=DevOps", "")
+	var res h.APISearchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil || len(res.SearchResults) != 2 {
+		t.Fatalf("expected both tagged pages, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if res.SearchResults[0].Title != "About Us" || res.SearchResults[1].Title != "Welcome" {
+		t.Fatalf("expected tagged pages by title, got %+v", res.SearchResults)
+	}
+
+	rr = anon(http.MethodGet, "/search?tag=go", "")
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "Welcome") || strings.Contains(body, "About Us</a></h3>") ||
+		!strings.Contains(body, `class="tag-cloud"`) || !strings.Contains(body, `href="/search?tag=devops`) {
+		t.Fatalf("unexpected tag browse page (%d):\n%s", rr.Code, body)
+	}
+
+	if rr := admin(http.MethodDelete, tagPath, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodDelete, tagPath, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", rr.Code)
+	}
+	var left int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM page_tags WHERE tag_id = ?`, devops.ID).Scan(&left); err != nil || left != 0 {
+		t.Fatalf("deleted tag should leave no page_tags rows, got %d (%v)", left, err)
+	}
+	var audited int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE target_type = 'tag' OR action = 'page.tags'`).Scan(&audited); err != nil || audited != 5 {
+		t.Fatalf("expected 5 audit entries, got %d (%v)", audited, err)
+	}
+}
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/i18n"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/gorilla/sessions"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// A template that fails midway is answered with the 500 error page, not a half-written 200.
+func TestTemplates_ExecErrorRendersErrorPage(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+
+	funcs := template.FuncMap{"year": func() int { return 2026 }, "t": i18n.T, "url": h.URL, "asset": h.Asset}
+	broken := template.Must(template.New("").Funcs(funcs).ParseGlob("../templates/*.html"))
+	// The index is out of range, so execution fails after the header has been rendered.
+	template.Must(broken.Parse(`{{define "about"}}{{template "header" .}}<p>half a page</p>{{index .Title 99}}{{end}}`))
+	h.Init(db, broken, sessions.NewCookieStore([]byte("test-key")))
+
+	before := testutil.ToFloat64(metrics.TemplateErrors.WithLabelValues("about"))
+	req := httptest.NewRequest(http.MethodGet, "/about", nil)
+	req.Header.Set("X-Request-ID", "tmpl-error-test")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	if strings.Contains(body, "half a page") || !strings.Contains(body, "Something went wrong") || !strings.Contains(body, "tmpl-error-test") {
+		t.Fatalf("expected only the error page with the request ID, got %s", body)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expected an HTML error page, got %q", ct)
+	}
+	if got := testutil.ToFloat64(metrics.TemplateErrors.WithLabelValues("about")) - before; got != 1 {
+		t.Fatalf("expected app_template_errors_total{template=\"about\"} to grow by 1, got %v", got)
+	}
+}
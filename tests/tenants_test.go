@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// Admins manage tenants; requests resolved to a tenant by path prefix or hostname only see
+// that tenant's pages, and the default tenant keeps the existing ones.
+func TestTenants_AdminAndScoping(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	handler := h.TenantMiddleware()(router)
+
+	cookies := registerAndLogin(t, router, "landlord", "secret")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'landlord'`); err != nil {
+		t.Fatal(err)
+	}
+	admin := adminClient(handler, cookies)
+	anon := adminClient(handler, nil)
+
+	rr := admin(http.MethodPost, "/admin/tenants", `{"name":"Docs Site","hostname":"Docs.Example.com:8080"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var docs h.Tenant
+	if err := json.Unmarshal(rr.Body.Bytes(), &docs); err != nil || docs.Slug != "docs-site" || docs.Hostname != "docs.example.com" {
+		t.Fatalf("unexpected tenant: %s", rr.Body.String())
+	}
+	if rr := admin(http.MethodPost, "/admin/tenants", `{"name":"Other","hostname":"docs.example.com"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a taken hostname, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPost, "/admin/tenants", `{"name":"Bad","hostname":"not a host"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid hostname, got %d", rr.Code)
+	}
+	tenantPath := "/admin/tenants/" + strconv.Itoa(docs.ID)
+	if rr := admin(http.MethodPatch, tenantPath, `{"slug":"docs"}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"slug":"docs"`) {
+		t.Fatalf("expected renamed slug, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := admin(http.MethodPatch, "/admin/tenants/1", `{"slug":"main"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for the default tenant's slug, got %d", rr.Code)
+	}
+
+	// The same URL may exist in both tenants.
+	res, err := db.Exec(`INSERT INTO pages (title, url, language, content, tenant_id) VALUES ('Welcome to the docs', '/welcome', 'en', 'Docs home', ?)`, docs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docsPage, _ := res.LastInsertId()
+	var welcome int
+	if err := db.QueryRow(`SELECT id FROM pages WHERE url = '/welcome' AND tenant_id = 1`).Scan(&welcome); err != nil {
+		t.Fatal(err)
+	}
+	if rr := admin(http.MethodPut, "/api/pages/"+strconv.Itoa(welcome)+"/tags", `{"tags":["Guide"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodPut, "/t/docs/api/pages/"+strconv.Itoa(int(docsPage))+"/tags", `{"tags":["Guide"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 within the tenant, got %d", rr.Code)
+	}
+
+	searchTitles := func(req *http.Request) []string {
+		t.Helper()
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		var res h.APISearchResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatalf("bad search response (%d): %s", rr.Code, rr.Body.String())
+		}
+		var titles []string
+		for _, r := range res.SearchResults {
+			titles = append(titles, r.Title)
+		}
+		return titles
+	}
+	if got := searchTitles(httptest.NewRequest(http.MethodGet, "/api/search?tag=guide", nil)); len(got) != 1 || got[0] != "Welcome" {
+		t.Fatalf("default tenant should only see its page, got %v", got)
+	}
+	if got := searchTitles(httptest.NewRequest(http.MethodGet, "/t/docs/api/search?tag=guide", nil)); len(got) != 1 || got[0] != "Welcome to the docs" {
+		t.Fatalf("path prefix should select the docs tenant, got %v", got)
+	}
+	byHost := httptest.NewRequest(http.MethodGet, "/api/search?tag=guide", nil)
+	byHost.Host = "DOCS.example.com"
+	if got := searchTitles(byHost); len(got) != 1 || got[0] != "Welcome to the docs" {
+		t.Fatalf("hostname should select the docs tenant, got %v", got)
+	}
+
+	if rr := anon(http.MethodGet, "/api/suggest?q=welcome", ""); !strings.Contains(rr.Body.String(), `["Welcome"]`) {
+		t.Fatalf("unexpected default suggestions: %s", rr.Body.String())
+	}
+	if rr := anon(http.MethodGet, "/t/docs/api/suggest?q=welcome", ""); !strings.Contains(rr.Body.String(), `["Welcome to the docs"]`) {
+		t.Fatalf("unexpected docs suggestions: %s", rr.Body.String())
+	}
+	if rr := anon(http.MethodGet, "/api/pages/"+strconv.Itoa(int(docsPage)), ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("another tenant's page must not be found, got %d", rr.Code)
+	}
+	if rr := anon(http.MethodGet, "/t/docs/api/pages/"+strconv.Itoa(int(docsPage)), ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected the docs page within its tenant, got %d", rr.Code)
+	}
+	if rr := anon(http.MethodGet, "/t/nope/api/search?q=x", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown tenant, got %d", rr.Code)
+	}
+
+	rr = admin(http.MethodGet, "/admin/tenants", "")
+	var list h.APITenantsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Tenants) != 2 || list.Tenants[0].Slug != "default" || list.Tenants[1].Pages != 1 {
+		t.Fatalf("unexpected tenant list: %s", rr.Body.String())
+	}
+
+	if rr := admin(http.MethodDelete, tenantPath, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while the tenant has pages, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodDelete, "/admin/tenants/1", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for the default tenant, got %d", rr.Code)
+	}
+	if _, err := db.Exec(`DELETE FROM pages WHERE id = ?`, docsPage); err != nil {
+		t.Fatal(err)
+	}
+	if rr := admin(http.MethodDelete, tenantPath, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if rr := anon(http.MethodGet, "/t/docs/api/suggest?q=welcome", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("a deleted tenant's prefix should 404, got %d", rr.Code)
+	}
+	var audited int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE target_type = 'tenant'`).Scan(&audited); err != nil || audited != 3 {
+		t.Fatalf("expected 3 audit entries, got %d (%v)", audited, err)
+	}
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"devops-valgfag/internal/snippet"
+	"devops-valgfag/internal/textnorm"
+)
+
+func TestTextnorm_QueryAndFold(t *testing.T) {
+	// "å" typed as a + combining ring (NFD, as macOS does) is the same query as the precomposed letter.
+	if a, b := textnorm.Query("  Bla\u030abær   GRØD"), textnorm.Query("blåbær grød"); a != b || a != "blåbær grød" {
+		t.Fatalf("expected equal NFC queries, got %q and %q", a, b)
+	}
+	for in, want := range map[string]string{
+		"Blåbærgrød":     "blabaergrod",
+		"Ærø":            "aero",
+		"Kø på Nørrebro": "ko pa norrebro",
+		"crème brûlée":   "creme brulee",
+		"Straße":         "strasse",
+		"plain ascii":    "plain ascii",
+	} {
+		if got := textnorm.Fold(in); got != want {
+			t.Errorf("Fold(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// Snippets centre on an accent-insensitive match, also where folding changes the length (æ is "ae").
+func TestTextnorm_SnippetMatchesDanish(t *testing.T) {
+	text := strings.Repeat("Opskrifter fra det danske køkken. ", 10) +
+		"Blåbærgrød serveres med fløde. " + strings.Repeat("Flere retter følger her. ", 10)
+	for _, q := range []string{"blabaergrod", "BLÅBÆRGRØD", "blabærgrod"} {
+		got := snippet.Around(text, q, 80)
+		if i := strings.Index(got, "Blåbærgrød"); i < 0 || !strings.HasPrefix(got, snippet.Ellipsis) {
+			t.Fatalf("%q: expected a window around the match, got %q", q, got)
+		}
+	}
+	if got := snippet.Around(text, "flode", 60); !strings.Contains(got, "fløde") {
+		t.Fatalf("expected a match on fløde, got %q", got)
+	}
+}
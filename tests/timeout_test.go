@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// A request over its route's budget gets 504 while its handler sees the context end; other
+// routes keep their own budget, and the event stream and file downloads have none.
+func TestTimeout_RouteBudgets(t *testing.T) {
+	canceled := make(chan error, 1)
+	deadlines := map[string]time.Duration{}
+	remaining := func(w http.ResponseWriter, r *http.Request) {
+		if d, ok := r.Context().Deadline(); ok {
+			deadlines[r.URL.Path] = time.Until(d)
+		} else {
+			deadlines[r.URL.Path] = 0
+		}
+		w.Header().Set("X-Handled", "1")
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	r := mux.NewRouter()
+	r.Use(h.RequestIDMiddleware())
+	r.Use(h.RecoverMiddleware())
+	r.Use(h.TimeoutMiddleware())
+	r.HandleFunc("/api/search", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		canceled <- r.Context().Err()
+		http.Error(w, "too late", http.StatusInternalServerError)
+	})
+	r.HandleFunc("/api/weather", remaining)
+	r.HandleFunc("/admin/sitemap", remaining)
+	r.HandleFunc("/events", remaining)
+	r.HandleFunc("/files/{key:.+}", remaining)
+	r.HandleFunc("/about", remaining)
+	r.HandleFunc("/boom", func(http.ResponseWriter, *http.Request) { panic("boom") })
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	start := time.Now()
+	rec := get("/api/search")
+	if took := time.Since(start); rec.Code != http.StatusGatewayTimeout || took < h.SearchRouteTimeout || took > h.SearchRouteTimeout+time.Second {
+		t.Fatalf("expected 504 after the search budget, got %d after %s", rec.Code, took)
+	}
+	if !strings.Contains(rec.Body.String(), `"request_id":"`+rec.Header().Get("X-Request-ID")+`"`) || strings.Contains(rec.Body.String(), "too late") {
+		t.Fatalf("expected the JSON timeout error only, got %s", rec.Body.String())
+	}
+	if err := <-canceled; err == nil {
+		t.Fatal("expected the handler's context to be canceled")
+	}
+
+	for path, want := range map[string]time.Duration{
+		"/api/weather":   h.WeatherRouteTimeout,
+		"/admin/sitemap": h.AdminRouteTimeout,
+		"/about":         h.DefaultRouteTimeout,
+		"/events":        0,
+		"/files/b/x.gz":  0,
+	} {
+		rec := get(path)
+		if rec.Code != http.StatusCreated || rec.Header().Get("X-Handled") != "1" {
+			t.Fatalf("%s: expected the handler's response, got %d", path, rec.Code)
+		}
+		if got := deadlines[path]; got > want || got < want-time.Second {
+			t.Errorf("%s: expected a budget of %s, got %s", path, want, got)
+		}
+	}
+
+	if rec := get("/boom"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("a panic must still reach RecoverMiddleware, got %d", rec.Code)
+	}
+}
+
+// A handler that flushes streams its response: what it sent stays, and the end of the budget
+// only cancels its context instead of answering 504.
+func TestTimeout_FlushStreams(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(h.TimeoutMiddleware())
+	r.HandleFunc("/api/search", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush: %v", err)
+		}
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond) // let the middleware stop the writer
+		_, _ = w.Write([]byte(" late"))
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search", nil))
+	if rec.Code != http.StatusOK || !rec.Flushed || rec.Body.String() != "partial" {
+		t.Fatalf("expected the streamed response only, got %d %q (flushed %v)", rec.Code, rec.Body.String(), rec.Flushed)
+	}
+}
+
+// Routes without a budget lift the server-wide WriteTimeout, so a slow download finishes.
+func TestTimeout_DownloadsOutliveWriteTimeout(t *testing.T) {
+	slow := func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("first "))
+		_ = http.NewResponseController(w).Flush()
+		time.Sleep(300 * time.Millisecond)
+		_, _ = w.Write([]byte("last"))
+	}
+	r := mux.NewRouter()
+	r.Use(metrics.RequestMetricsMiddleware())
+	r.Use(h.RequestIDMiddleware())
+	r.Use(h.RecoverMiddleware())
+	r.Use(h.TimeoutMiddleware())
+	r.HandleFunc("/files/{key:.+}", slow)
+	r.HandleFunc("/api/me/export", slow)
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	for _, path := range []string{"/files/backups/db.sql.gz", "/api/me/export"} {
+		resp, err := srv.Client().Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil || string(body) != "first last" {
+			t.Fatalf("%s: expected the whole body, got %q (%v)", path, body, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	h "devops-valgfag/handlers"
+	"devops-valgfag/internal/metrics"
+	"devops-valgfag/internal/traffic"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTraffic_Classify(t *testing.T) {
+	cases := []struct {
+		ua, path, want string
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0", "/", traffic.ClassBrowser},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "/", traffic.ClassBot},
+		{"facebookexternalhit/1.1", "/about", traffic.ClassBot},
+		{"Mozilla/5.0 HeadlessChrome/120.0", "/", traffic.ClassBot},
+		{"curl/8.5.0", "/", traffic.ClassAPI},
+		{"python-requests/2.32", "/api/search", traffic.ClassAPI},
+		{"my-integration/1.0", "/api/search", traffic.ClassAPI},
+		{"my-integration/1.0", "/about", traffic.ClassBot},
+		{"", "/api/search", traffic.ClassBot},
+	}
+	for _, c := range cases {
+		if got := traffic.Classify(c.ua, c.path); got != c.want {
+			t.Errorf("Classify(%q, %q) = %q, want %q", c.ua, c.path, got, c.want)
+		}
+	}
+}
+
+func TestTraffic_Source(t *testing.T) {
+	cases := []struct {
+		referer, want string
+	}{
+		{"", traffic.SourceDirect},
+		{"https://whoknows.example/search?q=go", traffic.SourceInternal},
+		{"https://www.google.dk/", traffic.SourceSearch},
+		{"https://duckduckgo.com/?q=whoknows", traffic.SourceSearch},
+		{"https://t.co/abc", traffic.SourceSocial},
+		{"https://old.reddit.com/r/golang", traffic.SourceSocial},
+		{"https://blog.example.org/post", traffic.SourceOther},
+		{"android-app://com.example", traffic.SourceOther},
+	}
+	for _, c := range cases {
+		if got := traffic.Source(c.referer, "whoknows.example:8080"); got != c.want {
+			t.Errorf("Source(%q) = %q, want %q", c.referer, got, c.want)
+		}
+	}
+	if got := traffic.ReferrerHost("https://WWW.Example.com:443/path"); got != "example.com" {
+		t.Fatalf("ReferrerHost = %q, want example.com", got)
+	}
+}
+
+// Requests are counted per class and route template, flushed into the daily tables and
+// reported on /admin/reports/traffic; probes are not counted.
+func TestTraffic_MiddlewareFlushAndReport(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	ctx := context.Background()
+	if err := h.FlushTrafficStats(ctx); err != nil { // counts left by other tests
+		t.Fatal(err)
+	}
+	for _, table := range []string{"traffic_daily", "referrers_daily"} {
+		if _, err := db.Exec(`DELETE FROM ` + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const browser = "Mozilla/5.0 (Macintosh) AppleWebKit/605.1.15 Safari/605.1.15"
+	botAbout := metrics.ClientRequests.WithLabelValues(traffic.ClassBot, "/about")
+	fromSearch := metrics.Referrals.WithLabelValues(traffic.SourceSearch)
+	startBot, startSearch := testutil.ToFloat64(botAbout), testutil.ToFloat64(fromSearch)
+
+	get := func(path, ua, referer string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("User-Agent", ua)
+		if referer != "" {
+			req.Header.Set("Referer", referer)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	get("/about", browser, "https://www.google.com/")
+	get("/about", browser, "https://news.ycombinator.com/item?id=1")
+	get("/about", browser, "http://example.com/search") // httptest requests are for example.com: internal
+	get("/about", browser, "https://blog.example.org/post")
+	get("/about", "Mozilla/5.0 (compatible; bingbot/2.0)", "")
+	get("/api/pages/1", "curl/8.5.0", "https://www.google.com/")
+	get("/api/pages/2", "curl/8.5.0", "")
+	get("/healthz", "kube-probe/1.30", "")
+
+	if got := testutil.ToFloat64(botAbout) - startBot; got != 1 {
+		t.Fatalf("expected 1 bot request to /about, got %v", got)
+	}
+	if got := testutil.ToFloat64(fromSearch) - startSearch; got != 1 {
+		t.Fatalf("expected 1 page view from a search engine (API calls are not page views), got %v", got)
+	}
+
+	if err := h.FlushTrafficStats(ctx); err != nil {
+		t.Fatal(err)
+	}
+	get("/about", browser, "")
+	if err := h.FlushTrafficStats(ctx); err != nil { // adds to today's rows
+		t.Fatal(err)
+	}
+
+	cookies := registerAndLogin(t, router, "trafficadmin", "secret123")
+	if _, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = 'trafficadmin'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.FlushTrafficStats(ctx); err != nil { // drop the register/login requests
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DELETE FROM traffic_daily WHERE path NOT IN ('/about', '/api/pages/{id:[0-9]+}')`); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := adminClient(router, cookies)(http.MethodGet, "/admin/reports/traffic?days=7", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("traffic report: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report h.TrafficReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.ByClass[traffic.ClassBrowser] != 5 || report.ByClass[traffic.ClassBot] != 1 || report.ByClass[traffic.ClassAPI] != 2 {
+		t.Fatalf("unexpected totals by class: %+v", report.ByClass)
+	}
+	if len(report.Paths) != 2 || report.Paths[0].Path != "/about" || report.Paths[0].Browser != 5 || report.Paths[0].Bot != 1 ||
+		report.Paths[1].Path != "/api/pages/{id:[0-9]+}" || report.Paths[1].API != 2 {
+		t.Fatalf("unexpected paths: %+v", report.Paths)
+	}
+	want := map[string]int64{"google.com": 1, "news.ycombinator.com": 1, "blog.example.org": 1}
+	if len(report.Referrers) != len(want) {
+		t.Fatalf("unexpected referrers: %+v", report.Referrers)
+	}
+	for _, ref := range report.Referrers {
+		if want[ref.Referrer] != ref.Requests {
+			t.Fatalf("unexpected referrers: %+v", report.Referrers)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"devops-valgfag/internal/httpclient"
+	"devops-valgfag/internal/urlcheck"
+)
+
+func TestURLCheck_Parse(t *testing.T) {
+	for raw, want := range map[string]error{
+		"https://en.wikipedia.org/wiki/Go":   nil,
+		"http://93.184.216.34:8080/x":        nil,
+		"https://[2606:4700::1]/":            nil,
+		"javascript:alert(1)":                urlcheck.ErrScheme,
+		"file:///etc/passwd":                 urlcheck.ErrScheme,
+		"gopher://example.com/":              urlcheck.ErrScheme,
+		"/relative/path":                     urlcheck.ErrScheme,
+		"https://user:pw@example.com/":       urlcheck.ErrCredentials,
+		"http:///nohost":                     urlcheck.ErrHost,
+		"http://127.0.0.1/":                  urlcheck.ErrPrivateAddress,
+		"http://localhost:8080/":             urlcheck.ErrPrivateAddress,
+		"http://10.1.2.3/":                   urlcheck.ErrPrivateAddress,
+		"http://192.168.0.1/":                urlcheck.ErrPrivateAddress,
+		"http://169.254.169.254/latest/meta": urlcheck.ErrPrivateAddress,
+		"http://100.64.0.1/":                 urlcheck.ErrPrivateAddress,
+		"http://0.0.0.0/":                    urlcheck.ErrPrivateAddress,
+		"http://[::1]/":                      urlcheck.ErrPrivateAddress,
+		"http://[fd00::1]/":                  urlcheck.ErrPrivateAddress,
+		"http://[fe80::1]/":                  urlcheck.ErrPrivateAddress,
+		"http://[::ffff:127.0.0.1]/":         urlcheck.ErrPrivateAddress,
+		"http://[64:ff9b::a00:1]/":           urlcheck.ErrPrivateAddress,
+		"http://[2002:c0a8:1::1]/":           urlcheck.ErrPrivateAddress,
+	} {
+		_, err := urlcheck.Parse(raw)
+		if want == nil && err != nil || want != nil && !errors.Is(err, want) {
+			t.Errorf("%s: expected %v, got %v", raw, want, err)
+		}
+	}
+	if !urlcheck.PublicAddr(netip.MustParseAddr("8.8.8.8")) || urlcheck.PublicAddr(netip.MustParseAddr("224.0.0.1")) {
+		t.Fatal("unexpected PublicAddr result")
+	}
+}
+
+// Check resolves the host: a name pointing at a private address is rejected.
+func TestURLCheck_CheckResolves(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := urlcheck.Check(ctx, "http://localhost./x"); !errors.Is(err, urlcheck.ErrPrivateAddress) {
+		t.Fatalf("expected localhost to be rejected, got %v", err)
+	}
+}
+
+// Control refuses the connection itself, whatever the name resolved to before, and untrusted
+// clients never reach a local server.
+func TestURLCheck_ControlAndUntrustedClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/trusted" {
+			t.Errorf("untrusted client reached %s", r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	dialer := &net.Dialer{Timeout: time.Second, Control: urlcheck.Control}
+	if _, err := dialer.Dial("tcp", srv.Listener.Addr().String()); !errors.Is(err, urlcheck.ErrPrivateAddress) {
+		t.Fatalf("expected the dial to be refused, got %v", err)
+	}
+
+	client := httpclient.NewUntrusted("urlchecktest", 5*time.Second)
+	for _, u := range []string{srv.URL, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)} {
+		if resp, err := client.Get(u); !errors.Is(err, urlcheck.ErrPrivateAddress) {
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			t.Fatalf("%s: expected the request to be refused, got %v", u, err)
+		}
+	}
+	// Trusted clients (configured endpoints) are unaffected.
+	resp, err := httpclient.New("urlchecktest", 5*time.Second).Get(srv.URL + "/trusted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+}
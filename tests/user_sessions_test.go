@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+
+	"github.com/gorilla/sessions"
+)
+
+// Each login is listed with its device; revoking one logs that device out (its remember-me
+// token included) while the others stay logged in, and other users' sessions are off limits.
+func TestUserSessions_ListAndRevoke(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	laptop := registerAndLogin(t, router, "nora", "secret123")
+
+	form := url.Values{"username": {"nora"}, "password": {"secret123"}, "remember": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Android 14; Mobile; rv:128.0) Gecko/128.0 Firefox/128.0")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("phone login: expected 302, got %d", rr.Code)
+	}
+	phone := rr.Result().Cookies()
+
+	list := func(cookies []*http.Cookie) []h.UserSession {
+		t.Helper()
+		rr := bookmarkRequest(router, http.MethodGet, "/api/me/sessions", "", cookies)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("list: expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp h.APIUserSessionsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Sessions
+	}
+
+	sessions := list(laptop)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", sessions)
+	}
+	var phoneID int64
+	for _, s := range sessions {
+		if s.Device == "Firefox on Android" {
+			phoneID = s.ID
+			if s.Current || s.IP == "" {
+				t.Fatalf("unexpected phone session: %+v", s)
+			}
+		} else if !s.Current {
+			t.Fatalf("expected the laptop session to be current: %+v", s)
+		}
+	}
+	if phoneID == 0 {
+		t.Fatalf("phone session not listed: %+v", sessions)
+	}
+
+	path := fmt.Sprintf("/api/me/sessions/%d", phoneID)
+	other := registerAndLogin(t, router, "otto", "secret123")
+	if rr := bookmarkRequest(router, http.MethodDelete, path, "", other); rr.Code != http.StatusNotFound {
+		t.Fatalf("other user: expected 404, got %d", rr.Code)
+	}
+	if rr := bookmarkRequest(router, http.MethodDelete, path, "", laptop); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke: expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The phone is logged out, and its remember cookie no longer logs it back in.
+	if rr := bookmarkRequest(router, http.MethodGet, "/api/me/bookmarks", "", phone); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked session: expected 401, got %d", rr.Code)
+	}
+	var tokens int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM remember_tokens`).Scan(&tokens); err != nil || tokens != 0 {
+		t.Fatalf("expected the remember token to be revoked, got %d (%v)", tokens, err)
+	}
+	if sessions := list(laptop); len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("expected only the laptop session, got %+v", sessions)
+	}
+
+	// Logout removes the session from the list.
+	if rr := bookmarkRequest(router, http.MethodPost, "/api/logout", "", laptop); rr.Code != http.StatusFound {
+		t.Fatalf("logout: expected 302, got %d", rr.Code)
+	}
+	var left int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM user_sessions s JOIN users u ON u.id = s.user_id WHERE u.username = 'nora'`).Scan(&left); err != nil || left != 0 {
+		t.Fatalf("expected no sessions after logout, got %d (%v)", left, err)
+	}
+}
+
+// A session from before tracking gets a row on its next request instead of being logged out;
+// one whose row was deleted is logged out.
+func TestUserSessions_UntrackedSessionIsRecorded(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer closeDB(t, db)
+	registerAndLogin(t, router, "ivan", "secret123")
+	var userID int
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = 'ivan'`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cookie as startSession wrote it before sessions were tracked (same key as setupTestServer).
+	store := sessions.NewCookieStore([]byte("test-key"))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	sess, _ := store.New(req, "session")
+	sess.Values["user_id"] = userID
+	sess.Values["session_version"] = 0
+	rec := httptest.NewRecorder()
+	if err := sess.Save(req, rec); err != nil {
+		t.Fatal(err)
+	}
+	legacy := rec.Result().Cookies()
+
+	rr := bookmarkRequest(router, http.MethodGet, "/api/me/sessions", "", legacy)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("legacy session: expected 200, got %d", rr.Code)
+	}
+	tracked := findCookie(rr.Result().Cookies(), "session")
+	if tracked == nil {
+		t.Fatal("expected the session cookie to be updated with its key")
+	}
+	var rows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM user_sessions WHERE user_id = $1`, userID).Scan(&rows); err != nil || rows != 2 {
+		t.Fatalf("expected the legacy session to be recorded, got %d rows (%v)", rows, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM user_sessions`); err != nil {
+		t.Fatal(err)
+	}
+	if rr := bookmarkRequest(router, http.MethodGet, "/api/me/bookmarks", "", []*http.Cookie{tracked}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a session without a row, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	h "devops-valgfag/handlers"
+)
+
+// One vote per user and page; voting again replaces it and DELETE removes it.
+func TestResultVotes(t *testing.T) {
+	router, db := setupTestServer(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+
+	var pageID string
+	if err := db.QueryRow(`SELECT CAST(id AS TEXT) FROM pages WHERE url = '/welcome'`).Scan(&pageID); err != nil {
+		t.Fatalf("sample page missing: %v", err)
+	}
+	path := "/api/pages/" + pageID + "/vote"
+
+	vote := func(method, body string, cookies []*http.Cookie) (*httptest.ResponseRecorder, h.VoteSummary) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var s h.VoteSummary
+		_ = json.Unmarshal(rr.Body.Bytes(), &s)
+		return rr, s
+	}
+
+	if rr, _ := vote(http.MethodPut, `{"helpful":true}`, nil); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", rr.Code)
+	}
+
+	alice := registerAndLogin(t, router, "alice", "secret")
+	bob := registerAndLogin(t, router, "bob", "secret")
+
+	vote(http.MethodPut, `{"helpful":true}`, alice)
+	rr, s := vote(http.MethodPut, `{"helpful":false}`, bob)
+	if rr.Code != http.StatusOK || s.Helpful != 1 || s.Unhelpful != 1 || s.YourVote != -1 {
+		t.Fatalf("unexpected summary after two votes: %d %+v", rr.Code, s)
+	}
+
+	// Changing a vote replaces it.
+	_, s = vote(http.MethodPut, `{"helpful":true}`, bob)
+	if s.Helpful != 2 || s.Unhelpful != 0 || s.YourVote != 1 {
+		t.Fatalf("unexpected summary after changed vote: %+v", s)
+	}
+
+	_, s = vote(http.MethodDelete, "", bob)
+	if s.Helpful != 1 || s.YourVote != 0 {
+		t.Fatalf("unexpected summary after delete: %+v", s)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/pages/999999/vote", strings.NewReader(`{"helpful":true}`))
+	for _, c := range alice {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown page, got %d", rec.Code)
+	}
+}